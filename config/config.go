@@ -1,29 +1,305 @@
 // Package config provides configuration management for the application
+//
+// Configuration is built in three layers, each overriding the previous one:
+//  1. Built-in defaults (NewConfig)
+//  2. An optional YAML or TOML file named by the WG_CONFIG_FILE environment variable
+//  3. WG_* environment variables (see settings in load.go)
 package config
 
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Environments the application can run in
+const (
+	EnvDevelopment = "development"
+	EnvStaging     = "staging"
+	EnvProduction  = "production"
+)
+
+// DevJWTSecret is the JWT secret used when none is configured.
+// It is only accepted in the development environment.
+const DevJWTSecret = "wg-edu-dev-secret-change-me"
+
 // Config holds all application configurations
 type Config struct {
-	DBHost     string
-	DBPort     string
-	DBName     string
-	DBUser     string
-	DBPassword string
+	Env string // Deployment environment: development, staging or production; required
+
+	DBHost            string
+	DBPort            string
+	DBName            string
+	DBUser            string
+	DBPassword        string
+	DBSSLMode         string        // PostgreSQL sslmode (disable, require, verify-full, ...)
+	DBMaxOpenConns    int           // Maximum open connections, 0 for unlimited
+	DBMaxIdleConns    int           // Maximum idle connections kept in the pool
+	DBConnMaxLifetime time.Duration // Maximum lifetime of a pooled connection, 0 for unlimited
+
 	JWTSecret  string
 	ServerPort string
+
+	CORSAllowedOrigins []string // Origins allowed to make cross-origin requests, "*" for any
+	TrustedProxies     []string // Proxy addresses or CIDRs whose X-Forwarded-For header gives the client address
+
+	PasswordHasher  string        // Password hashing algorithm: bcrypt or argon2id
+	AccessTokenTTL  time.Duration // Lifetime of JWT access tokens
+	RefreshTokenTTL time.Duration // Lifetime of refresh tokens
+
+	AttendanceThreshold float64 // Attendance percentage below which students are reported
+
+	StorageDir string // Directory uploaded homework files and project drafts are stored in
+
+	MailDriver   string // Mail delivery: smtp, or log to keep messages local
+	MailFrom     string // Sender of outgoing mail
+	MailDir      string // Directory the log driver saves messages in, empty to log them
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string // Empty to send without authentication
+	SMTPPassword string
+
+	PublicURL string // Base URL clients reach the API at, used in links such as calendar feeds
+
+	PasswordResetURL string        // Page of the web app that takes the reset token as ?token=
+	PasswordResetTTL time.Duration // Lifetime of password reset tokens
+
+	LoginAttemptsBackend   string        // Where login attempts are counted: postgres, shared by instances, or memory
+	LoginAttemptsRetention time.Duration // How long login attempts are kept for review
+	LoginWindow            time.Duration // Sliding window failed logins are counted in
+	LoginMaxIPFailures     int           // Failures from one address in the window before it is refused
+	LoginMaxUserFailures   int           // Failures of one username in the window before it is refused
+	LoginFreeFailures      int           // Failures of one username before each attempt must wait
+	LoginDelay             time.Duration // First wait between attempts, doubled after each further failure
+	LoginMaxDelay          time.Duration // Longest wait between attempts
+	LoginLockoutThreshold  int           // Failures of one account in the window that lock it, 0 to never lock
+	LoginLockoutDuration   time.Duration // How long a locked account refuses logins
+
+	MFAIssuer        string   // Service name authenticator apps show next to the account
+	MFARequiredRoles []string // Roles that must complete two-factor authentication for sensitive routes
 }
 
-// NewConfig returns a new Config with the default values
+// NewConfig returns a new Config with the default values. The environment
+// has no default, so a deployment that does not name one fails validation
+// instead of running with the development secret and CORS policy.
 //
 // Returns:
-//   - Config: Configuration object with default values
+//   - Config: Configuration object with default values suitable for local development once Env is set
 func NewConfig() Config {
 	return Config{
-		DBHost:     "47.79.6.81",
-		DBPort:     "5432",
-		DBName:     "WG_EDU",
-		DBUser:     "longdelao",
-		DBPassword: "2008",
-		JWTSecret:  "wg-edu-secret-key",
+		DBHost:            "localhost",
+		DBPort:            "5432",
+		DBName:            "wg_edu",
+		DBUser:            "postgres",
+		DBPassword:        "",
+		DBSSLMode:         "disable",
+		DBMaxOpenConns:    25,
+		DBMaxIdleConns:    5,
+		DBConnMaxLifetime: 30 * time.Minute,
+
+		JWTSecret:  DevJWTSecret,
 		ServerPort: ":8080",
+
+		CORSAllowedOrigins: []string{"*"},
+
+		PasswordHasher:  "bcrypt",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+
+		AttendanceThreshold: 90,
+
+		StorageDir: "uploads",
+
+		MailDriver: "log",
+		MailFrom:   "WG Education <no-reply@localhost>",
+		SMTPPort:   "587",
+
+		PublicURL: "http://localhost:8080",
+
+		PasswordResetURL: "http://localhost:3000/reset-password",
+		PasswordResetTTL: time.Hour,
+
+		LoginAttemptsBackend:   "postgres",
+		LoginAttemptsRetention: 30 * 24 * time.Hour,
+		LoginWindow:            15 * time.Minute,
+		LoginMaxIPFailures:     100,
+		LoginMaxUserFailures:   10,
+		LoginFreeFailures:      3,
+		LoginDelay:             time.Second,
+		LoginMaxDelay:          30 * time.Second,
+		LoginLockoutThreshold:  5,
+		LoginLockoutDuration:   15 * time.Minute,
+
+		MFAIssuer: "WG Education",
+	}
+}
+
+// IsDevelopment reports whether the application runs in the development environment
+func (c Config) IsDevelopment() bool {
+	return c.Env == EnvDevelopment
+}
+
+// Validate checks that the configuration is complete and safe to run with
+//
+// Returns:
+//   - error: Error listing every problem found, nil if the configuration is valid
+func (c Config) Validate() error {
+	var problems []string
+
+	required := map[string]string{
+		"env":                c.Env,
+		"db_host":            c.DBHost,
+		"db_port":            c.DBPort,
+		"db_name":            c.DBName,
+		"db_user":            c.DBUser,
+		"jwt_secret":         c.JWTSecret,
+		"server_port":        c.ServerPort,
+		"storage_dir":        c.StorageDir,
+		"mail_from":          c.MailFrom,
+		"public_url":         c.PublicURL,
+		"password_reset_url": c.PasswordResetURL,
+		"mfa_issuer":         c.MFAIssuer,
 	}
+	for _, s := range settings {
+		if value, ok := required[s.key]; ok && value == "" {
+			problems = append(problems, fmt.Sprintf("%s (%s) is required", s.key, s.env()))
+		}
+	}
+
+	switch c.Env {
+	case "", EnvDevelopment, EnvStaging, EnvProduction:
+	default:
+		problems = append(problems, fmt.Sprintf("env must be %s, %s or %s, got %q",
+			EnvDevelopment, EnvStaging, EnvProduction, c.Env))
+	}
+
+	if !c.IsDevelopment() {
+		if c.JWTSecret == DevJWTSecret {
+			problems = append(problems, "jwt_secret must be changed from the default outside development")
+		} else if len(c.JWTSecret) < 32 {
+			problems = append(problems, "jwt_secret must be at least 32 characters outside development")
+		}
+	}
+
+	switch c.DBSSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		problems = append(problems, fmt.Sprintf("db_sslmode %q is not a valid PostgreSQL sslmode", c.DBSSLMode))
+	}
+
+	if c.DBMaxOpenConns < 0 || c.DBMaxIdleConns < 0 || c.DBConnMaxLifetime < 0 {
+		problems = append(problems, "database pool settings must not be negative")
+	}
+
+	switch c.PasswordHasher {
+	case "bcrypt", "argon2id":
+	default:
+		problems = append(problems, fmt.Sprintf("password_hasher must be bcrypt or argon2id, got %q", c.PasswordHasher))
+	}
+
+	if c.AccessTokenTTL <= 0 || c.RefreshTokenTTL <= 0 {
+		problems = append(problems, "token lifetimes must be positive")
+	} else if c.RefreshTokenTTL < c.AccessTokenTTL {
+		problems = append(problems, "refresh_token_ttl must not be shorter than access_token_ttl")
+	}
+
+	if c.AttendanceThreshold <= 0 || c.AttendanceThreshold > 100 {
+		problems = append(problems, fmt.Sprintf("attendance_threshold must be a percentage above 0 and at most 100, got %g", c.AttendanceThreshold))
+	}
+
+	switch c.MailDriver {
+	case "log":
+	case "smtp":
+		if c.SMTPHost == "" || c.SMTPPort == "" {
+			problems = append(problems, "smtp_host and smtp_port are required with the smtp mail_driver")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("mail_driver must be smtp or log, got %q", c.MailDriver))
+	}
+
+	if c.PublicURL != "" {
+		if u, err := url.Parse(c.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("public_url must be an absolute http or https URL, got %q", c.PublicURL))
+		}
+	}
+
+	if c.PasswordResetTTL <= 0 {
+		problems = append(problems, "password_reset_ttl must be positive")
+	}
+
+	switch c.LoginAttemptsBackend {
+	case "postgres", "memory":
+	default:
+		problems = append(problems, fmt.Sprintf("login_attempts_backend must be postgres or memory, got %q", c.LoginAttemptsBackend))
+	}
+	if c.LoginWindow <= 0 || c.LoginAttemptsRetention < c.LoginWindow {
+		problems = append(problems, "login_window must be positive and login_attempts_retention at least as long")
+	}
+	if c.LoginMaxIPFailures < 0 || c.LoginMaxUserFailures < 0 || c.LoginFreeFailures < 0 || c.LoginLockoutThreshold < 0 ||
+		c.LoginDelay < 0 || c.LoginMaxDelay < 0 || c.LoginLockoutDuration < 0 {
+		problems = append(problems, "login limits must not be negative")
+	}
+	if c.LoginLockoutThreshold > 0 && c.LoginLockoutDuration == 0 {
+		problems = append(problems, "login_lockout_duration must be positive when login_lockout_threshold is set")
+	}
+
+	// The issuer prefixes the account in the provisioning URI label
+	if strings.Contains(c.MFAIssuer, ":") {
+		problems = append(problems, "mfa_issuer must not contain a colon")
+	}
+	for _, role := range c.MFARequiredRoles {
+		if role == "" {
+			problems = append(problems, "mfa_required_roles must not contain empty role names")
+			break
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration with secrets masked
+//
+// Returns:
+//   - Config: Copy safe to log or print
+func (c Config) Redacted() Config {
+	redacted := c
+	redacted.CORSAllowedOrigins = append([]string(nil), c.CORSAllowedOrigins...)
+	redacted.TrustedProxies = append([]string(nil), c.TrustedProxies...)
+	redacted.MFARequiredRoles = append([]string(nil), c.MFARequiredRoles...)
+	if redacted.DBPassword != "" {
+		redacted.DBPassword = "********"
+	}
+	if redacted.JWTSecret != "" {
+		redacted.JWTSecret = "********"
+	}
+	if redacted.SMTPPassword != "" {
+		redacted.SMTPPassword = "********"
+	}
+	return redacted
+}
+
+// String returns a human readable representation with secrets masked
+func (c Config) String() string {
+	r := c.Redacted()
+	return fmt.Sprintf(
+		"env=%s db=%s@%s:%s/%s sslmode=%s db_password=%s pool(open=%d idle=%d lifetime=%s) "+
+			"jwt_secret=%s server_port=%s cors=%s password_hasher=%s access_ttl=%s refresh_ttl=%s "+
+			"attendance_threshold=%g storage_dir=%s mail_driver=%s mail_from=%s mail_dir=%s "+
+			"smtp=%s@%s:%s smtp_password=%s public_url=%s password_reset_url=%s password_reset_ttl=%s trusted_proxies=%s "+
+			"login_attempts(backend=%s retention=%s) login_limits(window=%s ip=%d user=%d free=%d delay=%s max_delay=%s "+
+			"lockout=%d for %s) mfa_issuer=%s mfa_required_roles=%s",
+		r.Env, r.DBUser, r.DBHost, r.DBPort, r.DBName, r.DBSSLMode, r.DBPassword,
+		r.DBMaxOpenConns, r.DBMaxIdleConns, r.DBConnMaxLifetime,
+		r.JWTSecret, r.ServerPort, strings.Join(r.CORSAllowedOrigins, ","),
+		r.PasswordHasher, r.AccessTokenTTL, r.RefreshTokenTTL,
+		r.AttendanceThreshold, r.StorageDir, r.MailDriver, r.MailFrom, r.MailDir,
+		r.SMTPUsername, r.SMTPHost, r.SMTPPort, r.SMTPPassword, r.PublicURL, r.PasswordResetURL, r.PasswordResetTTL,
+		strings.Join(r.TrustedProxies, ","), r.LoginAttemptsBackend, r.LoginAttemptsRetention,
+		r.LoginWindow, r.LoginMaxIPFailures, r.LoginMaxUserFailures, r.LoginFreeFailures, r.LoginDelay, r.LoginMaxDelay,
+		r.LoginLockoutThreshold, r.LoginLockoutDuration, r.MFAIssuer, strings.Join(r.MFARequiredRoles, ","),
+	)
 }
@@ -0,0 +1,227 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the environment variable holding the optional config file path
+const ConfigFileEnv = "WG_CONFIG_FILE"
+
+// envPrefix is prepended to the upper-cased setting key to form its environment variable
+const envPrefix = "WG_"
+
+// setting describes one configuration knob shared by the file and environment sources
+type setting struct {
+	key   string                          // Key in the config file, e.g. db_host
+	apply func(c *Config, v string) error // Parses v and stores it in the config
+}
+
+// env returns the environment variable name of the setting, e.g. WG_DB_HOST
+func (s setting) env() string {
+	return envPrefix + strings.ToUpper(s.key)
+}
+
+// settings lists every configurable value
+var settings = []setting{
+	{"env", stringSetting(func(c *Config) *string { return &c.Env })},
+	{"db_host", stringSetting(func(c *Config) *string { return &c.DBHost })},
+	{"db_port", stringSetting(func(c *Config) *string { return &c.DBPort })},
+	{"db_name", stringSetting(func(c *Config) *string { return &c.DBName })},
+	{"db_user", stringSetting(func(c *Config) *string { return &c.DBUser })},
+	{"db_password", stringSetting(func(c *Config) *string { return &c.DBPassword })},
+	{"db_sslmode", stringSetting(func(c *Config) *string { return &c.DBSSLMode })},
+	{"db_max_open_conns", intSetting(func(c *Config) *int { return &c.DBMaxOpenConns })},
+	{"db_max_idle_conns", intSetting(func(c *Config) *int { return &c.DBMaxIdleConns })},
+	{"db_conn_max_lifetime", durationSetting(func(c *Config) *time.Duration { return &c.DBConnMaxLifetime })},
+	{"jwt_secret", stringSetting(func(c *Config) *string { return &c.JWTSecret })},
+	{"server_port", stringSetting(func(c *Config) *string { return &c.ServerPort })},
+	{"cors_allowed_origins", listSetting(func(c *Config) *[]string { return &c.CORSAllowedOrigins })},
+	{"trusted_proxies", listSetting(func(c *Config) *[]string { return &c.TrustedProxies })},
+	{"password_hasher", stringSetting(func(c *Config) *string { return &c.PasswordHasher })},
+	{"access_token_ttl", durationSetting(func(c *Config) *time.Duration { return &c.AccessTokenTTL })},
+	{"refresh_token_ttl", durationSetting(func(c *Config) *time.Duration { return &c.RefreshTokenTTL })},
+	{"attendance_threshold", floatSetting(func(c *Config) *float64 { return &c.AttendanceThreshold })},
+	{"storage_dir", stringSetting(func(c *Config) *string { return &c.StorageDir })},
+	{"mail_driver", stringSetting(func(c *Config) *string { return &c.MailDriver })},
+	{"mail_from", stringSetting(func(c *Config) *string { return &c.MailFrom })},
+	{"mail_dir", stringSetting(func(c *Config) *string { return &c.MailDir })},
+	{"smtp_host", stringSetting(func(c *Config) *string { return &c.SMTPHost })},
+	{"smtp_port", stringSetting(func(c *Config) *string { return &c.SMTPPort })},
+	{"smtp_username", stringSetting(func(c *Config) *string { return &c.SMTPUsername })},
+	{"smtp_password", stringSetting(func(c *Config) *string { return &c.SMTPPassword })},
+	{"public_url", stringSetting(func(c *Config) *string { return &c.PublicURL })},
+	{"password_reset_url", stringSetting(func(c *Config) *string { return &c.PasswordResetURL })},
+	{"password_reset_ttl", durationSetting(func(c *Config) *time.Duration { return &c.PasswordResetTTL })},
+	{"login_attempts_backend", stringSetting(func(c *Config) *string { return &c.LoginAttemptsBackend })},
+	{"login_attempts_retention", durationSetting(func(c *Config) *time.Duration { return &c.LoginAttemptsRetention })},
+	{"login_window", durationSetting(func(c *Config) *time.Duration { return &c.LoginWindow })},
+	{"login_max_ip_failures", intSetting(func(c *Config) *int { return &c.LoginMaxIPFailures })},
+	{"login_max_user_failures", intSetting(func(c *Config) *int { return &c.LoginMaxUserFailures })},
+	{"login_free_failures", intSetting(func(c *Config) *int { return &c.LoginFreeFailures })},
+	{"login_delay", durationSetting(func(c *Config) *time.Duration { return &c.LoginDelay })},
+	{"login_max_delay", durationSetting(func(c *Config) *time.Duration { return &c.LoginMaxDelay })},
+	{"login_lockout_threshold", intSetting(func(c *Config) *int { return &c.LoginLockoutThreshold })},
+	{"login_lockout_duration", durationSetting(func(c *Config) *time.Duration { return &c.LoginLockoutDuration })},
+	{"mfa_issuer", stringSetting(func(c *Config) *string { return &c.MFAIssuer })},
+	{"mfa_required_roles", listSetting(func(c *Config) *[]string { return &c.MFARequiredRoles })},
+}
+
+// Load builds the configuration from defaults, the optional config file and
+// the environment, then validates it
+//
+// Returns:
+//   - Config: The merged configuration
+//   - error: Error if the file cannot be read, a value cannot be parsed or validation fails
+func Load() (Config, error) {
+	cfg := NewConfig()
+
+	if path := os.Getenv(ConfigFileEnv); path != "" {
+		if err := applyFile(&cfg, path); err != nil {
+			return cfg, err
+		}
+	}
+
+	if err := applyEnv(&cfg, os.LookupEnv); err != nil {
+		return cfg, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// applyFile overrides the configuration with values from a YAML or TOML file.
+// The format is chosen by file extension and unknown keys are rejected.
+func applyFile(cfg *Config, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+
+	values := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &values)
+	case ".toml":
+		err = toml.Unmarshal(content, &values)
+	default:
+		return fmt.Errorf("unsupported config file format %q, expected .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	known := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		known[s.key] = s
+	}
+
+	// Apply in sorted order so error messages are deterministic
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s, ok := known[key]
+		if !ok {
+			return fmt.Errorf("unknown key %q in config file %s", key, path)
+		}
+		if err := s.apply(cfg, fileValueString(values[key])); err != nil {
+			return fmt.Errorf("invalid %s in config file %s: %v", key, path, err)
+		}
+	}
+
+	return nil
+}
+
+// applyEnv overrides the configuration with WG_* environment variables
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	for _, s := range settings {
+		value, ok := lookup(s.env())
+		if !ok {
+			continue
+		}
+		if err := s.apply(cfg, value); err != nil {
+			return fmt.Errorf("invalid %s: %v", s.env(), err)
+		}
+	}
+	return nil
+}
+
+// fileValueString converts a decoded file value to the string form used by the environment
+func fileValueString(v interface{}) string {
+	switch value := v.(type) {
+	case []interface{}:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func stringSetting(field func(c *Config) *string) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}
+}
+
+func intSetting(field func(c *Config) *int) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", v)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func floatSetting(field func(c *Config) *float64) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", v)
+		}
+		*field(c) = f
+		return nil
+	}
+}
+
+func durationSetting(field func(c *Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 15m or 168h", v)
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func listSetting(field func(c *Config) *[]string) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		var items []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*field(c) = items
+		return nil
+	}
+}
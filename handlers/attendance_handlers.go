@@ -0,0 +1,377 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultAttendanceThreshold is the attendance percentage below which students
+// are reported when the Handler does not configure one
+const DefaultAttendanceThreshold = 90.0
+
+// StudentAttendanceResponse summarizes a student's attendance
+type StudentAttendanceResponse struct {
+	StudentID   int                         `json:"student_id"`
+	StudentName string                      `json:"student_name"`
+	Overall     models.AttendanceCounts     `json:"overall"`  // All subjects combined
+	Subjects    []*models.AttendanceSummary `json:"subjects"` // One summary per subject
+}
+
+// SubjectAttendanceResponse summarizes the attendance in a subject
+type SubjectAttendanceResponse struct {
+	SubjectID   int                         `json:"subject_id"`
+	SubjectName string                      `json:"subject_name"`
+	Overall     models.AttendanceCounts     `json:"overall"`  // All students combined
+	Students    []*models.AttendanceSummary `json:"students"` // One summary per student
+}
+
+// AttendanceReportResponse lists the students below the attendance threshold
+type AttendanceReportResponse struct {
+	Threshold float64                     `json:"threshold"`      // Attendance percentage students must reach
+	From      string                      `json:"from,omitempty"` // First day counted, if limited
+	To        string                      `json:"to,omitempty"`   // Last day counted, if limited
+	Students  []*models.AttendanceSummary `json:"students"`       // Lowest attendance first
+}
+
+// RecordAttendanceRequest is the request body for recording attendance of an existing lesson
+type RecordAttendanceRequest struct {
+	Records []models.AttendanceEntry `json:"records"`
+}
+
+// attendanceThreshold returns the configured attendance threshold or the default
+func (h *Handler) attendanceThreshold() float64 {
+	if h.AttendanceThreshold > 0 {
+		return h.AttendanceThreshold
+	}
+	return DefaultAttendanceThreshold
+}
+
+// parseAttendancePeriod reads the optional from and to query parameters
+//
+// Parameters:
+//   - c: Gin context of the request
+//
+// Returns:
+//   - models.AttendancePeriod: Period, open where a parameter is omitted
+//   - error: If a date is malformed or from is after to
+func parseAttendancePeriod(c *gin.Context) (models.AttendancePeriod, error) {
+	var period models.AttendancePeriod
+	var err error
+	if from := c.Query("from"); from != "" {
+		if period.From, err = models.ParseLessonDate(from); err != nil {
+			return period, errors.New("Invalid from date, use YYYY-MM-DD")
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if period.To, err = models.ParseLessonDate(to); err != nil {
+			return period, errors.New("Invalid to date, use YYYY-MM-DD")
+		}
+	}
+	if !period.From.IsZero() && !period.To.IsZero() && period.From.After(period.To) {
+		return period, errors.New("from must not be after to")
+	}
+	return period, nil
+}
+
+// recordingError responds to an error from creating a lesson or recording attendance
+func recordingError(c *gin.Context, err error, notFound, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	case errors.Is(err, models.ErrNotTeaching):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not assigned to teach this subject"})
+	case errors.Is(err, models.ErrSubjectArchived):
+		c.JSON(http.StatusConflict, gin.H{"error": "Archived subjects take no new lessons"})
+	case errors.Is(err, models.ErrInvalidAttendance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// HandleCreateLesson creates a lesson and records the attendance of its students
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Expected Request Body:
+//   - subject_id: Subject the caller is assigned to teach
+//   - date: Day of the lesson as YYYY-MM-DD
+//   - topic: Optional description
+//   - records: List of {student_id, status, note}; status is present, absent,
+//     late or excused, and excused requires a note. Students must be enrolled
+//     in the subject. May be empty and recorded later.
+//
+// Returns:
+//   - 201 Created with the lesson and its records
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the attendance:record permission or if the caller does not teach the subject
+//   - 404 Not Found if the subject doesn't exist
+//   - 409 Conflict if the subject is archived
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleCreateLesson(c *gin.Context) {
+	var req models.LessonRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.SubjectID == 0 || req.Date == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	lesson, err := h.Attendance.CreateLesson(c.GetInt("user_id"), &req)
+	if err != nil {
+		recordingError(c, err, "Subject not found", "Failed to create lesson")
+		return
+	}
+
+	c.JSON(http.StatusCreated, lesson)
+}
+
+// HandleRecordAttendance adds or corrects attendance records of a lesson.
+// Students not listed keep their records.
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Lesson ID parameter from the URL
+//
+// Expected Request Body:
+//   - records: List of {student_id, status, note} as for HandleCreateLesson
+//
+// Returns:
+//   - 200 OK with the lesson and all of its records
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the attendance:record permission or if the caller does not teach the subject
+//   - 404 Not Found if the lesson doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleRecordAttendance(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lesson ID"})
+		return
+	}
+
+	var req RecordAttendanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Records) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	lesson, err := h.Attendance.RecordAttendance(id, c.GetInt("user_id"), req.Records)
+	if err != nil {
+		recordingError(c, err, "Lesson not found", "Failed to record attendance")
+		return
+	}
+
+	c.JSON(http.StatusOK, lesson)
+}
+
+// HandleGetLesson retrieves a lesson with its attendance records
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Lesson ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with the lesson and its records
+//   - 400 Bad Request if the lesson ID is invalid
+//   - 403 Forbidden without attendance:read, unless the caller teaches the subject
+//   - 404 Not Found if the lesson doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetLesson(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lesson ID"})
+		return
+	}
+
+	lesson, err := h.Attendance.GetLesson(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Lesson not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting lesson %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve lesson"})
+		return
+	}
+
+	if !h.requireSubjectAccess(c, lesson.SubjectID, models.PermAttendanceRead, models.PermAttendanceRecord) {
+		return
+	}
+
+	c.JSON(http.StatusOK, lesson)
+}
+
+// HandleGetSubjectLessons lists the lessons of a subject without their records
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Subject ID parameter from the URL
+//   - from, to: Optional YYYY-MM-DD query parameters limiting the lesson dates
+//
+// Returns:
+//   - 200 OK with the lessons, most recent first
+//   - 400 Bad Request if the subject ID or a date is invalid
+//   - 403 Forbidden without attendance:read, unless the caller teaches the subject
+//   - 404 Not Found if the subject doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetSubjectLessons(c *gin.Context) {
+	period, err := parseAttendancePeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subject := h.subjectWithAccess(c, models.PermAttendanceRead, models.PermAttendanceRecord)
+	if subject == nil {
+		return
+	}
+
+	lessons, err := h.Attendance.GetSubjectLessons(subject.ID, period)
+	if err != nil {
+		log.Printf("Error getting lessons of subject %d: %v", subject.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve lessons"})
+		return
+	}
+
+	c.JSON(http.StatusOK, lessons)
+}
+
+// HandleGetSubjectAttendance summarizes the attendance in a subject per student
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Subject ID parameter from the URL
+//   - from, to: Optional YYYY-MM-DD query parameters limiting the lesson dates
+//
+// Returns:
+//   - 200 OK with the overall counts and one summary per student
+//   - 400 Bad Request if the subject ID or a date is invalid
+//   - 403 Forbidden without attendance:read, unless the caller teaches the subject
+//   - 404 Not Found if the subject doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetSubjectAttendance(c *gin.Context) {
+	period, err := parseAttendancePeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subject := h.subjectWithAccess(c, models.PermAttendanceRead, models.PermAttendanceRecord)
+	if subject == nil {
+		return
+	}
+
+	summaries, err := h.Attendance.GetSubjectAttendance(subject.ID, period)
+	if err != nil {
+		log.Printf("Error summarizing attendance of subject %d: %v", subject.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve attendance"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SubjectAttendanceResponse{
+		SubjectID:   subject.ID,
+		SubjectName: subject.Name,
+		Overall:     models.TotalAttendance(summaries),
+		Students:    summaries,
+	})
+}
+
+// HandleGetStudentAttendance summarizes a student's attendance per subject
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Student ID parameter from the URL
+//   - from, to: Optional YYYY-MM-DD query parameters limiting the lesson dates
+//
+// Returns:
+//   - 200 OK with the overall counts and one summary per subject
+//   - 400 Bad Request if the student ID or a date is invalid
+//   - 403 Forbidden without the attendance:read permission
+//   - 404 Not Found if the student doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetStudentAttendance(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID"})
+		return
+	}
+
+	period, err := parseAttendancePeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	student, err := h.Students.GetStudentByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	summaries, err := h.Attendance.GetStudentAttendance(id, period)
+	if err != nil {
+		log.Printf("Error summarizing attendance of student %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve attendance"})
+		return
+	}
+
+	c.JSON(http.StatusOK, StudentAttendanceResponse{
+		StudentID:   student.ID,
+		StudentName: student.FirstName + " " + student.LastName,
+		Overall:     models.TotalAttendance(summaries),
+		Subjects:    summaries,
+	})
+}
+
+// HandleGetAttendanceReport lists the students whose attendance over all
+// subjects is below the threshold
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - threshold: Optional percentage between 0 and 100; defaults to the configured threshold
+//   - from, to: Optional YYYY-MM-DD query parameters limiting the lesson dates
+//
+// Returns:
+//   - 200 OK with the threshold and the students below it, lowest attendance first
+//   - 400 Bad Request if the threshold or a date is invalid
+//   - 403 Forbidden without the attendance:read permission
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetAttendanceReport(c *gin.Context) {
+	threshold := h.attendanceThreshold()
+	if value := c.Query("threshold"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || parsed > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be a percentage between 0 and 100"})
+			return
+		}
+		threshold = parsed
+	}
+
+	period, err := parseAttendancePeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	summaries, err := h.Attendance.GetLowAttendance(threshold, period)
+	if err != nil {
+		log.Printf("Error building attendance report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build attendance report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, AttendanceReportResponse{
+		Threshold: threshold,
+		From:      c.Query("from"),
+		To:        c.Query("to"),
+		Students:  summaries,
+	})
+}
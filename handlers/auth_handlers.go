@@ -2,7 +2,9 @@
 package handlers
 
 import (
-	"fmt"
+	"database/sql"
+	"errors"
+	"log"
 	"net/http"
 	"time"
 	"github.com/gin-gonic/gin"
@@ -18,8 +20,14 @@ type LoginRequest struct {
 
 // LoginResponse represents the login response body
 type LoginResponse struct {
-	Token string      `json:"token"`
-	User  models.User `json:"user"`
+	Token        string      `json:"token"`         // Short-lived access token
+	RefreshToken string      `json:"refresh_token"` // Single-use token for POST /api/token/refresh
+	ExpiresIn    int         `json:"expires_in"`    // Access token lifetime in seconds
+	User         models.User `json:"user"`
+
+	// The user's role requires two-factor authentication for sensitive
+	// routes but the user has not enrolled; see /api/me/mfa
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
 }
 
 // HandleLogin processes login requests
@@ -28,7 +36,15 @@ type LoginResponse struct {
 //   - c: Gin context containing the request and response
 //
 // The function expects a JSON body with username and password.
-// It returns a 200 OK with JWT token on success, or appropriate error status code
+// It returns a 200 OK with JWT token on success, or appropriate error status code.
+// Passwords still stored as plaintext are rewritten as hashes on successful login.
+// Deactivated accounts are refused with 403 Forbidden.
+// Failed logins are rate limited per username and client address (429 Too Many
+// Requests with Retry-After) and lock the account after repeated failures
+// (423 Locked); see models.LoginPolicy. Unknown usernames are checked
+// against a dummy hash so that they answer as slowly as wrong passwords.
+// Users with two-factor authentication get 202 Accepted with a short-lived
+// challenge instead of tokens, to complete with POST /api/login/mfa.
 func (h *Handler) HandleLogin(c *gin.Context) {
 	// Parse the request body
 	var req LoginRequest
@@ -37,30 +53,134 @@ func (h *Handler) HandleLogin(c *gin.Context) {
 		return
 	}
 
+	// No account has a longer username, and it would not fit the attempt log
+	if len(req.Username) > models.MaxUsernameLength {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return
+	}
+
+	// Refuse attempts over the rate limit before looking at the password
+	ip := c.ClientIP()
+	policy := h.loginPolicy()
+	now := time.Now()
+	failures, ok := h.checkLoginLimit(c, req.Username, ip, policy, now)
+	if !ok {
+		return
+	}
+
 	// Find the user
-	user, err := h.DB.GetUserByUsername(req.Username)
-	if err != nil {
+	user, err := h.Users.GetUserByUsername(req.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Check a password anyway so that unknown usernames answer as slowly as known ones
+		h.Users.VerifyDummyPassword(req.Password)
+		h.recordLoginAttempt(req.Username, ip, models.LoginFailure)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
 		return
 	}
+	if err != nil {
+		log.Printf("Error getting user %q: %v", req.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+
+	if h.refuseLocked(c, user, ip, now) {
+		return
+	}
 
 	// Check the password
 	if !user.CheckPassword(req.Password) {
+		h.loginFailed(user, ip, failures, policy, now)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
 		return
 	}
 
-	// Create a JWT token
-	token, err := createToken(user, h.JWTSecret)
+	// Deactivated accounts keep their data but cannot log in. The attempt is
+	// not a success, so it leaves the count of failures as it is.
+	if !user.Active {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
+		return
+	}
+
+	// With two-factor authentication the login only succeeds with the code,
+	// so that failed codes keep counting towards the lockout
+	mfa, err := h.MFA.GetMFA(user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error getting two-factor authentication of user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	mfaEnabled := mfa != nil && mfa.Enabled
+	if !mfaEnabled {
+		h.recordLoginAttempt(req.Username, ip, models.LoginSuccess)
+	}
+
+	// Rehash legacy plaintext or outdated hashes now that we know the password.
+	// A failure here must not block the login; the upgrade is retried next time.
+	if h.Users.PasswordNeedsUpgrade(user) {
+		if err := h.Users.UpdateUserPassword(user.ID, req.Password); err != nil {
+			log.Printf("Error upgrading password hash for user %d: %v", user.ID, err)
+		}
+	}
+
+	// The password alone only earns a challenge for the second factor
+	if mfaEnabled {
+		challenge, err := h.createMFAChallenge(user)
+		if err != nil {
+			log.Printf("Error creating MFA challenge for user %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusAccepted, MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    challenge,
+			ExpiresIn:   int(MFAChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	h.completeLogin(c, user, false)
+}
+
+// completeLogin answers a successful login with a session, or with a reset
+// token if an admin forced a password reset
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - user: User who logged in
+//   - mfa: Whether the user completed two-factor authentication
+func (h *Handler) completeLogin(c *gin.Context, user *models.User, mfa bool) {
+	// A forced reset trades the password for a reset token instead of a session
+	if user.MustChangePassword {
+		resetToken, err := h.createResetToken(user.ID)
+		if err != nil {
+			log.Printf("Error creating password reset token for user %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusForbidden, PasswordChangeRequiredResponse{
+			Error:      "Password change required",
+			ResetToken: resetToken,
+			ExpiresIn:  int(h.passwordResetTTL().Seconds()),
+		})
+		return
+	}
+
+	// Create the access and refresh tokens
+	tokens, err := h.issueTokens(user, mfa)
 	if err != nil {
+		log.Printf("Error issuing tokens for user %d: %v", user.ID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	// Return the token and user info
+	// Return the tokens and user info
 	resp := LoginResponse{
-		Token: token,
-		User:  *user,
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		User:         *user,
+
+		MFAEnrollmentRequired: !mfa && h.MFARequired(user.Role),
 	}
 
 	c.JSON(http.StatusOK, resp)
@@ -100,17 +220,26 @@ func (h *Handler) HandleProtected(c *gin.Context) {
 type Claims struct {
 	UserID int    `json:"user_id"`
 	Role   string `json:"role"`
+	MFA    bool   `json:"mfa,omitempty"` // The session was started with two-factor authentication
 	jwt.RegisteredClaims
 }
 
-// Helper function to create a JWT token
-func createToken(user *models.User, secret string) (string, error) {
+// Helper function to create a JWT token with a unique jti
+func createToken(user *models.User, secret string, ttl time.Duration, mfa bool) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
 	claims := Claims{
 		UserID: user.ID,
 		Role:   user.Role,
+		MFA:    mfa,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
@@ -146,30 +275,3 @@ func validateToken(tokenString, secret string) (*Claims, error) {
 
 	return claims, nil
 }
-
-// validateAdminToken validates that the request contains a valid admin token
-//
-// Parameters:
-//   - c: Gin context containing the request and response
-//
-// Returns:
-//   - *Claims: The JWT claims if token is valid and has admin role
-//   - error: Error if token is invalid or does not have admin role
-func (h *Handler) validateAdminToken(c *gin.Context) (*Claims, error) {
-	tokenString := extractToken(c)
-	if tokenString == "" {
-		return nil, fmt.Errorf("no token provided")
-	}
-
-	claims, err := validateToken(tokenString, h.JWTSecret)
-	if err != nil {
-		return nil, err
-	}
-
-	// Verify admin role
-	if claims.Role != "admin" {
-		return nil, fmt.Errorf("admin role required")
-	}
-
-	return claims, nil
-} 
\ No newline at end of file
@@ -0,0 +1,428 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// calendarAudience is the audience of calendar feed tokens. Feed tokens are
+// also signed with their own key (see calendarKey), and JWTAuth refuses tokens
+// with any audience, so neither kind of token is accepted in place of the other.
+const calendarAudience = "calendar"
+
+// CalendarFeedResponse is the subscription URL of the caller's calendar feed
+type CalendarFeedResponse struct {
+	URL   string `json:"url"`   // Feed URL to subscribe to in a calendar app
+	Token string `json:"token"` // Signed token embedded in the URL
+}
+
+// calendarClaims are the claims of a calendar feed token. The ID is the feed
+// identifier the token was issued for.
+type calendarClaims struct {
+	UserID int `json:"user_id"`
+	jwt.RegisteredClaims
+}
+
+// calendarKey derives the key calendar feed tokens are signed with from the
+// JWT secret, so that a feed token is never accepted as an access token
+func (h *Handler) calendarKey() []byte {
+	mac := hmac.New(sha256.New, []byte(h.JWTSecret))
+	mac.Write([]byte("calendar-feed"))
+	return mac.Sum(nil)
+}
+
+// createCalendarToken signs a calendar feed token for a user's current feed.
+// The token has no expiry and the same feed always yields the same token.
+func (h *Handler) createCalendarToken(userID int, feedID string) (string, error) {
+	claims := calendarClaims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       feedID,
+			Audience: jwt.ClaimStrings{calendarAudience},
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(h.calendarKey())
+}
+
+// parseCalendarToken validates the signature and audience of a calendar feed token
+func (h *Handler) parseCalendarToken(tokenString string) (*calendarClaims, error) {
+	claims := &calendarClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return h.calendarKey(), nil
+	}, jwt.WithAudience(calendarAudience), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// calendarFeedURL builds the subscription URL of a feed token below the
+// configured public URL
+func (h *Handler) calendarFeedURL(token string) (string, error) {
+	u, err := url.Parse(h.PublicURL)
+	if err != nil {
+		return "", err
+	}
+	return u.JoinPath("api", "calendar", "feeds", token+".ics").String(), nil
+}
+
+// calendarOwner finds the student record or teacher a calendar belongs to
+//
+// Returns:
+//   - *models.Student: The user's student record, or nil
+//   - *models.Teacher: The teacher, or nil if the user is a student
+//   - error: sql.ErrNoRows if the user is neither, or a database error
+func (h *Handler) calendarOwner(userID int) (*models.Student, *models.Teacher, error) {
+	student, err := h.Students.GetStudentByUserID(userID)
+	if err == nil {
+		return student, nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, err
+	}
+
+	teacher, err := h.Teachers.GetTeacherByID(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, teacher, nil
+}
+
+// calendarFeed responds with the subscription URL of a user's calendar feed
+func (h *Handler) calendarFeed(c *gin.Context, userID int, feedID string) {
+	token, err := h.createCalendarToken(userID, feedID)
+	if err != nil {
+		log.Printf("Error signing calendar feed token for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create calendar feed"})
+		return
+	}
+	feedURL, err := h.calendarFeedURL(token)
+	if err != nil {
+		log.Printf("Error building calendar feed URL for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create calendar feed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, CalendarFeedResponse{
+		URL:   feedURL,
+		Token: token,
+	})
+}
+
+// newCalendarFeed replaces a user's feed identifier and responds with the new URL
+func (h *Handler) newCalendarFeed(c *gin.Context, userID int) {
+	feedID, err := randomToken(16)
+	if err == nil {
+		err = h.Tokens.SetCalendarFeedID(userID, feedID)
+	}
+	if err != nil {
+		log.Printf("Error creating calendar feed for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create calendar feed"})
+		return
+	}
+	h.calendarFeed(c, userID, feedID)
+}
+
+// requireCalendarOwner responds unless the caller is a student or teacher
+//
+// Returns:
+//   - bool: False if a response has been sent
+func (h *Handler) requireCalendarOwner(c *gin.Context) bool {
+	_, _, err := h.calendarOwner(c.GetInt("user_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only students and teachers have calendar feeds"})
+		return false
+	}
+	if err != nil {
+		log.Printf("Error getting calendar owner %d: %v", c.GetInt("user_id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve calendar feed"})
+		return false
+	}
+	return true
+}
+
+// HandleGetCalendarFeed retrieves the URL of the caller's calendar feed,
+// creating the feed on first use
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Returns:
+//   - 200 OK with the feed URL and token
+//   - 403 Forbidden if the caller is neither a student nor a teacher
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetCalendarFeed(c *gin.Context) {
+	if !h.requireCalendarOwner(c) {
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	feedID, err := h.Tokens.GetCalendarFeedID(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.newCalendarFeed(c, userID)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting calendar feed of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve calendar feed"})
+		return
+	}
+	h.calendarFeed(c, userID, feedID)
+}
+
+// HandleResetCalendarFeed replaces the caller's calendar feed URL, for example
+// after it was shared by mistake. The previous URL stops working.
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Returns:
+//   - 200 OK with the new feed URL and token
+//   - 403 Forbidden if the caller is neither a student nor a teacher
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleResetCalendarFeed(c *gin.Context) {
+	if !h.requireCalendarOwner(c) {
+		return
+	}
+	h.newCalendarFeed(c, c.GetInt("user_id"))
+}
+
+// HandleCalendarFeed serves a calendar feed as an RFC 5545 iCalendar file. It
+// is authenticated by the signed token in the URL rather than a JWT
+// Authorization header, since calendar apps cannot send one.
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - token: Feed token parameter from the URL, optionally ending in .ics
+//
+// Returns:
+//   - 200 OK with weekly lessons, exams, assessment dates and project milestones
+//   - 404 Not Found if the token is invalid, has been reset, or its user is deactivated
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleCalendarFeed(c *gin.Context) {
+	claims, err := h.parseCalendarToken(strings.TrimSuffix(c.Param("token"), ".ics"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calendar feed not found"})
+		return
+	}
+
+	feedID, err := h.Tokens.GetCalendarFeedID(claims.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error getting calendar feed of user %d: %v", claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve calendar feed"})
+		return
+	}
+	if err != nil || feedID != claims.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calendar feed not found"})
+		return
+	}
+	user, err := h.Users.GetUserByID(claims.UserID)
+	if err != nil || !user.Active {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calendar feed not found"})
+		return
+	}
+
+	name, events, err := h.calendarEvents(user.ID)
+	if err != nil {
+		log.Printf("Error building calendar feed of user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve calendar feed"})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := writeICS(&buf, "WG Education: "+name, events, time.Now()); err != nil {
+		log.Printf("Error writing calendar feed of user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve calendar feed"})
+		return
+	}
+	c.Header("Content-Disposition", `inline; filename="calendar.ics"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+}
+
+// calendarEvents collects a user's calendar: the weekly lessons, the exams, the
+// assessment dates and the project milestones of a student's subjects, or of
+// the subjects and projects a teacher teaches and supervises. Users who are neither get an
+// empty calendar.
+//
+// Returns:
+//   - string: Name of the calendar's owner
+//   - []icsEvent: Lessons, then exams, then assessments, then milestones
+//   - error: Error if retrieval fails
+func (h *Handler) calendarEvents(userID int) (string, []icsEvent, error) {
+	student, teacher, err := h.calendarOwner(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	var name string
+	var filter models.TimetableFilter
+	var subjects []models.Subject
+	var projects []*models.Project
+	if student != nil {
+		name = student.FirstName + " " + student.LastName
+		filter.StudentID = student.ID
+		enrollments, err := h.Enrollments.GetStudentEnrollments(student.ID)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, e := range enrollments {
+			subjects = append(subjects, models.Subject{ID: e.SubjectID, Name: e.SubjectName, Grade: e.Grade})
+		}
+		if projects, err = h.Projects.GetStudentProjects(student.ID); err != nil {
+			return "", nil, err
+		}
+	} else {
+		name = strings.TrimSpace(teacher.FirstName + " " + teacher.LastName)
+		if name == "" {
+			name = teacher.Username
+		}
+		filter.TeacherID = teacher.ID
+		if subjects, err = h.Teachers.GetTeacherSubjects(teacher.ID); err != nil {
+			return "", nil, err
+		}
+		if projects, err = h.Projects.GetSupervisedProjects(teacher.ID); err != nil {
+			return "", nil, err
+		}
+	}
+
+	lessons, err := h.Timetable.GetTimetableLessons(filter)
+	if err != nil {
+		return "", nil, err
+	}
+	events := make([]icsEvent, 0, len(lessons))
+	for _, lesson := range lessons {
+		if event, ok := lessonEvent(lesson); ok {
+			events = append(events, event)
+		}
+	}
+
+	for _, subject := range subjects {
+		exams, err := h.Timetable.GetExams(subject.ID)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, exam := range exams {
+			if event, ok := examEvent(exam); ok {
+				events = append(events, event)
+			}
+		}
+	}
+
+	for _, subject := range subjects {
+		assessments, err := h.Gradebook.GetSubjectAssessments(subject.ID)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, a := range assessments {
+			events = append(events, icsEvent{
+				UID:        fmt.Sprintf("assessment-%d@wg-edu", a.ID),
+				Summary:    fmt.Sprintf("%s (%s): %s", subject.Name, subject.Grade, a.Name),
+				Categories: []string{a.Category},
+				Start:      a.Date,
+				AllDay:     true,
+				Modified:   a.CreatedAt,
+			})
+		}
+	}
+
+	for _, p := range projects {
+		title := "Extended Essay"
+		if p.Kind == models.ProjectIA {
+			title = p.SubjectName + " Internal Assessment"
+		}
+		if teacher != nil {
+			title += " (" + p.StudentName + ")"
+		}
+		for _, milestone := range p.Milestones {
+			description := p.Title
+			if milestone.CompletedAt != nil {
+				description = strings.TrimSpace(description + "\nCompleted " + milestone.CompletedAt.Format(models.LessonDateLayout))
+			}
+			events = append(events, icsEvent{
+				UID:         fmt.Sprintf("milestone-%d@wg-edu", milestone.ID),
+				Summary:     title + ": " + milestone.Name,
+				Description: description,
+				Start:       milestone.DueDate,
+				AllDay:      true,
+			})
+		}
+	}
+
+	return name, events, nil
+}
+
+// lessonEvent turns a timetable lesson into a weekly event, starting on the
+// lesson's weekday in the week it was scheduled
+//
+// Returns:
+//   - icsEvent: Recurring event
+//   - bool: False if the lesson's times cannot be read
+func lessonEvent(lesson *models.TimetableLesson) (icsEvent, bool) {
+	start, err := time.Parse(models.SlotTimeLayout, lesson.StartTime)
+	if err != nil {
+		return icsEvent{}, false
+	}
+	end, err := time.Parse(models.SlotTimeLayout, lesson.EndTime)
+	if err != nil {
+		return icsEvent{}, false
+	}
+
+	day := time.Date(lesson.CreatedAt.Year(), lesson.CreatedAt.Month(), lesson.CreatedAt.Day(), 0, 0, 0, 0, time.UTC)
+	for day.Weekday() != time.Weekday(lesson.Day%7) {
+		day = day.AddDate(0, 0, 1)
+	}
+
+	description := lesson.SlotName
+	if lesson.TeacherName != "" {
+		description += "\nTeacher: " + lesson.TeacherName
+	}
+	return icsEvent{
+		UID:         fmt.Sprintf("lesson-%d@wg-edu", lesson.ID),
+		Summary:     fmt.Sprintf("%s (%s)", lesson.SubjectName, lesson.Grade),
+		Description: description,
+		Location:    lesson.RoomName,
+		Start:       day.Add(time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute),
+		End:         day.Add(time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute),
+		Weekly:      true,
+		Modified:    lesson.UpdatedAt,
+	}, true
+}
+
+// examEvent turns an exam into a timed event in floating local time
+//
+// Returns:
+//   - icsEvent: Event lasting the exam's duration
+//   - bool: False if the exam's start time cannot be read
+func examEvent(exam *models.Exam) (icsEvent, bool) {
+	start, err := time.Parse(models.ExamTimeLayout, exam.StartsAt)
+	if err != nil {
+		return icsEvent{}, false
+	}
+	return icsEvent{
+		UID:        fmt.Sprintf("exam-%d@wg-edu", exam.ID),
+		Summary:    fmt.Sprintf("%s (%s): %s", exam.SubjectName, exam.Grade, exam.Name),
+		Location:   exam.Location,
+		Categories: []string{"Exam"},
+		Start:      start,
+		End:        start.Add(time.Duration(exam.DurationMinutes) * time.Minute),
+		Modified:   exam.UpdatedAt,
+	}, true
+}
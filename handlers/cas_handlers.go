@@ -0,0 +1,348 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"wg-edu-server/middleware"
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// casError responds to an error from changing a CAS activity
+func casError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "CAS activity not found"})
+	case errors.Is(err, models.ErrNotSupervisor):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not supervise this CAS activity"})
+	case errors.Is(err, models.ErrCASApproved), errors.Is(err, models.ErrCASReviewed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidCAS):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// casStudent loads the IB student record of the calling user, responding if
+// the user is not an IB student
+//
+// Returns:
+//   - *models.Student: Student, or nil if a response has been sent
+func (h *Handler) casStudent(c *gin.Context) *models.Student {
+	student, err := h.Students.GetStudentByUserID(c.GetInt("user_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only students log CAS activities"})
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error getting student of user %d: %v", c.GetInt("user_id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve student"})
+		return nil
+	}
+
+	if !models.IsDiplomaGrade(student.Grade) {
+		c.JSON(http.StatusConflict, gin.H{"error": "CAS only applies to IB1 and IB2 students"})
+		return nil
+	}
+	return student
+}
+
+// casProgress responds with a student's CAS progress and activities
+func (h *Handler) casProgress(c *gin.Context, student *models.Student) {
+	activities, err := h.CAS.GetStudentCASActivities(student.ID)
+	if err != nil {
+		log.Printf("Error getting CAS activities of student %d: %v", student.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve CAS activities"})
+		return
+	}
+
+	progress := models.BuildCASProgress(activities)
+	progress.StudentID = student.ID
+	progress.StudentName = student.FirstName + " " + student.LastName
+	c.JSON(http.StatusOK, progress)
+}
+
+// HandleGetMyCASProgress retrieves the calling student's CAS progress and activities
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Returns:
+//   - 200 OK with approved hours per strand, learning outcome progress and every activity
+//   - 403 Forbidden without the cas:log permission or if the caller is not a student
+//   - 409 Conflict if the student is not in IB1 or IB2
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetMyCASProgress(c *gin.Context) {
+	student := h.casStudent(c)
+	if student == nil {
+		return
+	}
+	h.casProgress(c, student)
+}
+
+// HandleGetStudentCASProgress retrieves a student's CAS progress and activities
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Student ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with approved hours per strand, learning outcome progress and every activity
+//   - 400 Bad Request if the student ID is invalid
+//   - 403 Forbidden without the cas:read permission
+//   - 404 Not Found if the student doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetStudentCASProgress(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID"})
+		return
+	}
+
+	student, err := h.Students.GetStudentByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+	h.casProgress(c, student)
+}
+
+// HandleCreateCASActivity logs a CAS activity for the calling student, pending review
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Expected Request Body:
+//   - title: Short description
+//   - strands: One or more of creativity, activity and service
+//   - hours: Time spent, above 0
+//   - start_date, end_date: YYYY-MM-DD; end_date is optional
+//   - reflection: The student's reflection
+//   - evidence: Optional link or description
+//   - outcomes: Learning outcomes 1 to 7 the activity demonstrates
+//   - supervisor_id: User ID of an active teacher
+//
+// Returns:
+//   - 201 Created with the activity
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the cas:log permission or if the caller is not a student
+//   - 409 Conflict if the student is not in IB1 or IB2
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleCreateCASActivity(c *gin.Context) {
+	var req models.CASActivityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	student := h.casStudent(c)
+	if student == nil {
+		return
+	}
+
+	activity, err := h.CAS.CreateCASActivity(student.ID, &req)
+	if err != nil {
+		casError(c, err, "Failed to log CAS activity")
+		return
+	}
+
+	c.JSON(http.StatusCreated, activity)
+}
+
+// HandleUpdateCASActivity edits one of the calling student's activities and
+// resubmits it for review
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Activity ID parameter from the URL
+//
+// Expected Request Body:
+//   - The fields of HandleCreateCASActivity
+//
+// Returns:
+//   - 200 OK with the activity, pending review
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the cas:log permission or if the caller is not a student
+//   - 404 Not Found if the student has no such activity
+//   - 409 Conflict if the activity is approved
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleUpdateCASActivity(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid activity ID"})
+		return
+	}
+
+	var req models.CASActivityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	student := h.casStudent(c)
+	if student == nil {
+		return
+	}
+
+	activity, err := h.CAS.UpdateCASActivity(id, student.ID, &req)
+	if err != nil {
+		casError(c, err, "Failed to update CAS activity")
+		return
+	}
+
+	c.JSON(http.StatusOK, activity)
+}
+
+// HandleDeleteCASActivity deletes one of the calling student's activities unless it is approved
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Activity ID parameter from the URL
+//
+// Returns:
+//   - 200 OK on success
+//   - 400 Bad Request if the activity ID is invalid
+//   - 403 Forbidden without the cas:log permission or if the caller is not a student
+//   - 404 Not Found if the student has no such activity
+//   - 409 Conflict if the activity is approved
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleDeleteCASActivity(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid activity ID"})
+		return
+	}
+
+	student := h.casStudent(c)
+	if student == nil {
+		return
+	}
+
+	if err := h.CAS.DeleteCASActivity(id, student.ID); err != nil {
+		casError(c, err, "Failed to delete CAS activity")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "CAS activity deleted successfully"})
+}
+
+// HandleGetCASActivity retrieves a CAS activity. Students see their own
+// activities, supervisors the ones they supervise, and cas:read all of them.
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Activity ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with the activity
+//   - 400 Bad Request if the activity ID is invalid
+//   - 403 Forbidden if the caller may not see the activity
+//   - 404 Not Found if the activity doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetCASActivity(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid activity ID"})
+		return
+	}
+
+	activity, err := h.CAS.GetCASActivity(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "CAS activity not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting CAS activity %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve CAS activity"})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	allowed := middleware.HasPermission(c, models.PermCASRead) ||
+		(middleware.HasPermission(c, models.PermCASSupervise) && activity.SupervisorID == userID)
+	if !allowed && middleware.HasPermission(c, models.PermCASLog) {
+		student, err := h.Students.GetStudentByUserID(userID)
+		allowed = err == nil && student.ID == activity.StudentID
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You may not view this CAS activity"})
+		return
+	}
+
+	c.JSON(http.StatusOK, activity)
+}
+
+// HandleGetSupervisedCASActivities lists the CAS activities the caller supervises
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - status: Optional pending, approved or rejected filter
+//
+// Returns:
+//   - 200 OK with the activities, most recent first
+//   - 400 Bad Request if the status is invalid
+//   - 403 Forbidden without the cas:supervise permission
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetSupervisedCASActivities(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && status != models.CASPending && status != models.CASApproved && status != models.CASRejected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status. Must be pending, approved, or rejected"})
+		return
+	}
+
+	activities, err := h.CAS.GetSupervisedCASActivities(c.GetInt("user_id"), status)
+	if err != nil {
+		log.Printf("Error getting CAS activities supervised by user %d: %v", c.GetInt("user_id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve CAS activities"})
+		return
+	}
+
+	c.JSON(http.StatusOK, activities)
+}
+
+// HandleReviewCASActivity approves or rejects a pending CAS activity
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Activity ID parameter from the URL
+//
+// Expected Request Body:
+//   - status: approved or rejected
+//   - comment: Feedback for the student; required when rejecting
+//
+// Returns:
+//   - 200 OK with the reviewed activity
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the cas:supervise permission or if the caller does not supervise the activity
+//   - 404 Not Found if the activity doesn't exist
+//   - 409 Conflict if the activity is not pending
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleReviewCASActivity(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid activity ID"})
+		return
+	}
+
+	var req models.CASReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	activity, err := h.CAS.ReviewCASActivity(id, c.GetInt("user_id"), &req)
+	if err != nil {
+		casError(c, err, "Failed to review CAS activity")
+		return
+	}
+
+	c.JSON(http.StatusOK, activity)
+}
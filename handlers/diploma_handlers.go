@@ -0,0 +1,179 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sources of the subject grades used for the diploma status
+const (
+	GradeSourcePredicted = "predicted" // Latest predicted grade, else the current grade
+	GradeSourceCurrent   = "current"   // Current grade computed from marks
+)
+
+// diplomaStudent reads the student ID parameter and loads an IB student,
+// responding if anything fails
+//
+// Returns:
+//   - *models.Student: Student, or nil if a response has been sent
+func (h *Handler) diplomaStudent(c *gin.Context) *models.Student {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID"})
+		return nil
+	}
+
+	student, err := h.Students.GetStudentByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return nil
+	}
+
+	if !models.IsDiplomaGrade(student.Grade) {
+		c.JSON(http.StatusConflict, gin.H{"error": "The IB diploma only applies to IB1 and IB2 students"})
+		return nil
+	}
+	return student
+}
+
+// diplomaSubjects collects the grades of a student's IB subjects
+//
+// Parameters:
+//   - studentID: Student whose subjects are collected
+//   - source: GradeSourcePredicted or GradeSourceCurrent
+//
+// Returns:
+//   - []models.DiplomaSubjectGrade: One entry per HL or SL subject, without a grade if none is known
+//   - error: Error if enrollments or gradebooks cannot be loaded
+func (h *Handler) diplomaSubjects(studentID int, source string) ([]models.DiplomaSubjectGrade, error) {
+	enrollments, err := h.Enrollments.GetStudentEnrollments(studentID)
+	if err != nil {
+		return nil, err
+	}
+
+	subjects := []models.DiplomaSubjectGrade{}
+	for _, e := range enrollments {
+		if e.Level == "" {
+			continue
+		}
+		book, err := h.Gradebook.GetStudentGradebook(e.SubjectID, studentID)
+		if err != nil {
+			return nil, err
+		}
+
+		subject := models.DiplomaSubjectGrade{
+			SubjectID:   e.SubjectID,
+			SubjectName: e.SubjectName,
+			Group:       e.Group,
+			Level:       e.Level,
+		}
+		switch {
+		case source == GradeSourcePredicted && book.Predicted != nil:
+			subject.Grade, subject.Source = book.Predicted.Grade, GradeSourcePredicted
+		case book.Grade != 0:
+			subject.Grade, subject.Source = book.Grade, GradeSourceCurrent
+		}
+		subjects = append(subjects, subject)
+	}
+	return subjects, nil
+}
+
+// HandleGetDiplomaStatus tells whether an IB student is on track for the
+// diploma: it totals the subject grades and TOK/EE bonus points and explains
+// the outcome of every failing condition
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Student ID parameter from the URL
+//   - source: Optional "predicted" (default; latest predicted grade, else the
+//     current grade) or "current" (current grades only)
+//
+// Returns:
+//   - 200 OK with the points, the status (on_track, failing or incomplete) and every rule
+//   - 400 Bad Request if the student ID or source is invalid
+//   - 403 Forbidden without the diploma:read permission
+//   - 404 Not Found if the student doesn't exist
+//   - 409 Conflict if the student is not in IB1 or IB2
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetDiplomaStatus(c *gin.Context) {
+	source := c.DefaultQuery("source", GradeSourcePredicted)
+	if source != GradeSourcePredicted && source != GradeSourceCurrent {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid source. Must be predicted or current"})
+		return
+	}
+
+	student := h.diplomaStudent(c)
+	if student == nil {
+		return
+	}
+
+	subjects, err := h.diplomaSubjects(student.ID, source)
+	if err != nil {
+		log.Printf("Error getting diploma subjects of student %d: %v", student.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve diploma status"})
+		return
+	}
+
+	core, err := h.Diploma.GetDiplomaCore(student.ID)
+	if err != nil {
+		log.Printf("Error getting diploma core of student %d: %v", student.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve diploma status"})
+		return
+	}
+
+	status := models.EvaluateDiploma(subjects, *core)
+	status.StudentID = student.ID
+	status.StudentName = student.FirstName + " " + student.LastName
+	c.JSON(http.StatusOK, status)
+}
+
+// HandleSetDiplomaCore records an IB student's TOK, EE and CAS results
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Student ID parameter from the URL
+//
+// Expected Request Body:
+//   - tok: Theory of Knowledge grade A to E or N; empty if not graded yet
+//   - ee: Extended Essay grade A to E or N; empty if not graded yet
+//   - cas_complete: true or false; null if not decided yet
+//
+// Returns:
+//   - 200 OK with the recorded results
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the diploma:write permission
+//   - 404 Not Found if the student doesn't exist
+//   - 409 Conflict if the student is not in IB1 or IB2
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleSetDiplomaCore(c *gin.Context) {
+	var req models.DiplomaCoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	student := h.diplomaStudent(c)
+	if student == nil {
+		return
+	}
+
+	core, err := h.Diploma.SetDiplomaCore(student.ID, c.GetInt("user_id"), &req)
+	if errors.Is(err, models.ErrInvalidDiplomaCore) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error recording diploma core of student %d: %v", student.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record core results"})
+		return
+	}
+
+	c.JSON(http.StatusOK, core)
+}
@@ -0,0 +1,149 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EnrollmentsResponse lists a student's enrollments together with the IB diploma check
+type EnrollmentsResponse struct {
+	Enrollments []*models.Enrollment `json:"enrollments"`       // Subjects the student takes
+	Diploma     *models.DiplomaCheck `json:"diploma,omitempty"` // Omitted for Pre-IB students
+}
+
+// HandleGetStudentEnrollments retrieves the subjects a student is enrolled in
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Student ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with enrollments and, for IB students, the diploma combination check
+//   - 400 Bad Request if student ID is invalid
+//   - 403 Forbidden without the enrollments:read permission
+//   - 404 Not Found if student doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetStudentEnrollments(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID"})
+		return
+	}
+
+	student, err := h.Students.GetStudentByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	enrollments, err := h.Enrollments.GetStudentEnrollments(id)
+	if err != nil {
+		log.Printf("Error getting enrollments of student %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve enrollments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, EnrollmentsResponse{
+		Enrollments: enrollments,
+		Diploma:     models.CheckDiplomaCombination(student, enrollments),
+	})
+}
+
+// HandleEnrollStudent enrolls a student in a subject
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Student ID parameter from the URL
+//
+// Expected Request Body:
+//   - subject_id: Subject to enroll in; must be for the student's grade
+//   - level: HL or SL for IB1/IB2 subjects, omitted for PIB subjects
+//
+// Returns:
+//   - 201 Created with the enrollment on success
+//   - 400 Bad Request if the input is invalid or breaks the IB diploma rules
+//   - 403 Forbidden without the enrollments:write permission
+//   - 404 Not Found if the student or subject doesn't exist
+//   - 409 Conflict if the student is already enrolled, the subject is archived,
+//     or with the conflicting lessons if a lesson of the subject clashes with
+//     one the student already attends
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleEnrollStudent(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID"})
+		return
+	}
+
+	var req models.EnrollmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.SubjectID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	enrollment, conflicts, err := h.Enrollments.EnrollStudent(id, &req)
+	switch {
+	case err == nil && len(conflicts) > 0:
+		c.JSON(http.StatusConflict, gin.H{"error": "The subject clashes with the student's timetable", "conflicts": conflicts})
+	case err == nil:
+		c.JSON(http.StatusCreated, enrollment)
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student or subject not found"})
+	case errors.Is(err, models.ErrSubjectArchived):
+		c.JSON(http.StatusConflict, gin.H{"error": "Archived subjects take no new enrollments"})
+	case errors.Is(err, models.ErrEnrollmentRule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case models.IsDuplicate(err):
+		c.JSON(http.StatusConflict, gin.H{"error": "Student is already enrolled in this subject"})
+	default:
+		log.Printf("Error enrolling student %d in subject %d: %v", id, req.SubjectID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enroll student"})
+	}
+}
+
+// HandleUnenrollStudent removes a student from a subject
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Student ID parameter from the URL
+//   - subjectId: Subject ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with success message
+//   - 400 Bad Request if an ID is invalid
+//   - 403 Forbidden without the enrollments:write permission
+//   - 404 Not Found if the student is not enrolled in the subject
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleUnenrollStudent(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID"})
+		return
+	}
+
+	subjectID, err := strconv.Atoi(c.Param("subjectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subject ID"})
+		return
+	}
+
+	if err := h.Enrollments.UnenrollStudent(id, subjectID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Enrollment not found"})
+			return
+		}
+		log.Printf("Error unenrolling student %d from subject %d: %v", id, subjectID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unenroll student"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Student unenrolled successfully"})
+}
@@ -0,0 +1,325 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportFormat describes a file format exports can be written in
+type exportFormat struct {
+	ContentType string // Response media type
+	Extension   string // File name extension
+	newWriter   func(w io.Writer, columns []string) exportWriter
+}
+
+// exportFormats maps format names, as accepted by the format query parameter, to formats
+var exportFormats = map[string]exportFormat{
+	"csv":  {ContentType: "text/csv", Extension: "csv", newWriter: newCSVExportWriter},
+	"xlsx": {ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Extension: "xlsx", newWriter: newXLSXExportWriter},
+	"json": {ContentType: "application/json", Extension: "json", newWriter: newJSONExportWriter},
+}
+
+// exportWriter writes the rows of an export one at a time
+type exportWriter interface {
+	// Row writes one record. CSV and XLSX write the cells, in column order;
+	// JSON writes the value as an element of an array.
+	Row(cells []string, value interface{}) error
+	// Close writes whatever follows the last row
+	Close() error
+}
+
+// parseExportFormat picks the export format from the format query parameter
+// or, without it, from the Accept header. JSON is used if neither names a format.
+//
+// Parameters:
+//   - c: Gin context of the export request
+//
+// Returns:
+//   - string: Format name, a key of exportFormats
+//   - int: 0, or the status to respond with if no format can be used
+func parseExportFormat(c *gin.Context) (string, int) {
+	if format := strings.ToLower(c.Query("format")); format != "" {
+		if _, ok := exportFormats[format]; !ok {
+			return "", http.StatusBadRequest
+		}
+		return format, 0
+	}
+
+	accept := c.GetHeader("Accept")
+	if accept == "" {
+		return "json", 0
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if mediaType == "*/*" || mediaType == "application/*" {
+			return "json", 0
+		}
+		for name, format := range exportFormats {
+			if mediaType == format.ContentType {
+				return name, 0
+			}
+		}
+	}
+	return "", http.StatusNotAcceptable
+}
+
+// exporter streams an export to the response. Nothing is written until the
+// first row or Close, so that errors found before then can still be answered
+// with an error status.
+type exporter struct {
+	c        *gin.Context
+	format   exportFormat
+	filename string
+	columns  []string
+	buf      *bufio.Writer
+	writer   exportWriter
+}
+
+// newExporter creates an exporter for a format name returned by parseExportFormat
+//
+// Parameters:
+//   - c: Gin context to respond on
+//   - format: Format name
+//   - name: File name without extension
+//   - columns: Column headers for CSV and XLSX
+//
+// Returns:
+//   - *exporter: Exporter that has not written anything yet
+func newExporter(c *gin.Context, format, name string, columns []string) *exporter {
+	f := exportFormats[format]
+	return &exporter{c: c, format: f, filename: name + "." + f.Extension, columns: columns}
+}
+
+// Started reports whether the response has been started
+func (e *exporter) Started() bool {
+	return e.writer != nil
+}
+
+// start sends the headers and everything preceding the first row
+func (e *exporter) start() {
+	e.c.Header("Content-Type", e.format.ContentType)
+	e.c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", e.filename))
+	e.c.Status(http.StatusOK)
+	e.buf = bufio.NewWriter(e.c.Writer)
+	e.writer = e.format.newWriter(e.buf, e.columns)
+}
+
+// Row writes one record, starting the response if needed
+func (e *exporter) Row(cells []string, value interface{}) error {
+	if !e.Started() {
+		e.start()
+	}
+	return e.writer.Row(cells, value)
+}
+
+// Close finishes the export, starting the response if there were no rows
+func (e *exporter) Close() error {
+	if !e.Started() {
+		e.start()
+	}
+	if err := e.writer.Close(); err != nil {
+		return err
+	}
+	return e.buf.Flush()
+}
+
+// csvExportWriter writes an export as CSV with a header row
+type csvExportWriter struct {
+	w       *csv.Writer
+	columns []string
+	started bool
+}
+
+// newCSVExportWriter creates a CSV writer whose first row holds the column headers
+func newCSVExportWriter(w io.Writer, columns []string) exportWriter {
+	return &csvExportWriter{w: csv.NewWriter(w), columns: columns}
+}
+
+// header writes the header row once
+func (w *csvExportWriter) header() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	return w.w.Write(w.columns)
+}
+
+// Row writes the cells of a record
+func (w *csvExportWriter) Row(cells []string, _ interface{}) error {
+	if err := w.header(); err != nil {
+		return err
+	}
+	return w.w.Write(cells)
+}
+
+// Close writes the header if there were no rows and flushes buffered rows
+func (w *csvExportWriter) Close() error {
+	if err := w.header(); err != nil {
+		return err
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// jsonExportWriter writes an export as a JSON array
+type jsonExportWriter struct {
+	w    io.Writer
+	rows int
+}
+
+// newJSONExportWriter creates a JSON writer; columns are not used
+func newJSONExportWriter(w io.Writer, _ []string) exportWriter {
+	return &jsonExportWriter{w: w}
+}
+
+// Row writes a value as the next array element
+func (w *jsonExportWriter) Row(_ []string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if w.rows == 0 {
+		sep = "[\n"
+	}
+	w.rows++
+	if _, err := io.WriteString(w.w, sep); err != nil {
+		return err
+	}
+	_, err = w.w.Write(data)
+	return err
+}
+
+// Close ends the array, writing an empty one if there were no rows
+func (w *jsonExportWriter) Close() error {
+	end := "\n]\n"
+	if w.rows == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(w.w, end)
+	return err
+}
+
+// Fixed parts of an exported XLSX workbook with a single worksheet
+const (
+	xlsxContentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`
+	xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+	xlsxWorkbookXML = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Export" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`
+)
+
+// xlsxExportWriter writes an export as an XLSX workbook. The worksheet is the
+// last part of the archive and is written row by row with inline strings.
+type xlsxExportWriter struct {
+	archive *zip.Writer
+	sheet   io.Writer
+	columns []string
+	rows    int
+	err     error
+}
+
+// newXLSXExportWriter creates an XLSX writer whose first row holds the column headers
+func newXLSXExportWriter(w io.Writer, columns []string) exportWriter {
+	return &xlsxExportWriter{archive: zip.NewWriter(w), columns: columns}
+}
+
+// header writes the fixed parts, opens the worksheet and writes the header row
+func (w *xlsxExportWriter) header() error {
+	if w.sheet != nil || w.err != nil {
+		return w.err
+	}
+
+	for _, part := range []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbookXML},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	} {
+		f, err := w.archive.Create(part.name)
+		if err == nil {
+			_, err = io.WriteString(f, part.content)
+		}
+		if err != nil {
+			w.err = err
+			return err
+		}
+	}
+
+	if w.sheet, w.err = w.archive.Create("xl/worksheets/sheet1.xml"); w.err != nil {
+		return w.err
+	}
+	if _, w.err = io.WriteString(w.sheet, xml.Header+
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); w.err != nil {
+		return w.err
+	}
+	return w.row(w.columns)
+}
+
+// row writes one worksheet row of inline strings
+func (w *xlsxExportWriter) row(cells []string) error {
+	w.rows++
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, w.rows)
+	for i, cell := range cells {
+		fmt.Fprintf(&b, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">`, xlsxColumnName(i), w.rows)
+		xml.EscapeText(&b, []byte(cell))
+		b.WriteString(`</t></is></c>`)
+	}
+	b.WriteString(`</row>`)
+
+	_, w.err = io.WriteString(w.sheet, b.String())
+	return w.err
+}
+
+// Row writes the cells of a record
+func (w *xlsxExportWriter) Row(cells []string, _ interface{}) error {
+	if err := w.header(); err != nil {
+		return err
+	}
+	return w.row(cells)
+}
+
+// Close ends the worksheet and the archive
+func (w *xlsxExportWriter) Close() error {
+	if err := w.header(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w.sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return w.archive.Close()
+}
+
+// xlsxColumnName converts a 0-based column index to its letters, e.g. 27 to "AB"
+func xlsxColumnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
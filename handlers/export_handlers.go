@@ -0,0 +1,192 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Column headers of the CSV and XLSX exports
+var (
+	studentExportColumns = []string{"id", "username", "first_name", "last_name", "email", "grade", "created_at", "updated_at"}
+	teacherExportColumns = []string{"id", "username", "first_name", "last_name", "email", "active", "subjects"}
+	subjectExportColumns = []string{"id", "grade", "name", "description", "group", "levels", "archived", "created_at"}
+)
+
+// startExport picks the export format and creates an exporter, responding
+// with an error if the requested format is unknown or not acceptable
+//
+// Parameters:
+//   - c: Gin context of the export request
+//   - name: File name without extension
+//   - columns: Column headers for CSV and XLSX
+//
+// Returns:
+//   - *exporter: Exporter, or nil if a response has been sent
+func startExport(c *gin.Context, name string, columns []string) *exporter {
+	format, status := parseExportFormat(c)
+	switch status {
+	case http.StatusBadRequest:
+		c.JSON(status, ErrorResponse{Error: "Invalid format. Must be csv, xlsx, or json"})
+		return nil
+	case http.StatusNotAcceptable:
+		c.JSON(status, ErrorResponse{Error: "Export is available as text/csv, application/json or XLSX"})
+		return nil
+	}
+	return newExporter(c, format, name, columns)
+}
+
+// finishExport completes an export after its rows have been written. Errors
+// found before the first row are answered like list errors; once rows have
+// been sent the response can only be cut short.
+func finishExport(c *gin.Context, exp *exporter, err error, message string) {
+	if err != nil {
+		if !exp.Started() {
+			listError(c, err, message)
+			return
+		}
+		log.Printf("%s: %v", message, err)
+		return
+	}
+	if err := exp.Close(); err != nil {
+		log.Printf("%s: %v", message, err)
+	}
+}
+
+// formatExportTime formats a timestamp for CSV and XLSX exports
+func formatExportTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// HandleExportStudents exports every student as CSV, XLSX or JSON
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - format: csv, xlsx or json; the Accept header is used if omitted
+//   - sort, q, filter[...]: As for the student list; limit, page and cursor are ignored
+//
+// Returns:
+//   - 200 OK with the students as a file download, streamed row by row
+//   - 400 Bad Request if the format or a list parameter is invalid
+//   - 403 Forbidden without the students:read permission
+//   - 406 Not Acceptable if the Accept header names no export format
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleExportStudents(c *gin.Context) {
+	params, err := parseListParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	exp := startExport(c, "students", studentExportColumns)
+	if exp == nil {
+		return
+	}
+
+	err = h.Students.EachStudent(params, func(s *models.Student) error {
+		return exp.Row([]string{
+			strconv.Itoa(s.ID),
+			s.Username,
+			s.FirstName,
+			s.LastName,
+			s.Email,
+			s.Grade,
+			formatExportTime(s.CreatedAt),
+			formatExportTime(s.UpdatedAt),
+		}, s)
+	})
+	finishExport(c, exp, err, "Failed to export students")
+}
+
+// ExportTeachers handles GET request to export every teacher with their subjects
+// @Summary Export teachers
+// @Description Streams every teacher with their assigned subjects as CSV, XLSX or JSON. Subjects are listed as "grade name", separated by semicolons, in CSV and XLSX.
+// @Tags teachers
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce json
+// @Param format query string false "csv, xlsx or json; the Accept header is used if omitted"
+// @Param sort query string false "Sort fields as for GET /api/teachers"
+// @Param filter[email] query string false "Filter by email"
+// @Param filter[active] query bool false "Filter by active status"
+// @Param q query string false "Search username, names and email"
+// @Success 200 {array} models.Teacher
+// @Failure 400 {object} ErrorResponse
+// @Failure 406 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/teachers/export [get]
+func (h *Handler) ExportTeachers(c *gin.Context) {
+	params, err := parseListParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	exp := startExport(c, "teachers", teacherExportColumns)
+	if exp == nil {
+		return
+	}
+
+	err = h.Teachers.EachTeacher(params, func(t *models.Teacher) error {
+		subjects := make([]string, len(t.Subjects))
+		for i, subject := range t.Subjects {
+			subjects[i] = subject.Grade + " " + subject.Name
+		}
+		return exp.Row([]string{
+			strconv.Itoa(t.ID),
+			t.Username,
+			t.FirstName,
+			t.LastName,
+			t.Email,
+			strconv.FormatBool(t.Active),
+			strings.Join(subjects, "; "),
+		}, t)
+	})
+	finishExport(c, exp, err, "Failed to export teachers")
+}
+
+// ExportSubjects handles GET request to export the subject catalogue
+// @Summary Export subjects
+// @Description Streams every subject ordered by grade and name as CSV, XLSX or JSON. Archived subjects are omitted unless include_archived=true.
+// @Tags subjects
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce json
+// @Param format query string false "csv, xlsx or json; the Accept header is used if omitted"
+// @Param include_archived query bool false "Include archived subjects"
+// @Success 200 {array} models.Subject
+// @Failure 400 {object} ErrorResponse
+// @Failure 406 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/subjects/export [get]
+func (h *Handler) ExportSubjects(c *gin.Context) {
+	exp := startExport(c, "subjects", subjectExportColumns)
+	if exp == nil {
+		return
+	}
+
+	err := h.Subjects.EachSubject(includeArchived(c), func(s *models.Subject) error {
+		group := ""
+		if s.Group != 0 {
+			group = strconv.Itoa(s.Group)
+		}
+		return exp.Row([]string{
+			strconv.Itoa(s.ID),
+			s.Grade,
+			s.Name,
+			s.Description,
+			group,
+			strings.Join(s.Levels, "; "),
+			strconv.FormatBool(s.Archived),
+			formatExportTime(s.CreatedAt),
+		}, s)
+	})
+	finishExport(c, exp, err, "Failed to export subjects")
+}
@@ -0,0 +1,461 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SubjectGradesResponse lists the current grades of a subject's students
+type SubjectGradesResponse struct {
+	SubjectID   int                    `json:"subject_id"`
+	SubjectName string                 `json:"subject_name"`
+	Scheme      *models.GradingScheme  `json:"scheme"`   // Categories and boundaries the grades are based on
+	Students    []*models.StudentGrade `json:"students"` // One grade per enrolled student
+}
+
+// RecordScoresRequest is the request body for recording marks of an assessment
+type RecordScoresRequest struct {
+	Scores []models.ScoreEntry `json:"scores"`
+}
+
+// gradebookError responds to an error from changing a gradebook
+func gradebookError(c *gin.Context, err error, notFound, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	case errors.Is(err, models.ErrNotTeaching):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not assigned to teach this subject"})
+	case errors.Is(err, models.ErrCategoryInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidGradebook):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// assessmentWithAccess reads the assessment ID parameter, loads the
+// assessment with its marks and checks the user may see them, responding if
+// anything fails
+//
+// Returns:
+//   - *models.Assessment: Assessment, or nil if a response has been sent
+func (h *Handler) assessmentWithAccess(c *gin.Context) *models.Assessment {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assessment ID"})
+		return nil
+	}
+
+	assessment, err := h.Gradebook.GetAssessment(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Assessment not found"})
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error getting assessment %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve assessment"})
+		return nil
+	}
+
+	if !h.requireSubjectAccess(c, assessment.SubjectID, models.PermGradebookRead, models.PermGradebookWrite) {
+		return nil
+	}
+	return assessment
+}
+
+// HandleGetGradingScheme retrieves the assessment categories and grade boundaries of a subject
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Subject ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with the grading scheme
+//   - 400 Bad Request if the subject ID is invalid
+//   - 403 Forbidden without gradebook:read, unless the caller teaches the subject
+//   - 404 Not Found if the subject doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetGradingScheme(c *gin.Context) {
+	subject := h.subjectWithAccess(c, models.PermGradebookRead, models.PermGradebookWrite)
+	if subject == nil {
+		return
+	}
+
+	scheme, err := h.Gradebook.GetGradingScheme(subject.ID)
+	if err != nil {
+		log.Printf("Error getting grading scheme of subject %d: %v", subject.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve grading scheme"})
+		return
+	}
+
+	c.JSON(http.StatusOK, scheme)
+}
+
+// HandleSetGradingScheme replaces the assessment categories and grade boundaries of a subject
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Subject ID parameter from the URL
+//
+// Expected Request Body:
+//   - categories: List of {name, weight}; every category used by an assessment must be kept
+//   - boundaries: Optional ascending minimum percentages for IB grades 2 to 7;
+//     the default boundaries apply if omitted
+//
+// Returns:
+//   - 200 OK with the updated scheme
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the gradebook:write permission or if the caller does not teach the subject
+//   - 404 Not Found if the subject doesn't exist
+//   - 409 Conflict if a dropped category still has assessments
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleSetGradingScheme(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subject ID"})
+		return
+	}
+
+	var req models.GradingSchemeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	scheme, err := h.Gradebook.SetGradingScheme(id, c.GetInt("user_id"), &req)
+	if err != nil {
+		gradebookError(c, err, "Subject not found", "Failed to update grading scheme")
+		return
+	}
+
+	c.JSON(http.StatusOK, scheme)
+}
+
+// HandleGetSubjectAssessments lists the assessments of a subject without their marks
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Subject ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with the assessments, oldest first
+//   - 400 Bad Request if the subject ID is invalid
+//   - 403 Forbidden without gradebook:read, unless the caller teaches the subject
+//   - 404 Not Found if the subject doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetSubjectAssessments(c *gin.Context) {
+	subject := h.subjectWithAccess(c, models.PermGradebookRead, models.PermGradebookWrite)
+	if subject == nil {
+		return
+	}
+
+	assessments, err := h.Gradebook.GetSubjectAssessments(subject.ID)
+	if err != nil {
+		log.Printf("Error getting assessments of subject %d: %v", subject.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve assessments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, assessments)
+}
+
+// HandleCreateAssessment adds an assessment to a subject
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Subject ID parameter from the URL
+//
+// Expected Request Body:
+//   - name: Name of the assessment
+//   - category: Category of the subject's grading scheme
+//   - weight: Optional weight within the category, defaults to 1
+//   - max_mark: Highest possible mark
+//   - date: Day of the assessment as YYYY-MM-DD
+//
+// Returns:
+//   - 201 Created with the assessment
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the gradebook:write permission or if the caller does not teach the subject
+//   - 404 Not Found if the subject doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleCreateAssessment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subject ID"})
+		return
+	}
+
+	var req models.AssessmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	assessment, err := h.Gradebook.CreateAssessment(id, c.GetInt("user_id"), &req)
+	if err != nil {
+		gradebookError(c, err, "Subject not found", "Failed to create assessment")
+		return
+	}
+
+	c.JSON(http.StatusCreated, assessment)
+}
+
+// HandleGetAssessment retrieves an assessment with its marks
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Assessment ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with the assessment and its marks
+//   - 400 Bad Request if the assessment ID is invalid
+//   - 403 Forbidden without gradebook:read, unless the caller teaches the subject
+//   - 404 Not Found if the assessment doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetAssessment(c *gin.Context) {
+	assessment := h.assessmentWithAccess(c)
+	if assessment == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, assessment)
+}
+
+// HandleUpdateAssessment changes an assessment
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Assessment ID parameter from the URL
+//
+// Expected Request Body:
+//   - The fields of HandleCreateAssessment; max_mark may not drop below a recorded mark
+//
+// Returns:
+//   - 200 OK with the updated assessment and its marks
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the gradebook:write permission or if the caller does not teach the subject
+//   - 404 Not Found if the assessment doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleUpdateAssessment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assessment ID"})
+		return
+	}
+
+	var req models.AssessmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	assessment, err := h.Gradebook.UpdateAssessment(id, c.GetInt("user_id"), &req)
+	if err != nil {
+		gradebookError(c, err, "Assessment not found", "Failed to update assessment")
+		return
+	}
+
+	c.JSON(http.StatusOK, assessment)
+}
+
+// HandleDeleteAssessment deletes an assessment and its marks
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Assessment ID parameter from the URL
+//
+// Returns:
+//   - 200 OK on success
+//   - 400 Bad Request if the assessment ID is invalid
+//   - 403 Forbidden without the gradebook:write permission or if the caller does not teach the subject
+//   - 404 Not Found if the assessment doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleDeleteAssessment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assessment ID"})
+		return
+	}
+
+	if err := h.Gradebook.DeleteAssessment(id, c.GetInt("user_id")); err != nil {
+		gradebookError(c, err, "Assessment not found", "Failed to delete assessment")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Assessment deleted successfully"})
+}
+
+// HandleRecordScores adds or corrects marks of an assessment.
+// Students not listed keep their marks.
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Assessment ID parameter from the URL
+//
+// Expected Request Body:
+//   - scores: List of {student_id, mark}; students must be enrolled in the
+//     subject and marks must be between 0 and the maximum mark
+//
+// Returns:
+//   - 200 OK with the assessment and all of its marks
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the gradebook:write permission or if the caller does not teach the subject
+//   - 404 Not Found if the assessment doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleRecordScores(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assessment ID"})
+		return
+	}
+
+	var req RecordScoresRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Scores) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	assessment, err := h.Gradebook.RecordScores(id, c.GetInt("user_id"), req.Scores)
+	if err != nil {
+		gradebookError(c, err, "Assessment not found", "Failed to record marks")
+		return
+	}
+
+	c.JSON(http.StatusOK, assessment)
+}
+
+// HandleGetSubjectGrades lists the current grade of every student enrolled in a subject
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Subject ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with the grading scheme and one grade per student, including the
+//     latest predicted grade
+//   - 400 Bad Request if the subject ID is invalid
+//   - 403 Forbidden without gradebook:read, unless the caller teaches the subject
+//   - 404 Not Found if the subject doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetSubjectGrades(c *gin.Context) {
+	subject := h.subjectWithAccess(c, models.PermGradebookRead, models.PermGradebookWrite)
+	if subject == nil {
+		return
+	}
+
+	scheme, err := h.Gradebook.GetGradingScheme(subject.ID)
+	if err != nil {
+		log.Printf("Error getting grading scheme of subject %d: %v", subject.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve grades"})
+		return
+	}
+
+	grades, err := h.Gradebook.GetSubjectGrades(subject.ID)
+	if err != nil {
+		log.Printf("Error getting grades of subject %d: %v", subject.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve grades"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SubjectGradesResponse{
+		SubjectID:   subject.ID,
+		SubjectName: subject.Name,
+		Scheme:      scheme,
+		Students:    grades,
+	})
+}
+
+// HandleGetStudentGradebook retrieves a student's marks, current grade and
+// predicted grade history in a subject
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Subject ID parameter from the URL
+//   - studentId: Student ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with the student's gradebook
+//   - 400 Bad Request if an ID is invalid
+//   - 403 Forbidden without gradebook:read, unless the caller teaches the subject
+//   - 404 Not Found if the subject doesn't exist or the student is not enrolled in it
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetStudentGradebook(c *gin.Context) {
+	studentID, err := strconv.Atoi(c.Param("studentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID"})
+		return
+	}
+
+	subject := h.subjectWithAccess(c, models.PermGradebookRead, models.PermGradebookWrite)
+	if subject == nil {
+		return
+	}
+
+	book, err := h.Gradebook.GetStudentGradebook(subject.ID, studentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student is not enrolled in this subject"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting gradebook of student %d in subject %d: %v", studentID, subject.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve gradebook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, book)
+}
+
+// HandleAddPredictedGrade records a predicted IB grade for a student. Earlier
+// predictions are kept as history.
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Subject ID parameter from the URL
+//   - studentId: Student ID parameter from the URL
+//
+// Expected Request Body:
+//   - grade: IB grade 1 to 7
+//   - comment: Optional justification
+//
+// Returns:
+//   - 201 Created with the predicted grade
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the gradebook:write permission or if the caller does not teach the subject
+//   - 404 Not Found if the student is not enrolled in the subject
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleAddPredictedGrade(c *gin.Context) {
+	subjectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subject ID"})
+		return
+	}
+	studentID, err := strconv.Atoi(c.Param("studentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID"})
+		return
+	}
+
+	var req models.PredictedGradeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	predicted, err := h.Gradebook.AddPredictedGrade(subjectID, studentID, c.GetInt("user_id"), &req)
+	if err != nil {
+		gradebookError(c, err, "Student is not enrolled in this subject", "Failed to record predicted grade")
+		return
+	}
+
+	c.JSON(http.StatusCreated, predicted)
+}
@@ -0,0 +1,289 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAllGuardians handles GET request to list guardians
+// @Summary List guardians
+// @Description Lists every guardian with the students they are linked to
+// @Tags guardians
+// @Produce json
+// @Success 200 {array} models.Guardian
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/guardians [get]
+func (h *Handler) GetAllGuardians(c *gin.Context) {
+	guardians, err := h.Guardians.GetAllGuardians()
+	if err != nil {
+		log.Printf("Error listing guardians: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve guardians"})
+		return
+	}
+
+	c.JSON(http.StatusOK, guardians)
+}
+
+// GetGuardian handles GET request to retrieve a guardian
+// @Summary Get guardian
+// @Description Retrieves a guardian with the students they are linked to
+// @Tags guardians
+// @Produce json
+// @Param id path int true "Guardian ID"
+// @Success 200 {object} models.Guardian
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/guardians/{id} [get]
+func (h *Handler) GetGuardian(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid guardian ID"})
+		return
+	}
+
+	guardian, err := h.Guardians.GetGuardianByID(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Guardian not found"})
+			return
+		}
+		log.Printf("Error getting guardian %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve guardian"})
+		return
+	}
+
+	c.JSON(http.StatusOK, guardian)
+}
+
+// CreateGuardian handles POST request to create a guardian with their login account
+// @Summary Create guardian
+// @Description Creates a guardian profile and login account in one transaction
+// @Tags guardians
+// @Accept json
+// @Produce json
+// @Param request body models.GuardianRequest true "Guardian details"
+// @Success 201 {object} models.Guardian
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/guardians [post]
+func (h *Handler) CreateGuardian(c *gin.Context) {
+	var req models.GuardianRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	if req.FirstName == "" || req.LastName == "" || req.Email == "" || req.Username == "" || req.Password == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing required fields"})
+		return
+	}
+	if err := models.ValidatePassword(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	guardian, err := h.Guardians.CreateGuardian(&req)
+	if err != nil {
+		if models.IsDuplicate(err) {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "Username or email already in use"})
+			return
+		}
+		log.Printf("Error creating guardian %s: %v", req.Username, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create guardian"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, guardian)
+}
+
+// UpdateGuardian handles PUT request to update a guardian's profile
+// @Summary Update guardian
+// @Description Updates a guardian's name, email and phone, and their password if given
+// @Tags guardians
+// @Accept json
+// @Produce json
+// @Param id path int true "Guardian ID"
+// @Param request body models.GuardianRequest true "Guardian details"
+// @Success 200 {object} models.Guardian
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/guardians/{id} [put]
+func (h *Handler) UpdateGuardian(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid guardian ID"})
+		return
+	}
+
+	var req models.GuardianRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	if req.FirstName == "" || req.LastName == "" || req.Email == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing required fields"})
+		return
+	}
+	if req.Password != "" {
+		if err := models.ValidatePassword(req.Password); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	guardian, err := h.Guardians.UpdateGuardian(id, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Guardian not found"})
+		case models.IsDuplicate(err):
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "Email already in use"})
+		default:
+			log.Printf("Error updating guardian %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update guardian"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, guardian)
+}
+
+// DeleteGuardian handles DELETE request to delete a guardian
+// @Summary Delete guardian
+// @Description Deletes a guardian together with their login account, profile and student links
+// @Tags guardians
+// @Produce json
+// @Param id path int true "Guardian ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/guardians/{id} [delete]
+func (h *Handler) DeleteGuardian(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid guardian ID"})
+		return
+	}
+
+	if err := h.Guardians.DeleteGuardian(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Guardian not found"})
+			return
+		}
+		log.Printf("Error deleting guardian %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete guardian"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Message: "Guardian deleted successfully"})
+}
+
+// LinkGuardianStudent handles POST request to link a guardian to a student
+// @Summary Link student
+// @Description Gives a guardian read access to a student through the guardian portal
+// @Tags guardians
+// @Accept json
+// @Produce json
+// @Param id path int true "Guardian ID"
+// @Param request body models.GuardianLinkRequest true "Student and relationship"
+// @Success 201 {object} models.GuardianChild
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/guardians/{id}/students [post]
+func (h *Handler) LinkGuardianStudent(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid guardian ID"})
+		return
+	}
+
+	var req models.GuardianLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := models.ValidateGuardianLink(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Tell a missing guardian apart from a missing student
+	if _, err := h.Guardians.GetGuardianByID(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Guardian not found"})
+			return
+		}
+		log.Printf("Error getting guardian %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to link student"})
+		return
+	}
+
+	child, err := h.Guardians.LinkGuardianStudent(id, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Student not found"})
+		case models.IsDuplicate(err):
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "Student is already linked to this guardian"})
+		default:
+			log.Printf("Error linking guardian %d to student %d: %v", id, req.StudentID, err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to link student"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, child)
+}
+
+// UnlinkGuardianStudent handles DELETE request to unlink a guardian from a student
+// @Summary Unlink student
+// @Description Removes a guardian's access to a student
+// @Tags guardians
+// @Produce json
+// @Param id path int true "Guardian ID"
+// @Param studentId path int true "Student ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/guardians/{id}/students/{studentId} [delete]
+func (h *Handler) UnlinkGuardianStudent(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid guardian ID"})
+		return
+	}
+	studentID, err := strconv.Atoi(c.Param("studentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid student ID"})
+		return
+	}
+
+	if err := h.Guardians.UnlinkGuardianStudent(id, studentID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Student is not linked to this guardian"})
+			return
+		}
+		log.Printf("Error unlinking guardian %d from student %d: %v", id, studentID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to unlink student"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Message: "Student unlinked successfully"})
+}
@@ -0,0 +1,185 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChildGradesResponse lists a student's gradebook in every enrolled subject
+type ChildGradesResponse struct {
+	StudentID   int                  `json:"student_id"`
+	StudentName string               `json:"student_name"`
+	Subjects    []ChildSubjectGrades `json:"subjects"` // One gradebook per enrolled subject
+}
+
+// ChildSubjectGrades is a student's gradebook in one subject
+type ChildSubjectGrades struct {
+	SubjectID   int    `json:"subject_id"`
+	SubjectName string `json:"subject_name"`
+	Level       string `json:"level,omitempty"` // HL or SL, empty for Pre-IB subjects
+	*models.StudentGradebook
+}
+
+// guardianChild loads the student checked by RequireGuardianOf, responding if
+// that fails
+//
+// Returns:
+//   - *models.Student: Student, or nil if a response has been sent
+func (h *Handler) guardianChild(c *gin.Context) *models.Student {
+	id := c.GetInt("student_id")
+	student, err := h.Students.GetStudentByID(id)
+	if err != nil {
+		// Links are removed with the student, so this is a failure rather than a 404
+		log.Printf("Error getting linked student %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve student"})
+		return nil
+	}
+	return student
+}
+
+// HandleGetMyChildren lists the students the caller is a guardian of
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Returns:
+//   - 200 OK with the linked students
+//   - 403 Forbidden without the children:read permission
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetMyChildren(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	children, err := h.Guardians.GetGuardianChildren(userID)
+	if err != nil {
+		log.Printf("Error listing children of guardian %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve children"})
+		return
+	}
+
+	c.JSON(http.StatusOK, children)
+}
+
+// HandleGetChild retrieves the profile of one of the caller's children
+//
+// Parameters:
+//   - c: Gin context with the student_id set by RequireGuardianOf
+//
+// Returns:
+//   - 200 OK with the student
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetChild(c *gin.Context) {
+	student := h.guardianChild(c)
+	if student == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, student)
+}
+
+// HandleGetChildSubjects lists the subjects one of the caller's children is
+// enrolled in
+//
+// Parameters:
+//   - c: Gin context with the student_id set by RequireGuardianOf
+//
+// Returns:
+//   - 200 OK with the enrollments
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetChildSubjects(c *gin.Context) {
+	id := c.GetInt("student_id")
+	enrollments, err := h.Enrollments.GetStudentEnrollments(id)
+	if err != nil {
+		log.Printf("Error getting enrollments of student %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve subjects"})
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollments)
+}
+
+// HandleGetChildAttendance summarizes the attendance of one of the caller's
+// children per subject
+//
+// Parameters:
+//   - c: Gin context with the student_id set by RequireGuardianOf
+//   - from, to: Optional YYYY-MM-DD query parameters limiting the lesson dates
+//
+// Returns:
+//   - 200 OK with the overall counts and one summary per subject
+//   - 400 Bad Request if a date is invalid
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetChildAttendance(c *gin.Context) {
+	period, err := parseAttendancePeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	student := h.guardianChild(c)
+	if student == nil {
+		return
+	}
+
+	summaries, err := h.Attendance.GetStudentAttendance(student.ID, period)
+	if err != nil {
+		log.Printf("Error summarizing attendance of student %d: %v", student.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve attendance"})
+		return
+	}
+
+	c.JSON(http.StatusOK, StudentAttendanceResponse{
+		StudentID:   student.ID,
+		StudentName: student.FirstName + " " + student.LastName,
+		Overall:     models.TotalAttendance(summaries),
+		Subjects:    summaries,
+	})
+}
+
+// HandleGetChildGrades retrieves the marks, current grade and predicted
+// grades of one of the caller's children in every enrolled subject
+//
+// Parameters:
+//   - c: Gin context with the student_id set by RequireGuardianOf
+//
+// Returns:
+//   - 200 OK with one gradebook per enrolled subject
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetChildGrades(c *gin.Context) {
+	student := h.guardianChild(c)
+	if student == nil {
+		return
+	}
+
+	enrollments, err := h.Enrollments.GetStudentEnrollments(student.ID)
+	if err != nil {
+		log.Printf("Error getting enrollments of student %d: %v", student.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve grades"})
+		return
+	}
+
+	subjects := []ChildSubjectGrades{}
+	for _, e := range enrollments {
+		book, err := h.Gradebook.GetStudentGradebook(e.SubjectID, student.ID)
+		if err != nil {
+			log.Printf("Error getting gradebook of student %d in subject %d: %v", student.ID, e.SubjectID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve grades"})
+			return
+		}
+		subjects = append(subjects, ChildSubjectGrades{
+			SubjectID:        e.SubjectID,
+			SubjectName:      e.SubjectName,
+			Level:            e.Level,
+			StudentGradebook: book,
+		})
+	}
+
+	c.JSON(http.StatusOK, ChildGradesResponse{
+		StudentID:   student.ID,
+		StudentName: student.FirstName + " " + student.LastName,
+		Subjects:    subjects,
+	})
+}
@@ -2,11 +2,91 @@
 package handlers
 
 import (
+	"sync"
+	"time"
+
+	"wg-edu-server/mailer"
 	"wg-edu-server/models"
+	"wg-edu-server/storage"
 )
 
-// Handler holds dependencies for the handlers
+// Handler holds dependencies for the handlers.
+// Stores are interfaces so that handlers can run against PostgreSQL
+// (*models.DB) in production and *models.MemoryStore in tests.
 type Handler struct {
-	DB        *models.DB
-	JWTSecret string
+	Users           models.UserStore
+	Tokens          models.TokenStore
+	LoginAttempts   models.LoginAttemptStore
+	Students        models.StudentStore
+	Subjects        models.SubjectStore
+	Teachers        models.TeacherStore
+	Enrollments     models.EnrollmentStore
+	Attendance      models.AttendanceStore
+	Gradebook       models.GradebookStore
+	Diploma         models.DiplomaStore
+	CAS             models.CASStore
+	Projects        models.ProjectStore
+	Timetable       models.TimetableStore
+	Homework        models.HomeworkStore
+	Guardians       models.GuardianStore
+	Roles           models.RoleStore
+	MFA             models.MFAStore
+	Files           storage.Storage // Content of uploaded homework files; must be set before serving
+	Mailer          mailer.Mailer   // Delivery of password reset links; must be set before serving
+	JWTSecret       string
+	AccessTokenTTL  time.Duration // Lifetime of issued access tokens
+	RefreshTokenTTL time.Duration // Lifetime of issued refresh tokens
+
+	AttendanceThreshold float64 // Attendance percentage below which students are reported
+
+	PublicURL string // Base URL clients reach the API at, used in links such as calendar feeds
+
+	PasswordResetURL string        // Page of the web app that takes the reset token as ?token=
+	PasswordResetTTL time.Duration // Lifetime of password reset tokens
+
+	PasswordResetPolicy models.LoginPolicy // Rate limits of reset requests; models.DefaultPasswordResetPolicy if zero
+
+	LoginPolicy models.LoginPolicy // Rate limits and lockout of failed logins; models.DefaultLoginPolicy if zero
+
+	MFAIssuer        string   // Service name shown by authenticator apps; DefaultMFAIssuer if empty
+	MFARequiredRoles []string // Roles that need a two-factor session for routes behind middleware.RequireMFA
+
+	background sync.WaitGroup // Work outliving its request, such as mailing reset links
+}
+
+// NewHandler creates a Handler backed by a single store for every dependency.
+//
+// Parameters:
+//   - store: Store implementation, e.g. *models.DB or *models.MemoryStore
+//   - jwtSecret: Secret key used to sign and validate JWTs
+//
+// Returns:
+//   - *Handler: Handler with default token lifetimes, login policy and attendance threshold
+func NewHandler(store models.Store, jwtSecret string) *Handler {
+	return &Handler{
+		Users:         store,
+		Tokens:        store,
+		LoginAttempts: store,
+		Students:      store,
+		Subjects:      store,
+		Teachers:      store,
+		Enrollments:   store,
+		Attendance:    store,
+		Gradebook:     store,
+		Diploma:       store,
+		CAS:           store,
+		Projects:      store,
+		Timetable:     store,
+		Homework:      store,
+		Guardians:     store,
+		Roles:         store,
+		MFA:           store,
+		JWTSecret:     jwtSecret,
+	}
+}
+
+// Wait blocks until the work handlers started in the background, such as
+// mailing password reset links, has finished
+func (h *Handler) Wait() {
+	h.background.Wait()
 }
@@ -0,0 +1,4140 @@
+package handlers_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"wg-edu-server/handlers"
+	"wg-edu-server/mailer"
+	"wg-edu-server/migrations"
+	"wg-edu-server/models"
+	"wg-edu-server/routes"
+	"wg-edu-server/storage"
+	"wg-edu-server/totp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	_ "github.com/lib/pq" // PostgreSQL driver
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testSecret = "test-secret"
+
+// exercised records every "METHOD /route/pattern" hit by any test so that
+// TestMain can fail the suite if a route in routes.SetupRoutes is untested.
+var (
+	exercisedMu sync.Mutex
+	exercised   = map[string]bool{}
+	allRoutes   = map[string]bool{}
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	code := m.Run()
+
+	// Only check coverage when the whole suite ran
+	if code == 0 && !isFiltered() {
+		var missing []string
+		for route := range allRoutes {
+			if !exercised[route] {
+				missing = append(missing, route)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			fmt.Println("routes not exercised by any test:")
+			for _, route := range missing {
+				fmt.Println("  " + route)
+			}
+			code = 1
+		}
+	}
+
+	os.Exit(code)
+}
+
+// isFiltered reports whether tests were selected with -run
+func isFiltered() bool {
+	run := flag.Lookup("test.run")
+	return run != nil && run.Value.String() != ""
+}
+
+// outbox is a mailer.Mailer keeping sent messages for inspection
+type outbox struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (o *outbox) Send(msg mailer.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sent = append(o.sent, msg)
+	return nil
+}
+
+// take returns and forgets the messages sent so far
+func (o *outbox) take() []mailer.Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	sent := o.sent
+	o.sent = nil
+	return sent
+}
+
+// testEnv is a router wired to a store with seeded users and subjects
+type testEnv struct {
+	router  *gin.Engine
+	store   models.Store
+	handler *handlers.Handler
+	outbox  *outbox
+
+	admin   *models.User
+	teacher *models.User
+	student *models.Student
+
+	ib1Physics *models.Subject
+	ib1Math    *models.Subject
+	pibMath    *models.Subject
+}
+
+// newTestEnv creates a test environment backed by an in-memory store
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	store := models.NewMemoryStore()
+	store.Hasher = models.BcryptHasher{Cost: bcrypt.MinCost}
+	return setupTestEnv(t, store)
+}
+
+// newPostgresEnv creates a test environment backed by the PostgreSQL database
+// at WG_TEST_DATABASE_URL, skipping the test when it is unset. The database is
+// wiped and every migration is applied, reverted and applied again, so it must
+// not be used for anything else.
+func newPostgresEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	dsn := os.Getenv("WG_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("WG_TEST_DATABASE_URL is not set")
+	}
+	// Sessions run in UTC, as models.NewDB sets them up
+	t.Setenv("PGTZ", "UTC")
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if _, err := conn.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public"); err != nil {
+		t.Fatalf("resetting database: %v", err)
+	}
+	migrator, err := migrations.New(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("migrating up: %v", err)
+	}
+	if _, err := migrator.Down(len(migrator.Migrations())); err != nil {
+		t.Fatalf("migrating down: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("migrating up after down: %v", err)
+	}
+
+	// Tests add the subjects they need, as they do with the memory store
+	if _, err := conn.Exec("DELETE FROM subjects"); err != nil {
+		t.Fatal(err)
+	}
+
+	db := &models.DB{DB: conn, Hasher: models.BcryptHasher{Cost: bcrypt.MinCost}, MFAKey: models.MFASecretKey(testSecret)}
+	env := setupTestEnv(t, db)
+	t.Cleanup(env.handler.Wait)
+	return env
+}
+
+// setupTestEnv seeds a store and wires a router to it
+func setupTestEnv(t *testing.T, store models.Store) *testEnv {
+	t.Helper()
+
+	env := &testEnv{store: store, outbox: &outbox{}}
+	env.handler = handlers.NewHandler(store, testSecret)
+	env.handler.Mailer = env.outbox
+	env.handler.PublicURL = "https://api.edu.example.com"
+	env.handler.PasswordResetURL = "https://edu.example.com/reset-password"
+
+	var err error
+	if env.handler.Files, err = storage.NewLocal(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if env.admin, err = store.CreateUser("admin", "admin_pw", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if env.teacher, err = store.CreateUser("teacher", "teacher_pw", "teacher"); err != nil {
+		t.Fatal(err)
+	}
+	env.student, err = store.CreateStudent(&models.StudentRequest{
+		FirstName: "Ada",
+		LastName:  "Lovelace",
+		Email:     "ada@example.com",
+		Grade:     "IB1",
+		Username:  "student",
+		Password:  "student_pw",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.ib1Physics = env.addSubject(t, "IB1", "Physics", 4)
+	env.ib1Math = env.addSubject(t, "IB1", "Math AA", 5)
+	env.pibMath = env.addSubject(t, "PIB", "Mathematics", 0)
+
+	env.router = gin.New()
+	env.router.Use(func(c *gin.Context) {
+		c.Next()
+		if path := c.FullPath(); path != "" {
+			exercisedMu.Lock()
+			exercised[c.Request.Method+" "+path] = true
+			exercisedMu.Unlock()
+		}
+	})
+	routes.SetupRoutes(env.router, env.handler, []string{"*"})
+
+	exercisedMu.Lock()
+	for _, route := range env.router.Routes() {
+		allRoutes[route.Method+" "+route.Path] = true
+	}
+	exercisedMu.Unlock()
+
+	return env
+}
+
+// addSubject adds a subject to the catalogue. IB subjects are offered at HL and SL.
+func (e *testEnv) addSubject(t *testing.T, grade, name string, group int) *models.Subject {
+	t.Helper()
+
+	req := &models.SubjectRequest{Grade: grade, Name: name, Description: grade + " " + name, Group: group}
+	if models.IsDiplomaGrade(grade) {
+		req.Levels = []string{models.LevelHL, models.LevelSL}
+	}
+	subject, err := e.store.CreateSubject(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return subject
+}
+
+// do sends a request with an optional bearer token and JSON body
+func (e *testEnv) do(t *testing.T, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(payload)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	e.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// upload posts a multipart form with a file and returns the response
+func (e *testEnv) upload(t *testing.T, path, token, filename string, content []byte, fields map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, path, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rec := httptest.NewRecorder()
+	e.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// login logs in and returns the response, failing the test on error
+func (e *testEnv) login(t *testing.T, username, password string) handlers.LoginResponse {
+	t.Helper()
+
+	rec := e.do(t, http.MethodPost, "/api/login", "", handlers.LoginRequest{Username: username, Password: password})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login as %s: status %d, body %s", username, rec.Code, rec.Body.String())
+	}
+
+	var resp handlers.LoginResponse
+	decode(t, rec, &resp)
+	return resp
+}
+
+func (e *testEnv) token(t *testing.T, username string) string {
+	t.Helper()
+	return e.login(t, username, username+"_pw").Token
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d, body %s", rec.Code, want, rec.Body.String())
+	}
+}
+
+func TestHealth(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.do(t, http.MethodGet, "/api/health", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var resp handlers.HealthResponse
+	decode(t, rec, &resp)
+	if resp.Status != "OK" {
+		t.Errorf("status = %q, want OK", resp.Status)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	env := newTestEnv(t)
+
+	resp := env.login(t, "admin", "admin_pw")
+	if resp.Token == "" || resp.RefreshToken == "" {
+		t.Fatal("expected access and refresh tokens")
+	}
+	if resp.User.Role != "admin" {
+		t.Errorf("role = %q, want admin", resp.User.Role)
+	}
+
+	tests := []struct {
+		name string
+		body interface{}
+		want int
+	}{
+		{"wrong password", handlers.LoginRequest{Username: "admin", Password: "nope"}, http.StatusUnauthorized},
+		{"unknown user", handlers.LoginRequest{Username: "ghost", Password: "admin_pw"}, http.StatusUnauthorized},
+		{"missing fields", map[string]string{"username": "admin"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, env.do(t, http.MethodPost, "/api/login", "", tt.body), tt.want)
+		})
+	}
+}
+
+func TestLoginUpgradesLegacyPassword(t *testing.T) {
+	env := newTestEnv(t)
+
+	legacy, err := env.store.(*models.MemoryStore).CreateUserWithStoredPassword("legacy", "plain_pw", "teacher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.login(t, "legacy", "plain_pw")
+
+	upgraded, err := env.store.GetUserByID(legacy.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !models.IsPasswordHash(upgraded.Password) {
+		t.Fatalf("password still stored as plaintext: %q", upgraded.Password)
+	}
+
+	// The upgraded hash must still accept the same password
+	env.login(t, "legacy", "plain_pw")
+}
+
+func TestLoginRejectsInvalidArgon2idParameters(t *testing.T) {
+	env := newTestEnv(t)
+
+	hasher := models.Argon2idHasher{Time: 1, Memory: 64, Threads: 1, KeyLen: 32, SaltLen: 16}
+	valid, err := hasher.Hash("argon_pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := env.store.(*models.MemoryStore)
+	if _, err := store.CreateUserWithStoredPassword("argon", valid, "teacher"); err != nil {
+		t.Fatal(err)
+	}
+	env.login(t, "argon", "argon_pw")
+
+	// Hashes whose parameters would panic or exhaust memory never verify
+	params := []string{"m=64,t=0,p=1", "m=64,t=1,p=0", "m=0,t=1,p=1", "m=4,t=1,p=1", "m=4194304,t=1,p=1", "m=64,t=1000,p=1", "m=64,t=1,p=256"}
+	for i, param := range params {
+		stored := strings.Replace(valid, "m=64,t=1,p=1", param, 1)
+		username := fmt.Sprintf("argon%d", i)
+		if _, err := store.CreateUserWithStoredPassword(username, stored, "teacher"); err != nil {
+			t.Fatal(err)
+		}
+		rec := env.do(t, http.MethodPost, "/api/login", "", handlers.LoginRequest{Username: username, Password: "argon_pw"})
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("login with %s: status = %d, want %d", param, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	env := newTestEnv(t)
+	first := env.login(t, "teacher", "teacher_pw")
+
+	rec := env.do(t, http.MethodPost, "/api/token/refresh", "", handlers.RefreshRequest{RefreshToken: first.RefreshToken})
+	expectStatus(t, rec, http.StatusOK)
+
+	var rotated handlers.TokenResponse
+	decode(t, rec, &rotated)
+	if rotated.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/protected", rotated.Token, nil), http.StatusOK)
+
+	// Reusing the rotated token is treated as theft and kills every session
+	rec = env.do(t, http.MethodPost, "/api/token/refresh", "", handlers.RefreshRequest{RefreshToken: first.RefreshToken})
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = env.do(t, http.MethodPost, "/api/token/refresh", "", handlers.RefreshRequest{RefreshToken: rotated.RefreshToken})
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	expectStatus(t, env.do(t, http.MethodPost, "/api/token/refresh", "", handlers.RefreshRequest{}), http.StatusBadRequest)
+}
+
+func TestLogout(t *testing.T) {
+	env := newTestEnv(t)
+	session := env.login(t, "student", "student_pw")
+
+	rec := env.do(t, http.MethodPost, "/api/logout", session.Token, handlers.RefreshRequest{RefreshToken: session.RefreshToken})
+	expectStatus(t, rec, http.StatusOK)
+
+	expectStatus(t, env.do(t, http.MethodGet, "/api/protected", session.Token, nil), http.StatusUnauthorized)
+
+	rec = env.do(t, http.MethodPost, "/api/token/refresh", "", handlers.RefreshRequest{RefreshToken: session.RefreshToken})
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
+
+func TestProtected(t *testing.T) {
+	env := newTestEnv(t)
+
+	expectStatus(t, env.do(t, http.MethodGet, "/api/protected", "", nil), http.StatusUnauthorized)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/protected", "not-a-jwt", nil), http.StatusUnauthorized)
+
+	rec := env.do(t, http.MethodGet, "/api/protected", env.token(t, "student"), nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var resp map[string]interface{}
+	decode(t, rec, &resp)
+	if resp["role"] != "student" {
+		t.Errorf("role = %v, want student", resp["role"])
+	}
+}
+
+func TestSubjects(t *testing.T) {
+	env := newTestEnv(t)
+	token := env.token(t, "student")
+
+	rec := env.do(t, http.MethodGet, "/api/subjects", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var all models.ListResult[models.Subject]
+	decode(t, rec, &all)
+	if len(all.Data) != 3 || all.Total != 3 {
+		t.Errorf("got %d of %d subjects, want 3", len(all.Data), all.Total)
+	}
+
+	rec = env.do(t, http.MethodGet, "/api/subjects/grouped", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var grouped map[string][]models.Subject
+	decode(t, rec, &grouped)
+	if len(grouped["IB1"]) != 2 || len(grouped["PIB"]) != 1 {
+		t.Errorf("unexpected grouping: %v", grouped)
+	}
+
+	rec = env.do(t, http.MethodGet, "/api/subjects/IB1", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var ib1 models.ListResult[models.Subject]
+	decode(t, rec, &ib1)
+	if len(ib1.Data) != 2 || ib1.Data[0].Name != "Math AA" {
+		t.Errorf("unexpected IB1 subjects: %v", ib1.Data)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/subjects/IB3", token, nil), http.StatusBadRequest)
+
+	rec = env.do(t, http.MethodGet, fmt.Sprintf("/api/subjects/id/%d", env.pibMath.ID), token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/subjects/id/9999", token, nil), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/subjects/id/abc", token, nil), http.StatusBadRequest)
+
+	expectStatus(t, env.do(t, http.MethodGet, "/api/subjects", "", nil), http.StatusUnauthorized)
+}
+
+func TestTeachers(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+	teacherToken := env.token(t, "teacher")
+	studentToken := env.token(t, "student")
+
+	assignPath := fmt.Sprintf("/api/teachers/%d/subjects", env.teacher.ID)
+	rec := env.do(t, http.MethodPost, assignPath, adminToken, handlers.AssignSubjectRequest{SubjectID: env.ib1Physics.ID})
+	expectStatus(t, rec, http.StatusOK)
+
+	// Teachers may not assign subjects, students may not see teachers at all
+	expectStatus(t, env.do(t, http.MethodPost, assignPath, teacherToken, handlers.AssignSubjectRequest{SubjectID: env.ib1Math.ID}), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/teachers", studentToken, nil), http.StatusForbidden)
+
+	rec = env.do(t, http.MethodGet, "/api/teachers", teacherToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var teachers models.ListResult[models.Teacher]
+	decode(t, rec, &teachers)
+	if len(teachers.Data) != 1 || len(teachers.Data[0].Subjects) != 1 || teachers.Data[0].Subjects[0].ID != env.ib1Physics.ID {
+		t.Fatalf("unexpected teachers: %+v", teachers.Data)
+	}
+
+	rec = env.do(t, http.MethodGet, fmt.Sprintf("/api/teachers/%d", env.teacher.ID), adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, fmt.Sprintf("/api/teachers/%d", env.admin.ID), adminToken, nil), http.StatusNotFound)
+
+	removePath := fmt.Sprintf("/api/teachers/%d/subjects/%d", env.teacher.ID, env.ib1Physics.ID)
+	expectStatus(t, env.do(t, http.MethodDelete, removePath, adminToken, nil), http.StatusOK)
+
+	subjects, err := env.store.GetTeacherSubjects(env.teacher.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subjects) != 0 {
+		t.Errorf("subject was not removed: %+v", subjects)
+	}
+}
+
+func TestAdminStudents(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/students", env.token(t, "teacher"), nil), http.StatusForbidden)
+
+	create := models.StudentRequest{
+		FirstName: "Alan",
+		LastName:  "Turing",
+		Email:     "alan@example.com",
+		Grade:     "IB2",
+		Username:  "alan",
+		Password:  "alan_password",
+	}
+	for _, password := range []string{"short", strings.Repeat("x", models.MaxPasswordLength+1)} {
+		weak := create
+		weak.Password = password
+		expectStatus(t, env.do(t, http.MethodPost, "/api/admin/students", adminToken, weak), http.StatusBadRequest)
+	}
+	rec := env.do(t, http.MethodPost, "/api/admin/students", adminToken, create)
+	expectStatus(t, rec, http.StatusCreated)
+	var created models.Student
+	decode(t, rec, &created)
+
+	expectStatus(t, env.do(t, http.MethodPost, "/api/admin/students", adminToken, models.StudentRequest{FirstName: "x"}), http.StatusBadRequest)
+
+	// The new student can log in with the password set by the admin
+	env.login(t, "alan", "alan_password")
+
+	rec = env.do(t, http.MethodGet, "/api/admin/students", adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var list models.ListResult[models.Student]
+	decode(t, rec, &list)
+	if len(list.Data) != 2 || list.Data[0].LastName != "Lovelace" {
+		t.Fatalf("unexpected students: %+v", list.Data)
+	}
+
+	studentPath := fmt.Sprintf("/api/admin/students/%d", created.ID)
+	expectStatus(t, env.do(t, http.MethodGet, studentPath, adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/students/9999", adminToken, nil), http.StatusNotFound)
+
+	update := create
+	update.Grade = "IB1"
+	update.Password = "short"
+	expectStatus(t, env.do(t, http.MethodPut, studentPath, adminToken, update), http.StatusBadRequest)
+	update.Password = "new_password"
+	rec = env.do(t, http.MethodPut, studentPath, adminToken, update)
+	expectStatus(t, rec, http.StatusOK)
+	var updated models.Student
+	decode(t, rec, &updated)
+	if updated.Grade != "IB1" {
+		t.Errorf("grade = %q, want IB1", updated.Grade)
+	}
+	env.login(t, "alan", "new_password")
+
+	expectStatus(t, env.do(t, http.MethodDelete, studentPath, adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, studentPath, adminToken, nil), http.StatusNotFound)
+}
+
+func TestListStudents(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+
+	for i, name := range []string{"Babbage", "Hopper", "Turing", "Liskov", "Knuth"} {
+		grade := "IB2"
+		if i%2 == 0 {
+			grade = "PIB"
+		}
+		_, err := env.store.CreateStudent(&models.StudentRequest{
+			FirstName: "Test",
+			LastName:  name,
+			Email:     strings.ToLower(name) + "@example.com",
+			Grade:     grade,
+			Username:  strings.ToLower(name),
+			Password:  "pw",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(query string) models.ListResult[models.Student] {
+		t.Helper()
+		rec := env.do(t, http.MethodGet, "/api/admin/students"+query, adminToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var result models.ListResult[models.Student]
+		decode(t, rec, &result)
+		return result
+	}
+	names := func(students []models.Student) string {
+		var out []string
+		for _, s := range students {
+			out = append(out, s.LastName)
+		}
+		return strings.Join(out, ",")
+	}
+
+	// Walk all pages by cursor in the default order
+	var walked []models.Student
+	page := list("?limit=2")
+	for pages := 1; ; pages++ {
+		if page.Total != 6 || page.Limit != 2 {
+			t.Fatalf("unexpected envelope: %+v", page)
+		}
+		walked = append(walked, page.Data...)
+		if page.NextCursor == "" {
+			if pages != 3 {
+				t.Errorf("walked %d pages, want 3", pages)
+			}
+			break
+		}
+		page = list("?limit=2&cursor=" + url.QueryEscape(page.NextCursor))
+	}
+	if got := names(walked); got != "Babbage,Hopper,Knuth,Liskov,Lovelace,Turing" {
+		t.Errorf("cursor walk returned %s", got)
+	}
+
+	if got := names(list("?limit=2&page=2").Data); got != "Knuth,Liskov" {
+		t.Errorf("page 2 returned %s", got)
+	}
+	if got := names(list("?sort=-last_name&limit=2").Data); got != "Turing,Lovelace" {
+		t.Errorf("descending sort returned %s", got)
+	}
+
+	filtered := list("?filter[grade]=PIB&sort=last_name")
+	if got := names(filtered.Data); got != "Babbage,Knuth,Turing" || filtered.Total != 3 {
+		t.Errorf("grade filter returned %s of %d", got, filtered.Total)
+	}
+	if got := names(list("?q=LOVE").Data); got != "Lovelace" {
+		t.Errorf("search returned %s", got)
+	}
+
+	// A cursor only continues the sort order it was issued for
+	cursor := list("?limit=1").NextCursor
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/students?sort=email&cursor="+url.QueryEscape(cursor), adminToken, nil), http.StatusBadRequest)
+
+	for _, query := range []string{
+		"?sort=password",
+		"?filter[first_name]=Ada",
+		"?limit=0",
+		"?limit=1000",
+		"?page=2&cursor=" + url.QueryEscape(cursor),
+		"?cursor=garbage",
+	} {
+		expectStatus(t, env.do(t, http.MethodGet, "/api/admin/students"+query, adminToken, nil), http.StatusBadRequest)
+	}
+
+	// The same parameters apply to subjects and teachers
+	subjects := env.do(t, http.MethodGet, "/api/subjects/IB1?sort=-group&limit=1", adminToken, nil)
+	expectStatus(t, subjects, http.StatusOK)
+	var subjectPage models.ListResult[models.Subject]
+	decode(t, subjects, &subjectPage)
+	if len(subjectPage.Data) != 1 || subjectPage.Data[0].ID != env.ib1Math.ID || subjectPage.Total != 2 || subjectPage.NextCursor == "" {
+		t.Errorf("unexpected subject page: %+v", subjectPage)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/teachers?filter[active]=maybe", adminToken, nil), http.StatusBadRequest)
+}
+
+// buildXLSX builds a minimal XLSX workbook whose first sheet holds rows,
+// storing the first row as shared strings and the rest as inline strings.
+// Empty cells are left out.
+func buildXLSX(t *testing.T, rows [][]string) []byte {
+	t.Helper()
+
+	var shared, sheet strings.Builder
+	for r, row := range rows {
+		fmt.Fprintf(&sheet, `<row r="%d">`, r+1)
+		for c, value := range row {
+			if value == "" {
+				continue
+			}
+			column := ""
+			for n := c + 1; n > 0; n = (n - 1) / 26 {
+				column = string(rune('A'+(n-1)%26)) + column
+			}
+			ref := fmt.Sprintf("%s%d", column, r+1)
+			if r == 0 {
+				fmt.Fprintf(&sheet, `<c r="%s" t="s"><v>%d</v></c>`, ref, c)
+				fmt.Fprintf(&shared, `<si><t>%s</t></si>`, value)
+			} else {
+				fmt.Fprintf(&sheet, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, value)
+			}
+		}
+		sheet.WriteString(`</row>`)
+	}
+
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Students" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/sharedStrings.xml":     `<sst>` + shared.String() + `</sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>` + sheet.String() + `</sheetData></worksheet>`,
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImportStudents(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+	importPath := "/api/admin/students/import"
+
+	countStudents := func() int {
+		t.Helper()
+		list, err := env.store.ListStudents(models.ListParams{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return list.Total
+	}
+
+	invalid := []byte("First Name,Last Name,Email,Grade,Username,Password\n" +
+		"Grace,Hopper,grace@example.com,IB1,grace,grace_pw\n" +
+		"Taken,User,taken@example.com,IB1,student,taken_pw\n" +
+		"\n" +
+		"Repeat,Email,grace@example.com,IB3,repeat,pw\n" +
+		"No,Password,nopw@example.com,PIB,nopw,\n")
+
+	expectStatus(t, env.upload(t, importPath, env.token(t, "teacher"), "students.csv", invalid, nil), http.StatusForbidden)
+
+	// A dry run reports every problem by row without writing anything
+	rec := env.upload(t, importPath+"?dry_run=true", adminToken, "students.csv", invalid, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var result models.StudentImportResult
+	decode(t, rec, &result)
+	var problems []string
+	for _, e := range result.Errors {
+		problems = append(problems, fmt.Sprintf("%d:%s", e.Row, e.Field))
+	}
+	if got := strings.Join(problems, ","); !result.DryRun || result.Valid || result.Rows != 4 || got != "3:username,5:password,5:grade,5:email,6:password" {
+		t.Errorf("unexpected dry run result %+v, errors %s", result, got)
+	}
+	if n := countStudents(); n != 1 {
+		t.Fatalf("dry run wrote students: %d", n)
+	}
+
+	// Committing an invalid file writes nothing; the report can be downloaded as CSV
+	rec = env.upload(t, importPath+"?report=csv", adminToken, "students.csv", invalid, nil)
+	expectStatus(t, rec, http.StatusUnprocessableEntity)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("report content type = %q", ct)
+	}
+	if !strings.Contains(rec.Header().Get("Content-Disposition"), "attachment") {
+		t.Errorf("report is not a download: %q", rec.Header().Get("Content-Disposition"))
+	}
+	if !strings.HasPrefix(rec.Body.String(), "row,field,value,error\n3,username,student,") {
+		t.Errorf("unexpected report:\n%s", rec.Body.String())
+	}
+	if n := countStudents(); n != 1 {
+		t.Fatalf("invalid import wrote students: %d", n)
+	}
+
+	// Columns can be mapped from other headers
+	mapped := []byte("Given,Family,Mail,Class,Login,Secret\n" +
+		"Grace,Hopper,grace@example.com,IB1,grace,grace_pw\n" +
+		"Edsger,Dijkstra,edsger@example.com,PIB,edsger,edsger_pw\n")
+	mapping := `{"first_name":"Given","last_name":"Family","email":"Mail","grade":"Class","username":"Login","password":"Secret"}`
+	expectStatus(t, env.upload(t, importPath, adminToken, "students.csv", mapped, nil), http.StatusBadRequest)
+	expectStatus(t, env.upload(t, importPath, adminToken, "students.csv", mapped, map[string]string{"mapping": `{"nickname":"Given"}`}), http.StatusBadRequest)
+
+	rec = env.upload(t, importPath+"?dry_run=1", adminToken, "students.csv", mapped, map[string]string{"mapping": mapping})
+	expectStatus(t, rec, http.StatusOK)
+	if n := countStudents(); n != 1 {
+		t.Fatalf("valid dry run wrote students: %d", n)
+	}
+
+	rec = env.upload(t, importPath, adminToken, "students.csv", mapped, map[string]string{"mapping": mapping})
+	expectStatus(t, rec, http.StatusCreated)
+	decode(t, rec, &result)
+	if len(result.Created) != 2 || result.Created[1].Username != "edsger" || result.Created[1].Grade != "PIB" {
+		t.Errorf("unexpected created students: %+v", result.Created)
+	}
+	env.login(t, "grace", "grace_pw")
+
+	// XLSX files are read from their first sheet
+	xlsx := buildXLSX(t, [][]string{
+		{"first_name", "last_name", "email", "grade", "username", "password"},
+		{"Barbara", "Liskov", "barbara@example.com", "IB2", "barbara", "barbara_pw"},
+	})
+	rec = env.upload(t, importPath, adminToken, "cohort.xlsx", xlsx, nil)
+	expectStatus(t, rec, http.StatusCreated)
+	if n := countStudents(); n != 4 {
+		t.Errorf("students after imports = %d, want 4", n)
+	}
+	env.login(t, "barbara", "barbara_pw")
+
+	// Re-importing the same file conflicts with the students it created
+	expectStatus(t, env.upload(t, importPath, adminToken, "cohort.xlsx", xlsx, nil), http.StatusUnprocessableEntity)
+
+	// Cells right of the header are dropped, even in the last column of a sheet
+	wide := []string{"Donald", "Knuth", "donald@example.com", "IB1", "donald", "donald_pw"}
+	wide = append(wide, make([]string, 16384-len(wide))...)
+	wide[16383] = "ignored"
+	xlsx = buildXLSX(t, [][]string{
+		{"first_name", "last_name", "email", "grade", "username", "password"},
+		wide,
+	})
+	expectStatus(t, env.upload(t, importPath, adminToken, "wide.xlsx", xlsx, nil), http.StatusCreated)
+	env.login(t, "donald", "donald_pw")
+
+	// Files longer than the limit are refused while they are read
+	var long strings.Builder
+	long.WriteString("first_name,last_name,email,grade,username,password\n")
+	for i := 0; i <= 2000; i++ {
+		fmt.Fprintf(&long, "Student,%d,s%d@example.com,IB1,s%d,pw\n", i, i, i)
+	}
+	rec = env.upload(t, importPath, adminToken, "long.csv", []byte(long.String()), nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+	if !strings.Contains(rec.Body.String(), "more than 2000 students") {
+		t.Errorf("unexpected long file response: %s", rec.Body.String())
+	}
+	if n := countStudents(); n != 5 {
+		t.Errorf("students after long file = %d, want 5", n)
+	}
+
+	expectStatus(t, env.upload(t, importPath, adminToken, "students.txt", mapped, nil), http.StatusBadRequest)
+	expectStatus(t, env.upload(t, importPath, adminToken, "broken.xlsx", []byte("not a zip"), nil), http.StatusBadRequest)
+	expectStatus(t, env.upload(t, importPath, adminToken, "empty.csv", []byte("first_name,last_name\n"), nil), http.StatusBadRequest)
+}
+
+func TestExports(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+
+	if err := env.store.AssignSubjectToTeacher(env.teacher.ID, env.ib1Physics.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.store.AssignSubjectToTeacher(env.teacher.ID, env.ib1Math.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.store.CreateStudent(&models.StudentRequest{
+		FirstName: "Alan", LastName: "Turing", Email: "alan@example.com", Grade: "PIB", Username: "alan", Password: "pw",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	export := func(path, accept string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		env.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// CSV keeps the list sort and filters but not paging
+	rec := export("/api/admin/students/export?format=csv&sort=-last_name&limit=1", "")
+	expectStatus(t, rec, http.StatusOK)
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="students.csv"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 3 || lines[0] != "id,username,first_name,last_name,email,grade,created_at,updated_at" ||
+		!strings.Contains(lines[1], "Turing") || !strings.Contains(lines[2], "Lovelace") {
+		t.Errorf("unexpected students CSV:\n%s", rec.Body.String())
+	}
+
+	rec = export("/api/admin/students/export?filter[grade]=PIB", "application/json")
+	expectStatus(t, rec, http.StatusOK)
+	var students []models.Student
+	decode(t, rec, &students)
+	if len(students) != 1 || students[0].Username != "alan" {
+		t.Errorf("unexpected students JSON: %+v", students)
+	}
+
+	// XLSX is chosen through the Accept header
+	rec = export("/api/teachers/export", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	expectStatus(t, rec, http.StatusOK)
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sheet string
+	for _, f := range archive.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			buf.ReadFrom(r)
+			r.Close()
+			sheet = buf.String()
+		}
+	}
+	if !strings.Contains(sheet, ">subjects<") || !strings.Contains(sheet, ">IB1 Math AA; IB1 Physics<") {
+		t.Errorf("unexpected teachers worksheet: %s", sheet)
+	}
+
+	rec = export("/api/teachers/export?format=json", "")
+	expectStatus(t, rec, http.StatusOK)
+	var teachers []models.Teacher
+	decode(t, rec, &teachers)
+	if len(teachers) != 1 || len(teachers[0].Subjects) != 2 {
+		t.Errorf("unexpected teachers JSON: %+v", teachers)
+	}
+
+	rec = export("/api/subjects/export?format=csv", "")
+	expectStatus(t, rec, http.StatusOK)
+	if lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n"); len(lines) != 4 || !strings.Contains(lines[1], "IB1,Math AA") {
+		t.Errorf("unexpected subjects CSV:\n%s", rec.Body.String())
+	}
+
+	// An empty export is still a valid file
+	rec = export("/api/admin/students/export?format=json&filter[grade]=IB2", "")
+	expectStatus(t, rec, http.StatusOK)
+	if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+		t.Errorf("empty export = %q", body)
+	}
+
+	expectStatus(t, export("/api/admin/students/export?format=pdf", ""), http.StatusBadRequest)
+	expectStatus(t, export("/api/admin/students/export", "text/html"), http.StatusNotAcceptable)
+	expectStatus(t, export("/api/admin/students/export?sort=password", ""), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/students/export", env.token(t, "teacher"), nil), http.StatusForbidden)
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+	session := env.login(t, "teacher", "teacher_pw")
+
+	path := fmt.Sprintf("/api/admin/users/%d/revoke-sessions", env.teacher.ID)
+	expectStatus(t, env.do(t, http.MethodPost, path, session.Token, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPost, path, adminToken, nil), http.StatusOK)
+
+	expectStatus(t, env.do(t, http.MethodGet, "/api/protected", session.Token, nil), http.StatusUnauthorized)
+	rec := env.do(t, http.MethodPost, "/api/token/refresh", "", handlers.RefreshRequest{RefreshToken: session.RefreshToken})
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	expectStatus(t, env.do(t, http.MethodPost, "/api/admin/users/9999/revoke-sessions", adminToken, nil), http.StatusNotFound)
+}
+
+func TestRoles(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+	teacherToken := env.token(t, "teacher")
+
+	rec := env.do(t, http.MethodGet, "/api/admin/permissions", adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var permissions []string
+	decode(t, rec, &permissions)
+	if len(permissions) != len(models.AllPermissions) {
+		t.Fatalf("permissions = %v, want %v", permissions, models.AllPermissions)
+	}
+
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/roles", teacherToken, nil), http.StatusForbidden)
+
+	registrar := models.RoleRequest{
+		Name:        "registrar",
+		Description: "Manages student records",
+		Permissions: []string{models.PermStudentsWrite, models.PermStudentsRead, models.PermStudentsRead},
+	}
+	rec = env.do(t, http.MethodPost, "/api/admin/roles", adminToken, registrar)
+	expectStatus(t, rec, http.StatusCreated)
+	var created models.Role
+	decode(t, rec, &created)
+	if len(created.Permissions) != 2 || created.Permissions[0] != models.PermStudentsRead {
+		t.Fatalf("permissions not sorted and deduplicated: %v", created.Permissions)
+	}
+
+	tests := []struct {
+		name string
+		body models.RoleRequest
+		want int
+	}{
+		{"duplicate", registrar, http.StatusConflict},
+		{"invalid name", models.RoleRequest{Name: "Bad Name"}, http.StatusBadRequest},
+		{"unknown permission", models.RoleRequest{Name: "auditor", Permissions: []string{"grades:write"}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, env.do(t, http.MethodPost, "/api/admin/roles", adminToken, tt.body), tt.want)
+		})
+	}
+
+	rec = env.do(t, http.MethodGet, "/api/admin/roles", adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var roles []models.Role
+	decode(t, rec, &roles)
+	if len(roles) != 5 {
+		t.Fatalf("roles = %+v, want 4 built-in plus registrar", roles)
+	}
+
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/roles/registrar", adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/roles/ghost", adminToken, nil), http.StatusNotFound)
+
+	// Role changes apply to existing tokens on their next request
+	rolePath := fmt.Sprintf("/api/admin/users/%d/role", env.teacher.ID)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/students", teacherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPut, rolePath, adminToken, handlers.SetUserRoleRequest{Role: "registrar"}), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/students", teacherToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/roles", teacherToken, nil), http.StatusForbidden)
+
+	expectStatus(t, env.do(t, http.MethodPut, rolePath, adminToken, handlers.SetUserRoleRequest{Role: "ghost"}), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodPut, "/api/admin/users/9999/role", adminToken, handlers.SetUserRoleRequest{Role: "teacher"}), http.StatusNotFound)
+
+	// Narrowing the role takes effect immediately as well
+	readOnly := models.RoleRequest{Description: "Views student records", Permissions: []string{models.PermStudentsRead}}
+	expectStatus(t, env.do(t, http.MethodPut, "/api/admin/roles/registrar", adminToken, readOnly), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodDelete, fmt.Sprintf("/api/admin/students/%d", env.student.ID), teacherToken, nil), http.StatusForbidden)
+
+	lockout := models.RoleRequest{Permissions: []string{models.PermStudentsRead}}
+	expectStatus(t, env.do(t, http.MethodPut, "/api/admin/roles/admin", adminToken, lockout), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPut, "/api/admin/roles/ghost", adminToken, readOnly), http.StatusNotFound)
+
+	expectStatus(t, env.do(t, http.MethodDelete, "/api/admin/roles/registrar", adminToken, nil), http.StatusConflict)
+	expectStatus(t, env.do(t, http.MethodDelete, "/api/admin/roles/teacher", adminToken, nil), http.StatusConflict)
+	expectStatus(t, env.do(t, http.MethodPut, rolePath, adminToken, handlers.SetUserRoleRequest{Role: "teacher"}), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodDelete, "/api/admin/roles/registrar", adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodDelete, "/api/admin/roles/registrar", adminToken, nil), http.StatusNotFound)
+}
+
+func TestEnrollments(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+	teacherToken := env.token(t, "teacher")
+
+	englishA := env.addSubject(t, "IB1", "English A Literature", 1)
+	spanishB := env.addSubject(t, "IB1", "Spanish B", 2)
+	economics := env.addSubject(t, "IB1", "Economics", 3)
+	chemistry := env.addSubject(t, "IB1", "Chemistry", 4)
+	mathAI := env.addSubject(t, "IB1", "Math AI", 5)
+	visualArts := env.addSubject(t, "IB1", "Visual Arts", 6)
+
+	path := fmt.Sprintf("/api/admin/students/%d/enrollments", env.student.ID)
+	enroll := func(subject *models.Subject, level string) *httptest.ResponseRecorder {
+		return env.do(t, http.MethodPost, path, adminToken, models.EnrollmentRequest{SubjectID: subject.ID, Level: level})
+	}
+	check := func() handlers.EnrollmentsResponse {
+		t.Helper()
+		rec := env.do(t, http.MethodGet, path, teacherToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var resp handlers.EnrollmentsResponse
+		decode(t, rec, &resp)
+		return resp
+	}
+
+	expectStatus(t, env.do(t, http.MethodPost, path, teacherToken, models.EnrollmentRequest{SubjectID: env.ib1Physics.ID, Level: "HL"}), http.StatusForbidden)
+
+	expectStatus(t, enroll(env.ib1Physics, models.LevelHL), http.StatusCreated)
+	expectStatus(t, enroll(env.ib1Physics, models.LevelHL), http.StatusConflict)
+	expectStatus(t, enroll(env.ib1Math, models.LevelHL), http.StatusCreated)
+
+	tests := []struct {
+		name    string
+		subject *models.Subject
+		level   string
+	}{
+		{"other grade", env.pibMath, ""},
+		{"missing level", englishA, ""},
+		{"second math", mathAI, models.LevelSL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, enroll(tt.subject, tt.level), http.StatusBadRequest)
+		})
+	}
+	expectStatus(t, env.do(t, http.MethodPost, path, adminToken, models.EnrollmentRequest{SubjectID: 9999, Level: "SL"}), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/admin/students/9999/enrollments", adminToken, models.EnrollmentRequest{SubjectID: englishA.ID, Level: "SL"}), http.StatusNotFound)
+
+	expectStatus(t, enroll(englishA, models.LevelHL), http.StatusCreated)
+	expectStatus(t, enroll(spanishB, models.LevelHL), http.StatusCreated)
+	expectStatus(t, enroll(economics, models.LevelHL), http.StatusBadRequest) // fifth HL
+	expectStatus(t, enroll(chemistry, models.LevelSL), http.StatusCreated)
+
+	resp := check()
+	if resp.Diploma == nil || resp.Diploma.Complete || len(resp.Enrollments) != 5 {
+		t.Fatalf("expected an incomplete diploma with 5 subjects, got %+v", resp)
+	}
+
+	// The last slot must go to the missing group 3
+	expectStatus(t, enroll(visualArts, models.LevelSL), http.StatusBadRequest)
+	expectStatus(t, enroll(economics, models.LevelSL), http.StatusCreated)
+
+	resp = check()
+	if !resp.Diploma.Complete || len(resp.Diploma.Problems) != 0 {
+		t.Fatalf("expected a complete diploma, got %+v", resp.Diploma)
+	}
+
+	expectStatus(t, enroll(visualArts, models.LevelSL), http.StatusBadRequest) // seventh subject
+
+	unenroll := fmt.Sprintf("%s/%d", path, chemistry.ID)
+	expectStatus(t, env.do(t, http.MethodDelete, unenroll, adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodDelete, unenroll, adminToken, nil), http.StatusNotFound)
+	if check().Diploma.Complete {
+		t.Fatal("diploma still complete after unenrolling")
+	}
+
+	// Pre-IB students take subjects without levels and have no diploma check
+	pib, err := env.store.CreateStudent(&models.StudentRequest{
+		FirstName: "Grace",
+		LastName:  "Hopper",
+		Email:     "grace@example.com",
+		Grade:     "PIB",
+		Username:  "grace",
+		Password:  "grace_pw",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pibPath := fmt.Sprintf("/api/admin/students/%d/enrollments", pib.ID)
+	expectStatus(t, env.do(t, http.MethodPost, pibPath, adminToken, models.EnrollmentRequest{SubjectID: env.pibMath.ID, Level: "HL"}), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPost, pibPath, adminToken, models.EnrollmentRequest{SubjectID: env.pibMath.ID}), http.StatusCreated)
+
+	rec := env.do(t, http.MethodGet, pibPath, adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var pibResp handlers.EnrollmentsResponse
+	decode(t, rec, &pibResp)
+	if pibResp.Diploma != nil || len(pibResp.Enrollments) != 1 {
+		t.Fatalf("unexpected Pre-IB enrollments: %+v", pibResp)
+	}
+
+	// Deleting the student removes their enrollments
+	expectStatus(t, env.do(t, http.MethodDelete, fmt.Sprintf("/api/admin/students/%d", pib.ID), adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, pibPath, adminToken, nil), http.StatusNotFound)
+}
+
+func TestTeacherAdmin(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+
+	create := models.TeacherRequest{
+		FirstName: "Marie",
+		LastName:  "Curie",
+		Email:     "marie@example.com",
+		Username:  "marie",
+		Password:  "marie_password",
+	}
+	expectStatus(t, env.do(t, http.MethodPost, "/api/admin/teachers", env.token(t, "teacher"), create), http.StatusForbidden)
+	weak := create
+	weak.Password = "short"
+	expectStatus(t, env.do(t, http.MethodPost, "/api/admin/teachers", adminToken, weak), http.StatusBadRequest)
+
+	rec := env.do(t, http.MethodPost, "/api/admin/teachers", adminToken, create)
+	expectStatus(t, rec, http.StatusCreated)
+	var created models.Teacher
+	decode(t, rec, &created)
+	if !created.Active || created.Email != create.Email {
+		t.Fatalf("unexpected teacher: %+v", created)
+	}
+
+	expectStatus(t, env.do(t, http.MethodPost, "/api/admin/teachers", adminToken, create), http.StatusConflict)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/admin/teachers", adminToken, models.TeacherRequest{Username: "x"}), http.StatusBadRequest)
+
+	// The profile is returned by the read endpoints
+	teacherPath := fmt.Sprintf("/api/teachers/%d", created.ID)
+	rec = env.do(t, http.MethodGet, teacherPath, adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var fetched models.Teacher
+	decode(t, rec, &fetched)
+	if fetched.FirstName != "Marie" || fetched.LastName != "Curie" {
+		t.Fatalf("profile not loaded: %+v", fetched)
+	}
+
+	adminPath := fmt.Sprintf("/api/admin/teachers/%d", created.ID)
+	update := create
+	update.LastName = "Sklodowska-Curie"
+	update.Password = "short"
+	expectStatus(t, env.do(t, http.MethodPut, adminPath, adminToken, update), http.StatusBadRequest)
+	update.Password = "new_password"
+	rec = env.do(t, http.MethodPut, adminPath, adminToken, update)
+	expectStatus(t, rec, http.StatusOK)
+	var updated models.Teacher
+	decode(t, rec, &updated)
+	if updated.LastName != "Sklodowska-Curie" {
+		t.Fatalf("last name not updated: %+v", updated)
+	}
+	env.login(t, "marie", "new_password")
+
+	expectStatus(t, env.do(t, http.MethodPost, "/api/admin/teachers", adminToken, models.TeacherRequest{
+		FirstName: "Other", LastName: "Teacher", Email: create.Email, Username: "other", Password: "other_pw",
+	}), http.StatusConflict)
+	expectStatus(t, env.do(t, http.MethodPut, "/api/admin/teachers/9999", adminToken, update), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodPut, fmt.Sprintf("/api/admin/teachers/%d", env.admin.ID), adminToken, update), http.StatusNotFound)
+
+	// Deactivation blocks login and ends existing sessions
+	session := env.login(t, "marie", "new_password")
+	expectStatus(t, env.do(t, http.MethodPost, adminPath+"/deactivate", adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/protected", session.Token, nil), http.StatusUnauthorized)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/token/refresh", "", handlers.RefreshRequest{RefreshToken: session.RefreshToken}), http.StatusUnauthorized)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/login", "", handlers.LoginRequest{Username: "marie", Password: "new_password"}), http.StatusForbidden)
+
+	rec = env.do(t, http.MethodGet, teacherPath, adminToken, nil)
+	decode(t, rec, &fetched)
+	if fetched.Active {
+		t.Fatal("teacher still active after deactivation")
+	}
+
+	expectStatus(t, env.do(t, http.MethodPost, adminPath+"/activate", adminToken, nil), http.StatusOK)
+	env.login(t, "marie", "new_password")
+	expectStatus(t, env.do(t, http.MethodPost, "/api/admin/teachers/9999/deactivate", adminToken, nil), http.StatusNotFound)
+
+	// Deleting removes the login account and subject assignments
+	expectStatus(t, env.do(t, http.MethodPost, fmt.Sprintf("%s/subjects", teacherPath), adminToken, handlers.AssignSubjectRequest{SubjectID: env.ib1Physics.ID}), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodDelete, adminPath, adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, teacherPath, adminToken, nil), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/login", "", handlers.LoginRequest{Username: "marie", Password: "new_password"}), http.StatusUnauthorized)
+	expectStatus(t, env.do(t, http.MethodDelete, adminPath, adminToken, nil), http.StatusNotFound)
+}
+
+func TestSubjectAdmin(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+
+	history := models.SubjectRequest{
+		Grade:       "IB1",
+		Name:        "History",
+		Description: "IB1 History",
+		Group:       3,
+		Levels:      []string{models.LevelSL, models.LevelHL, models.LevelSL},
+	}
+	expectStatus(t, env.do(t, http.MethodPost, "/api/subjects", env.token(t, "teacher"), history), http.StatusForbidden)
+
+	rec := env.do(t, http.MethodPost, "/api/subjects", adminToken, history)
+	expectStatus(t, rec, http.StatusCreated)
+	var created models.Subject
+	decode(t, rec, &created)
+	if len(created.Levels) != 2 || created.Levels[0] != models.LevelHL || created.Archived {
+		t.Fatalf("unexpected subject: %+v", created)
+	}
+
+	tests := []struct {
+		name string
+		body models.SubjectRequest
+		want int
+	}{
+		{"duplicate name in grade", history, http.StatusConflict},
+		{"missing name", models.SubjectRequest{Grade: "IB1", Group: 3, Levels: []string{"SL"}}, http.StatusBadRequest},
+		{"invalid grade", models.SubjectRequest{Grade: "IB3", Name: "X", Group: 3, Levels: []string{"SL"}}, http.StatusBadRequest},
+		{"IB subject without group", models.SubjectRequest{Grade: "IB1", Name: "X", Levels: []string{"SL"}}, http.StatusBadRequest},
+		{"IB subject without levels", models.SubjectRequest{Grade: "IB1", Name: "X", Group: 3}, http.StatusBadRequest},
+		{"unknown level", models.SubjectRequest{Grade: "IB1", Name: "X", Group: 3, Levels: []string{"AL"}}, http.StatusBadRequest},
+		{"PIB subject with levels", models.SubjectRequest{Grade: "PIB", Name: "X", Levels: []string{"SL"}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, env.do(t, http.MethodPost, "/api/subjects", adminToken, tt.body), tt.want)
+		})
+	}
+
+	// The same name is allowed in another grade
+	history2 := history
+	history2.Grade = "IB2"
+	expectStatus(t, env.do(t, http.MethodPost, "/api/subjects", adminToken, history2), http.StatusCreated)
+
+	// Enrollments are limited to the offered levels
+	path := fmt.Sprintf("/api/subjects/%d", created.ID)
+	slOnly := history
+	slOnly.Levels = []string{models.LevelSL}
+	expectStatus(t, env.do(t, http.MethodPut, path, adminToken, slOnly), http.StatusOK)
+	enrollPath := fmt.Sprintf("/api/admin/students/%d/enrollments", env.student.ID)
+	expectStatus(t, env.do(t, http.MethodPost, enrollPath, adminToken, models.EnrollmentRequest{SubjectID: created.ID, Level: "HL"}), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPost, enrollPath, adminToken, models.EnrollmentRequest{SubjectID: created.ID, Level: "SL"}), http.StatusCreated)
+
+	expectStatus(t, env.do(t, http.MethodPut, "/api/subjects/9999", adminToken, slOnly), http.StatusNotFound)
+	renamed := slOnly
+	renamed.Name = "Physics"
+	expectStatus(t, env.do(t, http.MethodPut, path, adminToken, renamed), http.StatusConflict)
+
+	// Used subjects cannot be deleted, only archived
+	expectStatus(t, env.do(t, http.MethodDelete, path, adminToken, nil), http.StatusConflict)
+
+	archived := slOnly
+	archived.Archived = true
+	expectStatus(t, env.do(t, http.MethodPut, path, adminToken, archived), http.StatusOK)
+
+	countIB1 := func(query string) int {
+		t.Helper()
+		rec := env.do(t, http.MethodGet, "/api/subjects/IB1"+query, adminToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var subjects models.ListResult[models.Subject]
+		decode(t, rec, &subjects)
+		return len(subjects.Data)
+	}
+	if n := countIB1(""); n != 2 {
+		t.Errorf("listed %d IB1 subjects, want 2 without the archived one", n)
+	}
+	if n := countIB1("?include_archived=true"); n != 3 {
+		t.Errorf("listed %d IB1 subjects, want 3 including the archived one", n)
+	}
+
+	// Existing enrollments survive; new enrollments and assignments are refused
+	rec = env.do(t, http.MethodGet, enrollPath, adminToken, nil)
+	var enrollments handlers.EnrollmentsResponse
+	decode(t, rec, &enrollments)
+	if len(enrollments.Enrollments) != 1 {
+		t.Fatalf("archived subject dropped from enrollments: %+v", enrollments)
+	}
+	expectStatus(t, env.do(t, http.MethodPost, fmt.Sprintf("/api/teachers/%d/subjects", env.teacher.ID), adminToken, handlers.AssignSubjectRequest{SubjectID: created.ID}), http.StatusConflict)
+	expectStatus(t, env.do(t, http.MethodDelete, fmt.Sprintf("%s/%d", enrollPath, created.ID), adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodPost, enrollPath, adminToken, models.EnrollmentRequest{SubjectID: created.ID, Level: "SL"}), http.StatusConflict)
+
+	// Once unused, the subject can be deleted
+	expectStatus(t, env.do(t, http.MethodDelete, path, adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodDelete, path, adminToken, nil), http.StatusNotFound)
+}
+
+func TestAttendance(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+	teacherToken := env.token(t, "teacher")
+
+	if _, err := env.store.CreateUser("other_teacher", "other_teacher_pw", "teacher"); err != nil {
+		t.Fatal(err)
+	}
+	otherToken := env.token(t, "other_teacher")
+
+	grace, err := env.store.CreateStudent(&models.StudentRequest{
+		FirstName: "Grace",
+		LastName:  "Hopper",
+		Email:     "grace@example.com",
+		Grade:     "IB1",
+		Username:  "grace",
+		Password:  "grace_pw",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, studentID := range []int{env.student.ID, grace.ID} {
+		if _, _, err := env.store.EnrollStudent(studentID, &models.EnrollmentRequest{SubjectID: env.ib1Physics.ID, Level: models.LevelHL}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := env.store.AssignSubjectToTeacher(env.teacher.ID, env.ib1Physics.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	lesson := func(date string, records ...models.AttendanceEntry) models.LessonRequest {
+		return models.LessonRequest{SubjectID: env.ib1Physics.ID, Date: date, Topic: "Kinematics", Records: records}
+	}
+	create := func(token string, req models.LessonRequest) *httptest.ResponseRecorder {
+		return env.do(t, http.MethodPost, "/api/attendance/lessons", token, req)
+	}
+	ada := func(status, note string) models.AttendanceEntry {
+		return models.AttendanceEntry{StudentID: env.student.ID, Status: status, Note: note}
+	}
+	hopper := func(status string) models.AttendanceEntry {
+		return models.AttendanceEntry{StudentID: grace.ID, Status: status}
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		req   models.LessonRequest
+		want  int
+	}{
+		{"not teaching", otherToken, lesson("2026-09-01", ada("present", "")), http.StatusForbidden},
+		{"students lack permission", env.token(t, "student"), lesson("2026-09-01"), http.StatusForbidden},
+		{"bad date", teacherToken, lesson("01/09/2026"), http.StatusBadRequest},
+		{"bad status", teacherToken, lesson("2026-09-01", ada("sick", "")), http.StatusBadRequest},
+		{"excused without note", teacherToken, lesson("2026-09-01", ada("excused", " ")), http.StatusBadRequest},
+		{"listed twice", teacherToken, lesson("2026-09-01", ada("present", ""), ada("late", "")), http.StatusBadRequest},
+		{"not enrolled", teacherToken, models.LessonRequest{SubjectID: env.ib1Math.ID, Date: "2026-09-01"}, http.StatusForbidden},
+		{"unknown subject", teacherToken, models.LessonRequest{SubjectID: 9999, Date: "2026-09-01"}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, create(tt.token, tt.req), tt.want)
+		})
+	}
+
+	// Students must be enrolled in the subject
+	if err := env.store.AssignSubjectToTeacher(env.teacher.ID, env.ib1Math.ID); err != nil {
+		t.Fatal(err)
+	}
+	mathLesson := models.LessonRequest{SubjectID: env.ib1Math.ID, Date: "2026-09-01", Records: []models.AttendanceEntry{ada("present", "")}}
+	expectStatus(t, create(teacherToken, mathLesson), http.StatusBadRequest)
+
+	// Four lessons: Ada attends two, is late once and excused once; Grace is absent from three
+	var lessons []models.Lesson
+	for _, req := range []models.LessonRequest{
+		lesson("2026-09-01", ada("present", ""), hopper("present")),
+		lesson("2026-09-02", ada("late", ""), hopper("absent")),
+		lesson("2026-09-03", ada("excused", "Doctor's appointment"), hopper("absent")),
+		lesson("2026-09-04", ada("present", ""), hopper("present")),
+	} {
+		rec := create(teacherToken, req)
+		expectStatus(t, rec, http.StatusCreated)
+		var created models.Lesson
+		decode(t, rec, &created)
+		lessons = append(lessons, created)
+	}
+	if got := lessons[0].Records; len(got) != 2 || got[0].StudentName != "Grace Hopper" || got[0].RecordedBy != env.teacher.ID {
+		t.Fatalf("unexpected records %+v", got)
+	}
+
+	// Corrections replace the listed records only
+	recordPath := fmt.Sprintf("/api/attendance/lessons/%d/records", lessons[3].ID)
+	correction := handlers.RecordAttendanceRequest{Records: []models.AttendanceEntry{hopper("absent")}}
+	expectStatus(t, env.do(t, http.MethodPut, recordPath, otherToken, correction), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPut, recordPath, teacherToken, handlers.RecordAttendanceRequest{}), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPut, "/api/attendance/lessons/9999/records", teacherToken, correction), http.StatusNotFound)
+	rec := env.do(t, http.MethodPut, recordPath, teacherToken, correction)
+	expectStatus(t, rec, http.StatusOK)
+	var corrected models.Lesson
+	decode(t, rec, &corrected)
+	if len(corrected.Records) != 2 || corrected.Records[0].Status != models.AttendanceAbsent || corrected.Records[1].Status != models.AttendancePresent {
+		t.Fatalf("unexpected records after correction %+v", corrected.Records)
+	}
+
+	// Teachers see the lessons of their own subjects; attendance:read sees all
+	lessonPath := fmt.Sprintf("/api/attendance/lessons/%d", lessons[0].ID)
+	expectStatus(t, env.do(t, http.MethodGet, lessonPath, teacherToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, lessonPath, adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, lessonPath, otherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/attendance/lessons/9999", adminToken, nil), http.StatusNotFound)
+
+	lessonsPath := fmt.Sprintf("/api/attendance/subjects/%d/lessons", env.ib1Physics.ID)
+	rec = env.do(t, http.MethodGet, lessonsPath+"?from=2026-09-02&to=2026-09-03", teacherToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var listed []models.Lesson
+	decode(t, rec, &listed)
+	if len(listed) != 2 || listed[0].ID != lessons[2].ID {
+		t.Fatalf("expected the lessons of 2 and 3 September, most recent first, got %+v", listed)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, lessonsPath, otherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, lessonsPath+"?from=2026-09-04&to=2026-09-01", teacherToken, nil), http.StatusBadRequest)
+
+	// Per-subject summary: Ada 3 of 3 counted lessons, Grace 1 of 4
+	summaryPath := fmt.Sprintf("/api/attendance/subjects/%d/summary", env.ib1Physics.ID)
+	rec = env.do(t, http.MethodGet, summaryPath, teacherToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var subjectSummary handlers.SubjectAttendanceResponse
+	decode(t, rec, &subjectSummary)
+	if len(subjectSummary.Students) != 2 {
+		t.Fatalf("expected 2 students, got %+v", subjectSummary)
+	}
+	hopperSummary, adaSummary := subjectSummary.Students[0], subjectSummary.Students[1]
+	if hopperSummary.Rate != 25 || hopperSummary.Absent != 3 || adaSummary.Rate != 100 || adaSummary.Excused != 1 || adaSummary.Late != 1 {
+		t.Fatalf("unexpected summaries %+v %+v", hopperSummary, adaSummary)
+	}
+	if subjectSummary.Overall.Lessons != 8 || subjectSummary.Overall.Rate != 57.1 {
+		t.Fatalf("unexpected overall %+v", subjectSummary.Overall)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, summaryPath, otherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/attendance/subjects/9999/summary", adminToken, nil), http.StatusNotFound)
+
+	// Per-student summary is limited to attendance:read
+	studentPath := fmt.Sprintf("/api/attendance/students/%d/summary", grace.ID)
+	expectStatus(t, env.do(t, http.MethodGet, studentPath, teacherToken, nil), http.StatusForbidden)
+	rec = env.do(t, http.MethodGet, studentPath+"?from=2026-09-02", adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var studentSummary handlers.StudentAttendanceResponse
+	decode(t, rec, &studentSummary)
+	if len(studentSummary.Subjects) != 1 || studentSummary.Subjects[0].SubjectName != "Physics" || studentSummary.Overall.Lessons != 3 || studentSummary.Overall.Rate != 0 {
+		t.Fatalf("unexpected student summary %+v", studentSummary)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/attendance/students/9999/summary", adminToken, nil), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodGet, studentPath+"?to=tomorrow", adminToken, nil), http.StatusBadRequest)
+
+	// The report lists students below the threshold, 90% unless configured or overridden
+	report := func(query string) handlers.AttendanceReportResponse {
+		t.Helper()
+		rec := env.do(t, http.MethodGet, "/api/admin/attendance/report"+query, adminToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var resp handlers.AttendanceReportResponse
+		decode(t, rec, &resp)
+		return resp
+	}
+	if resp := report(""); resp.Threshold != 90 || len(resp.Students) != 1 || resp.Students[0].StudentID != grace.ID {
+		t.Fatalf("unexpected report %+v", resp)
+	}
+	if resp := report("?threshold=20"); len(resp.Students) != 0 {
+		t.Fatalf("expected nobody below 20%%, got %+v", resp.Students)
+	}
+	env.handler.AttendanceThreshold = 10
+	if resp := report("?from=2026-09-02&to=2026-09-03"); resp.Threshold != 10 || len(resp.Students) != 1 || resp.Students[0].Rate != 0 {
+		t.Fatalf("unexpected report for 2 and 3 September %+v", resp)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/attendance/report?threshold=120", adminToken, nil), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/attendance/report", teacherToken, nil), http.StatusForbidden)
+
+	// Subjects with lessons can only be archived, and archived subjects take no new lessons
+	expectStatus(t, env.do(t, http.MethodDelete, fmt.Sprintf("/api/subjects/%d", env.ib1Physics.ID), adminToken, nil), http.StatusConflict)
+	archived := models.SubjectRequest{Grade: "IB1", Name: "Physics", Group: 4, Levels: []string{models.LevelHL, models.LevelSL}, Archived: true}
+	expectStatus(t, env.do(t, http.MethodPut, fmt.Sprintf("/api/subjects/%d", env.ib1Physics.ID), adminToken, archived), http.StatusOK)
+	expectStatus(t, create(teacherToken, lesson("2026-09-05", ada("present", ""))), http.StatusConflict)
+
+	// Deleting the teacher keeps the lessons
+	expectStatus(t, env.do(t, http.MethodDelete, fmt.Sprintf("/api/admin/teachers/%d", env.teacher.ID), adminToken, nil), http.StatusOK)
+	rec = env.do(t, http.MethodGet, lessonPath, adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var orphaned models.Lesson
+	decode(t, rec, &orphaned)
+	if orphaned.TeacherID != 0 || len(orphaned.Records) != 2 || orphaned.Records[0].RecordedBy != 0 {
+		t.Fatalf("unexpected lesson after deleting its teacher %+v", orphaned)
+	}
+}
+
+func TestGradebook(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+	teacherToken := env.token(t, "teacher")
+
+	if _, err := env.store.CreateUser("other_teacher", "other_teacher_pw", "teacher"); err != nil {
+		t.Fatal(err)
+	}
+	otherToken := env.token(t, "other_teacher")
+
+	grace, err := env.store.CreateStudent(&models.StudentRequest{
+		FirstName: "Grace",
+		LastName:  "Hopper",
+		Email:     "grace@example.com",
+		Grade:     "IB1",
+		Username:  "grace",
+		Password:  "grace_pw",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, studentID := range []int{env.student.ID, grace.ID} {
+		if _, _, err := env.store.EnrollStudent(studentID, &models.EnrollmentRequest{SubjectID: env.ib1Physics.ID, Level: models.LevelHL}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, subjectID := range []int{env.ib1Physics.ID, env.ib1Math.ID} {
+		if err := env.store.AssignSubjectToTeacher(env.teacher.ID, subjectID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	subjectPath := fmt.Sprintf("/api/gradebook/subjects/%d", env.ib1Physics.ID)
+
+	// Subjects start without categories and with the default boundaries
+	rec := env.do(t, http.MethodGet, subjectPath+"/scheme", teacherToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var scheme models.GradingScheme
+	decode(t, rec, &scheme)
+	if len(scheme.Categories) != 0 || !scheme.DefaultBoundaries || len(scheme.Boundaries) != 6 {
+		t.Fatalf("unexpected default scheme %+v", scheme)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, subjectPath+"/scheme", otherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/gradebook/subjects/9999/scheme", adminToken, nil), http.StatusNotFound)
+
+	categories := []models.AssessmentCategory{{Name: "Tests", Weight: 70}, {Name: "Homework", Weight: 30}}
+	schemes := []struct {
+		name  string
+		token string
+		req   models.GradingSchemeRequest
+		want  int
+	}{
+		{"not teaching", otherToken, models.GradingSchemeRequest{Categories: categories}, http.StatusForbidden},
+		{"students lack permission", env.token(t, "student"), models.GradingSchemeRequest{Categories: categories}, http.StatusForbidden},
+		{"no categories", teacherToken, models.GradingSchemeRequest{}, http.StatusBadRequest},
+		{"zero weight", teacherToken, models.GradingSchemeRequest{Categories: []models.AssessmentCategory{{Name: "Tests"}}}, http.StatusBadRequest},
+		{"duplicate category", teacherToken, models.GradingSchemeRequest{Categories: append(categories, models.AssessmentCategory{Name: " Tests ", Weight: 1})}, http.StatusBadRequest},
+		{"descending boundaries", teacherToken, models.GradingSchemeRequest{Categories: categories, Boundaries: []float64{20, 30, 42, 54, 78, 66}}, http.StatusBadRequest},
+		{"too few boundaries", teacherToken, models.GradingSchemeRequest{Categories: categories, Boundaries: []float64{20, 30}}, http.StatusBadRequest},
+		{"valid", teacherToken, models.GradingSchemeRequest{Categories: categories}, http.StatusOK},
+	}
+	for _, tt := range schemes {
+		t.Run("scheme "+tt.name, func(t *testing.T) {
+			expectStatus(t, env.do(t, http.MethodPut, subjectPath+"/scheme", tt.token, tt.req), tt.want)
+		})
+	}
+
+	// Assessments belong to a category of the scheme
+	create := func(token string, req models.AssessmentRequest) *httptest.ResponseRecorder {
+		return env.do(t, http.MethodPost, subjectPath+"/assessments", token, req)
+	}
+	unitTest := models.AssessmentRequest{Name: "Unit 1 test", Category: "Tests", MaxMark: 50, Date: "2026-09-10"}
+	expectStatus(t, create(otherToken, unitTest), http.StatusForbidden)
+	expectStatus(t, create(teacherToken, models.AssessmentRequest{Name: "Lab", Category: "Labs", MaxMark: 10, Date: "2026-09-10"}), http.StatusBadRequest)
+	expectStatus(t, create(teacherToken, models.AssessmentRequest{Name: "Lab", Category: "Tests", Date: "2026-09-10"}), http.StatusBadRequest)
+	expectStatus(t, create(teacherToken, models.AssessmentRequest{Name: "Lab", Category: "Tests", MaxMark: 10, Date: "10.09.2026"}), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/gradebook/subjects/9999/assessments", teacherToken, unitTest), http.StatusNotFound)
+
+	var assessments []models.Assessment
+	for _, req := range []models.AssessmentRequest{
+		unitTest,
+		{Name: "Worksheet", Category: "Homework", MaxMark: 10, Date: "2026-09-05"},
+		{Name: "Quiz", Category: "Tests", Weight: 0.5, MaxMark: 20, Date: "2026-09-12"},
+	} {
+		rec := create(teacherToken, req)
+		expectStatus(t, rec, http.StatusCreated)
+		var created models.Assessment
+		decode(t, rec, &created)
+		assessments = append(assessments, created)
+	}
+	if assessments[0].Weight != 1 || assessments[0].CreatedBy != env.teacher.ID {
+		t.Fatalf("unexpected assessment %+v", assessments[0])
+	}
+
+	rec = env.do(t, http.MethodGet, subjectPath+"/assessments", teacherToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var listed []models.Assessment
+	decode(t, rec, &listed)
+	if len(listed) != 3 || listed[0].Name != "Worksheet" || listed[2].Name != "Quiz" {
+		t.Fatalf("expected assessments oldest first, got %+v", listed)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, subjectPath+"/assessments", otherToken, nil), http.StatusForbidden)
+
+	// Marks are limited to enrolled students and the maximum mark
+	scores := func(assessment models.Assessment, token string, entries ...models.ScoreEntry) *httptest.ResponseRecorder {
+		path := fmt.Sprintf("/api/gradebook/assessments/%d/scores", assessment.ID)
+		return env.do(t, http.MethodPut, path, token, handlers.RecordScoresRequest{Scores: entries})
+	}
+	ada := func(mark float64) models.ScoreEntry { return models.ScoreEntry{StudentID: env.student.ID, Mark: mark} }
+	hopper := func(mark float64) models.ScoreEntry { return models.ScoreEntry{StudentID: grace.ID, Mark: mark} }
+	expectStatus(t, scores(assessments[0], otherToken, ada(40)), http.StatusForbidden)
+	expectStatus(t, scores(assessments[0], teacherToken), http.StatusBadRequest)
+	expectStatus(t, scores(assessments[0], teacherToken, ada(51)), http.StatusBadRequest)
+	expectStatus(t, scores(assessments[0], teacherToken, ada(-1)), http.StatusBadRequest)
+	expectStatus(t, scores(assessments[0], teacherToken, ada(40), ada(41)), http.StatusBadRequest)
+	expectStatus(t, scores(assessments[0], teacherToken, models.ScoreEntry{StudentID: 9999, Mark: 1}), http.StatusBadRequest)
+	expectStatus(t, scores(models.Assessment{ID: 9999}, teacherToken, ada(1)), http.StatusNotFound)
+
+	// Ada: tests (80% weight 1, 50% weight 0.5) = 70%, homework 90%, overall 76%.
+	// Grace: tests 40% and no homework, overall 40%.
+	expectStatus(t, scores(assessments[0], teacherToken, ada(40), hopper(20)), http.StatusOK)
+	expectStatus(t, scores(assessments[1], teacherToken, ada(9)), http.StatusOK)
+	expectStatus(t, scores(assessments[2], teacherToken, ada(12)), http.StatusOK)
+	rec = scores(assessments[2], teacherToken, ada(10))
+	expectStatus(t, rec, http.StatusOK)
+	var marked models.Assessment
+	decode(t, rec, &marked)
+	if len(marked.Scores) != 1 || marked.Scores[0].Mark != 10 || marked.Scores[0].StudentName != "Ada Lovelace" {
+		t.Fatalf("unexpected marks after correction %+v", marked.Scores)
+	}
+
+	grades := func() handlers.SubjectGradesResponse {
+		t.Helper()
+		rec := env.do(t, http.MethodGet, subjectPath+"/grades", teacherToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var resp handlers.SubjectGradesResponse
+		decode(t, rec, &resp)
+		if len(resp.Students) != 2 {
+			t.Fatalf("expected 2 students, got %+v", resp.Students)
+		}
+		return resp
+	}
+	resp := grades()
+	hopperGrade, adaGrade := resp.Students[0], resp.Students[1]
+	if *adaGrade.Percentage != 76 || adaGrade.Grade != 6 || *adaGrade.Categories[0].Percentage != 70 || *adaGrade.Categories[1].Percentage != 90 {
+		t.Fatalf("unexpected grade for Ada %+v", adaGrade)
+	}
+	if *hopperGrade.Percentage != 40 || hopperGrade.Grade != 3 || hopperGrade.Categories[1].Percentage != nil {
+		t.Fatalf("unexpected grade for Grace %+v", hopperGrade)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, subjectPath+"/grades", otherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, subjectPath+"/grades", adminToken, nil), http.StatusOK)
+
+	// Custom boundaries change the grades; used categories cannot be dropped
+	lenient := models.GradingSchemeRequest{Categories: categories, Boundaries: []float64{10, 20, 30, 40, 50, 60}}
+	expectStatus(t, env.do(t, http.MethodPut, subjectPath+"/scheme", teacherToken, lenient), http.StatusOK)
+	if resp := grades(); resp.Scheme.DefaultBoundaries || resp.Students[0].Grade != 5 || resp.Students[1].Grade != 7 {
+		t.Fatalf("unexpected grades with custom boundaries %+v", resp)
+	}
+	testsOnly := models.GradingSchemeRequest{Categories: categories[:1]}
+	expectStatus(t, env.do(t, http.MethodPut, subjectPath+"/scheme", teacherToken, testsOnly), http.StatusConflict)
+
+	// Assessments can be viewed by their teachers and gradebook:read
+	assessmentPath := fmt.Sprintf("/api/gradebook/assessments/%d", assessments[0].ID)
+	expectStatus(t, env.do(t, http.MethodGet, assessmentPath, teacherToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, assessmentPath, adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, assessmentPath, otherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/gradebook/assessments/9999", adminToken, nil), http.StatusNotFound)
+
+	// The maximum mark cannot drop below a recorded mark
+	unitTest.MaxMark = 30
+	expectStatus(t, env.do(t, http.MethodPut, assessmentPath, teacherToken, unitTest), http.StatusBadRequest)
+	unitTest.MaxMark = 50
+	unitTest.Name = "Unit 1 test (kinematics)"
+	expectStatus(t, env.do(t, http.MethodPut, assessmentPath, otherToken, unitTest), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPut, "/api/gradebook/assessments/9999", teacherToken, unitTest), http.StatusNotFound)
+	rec = env.do(t, http.MethodPut, assessmentPath, teacherToken, unitTest)
+	expectStatus(t, rec, http.StatusOK)
+	var updated models.Assessment
+	decode(t, rec, &updated)
+	if updated.Name != unitTest.Name || len(updated.Scores) != 2 {
+		t.Fatalf("unexpected updated assessment %+v", updated)
+	}
+
+	// Predicted grades keep their history
+	predictedPath := fmt.Sprintf("%s/students/%d/predicted", subjectPath, env.student.ID)
+	expectStatus(t, env.do(t, http.MethodPost, predictedPath, otherToken, models.PredictedGradeRequest{Grade: 6}), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPost, predictedPath, teacherToken, models.PredictedGradeRequest{Grade: 8}), http.StatusBadRequest)
+	notEnrolled := fmt.Sprintf("/api/gradebook/subjects/%d/students/%d/predicted", env.ib1Math.ID, env.student.ID)
+	expectStatus(t, env.do(t, http.MethodPost, notEnrolled, teacherToken, models.PredictedGradeRequest{Grade: 6}), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodPost, predictedPath, teacherToken, models.PredictedGradeRequest{Grade: 6}), http.StatusCreated)
+	expectStatus(t, env.do(t, http.MethodPost, predictedPath, teacherToken, models.PredictedGradeRequest{Grade: 7, Comment: "Strong lab work"}), http.StatusCreated)
+
+	bookPath := fmt.Sprintf("%s/students/%d", subjectPath, env.student.ID)
+	rec = env.do(t, http.MethodGet, bookPath, teacherToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var book models.StudentGradebook
+	decode(t, rec, &book)
+	if book.Predicted == nil || book.Predicted.Grade != 7 || len(book.PredictedHistory) != 2 || book.PredictedHistory[1].Grade != 6 {
+		t.Fatalf("unexpected predicted grades %+v", book)
+	}
+	if len(book.Marks) != 3 || book.Marks[0].Name != "Worksheet" || *book.Marks[0].Mark != 9 || book.Grade != 7 {
+		t.Fatalf("unexpected gradebook %+v", book)
+	}
+	if resp := grades(); resp.Students[1].Predicted == nil || resp.Students[1].Predicted.Grade != 7 || resp.Students[0].Predicted != nil {
+		t.Fatalf("expected the latest prediction in the grade list, got %+v", resp.Students)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, bookPath, otherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, fmt.Sprintf("%s/students/9999", subjectPath), adminToken, nil), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodGet, fmt.Sprintf("%s/students/x", subjectPath), adminToken, nil), http.StatusBadRequest)
+
+	// Subjects with assessments can only be archived
+	expectStatus(t, env.do(t, http.MethodDelete, fmt.Sprintf("/api/subjects/%d", env.ib1Physics.ID), adminToken, nil), http.StatusConflict)
+
+	// Deleting an assessment removes its marks from the grades
+	quizPath := fmt.Sprintf("/api/gradebook/assessments/%d", assessments[2].ID)
+	expectStatus(t, env.do(t, http.MethodDelete, quizPath, otherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodDelete, quizPath, teacherToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodDelete, quizPath, teacherToken, nil), http.StatusNotFound)
+	if resp := grades(); *resp.Students[1].Categories[0].Percentage != 80 {
+		t.Fatalf("expected tests at 80%% without the quiz, got %+v", resp.Students[1])
+	}
+}
+
+func TestDiplomaStatus(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+
+	// Ada takes Physics, Math and History at HL and English, Spanish and Art at SL
+	subjects := []struct {
+		subject *models.Subject
+		level   string
+	}{
+		{env.ib1Physics, models.LevelHL},
+		{env.ib1Math, models.LevelHL},
+		{env.addSubject(t, "IB1", "History", 3), models.LevelHL},
+		{env.addSubject(t, "IB1", "English A", 1), models.LevelSL},
+		{env.addSubject(t, "IB1", "Spanish B", 2), models.LevelSL},
+		{env.addSubject(t, "IB1", "Visual Arts", 6), models.LevelSL},
+	}
+	for _, s := range subjects {
+		if _, _, err := env.store.EnrollStudent(env.student.ID, &models.EnrollmentRequest{SubjectID: s.subject.ID, Level: s.level}); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.store.AssignSubjectToTeacher(env.teacher.ID, s.subject.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	statusPath := fmt.Sprintf("/api/students/%d/diploma-status", env.student.ID)
+	corePath := fmt.Sprintf("/api/students/%d/diploma-core", env.student.ID)
+	status := func(query string) models.DiplomaStatus {
+		t.Helper()
+		rec := env.do(t, http.MethodGet, statusPath+query, adminToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var resp models.DiplomaStatus
+		decode(t, rec, &resp)
+		return resp
+	}
+
+	if resp := status(""); resp.Status != models.DiplomaIncomplete || len(resp.Subjects) != 6 || resp.TotalPoints != 0 {
+		t.Fatalf("expected an incomplete status without grades, got %+v", resp)
+	}
+
+	// Predicted grades 6, 5, 5 at HL and 5, 4, 4 at SL with TOK B and EE A make 32 points
+	for i, grade := range []int{6, 5, 5, 5, 4, 4} {
+		if _, err := env.store.AddPredictedGrade(subjects[i].subject.ID, env.student.ID, env.teacher.ID, &models.PredictedGradeRequest{Grade: grade}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	complete := true
+	rec := env.do(t, http.MethodPut, corePath, adminToken, models.DiplomaCoreRequest{TOK: "b", EE: "A", CASComplete: &complete})
+	expectStatus(t, rec, http.StatusOK)
+	var core models.DiplomaCore
+	decode(t, rec, &core)
+	if core.TOK != "B" || core.UpdatedBy != env.admin.ID {
+		t.Fatalf("unexpected core results %+v", core)
+	}
+
+	resp := status("")
+	if resp.Status != models.DiplomaOnTrack || resp.SubjectPoints != 29 || resp.CorePoints != 3 || resp.TotalPoints != 32 {
+		t.Fatalf("expected 32 points on track, got %+v", resp)
+	}
+	for _, r := range resp.Rules {
+		if r.Result != models.RulePassed || r.Explanation == "" {
+			t.Fatalf("expected every rule to pass with an explanation, got %+v", r)
+		}
+	}
+
+	// Current grades need marks, which nobody has yet
+	if resp := status("?source=current"); resp.Status != models.DiplomaIncomplete || resp.SubjectPoints != 0 {
+		t.Fatalf("expected an incomplete status from current grades, got %+v", resp)
+	}
+
+	// An E in the core fails the diploma
+	expectStatus(t, env.do(t, http.MethodPut, corePath, adminToken, models.DiplomaCoreRequest{TOK: "E", EE: "A"}), http.StatusOK)
+	if resp := status(""); resp.Status != models.DiplomaFailing || resp.CorePoints != 0 {
+		t.Fatalf("expected a failing status with TOK E, got %+v", resp)
+	}
+
+	expectStatus(t, env.do(t, http.MethodPut, corePath, adminToken, models.DiplomaCoreRequest{TOK: "F"}), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPut, "/api/students/9999/diploma-core", adminToken, models.DiplomaCoreRequest{}), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodPut, corePath, env.token(t, "teacher"), models.DiplomaCoreRequest{}), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, statusPath, env.token(t, "teacher"), nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, statusPath+"?source=final", adminToken, nil), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/students/9999/diploma-status", adminToken, nil), http.StatusNotFound)
+
+	pib, err := env.store.CreateStudent(&models.StudentRequest{
+		FirstName: "Alan",
+		LastName:  "Turing",
+		Email:     "alan@example.com",
+		Grade:     "PIB",
+		Username:  "alan",
+		Password:  "alan_pw",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, fmt.Sprintf("/api/students/%d/diploma-status", pib.ID), adminToken, nil), http.StatusConflict)
+}
+
+func TestCAS(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+	teacherToken := env.token(t, "teacher")
+	studentToken := env.token(t, "student")
+
+	if _, err := env.store.CreateUser("other", "other_pw", "teacher"); err != nil {
+		t.Fatal(err)
+	}
+	otherToken := env.token(t, "other")
+
+	activity := models.CASActivityRequest{
+		Title:        "Beach clean-up",
+		Strands:      []string{models.CASStrandService, models.CASStrandActivity},
+		Hours:        6,
+		StartDate:    "2024-03-02",
+		Reflection:   "Organising volunteers was harder than expected.",
+		Outcomes:     []int{2, 4},
+		SupervisorID: env.teacher.ID,
+	}
+	rec := env.do(t, http.MethodPost, "/api/cas/activities", studentToken, activity)
+	expectStatus(t, rec, http.StatusCreated)
+	var created models.CASActivity
+	decode(t, rec, &created)
+	if created.Status != models.CASPending || created.StudentID != env.student.ID || created.SupervisorName == "" {
+		t.Fatalf("unexpected activity %+v", created)
+	}
+	activityPath := fmt.Sprintf("/api/cas/activities/%d", created.ID)
+
+	// Invalid activities are rejected
+	invalid := activity
+	invalid.Strands = []string{"sport"}
+	expectStatus(t, env.do(t, http.MethodPost, "/api/cas/activities", studentToken, invalid), http.StatusBadRequest)
+	invalid = activity
+	invalid.Outcomes = []int{8}
+	expectStatus(t, env.do(t, http.MethodPost, "/api/cas/activities", studentToken, invalid), http.StatusBadRequest)
+	invalid = activity
+	invalid.SupervisorID = env.admin.ID
+	expectStatus(t, env.do(t, http.MethodPost, "/api/cas/activities", studentToken, invalid), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/cas/activities", teacherToken, activity), http.StatusForbidden)
+
+	// The owner, the supervisor and coordinators see the activity; other teachers don't
+	expectStatus(t, env.do(t, http.MethodGet, activityPath, studentToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, activityPath, teacherToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, activityPath, adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, activityPath, otherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/cas/activities/9999", adminToken, nil), http.StatusNotFound)
+
+	rec = env.do(t, http.MethodGet, "/api/cas/supervision?status=pending", teacherToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var pending []models.CASActivity
+	decode(t, rec, &pending)
+	if len(pending) != 1 || pending[0].ID != created.ID {
+		t.Fatalf("expected one pending activity to review, got %+v", pending)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/cas/supervision?status=done", teacherToken, nil), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/cas/supervision", studentToken, nil), http.StatusForbidden)
+
+	// Only the supervisor reviews, and a rejection needs a comment
+	reviewPath := activityPath + "/review"
+	expectStatus(t, env.do(t, http.MethodPost, reviewPath, otherToken, models.CASReviewRequest{Status: models.CASApproved}), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPost, reviewPath, teacherToken, models.CASReviewRequest{Status: models.CASRejected}), http.StatusBadRequest)
+	rec = env.do(t, http.MethodPost, reviewPath, teacherToken, models.CASReviewRequest{Status: models.CASRejected, Comment: "Add photos"})
+	expectStatus(t, rec, http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodPost, reviewPath, teacherToken, models.CASReviewRequest{Status: models.CASApproved}), http.StatusConflict)
+
+	// Editing resubmits the activity for review
+	activity.Evidence = "https://example.com/photos"
+	rec = env.do(t, http.MethodPut, activityPath, studentToken, activity)
+	expectStatus(t, rec, http.StatusOK)
+	var updated models.CASActivity
+	decode(t, rec, &updated)
+	if updated.Status != models.CASPending || updated.ReviewComment != "" || updated.Evidence == "" {
+		t.Fatalf("expected the edited activity to await review, got %+v", updated)
+	}
+	expectStatus(t, env.do(t, http.MethodPost, reviewPath, teacherToken, models.CASReviewRequest{Status: models.CASApproved}), http.StatusOK)
+
+	// Approved activities are locked
+	expectStatus(t, env.do(t, http.MethodPut, activityPath, studentToken, activity), http.StatusConflict)
+	expectStatus(t, env.do(t, http.MethodDelete, activityPath, studentToken, nil), http.StatusConflict)
+
+	// A pending creativity activity counts towards pending hours only
+	draft := models.CASActivityRequest{
+		Title:        "School musical",
+		Strands:      []string{models.CASStrandCreativity},
+		Hours:        10,
+		StartDate:    "2024-04-01",
+		EndDate:      "2024-05-15",
+		Reflection:   "Learning lines alongside exams.",
+		Outcomes:     []int{1},
+		SupervisorID: env.teacher.ID,
+	}
+	rec = env.do(t, http.MethodPost, "/api/cas/activities", studentToken, draft)
+	expectStatus(t, rec, http.StatusCreated)
+	var musical models.CASActivity
+	decode(t, rec, &musical)
+
+	rec = env.do(t, http.MethodGet, "/api/cas/me", studentToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var progress models.CASProgress
+	decode(t, rec, &progress)
+	if progress.ApprovedHours != 6 || progress.PendingHours != 10 || progress.OutcomesMet != 2 ||
+		progress.StrandHours[models.CASStrandService] != 6 || progress.StrandHours[models.CASStrandCreativity] != 0 ||
+		len(progress.Outcomes) != 7 || !progress.Outcomes[3].Met || len(progress.Activities) != 2 {
+		t.Fatalf("unexpected progress %+v", progress)
+	}
+
+	expectStatus(t, env.do(t, http.MethodDelete, fmt.Sprintf("/api/cas/activities/%d", musical.ID), studentToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodDelete, fmt.Sprintf("/api/cas/activities/%d", musical.ID), studentToken, nil), http.StatusNotFound)
+
+	studentPath := fmt.Sprintf("/api/cas/students/%d", env.student.ID)
+	rec = env.do(t, http.MethodGet, studentPath, adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &progress)
+	if progress.StudentName != "Ada Lovelace" || progress.ApprovedHours != 6 || len(progress.Activities) != 1 {
+		t.Fatalf("unexpected student progress %+v", progress)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, studentPath, teacherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/cas/students/9999", adminToken, nil), http.StatusNotFound)
+
+	// CAS only applies to IB students
+	if _, err := env.store.CreateStudent(&models.StudentRequest{
+		FirstName: "Alan",
+		LastName:  "Turing",
+		Email:     "alan@example.com",
+		Grade:     "PIB",
+		Username:  "alan",
+		Password:  "alan_pw",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/cas/me", env.token(t, "alan"), nil), http.StatusConflict)
+
+	// Deleting the supervisor keeps the activity without a supervisor
+	if err := env.store.DeleteTeacher(env.teacher.ID); err != nil {
+		t.Fatal(err)
+	}
+	rec = env.do(t, http.MethodGet, activityPath, adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var orphaned models.CASActivity
+	decode(t, rec, &orphaned)
+	if orphaned.SupervisorID != 0 || orphaned.Status != models.CASApproved {
+		t.Fatalf("expected the approved activity without a supervisor, got %+v", orphaned)
+	}
+}
+
+func TestProjects(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+	teacherToken := env.token(t, "teacher")
+	studentToken := env.token(t, "student")
+
+	other, err := env.store.CreateUser("other", "other_pw", "teacher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherToken := env.token(t, "other")
+	if _, _, err := env.store.EnrollStudent(env.student.ID, &models.EnrollmentRequest{SubjectID: env.ib1Physics.ID, Level: models.LevelHL}); err != nil {
+		t.Fatal(err)
+	}
+
+	ia := models.ProjectRequest{
+		Kind:         "IA",
+		StudentID:    env.student.ID,
+		SubjectID:    env.ib1Physics.ID,
+		SupervisorID: env.teacher.ID,
+		Title:        "Damping of a pendulum",
+		Milestones: []models.MilestoneRequest{
+			{Name: "First draft", DueDate: "2024-03-01"},
+			{Name: "Research question", DueDate: "2024-01-15"},
+		},
+	}
+	rec := env.do(t, http.MethodPost, "/api/projects", adminToken, ia)
+	expectStatus(t, rec, http.StatusCreated)
+	var created models.Project
+	decode(t, rec, &created)
+	if created.Kind != models.ProjectIA || created.SubjectName != "Physics" || len(created.Milestones) != 2 || created.Milestones[0].Name != "Research question" {
+		t.Fatalf("unexpected project %+v", created)
+	}
+	projectPath := fmt.Sprintf("/api/projects/%d", created.ID)
+	question, firstDraft := created.Milestones[0], created.Milestones[1]
+
+	expectStatus(t, env.do(t, http.MethodPost, "/api/projects", adminToken, ia), http.StatusConflict)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/projects", teacherToken, ia), http.StatusForbidden)
+	for _, invalid := range []models.ProjectRequest{
+		{Kind: "tok", StudentID: env.student.ID, SubjectID: env.ib1Physics.ID, SupervisorID: env.teacher.ID},
+		{Kind: "ia", StudentID: env.student.ID, SubjectID: env.ib1Math.ID, SupervisorID: env.teacher.ID},
+		{Kind: "ee", StudentID: env.student.ID, SubjectID: env.pibMath.ID, SupervisorID: env.teacher.ID},
+		{Kind: "ee", StudentID: env.student.ID, SubjectID: env.ib1Math.ID, SupervisorID: env.admin.ID},
+		{Kind: "ee", StudentID: env.student.ID, SubjectID: env.ib1Math.ID, SupervisorID: env.teacher.ID,
+			Milestones: []models.MilestoneRequest{{Name: "Outline", DueDate: "March"}}},
+	} {
+		expectStatus(t, env.do(t, http.MethodPost, "/api/projects", adminToken, invalid), http.StatusBadRequest)
+	}
+
+	// The EE needs no enrollment, but a student writes only one
+	ee := models.ProjectRequest{
+		Kind:         "ee",
+		StudentID:    env.student.ID,
+		SubjectID:    env.ib1Math.ID,
+		SupervisorID: other.ID,
+		Milestones:   []models.MilestoneRequest{{Name: "Proposal", DueDate: "2024-01-20"}},
+	}
+	rec = env.do(t, http.MethodPost, "/api/projects", adminToken, ee)
+	expectStatus(t, rec, http.StatusCreated)
+	var essay models.Project
+	decode(t, rec, &essay)
+	ee.SubjectID = env.ib1Physics.ID
+	expectStatus(t, env.do(t, http.MethodPost, "/api/projects", adminToken, ee), http.StatusConflict)
+
+	var projects []models.Project
+	rec = env.do(t, http.MethodGet, "/api/projects/mine", studentToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &projects)
+	if len(projects) != 2 {
+		t.Fatalf("expected the student's EE and IA, got %+v", projects)
+	}
+	rec = env.do(t, http.MethodGet, "/api/projects/supervised", teacherToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &projects)
+	if len(projects) != 1 || projects[0].ID != created.ID {
+		t.Fatalf("expected the teacher to supervise the IA only, got %+v", projects)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/projects/mine", teacherToken, nil), http.StatusForbidden)
+
+	// Only the supervisor signs milestones off
+	completionPath := fmt.Sprintf("%s/milestones/%d/completion", projectPath, question.ID)
+	expectStatus(t, env.do(t, http.MethodPut, completionPath, otherToken, models.MilestoneCompletionRequest{Completed: true}), http.StatusForbidden)
+	rec = env.do(t, http.MethodPut, completionPath, teacherToken, models.MilestoneCompletionRequest{Completed: true})
+	expectStatus(t, rec, http.StatusOK)
+	var signedOff models.ProjectMilestone
+	decode(t, rec, &signedOff)
+	if signedOff.CompletedAt == nil || signedOff.CompletedBy != env.teacher.ID {
+		t.Fatalf("expected the milestone to be signed off, got %+v", signedOff)
+	}
+	expectStatus(t, env.do(t, http.MethodPut, fmt.Sprintf("/api/projects/%d/milestones/%d/completion", essay.ID, essay.Milestones[0].ID), teacherToken,
+		models.MilestoneCompletionRequest{Completed: true}), http.StatusForbidden)
+
+	// On 1 February the EE proposal is overdue while the IA is on track
+	rec = env.do(t, http.MethodGet, "/api/projects/board?grade=IB1&date=2024-02-01", adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var board models.ProjectBoard
+	decode(t, rec, &board)
+	if len(board.Projects) != 2 || board.Counts[models.ProjectBehind] != 1 || board.Counts[models.ProjectOnTrack] != 1 ||
+		board.Projects[0].ID != essay.ID || board.Projects[0].Overdue != 1 || !board.Projects[0].Milestones[0].Overdue {
+		t.Fatalf("expected the EE to be behind first, got %+v", board)
+	}
+	if ia := board.Projects[1]; ia.Status != models.ProjectOnTrack || ia.Completed != 1 || ia.NextMilestone == nil || ia.NextMilestone.ID != firstDraft.ID {
+		t.Fatalf("expected the IA on track with the first draft next, got %+v", ia)
+	}
+	rec = env.do(t, http.MethodGet, "/api/projects/board?grade=IB1&kind=ia", adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &board)
+	if len(board.Projects) != 1 || board.Kind != models.ProjectIA {
+		t.Fatalf("expected only the IA, got %+v", board)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/projects/board?grade=PIB", adminToken, nil), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/projects/board?grade=IB1&kind=tok", adminToken, nil), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/projects/board?grade=IB1&date=soon", adminToken, nil), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/projects/board?grade=IB1", teacherToken, nil), http.StatusForbidden)
+
+	// Students upload drafts of their own projects
+	draftsPath := projectPath + "/drafts"
+	content := []byte("%PDF-1.4 first draft")
+	rec = env.upload(t, draftsPath, studentToken, "draft.pdf", content, map[string]string{"milestone_id": strconv.Itoa(firstDraft.ID)})
+	expectStatus(t, rec, http.StatusCreated)
+	var draft models.ProjectDraft
+	decode(t, rec, &draft)
+	if draft.Size != int64(len(content)) || draft.MilestoneID != firstDraft.ID || draft.Filename != "draft.pdf" {
+		t.Fatalf("unexpected draft %+v", draft)
+	}
+	storedDraft, err := env.store.GetProjectDraft(created.ID, draft.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, env.upload(t, draftsPath, studentToken, "draft.pdf", content,
+		map[string]string{"milestone_id": strconv.Itoa(essay.Milestones[0].ID)}), http.StatusBadRequest)
+	expectStatus(t, env.upload(t, draftsPath, studentToken, "empty.pdf", nil, nil), http.StatusBadRequest)
+	expectStatus(t, env.upload(t, draftsPath, adminToken, "draft.pdf", content, nil), http.StatusForbidden)
+
+	downloadPath := fmt.Sprintf("%s/%d", draftsPath, draft.ID)
+	rec = env.do(t, http.MethodGet, downloadPath, teacherToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if rec.Body.String() != string(content) || rec.Header().Get("Content-Disposition") != `attachment; filename="draft.pdf"` {
+		t.Fatalf("unexpected download %q with %q", rec.Body.String(), rec.Header().Get("Content-Disposition"))
+	}
+	expectStatus(t, env.do(t, http.MethodGet, downloadPath, otherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, draftsPath+"/9999", studentToken, nil), http.StatusNotFound)
+
+	// The supervisor comments on the draft
+	commentsPath := projectPath + "/comments"
+	expectStatus(t, env.do(t, http.MethodPost, commentsPath, teacherToken, models.ProjectCommentRequest{Body: "Good start", DraftID: draft.ID}), http.StatusCreated)
+	expectStatus(t, env.do(t, http.MethodPost, commentsPath, teacherToken, models.ProjectCommentRequest{Body: " "}), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPost, commentsPath, otherToken, models.ProjectCommentRequest{Body: "Hi"}), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPost, commentsPath, studentToken, models.ProjectCommentRequest{Body: "Hi"}), http.StatusForbidden)
+
+	rec = env.do(t, http.MethodGet, projectPath, studentToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var details models.ProjectDetails
+	decode(t, rec, &details)
+	if details.DraftCount != 1 || len(details.Drafts) != 1 || len(details.Comments) != 1 ||
+		details.Comments[0].AuthorID != env.teacher.ID || details.Comments[0].DraftID != draft.ID {
+		t.Fatalf("unexpected project details %+v", details)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, projectPath, otherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/projects/9999", adminToken, nil), http.StatusNotFound)
+
+	// Coordinators manage milestones
+	milestonesPath := projectPath + "/milestones"
+	rec = env.do(t, http.MethodPost, milestonesPath, adminToken, models.MilestoneRequest{Name: "Final submission", DueDate: "2024-04-10"})
+	expectStatus(t, rec, http.StatusCreated)
+	var final models.ProjectMilestone
+	decode(t, rec, &final)
+	rec = env.do(t, http.MethodPut, fmt.Sprintf("%s/%d", milestonesPath, final.ID), adminToken, models.MilestoneRequest{Name: "Final", DueDate: "2024-04-20"})
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &final)
+	if final.Name != "Final" || final.DueDate.Format(models.LessonDateLayout) != "2024-04-20" {
+		t.Fatalf("unexpected milestone %+v", final)
+	}
+	expectStatus(t, env.do(t, http.MethodPut, fmt.Sprintf("%s/%d", milestonesPath, essay.Milestones[0].ID), adminToken,
+		models.MilestoneRequest{Name: "Proposal", DueDate: "2024-02-01"}), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodPost, milestonesPath, teacherToken, models.MilestoneRequest{Name: "Extra", DueDate: "2024-04-01"}), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodDelete, fmt.Sprintf("%s/%d", milestonesPath, final.ID), adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodDelete, fmt.Sprintf("%s/%d", milestonesPath, final.ID), adminToken, nil), http.StatusNotFound)
+
+	// Handing the IA to another supervisor moves it off the teacher's list
+	rec = env.do(t, http.MethodPut, projectPath, adminToken, models.ProjectUpdateRequest{SupervisorID: other.ID, Title: "Pendulum damping"})
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &created)
+	if created.SupervisorID != other.ID || created.Title != "Pendulum damping" {
+		t.Fatalf("unexpected project %+v", created)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, projectPath, teacherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPut, projectPath, adminToken, models.ProjectUpdateRequest{SupervisorID: env.student.UserID}), http.StatusBadRequest)
+
+	// Subjects with projects cannot be deleted
+	expectStatus(t, env.do(t, http.MethodDelete, fmt.Sprintf("/api/subjects/%d", env.ib1Math.ID), adminToken, nil), http.StatusConflict)
+
+	// Deleting the project removes the stored files of its drafts
+	expectStatus(t, env.do(t, http.MethodDelete, projectPath, adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodDelete, projectPath, adminToken, nil), http.StatusNotFound)
+	if _, err := env.handler.Files.Open(storedDraft.StorageKey); err != storage.ErrNotFound {
+		t.Fatalf("expected the draft file to be deleted, got %v", err)
+	}
+}
+
+func TestTimetable(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+	teacherToken := env.token(t, "teacher")
+	studentToken := env.token(t, "student")
+
+	other, err := env.store.CreateUser("other", "other_pw", "teacher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, assignment := range []struct{ teacherID, subjectID int }{
+		{env.teacher.ID, env.ib1Physics.ID},
+		{env.teacher.ID, env.ib1Math.ID},
+		{other.ID, env.ib1Math.ID},
+		{other.ID, env.pibMath.ID},
+	} {
+		if err := env.store.AssignSubjectToTeacher(assignment.teacherID, assignment.subjectID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, subject := range []*models.Subject{env.ib1Physics, env.ib1Math} {
+		if _, _, err := env.store.EnrollStudent(env.student.ID, &models.EnrollmentRequest{SubjectID: subject.ID, Level: models.LevelHL}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Time slots may not overlap
+	createSlot := func(req models.TimeSlotRequest) models.TimeSlot {
+		rec := env.do(t, http.MethodPost, "/api/timetable/slots", adminToken, req)
+		expectStatus(t, rec, http.StatusCreated)
+		var slot models.TimeSlot
+		decode(t, rec, &slot)
+		return slot
+	}
+	first := createSlot(models.TimeSlotRequest{Name: "Period 1", StartTime: "8:00", EndTime: "08:50"})
+	second := createSlot(models.TimeSlotRequest{Name: "Period 2", StartTime: "09:00", EndTime: "09:50"})
+	if first.StartTime != "08:00" || second.EndTime != "09:50" {
+		t.Fatalf("unexpected slots %+v %+v", first, second)
+	}
+	expectStatus(t, env.do(t, http.MethodPost, "/api/timetable/slots", teacherToken, models.TimeSlotRequest{Name: "Period 3", StartTime: "10:00", EndTime: "10:50"}), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/timetable/slots", adminToken, models.TimeSlotRequest{Name: "Period 1", StartTime: "10:00", EndTime: "10:50"}), http.StatusConflict)
+	for _, invalid := range []models.TimeSlotRequest{
+		{Name: "Overlap", StartTime: "08:30", EndTime: "09:10"},
+		{Name: "Backwards", StartTime: "11:00", EndTime: "10:00"},
+		{Name: "Noon", StartTime: "noon", EndTime: "13:00"},
+		{StartTime: "12:00", EndTime: "13:00"},
+	} {
+		expectStatus(t, env.do(t, http.MethodPost, "/api/timetable/slots", adminToken, invalid), http.StatusBadRequest)
+	}
+	secondPath := fmt.Sprintf("/api/timetable/slots/%d", second.ID)
+	expectStatus(t, env.do(t, http.MethodPut, secondPath, adminToken, models.TimeSlotRequest{Name: "Period 2", StartTime: "08:45", EndTime: "09:50"}), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPut, secondPath, adminToken, models.TimeSlotRequest{Name: "Period 2", StartTime: "09:05", EndTime: "09:55"}), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodPut, "/api/timetable/slots/999", adminToken, models.TimeSlotRequest{Name: "Period 9", StartTime: "15:00", EndTime: "15:50"}), http.StatusNotFound)
+
+	rec := env.do(t, http.MethodGet, "/api/timetable/slots", teacherToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var slots []models.TimeSlot
+	decode(t, rec, &slots)
+	if len(slots) != 2 || slots[0].ID != first.ID || slots[1].StartTime != "09:05" {
+		t.Fatalf("unexpected slots %+v", slots)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/timetable/slots", studentToken, nil), http.StatusForbidden)
+
+	// Rooms
+	createRoom := func(req models.RoomRequest) models.Room {
+		rec := env.do(t, http.MethodPost, "/api/timetable/rooms", adminToken, req)
+		expectStatus(t, rec, http.StatusCreated)
+		var room models.Room
+		decode(t, rec, &room)
+		return room
+	}
+	lab := createRoom(models.RoomRequest{Name: "Lab 2", Capacity: 24})
+	classroom := createRoom(models.RoomRequest{Name: "Room 12"})
+	expectStatus(t, env.do(t, http.MethodPost, "/api/timetable/rooms", adminToken, models.RoomRequest{Name: "Lab 2"}), http.StatusConflict)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/timetable/rooms", adminToken, models.RoomRequest{Name: "Hall", Capacity: -1}), http.StatusBadRequest)
+	classroomPath := fmt.Sprintf("/api/timetable/rooms/%d", classroom.ID)
+	expectStatus(t, env.do(t, http.MethodPut, classroomPath, adminToken, models.RoomRequest{Name: "Lab 2"}), http.StatusConflict)
+	expectStatus(t, env.do(t, http.MethodPut, classroomPath, adminToken, models.RoomRequest{Name: "Room 12", Capacity: 30}), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodPut, "/api/timetable/rooms/999", adminToken, models.RoomRequest{Name: "Attic"}), http.StatusNotFound)
+
+	rec = env.do(t, http.MethodGet, "/api/timetable/rooms", teacherToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var rooms []models.Room
+	decode(t, rec, &rooms)
+	if len(rooms) != 2 || rooms[0].Name != "Lab 2" || rooms[1].Capacity != 30 {
+		t.Fatalf("unexpected rooms %+v", rooms)
+	}
+
+	// Lessons
+	physics := models.TimetableLessonRequest{SubjectID: env.ib1Physics.ID, TeacherID: env.teacher.ID, RoomID: lab.ID, Day: 1, SlotID: first.ID}
+	rec = env.do(t, http.MethodPost, "/api/timetable/lessons", adminToken, physics)
+	expectStatus(t, rec, http.StatusCreated)
+	var physicsLesson models.TimetableLesson
+	decode(t, rec, &physicsLesson)
+	if physicsLesson.SubjectName != "Physics" || physicsLesson.RoomName != "Lab 2" || physicsLesson.SlotName != "Period 1" || physicsLesson.StartTime != "08:00" {
+		t.Fatalf("unexpected lesson %+v", physicsLesson)
+	}
+	expectStatus(t, env.do(t, http.MethodPost, "/api/timetable/lessons", teacherToken, physics), http.StatusForbidden)
+	for _, invalid := range []models.TimetableLessonRequest{
+		{SubjectID: env.ib1Physics.ID, TeacherID: other.ID, RoomID: lab.ID, Day: 2, SlotID: first.ID},
+		{SubjectID: env.ib1Physics.ID, TeacherID: env.teacher.ID, RoomID: lab.ID, Day: 8, SlotID: first.ID},
+		{SubjectID: env.ib1Physics.ID, TeacherID: env.teacher.ID, RoomID: 999, Day: 2, SlotID: first.ID},
+		{SubjectID: env.ib1Physics.ID, TeacherID: env.teacher.ID, RoomID: lab.ID, Day: 2},
+	} {
+		expectStatus(t, env.do(t, http.MethodPost, "/api/timetable/lessons", adminToken, invalid), http.StatusBadRequest)
+	}
+
+	conflicts := func(req models.TimetableLessonRequest, method, path string) []models.TimetableConflict {
+		t.Helper()
+		rec := env.do(t, method, path, adminToken, req)
+		expectStatus(t, rec, http.StatusConflict)
+		var body struct {
+			Conflicts []models.TimetableConflict `json:"conflicts"`
+		}
+		decode(t, rec, &body)
+		return body.Conflicts
+	}
+	types := func(conflicts []models.TimetableConflict) string {
+		names := make([]string, len(conflicts))
+		for i, conflict := range conflicts {
+			names[i] = conflict.Type
+		}
+		return strings.Join(names, ",")
+	}
+
+	// The teacher, the lab and Ada are all busy with physics on Monday morning
+	clash := models.TimetableLessonRequest{SubjectID: env.ib1Math.ID, TeacherID: env.teacher.ID, RoomID: lab.ID, Day: 1, SlotID: first.ID}
+	if got := types(conflicts(clash, http.MethodPost, "/api/timetable/lessons")); got != "teacher,room,student" {
+		t.Fatalf("unexpected conflicts %s", got)
+	}
+	clash.TeacherID, clash.RoomID = other.ID, classroom.ID
+	found := conflicts(clash, http.MethodPost, "/api/timetable/lessons")
+	if len(found) != 1 || found[0].Type != models.ConflictStudent || found[0].LessonID != physicsLesson.ID || len(found[0].StudentIDs) != 1 || found[0].StudentIDs[0] != env.student.ID {
+		t.Fatalf("unexpected conflicts %+v", found)
+	}
+
+	// PIB mathematics shares no students, teacher or room with physics
+	pib := models.TimetableLessonRequest{SubjectID: env.pibMath.ID, TeacherID: other.ID, RoomID: classroom.ID, Day: 1, SlotID: first.ID}
+	expectStatus(t, env.do(t, http.MethodPost, "/api/timetable/lessons", adminToken, pib), http.StatusCreated)
+
+	clash.Day = 5
+	rec = env.do(t, http.MethodPost, "/api/timetable/lessons", adminToken, clash)
+	expectStatus(t, rec, http.StatusCreated)
+	var mathLesson models.TimetableLesson
+	decode(t, rec, &mathLesson)
+	mathPath := fmt.Sprintf("/api/timetable/lessons/%d", mathLesson.ID)
+
+	// Moving maths onto Monday morning clashes with both other lessons
+	clash.Day = 1
+	if got := types(conflicts(clash, http.MethodPut, mathPath)); got != "teacher,room,student" {
+		t.Fatalf("unexpected conflicts %s", got)
+	}
+	clash.SlotID = second.ID
+	rec = env.do(t, http.MethodPut, mathPath, adminToken, clash)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &mathLesson)
+	if mathLesson.Day != 1 || mathLesson.SlotName != "Period 2" || mathLesson.TeacherName != "other" {
+		t.Fatalf("unexpected lesson %+v", mathLesson)
+	}
+	expectStatus(t, env.do(t, http.MethodPut, "/api/timetable/lessons/999", adminToken, clash), http.StatusNotFound)
+
+	rec = env.do(t, http.MethodGet, fmt.Sprintf("/api/timetable/lessons?student_id=%d&day=1", env.student.ID), teacherToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var lessons []models.TimetableLesson
+	decode(t, rec, &lessons)
+	if len(lessons) != 2 || lessons[0].ID != physicsLesson.ID || lessons[1].ID != mathLesson.ID {
+		t.Fatalf("unexpected lessons %+v", lessons)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/timetable/lessons?day=8", teacherToken, nil), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/timetable/lessons?room_id=lab", teacherToken, nil), http.StatusBadRequest)
+
+	// Weekly timetables
+	timetable := func(path, token string) models.Timetable {
+		t.Helper()
+		rec := env.do(t, http.MethodGet, path, token, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var timetable models.Timetable
+		decode(t, rec, &timetable)
+		return timetable
+	}
+	week := timetable(fmt.Sprintf("/api/timetable/teachers/%d", other.ID), teacherToken)
+	if week.Name != "other" || len(week.Days) != 5 || len(week.Days[0].Lessons) != 2 || week.Days[0].Lessons[0].SubjectID != env.pibMath.ID {
+		t.Fatalf("unexpected timetable %+v", week)
+	}
+	week = timetable(fmt.Sprintf("/api/timetable/students/%d", env.student.ID), adminToken)
+	if week.Name != "Ada Lovelace" || len(week.Days[0].Lessons) != 2 || len(week.Days[4].Lessons) != 0 {
+		t.Fatalf("unexpected timetable %+v", week)
+	}
+	if mine := timetable("/api/timetable/me", studentToken); mine.StudentID != env.student.ID || len(mine.Days[0].Lessons) != 2 {
+		t.Fatalf("unexpected timetable %+v", mine)
+	}
+	if mine := timetable("/api/timetable/me", teacherToken); mine.TeacherID != env.teacher.ID || len(mine.Days[0].Lessons) != 1 {
+		t.Fatalf("unexpected timetable %+v", mine)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/timetable/me", adminToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, fmt.Sprintf("/api/timetable/teachers/%d", env.admin.ID), adminToken, nil), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/timetable/students/999", adminToken, nil), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodGet, fmt.Sprintf("/api/timetable/students/%d", env.student.ID), studentToken, nil), http.StatusForbidden)
+
+	// Students are not enrolled in a subject taught while they attend another
+	economics := env.addSubject(t, "IB1", "Economics", 3)
+	if err := env.store.AssignSubjectToTeacher(env.teacher.ID, economics.ID); err != nil {
+		t.Fatal(err)
+	}
+	economicsReq := models.TimetableLessonRequest{SubjectID: economics.ID, TeacherID: env.teacher.ID, RoomID: lab.ID, Day: 1, SlotID: second.ID}
+	rec = env.do(t, http.MethodPost, "/api/timetable/lessons", adminToken, economicsReq)
+	expectStatus(t, rec, http.StatusCreated)
+	var economicsLesson models.TimetableLesson
+	decode(t, rec, &economicsLesson)
+	economicsPath := fmt.Sprintf("/api/timetable/lessons/%d", economicsLesson.ID)
+	enrollPath := fmt.Sprintf("/api/admin/students/%d/enrollments", env.student.ID)
+	enrollEconomics := models.EnrollmentRequest{SubjectID: economics.ID, Level: models.LevelSL}
+	rec = env.do(t, http.MethodPost, enrollPath, adminToken, enrollEconomics)
+	expectStatus(t, rec, http.StatusConflict)
+	var refused struct {
+		Conflicts []models.TimetableConflict `json:"conflicts"`
+	}
+	decode(t, rec, &refused)
+	if found := refused.Conflicts; len(found) != 1 || found[0].Type != models.ConflictStudent || found[0].LessonID != mathLesson.ID ||
+		len(found[0].StudentIDs) != 1 || found[0].StudentIDs[0] != env.student.ID {
+		t.Fatalf("unexpected conflicts %+v", found)
+	}
+	economicsReq.Day = 2
+	expectStatus(t, env.do(t, http.MethodPut, economicsPath, adminToken, economicsReq), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodPost, enrollPath, adminToken, enrollEconomics), http.StatusCreated)
+	expectStatus(t, env.do(t, http.MethodDelete, economicsPath, adminToken, nil), http.StatusOK)
+
+	// Slots, rooms and subjects with scheduled lessons cannot be deleted
+	expectStatus(t, env.do(t, http.MethodDelete, secondPath, adminToken, nil), http.StatusConflict)
+	expectStatus(t, env.do(t, http.MethodDelete, classroomPath, adminToken, nil), http.StatusConflict)
+	if err := env.store.RemoveSubjectFromTeacher(env.teacher.ID, env.ib1Physics.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.store.UnenrollStudent(env.student.ID, env.ib1Physics.ID); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, env.do(t, http.MethodDelete, fmt.Sprintf("/api/subjects/%d", env.ib1Physics.ID), adminToken, nil), http.StatusConflict)
+
+	expectStatus(t, env.do(t, http.MethodDelete, mathPath, teacherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodDelete, mathPath, adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodDelete, mathPath, adminToken, nil), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodDelete, secondPath, adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodDelete, secondPath, adminToken, nil), http.StatusNotFound)
+	room := createRoom(models.RoomRequest{Name: "Spare"})
+	expectStatus(t, env.do(t, http.MethodDelete, fmt.Sprintf("/api/timetable/rooms/%d", room.ID), adminToken, nil), http.StatusOK)
+
+	// Exams are scheduled by administrators and listed by start time
+	paper1 := models.ExamRequest{SubjectID: env.ib1Physics.ID, Name: "Paper 1", StartsAt: "2025-05-12T09:00", DurationMinutes: 75, Location: "Sports hall"}
+	expectStatus(t, env.do(t, http.MethodPost, "/api/timetable/exams", teacherToken, paper1), http.StatusForbidden)
+	rec = env.do(t, http.MethodPost, "/api/timetable/exams", adminToken, paper1)
+	expectStatus(t, rec, http.StatusCreated)
+	var exam models.Exam
+	decode(t, rec, &exam)
+	if exam.SubjectName != "Physics" || exam.StartsAt != "2025-05-12T09:00" || exam.Location != "Sports hall" {
+		t.Fatalf("unexpected exam %+v", exam)
+	}
+	for _, bad := range []models.ExamRequest{
+		{SubjectID: env.ib1Physics.ID, Name: "Paper 1", StartsAt: "12/05/2025 09:00", DurationMinutes: 75},
+		{SubjectID: env.ib1Physics.ID, Name: "Paper 1", StartsAt: "2025-05-12T09:00"},
+		{SubjectID: 999, Name: "Paper 1", StartsAt: "2025-05-12T09:00", DurationMinutes: 75},
+		{SubjectID: env.ib1Physics.ID, StartsAt: "2025-05-12T09:00", DurationMinutes: 75},
+	} {
+		expectStatus(t, env.do(t, http.MethodPost, "/api/timetable/exams", adminToken, bad), http.StatusBadRequest)
+	}
+	paper2 := paper1
+	paper2.Name, paper2.StartsAt = "Paper 2", "2025-05-11T13:00"
+	expectStatus(t, env.do(t, http.MethodPost, "/api/timetable/exams", adminToken, paper2), http.StatusCreated)
+	rec = env.do(t, http.MethodGet, fmt.Sprintf("/api/timetable/exams?subject_id=%d", env.ib1Physics.ID), teacherToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var exams []models.Exam
+	decode(t, rec, &exams)
+	if len(exams) != 2 || exams[0].Name != "Paper 2" || exams[1].ID != exam.ID {
+		t.Fatalf("unexpected exams %+v", exams)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/timetable/exams?subject_id=x", adminToken, nil), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/timetable/exams", studentToken, nil), http.StatusForbidden)
+
+	examPath := fmt.Sprintf("/api/timetable/exams/%d", exam.ID)
+	paper1.StartsAt = "2025-05-13T09:00"
+	rec = env.do(t, http.MethodPut, examPath, adminToken, paper1)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &exam)
+	if exam.StartsAt != "2025-05-13T09:00" {
+		t.Fatalf("exam not moved: %+v", exam)
+	}
+	expectStatus(t, env.do(t, http.MethodPut, "/api/timetable/exams/999", adminToken, paper1), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodDelete, examPath, teacherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodDelete, examPath, adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodDelete, examPath, adminToken, nil), http.StatusNotFound)
+
+	// Deleting a teacher keeps the lessons, which then have no teacher
+	if err := env.store.DeleteTeacher(other.ID); err != nil {
+		t.Fatal(err)
+	}
+	rec = env.do(t, http.MethodGet, fmt.Sprintf("/api/timetable/lessons?room_id=%d", classroom.ID), adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	lessons = nil
+	decode(t, rec, &lessons)
+	if len(lessons) != 1 || lessons[0].TeacherID != 0 || lessons[0].TeacherName != "" {
+		t.Fatalf("unexpected lessons %+v", lessons)
+	}
+}
+
+func TestCalendarFeed(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+	teacherToken := env.token(t, "teacher")
+	studentToken := env.token(t, "student")
+
+	if err := env.store.AssignSubjectToTeacher(env.teacher.ID, env.ib1Physics.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := env.store.EnrollStudent(env.student.ID, &models.EnrollmentRequest{SubjectID: env.ib1Physics.ID, Level: models.LevelHL}); err != nil {
+		t.Fatal(err)
+	}
+	slot, err := env.store.CreateTimeSlot(&models.TimeSlotRequest{Name: "Period 1", StartTime: "08:00", EndTime: "08:50"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	room, err := env.store.CreateRoom(&models.RoomRequest{Name: "Lab 2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, conflicts, err := env.store.CreateTimetableLesson(&models.TimetableLessonRequest{
+		SubjectID: env.ib1Physics.ID, TeacherID: env.teacher.ID, RoomID: room.ID, Day: 3, SlotID: slot.ID,
+	})
+	if err != nil || len(conflicts) != 0 {
+		t.Fatal(err, conflicts)
+	}
+	scheme := &models.GradingSchemeRequest{Categories: []models.AssessmentCategory{{Name: "Exams", Weight: 100}}}
+	if _, err := env.store.SetGradingScheme(env.ib1Physics.ID, env.teacher.ID, scheme); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.store.CreateAssessment(env.ib1Physics.ID, env.teacher.ID, &models.AssessmentRequest{
+		Name: "Mock paper 1, mechanics", Category: "Exams", MaxMark: 40, Date: "2025-05-12",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.store.CreateExam(&models.ExamRequest{
+		SubjectID: env.ib1Physics.ID, Name: "Paper 1", StartsAt: "2025-05-14T09:00", DurationMinutes: 75, Location: "Sports hall\rEast entrance",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.store.CreateProject(&models.ProjectRequest{
+		Kind: models.ProjectIA, StudentID: env.student.ID, SubjectID: env.ib1Physics.ID, SupervisorID: env.teacher.ID,
+		Title:      "How does the length of a pendulum affect the rate at which its swing is damped by air resistance?",
+		Milestones: []models.MilestoneRequest{{Name: "Research question", DueDate: "2025-01-15"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	feed := func(token string) handlers.CalendarFeedResponse {
+		t.Helper()
+		rec := env.do(t, http.MethodGet, "/api/calendar/feed", token, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var feed handlers.CalendarFeedResponse
+		decode(t, rec, &feed)
+		return feed
+	}
+	fetch := func(token string) *httptest.ResponseRecorder {
+		return env.do(t, http.MethodGet, "/api/calendar/feeds/"+token+".ics", "", nil)
+	}
+
+	// The feed URL is stable until it is reset
+	studentFeed := feed(studentToken)
+	if studentFeed.URL != "https://api.edu.example.com/api/calendar/feeds/"+studentFeed.Token+".ics" {
+		t.Fatalf("unexpected feed URL %s", studentFeed.URL)
+	}
+	if again := feed(studentToken); again.Token != studentFeed.Token {
+		t.Fatalf("feed token changed: %s", again.Token)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/calendar/feed", adminToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/calendar/feed", "", nil), http.StatusUnauthorized)
+
+	rec := fetch(studentFeed.Token)
+	expectStatus(t, rec, http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"X-WR-CALNAME:WG Education: Ada Lovelace\r\n",
+		"RRULE:FREQ=WEEKLY;BYDAY=WE\r\n",
+		"SUMMARY:Physics (IB1)\r\n",
+		"LOCATION:Lab 2\r\n",
+		"DTSTART;VALUE=DATE:20250512\r\nDTEND;VALUE=DATE:20250513\r\n",
+		"SUMMARY:Physics (IB1): Mock paper 1\\, mechanics\r\n",
+		"CATEGORIES:Exams\r\n",
+		"DTSTART:20250514T090000\r\nDTEND:20250514T101500\r\n",
+		"SUMMARY:Physics (IB1): Paper 1\r\n",
+		"LOCATION:Sports hall\\nEast entrance\r\n",
+		"CATEGORIES:Exam\r\n",
+		"SUMMARY:Physics Internal Assessment: Research question\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("feed lacks %q:\n%s", want, body)
+		}
+	}
+	if !regexp.MustCompile(`DTSTART:\d{8}T080000\r\nDTEND:\d{8}T085000\r\n`).MatchString(body) {
+		t.Fatalf("feed lacks the lesson times:\n%s", body)
+	}
+	for _, line := range strings.Split(body, "\r\n") {
+		if len(line) > 75 {
+			t.Fatalf("line not folded: %q", line)
+		}
+		if strings.ContainsAny(line, "\r\n") {
+			t.Fatalf("line break inside a line: %q", line)
+		}
+	}
+	if unfolded := strings.ReplaceAll(body, "\r\n ", ""); !strings.Contains(unfolded, "DESCRIPTION:How does the length of a pendulum affect the rate at which its swing is damped by air resistance?\r\n") {
+		t.Fatalf("feed lacks the folded description:\n%s", body)
+	}
+
+	rec = fetch(feed(teacherToken).Token)
+	expectStatus(t, rec, http.StatusOK)
+	if body := rec.Body.String(); !strings.Contains(body, "SUMMARY:Physics Internal Assessment (Ada Lovelace): Research question\r\n") ||
+		!strings.Contains(body, "RRULE:FREQ=WEEKLY;BYDAY=WE\r\n") {
+		t.Fatalf("unexpected teacher feed:\n%s", body)
+	}
+
+	// Feed tokens and access tokens are not interchangeable, and tokens cannot be forged
+	expectStatus(t, fetch(studentToken), http.StatusNotFound)
+	expectStatus(t, fetch(studentFeed.Token+"x"), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/protected", studentFeed.Token, nil), http.StatusUnauthorized)
+	now := time.Now()
+	withAudience, err := jwt.NewWithClaims(jwt.SigningMethodHS256, handlers.Claims{
+		UserID: env.student.UserID,
+		Role:   models.RoleStudent,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "feed-like",
+			Audience:  jwt.ClaimStrings{"calendar"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/protected", withAudience, nil), http.StatusUnauthorized)
+
+	// Resetting the feed invalidates the old URL
+	rec = env.do(t, http.MethodPost, "/api/calendar/feed/reset", studentToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var reset handlers.CalendarFeedResponse
+	decode(t, rec, &reset)
+	if reset.Token == studentFeed.Token {
+		t.Fatal("reset kept the feed token")
+	}
+	expectStatus(t, fetch(studentFeed.Token), http.StatusNotFound)
+	expectStatus(t, fetch(reset.Token), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/calendar/feed/reset", adminToken, nil), http.StatusForbidden)
+
+	// Feeds of deactivated users stop working
+	teacherFeed := feed(teacherToken)
+	if err := env.store.SetTeacherActive(env.teacher.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, fetch(teacherFeed.Token), http.StatusNotFound)
+}
+
+func TestHomework(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+	teacherToken := env.token(t, "teacher")
+	studentToken := env.token(t, "student")
+
+	if _, err := env.store.CreateUser("other", "other_pw", "teacher"); err != nil {
+		t.Fatal(err)
+	}
+	otherToken := env.token(t, "other")
+	for _, subject := range []*models.Subject{env.ib1Physics, env.ib1Math} {
+		if err := env.store.AssignSubjectToTeacher(env.teacher.ID, subject.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := env.store.EnrollStudent(env.student.ID, &models.EnrollmentRequest{SubjectID: env.ib1Physics.ID, Level: models.LevelHL}); err != nil {
+		t.Fatal(err)
+	}
+
+	physicsPath := fmt.Sprintf("/api/homework/subjects/%d", env.ib1Physics.ID)
+	now := time.Now()
+	create := func(path string, req models.HomeworkRequest) models.Homework {
+		t.Helper()
+		rec := env.do(t, http.MethodPost, path, teacherToken, req)
+		expectStatus(t, rec, http.StatusCreated)
+		var homework models.Homework
+		decode(t, rec, &homework)
+		return homework
+	}
+	kinematics := create(physicsPath, models.HomeworkRequest{
+		Title:        "Kinematics problem set",
+		Instructions: "Questions 1 to 12",
+		DueAt:        now.Add(48 * time.Hour).Format(time.RFC3339),
+	})
+	if kinematics.SubjectName != "Physics" || kinematics.LatePolicy != models.LatePolicyAccept || kinematics.CreatedBy != env.teacher.ID {
+		t.Fatalf("unexpected homework %+v", kinematics)
+	}
+	closed := create(physicsPath, models.HomeworkRequest{Title: "Lab report", DueAt: now.Add(-time.Hour).Format(time.RFC3339), LatePolicy: "Reject"})
+	overdue := create(physicsPath, models.HomeworkRequest{Title: "Vectors", DueAt: now.Add(-2 * time.Hour).Format(time.RFC3339)})
+	proofs := create(fmt.Sprintf("/api/homework/subjects/%d", env.ib1Math.ID), models.HomeworkRequest{Title: "Proofs", DueAt: now.Add(time.Hour).Format(time.RFC3339)})
+
+	valid := models.HomeworkRequest{Title: "Waves", DueAt: now.Format(time.RFC3339)}
+	for _, invalid := range []models.HomeworkRequest{
+		{Title: " ", DueAt: valid.DueAt},
+		{Title: "Waves", DueAt: "tomorrow"},
+		{Title: "Waves", DueAt: valid.DueAt, LatePolicy: "maybe"},
+	} {
+		expectStatus(t, env.do(t, http.MethodPost, physicsPath, teacherToken, invalid), http.StatusBadRequest)
+	}
+	expectStatus(t, env.do(t, http.MethodPost, physicsPath, otherToken, valid), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPost, physicsPath, adminToken, valid), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPost, physicsPath, studentToken, valid), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/homework/subjects/9999", teacherToken, valid), http.StatusNotFound)
+
+	var assignments []models.Homework
+	rec := env.do(t, http.MethodGet, physicsPath, teacherToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &assignments)
+	if len(assignments) != 3 || assignments[0].ID != overdue.ID || assignments[2].ID != kinematics.ID {
+		t.Fatalf("expected the physics homework earliest due first, got %+v", assignments)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, physicsPath, adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, physicsPath, otherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, physicsPath, studentToken, nil), http.StatusForbidden)
+
+	// Teachers attach files; enrolled students download them
+	homeworkPath := fmt.Sprintf("/api/homework/%d", kinematics.ID)
+	sheet := []byte("%PDF-1.4 problem set")
+	rec = env.upload(t, homeworkPath+"/attachments", teacherToken, "sheet.pdf", sheet, nil)
+	expectStatus(t, rec, http.StatusCreated)
+	var attachment models.HomeworkFile
+	decode(t, rec, &attachment)
+	if attachment.Size != int64(len(sheet)) || attachment.Filename != "sheet.pdf" {
+		t.Fatalf("unexpected attachment %+v", attachment)
+	}
+	expectStatus(t, env.upload(t, homeworkPath+"/attachments", otherToken, "sheet.pdf", sheet, nil), http.StatusForbidden)
+	expectStatus(t, env.upload(t, homeworkPath+"/attachments", teacherToken, "empty.pdf", nil, nil), http.StatusBadRequest)
+
+	var homework models.Homework
+	rec = env.do(t, http.MethodGet, homeworkPath, studentToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &homework)
+	if len(homework.Attachments) != 1 || homework.Attachments[0].ID != attachment.ID {
+		t.Fatalf("expected the attachment, got %+v", homework)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, homeworkPath, otherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, fmt.Sprintf("/api/homework/%d", proofs.ID), studentToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/homework/9999", adminToken, nil), http.StatusNotFound)
+
+	attachmentPath := fmt.Sprintf("%s/attachments/%d", homeworkPath, attachment.ID)
+	rec = env.do(t, http.MethodGet, attachmentPath, studentToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if rec.Body.String() != string(sheet) || rec.Header().Get("Content-Disposition") != `attachment; filename="sheet.pdf"` {
+		t.Fatalf("unexpected download %q with %q", rec.Body.String(), rec.Header().Get("Content-Disposition"))
+	}
+	expectStatus(t, env.do(t, http.MethodGet, homeworkPath+"/attachments/9999", studentToken, nil), http.StatusNotFound)
+
+	// Students submit and resubmit; every attempt is kept
+	submissionsPath := homeworkPath + "/submissions"
+	rec = env.upload(t, submissionsPath, studentToken, "answers.pdf", []byte("first attempt"), map[string]string{"comment": "Question 7 was hard"})
+	expectStatus(t, rec, http.StatusCreated)
+	var first models.HomeworkSubmission
+	decode(t, rec, &first)
+	if first.Attempt != 1 || first.Late || first.Comment != "Question 7 was hard" || first.StudentName != "Ada Lovelace" {
+		t.Fatalf("unexpected submission %+v", first)
+	}
+	rec = env.upload(t, submissionsPath, studentToken, "answers-v2.pdf", []byte("second attempt"), nil)
+	expectStatus(t, rec, http.StatusCreated)
+	var second models.HomeworkSubmission
+	decode(t, rec, &second)
+	if second.Attempt != 2 || second.Late {
+		t.Fatalf("unexpected resubmission %+v", second)
+	}
+	expectStatus(t, env.upload(t, submissionsPath, studentToken, "answers.pdf", nil, nil), http.StatusBadRequest)
+	expectStatus(t, env.upload(t, submissionsPath, teacherToken, "answers.pdf", []byte("x"), nil), http.StatusForbidden)
+	expectStatus(t, env.upload(t, fmt.Sprintf("/api/homework/%d/submissions", proofs.ID), studentToken, "proof.pdf", []byte("x"), nil), http.StatusForbidden)
+	expectStatus(t, env.upload(t, "/api/homework/9999/submissions", studentToken, "answers.pdf", []byte("x"), nil), http.StatusNotFound)
+
+	// Late work is flagged, or refused when the homework rejects it
+	expectStatus(t, env.upload(t, fmt.Sprintf("/api/homework/%d/submissions", closed.ID), studentToken, "report.pdf", []byte("x"), nil), http.StatusConflict)
+	rec = env.upload(t, fmt.Sprintf("/api/homework/%d/submissions", overdue.ID), studentToken, "vectors.pdf", []byte("x"), nil)
+	expectStatus(t, rec, http.StatusCreated)
+	var late models.HomeworkSubmission
+	decode(t, rec, &late)
+	if !late.Late {
+		t.Fatalf("expected a late submission, got %+v", late)
+	}
+
+	var mine []models.StudentHomework
+	rec = env.do(t, http.MethodGet, "/api/homework/mine", studentToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &mine)
+	statuses := []string{}
+	for _, h := range mine {
+		statuses = append(statuses, h.Title+":"+h.Status)
+	}
+	if got := strings.Join(statuses, ","); got != "Vectors:late,Lab report:missing,Kinematics problem set:submitted" {
+		t.Fatalf("unexpected homework statuses %s", got)
+	}
+	if attempts := mine[2].Submissions; len(attempts) != 2 || attempts[0].ID != second.ID {
+		t.Fatalf("expected both attempts, latest first, got %+v", attempts)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/homework/mine", teacherToken, nil), http.StatusForbidden)
+
+	var submissions []models.HomeworkSubmission
+	rec = env.do(t, http.MethodGet, submissionsPath, teacherToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &submissions)
+	if len(submissions) != 2 || submissions[0].Attempt != 2 || submissions[1].Attempt != 1 {
+		t.Fatalf("expected both attempts, latest first, got %+v", submissions)
+	}
+	rec = env.do(t, http.MethodGet, fmt.Sprintf("%s?student_id=%d", submissionsPath, env.student.ID+1), adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	submissions = nil
+	decode(t, rec, &submissions)
+	if len(submissions) != 0 {
+		t.Fatalf("expected no submissions of another student, got %+v", submissions)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, submissionsPath+"?student_id=ada", teacherToken, nil), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodGet, submissionsPath, studentToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, submissionsPath, otherToken, nil), http.StatusForbidden)
+
+	filePath := fmt.Sprintf("/api/homework/submissions/%d/file", first.ID)
+	rec = env.do(t, http.MethodGet, filePath, teacherToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if rec.Body.String() != "first attempt" || rec.Header().Get("Content-Disposition") != `attachment; filename="answers.pdf"` {
+		t.Fatalf("unexpected download %q with %q", rec.Body.String(), rec.Header().Get("Content-Disposition"))
+	}
+	expectStatus(t, env.do(t, http.MethodGet, filePath, studentToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodGet, filePath, otherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/homework/submissions/9999/file", teacherToken, nil), http.StatusNotFound)
+
+	// Only teachers of the subject give feedback
+	feedbackPath := fmt.Sprintf("/api/homework/submissions/%d/feedback", second.ID)
+	rec = env.do(t, http.MethodPut, feedbackPath, teacherToken, models.HomeworkFeedbackRequest{Feedback: "Check your units in question 7"})
+	expectStatus(t, rec, http.StatusOK)
+	var reviewed models.HomeworkSubmission
+	decode(t, rec, &reviewed)
+	if reviewed.Feedback != "Check your units in question 7" || reviewed.FeedbackBy != env.teacher.ID || reviewed.FeedbackAt == nil {
+		t.Fatalf("unexpected feedback %+v", reviewed)
+	}
+	expectStatus(t, env.do(t, http.MethodPut, feedbackPath, teacherToken, models.HomeworkFeedbackRequest{Feedback: " "}), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPut, feedbackPath, otherToken, models.HomeworkFeedbackRequest{Feedback: "Hi"}), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPut, feedbackPath, studentToken, models.HomeworkFeedbackRequest{Feedback: "Hi"}), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPut, "/api/homework/submissions/9999/feedback", teacherToken, models.HomeworkFeedbackRequest{Feedback: "Hi"}), http.StatusNotFound)
+
+	// Moving the due time earlier flags the earlier attempts late
+	update := models.HomeworkRequest{Title: "Kinematics", DueAt: now.Add(-24 * time.Hour).Format(time.RFC3339)}
+	rec = env.do(t, http.MethodPut, homeworkPath, teacherToken, update)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &homework)
+	if homework.Title != "Kinematics" || len(homework.Attachments) != 1 {
+		t.Fatalf("unexpected homework %+v", homework)
+	}
+	rec = env.do(t, http.MethodGet, submissionsPath, studentToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &submissions)
+	if len(submissions) != 2 || !submissions[0].Late || !submissions[1].Late {
+		t.Fatalf("expected both attempts to be late, got %+v", submissions)
+	}
+	expectStatus(t, env.do(t, http.MethodPut, homeworkPath, otherToken, update), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPut, homeworkPath, teacherToken, models.HomeworkRequest{Title: "Kinematics"}), http.StatusBadRequest)
+
+	// Subjects with homework cannot be deleted
+	expectStatus(t, env.do(t, http.MethodDelete, fmt.Sprintf("/api/subjects/%d", env.ib1Math.ID), adminToken, nil), http.StatusConflict)
+
+	expectStatus(t, env.do(t, http.MethodDelete, attachmentPath, otherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodDelete, attachmentPath, teacherToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodDelete, attachmentPath, teacherToken, nil), http.StatusNotFound)
+
+	// Deleting homework removes the stored files of its submissions
+	stored, err := env.store.GetHomeworkSubmission(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, env.do(t, http.MethodDelete, homeworkPath, otherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodDelete, homeworkPath, teacherToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodDelete, homeworkPath, teacherToken, nil), http.StatusNotFound)
+	if _, err := env.handler.Files.Open(stored.StorageKey); err != storage.ErrNotFound {
+		t.Fatalf("expected the submitted file to be deleted, got %v", err)
+	}
+}
+
+func TestGuardians(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+
+	if _, _, err := env.store.EnrollStudent(env.student.ID, &models.EnrollmentRequest{SubjectID: env.ib1Physics.ID, Level: models.LevelHL}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.store.AssignSubjectToTeacher(env.teacher.ID, env.ib1Physics.ID); err != nil {
+		t.Fatal(err)
+	}
+	lesson := &models.LessonRequest{
+		SubjectID: env.ib1Physics.ID,
+		Date:      "2026-09-01",
+		Records:   []models.AttendanceEntry{{StudentID: env.student.ID, Status: models.AttendanceAbsent}},
+	}
+	if _, err := env.store.CreateLesson(env.teacher.ID, lesson); err != nil {
+		t.Fatal(err)
+	}
+	other, err := env.store.CreateStudent(&models.StudentRequest{FirstName: "Alan", LastName: "Turing", Grade: "IB1", Username: "alan", Password: "alan_pw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := models.GuardianRequest{
+		FirstName: "Anne",
+		LastName:  "Byron",
+		Email:     "anne@example.com",
+		Phone:     "+44 20 7946 0000",
+		Username:  "byron",
+		Password:  "byron_pw",
+	}
+	expectStatus(t, env.do(t, http.MethodPost, "/api/admin/guardians", env.token(t, "teacher"), create), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/admin/guardians", adminToken, models.GuardianRequest{Username: "x"}), http.StatusBadRequest)
+	weak := create
+	weak.Password = "short"
+	expectStatus(t, env.do(t, http.MethodPost, "/api/admin/guardians", adminToken, weak), http.StatusBadRequest)
+
+	rec := env.do(t, http.MethodPost, "/api/admin/guardians", adminToken, create)
+	expectStatus(t, rec, http.StatusCreated)
+	var guardian models.Guardian
+	decode(t, rec, &guardian)
+	if !guardian.Active || guardian.Phone != create.Phone || len(guardian.Children) != 0 {
+		t.Fatalf("unexpected guardian: %+v", guardian)
+	}
+	expectStatus(t, env.do(t, http.MethodPost, "/api/admin/guardians", adminToken, create), http.StatusConflict)
+
+	guardianPath := fmt.Sprintf("/api/admin/guardians/%d", guardian.ID)
+	create.Phone = ""
+	rec = env.do(t, http.MethodPut, guardianPath, adminToken, create)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &guardian)
+	if guardian.Phone != "" {
+		t.Fatalf("phone was not cleared: %+v", guardian)
+	}
+	expectStatus(t, env.do(t, http.MethodPut, "/api/admin/guardians/9999", adminToken, create), http.StatusNotFound)
+
+	// Admins link guardians to students
+	linksPath := guardianPath + "/students"
+	rec = env.do(t, http.MethodPost, linksPath, adminToken, models.GuardianLinkRequest{StudentID: env.student.ID, Relationship: " mother "})
+	expectStatus(t, rec, http.StatusCreated)
+	var child models.GuardianChild
+	decode(t, rec, &child)
+	if child.StudentID != env.student.ID || child.FirstName != "Ada" || child.Relationship != "mother" {
+		t.Fatalf("unexpected link: %+v", child)
+	}
+	expectStatus(t, env.do(t, http.MethodPost, linksPath, adminToken, models.GuardianLinkRequest{StudentID: env.student.ID}), http.StatusConflict)
+	expectStatus(t, env.do(t, http.MethodPost, linksPath, adminToken, models.GuardianLinkRequest{StudentID: 9999}), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodPost, linksPath, adminToken, models.GuardianLinkRequest{}), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/admin/guardians/9999/students", adminToken, models.GuardianLinkRequest{StudentID: env.student.ID}), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodPost, linksPath, adminToken, models.GuardianLinkRequest{StudentID: other.ID}), http.StatusCreated)
+
+	rec = env.do(t, http.MethodGet, guardianPath, adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &guardian)
+	if len(guardian.Children) != 2 || guardian.Children[0].FirstName != "Ada" {
+		t.Fatalf("expected Ada and Alan ordered by last name, got %+v", guardian.Children)
+	}
+
+	unlinkPath := fmt.Sprintf("%s/%d", linksPath, other.ID)
+	expectStatus(t, env.do(t, http.MethodDelete, unlinkPath, adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodDelete, unlinkPath, adminToken, nil), http.StatusNotFound)
+
+	rec = env.do(t, http.MethodGet, "/api/admin/guardians", adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var guardians []models.Guardian
+	decode(t, rec, &guardians)
+	if len(guardians) != 1 || len(guardians[0].Children) != 1 {
+		t.Fatalf("unexpected guardians: %+v", guardians)
+	}
+
+	// The guardian sees only their own children
+	guardianToken := env.token(t, "byron")
+	rec = env.do(t, http.MethodGet, "/api/guardian/children", guardianToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var children []models.GuardianChild
+	decode(t, rec, &children)
+	if len(children) != 1 || children[0].StudentID != env.student.ID {
+		t.Fatalf("unexpected children: %+v", children)
+	}
+
+	childPath := fmt.Sprintf("/api/guardian/children/%d", env.student.ID)
+	otherPath := fmt.Sprintf("/api/guardian/children/%d", other.ID)
+	for _, suffix := range []string{"", "/subjects", "/attendance", "/grades"} {
+		expectStatus(t, env.do(t, http.MethodGet, otherPath+suffix, guardianToken, nil), http.StatusForbidden)
+		expectStatus(t, env.do(t, http.MethodGet, childPath+suffix, env.token(t, "student"), nil), http.StatusForbidden)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/guardian/children/x", guardianToken, nil), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/students", guardianToken, nil), http.StatusForbidden)
+
+	rec = env.do(t, http.MethodGet, childPath, guardianToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var student models.Student
+	decode(t, rec, &student)
+	if student.LastName != "Lovelace" {
+		t.Fatalf("unexpected student: %+v", student)
+	}
+
+	rec = env.do(t, http.MethodGet, childPath+"/subjects", guardianToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var enrollments []models.Enrollment
+	decode(t, rec, &enrollments)
+	if len(enrollments) != 1 || enrollments[0].SubjectID != env.ib1Physics.ID {
+		t.Fatalf("unexpected subjects: %+v", enrollments)
+	}
+
+	rec = env.do(t, http.MethodGet, childPath+"/attendance", guardianToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var attendance handlers.StudentAttendanceResponse
+	decode(t, rec, &attendance)
+	if attendance.Overall.Lessons != 1 || attendance.Overall.Absent != 1 {
+		t.Fatalf("unexpected attendance: %+v", attendance)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, childPath+"/attendance?from=x", guardianToken, nil), http.StatusBadRequest)
+
+	rec = env.do(t, http.MethodGet, childPath+"/grades", guardianToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var grades handlers.ChildGradesResponse
+	decode(t, rec, &grades)
+	if len(grades.Subjects) != 1 || grades.Subjects[0].SubjectID != env.ib1Physics.ID || grades.Subjects[0].Level != models.LevelHL {
+		t.Fatalf("unexpected grades: %+v", grades)
+	}
+
+	// Deleting a student removes the link; deleting the guardian removes the account
+	if err := env.store.DeleteStudent(env.student.ID); err != nil {
+		t.Fatal(err)
+	}
+	rec = env.do(t, http.MethodGet, "/api/guardian/children", guardianToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	children = nil
+	decode(t, rec, &children)
+	if len(children) != 0 {
+		t.Fatalf("link survived the student: %+v", children)
+	}
+
+	expectStatus(t, env.do(t, http.MethodDelete, guardianPath, adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodDelete, guardianPath, adminToken, nil), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodGet, guardianPath, adminToken, nil), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/guardian/children", guardianToken, nil), http.StatusUnauthorized)
+}
+
+func TestMe(t *testing.T) {
+	env := newTestEnv(t)
+	studentToken := env.token(t, "student")
+	teacherToken := env.token(t, "teacher")
+	adminToken := env.token(t, "admin")
+
+	if err := env.store.AssignSubjectToTeacher(env.teacher.ID, env.ib1Physics.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.store.CreateStudent(&models.StudentRequest{FirstName: "Alan", LastName: "Turing", Email: "alan@example.com", Grade: "IB1", Username: "alan", Password: "alan_pw"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := env.do(t, http.MethodGet, "/api/me", studentToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var me handlers.MeResponse
+	decode(t, rec, &me)
+	if me.User.ID != env.student.UserID || me.Student == nil || me.Student.ID != env.student.ID || me.Teacher != nil {
+		t.Fatalf("unexpected student profile: %+v", me)
+	}
+	if !slices.Contains(me.Permissions, models.PermHomeworkSubmit) {
+		t.Errorf("student permissions = %v", me.Permissions)
+	}
+
+	rec = env.do(t, http.MethodGet, "/api/me", teacherToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	me = handlers.MeResponse{}
+	decode(t, rec, &me)
+	if me.Teacher == nil || len(me.Teacher.Subjects) != 1 || me.Teacher.Subjects[0].ID != env.ib1Physics.ID || me.Student != nil {
+		t.Fatalf("unexpected teacher profile: %+v", me)
+	}
+
+	// Students change their display name and email, not their official record.
+	// A new email needs the current password and is reported to the old address.
+	update := models.ProfileRequest{DisplayName: " Countess ", Email: "countess@example.com"}
+	expectStatus(t, env.do(t, http.MethodPut, "/api/me", studentToken, update), http.StatusBadRequest)
+	update.CurrentPassword = "wrong"
+	expectStatus(t, env.do(t, http.MethodPut, "/api/me", studentToken, update), http.StatusForbidden)
+	update.CurrentPassword = "student_pw"
+	rec = env.do(t, http.MethodPut, "/api/me", studentToken, update)
+	expectStatus(t, rec, http.StatusOK)
+	me = handlers.MeResponse{}
+	decode(t, rec, &me)
+	if me.User.DisplayName != "Countess" || me.Student.Email != "countess@example.com" || me.Student.LastName != "Lovelace" {
+		t.Fatalf("unexpected profile after update: %+v %+v", me.User, me.Student)
+	}
+	env.handler.Wait()
+	if sent := env.outbox.take(); len(sent) != 1 || sent[0].To != "ada@example.com" || !strings.Contains(sent[0].Body, "countess@example.com") {
+		t.Fatalf("unexpected email change notice: %+v", sent)
+	}
+	rec = env.do(t, http.MethodPut, "/api/me", studentToken, models.ProfileRequest{DisplayName: "Ada", Email: "Countess@example.com"})
+	expectStatus(t, rec, http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodPut, "/api/me", studentToken, models.ProfileRequest{Email: "alan@example.com", CurrentPassword: "student_pw"}), http.StatusConflict)
+	expectStatus(t, env.do(t, http.MethodPut, "/api/me", studentToken, models.ProfileRequest{Email: "not an email"}), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPut, "/api/me", studentToken, models.ProfileRequest{DisplayName: "Ada"}), http.StatusBadRequest)
+
+	// Teachers without a profile get one; admins have no email
+	rec = env.do(t, http.MethodPut, "/api/me", teacherToken, models.ProfileRequest{Email: "teacher@example.com", CurrentPassword: "teacher_pw"})
+	expectStatus(t, rec, http.StatusOK)
+	me = handlers.MeResponse{}
+	decode(t, rec, &me)
+	if me.Teacher == nil || me.Teacher.Email != "teacher@example.com" {
+		t.Fatalf("unexpected teacher after update: %+v", me.Teacher)
+	}
+	expectStatus(t, env.do(t, http.MethodPut, "/api/me", adminToken, models.ProfileRequest{Email: "admin@example.com"}), http.StatusBadRequest)
+	rec = env.do(t, http.MethodPut, "/api/me", adminToken, models.ProfileRequest{DisplayName: "Head of School"})
+	expectStatus(t, rec, http.StatusOK)
+	me = handlers.MeResponse{}
+	decode(t, rec, &me)
+	if me.User.DisplayName != "Head of School" || me.Student != nil || me.Teacher != nil || me.Guardian != nil {
+		t.Fatalf("unexpected admin profile: %+v", me)
+	}
+
+	// Changing the password needs the current one and ends every session
+	session := env.login(t, "student", "student_pw")
+	passwordPath := "/api/me/password"
+	expectStatus(t, env.do(t, http.MethodPost, passwordPath, studentToken, handlers.ChangePasswordRequest{CurrentPassword: "wrong", NewPassword: "new_password"}), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPost, passwordPath, studentToken, handlers.ChangePasswordRequest{CurrentPassword: "student_pw"}), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPost, passwordPath, studentToken, handlers.ChangePasswordRequest{CurrentPassword: "student_pw", NewPassword: "student_pw"}), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPost, passwordPath, studentToken, handlers.ChangePasswordRequest{CurrentPassword: "student_pw", NewPassword: "short"}), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPost, passwordPath, studentToken, handlers.ChangePasswordRequest{CurrentPassword: "student_pw", NewPassword: strings.Repeat("x", models.MaxPasswordLength+1)}), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPost, passwordPath, studentToken, handlers.ChangePasswordRequest{CurrentPassword: "student_pw", NewPassword: "new_password"}), http.StatusOK)
+
+	expectStatus(t, env.do(t, http.MethodGet, "/api/me", studentToken, nil), http.StatusUnauthorized)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/token/refresh", "", handlers.RefreshRequest{RefreshToken: session.RefreshToken}), http.StatusUnauthorized)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/login", "", handlers.LoginRequest{Username: "student", Password: "student_pw"}), http.StatusUnauthorized)
+	env.login(t, "student", "new_password")
+}
+
+func TestPasswordReset(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+	session := env.login(t, "student", "student_pw")
+	resetToken := regexp.MustCompile(`https://edu\.example\.com/reset-password\?token=([A-Za-z0-9_-]+)`)
+
+	// Unknown addresses get the same answer as known ones, without mail
+	expectStatus(t, env.do(t, http.MethodPost, "/api/password/forgot", "", handlers.ForgotPasswordRequest{Email: "nobody@example.com"}), http.StatusAccepted)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/password/forgot", "", handlers.ForgotPasswordRequest{}), http.StatusBadRequest)
+	env.handler.Wait()
+	if sent := env.outbox.take(); len(sent) != 0 {
+		t.Fatalf("mail sent for unknown address: %+v", sent)
+	}
+
+	expectStatus(t, env.do(t, http.MethodPost, "/api/password/forgot", "", handlers.ForgotPasswordRequest{Email: " ADA@example.com "}), http.StatusAccepted)
+	env.handler.Wait()
+	sent := env.outbox.take()
+	if len(sent) != 1 || sent[0].To != "ADA@example.com" || !strings.Contains(sent[0].Body, `"student"`) {
+		t.Fatalf("unexpected reset mail: %+v", sent)
+	}
+	match := resetToken.FindStringSubmatch(sent[0].Body)
+	if match == nil {
+		t.Fatalf("no reset link in %q", sent[0].Body)
+	}
+
+	// Tokens are single-use and end the sessions started with the old password
+	reset := handlers.ResetPasswordRequest{Token: match[1], NewPassword: "reset_pw"}
+	expectStatus(t, env.do(t, http.MethodPost, "/api/password/reset", "", handlers.ResetPasswordRequest{Token: match[1]}), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/password/reset", "", handlers.ResetPasswordRequest{Token: match[1], NewPassword: "short"}), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/password/reset", "", reset), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/password/reset", "", reset), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/protected", session.Token, nil), http.StatusUnauthorized)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/login", "", handlers.LoginRequest{Username: "student", Password: "student_pw"}), http.StatusUnauthorized)
+	env.login(t, "student", "reset_pw")
+
+	// Requests are limited per email address, whatever its case, and per client address
+	forgot := func(email string) *httptest.ResponseRecorder {
+		return env.do(t, http.MethodPost, "/api/password/forgot", "", handlers.ForgotPasswordRequest{Email: email})
+	}
+	expectStatus(t, forgot("ada@example.com"), http.StatusAccepted)
+	expectStatus(t, forgot("Ada@Example.com"), http.StatusAccepted)
+	rec := forgot("ada@example.com")
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("no Retry-After header")
+	}
+	env.handler.Wait()
+	if sent := env.outbox.take(); len(sent) != 2 {
+		t.Fatalf("sent %d reset mails, want 2", len(sent))
+	}
+	for i := 0; i < 16; i++ {
+		expectStatus(t, forgot(fmt.Sprintf("someone%d@example.com", i)), http.StatusAccepted)
+	}
+	expectStatus(t, forgot("grace@example.com"), http.StatusTooManyRequests)
+	expectStatus(t, forgot(strings.Repeat("a", 250)+"@example.com"), http.StatusBadRequest)
+	env.handler.Wait()
+
+	// Expired tokens are refused
+	if err := env.store.CreatePasswordResetToken(env.student.UserID, models.HashToken("expired"), time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, env.do(t, http.MethodPost, "/api/password/reset", "", handlers.ResetPasswordRequest{Token: "expired", NewPassword: "other_pw"}), http.StatusBadRequest)
+
+	// A forced reset ends the sessions; login then hands out a reset token only
+	teacher := env.login(t, "teacher", "teacher_pw")
+	path := fmt.Sprintf("/api/admin/users/%d/force-password-reset", env.teacher.ID)
+	expectStatus(t, env.do(t, http.MethodPost, path, teacher.Token, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPost, path, adminToken, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/admin/users/9999/force-password-reset", adminToken, nil), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/protected", teacher.Token, nil), http.StatusUnauthorized)
+
+	rec = env.do(t, http.MethodPost, "/api/login", "", handlers.LoginRequest{Username: "teacher", Password: "teacher_pw"})
+	expectStatus(t, rec, http.StatusForbidden)
+	var required handlers.PasswordChangeRequiredResponse
+	decode(t, rec, &required)
+	if required.ResetToken == "" || required.ExpiresIn != int(handlers.DefaultPasswordResetTTL.Seconds()) {
+		t.Fatalf("unexpected forced reset response: %+v", required)
+	}
+	expectStatus(t, env.do(t, http.MethodPost, "/api/login", "", handlers.LoginRequest{Username: "teacher", Password: "wrong"}), http.StatusUnauthorized)
+
+	expectStatus(t, env.do(t, http.MethodPost, "/api/password/reset", "", handlers.ResetPasswordRequest{Token: required.ResetToken, NewPassword: "teacher_pw2"}), http.StatusOK)
+	if login := env.login(t, "teacher", "teacher_pw2"); login.User.MustChangePassword {
+		t.Error("must_change_password still set after reset")
+	}
+}
+
+func TestLoginProtection(t *testing.T) {
+	env := newTestEnv(t)
+	adminToken := env.token(t, "admin")
+	teacherToken := env.token(t, "teacher")
+	login := func(username, password string) *httptest.ResponseRecorder {
+		return env.do(t, http.MethodPost, "/api/login", "", handlers.LoginRequest{Username: username, Password: password})
+	}
+
+	// Failures beyond the free ones make each attempt wait, doubling
+	env.handler.LoginPolicy = models.LoginPolicy{Window: time.Hour, FreeFailures: 1, Delay: time.Minute, MaxDelay: time.Hour}
+	expectStatus(t, login("ghost", "guess1"), http.StatusUnauthorized)
+	expectStatus(t, login("ghost", "guess2"), http.StatusUnauthorized)
+	rec := login("ghost", "guess3")
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+	expectStatus(t, login("admin", "admin_pw"), http.StatusOK)
+
+	// Too many failures of a username refuse it until they leave the window
+	env.handler.LoginPolicy = models.LoginPolicy{Window: time.Hour, MaxUserFailures: 3}
+	expectStatus(t, login("ghost", "guess4"), http.StatusUnauthorized)
+	rec = login("ghost", "guess5")
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if got, _ := strconv.Atoi(rec.Header().Get("Retry-After")); got < 3590 || got > 3600 {
+		t.Errorf("Retry-After = %d, want about an hour", got)
+	}
+
+	// Repeated failures lock an account, even against the correct password
+	env.handler.LoginPolicy = models.LoginPolicy{Window: time.Hour, LockoutThreshold: 3, LockoutDuration: time.Hour}
+	for i := 0; i < 3; i++ {
+		expectStatus(t, login("teacher", "wrong"), http.StatusUnauthorized)
+	}
+	expectStatus(t, login("teacher", "teacher_pw"), http.StatusLocked)
+
+	unlockPath := fmt.Sprintf("/api/admin/users/%d/unlock", env.teacher.ID)
+	expectStatus(t, env.do(t, http.MethodPost, unlockPath, teacherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/admin/users/9999/unlock", adminToken, nil), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodPost, unlockPath, adminToken, nil), http.StatusOK)
+
+	// Unlocking and logging in restart the count
+	expectStatus(t, login("teacher", "wrong"), http.StatusUnauthorized)
+	if session := env.login(t, "teacher", "teacher_pw"); session.User.LockedUntil != nil {
+		t.Errorf("teacher still locked until %v", session.User.LockedUntil)
+	}
+	expectStatus(t, login("teacher", "wrong"), http.StatusUnauthorized)
+	expectStatus(t, login("teacher", "wrong"), http.StatusUnauthorized)
+	env.login(t, "teacher", "teacher_pw")
+
+	// The summary shows where the failures came from
+	rec = env.do(t, http.MethodGet, "/api/admin/login-attempts/summary?hours=1&limit=1", adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var summary models.LoginFailureSummary
+	decode(t, rec, &summary)
+	if summary.Failures != 9 || summary.Blocked != 3 || len(summary.ByUsername) != 1 || summary.ByUsername[0].Key != "teacher" ||
+		summary.ByUsername[0].Failures != 6 || len(summary.ByIP) != 1 || summary.ByIP[0].Failures != 9 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/login-attempts/summary?limit=0", adminToken, nil), http.StatusBadRequest)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/login-attempts/summary", teacherToken, nil), http.StatusForbidden)
+
+	rec = env.do(t, http.MethodGet, "/api/admin/login-attempts?filter[username]=teacher&filter[outcome]=unlocked", adminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var attempts models.ListResult[*models.LoginAttempt]
+	decode(t, rec, &attempts)
+	if attempts.Total != 1 || attempts.Data[0].IPAddress != summary.ByIP[0].Key {
+		t.Fatalf("unexpected unlock attempts: %+v", attempts)
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/login-attempts?filter[password]=x", adminToken, nil), http.StatusBadRequest)
+
+	// Too many failures from one address refuse every login from it
+	env.handler.LoginPolicy = models.LoginPolicy{Window: time.Hour, MaxIPFailures: summary.ByIP[0].Failures + 1}
+	expectStatus(t, login("mallory", "guess"), http.StatusUnauthorized)
+	expectStatus(t, login("student", "student_pw"), http.StatusTooManyRequests)
+
+	// The password of a deactivated account is no successful login, so the
+	// count of failures carries on across it
+	env.handler.LoginPolicy = models.LoginPolicy{Window: time.Hour, LockoutThreshold: 2, LockoutDuration: time.Hour}
+	expectStatus(t, login("teacher", "wrong"), http.StatusUnauthorized)
+	if err := env.store.SetTeacherActive(env.teacher.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, login("teacher", "teacher_pw"), http.StatusForbidden)
+	if err := env.store.SetTeacherActive(env.teacher.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, login("teacher", "wrong"), http.StatusUnauthorized)
+	expectStatus(t, login("teacher", "teacher_pw"), http.StatusLocked)
+}
+
+// lookupUsers wraps a user store to fail lookups by username and to count
+// checks of dummy passwords
+type lookupUsers struct {
+	models.UserStore
+	err     error
+	dummies int
+}
+
+func (u *lookupUsers) GetUserByUsername(username string) (*models.User, error) {
+	if u.err != nil {
+		return nil, u.err
+	}
+	return u.UserStore.GetUserByUsername(username)
+}
+
+func (u *lookupUsers) VerifyDummyPassword(password string) {
+	u.dummies++
+	u.UserStore.VerifyDummyPassword(password)
+}
+
+func TestLoginLookup(t *testing.T) {
+	env := newTestEnv(t)
+	users := &lookupUsers{UserStore: env.store}
+	env.handler.Users = users
+	login := func(username, password string) *httptest.ResponseRecorder {
+		return env.do(t, http.MethodPost, "/api/login", "", handlers.LoginRequest{Username: username, Password: password})
+	}
+
+	// Unknown usernames check a password like known ones do
+	expectStatus(t, login("ghost", "guess"), http.StatusUnauthorized)
+	expectStatus(t, login("teacher", "wrong"), http.StatusUnauthorized)
+	if users.dummies != 1 {
+		t.Errorf("dummy password checks = %d, want 1", users.dummies)
+	}
+
+	// A failing lookup is a server error and not a failed login
+	users.err = errors.New("connection refused")
+	expectStatus(t, login("teacher", "teacher_pw"), http.StatusInternalServerError)
+	failures, err := env.store.CountLoginFailures("teacher", "192.0.2.1", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failures.Username != 1 || failures.IP != 2 {
+		t.Errorf("unexpected failures after a failed lookup: %+v", failures)
+	}
+}
+
+func TestMFA(t *testing.T) {
+	env := newTestEnv(t)
+	env.handler.LoginPolicy = models.LoginPolicy{Window: time.Hour}
+	teacherToken := env.token(t, "teacher")
+	step := totp.Step(time.Now())
+	code := func(secret string, step int64) string {
+		t.Helper()
+		c, err := totp.Code(secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	challenge := func(username string) string {
+		t.Helper()
+		rec := env.do(t, http.MethodPost, "/api/login", "", handlers.LoginRequest{Username: username, Password: username + "_pw"})
+		expectStatus(t, rec, http.StatusAccepted)
+		var resp handlers.MFAChallengeResponse
+		decode(t, rec, &resp)
+		if !resp.MFARequired || resp.MFAToken == "" || resp.ExpiresIn != int(handlers.MFAChallengeTTL.Seconds()) {
+			t.Fatalf("unexpected challenge: %+v", resp)
+		}
+		return resp.MFAToken
+	}
+	loginMFA := func(mfaToken, code string) *httptest.ResponseRecorder {
+		return env.do(t, http.MethodPost, "/api/login/mfa", "", handlers.MFALoginRequest{MFAToken: mfaToken, Code: code})
+	}
+	enrol := func(token, username string) (string, []string) {
+		t.Helper()
+		rec := env.do(t, http.MethodPost, "/api/me/mfa", token, handlers.MFAPasswordRequest{Password: username + "_pw"})
+		expectStatus(t, rec, http.StatusOK)
+		var enrolment handlers.MFAEnrollmentResponse
+		decode(t, rec, &enrolment)
+		rec = env.do(t, http.MethodPost, "/api/me/mfa/confirm", token, handlers.MFACodeRequest{Code: code(enrolment.Secret, step)})
+		expectStatus(t, rec, http.StatusOK)
+		var recovery handlers.RecoveryCodesResponse
+		decode(t, rec, &recovery)
+		return enrolment.Secret, recovery.RecoveryCodes
+	}
+	status := func(token string) handlers.MFAStatusResponse {
+		t.Helper()
+		rec := env.do(t, http.MethodGet, "/api/me/mfa", token, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var resp handlers.MFAStatusResponse
+		decode(t, rec, &resp)
+		return resp
+	}
+
+	// Enrolment needs the password, and login only changes once it is confirmed
+	expectStatus(t, env.do(t, http.MethodGet, "/api/me/mfa", env.token(t, "student"), nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/me/mfa", teacherToken, handlers.MFAPasswordRequest{Password: "wrong"}), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/me/mfa/confirm", teacherToken, handlers.MFACodeRequest{Code: "123456"}), http.StatusBadRequest)
+	rec := env.do(t, http.MethodPost, "/api/me/mfa", teacherToken, handlers.MFAPasswordRequest{Password: "teacher_pw"})
+	expectStatus(t, rec, http.StatusOK)
+	var enrolment handlers.MFAEnrollmentResponse
+	decode(t, rec, &enrolment)
+	if !strings.HasPrefix(enrolment.ProvisioningURI, "otpauth://totp/WG%20Education:teacher?") ||
+		!strings.Contains(enrolment.ProvisioningURI, "secret="+enrolment.Secret) {
+		t.Fatalf("unexpected provisioning URI %q", enrolment.ProvisioningURI)
+	}
+	if s := status(teacherToken); s.Enabled || !s.Pending || s.Required || s.Session {
+		t.Fatalf("unexpected pending status: %+v", s)
+	}
+	env.login(t, "teacher", "teacher_pw")
+
+	secret := enrolment.Secret
+	expectStatus(t, env.do(t, http.MethodPost, "/api/me/mfa/confirm", teacherToken, handlers.MFACodeRequest{Code: code(secret, step+10)}), http.StatusForbidden)
+	rec = env.do(t, http.MethodPost, "/api/me/mfa/confirm", teacherToken, handlers.MFACodeRequest{Code: code(secret, step)})
+	expectStatus(t, rec, http.StatusOK)
+	var recovery handlers.RecoveryCodesResponse
+	decode(t, rec, &recovery)
+	if len(recovery.RecoveryCodes) != models.RecoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(recovery.RecoveryCodes), models.RecoveryCodeCount)
+	}
+	expectStatus(t, env.do(t, http.MethodPost, "/api/me/mfa/confirm", teacherToken, handlers.MFACodeRequest{Code: code(secret, step)}), http.StatusConflict)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/me/mfa", teacherToken, handlers.MFAPasswordRequest{Password: "teacher_pw"}), http.StatusConflict)
+
+	// The password now only earns a challenge, which is not an access token,
+	// and codes cannot be used twice. A challenge takes a single code, right
+	// or wrong.
+	mfaToken := challenge("teacher")
+	expectStatus(t, env.do(t, http.MethodGet, "/api/protected", mfaToken, nil), http.StatusUnauthorized)
+	expectStatus(t, loginMFA(mfaToken, ""), http.StatusBadRequest)
+	expectStatus(t, loginMFA("forged", code(secret, step+1)), http.StatusUnauthorized)
+	expectStatus(t, loginMFA(mfaToken, code(secret, step)), http.StatusUnauthorized)
+	expectStatus(t, loginMFA(mfaToken, code(secret, step+1)), http.StatusUnauthorized)
+	mfaToken = challenge("teacher")
+	rec = loginMFA(mfaToken, code(secret, step+1))
+	expectStatus(t, rec, http.StatusOK)
+	var session handlers.LoginResponse
+	decode(t, rec, &session)
+	expectStatus(t, loginMFA(mfaToken, recovery.RecoveryCodes[1]), http.StatusUnauthorized)
+	expectStatus(t, loginMFA(challenge("teacher"), code(secret, step+1)), http.StatusUnauthorized)
+
+	// Recovery codes work once, however they are typed
+	typed := strings.ToUpper(strings.ReplaceAll(recovery.RecoveryCodes[0], "-", " "))
+	expectStatus(t, loginMFA(challenge("teacher"), typed), http.StatusOK)
+	expectStatus(t, loginMFA(challenge("teacher"), recovery.RecoveryCodes[0]), http.StatusUnauthorized)
+	if s := status(session.Token); !s.Enabled || s.Pending || !s.Session || s.RecoveryCodesLeft != models.RecoveryCodeCount-1 {
+		t.Fatalf("unexpected enabled status: %+v", s)
+	}
+
+	// Of concurrent requests with one challenge, only one has its code checked
+	mfaToken = challenge("teacher")
+	statuses := make(chan int, 2)
+	for _, recoveryCode := range recovery.RecoveryCodes[2:4] {
+		go func(recoveryCode string) {
+			statuses <- loginMFA(mfaToken, recoveryCode).Code
+		}(recoveryCode)
+	}
+	if first, second := <-statuses, <-statuses; first+second != http.StatusOK+http.StatusUnauthorized {
+		t.Fatalf("concurrent logins with one challenge answered %d and %d", first, second)
+	}
+
+	// Refreshed sessions keep the claim
+	rec = env.do(t, http.MethodPost, "/api/token/refresh", "", handlers.RefreshRequest{RefreshToken: session.RefreshToken})
+	expectStatus(t, rec, http.StatusOK)
+	var refreshed handlers.TokenResponse
+	decode(t, rec, &refreshed)
+	if !status(refreshed.Token).Session {
+		t.Error("refreshed session lost the mfa claim")
+	}
+
+	// Changes need a two-factor session and the password
+	regenerate := handlers.MFAPasswordRequest{Password: "teacher_pw"}
+	expectStatus(t, env.do(t, http.MethodPost, "/api/me/mfa/recovery-codes", teacherToken, regenerate), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/me/mfa/recovery-codes", session.Token, handlers.MFAPasswordRequest{Password: "wrong"}), http.StatusForbidden)
+	rec = env.do(t, http.MethodPost, "/api/me/mfa/recovery-codes", session.Token, regenerate)
+	expectStatus(t, rec, http.StatusOK)
+	var replaced handlers.RecoveryCodesResponse
+	decode(t, rec, &replaced)
+	if len(replaced.RecoveryCodes) != models.RecoveryCodeCount || replaced.RecoveryCodes[0] == recovery.RecoveryCodes[0] {
+		t.Fatalf("unexpected replacement codes: %+v", replaced)
+	}
+	expectStatus(t, loginMFA(challenge("teacher"), recovery.RecoveryCodes[2]), http.StatusUnauthorized)
+
+	expectStatus(t, env.do(t, http.MethodPost, "/api/me/mfa/disable", teacherToken, regenerate), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/me/mfa/disable", session.Token, regenerate), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/me/mfa/disable", session.Token, regenerate), http.StatusBadRequest)
+	teacherToken = env.token(t, "teacher")
+	enrol(teacherToken, "teacher")
+
+	// Roles requiring two-factor authentication are sent to enrol, and
+	// sensitive routes refuse their sessions without it
+	env.handler.MFARequiredRoles = []string{"admin"}
+	admin := env.login(t, "admin", "admin_pw")
+	if !admin.MFAEnrollmentRequired {
+		t.Error("admin login does not ask for enrolment")
+	}
+	rec = env.do(t, http.MethodGet, "/api/admin/roles", admin.Token, nil)
+	expectStatus(t, rec, http.StatusForbidden)
+	if !strings.Contains(rec.Body.String(), `"mfa_required":true`) {
+		t.Errorf("unexpected refusal %s", rec.Body.String())
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/students", admin.Token, nil), http.StatusOK)
+
+	adminSecret, _ := enrol(admin.Token, "admin")
+	rec = loginMFA(challenge("admin"), code(adminSecret, step+1))
+	expectStatus(t, rec, http.StatusOK)
+	admin = handlers.LoginResponse{}
+	decode(t, rec, &admin)
+	if admin.MFAEnrollmentRequired {
+		t.Error("enrolled admin asked to enrol")
+	}
+	expectStatus(t, env.do(t, http.MethodGet, "/api/admin/roles", admin.Token, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodPost, "/api/me/mfa/disable", admin.Token, handlers.MFAPasswordRequest{Password: "admin_pw"}), http.StatusForbidden)
+	if s := status(admin.Token); !s.Required || !s.Enabled {
+		t.Fatalf("unexpected admin status: %+v", s)
+	}
+
+	// Admins reset the second factor of users who lost it
+	resetPath := fmt.Sprintf("/api/admin/users/%d/mfa/reset", env.teacher.ID)
+	expectStatus(t, env.do(t, http.MethodPost, resetPath, teacherToken, nil), http.StatusForbidden)
+	expectStatus(t, env.do(t, http.MethodPost, resetPath, admin.Token, nil), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodPost, resetPath, admin.Token, nil), http.StatusNotFound)
+	expectStatus(t, env.do(t, http.MethodGet, "/api/protected", teacherToken, nil), http.StatusUnauthorized)
+	env.login(t, "teacher", "teacher_pw")
+
+	// Wrong codes count as failed logins and lock the account
+	env.handler.LoginPolicy = models.LoginPolicy{Window: time.Hour, LockoutThreshold: 2, LockoutDuration: time.Hour}
+	challenges := []string{challenge("admin"), challenge("admin"), challenge("admin")}
+	expectStatus(t, loginMFA(challenges[0], "000000x"), http.StatusUnauthorized)
+	expectStatus(t, loginMFA(challenges[1], "abcd-efgh"), http.StatusUnauthorized)
+	expectStatus(t, loginMFA(challenges[2], code(adminSecret, step+1)), http.StatusLocked)
+}
+
+func TestEvaluateDiploma(t *testing.T) {
+	grades := func(levels string, values ...int) []models.DiplomaSubjectGrade {
+		subjects := make([]models.DiplomaSubjectGrade, len(values))
+		for i, v := range values {
+			subjects[i] = models.DiplomaSubjectGrade{SubjectID: i + 1, Level: models.LevelSL, Grade: v}
+			if levels[i] == 'H' {
+				subjects[i].Level = models.LevelHL
+			}
+		}
+		return subjects
+	}
+	complete, incomplete := true, false
+	passedCore := models.DiplomaCore{TOK: "C", EE: "C", CASComplete: &complete}
+
+	tests := []struct {
+		name     string
+		subjects []models.DiplomaSubjectGrade
+		core     models.DiplomaCore
+		failed   string // Rule expected to fail, empty if the diploma is on track
+	}{
+		{"on track", grades("HHHSSS", 5, 5, 5, 4, 4, 4), passedCore, ""},
+		{"too few points", grades("HHHSSS", 4, 4, 4, 4, 4, 3), models.DiplomaCore{TOK: "D", EE: "D", CASComplete: &complete}, "min_points"},
+		{"bonus reaches 24", grades("HHHSSS", 4, 4, 4, 4, 4, 3), models.DiplomaCore{TOK: "A", EE: "D", CASComplete: &complete}, ""},
+		{"grade 1", grades("HHHSSS", 7, 7, 7, 7, 7, 1), passedCore, "no_grade_1"},
+		{"three grade 2s", grades("HHHSSS", 7, 7, 2, 7, 2, 2), passedCore, "grade_2_count"},
+		{"four grades of 3 or below", grades("HHHSSS", 7, 7, 3, 3, 3, 3), passedCore, "grade_3_count"},
+		{"HL below 12", grades("HHHSSS", 3, 4, 4, 7, 7, 7), passedCore, "hl_points"},
+		{"SL below 9", grades("HHHSSS", 7, 7, 7, 3, 3, 2), passedCore, "sl_points"},
+		{"four HL, best three count", grades("HHHHSS", 3, 3, 4, 4, 7, 7), passedCore, "hl_points"},
+		{"four HL, two SL need 5", grades("HHHHSS", 7, 7, 7, 3, 3, 2), passedCore, ""},
+		{"N for TOK", grades("HHHSSS", 5, 5, 5, 4, 4, 4), models.DiplomaCore{TOK: "N", EE: "A", CASComplete: &complete}, "no_n"},
+		{"CAS not met", grades("HHHSSS", 5, 5, 5, 4, 4, 4), models.DiplomaCore{TOK: "A", EE: "A", CASComplete: &incomplete}, "cas"},
+		{"fails before all grades are known", grades("HHHS", 1, 5, 5, 5), models.DiplomaCore{}, "no_grade_1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := models.EvaluateDiploma(tt.subjects, tt.core)
+			var failed []string
+			for _, r := range status.Rules {
+				if r.Result == models.RuleFailed {
+					failed = append(failed, r.Rule)
+				}
+			}
+			if tt.failed == "" {
+				if status.Status != models.DiplomaOnTrack {
+					t.Fatalf("expected on track, got %s with %v", status.Status, status.Rules)
+				}
+				return
+			}
+			if status.Status != models.DiplomaFailing || len(failed) != 1 || failed[0] != tt.failed {
+				t.Fatalf("expected only %s to fail, got %s with %v", tt.failed, status.Status, failed)
+			}
+		})
+	}
+}
+
+// timeZones are server zones east and west of UTC, in which times written
+// as wall-clock time instead of instants land hours away
+var timeZones = []*time.Location{
+	time.FixedZone("UTC+10", 10*60*60),
+	time.FixedZone("UTC-10", -10*60*60),
+}
+
+// inTimeZone runs the rest of a test with time.Local set to zone
+func inTimeZone(t *testing.T, zone *time.Location) {
+	t.Helper()
+	local := time.Local
+	time.Local = zone
+	t.Cleanup(func() { time.Local = local })
+}
+
+// TestPostgres checks against a real database what the in-memory store cannot:
+// the migrations, keyset cursors, row locks, conflict queries, attempt counts,
+// stored times on servers outside UTC, moving drafts out of the database and
+// encrypted two-factor secrets. Run it with WG_TEST_DATABASE_URL
+// set to a scratch database, e.g.
+// postgres://wg:wg@localhost:5432/wg_test?sslmode=disable.
+func TestPostgres(t *testing.T) {
+	env := newPostgresEnv(t)
+	db := env.store.(*models.DB)
+	adminToken := env.token(t, "admin")
+	ip := "192.0.2.1"
+
+	t.Run("migrations", func(t *testing.T) {
+		migrator, err := migrations.New(db.DB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statuses, err := migrator.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(statuses) != len(migrator.Migrations()) {
+			t.Fatalf("%d statuses for %d migrations", len(statuses), len(migrator.Migrations()))
+		}
+		for _, status := range statuses {
+			if status.AppliedAt == nil {
+				t.Errorf("migration %04d_%s not applied", status.Version, status.Name)
+			}
+		}
+		if applied, err := migrator.Up(); err != nil || len(applied) != 0 {
+			t.Errorf("second up applied %d migrations: %v", len(applied), err)
+		}
+
+		// Status only reads, so a database never migrated stays untouched
+		if _, err := db.Exec("ALTER TABLE schema_migrations RENAME TO schema_migrations_saved"); err != nil {
+			t.Fatal(err)
+		}
+		statuses, err = migrator.Status()
+		if err != nil || len(statuses) != len(migrator.Migrations()) || statuses[0].AppliedAt != nil {
+			t.Errorf("status without schema_migrations = %+v, %v", statuses, err)
+		}
+		var created bool
+		if err := db.QueryRow("SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&created); err != nil || created {
+			t.Errorf("status created schema_migrations: %v", err)
+		}
+		if _, err := db.Exec("ALTER TABLE schema_migrations_saved RENAME TO schema_migrations"); err != nil {
+			t.Fatal(err)
+		}
+
+		// The seed runs on every boot
+		for i := 0; i < 2; i++ {
+			if err := migrations.Seed(db.DB); err != nil {
+				t.Fatalf("seed run %d: %v", i+1, err)
+			}
+		}
+
+		// Every deployment gets a group 1 subject, without which no IB student
+		// completes a diploma. The environment empties the catalogue, so the
+		// migration adding them is reapplied first.
+		all := migrator.Migrations()
+		for i, m := range all {
+			if m.Name != "group_1_subjects" {
+				continue
+			}
+			if _, err := migrator.Down(len(all) - i); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := migrator.Up(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		defer db.Exec("DELETE FROM subjects")
+		for _, grade := range []string{"IB1", "IB2"} {
+			var levels string
+			err := db.QueryRow(
+				"SELECT array_to_string(levels, ',') FROM subjects WHERE grade = $1 AND subject_group = 1",
+				grade,
+			).Scan(&levels)
+			if err != nil {
+				t.Fatalf("%s group 1 subject: %v", grade, err)
+			}
+			if levels != "HL,SL" {
+				t.Errorf("%s group 1 subject offered at %q", grade, levels)
+			}
+		}
+	})
+
+	t.Run("keyset cursors", func(t *testing.T) {
+		for i, name := range []string{"Hopper", "Turing", "Hopper", "Knuth", "Hopper"} {
+			_, err := env.store.CreateStudent(&models.StudentRequest{
+				FirstName: "Test",
+				LastName:  name,
+				Email:     fmt.Sprintf("pg%d@example.com", i),
+				Grade:     []string{"PIB", "IB2"}[i%2],
+				Username:  fmt.Sprintf("pg%d", i),
+				Password:  "pw",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		list := func(query string) models.ListResult[models.Student] {
+			t.Helper()
+			rec := env.do(t, http.MethodGet, "/api/admin/students"+query, adminToken, nil)
+			expectStatus(t, rec, http.StatusOK)
+			var result models.ListResult[models.Student]
+			decode(t, rec, &result)
+			return result
+		}
+
+		// Walking by cursor visits every student once in the order of a single page,
+		// including runs of equal sort values split across pages
+		for _, sort := range []string{"", "last_name", "-last_name", "grade", "-created_at"} {
+			want := list("?limit=100&sort=" + sort)
+			if want.Total != 6 || len(want.Data) != 6 {
+				t.Fatalf("sort %q: unexpected single page %+v", sort, want)
+			}
+			var walked []models.Student
+			page := list("?limit=2&sort=" + sort)
+			for len(walked) < 10 {
+				walked = append(walked, page.Data...)
+				if page.NextCursor == "" {
+					break
+				}
+				page = list("?limit=2&sort=" + sort + "&cursor=" + url.QueryEscape(page.NextCursor))
+			}
+			if len(walked) != len(want.Data) {
+				t.Fatalf("sort %q: walked %d students, want %d", sort, len(walked), len(want.Data))
+			}
+			for i := range walked {
+				if walked[i].ID != want.Data[i].ID {
+					t.Errorf("sort %q: student %d is %d, want %d", sort, i, walked[i].ID, want.Data[i].ID)
+				}
+			}
+		}
+	})
+
+	t.Run("enrollment locks", func(t *testing.T) {
+		subjects := []*models.Subject{
+			env.addSubject(t, "IB1", "English A Language and Literature", 1),
+			env.addSubject(t, "IB1", "Spanish B", 2),
+			env.addSubject(t, "IB1", "Economics", 3),
+			env.ib1Physics,
+			env.ib1Math,
+			env.addSubject(t, "IB1", "Visual Arts", 6),
+		}
+
+		// Concurrent enrollments are validated one at a time, so only four are taken at HL
+		path := fmt.Sprintf("/api/admin/students/%d/enrollments", env.student.ID)
+		codes := make([]int, len(subjects))
+		var wg sync.WaitGroup
+		for i, subject := range subjects {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rec := env.do(t, http.MethodPost, path, adminToken, models.EnrollmentRequest{SubjectID: subject.ID, Level: models.LevelHL})
+				codes[i] = rec.Code
+			}()
+		}
+		wg.Wait()
+
+		created := 0
+		for _, code := range codes {
+			switch code {
+			case http.StatusCreated:
+				created++
+			case http.StatusBadRequest:
+			default:
+				t.Errorf("unexpected enrollment status %d", code)
+			}
+		}
+		enrollments, err := env.store.GetStudentEnrollments(env.student.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created != models.DiplomaMaxHL || len(enrollments) != models.DiplomaMaxHL {
+			t.Errorf("created %d and stored %d enrollments, want %d", created, len(enrollments), models.DiplomaMaxHL)
+		}
+	})
+
+	t.Run("timetable conflicts", func(t *testing.T) {
+		other, err := env.store.CreateUser("other", "other_pw", "teacher")
+		if err != nil {
+			t.Fatal(err)
+		}
+		chemistry := env.addSubject(t, "PIB", "Chemistry", 0)
+		biology := env.addSubject(t, "PIB", "Biology", 0)
+		pib, err := env.store.CreateStudent(&models.StudentRequest{
+			FirstName: "Grace", LastName: "Hopper", Email: "grace@example.com", Grade: "PIB", Username: "grace", Password: "pw",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, subject := range []*models.Subject{chemistry, biology} {
+			if err := env.store.AssignSubjectToTeacher(env.teacher.ID, subject.ID); err != nil {
+				t.Fatal(err)
+			}
+			if err := env.store.AssignSubjectToTeacher(other.ID, subject.ID); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := env.store.EnrollStudent(pib.ID, &models.EnrollmentRequest{SubjectID: subject.ID}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		slot, err := env.store.CreateTimeSlot(&models.TimeSlotRequest{Name: "Period 1", StartTime: "08:00", EndTime: "08:50"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lab, err := env.store.CreateRoom(&models.RoomRequest{Name: "Lab 1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		classroom, err := env.store.CreateRoom(&models.RoomRequest{Name: "Room 1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lesson := models.TimetableLessonRequest{SubjectID: chemistry.ID, TeacherID: env.teacher.ID, RoomID: lab.ID, Day: 1, SlotID: slot.ID}
+		rec := env.do(t, http.MethodPost, "/api/timetable/lessons", adminToken, lesson)
+		expectStatus(t, rec, http.StatusCreated)
+		var chemistryLesson models.TimetableLesson
+		decode(t, rec, &chemistryLesson)
+
+		conflicts := func(req models.TimetableLessonRequest, method, path string) string {
+			t.Helper()
+			rec := env.do(t, method, path, adminToken, req)
+			expectStatus(t, rec, http.StatusConflict)
+			var body struct {
+				Conflicts []models.TimetableConflict `json:"conflicts"`
+			}
+			decode(t, rec, &body)
+			var found []string
+			for _, conflict := range body.Conflicts {
+				if conflict.LessonID != chemistryLesson.ID {
+					t.Errorf("conflict with lesson %d, want %d", conflict.LessonID, chemistryLesson.ID)
+				}
+				found = append(found, conflict.Type)
+			}
+			return strings.Join(found, ",")
+		}
+
+		clash := models.TimetableLessonRequest{SubjectID: biology.ID, TeacherID: env.teacher.ID, RoomID: lab.ID, Day: 1, SlotID: slot.ID}
+		if got := conflicts(clash, http.MethodPost, "/api/timetable/lessons"); got != "teacher,room,student" {
+			t.Errorf("unexpected conflicts %s", got)
+		}
+		clash.TeacherID, clash.RoomID, clash.Day = other.ID, classroom.ID, 2
+		rec = env.do(t, http.MethodPost, "/api/timetable/lessons", adminToken, clash)
+		expectStatus(t, rec, http.StatusCreated)
+		var biologyLesson models.TimetableLesson
+		decode(t, rec, &biologyLesson)
+
+		// A lesson does not conflict with itself when it is moved
+		clash.Day = 1
+		if got := conflicts(clash, http.MethodPut, fmt.Sprintf("/api/timetable/lessons/%d", biologyLesson.ID)); got != "student" {
+			t.Errorf("unexpected conflicts %s", got)
+		}
+		clash.Day = 3
+		expectStatus(t, env.do(t, http.MethodPut, fmt.Sprintf("/api/timetable/lessons/%d", biologyLesson.ID), adminToken, clash), http.StatusOK)
+	})
+
+	t.Run("session revocation across time zones", func(t *testing.T) {
+		for _, zone := range timeZones {
+			t.Run(zone.String(), func(t *testing.T) {
+				inTimeZone(t, zone)
+
+				// Sessions issued before the revocation end and later ones work
+				before := env.login(t, "student", "student_pw")
+				path := fmt.Sprintf("/api/admin/users/%d/revoke-sessions", env.student.UserID)
+				expectStatus(t, env.do(t, http.MethodPost, path, adminToken, nil), http.StatusOK)
+				time.Sleep(1100 * time.Millisecond) // Revocations cover tokens issued in the same second
+				after := env.login(t, "student", "student_pw")
+
+				expectStatus(t, env.do(t, http.MethodGet, "/api/protected", before.Token, nil), http.StatusUnauthorized)
+				expectStatus(t, env.do(t, http.MethodGet, "/api/protected", after.Token, nil), http.StatusOK)
+				expectStatus(t, env.do(t, http.MethodPost, "/api/token/refresh", "", handlers.RefreshRequest{RefreshToken: after.RefreshToken}), http.StatusOK)
+
+				// Last, as a revoked refresh token counts as reuse and ends every session
+				expectStatus(t, env.do(t, http.MethodPost, "/api/token/refresh", "", handlers.RefreshRequest{RefreshToken: before.RefreshToken}), http.StatusUnauthorized)
+			})
+		}
+	})
+
+	t.Run("attempt counting", func(t *testing.T) {
+		env.handler.LoginPolicy = models.LoginPolicy{Window: time.Hour, MaxUserFailures: 3}
+		login := func(password string) int {
+			return env.do(t, http.MethodPost, "/api/login", "", handlers.LoginRequest{Username: "teacher", Password: password}).Code
+		}
+
+		// A successful login restarts the count of the username but not of the address
+		for _, try := range []struct {
+			password string
+			want     int
+		}{
+			{"wrong", http.StatusUnauthorized},
+			{"wrong", http.StatusUnauthorized},
+			{"teacher_pw", http.StatusOK},
+			{"wrong", http.StatusUnauthorized},
+			{"wrong", http.StatusUnauthorized},
+			{"wrong", http.StatusUnauthorized},
+			{"teacher_pw", http.StatusTooManyRequests},
+		} {
+			if got := login(try.password); got != try.want {
+				t.Fatalf("login with %q: status = %d, want %d", try.password, got, try.want)
+			}
+		}
+		since := time.Now().Add(-time.Hour)
+		failures, err := db.CountLoginFailures("teacher", ip, since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failures.Username != 3 || failures.IP != 5 || failures.UsernameFirst.After(failures.UsernameLast) || failures.IPFirst.After(failures.UsernameFirst) {
+			t.Errorf("unexpected login failures %+v", failures)
+		}
+
+		// Reset requests are counted apart from failed logins
+		for i := 0; i < 3; i++ {
+			expectStatus(t, env.do(t, http.MethodPost, "/api/password/forgot", "", handlers.ForgotPasswordRequest{Email: "ada@example.com"}), http.StatusAccepted)
+		}
+		expectStatus(t, env.do(t, http.MethodPost, "/api/password/forgot", "", handlers.ForgotPasswordRequest{Email: "ADA@example.com"}), http.StatusTooManyRequests)
+		requests, err := db.CountPasswordResetRequests("ada@example.com", ip, since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if requests.Username != 3 || requests.IP != 3 {
+			t.Errorf("unexpected reset requests %+v", requests)
+		}
+		if failures, err = db.CountLoginFailures("teacher", ip, since); err != nil || failures.Username != 3 || failures.IP != 5 {
+			t.Errorf("login failures after reset requests: %+v, %v", failures, err)
+		}
+		env.handler.Wait()
+	})
+
+	t.Run("lockouts across time zones", func(t *testing.T) {
+		for i, zone := range timeZones {
+			t.Run(zone.String(), func(t *testing.T) {
+				inTimeZone(t, zone)
+				username := fmt.Sprintf("zone%d", i)
+				if _, err := env.store.CreateUser(username, "zone_pw", "teacher"); err != nil {
+					t.Fatal(err)
+				}
+				login := func(password string) *httptest.ResponseRecorder {
+					return env.do(t, http.MethodPost, "/api/login", "", handlers.LoginRequest{Username: username, Password: password})
+				}
+
+				// A failure delays the next attempt by a minute, not by the zone's offset
+				env.handler.LoginPolicy = models.LoginPolicy{Window: time.Hour, Delay: time.Minute}
+				expectStatus(t, login("wrong"), http.StatusUnauthorized)
+				rec := login("zone_pw")
+				expectStatus(t, rec, http.StatusTooManyRequests)
+				if got, _ := strconv.Atoi(rec.Header().Get("Retry-After")); got < 55 || got > 60 {
+					t.Errorf("Retry-After = %d, want about a minute", got)
+				}
+
+				// A lockout lasts its duration
+				env.handler.LoginPolicy = models.LoginPolicy{Window: time.Hour, LockoutThreshold: 2, LockoutDuration: time.Hour}
+				expectStatus(t, login("wrong"), http.StatusUnauthorized)
+				rec = login("zone_pw")
+				expectStatus(t, rec, http.StatusLocked)
+				var locked struct {
+					LockedUntil time.Time `json:"locked_until"`
+				}
+				decode(t, rec, &locked)
+				if d := time.Until(locked.LockedUntil); d < 59*time.Minute || d > time.Hour {
+					t.Errorf("locked for %v, want an hour", d)
+				}
+			})
+		}
+	})
+
+	t.Run("reset tokens across time zones", func(t *testing.T) {
+		env.handler.LoginPolicy = models.LoginPolicy{Window: time.Hour}
+		env.handler.PasswordResetTTL = 2 * time.Second
+		for i, zone := range timeZones {
+			t.Run(zone.String(), func(t *testing.T) {
+				inTimeZone(t, zone)
+				username := fmt.Sprintf("reset%d", i)
+				user, err := env.store.CreateUser(username, "reset_pw", "teacher")
+				if err != nil {
+					t.Fatal(err)
+				}
+				expectStatus(t, env.do(t, http.MethodPost, fmt.Sprintf("/api/admin/users/%d/force-password-reset", user.ID), adminToken, nil), http.StatusOK)
+				resetToken := func() string {
+					t.Helper()
+					rec := env.do(t, http.MethodPost, "/api/login", "", handlers.LoginRequest{Username: username, Password: "reset_pw"})
+					expectStatus(t, rec, http.StatusForbidden)
+					var resp handlers.PasswordChangeRequiredResponse
+					decode(t, rec, &resp)
+					return resp.ResetToken
+				}
+
+				// Tokens work for their lifetime, not for it plus or minus the zone's offset
+				expired := resetToken()
+				time.Sleep(2100 * time.Millisecond)
+				expectStatus(t, env.do(t, http.MethodPost, "/api/password/reset", "", handlers.ResetPasswordRequest{Token: expired, NewPassword: "new_reset_pw"}), http.StatusBadRequest)
+				expectStatus(t, env.do(t, http.MethodPost, "/api/password/reset", "", handlers.ResetPasswordRequest{Token: resetToken(), NewPassword: "new_reset_pw"}), http.StatusOK)
+				env.login(t, username, "new_reset_pw")
+			})
+		}
+	})
+
+	t.Run("project drafts moved to storage", func(t *testing.T) {
+		// A draft uploaded while drafts were kept in the database
+		var projectID, draftID int
+		err := db.QueryRow(`
+			INSERT INTO projects (kind, student_id, subject_id) VALUES ('ee', $1, $2) RETURNING id`,
+			env.student.ID, env.ib1Physics.ID,
+		).Scan(&projectID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := []byte("%PDF-1.4 legacy draft")
+		err = db.QueryRow(`
+			INSERT INTO project_drafts (project_id, filename, content_type, size, data)
+			VALUES ($1, 'legacy.pdf', 'application/pdf', $2, $3) RETURNING id`,
+			projectID, len(content), content,
+		).Scan(&draftID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for want := 1; want >= 0; want-- {
+			if moved, err := db.MoveProjectDraftsToStorage(env.handler.Files); err != nil || moved != want {
+				t.Fatalf("moved %d drafts, want %d: %v", moved, want, err)
+			}
+		}
+		var inDatabase bool
+		if err := db.QueryRow("SELECT data IS NOT NULL FROM project_drafts WHERE id = $1", draftID).Scan(&inDatabase); err != nil || inDatabase {
+			t.Fatalf("draft content still in the database: %v", err)
+		}
+
+		projectPath := fmt.Sprintf("/api/projects/%d", projectID)
+		rec := env.do(t, http.MethodGet, fmt.Sprintf("%s/drafts/%d", projectPath, draftID), adminToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+		if rec.Body.String() != string(content) {
+			t.Fatalf("downloaded %q, want %q", rec.Body.String(), content)
+		}
+
+		draft, err := db.GetProjectDraft(projectID, draftID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectStatus(t, env.do(t, http.MethodDelete, projectPath, adminToken, nil), http.StatusOK)
+		if _, err := env.handler.Files.Open(draft.StorageKey); err != storage.ErrNotFound {
+			t.Fatalf("expected the draft file to be deleted, got %v", err)
+		}
+	})
+
+	t.Run("two-factor secrets encrypted", func(t *testing.T) {
+		env.handler.LoginPolicy = models.LoginPolicy{Window: time.Hour}
+		user, err := env.store.CreateUser("mfa_user", "mfa_user_pw", "teacher")
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored := func() string {
+			t.Helper()
+			var secret string
+			if err := db.QueryRow("SELECT secret FROM user_mfa WHERE user_id = $1", user.ID).Scan(&secret); err != nil {
+				t.Fatal(err)
+			}
+			return secret
+		}
+		step := totp.Step(time.Now())
+		code := func(secret string, step int64) string {
+			t.Helper()
+			c, err := totp.Code(secret, step)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return c
+		}
+
+		rec := env.do(t, http.MethodPost, "/api/me/mfa", env.token(t, "mfa_user"), handlers.MFAPasswordRequest{Password: "mfa_user_pw"})
+		expectStatus(t, rec, http.StatusOK)
+		var enrolment handlers.MFAEnrollmentResponse
+		decode(t, rec, &enrolment)
+		if secret := stored(); !strings.HasPrefix(secret, "v1:") || strings.Contains(secret, enrolment.Secret) {
+			t.Fatalf("secret stored as %q", secret)
+		}
+		expectStatus(t, env.do(t, http.MethodPost, "/api/me/mfa/confirm", env.token(t, "mfa_user"), handlers.MFACodeRequest{Code: code(enrolment.Secret, step)}), http.StatusOK)
+
+		// Secrets stored in plain text before are encrypted in place
+		if _, err := db.Exec("UPDATE user_mfa SET secret = $1 WHERE user_id = $2", enrolment.Secret, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		for want := 1; want >= 0; want-- {
+			if encrypted, err := db.EncryptMFASecrets(); err != nil || encrypted != want {
+				t.Fatalf("encrypted %d secrets, want %d: %v", encrypted, want, err)
+			}
+		}
+		if secret := stored(); !strings.HasPrefix(secret, "v1:") {
+			t.Fatalf("secret still stored as %q", secret)
+		}
+
+		rec = env.do(t, http.MethodPost, "/api/login", "", handlers.LoginRequest{Username: "mfa_user", Password: "mfa_user_pw"})
+		expectStatus(t, rec, http.StatusAccepted)
+		var challenge handlers.MFAChallengeResponse
+		decode(t, rec, &challenge)
+		rec = env.do(t, http.MethodPost, "/api/login/mfa", "", handlers.MFALoginRequest{MFAToken: challenge.MFAToken, Code: code(enrolment.Secret, step+1)})
+		expectStatus(t, rec, http.StatusOK)
+	})
+}
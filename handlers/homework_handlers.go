@@ -0,0 +1,750 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"wg-edu-server/middleware"
+	"wg-edu-server/models"
+	"wg-edu-server/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxHomeworkFileSize is the upload size of a homework attachment or submission in bytes
+const maxHomeworkFileSize = 20 << 20
+
+// homeworkError responds to an error from a homework operation
+func homeworkError(c *gin.Context, err error, notFound, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	case errors.Is(err, models.ErrNotTeaching):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not assigned to teach this subject"})
+	case errors.Is(err, models.ErrNotEnrolled):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not enrolled in this subject"})
+	case errors.Is(err, models.ErrSubjectArchived), errors.Is(err, models.ErrHomeworkClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidHomework):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// loadHomework reads the homework ID parameter and loads the homework with
+// its attachments, responding if anything fails
+//
+// Returns:
+//   - *models.Homework: Homework, or nil if a response has been sent
+func (h *Handler) loadHomework(c *gin.Context) *models.Homework {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid homework ID"})
+		return nil
+	}
+
+	homework, err := h.Homework.GetHomework(id)
+	if err != nil {
+		homeworkError(c, err, "Homework not found", "Failed to retrieve homework")
+		return nil
+	}
+	return homework
+}
+
+// enrolledStudent returns the calling student if they may submit homework of
+// a subject they are enrolled in
+//
+// Returns:
+//   - *models.Student: Caller's student record, or nil if the caller is not an enrolled student
+//   - error: Error if the student or their enrollments cannot be loaded
+func (h *Handler) enrolledStudent(c *gin.Context, subjectID int) (*models.Student, error) {
+	if !middleware.HasPermission(c, models.PermHomeworkSubmit) {
+		return nil, nil
+	}
+	student, err := h.Students.GetStudentByUserID(c.GetInt("user_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	enrollments, err := h.Enrollments.GetStudentEnrollments(student.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, enrollment := range enrollments {
+		if enrollment.SubjectID == subjectID {
+			return student, nil
+		}
+	}
+	return nil, nil
+}
+
+// homeworkAccess works out how the caller may see homework: teachers of its
+// subject and users with homework:read see everything, enrolled students
+// see the homework and their own submissions. It responds with 403 or 500 if
+// the caller may not see the homework.
+//
+// Returns:
+//   - bool: True if the caller sees every submission
+//   - *models.Student: Caller's student record if they only see their own submissions
+//   - bool: False if a response has been sent
+func (h *Handler) homeworkAccess(c *gin.Context, homework *models.Homework) (bool, *models.Student, bool) {
+	teaches, err := h.canViewSubject(c, homework.SubjectID, models.PermHomeworkRead, models.PermHomeworkManage)
+	if err != nil {
+		log.Printf("Error checking access to subject %d: %v", homework.SubjectID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false, nil, false
+	}
+	if teaches {
+		return true, nil, true
+	}
+
+	student, err := h.enrolledStudent(c, homework.SubjectID)
+	if err != nil {
+		log.Printf("Error checking enrollment of user %d: %v", c.GetInt("user_id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false, nil, false
+	}
+	if student == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only teachers and students of this subject may view its homework"})
+		return false, nil, false
+	}
+	return false, student, true
+}
+
+// storedUpload is an uploaded file saved on the storage backend
+type storedUpload struct {
+	Filename    string // Base name of the uploaded file
+	ContentType string // MIME type sent with the file, application/octet-stream if invalid
+	Size        int64  // Size in bytes
+	StorageKey  string // Key of the content on the storage backend
+}
+
+// storeUpload streams the multipart "file" field to the storage backend
+// under a new key below prefix, responding if anything fails. The request
+// body is limited to maxSize, so it must be called before any other form
+// field is read.
+//
+// Returns:
+//   - *storedUpload: File name, content type, size and storage key, or nil if a response has been sent
+func (h *Handler) storeUpload(c *gin.Context, prefix string, maxSize int64) *storedUpload {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large"})
+			return nil
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file"})
+		return nil
+	}
+	if fileHeader.Size == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is empty"})
+		return nil
+	}
+
+	stored := &storedUpload{
+		Filename:    filepath.Base(fileHeader.Filename),
+		ContentType: fileHeader.Header.Get("Content-Type"),
+	}
+	if _, _, err := mime.ParseMediaType(stored.ContentType); err != nil {
+		stored.ContentType = "application/octet-stream"
+	}
+
+	name, err := randomToken(16)
+	if err != nil {
+		log.Printf("Error generating storage key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store file"})
+		return nil
+	}
+	stored.StorageKey = prefix + name
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file"})
+		return nil
+	}
+	defer file.Close()
+	if stored.Size, err = h.Files.Put(stored.StorageKey, file); err != nil {
+		log.Printf("Error storing %s: %v", stored.StorageKey, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store file"})
+		return nil
+	}
+	return stored
+}
+
+// storeHomeworkFile saves the multipart "file" field of a homework upload,
+// at most maxHomeworkFileSize, on the storage backend below prefix
+//
+// Returns:
+//   - *models.HomeworkFile: File name, content type, size and storage key, or nil if a response has been sent
+func (h *Handler) storeHomeworkFile(c *gin.Context, prefix string) *models.HomeworkFile {
+	upload := h.storeUpload(c, prefix, maxHomeworkFileSize)
+	if upload == nil {
+		return nil
+	}
+	return &models.HomeworkFile{
+		Filename:    upload.Filename,
+		ContentType: upload.ContentType,
+		Size:        upload.Size,
+		StorageKey:  upload.StorageKey,
+	}
+}
+
+// deleteStoredFiles removes file content whose records have been deleted,
+// logging failures; the orphaned content is harmless
+func (h *Handler) deleteStoredFiles(keys ...string) {
+	for _, key := range keys {
+		if err := h.Files.Delete(key); err != nil {
+			log.Printf("Error deleting stored file %s: %v", key, err)
+		}
+	}
+}
+
+// sendStoredFile responds with file content from the storage backend as a download
+func (h *Handler) sendStoredFile(c *gin.Context, key, filename, contentType string, size int64) {
+	content, err := h.Files.Open(key)
+	if errors.Is(err, storage.ErrNotFound) {
+		log.Printf("Stored file %s is missing", key)
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening stored file %s: %v", key, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve file"})
+		return
+	}
+	defer content.Close()
+
+	c.DataFromReader(http.StatusOK, size, contentType, content, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", filename),
+	})
+}
+
+// HandleGetSubjectHomework lists the homework of a subject
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Subject ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with the homework, earliest due first
+//   - 400 Bad Request if the ID is invalid
+//   - 403 Forbidden unless the caller teaches the subject or has homework:read
+//   - 404 Not Found if the subject doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetSubjectHomework(c *gin.Context) {
+	subject := h.subjectWithAccess(c, models.PermHomeworkRead, models.PermHomeworkManage)
+	if subject == nil {
+		return
+	}
+
+	assignments, err := h.Homework.GetSubjectHomework(subject.ID)
+	if err != nil {
+		log.Printf("Error getting homework of subject %d: %v", subject.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve homework"})
+		return
+	}
+
+	c.JSON(http.StatusOK, assignments)
+}
+
+// HandleCreateHomework sets homework for a subject the caller teaches
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Subject ID parameter from the URL
+//
+// Expected Request Body:
+//   - title: Required
+//   - instructions: Optional
+//   - due_at: RFC 3339 time, e.g. 2025-03-14T23:59:00+01:00
+//   - late_policy: accept (default) flags late submissions, reject refuses them
+//
+// Returns:
+//   - 201 Created with the homework
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the homework:manage permission or if the caller does not teach the subject
+//   - 404 Not Found if the subject doesn't exist
+//   - 409 Conflict if the subject is archived
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleCreateHomework(c *gin.Context) {
+	subjectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subject ID"})
+		return
+	}
+
+	var req models.HomeworkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	homework, err := h.Homework.CreateHomework(subjectID, c.GetInt("user_id"), &req)
+	if err != nil {
+		homeworkError(c, err, "Subject not found", "Failed to create homework")
+		return
+	}
+
+	c.JSON(http.StatusCreated, homework)
+}
+
+// HandleGetMyHomework lists the homework of the calling student's subjects
+// with their submissions
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Returns:
+//   - 200 OK with the homework, earliest due first, each with its status and the student's attempts
+//   - 403 Forbidden without the homework:submit permission or if the caller is not a student
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetMyHomework(c *gin.Context) {
+	student, err := h.Students.GetStudentByUserID(c.GetInt("user_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only students have homework"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting student of user %d: %v", c.GetInt("user_id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve student"})
+		return
+	}
+
+	assignments, err := h.Homework.GetStudentHomework(student.ID)
+	if err != nil {
+		log.Printf("Error getting homework of student %d: %v", student.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve homework"})
+		return
+	}
+	submissions, err := h.Homework.GetStudentSubmissions(student.ID)
+	if err != nil {
+		log.Printf("Error getting submissions of student %d: %v", student.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve submissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.BuildStudentHomework(assignments, submissions, time.Now()))
+}
+
+// HandleGetHomework retrieves homework with its attachments
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Homework ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with the homework
+//   - 400 Bad Request if the ID is invalid
+//   - 403 Forbidden unless the caller teaches or is enrolled in the subject, or has homework:read
+//   - 404 Not Found if the homework doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetHomework(c *gin.Context) {
+	homework := h.loadHomework(c)
+	if homework == nil {
+		return
+	}
+	if _, _, ok := h.homeworkAccess(c, homework); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, homework)
+}
+
+// HandleUpdateHomework changes homework of a subject the caller teaches.
+// Late flags of earlier submissions follow the new due time.
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Homework ID parameter from the URL
+//
+// Expected Request Body:
+//   - Same fields as HandleCreateHomework
+//
+// Returns:
+//   - 200 OK with the updated homework
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the homework:manage permission or if the caller does not teach the subject
+//   - 404 Not Found if the homework doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleUpdateHomework(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid homework ID"})
+		return
+	}
+
+	var req models.HomeworkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	homework, err := h.Homework.UpdateHomework(id, c.GetInt("user_id"), &req)
+	if err != nil {
+		homeworkError(c, err, "Homework not found", "Failed to update homework")
+		return
+	}
+
+	c.JSON(http.StatusOK, homework)
+}
+
+// HandleDeleteHomework deletes homework with its attachments and submissions
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Homework ID parameter from the URL
+//
+// Returns:
+//   - 200 OK on success
+//   - 400 Bad Request if the ID is invalid
+//   - 403 Forbidden without the homework:manage permission or if the caller does not teach the subject
+//   - 404 Not Found if the homework doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleDeleteHomework(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid homework ID"})
+		return
+	}
+
+	keys, err := h.Homework.DeleteHomework(id, c.GetInt("user_id"))
+	if err != nil {
+		homeworkError(c, err, "Homework not found", "Failed to delete homework")
+		return
+	}
+	h.deleteStoredFiles(keys...)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Homework deleted successfully"})
+}
+
+// HandleUploadHomeworkAttachment attaches a file to homework of a subject the caller teaches
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Homework ID parameter from the URL
+//
+// Expected Request Body (multipart/form-data):
+//   - file: Attachment, at most 20 MB
+//
+// Returns:
+//   - 201 Created with the attachment
+//   - 400 Bad Request if the ID is invalid or the file is missing or empty
+//   - 403 Forbidden without the homework:manage permission or if the caller does not teach the subject
+//   - 404 Not Found if the homework doesn't exist
+//   - 413 Request Entity Too Large if the file exceeds the limit
+//   - 500 Internal Server Error on storage or database failure
+func (h *Handler) HandleUploadHomeworkAttachment(c *gin.Context) {
+	homework := h.loadHomework(c)
+	if homework == nil {
+		return
+	}
+	file := h.storeHomeworkFile(c, fmt.Sprintf("homework/%d/attachments/", homework.ID))
+	if file == nil {
+		return
+	}
+
+	// The store checks the caller teaches the subject; drop the file if it refuses
+	stored, err := h.Homework.AddHomeworkAttachment(homework.ID, c.GetInt("user_id"), file)
+	if err != nil {
+		h.deleteStoredFiles(file.StorageKey)
+		homeworkError(c, err, "Homework not found", "Failed to upload attachment")
+		return
+	}
+
+	c.JSON(http.StatusCreated, stored)
+}
+
+// parseFileID reads the file ID parameter, responding if it is invalid
+//
+// Returns:
+//   - int: File ID
+//   - bool: False if a response has been sent
+func parseFileID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("fileId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// HandleDownloadHomeworkAttachment downloads a file attached to homework the caller may see
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Homework ID parameter from the URL
+//   - fileId: Attachment ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with the file as an attachment
+//   - 400 Bad Request if an ID is invalid
+//   - 403 Forbidden unless the caller teaches or is enrolled in the subject, or has homework:read
+//   - 404 Not Found if the homework has no such attachment
+//   - 500 Internal Server Error on storage or database failure
+func (h *Handler) HandleDownloadHomeworkAttachment(c *gin.Context) {
+	homework := h.loadHomework(c)
+	if homework == nil {
+		return
+	}
+	fileID, ok := parseFileID(c)
+	if !ok {
+		return
+	}
+	if _, _, ok := h.homeworkAccess(c, homework); !ok {
+		return
+	}
+
+	file, err := h.Homework.GetHomeworkAttachment(homework.ID, fileID)
+	if err != nil {
+		homeworkError(c, err, "Attachment not found", "Failed to retrieve attachment")
+		return
+	}
+
+	h.sendStoredFile(c, file.StorageKey, file.Filename, file.ContentType, file.Size)
+}
+
+// HandleDeleteHomeworkAttachment removes a file attached to homework of a subject the caller teaches
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Homework ID parameter from the URL
+//   - fileId: Attachment ID parameter from the URL
+//
+// Returns:
+//   - 200 OK on success
+//   - 400 Bad Request if an ID is invalid
+//   - 403 Forbidden without the homework:manage permission or if the caller does not teach the subject
+//   - 404 Not Found if the homework has no such attachment
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleDeleteHomeworkAttachment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid homework ID"})
+		return
+	}
+	fileID, ok := parseFileID(c)
+	if !ok {
+		return
+	}
+
+	key, err := h.Homework.DeleteHomeworkAttachment(id, fileID, c.GetInt("user_id"))
+	if err != nil {
+		homeworkError(c, err, "Attachment not found", "Failed to delete attachment")
+		return
+	}
+	h.deleteStoredFiles(key)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
+}
+
+// HandleSubmitHomework submits the calling student's work. Every submission
+// is kept as a new attempt and flagged late after the due time; homework
+// with the reject late policy closes at the due time.
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Homework ID parameter from the URL
+//
+// Expected Request Body (multipart/form-data):
+//   - file: Submitted work, at most 20 MB
+//   - comment: Optional note to the teacher
+//
+// Returns:
+//   - 201 Created with the submission, its attempt number and late flag
+//   - 400 Bad Request if the ID or comment is invalid or the file is missing or empty
+//   - 403 Forbidden without the homework:submit permission or if the caller is not enrolled in the subject
+//   - 404 Not Found if the homework doesn't exist
+//   - 409 Conflict if the homework is past due and rejects late submissions
+//   - 413 Request Entity Too Large if the file exceeds the limit
+//   - 500 Internal Server Error on storage or database failure
+func (h *Handler) HandleSubmitHomework(c *gin.Context) {
+	homework := h.loadHomework(c)
+	if homework == nil {
+		return
+	}
+	student, err := h.enrolledStudent(c, homework.SubjectID)
+	if err != nil {
+		homeworkError(c, err, "Homework not found", "Failed to check enrollment")
+		return
+	}
+	// Refuse before storing the file; SubmitHomework checks again
+	if _, err := models.CheckHomeworkSubmission(homework, student != nil, time.Now()); err != nil {
+		homeworkError(c, err, "Homework not found", "Failed to submit homework")
+		return
+	}
+
+	file := h.storeHomeworkFile(c, fmt.Sprintf("homework/%d/submissions/", homework.ID))
+	if file == nil {
+		return
+	}
+
+	submission, err := h.Homework.SubmitHomework(homework.ID, student.ID, &models.HomeworkSubmission{
+		Comment:     c.PostForm("comment"),
+		Filename:    file.Filename,
+		ContentType: file.ContentType,
+		Size:        file.Size,
+		StorageKey:  file.StorageKey,
+	})
+	if err != nil {
+		h.deleteStoredFiles(file.StorageKey)
+		homeworkError(c, err, "Homework not found", "Failed to submit homework")
+		return
+	}
+
+	c.JSON(http.StatusCreated, submission)
+}
+
+// HandleGetHomeworkSubmissions lists the submissions of homework. Teachers
+// of the subject and users with homework:read see every student's attempts,
+// optionally of one student; enrolled students see their own.
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Homework ID parameter from the URL
+//   - student_id: Optional student filter for teachers
+//
+// Returns:
+//   - 200 OK with the submissions ordered by student name, latest attempt first
+//   - 400 Bad Request if the ID or student filter is invalid
+//   - 403 Forbidden unless the caller teaches or is enrolled in the subject, or has homework:read
+//   - 404 Not Found if the homework doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetHomeworkSubmissions(c *gin.Context) {
+	homework := h.loadHomework(c)
+	if homework == nil {
+		return
+	}
+	all, student, ok := h.homeworkAccess(c, homework)
+	if !ok {
+		return
+	}
+
+	studentID := 0
+	if !all {
+		studentID = student.ID
+	} else if value := c.Query("student_id"); value != "" {
+		var err error
+		if studentID, err = strconv.Atoi(value); err != nil || studentID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID"})
+			return
+		}
+	}
+
+	submissions, err := h.Homework.GetHomeworkSubmissions(homework.ID, studentID)
+	if err != nil {
+		log.Printf("Error getting submissions of homework %d: %v", homework.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve submissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, submissions)
+}
+
+// loadSubmission reads the submission ID parameter and loads the submission
+// and its homework, responding if anything fails
+//
+// Returns:
+//   - *models.HomeworkSubmission: Submission, or nil if a response has been sent
+//   - *models.Homework: Homework the submission is for
+func (h *Handler) loadSubmission(c *gin.Context) (*models.HomeworkSubmission, *models.Homework) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return nil, nil
+	}
+
+	submission, err := h.Homework.GetHomeworkSubmission(id)
+	if err != nil {
+		homeworkError(c, err, "Submission not found", "Failed to retrieve submission")
+		return nil, nil
+	}
+	homework, err := h.Homework.GetHomework(submission.HomeworkID)
+	if err != nil {
+		homeworkError(c, err, "Submission not found", "Failed to retrieve homework")
+		return nil, nil
+	}
+	return submission, homework
+}
+
+// HandleDownloadHomeworkSubmission downloads the file of a submission. Teachers
+// of the subject, users with homework:read and the submitting student may download it.
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Submission ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with the file as an attachment
+//   - 400 Bad Request if the ID is invalid
+//   - 403 Forbidden if the caller may not see the submission
+//   - 404 Not Found if the submission doesn't exist
+//   - 500 Internal Server Error on storage or database failure
+func (h *Handler) HandleDownloadHomeworkSubmission(c *gin.Context) {
+	submission, homework := h.loadSubmission(c)
+	if submission == nil {
+		return
+	}
+	all, student, ok := h.homeworkAccess(c, homework)
+	if !ok {
+		return
+	}
+	if !all && student.ID != submission.StudentID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You may only download your own submissions"})
+		return
+	}
+
+	h.sendStoredFile(c, submission.StorageKey, submission.Filename, submission.ContentType, submission.Size)
+}
+
+// HandleSetHomeworkFeedback gives or replaces feedback on a submission to
+// homework of a subject the caller teaches
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Submission ID parameter from the URL
+//
+// Expected Request Body:
+//   - feedback: Feedback text
+//
+// Returns:
+//   - 200 OK with the submission and its feedback
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the homework:manage permission or if the caller does not teach the subject
+//   - 404 Not Found if the submission doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleSetHomeworkFeedback(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+
+	var req models.HomeworkFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	submission, err := h.Homework.SetHomeworkFeedback(id, c.GetInt("user_id"), &req)
+	if err != nil {
+		homeworkError(c, err, "Submission not found", "Failed to save feedback")
+		return
+	}
+
+	c.JSON(http.StatusOK, submission)
+}
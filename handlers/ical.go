@@ -0,0 +1,128 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Layouts of iCalendar DATE and DATE-TIME values. Lesson times are floating
+// (no time zone), so calendar apps show them in the school's local time.
+const (
+	icsDateLayout     = "20060102"
+	icsDateTimeLayout = "20060102T150405"
+	icsUTCLayout      = "20060102T150405Z"
+)
+
+// icsMaxLineLength is the longest content line, in octets, before it is folded
+const icsMaxLineLength = 75
+
+// icsWeekdays are the RFC 5545 names of the weekdays, indexed by time.Weekday
+var icsWeekdays = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// icsEvent is one VEVENT of a calendar feed
+type icsEvent struct {
+	UID         string    // Globally unique, stable identifier
+	Summary     string    // Title shown in calendar apps
+	Description string    // Optional details
+	Location    string    // Optional room
+	Categories  []string  // Optional categories, e.g. the assessment category
+	Start       time.Time // Start; only the date is used for all-day events
+	End         time.Time // End of timed events
+	AllDay      bool      // Event lasts the whole day of Start
+	Weekly      bool      // Event repeats every week on Start's weekday
+	Modified    time.Time // Last change, zero if unknown
+}
+
+// icsWriter writes an RFC 5545 calendar, remembering the first write error
+type icsWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+// line writes one content line, folded to icsMaxLineLength octets
+func (iw *icsWriter) line(name, value string) {
+	if iw.err != nil {
+		return
+	}
+	line := name + ":" + value
+	for len(line) > icsMaxLineLength {
+		// Fold without splitting a UTF-8 sequence; continuation lines start with a space
+		cut := icsMaxLineLength
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		if _, iw.err = iw.w.WriteString(line[:cut] + "\r\n "); iw.err != nil {
+			return
+		}
+		line = line[cut:]
+	}
+	_, iw.err = iw.w.WriteString(line + "\r\n")
+}
+
+// icsEscaper escapes TEXT property values
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\r", `\n`, "\n", `\n`)
+
+// writeICS writes a calendar with the given events
+//
+// Parameters:
+//   - w: Destination of the calendar
+//   - name: Calendar name shown by calendar apps
+//   - events: Events in the order they are written
+//   - now: Time the calendar is generated, written as each event's DTSTAMP
+//
+// Returns:
+//   - error: First error writing to w
+func writeICS(w io.Writer, name string, events []icsEvent, now time.Time) error {
+	iw := &icsWriter{w: bufio.NewWriter(w)}
+	iw.line("BEGIN", "VCALENDAR")
+	iw.line("VERSION", "2.0")
+	iw.line("PRODID", "-//WG Education//Calendar Feed//EN")
+	iw.line("CALSCALE", "GREGORIAN")
+	iw.line("METHOD", "PUBLISH")
+	iw.line("X-WR-CALNAME", icsEscaper.Replace(name))
+
+	stamp := now.UTC().Format(icsUTCLayout)
+	for _, event := range events {
+		iw.line("BEGIN", "VEVENT")
+		iw.line("UID", event.UID)
+		iw.line("DTSTAMP", stamp)
+		if event.AllDay {
+			iw.line("DTSTART;VALUE=DATE", event.Start.Format(icsDateLayout))
+			iw.line("DTEND;VALUE=DATE", event.Start.AddDate(0, 0, 1).Format(icsDateLayout))
+		} else {
+			iw.line("DTSTART", event.Start.Format(icsDateTimeLayout))
+			iw.line("DTEND", event.End.Format(icsDateTimeLayout))
+		}
+		if event.Weekly {
+			iw.line("RRULE", "FREQ=WEEKLY;BYDAY="+icsWeekdays[event.Start.Weekday()])
+		}
+		iw.line("SUMMARY", icsEscaper.Replace(event.Summary))
+		if event.Description != "" {
+			iw.line("DESCRIPTION", icsEscaper.Replace(event.Description))
+		}
+		if event.Location != "" {
+			iw.line("LOCATION", icsEscaper.Replace(event.Location))
+		}
+		if len(event.Categories) > 0 {
+			categories := make([]string, len(event.Categories))
+			for i, category := range event.Categories {
+				categories[i] = icsEscaper.Replace(category)
+			}
+			iw.line("CATEGORIES", strings.Join(categories, ","))
+		}
+		if !event.Modified.IsZero() {
+			iw.line("LAST-MODIFIED", event.Modified.UTC().Format(icsUTCLayout))
+		}
+		iw.line("END", "VEVENT")
+	}
+
+	iw.line("END", "VCALENDAR")
+	if iw.err != nil {
+		return iw.err
+	}
+	return iw.w.Flush()
+}
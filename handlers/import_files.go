@@ -0,0 +1,330 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// sheetRow is one non-empty row of an uploaded spreadsheet
+type sheetRow struct {
+	Line  int      // 1-based row number in the file
+	Cells []string // Cell values, trimmed
+}
+
+// Limits applied when reading spreadsheets
+const (
+	maxXLSXPartSize = 64 << 20 // Uncompressed size of each part that is read
+	maxXLSXColumns  = 16384    // Columns of a worksheet, as in Excel
+	maxSheetColumns = 256      // Header cells kept; cells further right are dropped
+)
+
+// errInvalidSheet is returned when an uploaded file cannot be read as a spreadsheet
+var errInvalidSheet = errors.New("invalid spreadsheet")
+
+// errSheetTooLong is returned as soon as a spreadsheet has more non-empty rows than allowed
+var errSheetTooLong = errors.New("spreadsheet has too many rows")
+
+// sheetBuilder collects the non-empty rows of a spreadsheet while it is read,
+// so that long files are refused early and wide rows take no memory beyond
+// the header's columns
+type sheetBuilder struct {
+	rows    []sheetRow
+	maxRows int // Non-empty rows allowed, including the header
+	columns int // Cells kept per row: up to the header's last non-empty cell
+}
+
+// newSheetBuilder creates a builder refusing more than maxRows non-empty rows
+func newSheetBuilder(maxRows int) *sheetBuilder {
+	return &sheetBuilder{maxRows: maxRows, columns: maxSheetColumns}
+}
+
+// add keeps a row if any of its cells is non-empty, dropping the cells right
+// of the header. The first row kept is the header.
+//
+// Returns:
+//   - error: errSheetTooLong if the row is one more than allowed
+func (b *sheetBuilder) add(line int, cells []string) error {
+	if len(cells) > b.columns {
+		cells = cells[:b.columns]
+	}
+	row, ok := newSheetRow(line, cells)
+	if !ok {
+		return nil
+	}
+	if len(b.rows) >= b.maxRows {
+		return errSheetTooLong
+	}
+	if len(b.rows) == 0 {
+		// Cells right of the last header have no column to go in
+		for b.columns = len(row.Cells); row.Cells[b.columns-1] == ""; b.columns-- {
+		}
+		row.Cells = row.Cells[:b.columns]
+	}
+	b.rows = append(b.rows, row)
+	return nil
+}
+
+// readCSV reads every non-empty row of a CSV file. A UTF-8 byte order mark,
+// as written by Excel, is ignored.
+//
+// Parameters:
+//   - r: CSV content
+//   - maxRows: Non-empty rows allowed, including the header
+//
+// Returns:
+//   - []sheetRow: Rows with their line numbers
+//   - error: errInvalidSheet wrapped with the parse error, or errSheetTooLong
+func readCSV(r io.Reader, maxRows int) ([]sheetRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	sheet := newSheetBuilder(maxRows)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidSheet, err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(sheet.rows) == 0 {
+			record[0] = strings.TrimPrefix(record[0], "\ufeff")
+		}
+		if err := sheet.add(line, append([]string(nil), record...)); err != nil {
+			return nil, err
+		}
+	}
+	return sheet.rows, nil
+}
+
+// newSheetRow trims the cells of a row and reports whether any is non-empty
+func newSheetRow(line int, cells []string) (sheetRow, bool) {
+	empty := true
+	for i, cell := range cells {
+		cells[i] = strings.TrimSpace(cell)
+		if cells[i] != "" {
+			empty = false
+		}
+	}
+	return sheetRow{Line: line, Cells: cells}, !empty
+}
+
+// XLSX (Office Open XML) parts needed to read the first worksheet
+type (
+	xlsxWorkbook struct {
+		Sheets []struct {
+			RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	xlsxRelationships struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	xlsxText struct {
+		T    string `xml:"t"`
+		Runs []struct {
+			T string `xml:"t"`
+		} `xml:"r"`
+	}
+	xlsxSharedStrings struct {
+		Items []xlsxText `xml:"si"`
+	}
+	xlsxRow struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R      string    `xml:"r,attr"`
+			T      string    `xml:"t,attr"`
+			V      string    `xml:"v"`
+			Inline *xlsxText `xml:"is"`
+		} `xml:"c"`
+	}
+)
+
+// String joins a rich text's runs, or returns its plain text
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.T)
+	}
+	return b.String()
+}
+
+// readXLSX reads every non-empty row of the first worksheet of an XLSX file.
+// Cells are read as the text they store; formulas are not evaluated. The
+// worksheet is decoded one row at a time.
+//
+// Parameters:
+//   - r: XLSX content
+//   - size: Size of the content in bytes
+//   - maxRows: Non-empty rows allowed, including the header
+//
+// Returns:
+//   - []sheetRow: Rows with their row numbers
+//   - error: errInvalidSheet wrapped with the reason, or errSheetTooLong
+func readXLSX(r io.ReaderAt, size int64, maxRows int) ([]sheetRow, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidSheet, err)
+	}
+
+	var workbook xlsxWorkbook
+	if err := readXLSXPart(archive, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, fmt.Errorf("%w: workbook has no worksheets", errInvalidSheet)
+	}
+
+	var rels xlsxRelationships
+	if err := readXLSXPart(archive, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	sheetPath := ""
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[0].RID {
+			if strings.HasPrefix(rel.Target, "/") {
+				sheetPath = strings.TrimPrefix(rel.Target, "/")
+			} else {
+				sheetPath = path.Join("xl", rel.Target)
+			}
+		}
+	}
+	if sheetPath == "" {
+		return nil, fmt.Errorf("%w: first worksheet not found", errInvalidSheet)
+	}
+
+	// Workbooks without text cells have no shared strings part
+	var shared xlsxSharedStrings
+	if archiveHas(archive, "xl/sharedStrings.xml") {
+		if err := readXLSXPart(archive, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := archive.Open(sheetPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing %s", errInvalidSheet, sheetPath)
+	}
+	defer f.Close()
+
+	decoder := xml.NewDecoder(io.LimitReader(f, maxXLSXPartSize))
+	sheet := newSheetBuilder(maxRows)
+	line := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", errInvalidSheet, sheetPath, err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		var xr xlsxRow
+		if err := decoder.DecodeElement(&xr, &start); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", errInvalidSheet, sheetPath, err)
+		}
+
+		line++
+		if xr.R > 0 {
+			line = xr.R
+		}
+
+		var cells []string
+		for _, xc := range xr.Cells {
+			col := len(cells)
+			if xc.R != "" {
+				if col = xlsxColumn(xc.R); col < 0 || col >= maxXLSXColumns {
+					return nil, fmt.Errorf("%w: invalid cell reference %q", errInvalidSheet, xc.R)
+				}
+			}
+			if col >= sheet.columns {
+				continue
+			}
+
+			value := xc.V
+			switch xc.T {
+			case "s":
+				i, err := strconv.Atoi(xc.V)
+				if err != nil || i < 0 || i >= len(shared.Items) {
+					return nil, fmt.Errorf("%w: invalid shared string in cell %s", errInvalidSheet, xc.R)
+				}
+				value = shared.Items[i].String()
+			case "inlineStr":
+				if xc.Inline != nil {
+					value = xc.Inline.String()
+				}
+			}
+
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+			cells[col] = value
+		}
+
+		if err := sheet.add(line, cells); err != nil {
+			return nil, err
+		}
+	}
+	return sheet.rows, nil
+}
+
+// archiveHas reports whether a zip archive contains a file
+func archiveHas(archive *zip.Reader, name string) bool {
+	for _, f := range archive.File {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readXLSXPart decodes an XML part of an XLSX archive
+func readXLSXPart(archive *zip.Reader, name string, v interface{}) error {
+	f, err := archive.Open(name)
+	if err != nil {
+		return fmt.Errorf("%w: missing %s", errInvalidSheet, name)
+	}
+	defer f.Close()
+
+	if err := xml.NewDecoder(io.LimitReader(f, maxXLSXPartSize)).Decode(v); err != nil {
+		return fmt.Errorf("%w: %s: %v", errInvalidSheet, name, err)
+	}
+	return nil
+}
+
+// xlsxColumn converts the letters of a cell reference such as "AB12" to a
+// 0-based column index, or returns -1 if there are none or more than three
+func xlsxColumn(ref string) int {
+	col := 0
+	n := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		col = col*26 + int(ch-'A'+1)
+		n++
+	}
+	if n == 0 || n > 3 {
+		return -1
+	}
+	return col - 1
+}
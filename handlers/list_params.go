@@ -0,0 +1,67 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseListParams reads the common list query parameters:
+//
+//	limit=50            page size, at most models.MaxListLimit
+//	page=2              1-based page number, or
+//	cursor=...          next_cursor of the previous page
+//	sort=-created_at,id comma separated fields, "-" for descending
+//	filter[grade]=IB1   exact-match filter, repeatable per field
+//	q=ada               case-insensitive search
+//
+// Field names are checked against the entity's allow-list by the store.
+func parseListParams(c *gin.Context) (models.ListParams, error) {
+	params := models.ListParams{
+		Cursor:  c.Query("cursor"),
+		Filters: c.QueryMap("filter"),
+		Query:   c.Query("q"),
+	}
+
+	var err error
+	if v := c.Query("limit"); v != "" {
+		if params.Limit, err = strconv.Atoi(v); err != nil || params.Limit < 1 {
+			return params, fmt.Errorf("%w: limit must be a positive integer", models.ErrInvalidListParams)
+		}
+	}
+	if v := c.Query("page"); v != "" {
+		if params.Page, err = strconv.Atoi(v); err != nil || params.Page < 1 {
+			return params, fmt.Errorf("%w: page must be a positive integer", models.ErrInvalidListParams)
+		}
+	}
+
+	if v := c.Query("sort"); v != "" {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			sort := models.SortField{Field: strings.TrimPrefix(field, "-")}
+			sort.Desc = sort.Field != field
+			params.Sort = append(params.Sort, sort)
+		}
+	}
+
+	return params, nil
+}
+
+// listError responds to a failed list query: 400 for invalid list parameters,
+// 500 otherwise
+func listError(c *gin.Context, err error, message string) {
+	if errors.Is(err, models.ErrInvalidListParams) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	log.Printf("%s: %v", message, err)
+	c.JSON(http.StatusInternalServerError, ErrorResponse{Error: message})
+}
@@ -0,0 +1,215 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits of the login failure summary
+const (
+	DefaultLoginSummaryHours = 24
+	DefaultLoginSummaryLimit = 10
+	MaxLoginSummaryLimit     = 100
+)
+
+// loginPolicy returns the configured login policy or the default
+func (h *Handler) loginPolicy() models.LoginPolicy {
+	if h.LoginPolicy == (models.LoginPolicy{}) {
+		return models.DefaultLoginPolicy()
+	}
+	return h.LoginPolicy
+}
+
+// recordLoginAttempt records a login attempt. A failure to record is only
+// logged so that logins keep working; the rate limit then undercounts.
+func (h *Handler) recordLoginAttempt(username, ip, outcome string) {
+	if err := h.LoginAttempts.RecordLoginAttempt(username, ip, outcome); err != nil {
+		log.Printf("Error recording %s login of %q from %s: %v", outcome, username, ip, err)
+	}
+}
+
+// tooManyRequests refuses a request over a rate limit with 429 Too Many
+// Requests and a Retry-After header in whole seconds
+func tooManyRequests(c *gin.Context, wait time.Duration, message string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       message,
+		"retry_after": seconds,
+	})
+}
+
+// tooManyLogins refuses a login over the rate limit
+func tooManyLogins(c *gin.Context, wait time.Duration) {
+	tooManyRequests(c, wait, "Too many failed login attempts. Try again later")
+}
+
+// checkLoginLimit counts the recent failed logins of a username and client
+// address and refuses the attempt if it is over the rate limit
+//
+// Returns:
+//   - *models.LoginFailures: The counted failures
+//   - bool: False once a response is written
+func (h *Handler) checkLoginLimit(c *gin.Context, username, ip string, policy models.LoginPolicy, now time.Time) (*models.LoginFailures, bool) {
+	failures, err := h.LoginAttempts.CountLoginFailures(username, ip, now.Add(-policy.Window))
+	if err != nil {
+		log.Printf("Error counting failed logins of %q from %s: %v", username, ip, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return nil, false
+	}
+	if wait := policy.RetryAfter(failures, now); wait > 0 {
+		h.recordLoginAttempt(username, ip, models.LoginBlocked)
+		tooManyLogins(c, wait)
+		return nil, false
+	}
+	return failures, true
+}
+
+// refuseLocked refuses a login of a locked account with 423 Locked. Locked
+// accounts refuse even the correct password. It returns true once a response
+// is written.
+func (h *Handler) refuseLocked(c *gin.Context, user *models.User, ip string, now time.Time) bool {
+	if user.LockedUntil == nil || !now.Before(*user.LockedUntil) {
+		return false
+	}
+	h.recordLoginAttempt(user.Username, ip, models.LoginBlocked)
+	c.JSON(http.StatusLocked, gin.H{
+		"error":        "Account is locked after too many failed logins",
+		"locked_until": user.LockedUntil,
+	})
+	return true
+}
+
+// loginFailed records a wrong password or code for an existing account and
+// locks the account once its failures reach the lockout threshold
+func (h *Handler) loginFailed(user *models.User, ip string, failures *models.LoginFailures, policy models.LoginPolicy, now time.Time) {
+	h.recordLoginAttempt(user.Username, ip, models.LoginFailure)
+	if policy.Locks(failures.Username + 1) {
+		if err := h.Users.LockUser(user.ID, now.Add(policy.LockoutDuration)); err != nil {
+			log.Printf("Error locking user %d: %v", user.ID, err)
+		}
+	}
+}
+
+// HandleUnlockUser lifts the lockout of an account and restarts the count of
+// its failed logins
+// @Summary Unlock user
+// @Description Lets a user locked after repeated failed logins log in again
+// @Tags auth
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id}/unlock [post]
+func (h *Handler) HandleUnlockUser(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	user, err := h.Users.GetUserByID(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to unlock user"})
+		return
+	}
+
+	if err := h.Users.UnlockUser(userID); err != nil {
+		log.Printf("Error unlocking user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to unlock user"})
+		return
+	}
+	// Without this the earlier failures would lock the account again
+	if err := h.LoginAttempts.RecordLoginAttempt(user.Username, c.ClientIP(), models.LoginUnlocked); err != nil {
+		log.Printf("Error recording unlock of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "User unlocked but failed logins could not be reset"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Message: "User unlocked successfully"})
+}
+
+// GetLoginAttempts lists recorded login attempts
+// @Summary List login attempts
+// @Description Every login is recorded with its username, client address and outcome (success, failure, blocked or unlocked)
+// @Tags auth
+// @Produce json
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param page query int false "1-based page number"
+// @Param cursor query string false "Cursor from next_cursor of the previous page"
+// @Param sort query string false "Comma separated fields, '-' for descending: id, username, ip_address, outcome, attempted_at (default -attempted_at)"
+// @Param filter[username] query string false "Exact username"
+// @Param filter[ip_address] query string false "Exact client address"
+// @Param filter[outcome] query string false "success, failure, blocked or unlocked"
+// @Param q query string false "Search username and client address"
+// @Success 200 {object} models.ListResult[models.LoginAttempt]
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/login-attempts [get]
+func (h *Handler) GetLoginAttempts(c *gin.Context) {
+	params, err := parseListParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	result, err := h.LoginAttempts.ListLoginAttempts(params)
+	if err != nil {
+		listError(c, err, "Failed to retrieve login attempts")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetLoginFailureSummary shows which addresses and usernames failed to log in
+// most often recently
+// @Summary Summarize failed logins
+// @Description Counts failed and blocked logins and lists the addresses and usernames with the most failures
+// @Tags auth
+// @Produce json
+// @Param hours query int false "Length of the period in hours (default 24)"
+// @Param limit query int false "Addresses and usernames listed (default 10, max 100)"
+// @Success 200 {object} models.LoginFailureSummary
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/login-attempts/summary [get]
+func (h *Handler) GetLoginFailureSummary(c *gin.Context) {
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", strconv.Itoa(DefaultLoginSummaryHours)))
+	if err != nil || hours < 1 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "hours must be a positive integer"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DefaultLoginSummaryLimit)))
+	if err != nil || limit < 1 || limit > MaxLoginSummaryLimit {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "limit must be between 1 and " + strconv.Itoa(MaxLoginSummaryLimit)})
+		return
+	}
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	summary, err := h.LoginAttempts.SummarizeLoginFailures(since, limit)
+	if err != nil {
+		log.Printf("Error summarizing failed logins: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to summarize login attempts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
@@ -0,0 +1,262 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"wg-edu-server/mailer"
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MeResponse is the caller's account with the record of their role
+type MeResponse struct {
+	User        models.User      `json:"user"`
+	Permissions []string         `json:"permissions"`        // Permissions of the user's current role
+	Student     *models.Student  `json:"student,omitempty"`  // Set for students
+	Teacher     *models.Teacher  `json:"teacher,omitempty"`  // Set for teachers, with their subjects
+	Guardian    *models.Guardian `json:"guardian,omitempty"` // Set for guardians, with their children
+}
+
+// ChangePasswordRequest is used by users to change their own password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// me loads the caller's account and role record
+//
+// Parameters:
+//   - userID: Authenticated user
+//
+// Returns:
+//   - *MeResponse: Account, permissions and the record of the user's role, if any
+//   - error: sql.ErrNoRows if the user no longer exists, or a database error
+func (h *Handler) me(userID int) (*MeResponse, error) {
+	user, err := h.Users.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	_, permissions, err := h.Roles.GetUserPermissions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &MeResponse{User: *user, Permissions: permissions}
+	switch user.Role {
+	case models.RoleStudent:
+		resp.Student, err = h.Students.GetStudentByUserID(userID)
+	case models.RoleTeacher:
+		resp.Teacher, err = h.Teachers.GetTeacherByID(userID)
+	case models.RoleGuardian:
+		resp.Guardian, err = h.Guardians.GetGuardianByID(userID)
+	}
+	// Users given a role through role management may have no record for it
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// email returns the email address in the record of the user's role, empty if
+// the role has none
+func (m *MeResponse) email() string {
+	switch {
+	case m.Student != nil:
+		return m.Student.Email
+	case m.Teacher != nil:
+		return m.Teacher.Email
+	case m.Guardian != nil:
+		return m.Guardian.Email
+	}
+	return ""
+}
+
+// notifyEmailChanged tells the previous address of an account that its email
+// was changed, so that the owner notices if someone else did it. The mail is
+// sent in the background and failures are only logged.
+func (h *Handler) notifyEmailChanged(user *models.User, previous, email string) {
+	msg := mailer.Message{
+		To:      previous,
+		Subject: "Your WG Education email address was changed",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"The email address of your WG Education account %q was changed to %s.\n"+
+			"Password reset links are now sent there instead of to this address.\n\n"+
+			"If you did not make this change, contact the school office immediately.\n",
+			user.Username, user.Username, email),
+	}
+
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		if err := h.Mailer.Send(msg); err != nil {
+			log.Printf("Error notifying user %d of their email change: %v", user.ID, err)
+		}
+	}()
+}
+
+// HandleGetMe returns the caller's own account and profile
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Returns:
+//   - 200 OK with the account, permissions and the student record, teacher
+//     profile with subjects or guardian profile with children
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetMe(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	resp, err := h.me(userID)
+	if err != nil {
+		log.Printf("Error loading profile of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleUpdateMe lets the caller change their display name and email address.
+// Password reset links go to the email address, so changing it needs the
+// current password, and the previous address is told of the change.
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Expected Request Body:
+//   - display_name: Name to show, empty to show the username
+//   - email: Email address; required for students, teachers and guardians,
+//     refused for roles without a profile
+//   - current_password: The user's password, required if the email changes
+//
+// Returns:
+//   - 200 OK with the updated account and profile, as for GET /api/me
+//   - 400 Bad Request if the input is invalid or the email changes without current_password
+//   - 403 Forbidden if the current password is wrong
+//   - 409 Conflict if the email is already in use
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleUpdateMe(c *gin.Context) {
+	var req models.ProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := models.ValidateProfile(&req, c.GetString("role")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	before, err := h.me(userID)
+	if err != nil {
+		log.Printf("Error loading profile of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+	previous := before.email()
+	emailChanged := models.ProfileHasEmail(c.GetString("role")) && !strings.EqualFold(req.Email, previous)
+	if emailChanged {
+		if req.CurrentPassword == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "current_password is required to change the email address"})
+			return
+		}
+		if !before.User.CheckPassword(req.CurrentPassword) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+	}
+
+	if _, err := h.Users.UpdateProfile(userID, &req); err != nil {
+		if models.IsDuplicate(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already in use"})
+			return
+		}
+		log.Printf("Error updating profile of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+	if emailChanged && previous != "" {
+		h.notifyEmailChanged(&before.User, previous, req.Email)
+	}
+
+	resp, err := h.me(userID)
+	if err != nil {
+		log.Printf("Error loading profile of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleChangePassword lets the caller change their password after
+// confirming the current one. Every session of the user, including the
+// current one, is revoked, so they log in again with the new password.
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Expected Request Body:
+//   - current_password: The user's current password
+//   - new_password: The new password, different from the current one
+//
+// Returns:
+//   - 200 OK once the password is changed and the sessions are revoked
+//   - 400 Bad Request if a field is missing, or the password is unchanged, too short or too long
+//   - 403 Forbidden if the current password is wrong
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "current_password and new_password are required"})
+		return
+	}
+	if req.CurrentPassword == req.NewPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The new password must differ from the current one"})
+		return
+	}
+	if err := models.ValidatePassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	user, err := h.Users.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error getting user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+	if !user.CheckPassword(req.CurrentPassword) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	if err := h.Users.UpdateUserPassword(userID, req.NewPassword); err != nil {
+		log.Printf("Error changing password of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	// Sessions started with the old password, possibly by someone else, end here
+	if err := h.Tokens.RevokeUserSessions(userID); err != nil {
+		log.Printf("Error revoking sessions after password change of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password changed but sessions could not be revoked"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully. Log in again with the new password"})
+}
@@ -0,0 +1,600 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"wg-edu-server/models"
+	"wg-edu-server/totp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Two-factor authentication settings
+const (
+	DefaultMFAIssuer = "WG Education"
+	MFAChallengeTTL  = 5 * time.Minute // Time to enter the code after the password
+	MFASkew          = 1               // TOTP periods accepted either side of the current one
+)
+
+// MFAChallengeResponse is returned by login instead of tokens when the user
+// has two-factor authentication enabled
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`  // Challenge for POST /api/login/mfa
+	ExpiresIn   int    `json:"expires_in"` // Challenge lifetime in seconds
+}
+
+// MFALoginRequest completes a login with the second factor
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token"` // Challenge returned by POST /api/login
+	Code     string `json:"code"`      // Code from the authenticator app, or a recovery code
+}
+
+// MFAPasswordRequest confirms a change to two-factor authentication with the
+// user's password
+type MFAPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+// MFACodeRequest carries a code from the authenticator app
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+// MFAStatusResponse is the caller's two-factor authentication state
+type MFAStatusResponse struct {
+	Enabled           bool       `json:"enabled"`             // The enrolment is confirmed and login asks for a code
+	Pending           bool       `json:"pending"`             // An enrolment waits for its first code
+	Required          bool       `json:"required"`            // The user's role needs it for sensitive routes
+	Session           bool       `json:"session"`             // The current session was started with a code
+	RecoveryCodesLeft int        `json:"recovery_codes_left"` // Unused recovery codes
+	ConfirmedAt       *time.Time `json:"confirmed_at"`
+}
+
+// MFAEnrollmentResponse holds a new TOTP secret for the authenticator app
+type MFAEnrollmentResponse struct {
+	Secret          string `json:"secret"`           // Base32 secret for manual entry
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth:// URI to show as a QR code
+}
+
+// RecoveryCodesResponse holds newly issued recovery codes. They are shown
+// once; only their hashes are stored.
+type RecoveryCodesResponse struct {
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// mfaChallengeClaims are the claims of an MFA challenge token
+type mfaChallengeClaims struct {
+	UserID int `json:"user_id"`
+	jwt.RegisteredClaims
+}
+
+// MFARequired reports whether users of a role must complete two-factor
+// authentication for routes behind middleware.RequireMFA
+func (h *Handler) MFARequired(role string) bool {
+	return slices.Contains(h.MFARequiredRoles, role)
+}
+
+// mfaIssuer returns the configured issuer name or the default
+func (h *Handler) mfaIssuer() string {
+	if h.MFAIssuer != "" {
+		return h.MFAIssuer
+	}
+	return DefaultMFAIssuer
+}
+
+// mfaChallengeKey derives the key MFA challenges are signed with from the
+// JWT secret, so that a challenge is never accepted as an access token
+func (h *Handler) mfaChallengeKey() []byte {
+	mac := hmac.New(sha256.New, []byte(h.JWTSecret))
+	mac.Write([]byte("mfa-challenge"))
+	return mac.Sum(nil)
+}
+
+// createMFAChallenge signs a challenge proving that a user entered the right
+// password
+func (h *Handler) createMFAChallenge(user *models.User) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := mfaChallengeClaims{
+		UserID: user.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(MFAChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(h.mfaChallengeKey())
+}
+
+// parseMFAChallenge validates an MFA challenge and returns its claims
+func (h *Handler) parseMFAChallenge(tokenString string) (*mfaChallengeClaims, error) {
+	claims := &mfaChallengeClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return h.mfaChallengeKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.ID == "" || claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		return nil, errors.New("invalid MFA challenge claims")
+	}
+	return claims, nil
+}
+
+// checkMFACode accepts a TOTP code that was not used before, or an unused
+// recovery code
+//
+// Returns:
+//   - error: models.ErrInvalidMFACode if the code is wrong or used, or a database error
+func (h *Handler) checkMFACode(mfa *models.MFA, code string) error {
+	if step, ok := totp.Verify(mfa.Secret, code, time.Now(), MFASkew); ok {
+		return h.MFA.UseMFAStep(mfa.UserID, step)
+	}
+	recovery := normalizeRecoveryCode(code)
+	if recovery == "" {
+		return models.ErrInvalidMFACode
+	}
+	return h.MFA.UseRecoveryCode(mfa.UserID, models.HashToken(recovery))
+}
+
+// newRecoveryCodes generates a set of recovery codes
+//
+// Returns:
+//   - []string: Codes to show the user, formatted as xxxx-xxxx
+//   - []string: SHA-256 hashes of the normalized codes, to store
+//   - error: Error if random data is unavailable
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, models.RecoveryCodeCount)
+	hashes := make([]string, models.RecoveryCodeCount)
+	b := make([]byte, 5)
+	for i := range codes {
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = models.HashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode removes the formatting users may type along with a
+// recovery code
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// requireMFASession refuses changes to two-factor authentication from sessions
+// started without it, so that a stolen password alone cannot remove or replace
+// the second factor. It returns false once a response is written.
+func requireMFASession(c *gin.Context) bool {
+	if !c.GetBool("mfa") {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":        "Log in with two-factor authentication to change it",
+			"mfa_required": true,
+		})
+		return false
+	}
+	return true
+}
+
+// checkMFAPassword binds a password confirmation and checks it against the
+// caller's account. It returns false once a response is written.
+func (h *Handler) checkMFAPassword(c *gin.Context, userID int) (*models.User, bool) {
+	var req MFAPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password is required"})
+		return nil, false
+	}
+
+	user, err := h.Users.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error getting user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update two-factor authentication"})
+		return nil, false
+	}
+	if !user.CheckPassword(req.Password) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Password is incorrect"})
+		return nil, false
+	}
+	return user, true
+}
+
+// HandleLoginMFA completes a login of a user with two-factor authentication
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Expected Request Body:
+//   - mfa_token: Challenge returned by POST /api/login
+//   - code: Current code from the authenticator app, or an unused recovery code
+//
+// Returns:
+//   - 200 OK with tokens whose claims record that two-factor authentication was completed
+//   - 400 Bad Request if a field is missing
+//   - 401 Unauthorized if the challenge is invalid, expired or used, or the code is wrong or used;
+//     each challenge takes one code, so a wrong code means logging in again
+//   - 403 Forbidden if the account is deactivated or must change its password
+//   - 423 Locked and 429 Too Many Requests as for POST /api/login; wrong
+//     codes count as failed logins
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleLoginMFA(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mfa_token and code are required"})
+		return
+	}
+
+	claims, err := h.parseMFAChallenge(req.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+	// A challenge is single-use and dies with the user's sessions
+	revoked, err := h.Tokens.IsTokenRevoked(claims.ID, claims.UserID, claims.IssuedAt.Time)
+	if err != nil {
+		log.Printf("Error checking MFA challenge of user %d: %v", claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	if revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	user, err := h.Users.GetUserByID(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	ip := c.ClientIP()
+	policy := h.loginPolicy()
+	now := time.Now()
+	failures, ok := h.checkLoginLimit(c, user.Username, ip, policy, now)
+	if !ok {
+		return
+	}
+	if h.refuseLocked(c, user, ip, now) {
+		return
+	}
+	if !user.Active {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
+		return
+	}
+
+	mfa, err := h.MFA.GetMFA(user.ID)
+	if err != nil || !mfa.Enabled {
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting two-factor authentication of user %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+			return
+		}
+		// Reset by an admin since the password was checked
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	// Claim the challenge before checking the code, so that of concurrent
+	// requests with it only one gets a code checked; a wrong code uses it up
+	claimed, err := h.Tokens.ClaimToken(claims.ID, user.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		log.Printf("Error using MFA challenge of user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	if !claimed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	if err := h.checkMFACode(mfa, req.Code); err != nil {
+		if !errors.Is(err, models.ErrInvalidMFACode) {
+			log.Printf("Error checking two-factor code of user %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+			return
+		}
+		h.loginFailed(user, ip, failures, policy, now)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor authentication code"})
+		return
+	}
+	h.recordLoginAttempt(user.Username, ip, models.LoginSuccess)
+
+	h.completeLogin(c, user, true)
+}
+
+// HandleGetMyMFA returns the caller's two-factor authentication state
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Returns:
+//   - 200 OK with the state, whether the caller's role requires it and
+//     whether the current session was started with it
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetMyMFA(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	resp := MFAStatusResponse{
+		Required: h.MFARequired(c.GetString("role")),
+		Session:  c.GetBool("mfa"),
+	}
+
+	mfa, err := h.MFA.GetMFA(userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error getting two-factor authentication of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve two-factor authentication"})
+		return
+	}
+	if mfa != nil {
+		resp.Enabled = mfa.Enabled
+		resp.Pending = !mfa.Enabled
+		resp.RecoveryCodesLeft = mfa.RecoveryCodesLeft
+		resp.ConfirmedAt = mfa.ConfirmedAt
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleStartMFAEnrollment generates a TOTP secret for the caller. Login asks
+// for codes only once the enrolment is confirmed with POST /api/me/mfa/confirm;
+// starting again before that replaces the secret.
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Expected Request Body:
+//   - password: The caller's password
+//
+// Returns:
+//   - 200 OK with the secret and the otpauth:// provisioning URI to show as a QR code
+//   - 400 Bad Request if the password is missing
+//   - 403 Forbidden if the password is wrong
+//   - 409 Conflict if two-factor authentication is already enabled
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleStartMFAEnrollment(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	user, ok := h.checkMFAPassword(c, userID)
+	if !ok {
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Printf("Error generating TOTP secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor authentication"})
+		return
+	}
+
+	if err := h.MFA.StartMFAEnrollment(userID, secret); err != nil {
+		if errors.Is(err, models.ErrMFAEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+		log.Printf("Error starting two-factor authentication of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MFAEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.URI(h.mfaIssuer(), user.Username, secret),
+	})
+}
+
+// HandleConfirmMFA enables the caller's pending enrolment once the
+// authenticator app shows the right code
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Expected Request Body:
+//   - code: Current code from the authenticator app
+//
+// Returns:
+//   - 200 OK with the recovery codes, shown only this once
+//   - 400 Bad Request if the code is missing or no enrolment is pending
+//   - 403 Forbidden if the code is wrong
+//   - 409 Conflict if two-factor authentication is already enabled
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleConfirmMFA(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	mfa, err := h.MFA.GetMFA(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No two-factor enrolment is pending"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting two-factor authentication of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	if mfa.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	step, ok := totp.Verify(mfa.Secret, req.Code, time.Now(), MFASkew)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid code. Check the time on the device"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	if err := h.MFA.ConfirmMFA(userID, step, hashes); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+		log.Printf("Error enabling two-factor authentication of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{
+		Message:       "Two-factor authentication enabled. Keep the recovery codes somewhere safe",
+		RecoveryCodes: codes,
+	})
+}
+
+// HandleRegenerateRecoveryCodes replaces the caller's recovery codes, used or
+// not
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Expected Request Body:
+//   - password: The caller's password
+//
+// Returns:
+//   - 200 OK with the new recovery codes, shown only this once
+//   - 400 Bad Request if the password is missing or two-factor authentication is not enabled
+//   - 403 Forbidden if the password is wrong or the session was started without two-factor authentication
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleRegenerateRecoveryCodes(c *gin.Context) {
+	if !requireMFASession(c) {
+		return
+	}
+	userID := c.GetInt("user_id")
+	if _, ok := h.checkMFAPassword(c, userID); !ok {
+		return
+	}
+
+	mfa, err := h.MFA.GetMFA(userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error getting two-factor authentication of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replace recovery codes"})
+		return
+	}
+	if mfa == nil || !mfa.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replace recovery codes"})
+		return
+	}
+	if err := h.MFA.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		log.Printf("Error replacing recovery codes of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replace recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{
+		Message:       "Recovery codes replaced. The previous codes no longer work",
+		RecoveryCodes: codes,
+	})
+}
+
+// HandleDisableMFA turns off the caller's two-factor authentication
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Expected Request Body:
+//   - password: The caller's password
+//
+// Returns:
+//   - 200 OK once login no longer asks for a code
+//   - 400 Bad Request if the password is missing or two-factor authentication is not enabled
+//   - 403 Forbidden if the password is wrong, the session was started without
+//     two-factor authentication or the caller's role requires it
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleDisableMFA(c *gin.Context) {
+	if !requireMFASession(c) {
+		return
+	}
+	if h.MFARequired(c.GetString("role")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your role"})
+		return
+	}
+	userID := c.GetInt("user_id")
+	if _, ok := h.checkMFAPassword(c, userID); !ok {
+		return
+	}
+
+	if err := h.MFA.DisableMFA(userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+			return
+		}
+		log.Printf("Error disabling two-factor authentication of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// HandleResetUserMFA turns off a user's two-factor authentication, e.g. after
+// they lost their device and recovery codes
+// @Summary Reset two-factor authentication
+// @Description Removes a user's TOTP secret and recovery codes and revokes their sessions, so that they log in with the password alone and can enrol again
+// @Tags auth
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id}/mfa/reset [post]
+func (h *Handler) HandleResetUserMFA(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	if err := h.MFA.DisableMFA(userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found or not enrolled in two-factor authentication"})
+			return
+		}
+		log.Printf("Error resetting two-factor authentication of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reset two-factor authentication"})
+		return
+	}
+
+	// Sessions and pending challenges started with the old second factor end here
+	if err := h.Tokens.RevokeUserSessions(userID); err != nil {
+		log.Printf("Error revoking sessions for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Two-factor authentication reset but sessions could not be revoked"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Message: "Two-factor authentication reset successfully"})
+}
@@ -0,0 +1,275 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"wg-edu-server/mailer"
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultPasswordResetTTL is the lifetime of password reset tokens used when
+// the Handler does not configure it
+const DefaultPasswordResetTTL = time.Hour
+
+// ForgotPasswordRequest is used to request a password reset link
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest is used to set a new password with a reset token
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`        // Token from the reset link or the forced reset login response
+	NewPassword string `json:"new_password"` // Password to set
+}
+
+// PasswordChangeRequiredResponse is returned by login instead of tokens when
+// an admin has forced a password reset
+type PasswordChangeRequiredResponse struct {
+	Error      string `json:"error"`
+	ResetToken string `json:"reset_token"` // Token for POST /api/password/reset
+	ExpiresIn  int    `json:"expires_in"`  // Reset token lifetime in seconds
+}
+
+// passwordResetPolicy returns the configured reset request rate limits or the default
+func (h *Handler) passwordResetPolicy() models.LoginPolicy {
+	if h.PasswordResetPolicy == (models.LoginPolicy{}) {
+		return models.DefaultPasswordResetPolicy()
+	}
+	return h.PasswordResetPolicy
+}
+
+// passwordResetTTL returns the configured reset token lifetime or the default
+func (h *Handler) passwordResetTTL() time.Duration {
+	if h.PasswordResetTTL > 0 {
+		return h.PasswordResetTTL
+	}
+	return DefaultPasswordResetTTL
+}
+
+// createResetToken stores a new password reset token for a user
+//
+// Returns:
+//   - string: The token; only its hash is stored
+//   - error: Error if the token cannot be generated or stored
+func (h *Handler) createResetToken(userID int) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(h.passwordResetTTL())
+	if err := h.Tokens.CreatePasswordResetToken(userID, models.HashToken(token), expiresAt); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// resetLink adds a reset token to the configured reset page URL
+func (h *Handler) resetLink(token string) (string, error) {
+	u, err := url.Parse(h.PasswordResetURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// sendResetLink creates a reset token for a user and mails them the link
+func (h *Handler) sendResetLink(user *models.User, email string) error {
+	token, err := h.createResetToken(user.ID)
+	if err != nil {
+		return err
+	}
+	link, err := h.resetLink(token)
+	if err != nil {
+		return err
+	}
+
+	return h.Mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Reset your WG Education password",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"A password reset was requested for your WG Education account %q.\n"+
+			"Open this link within %s to choose a new password:\n\n%s\n\n"+
+			"If you did not ask for this, ignore this email and your password stays unchanged.\n",
+			user.Username, user.Username, h.passwordResetTTL(), link),
+	})
+}
+
+// sendResetLinks mails a reset link to every active account with an email
+// address. Failures are only logged; reporting them would reveal that an
+// account exists.
+func (h *Handler) sendResetLinks(email string) {
+	users, err := h.Users.GetUsersByEmail(email)
+	if err != nil {
+		log.Printf("Error looking up users for a password reset: %v", err)
+		return
+	}
+
+	for _, user := range users {
+		if !user.Active {
+			continue
+		}
+		if err := h.sendResetLink(user, email); err != nil {
+			log.Printf("Error sending password reset link to user %d: %v", user.ID, err)
+		}
+	}
+}
+
+// HandleForgotPassword mails a password reset link to every active account
+// with the given email address. The response is the same whether or not an
+// account exists, so the endpoint cannot be used to discover users: the
+// accounts are looked up and mailed in the background, after responding.
+// Requests are rate limited per email address and per client address, so
+// that the endpoint cannot flood a mailbox.
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Expected Request Body:
+//   - email: Email address of the student, teacher or guardian record
+//
+// Returns:
+//   - 202 Accepted, whether or not a link is sent
+//   - 400 Bad Request if the email is missing or too long
+//   - 429 Too Many Requests with Retry-After over the rate limit
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email is required"})
+		return
+	}
+	// Longer addresses fit no email column, nor the login_attempts username
+	if len(req.Email) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email is too long"})
+		return
+	}
+
+	key, ip, now := strings.ToLower(req.Email), c.ClientIP(), time.Now()
+	policy := h.passwordResetPolicy()
+	requests, err := h.LoginAttempts.CountPasswordResetRequests(key, ip, now.Add(-policy.Window))
+	if err != nil {
+		log.Printf("Error counting password reset requests for %q from %s: %v", key, ip, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request password reset"})
+		return
+	}
+	if wait := policy.RetryAfter(requests, now); wait > 0 {
+		tooManyRequests(c, wait, "Too many password reset requests. Try again later")
+		return
+	}
+	h.recordLoginAttempt(key, ip, models.LoginReset)
+
+	h.background.Add(1)
+	go func(email string) {
+		defer h.background.Done()
+		h.sendResetLinks(email)
+	}(req.Email)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the email belongs to an account, a reset link has been sent"})
+}
+
+// HandleResetPassword sets a new password with a reset token and revokes
+// every session of the user
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Expected Request Body:
+//   - token: Token from the reset link or the forced reset login response
+//   - new_password: Password to set
+//
+// Returns:
+//   - 200 OK once the password is set
+//   - 400 Bad Request if a field is missing, the password is too short or too long,
+//     or the token is invalid, expired or used
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if req.Token == "" || req.NewPassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token and new_password are required"})
+		return
+	}
+	if err := models.ValidatePassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := h.Tokens.ResetPassword(models.HashToken(req.Token), req.NewPassword)
+	if errors.Is(err, models.ErrInvalidResetToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reset token is invalid, expired or already used"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error resetting password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	// Whoever knew the old password is signed out
+	if err := h.Tokens.RevokeUserSessions(userID); err != nil {
+		log.Printf("Error revoking sessions after password reset of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password reset but sessions could not be revoked"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully. Log in with the new password"})
+}
+
+// HandleForcePasswordReset requires a user to choose a new password
+// @Summary Force password reset
+// @Description Revokes every session of a user; their next login returns a reset token instead of a session
+// @Tags auth
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id}/force-password-reset [post]
+func (h *Handler) HandleForcePasswordReset(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	if err := h.Users.RequirePasswordChange(userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+			return
+		}
+		log.Printf("Error forcing password reset of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to force password reset"})
+		return
+	}
+
+	if err := h.Tokens.RevokeUserSessions(userID); err != nil {
+		log.Printf("Error revoking sessions for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Password reset forced but sessions could not be revoked"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Message: "User must choose a new password at next login"})
+}
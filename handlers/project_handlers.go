@@ -0,0 +1,658 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"wg-edu-server/middleware"
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxDraftSize is the upload size of a project draft in bytes
+const maxDraftSize = 20 << 20
+
+// today returns midnight UTC of the current local date, matching how due dates are stored
+func today() time.Time {
+	date, _ := time.Parse(models.LessonDateLayout, time.Now().Format(models.LessonDateLayout))
+	return date
+}
+
+// projectError responds to an error from a project operation
+func projectError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+	case errors.Is(err, models.ErrProjectExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidProject):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// loadProject reads the project ID parameter and loads the project,
+// responding if anything fails
+//
+// Returns:
+//   - *models.Project: Project, or nil if a response has been sent
+func (h *Handler) loadProject(c *gin.Context) *models.Project {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return nil
+	}
+
+	project, err := h.Projects.GetProject(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error getting project %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve project"})
+		return nil
+	}
+	return project
+}
+
+// supervisesProject reports whether the caller supervises a project, or may
+// act for any supervisor with the projects:manage permission
+func supervisesProject(c *gin.Context, project *models.Project) bool {
+	return middleware.HasPermission(c, models.PermProjectsManage) ||
+		(middleware.HasPermission(c, models.PermProjectsSupervise) && project.SupervisorID == c.GetInt("user_id"))
+}
+
+// ownsProject reports whether the caller is the student a project belongs to
+func (h *Handler) ownsProject(c *gin.Context, project *models.Project) bool {
+	if !middleware.HasPermission(c, models.PermProjectsSubmit) {
+		return false
+	}
+	student, err := h.Students.GetStudentByUserID(c.GetInt("user_id"))
+	return err == nil && student.ID == project.StudentID
+}
+
+// canViewProject reports whether the caller may see a project: its student,
+// its supervisor, and users with projects:read or projects:manage
+func (h *Handler) canViewProject(c *gin.Context, project *models.Project) bool {
+	return middleware.HasPermission(c, models.PermProjectsRead) || supervisesProject(c, project) || h.ownsProject(c, project)
+}
+
+// parseMilestoneID reads the milestone ID parameter, responding if it is invalid
+//
+// Returns:
+//   - int: Milestone ID
+//   - bool: False if a response has been sent
+func parseMilestoneID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("milestoneId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid milestone ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// milestoneError responds to an error from a milestone operation
+func milestoneError(c *gin.Context, err error, message string) {
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Milestone not found"})
+		return
+	}
+	projectError(c, err, message)
+}
+
+// HandleGetProjectBoard shows the EEs and IAs of a grade with their milestone
+// status so coordinators see who is behind
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - grade: IB1 or IB2
+//   - kind: Optional ee or ia
+//   - date: Optional YYYY-MM-DD day to evaluate on, default today
+//
+// Returns:
+//   - 200 OK with the counts per status and the projects, those behind first
+//   - 400 Bad Request if a parameter is invalid
+//   - 403 Forbidden without the projects:read permission
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetProjectBoard(c *gin.Context) {
+	grade := c.Query("grade")
+	if !models.IsDiplomaGrade(grade) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid grade. Must be IB1 or IB2"})
+		return
+	}
+	kind := c.Query("kind")
+	if kind != "" && kind != models.ProjectEE && kind != models.ProjectIA {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid kind. Must be ee or ia"})
+		return
+	}
+	date := today()
+	if value := c.Query("date"); value != "" {
+		var err error
+		if date, err = time.Parse(models.LessonDateLayout, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date. Must be formatted as YYYY-MM-DD"})
+			return
+		}
+	}
+
+	projects, err := h.Projects.GetGradeProjects(grade, kind)
+	if err != nil {
+		log.Printf("Error getting projects of grade %s: %v", grade, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve projects"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.BuildProjectBoard(grade, kind, projects, date))
+}
+
+// HandleGetMyProjects retrieves the calling student's EE and IAs
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Returns:
+//   - 200 OK with the projects and their milestone status
+//   - 403 Forbidden without the projects:submit permission or if the caller is not a student
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetMyProjects(c *gin.Context) {
+	student, err := h.Students.GetStudentByUserID(c.GetInt("user_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only students have projects"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting student of user %d: %v", c.GetInt("user_id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve student"})
+		return
+	}
+
+	projects, err := h.Projects.GetStudentProjects(student.ID)
+	if err != nil {
+		log.Printf("Error getting projects of student %d: %v", student.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve projects"})
+		return
+	}
+
+	date := today()
+	for _, p := range projects {
+		p.Evaluate(date)
+	}
+	c.JSON(http.StatusOK, projects)
+}
+
+// HandleGetSupervisedProjects retrieves the projects the caller supervises
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Returns:
+//   - 200 OK with the projects and their milestone status, ordered by student name
+//   - 403 Forbidden without the projects:supervise permission
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetSupervisedProjects(c *gin.Context) {
+	projects, err := h.Projects.GetSupervisedProjects(c.GetInt("user_id"))
+	if err != nil {
+		log.Printf("Error getting projects supervised by user %d: %v", c.GetInt("user_id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve projects"})
+		return
+	}
+
+	date := today()
+	for _, p := range projects {
+		p.Evaluate(date)
+	}
+	c.JSON(http.StatusOK, projects)
+}
+
+// HandleCreateProject assigns a supervisor to a student's EE or IA
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Expected Request Body:
+//   - kind: ee or ia
+//   - student_id: IB1 or IB2 student
+//   - subject_id: IB subject; for an IA one the student is enrolled in
+//   - supervisor_id: User ID of an active teacher
+//   - title: Optional working title
+//   - milestones: Optional list of {"name", "due_date"} checkpoints
+//
+// Returns:
+//   - 201 Created with the project
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the projects:manage permission
+//   - 409 Conflict if the student already has an EE, or an IA in the subject
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleCreateProject(c *gin.Context) {
+	var req models.ProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	project, err := h.Projects.CreateProject(&req)
+	if err != nil {
+		projectError(c, err, "Failed to create project")
+		return
+	}
+
+	project.Evaluate(today())
+	c.JSON(http.StatusCreated, project)
+}
+
+// HandleGetProject retrieves a project with its milestones, drafts and comments.
+// Students see their own projects, supervisors the ones they supervise, and
+// projects:read all of them.
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Project ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with the project
+//   - 400 Bad Request if the project ID is invalid
+//   - 403 Forbidden if the caller may not see the project
+//   - 404 Not Found if the project doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetProject(c *gin.Context) {
+	project := h.loadProject(c)
+	if project == nil {
+		return
+	}
+	if !h.canViewProject(c, project) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You may not view this project"})
+		return
+	}
+
+	drafts, err := h.Projects.GetProjectDrafts(project.ID)
+	if err != nil {
+		log.Printf("Error getting drafts of project %d: %v", project.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve project"})
+		return
+	}
+	comments, err := h.Projects.GetProjectComments(project.ID)
+	if err != nil {
+		log.Printf("Error getting comments of project %d: %v", project.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve project"})
+		return
+	}
+
+	project.Evaluate(today())
+	c.JSON(http.StatusOK, models.ProjectDetails{Project: project, Drafts: drafts, Comments: comments})
+}
+
+// HandleUpdateProject changes a project's supervisor or title
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Project ID parameter from the URL
+//
+// Expected Request Body:
+//   - supervisor_id: User ID of an active teacher
+//   - title: Optional working title
+//
+// Returns:
+//   - 200 OK with the project
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the projects:manage permission
+//   - 404 Not Found if the project doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleUpdateProject(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	var req models.ProjectUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	project, err := h.Projects.UpdateProject(id, &req)
+	if err != nil {
+		projectError(c, err, "Failed to update project")
+		return
+	}
+
+	project.Evaluate(today())
+	c.JSON(http.StatusOK, project)
+}
+
+// HandleDeleteProject deletes a project with its milestones, drafts and comments
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Project ID parameter from the URL
+//
+// Returns:
+//   - 200 OK on success
+//   - 400 Bad Request if the project ID is invalid
+//   - 403 Forbidden without the projects:manage permission
+//   - 404 Not Found if the project doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleDeleteProject(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	keys, err := h.Projects.DeleteProject(id)
+	if err != nil {
+		projectError(c, err, "Failed to delete project")
+		return
+	}
+	h.deleteStoredFiles(keys...)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Project deleted successfully"})
+}
+
+// HandleAddMilestone adds a checkpoint to a project
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Project ID parameter from the URL
+//
+// Expected Request Body:
+//   - name: e.g. "Research question"
+//   - due_date: YYYY-MM-DD
+//
+// Returns:
+//   - 201 Created with the milestone
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the projects:manage permission
+//   - 404 Not Found if the project doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleAddMilestone(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	var req models.MilestoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	milestone, err := h.Projects.AddMilestone(id, &req)
+	if err != nil {
+		projectError(c, err, "Failed to add milestone")
+		return
+	}
+
+	c.JSON(http.StatusCreated, milestone)
+}
+
+// HandleUpdateMilestone renames a milestone or moves its due date
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Project ID parameter from the URL
+//   - milestoneId: Milestone ID parameter from the URL
+//
+// Expected Request Body:
+//   - The fields of HandleAddMilestone
+//
+// Returns:
+//   - 200 OK with the milestone
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the projects:manage permission
+//   - 404 Not Found if the project has no such milestone
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleUpdateMilestone(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+	milestoneID, ok := parseMilestoneID(c)
+	if !ok {
+		return
+	}
+
+	var req models.MilestoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	milestone, err := h.Projects.UpdateMilestone(id, milestoneID, &req)
+	if err != nil {
+		milestoneError(c, err, "Failed to update milestone")
+		return
+	}
+
+	c.JSON(http.StatusOK, milestone)
+}
+
+// HandleDeleteMilestone deletes a milestone; drafts uploaded for it are kept
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Project ID parameter from the URL
+//   - milestoneId: Milestone ID parameter from the URL
+//
+// Returns:
+//   - 200 OK on success
+//   - 400 Bad Request if an ID is invalid
+//   - 403 Forbidden without the projects:manage permission
+//   - 404 Not Found if the project has no such milestone
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleDeleteMilestone(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+	milestoneID, ok := parseMilestoneID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Projects.DeleteMilestone(id, milestoneID); err != nil {
+		milestoneError(c, err, "Failed to delete milestone")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Milestone deleted successfully"})
+}
+
+// HandleSetMilestoneCompletion signs off a milestone or reopens it
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Project ID parameter from the URL
+//   - milestoneId: Milestone ID parameter from the URL
+//
+// Expected Request Body:
+//   - completed: true to sign the milestone off, false to reopen it
+//
+// Returns:
+//   - 200 OK with the milestone
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the projects:supervise permission or if the caller does not supervise the project
+//   - 404 Not Found if the project or milestone doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleSetMilestoneCompletion(c *gin.Context) {
+	var req models.MilestoneCompletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	project := h.loadProject(c)
+	if project == nil {
+		return
+	}
+	milestoneID, ok := parseMilestoneID(c)
+	if !ok {
+		return
+	}
+	if !supervisesProject(c, project) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not supervise this project"})
+		return
+	}
+
+	milestone, err := h.Projects.SetMilestoneCompleted(project.ID, milestoneID, c.GetInt("user_id"), req.Completed)
+	if err != nil {
+		milestoneError(c, err, "Failed to update milestone")
+		return
+	}
+
+	c.JSON(http.StatusOK, milestone)
+}
+
+// HandleUploadProjectDraft uploads a draft of the calling student's project
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Project ID parameter from the URL
+//
+// Expected multipart form:
+//   - file: The draft
+//   - milestone_id: Optional milestone of the project the draft is for
+//
+// Returns:
+//   - 201 Created with the draft, without its content
+//   - 400 Bad Request if the file or milestone is invalid
+//   - 403 Forbidden without the projects:submit permission or if the project is not the caller's
+//   - 404 Not Found if the project doesn't exist
+//   - 413 Request Entity Too Large if the file exceeds 20 MB
+//   - 500 Internal Server Error on storage or database failure
+func (h *Handler) HandleUploadProjectDraft(c *gin.Context) {
+	project := h.loadProject(c)
+	if project == nil {
+		return
+	}
+	if !h.ownsProject(c, project) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You may only upload drafts of your own projects"})
+		return
+	}
+
+	upload := h.storeUpload(c, fmt.Sprintf("projects/%d/drafts/", project.ID), maxDraftSize)
+	if upload == nil {
+		return
+	}
+
+	draft := &models.ProjectDraft{
+		Filename:    upload.Filename,
+		ContentType: upload.ContentType,
+		Size:        upload.Size,
+		StorageKey:  upload.StorageKey,
+		UploadedBy:  c.GetInt("user_id"),
+	}
+	if value := c.PostForm("milestone_id"); value != "" {
+		var err error
+		if draft.MilestoneID, err = strconv.Atoi(value); err != nil {
+			h.deleteStoredFiles(draft.StorageKey)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid milestone ID"})
+			return
+		}
+	}
+
+	// Drop the file if the project or milestone is refused
+	stored, err := h.Projects.AddProjectDraft(project.ID, draft)
+	if err != nil {
+		h.deleteStoredFiles(draft.StorageKey)
+		projectError(c, err, "Failed to upload draft")
+		return
+	}
+
+	c.JSON(http.StatusCreated, stored)
+}
+
+// HandleDownloadProjectDraft downloads a draft of a project the caller may see
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Project ID parameter from the URL
+//   - draftId: Draft ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with the file as an attachment
+//   - 400 Bad Request if an ID is invalid
+//   - 403 Forbidden if the caller may not see the project
+//   - 404 Not Found if the project has no such draft
+//   - 500 Internal Server Error on storage or database failure
+func (h *Handler) HandleDownloadProjectDraft(c *gin.Context) {
+	project := h.loadProject(c)
+	if project == nil {
+		return
+	}
+	draftID, err := strconv.Atoi(c.Param("draftId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid draft ID"})
+		return
+	}
+	if !h.canViewProject(c, project) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You may not view this project"})
+		return
+	}
+
+	draft, err := h.Projects.GetProjectDraft(project.ID, draftID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Draft not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting draft %d of project %d: %v", draftID, project.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve draft"})
+		return
+	}
+
+	h.sendStoredFile(c, draft.StorageKey, draft.Filename, draft.ContentType, draft.Size)
+}
+
+// HandleAddProjectComment comments on a project the caller supervises
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Project ID parameter from the URL
+//
+// Expected Request Body:
+//   - body: Comment text
+//   - draft_id: Optional draft of the project the comment is about
+//
+// Returns:
+//   - 201 Created with the comment
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the projects:supervise permission or if the caller does not supervise the project
+//   - 404 Not Found if the project doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleAddProjectComment(c *gin.Context) {
+	var req models.ProjectCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	project := h.loadProject(c)
+	if project == nil {
+		return
+	}
+	if !supervisesProject(c, project) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not supervise this project"})
+		return
+	}
+
+	comment, err := h.Projects.AddProjectComment(project.ID, c.GetInt("user_id"), &req)
+	if err != nil {
+		projectError(c, err, "Failed to add comment")
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
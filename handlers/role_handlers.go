@@ -0,0 +1,204 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetUserRoleRequest represents the request body for changing a user's role
+type SetUserRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// GetAllPermissions handles GET request to list every permission known to the API
+// @Summary Get all permissions
+// @Description Lists the permissions that can be granted to roles
+// @Tags roles
+// @Produce json
+// @Success 200 {array} string
+// @Router /api/admin/permissions [get]
+func (h *Handler) GetAllPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, models.AllPermissions)
+}
+
+// GetAllRoles handles GET request to retrieve all roles
+// @Summary Get all roles
+// @Description Retrieves all roles with their permissions
+// @Tags roles
+// @Produce json
+// @Success 200 {array} models.Role
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/roles [get]
+func (h *Handler) GetAllRoles(c *gin.Context) {
+	roles, err := h.Roles.GetAllRoles()
+	if err != nil {
+		log.Printf("Error getting roles: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// GetRole handles GET request to retrieve a role by name
+// @Summary Get role
+// @Description Retrieves a role with its permissions
+// @Tags roles
+// @Produce json
+// @Param name path string true "Role name"
+// @Success 200 {object} models.Role
+// @Failure 404 {object} ErrorResponse
+// @Router /api/admin/roles/{name} [get]
+func (h *Handler) GetRole(c *gin.Context) {
+	role, err := h.Roles.GetRole(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Role not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// CreateRole handles POST request to create a role
+// @Summary Create role
+// @Description Creates a role from a set of permissions
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Param request body models.RoleRequest true "Role definition"
+// @Success 201 {object} models.Role
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/roles [post]
+func (h *Handler) CreateRole(c *gin.Context) {
+	var req models.RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	role, err := h.Roles.CreateRole(&req)
+	if err != nil {
+		h.roleError(c, err, "Failed to create role")
+		return
+	}
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole handles PUT request to replace a role's description and permissions
+// @Summary Update role
+// @Description Replaces the description and full permission set of a role
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Param name path string true "Role name"
+// @Param request body models.RoleRequest true "Role definition"
+// @Success 200 {object} models.Role
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/roles/{name} [put]
+func (h *Handler) UpdateRole(c *gin.Context) {
+	var req models.RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	role, err := h.Roles.UpdateRole(c.Param("name"), &req)
+	if err != nil {
+		h.roleError(c, err, "Failed to update role")
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole handles DELETE request to delete a role
+// @Summary Delete role
+// @Description Deletes a role that is not built in and not assigned to any user
+// @Tags roles
+// @Produce json
+// @Param name path string true "Role name"
+// @Success 200 {object} SuccessResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/roles/{name} [delete]
+func (h *Handler) DeleteRole(c *gin.Context) {
+	if err := h.Roles.DeleteRole(c.Param("name")); err != nil {
+		h.roleError(c, err, "Failed to delete role")
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Message: "Role deleted successfully"})
+}
+
+// SetUserRole handles PUT request to change a user's role
+// @Summary Set user role
+// @Description Assigns a role to a user. Permissions are resolved per request, so the change applies immediately.
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body SetUserRoleRequest true "New role"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id}/role [put]
+func (h *Handler) SetUserRole(c *gin.Context) {
+	idStr := c.Param("id")
+	userID, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	var req SetUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Role == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	if err := h.Roles.SetUserRole(userID, req.Role); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User or role not found"})
+			return
+		}
+		log.Printf("Error setting role of user %d to %s: %v", userID, req.Role, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to set user role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Message: "User role updated successfully"})
+}
+
+// roleError maps role store errors to HTTP responses
+func (h *Handler) roleError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Role not found"})
+	case errors.Is(err, models.ErrInvalidRoleName),
+		errors.Is(err, models.ErrUnknownPermission),
+		errors.Is(err, models.ErrAdminLockout):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrSystemRole), errors.Is(err, models.ErrRoleInUse):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	case models.IsDuplicate(err):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Role already exists"})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: message})
+	}
+}
@@ -8,33 +8,32 @@ import (
 	"wg-edu-server/models"
 )
 
-// HandleGetAllStudents retrieves all students
+// HandleGetAllStudents retrieves a page of students
 //
 // Parameters:
 //   - c: Gin context containing the request and response
+//   - limit, page, cursor, sort, q: Common list query parameters
+//   - filter[grade], filter[email], filter[username]: Exact-match filters
 //
 // Returns:
-//   - 200 OK with array of students on success
-//   - 401 Unauthorized if not authenticated as admin
+//   - 200 OK with a page of students, the total and the next cursor on success
+//   - 400 Bad Request if a list parameter is invalid
+//   - 403 Forbidden without the students:read permission
 //   - 500 Internal Server Error on database failure
 func (h *Handler) HandleGetAllStudents(c *gin.Context) {
-	// Validate admin role
-	claims, err := h.validateAdminToken(c)
+	params, err := parseListParams(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized - Admin access required"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	students, err := h.DB.GetAllStudents()
+	students, err := h.Students.ListStudents(params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve students"})
+		listError(c, err, "Failed to retrieve students")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"students": students,
-		"admin_id": claims.UserID,
-	})
+	c.JSON(http.StatusOK, students)
 }
 
 // HandleGetStudent retrieves a specific student by ID
@@ -46,17 +45,10 @@ func (h *Handler) HandleGetAllStudents(c *gin.Context) {
 // Returns:
 //   - 200 OK with student object on success
 //   - 400 Bad Request if student ID is invalid
-//   - 401 Unauthorized if not authenticated as admin
+//   - 403 Forbidden without the students:read permission
 //   - 404 Not Found if student doesn't exist
 //   - 500 Internal Server Error on database failure
 func (h *Handler) HandleGetStudent(c *gin.Context) {
-	// Validate admin role
-	_, err := h.validateAdminToken(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized - Admin access required"})
-		return
-	}
-
 	// Parse student ID from path parameter
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
@@ -65,7 +57,7 @@ func (h *Handler) HandleGetStudent(c *gin.Context) {
 		return
 	}
 
-	student, err := h.DB.GetStudentByID(id)
+	student, err := h.Students.GetStudentByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
 		return
@@ -90,16 +82,9 @@ func (h *Handler) HandleGetStudent(c *gin.Context) {
 // Returns:
 //   - 201 Created with the new student object on success
 //   - 400 Bad Request if request data is invalid
-//   - 401 Unauthorized if not authenticated as admin
+//   - 403 Forbidden without the students:write permission
 //   - 500 Internal Server Error on database failure
 func (h *Handler) HandleCreateStudent(c *gin.Context) {
-	// Validate admin role
-	_, err := h.validateAdminToken(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized - Admin access required"})
-		return
-	}
-
 	var req models.StudentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
@@ -111,8 +96,12 @@ func (h *Handler) HandleCreateStudent(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required fields"})
 		return
 	}
+	if err := models.ValidatePassword(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	student, err := h.DB.CreateStudent(&req)
+	student, err := h.Students.CreateStudent(&req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create student"})
 		return
@@ -137,16 +126,9 @@ func (h *Handler) HandleCreateStudent(c *gin.Context) {
 // Returns:
 //   - 200 OK with the updated student object on success
 //   - 400 Bad Request if request data or ID is invalid
-//   - 401 Unauthorized if not authenticated as admin
+//   - 403 Forbidden without the students:write permission
 //   - 500 Internal Server Error on database failure
 func (h *Handler) HandleUpdateStudent(c *gin.Context) {
-	// Validate admin role
-	_, err := h.validateAdminToken(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized - Admin access required"})
-		return
-	}
-
 	// Parse student ID from path parameter
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
@@ -166,8 +148,14 @@ func (h *Handler) HandleUpdateStudent(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required fields"})
 		return
 	}
+	if req.Password != "" {
+		if err := models.ValidatePassword(req.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
-	student, err := h.DB.UpdateStudent(id, &req)
+	student, err := h.Students.UpdateStudent(id, &req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update student"})
 		return
@@ -185,16 +173,9 @@ func (h *Handler) HandleUpdateStudent(c *gin.Context) {
 // Returns:
 //   - 200 OK with success message on successful deletion
 //   - 400 Bad Request if student ID is invalid
-//   - 401 Unauthorized if not authenticated as admin
+//   - 403 Forbidden without the students:write permission
 //   - 500 Internal Server Error on database failure
 func (h *Handler) HandleDeleteStudent(c *gin.Context) {
-	// Validate admin role
-	_, err := h.validateAdminToken(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized - Admin access required"})
-		return
-	}
-
 	// Parse student ID from path parameter
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
@@ -203,7 +184,7 @@ func (h *Handler) HandleDeleteStudent(c *gin.Context) {
 		return
 	}
 
-	err = h.DB.DeleteStudent(id)
+	err = h.Students.DeleteStudent(id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete student"})
 		return
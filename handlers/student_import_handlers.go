@@ -0,0 +1,256 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits on student import files
+const (
+	maxImportFileSize = 10 << 20 // Upload size in bytes
+	maxImportRows     = 2000     // Students per file
+)
+
+// HandleImportStudents creates students in bulk from a CSV or XLSX file
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - dry_run: Query parameter; when true the rows are validated but not written
+//   - report: Query parameter; "csv" returns the per-row errors as a CSV download
+//
+// Expected multipart form:
+//   - file: CSV or XLSX file whose first row holds the column headers
+//   - format: "csv" or "xlsx" (optional, taken from the file extension otherwise)
+//   - mapping: JSON object mapping student fields to column headers, e.g.
+//     {"first_name": "Given name"} (optional, headers default to the field names)
+//
+// Every row needs first_name, last_name, email, grade, username and password.
+// Students are created in one transaction, so nothing is written unless every
+// row is valid.
+//
+// Returns:
+//   - 200 OK with the validation result and per-row errors on a dry run
+//   - 201 Created with the created students on success
+//   - 400 Bad Request if the file, format or mapping is invalid
+//   - 403 Forbidden without the students:write permission
+//   - 413 Request Entity Too Large if the file exceeds 10 MB
+//   - 422 Unprocessable Entity with the per-row errors if any row is invalid and nothing was written
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleImportStudents(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Import file is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing import file"})
+		return
+	}
+
+	mapping, err := parseImportMapping(c.PostForm("mapping"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sheet, err := readImportFile(fileHeader, c.PostForm("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := mapStudentRows(sheet, mapping)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+	result, err := h.Students.ImportStudents(rows, dryRun)
+	if err != nil {
+		log.Printf("Error importing students: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import students"})
+		return
+	}
+
+	status := http.StatusCreated
+	if dryRun {
+		status = http.StatusOK
+	} else if !result.Valid {
+		status = http.StatusUnprocessableEntity
+	}
+
+	if c.Query("report") == "csv" {
+		writeImportReport(c, status, result)
+		return
+	}
+	c.JSON(status, result)
+}
+
+// parseImportMapping parses the optional field to column header mapping
+//
+// Parameters:
+//   - raw: JSON object from the mapping form field, or empty
+//
+// Returns:
+//   - map[string]string: Column header for each mapped field
+//   - error: If the JSON is invalid or names an unknown field
+func parseImportMapping(raw string) (map[string]string, error) {
+	mapping := map[string]string{}
+	if raw == "" {
+		return mapping, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+		return nil, errors.New("Invalid column mapping")
+	}
+
+	known := map[string]bool{}
+	for _, field := range models.StudentImportFields {
+		known[field] = true
+	}
+	for field := range mapping {
+		if !known[field] {
+			return nil, fmt.Errorf("Unknown field %q in column mapping", field)
+		}
+	}
+	return mapping, nil
+}
+
+// readImportFile reads the rows of an uploaded CSV or XLSX file
+//
+// Parameters:
+//   - fileHeader: Uploaded file
+//   - format: "csv", "xlsx", or empty to use the file extension
+//
+// Returns:
+//   - []sheetRow: Non-empty rows, the first being the header
+//   - error: If the format is unsupported or the file cannot be read
+func readImportFile(fileHeader *multipart.FileHeader, format string) ([]sheetRow, error) {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(fileHeader.Filename), ".")
+	}
+	format = strings.ToLower(format)
+	if format != "csv" && format != "xlsx" {
+		return nil, errors.New("Unsupported file format, use CSV or XLSX")
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, errors.New("Failed to read import file")
+	}
+	defer file.Close()
+
+	var rows []sheetRow
+	if format == "csv" {
+		rows, err = readCSV(file, maxImportRows+1)
+	} else {
+		rows, err = readXLSX(file, fileHeader.Size, maxImportRows+1)
+	}
+	if errors.Is(err, errSheetTooLong) {
+		return nil, fmt.Errorf("Import file has more than %d students", maxImportRows)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read import file: %v", err)
+	}
+	return rows, nil
+}
+
+// normalizeHeader makes column headers comparable: "First Name" matches first_name
+func normalizeHeader(header string) string {
+	header = strings.ToLower(strings.TrimSpace(header))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(header)
+}
+
+// mapStudentRows turns spreadsheet rows into import rows using the header row
+//
+// Parameters:
+//   - sheet: Rows of the file, the first being the header
+//   - mapping: Column header for each field that is not named after the field
+//
+// Returns:
+//   - []models.StudentImportRow: One row per student
+//   - error: If the header lacks a column, or the file is empty
+func mapStudentRows(sheet []sheetRow, mapping map[string]string) ([]models.StudentImportRow, error) {
+	if len(sheet) < 2 {
+		return nil, errors.New("Import file has no students")
+	}
+	headers := map[string]int{}
+	for i, header := range sheet[0].Cells {
+		if _, ok := headers[normalizeHeader(header)]; !ok {
+			headers[normalizeHeader(header)] = i
+		}
+	}
+
+	columns := map[string]int{}
+	var missing []string
+	for _, field := range models.StudentImportFields {
+		header := field
+		if mapped, ok := mapping[field]; ok {
+			header = mapped
+		}
+		col, ok := headers[normalizeHeader(header)]
+		if !ok {
+			missing = append(missing, header)
+			continue
+		}
+		columns[field] = col
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("Missing columns: %s", strings.Join(missing, ", "))
+	}
+
+	rows := make([]models.StudentImportRow, 0, len(sheet)-1)
+	for _, row := range sheet[1:] {
+		cell := func(field string) string {
+			if col := columns[field]; col < len(row.Cells) {
+				return row.Cells[col]
+			}
+			return ""
+		}
+		rows = append(rows, models.StudentImportRow{
+			Row: row.Line,
+			StudentRequest: models.StudentRequest{
+				FirstName: cell("first_name"),
+				LastName:  cell("last_name"),
+				Email:     cell("email"),
+				Grade:     cell("grade"),
+				Username:  cell("username"),
+				Password:  cell("password"),
+			},
+		})
+	}
+	return rows, nil
+}
+
+// writeImportReport responds with the per-row errors of an import as a CSV download
+func writeImportReport(c *gin.Context, status int, result *models.StudentImportResult) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="student-import-errors.csv"`)
+	c.Status(status)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"row", "field", "value", "error"})
+	for _, e := range result.Errors {
+		w.Write([]string{strconv.Itoa(e.Row), e.Field, e.Value, e.Message})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Printf("Error writing student import report: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"wg-edu-server/middleware"
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// canViewSubject reports whether the user may see the records of a subject,
+// such as attendance or marks: with the read permission for any subject, with
+// the teaching permission for the subjects they are assigned to
+//
+// Parameters:
+//   - c: Gin context populated by LoadPermissions
+//   - subjectID: Subject whose records are requested
+//   - readPermission: Permission granting access to every subject
+//   - teachPermission: Permission granting access to the user's own subjects
+//
+// Returns:
+//   - bool: True if the user may see the records
+//   - error: Error if the teacher's subjects cannot be loaded
+func (h *Handler) canViewSubject(c *gin.Context, subjectID int, readPermission, teachPermission string) (bool, error) {
+	if middleware.HasPermission(c, readPermission) {
+		return true, nil
+	}
+	if !middleware.HasPermission(c, teachPermission) {
+		return false, nil
+	}
+
+	subjects, err := h.Teachers.GetTeacherSubjects(c.GetInt("user_id"))
+	if err != nil {
+		return false, err
+	}
+	for _, subject := range subjects {
+		if subject.ID == subjectID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// requireSubjectAccess responds with 403 unless the user may see the records
+// of a subject, see canViewSubject
+//
+// Returns:
+//   - bool: True if the request may continue
+func (h *Handler) requireSubjectAccess(c *gin.Context, subjectID int, readPermission, teachPermission string) bool {
+	allowed, err := h.canViewSubject(c, subjectID, readPermission, teachPermission)
+	if err != nil {
+		log.Printf("Error checking access to subject %d: %v", subjectID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only teachers of this subject may view its records"})
+		return false
+	}
+	return true
+}
+
+// subjectWithAccess reads the subject ID parameter, loads the subject and
+// checks the user may see its records, responding if anything fails
+//
+// Returns:
+//   - *models.Subject: Subject, or nil if a response has been sent
+func (h *Handler) subjectWithAccess(c *gin.Context, readPermission, teachPermission string) *models.Subject {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subject ID"})
+		return nil
+	}
+
+	subject, err := h.Subjects.GetSubjectByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subject not found"})
+		return nil
+	}
+
+	if !h.requireSubjectAccess(c, subject.ID, readPermission, teachPermission) {
+		return nil
+	}
+	return subject
+}
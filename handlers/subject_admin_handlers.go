@@ -0,0 +1,128 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// includeArchived reports whether the include_archived query parameter is set
+func includeArchived(c *gin.Context) bool {
+	include, _ := strconv.ParseBool(c.Query("include_archived"))
+	return include
+}
+
+// CreateSubject handles POST request to add a subject to the catalogue
+// @Summary Create subject
+// @Description Adds a subject. IB1/IB2 subjects need a group (1-6) and at least one level; PIB subjects have neither.
+// @Tags subjects
+// @Accept json
+// @Produce json
+// @Param request body models.SubjectRequest true "Subject definition"
+// @Success 201 {object} models.Subject
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/subjects [post]
+func (h *Handler) CreateSubject(c *gin.Context) {
+	var req models.SubjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	subject, err := h.Subjects.CreateSubject(&req)
+	if err != nil {
+		h.subjectError(c, err, "Failed to create subject")
+		return
+	}
+
+	c.JSON(http.StatusCreated, subject)
+}
+
+// UpdateSubject handles PUT request to replace a subject's definition
+// @Summary Update subject
+// @Description Replaces a subject's definition. Set archived to retire a subject; existing enrollments and teacher assignments are kept.
+// @Tags subjects
+// @Accept json
+// @Produce json
+// @Param id path int true "Subject ID"
+// @Param request body models.SubjectRequest true "Subject definition"
+// @Success 200 {object} models.Subject
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/subjects/{id} [put]
+func (h *Handler) UpdateSubject(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid subject ID"})
+		return
+	}
+
+	var req models.SubjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	subject, err := h.Subjects.UpdateSubject(id, &req)
+	if err != nil {
+		h.subjectError(c, err, "Failed to update subject")
+		return
+	}
+
+	c.JSON(http.StatusOK, subject)
+}
+
+// DeleteSubject handles DELETE request to remove a subject from the catalogue
+// @Summary Delete subject
+// @Description Deletes a subject that has no enrollments, teacher assignments, lessons, assessments or projects. Used subjects must be archived instead.
+// @Tags subjects
+// @Produce json
+// @Param id path int true "Subject ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/subjects/{id} [delete]
+func (h *Handler) DeleteSubject(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid subject ID"})
+		return
+	}
+
+	if err := h.Subjects.DeleteSubject(id); err != nil {
+		h.subjectError(c, err, "Failed to delete subject")
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Message: "Subject deleted successfully"})
+}
+
+// subjectError maps subject store errors to HTTP responses
+func (h *Handler) subjectError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Subject not found"})
+	case errors.Is(err, models.ErrInvalidSubject):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrSubjectInUse):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	case models.IsDuplicate(err):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "A subject with this name already exists for the grade"})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: message})
+	}
+}
@@ -0,0 +1,204 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateTeacher handles POST request to create a teacher with their login account
+// @Summary Create teacher
+// @Description Creates a teacher profile and login account in one transaction
+// @Tags teachers
+// @Accept json
+// @Produce json
+// @Param request body models.TeacherRequest true "Teacher details"
+// @Success 201 {object} models.Teacher
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/teachers [post]
+func (h *Handler) CreateTeacher(c *gin.Context) {
+	var req models.TeacherRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	if req.FirstName == "" || req.LastName == "" || req.Email == "" || req.Username == "" || req.Password == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing required fields"})
+		return
+	}
+	if err := models.ValidatePassword(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	teacher, err := h.Teachers.CreateTeacher(&req)
+	if err != nil {
+		if models.IsDuplicate(err) {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "Username or email already in use"})
+			return
+		}
+		log.Printf("Error creating teacher %s: %v", req.Username, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create teacher"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, teacher)
+}
+
+// UpdateTeacher handles PUT request to update a teacher's profile
+// @Summary Update teacher
+// @Description Updates a teacher's name and email, and their password if given
+// @Tags teachers
+// @Accept json
+// @Produce json
+// @Param id path int true "Teacher ID"
+// @Param request body models.TeacherRequest true "Teacher details"
+// @Success 200 {object} models.Teacher
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/teachers/{id} [put]
+func (h *Handler) UpdateTeacher(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid teacher ID"})
+		return
+	}
+
+	var req models.TeacherRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	if req.FirstName == "" || req.LastName == "" || req.Email == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing required fields"})
+		return
+	}
+	if req.Password != "" {
+		if err := models.ValidatePassword(req.Password); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	teacher, err := h.Teachers.UpdateTeacher(id, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Teacher not found"})
+		case models.IsDuplicate(err):
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "Email already in use"})
+		default:
+			log.Printf("Error updating teacher %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update teacher"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, teacher)
+}
+
+// DeactivateTeacher handles POST request to deactivate a teacher
+// @Summary Deactivate teacher
+// @Description Blocks a teacher from logging in and revokes their sessions. Their data and subject assignments are kept.
+// @Tags teachers
+// @Produce json
+// @Param id path int true "Teacher ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/teachers/{id}/deactivate [post]
+func (h *Handler) DeactivateTeacher(c *gin.Context) {
+	h.setTeacherActive(c, false)
+}
+
+// ActivateTeacher handles POST request to reactivate a teacher
+// @Summary Activate teacher
+// @Description Allows a deactivated teacher to log in again
+// @Tags teachers
+// @Produce json
+// @Param id path int true "Teacher ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/teachers/{id}/activate [post]
+func (h *Handler) ActivateTeacher(c *gin.Context) {
+	h.setTeacherActive(c, true)
+}
+
+// setTeacherActive changes whether the teacher in the id path parameter may log in
+func (h *Handler) setTeacherActive(c *gin.Context, active bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid teacher ID"})
+		return
+	}
+
+	if err := h.Teachers.SetTeacherActive(id, active); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Teacher not found"})
+			return
+		}
+		log.Printf("Error setting active=%t for teacher %d: %v", active, id, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update teacher"})
+		return
+	}
+
+	if !active {
+		// End sessions that were started before the deactivation
+		if err := h.Tokens.RevokeUserSessions(id); err != nil {
+			log.Printf("Error revoking sessions for deactivated teacher %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Teacher deactivated but sessions could not be revoked"})
+			return
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Teacher deactivated successfully"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Message: "Teacher activated successfully"})
+}
+
+// DeleteTeacher handles DELETE request to delete a teacher
+// @Summary Delete teacher
+// @Description Deletes a teacher together with their login account, profile and subject assignments
+// @Tags teachers
+// @Produce json
+// @Param id path int true "Teacher ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/teachers/{id} [delete]
+func (h *Handler) DeleteTeacher(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid teacher ID"})
+		return
+	}
+
+	if err := h.Teachers.DeleteTeacher(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Teacher not found"})
+			return
+		}
+		log.Printf("Error deleting teacher %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete teacher"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Message: "Teacher deleted successfully"})
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -20,46 +22,67 @@ type SuccessResponse struct {
 	Message string `json:"message"`
 }
 
-// GetAllSubjects handles GET request to retrieve all subjects
+// GetAllSubjects handles GET request to retrieve a page of subjects
 // @Summary Get all subjects
-// @Description Retrieves a list of all subjects
+// @Description Retrieves a page of subjects. Archived subjects are omitted unless include_archived=true.
 // @Tags subjects
 // @Produce json
-// @Success 200 {array} models.Subject
+// @Param include_archived query bool false "Include archived subjects"
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param page query int false "Page number"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "Sort fields: id, grade, name, group, archived, created_at; prefix - for descending"
+// @Param filter[grade] query string false "Filter by grade"
+// @Param filter[group] query int false "Filter by IB subject group"
+// @Param q query string false "Search name and description"
+// @Success 200 {object} models.ListResult[models.Subject]
+// @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/subjects [get]
 func (h *Handler) GetAllSubjects(c *gin.Context) {
-	subjects, err := h.DB.GetAllSubjects()
+	params, err := parseListParams(c)
 	if err != nil {
-		log.Printf("Error getting subjects: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve subjects"})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	subjects, err := h.Subjects.ListSubjects(params, includeArchived(c))
+	if err != nil {
+		listError(c, err, "Failed to retrieve subjects")
 		return
 	}
 
 	c.JSON(http.StatusOK, subjects)
 }
 
-// GetSubjectsByGrade handles GET request to retrieve subjects by grade
+// GetSubjectsByGrade handles GET request to retrieve a page of subjects of a grade
 // @Summary Get subjects by grade
-// @Description Retrieves a list of subjects for a specific grade
+// @Description Retrieves a page of subjects for a specific grade. Accepts the same list parameters as GET /api/subjects.
 // @Tags subjects
 // @Produce json
 // @Param grade path string true "Grade (PIB, IB1, IB2)"
-// @Success 200 {array} models.Subject
+// @Param include_archived query bool false "Include archived subjects"
+// @Success 200 {object} models.ListResult[models.Subject]
 // @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/subjects/{grade} [get]
 func (h *Handler) GetSubjectsByGrade(c *gin.Context) {
 	grade := c.Param("grade")
-	if grade != "PIB" && grade != "IB1" && grade != "IB2" {
+	if !models.IsValidGrade(grade) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid grade. Must be PIB, IB1, or IB2"})
 		return
 	}
 
-	subjects, err := h.DB.GetSubjectsByGrade(grade)
+	params, err := parseListParams(c)
 	if err != nil {
-		log.Printf("Error getting subjects for grade %s: %v", grade, err)
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve subjects"})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	params.Filters["grade"] = grade
+
+	subjects, err := h.Subjects.ListSubjects(params, includeArchived(c))
+	if err != nil {
+		listError(c, err, "Failed to retrieve subjects")
 		return
 	}
 
@@ -85,7 +108,7 @@ func (h *Handler) GetSubjectByID(c *gin.Context) {
 		return
 	}
 
-	subject, err := h.DB.GetSubjectByID(id)
+	subject, err := h.Subjects.GetSubjectByID(id)
 	if err != nil {
 		log.Printf("Error getting subject with ID %d: %v", id, err)
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Subject not found"})
@@ -95,19 +118,32 @@ func (h *Handler) GetSubjectByID(c *gin.Context) {
 	c.JSON(http.StatusOK, subject)
 }
 
-// GetAllTeachers handles GET request to retrieve all teachers with their subjects
+// GetAllTeachers handles GET request to retrieve a page of teachers with their subjects
 // @Summary Get all teachers
-// @Description Retrieves a list of all teachers with their assigned subjects
+// @Description Retrieves a page of teachers with their assigned subjects
 // @Tags teachers
 // @Produce json
-// @Success 200 {array} models.Teacher
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param page query int false "Page number"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "Sort fields: id, username, first_name, last_name, email, active; prefix - for descending"
+// @Param filter[email] query string false "Filter by email"
+// @Param filter[active] query bool false "Filter by active status"
+// @Param q query string false "Search username, names and email"
+// @Success 200 {object} models.ListResult[models.Teacher]
+// @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/teachers [get]
 func (h *Handler) GetAllTeachers(c *gin.Context) {
-	teachers, err := h.DB.GetAllTeachers()
+	params, err := parseListParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	teachers, err := h.Teachers.ListTeachers(params)
 	if err != nil {
-		log.Printf("Error getting teachers: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve teachers"})
+		listError(c, err, "Failed to retrieve teachers")
 		return
 	}
 
@@ -133,7 +169,7 @@ func (h *Handler) GetTeacherByID(c *gin.Context) {
 		return
 	}
 
-	teacher, err := h.DB.GetTeacherByID(id)
+	teacher, err := h.Teachers.GetTeacherByID(id)
 	if err != nil {
 		log.Printf("Error getting teacher with ID %d: %v", id, err)
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Teacher not found"})
@@ -159,15 +195,10 @@ type AssignSubjectRequest struct {
 // @Success 200 {object} SuccessResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/teachers/{id}/subjects [post]
 func (h *Handler) AssignSubjectToTeacher(c *gin.Context) {
-	// Verify admin role
-	if !isAdmin(c) {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized: Admin access required"})
-		return
-	}
-
 	idStr := c.Param("id")
 	teacherID, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -181,7 +212,15 @@ func (h *Handler) AssignSubjectToTeacher(c *gin.Context) {
 		return
 	}
 
-	err = h.DB.AssignSubjectToTeacher(teacherID, req.SubjectID)
+	err = h.Teachers.AssignSubjectToTeacher(teacherID, req.SubjectID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Teacher or subject not found"})
+		return
+	}
+	if errors.Is(err, models.ErrSubjectArchived) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Archived subjects cannot be assigned"})
+		return
+	}
 	if err != nil {
 		log.Printf("Error assigning subject %d to teacher %d: %v", req.SubjectID, teacherID, err)
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to assign subject to teacher"})
@@ -200,16 +239,10 @@ func (h *Handler) AssignSubjectToTeacher(c *gin.Context) {
 // @Param subjectId path int true "Subject ID"
 // @Success 200 {object} SuccessResponse
 // @Failure 400 {object} ErrorResponse
-// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/teachers/{id}/subjects/{subjectId} [delete]
 func (h *Handler) RemoveSubjectFromTeacher(c *gin.Context) {
-	// Verify admin role
-	if !isAdmin(c) {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized: Admin access required"})
-		return
-	}
-
 	teacherIDStr := c.Param("id")
 	teacherID, err := strconv.Atoi(teacherIDStr)
 	if err != nil {
@@ -224,7 +257,7 @@ func (h *Handler) RemoveSubjectFromTeacher(c *gin.Context) {
 		return
 	}
 
-	err = h.DB.RemoveSubjectFromTeacher(teacherID, subjectID)
+	err = h.Teachers.RemoveSubjectFromTeacher(teacherID, subjectID)
 	if err != nil {
 		log.Printf("Error removing subject %d from teacher %d: %v", subjectID, teacherID, err)
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to remove subject from teacher"})
@@ -236,14 +269,15 @@ func (h *Handler) RemoveSubjectFromTeacher(c *gin.Context) {
 
 // GetAllSubjectsGrouped handles GET request to retrieve all subjects grouped by grade
 // @Summary Get all subjects grouped by grade
-// @Description Retrieves a list of all subjects organized by grade level
+// @Description Retrieves a list of all subjects organized by grade level. Archived subjects are omitted unless include_archived=true.
 // @Tags subjects
 // @Produce json
+// @Param include_archived query bool false "Include archived subjects"
 // @Success 200 {object} map[string][]models.Subject
 // @Failure 500 {object} ErrorResponse
 // @Router /api/subjects/grouped [get]
 func (h *Handler) GetAllSubjectsGrouped(c *gin.Context) {
-	subjects, err := h.DB.GetAllSubjects()
+	subjects, err := h.Subjects.GetAllSubjects(includeArchived(c))
 	if err != nil {
 		log.Printf("Error getting subjects: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve subjects"})
@@ -259,12 +293,3 @@ func (h *Handler) GetAllSubjectsGrouped(c *gin.Context) {
 
 	c.JSON(http.StatusOK, grouped)
 }
-
-// Helper function to check if user has admin role
-func isAdmin(c *gin.Context) bool {
-	role, exists := c.Get("role")
-	if !exists {
-		return false
-	}
-	return role == "admin"
-}
@@ -0,0 +1,708 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timetableError responds to an error from a timetable operation
+//
+// Parameters:
+//   - notFound: Message sent when the slot, room or lesson does not exist
+//   - duplicate: Message sent when a unique name is taken
+func timetableError(c *gin.Context, err error, notFound, duplicate, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	case errors.Is(err, models.ErrInvalidTimetable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrSlotInUse), errors.Is(err, models.ErrRoomInUse), errors.Is(err, models.ErrSubjectArchived):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case models.IsDuplicate(err):
+		c.JSON(http.StatusConflict, gin.H{"error": duplicate})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// parseTimetableFilter reads the optional teacher_id, student_id, room_id and
+// day query parameters, responding if one is invalid
+//
+// Returns:
+//   - models.TimetableFilter: Filter, zero fields for absent parameters
+//   - bool: False if a response has been sent
+func parseTimetableFilter(c *gin.Context) (models.TimetableFilter, bool) {
+	var filter models.TimetableFilter
+	for name, field := range map[string]*int{
+		"teacher_id": &filter.TeacherID,
+		"student_id": &filter.StudentID,
+		"room_id":    &filter.RoomID,
+		"day":        &filter.Day,
+	} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+			return filter, false
+		}
+		*field = n
+	}
+	if filter.Day > len(models.Weekdays) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid day. Must be 1 (Monday) to 7 (Sunday)"})
+		return filter, false
+	}
+	return filter, true
+}
+
+// timetable responds with the weekly timetable of the lessons matching a filter
+func (h *Handler) timetable(c *gin.Context, timetable models.Timetable, filter models.TimetableFilter) {
+	lessons, err := h.Timetable.GetTimetableLessons(filter)
+	if err != nil {
+		log.Printf("Error getting timetable %+v: %v", filter, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve timetable"})
+		return
+	}
+
+	timetable.Days = models.BuildTimetable(lessons)
+	c.JSON(http.StatusOK, timetable)
+}
+
+// teacherTimetable responds with a teacher's weekly timetable
+func (h *Handler) teacherTimetable(c *gin.Context, teacher *models.Teacher) {
+	name := strings.TrimSpace(teacher.FirstName + " " + teacher.LastName)
+	if name == "" {
+		name = teacher.Username
+	}
+	h.timetable(c, models.Timetable{TeacherID: teacher.ID, Name: name}, models.TimetableFilter{TeacherID: teacher.ID})
+}
+
+// studentTimetable responds with the weekly timetable of a student's subjects
+func (h *Handler) studentTimetable(c *gin.Context, student *models.Student) {
+	h.timetable(c, models.Timetable{
+		StudentID: student.ID,
+		Name:      student.FirstName + " " + student.LastName,
+	}, models.TimetableFilter{StudentID: student.ID})
+}
+
+// HandleGetTimeSlots retrieves the periods of the school day
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Returns:
+//   - 200 OK with the time slots ordered by start time
+//   - 403 Forbidden without the timetable:read permission
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetTimeSlots(c *gin.Context) {
+	slots, err := h.Timetable.GetTimeSlots()
+	if err != nil {
+		log.Printf("Error getting time slots: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve time slots"})
+		return
+	}
+
+	c.JSON(http.StatusOK, slots)
+}
+
+// HandleCreateTimeSlot adds a period to the school day
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Expected Request Body:
+//   - name: Unique name, e.g. "Period 1"
+//   - start_time, end_time: HH:MM; the slot may not overlap another
+//
+// Returns:
+//   - 201 Created with the time slot
+//   - 400 Bad Request if the input is invalid or overlaps another slot
+//   - 403 Forbidden without the timetable:manage permission
+//   - 409 Conflict if the name is taken
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleCreateTimeSlot(c *gin.Context) {
+	var req models.TimeSlotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	slot, err := h.Timetable.CreateTimeSlot(&req)
+	if err != nil {
+		timetableError(c, err, "Time slot not found", "A time slot with this name already exists", "Failed to create time slot")
+		return
+	}
+
+	c.JSON(http.StatusCreated, slot)
+}
+
+// HandleUpdateTimeSlot renames a time slot or moves its times. Lessons
+// scheduled in the slot move with it.
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Time slot ID parameter from the URL
+//
+// Expected Request Body:
+//   - name: Unique name
+//   - start_time, end_time: HH:MM; the slot may not overlap another
+//
+// Returns:
+//   - 200 OK with the time slot
+//   - 400 Bad Request if the input is invalid or overlaps another slot
+//   - 403 Forbidden without the timetable:manage permission
+//   - 404 Not Found if the time slot doesn't exist
+//   - 409 Conflict if the name is taken
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleUpdateTimeSlot(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time slot ID"})
+		return
+	}
+
+	var req models.TimeSlotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	slot, err := h.Timetable.UpdateTimeSlot(id, &req)
+	if err != nil {
+		timetableError(c, err, "Time slot not found", "A time slot with this name already exists", "Failed to update time slot")
+		return
+	}
+
+	c.JSON(http.StatusOK, slot)
+}
+
+// HandleDeleteTimeSlot deletes a time slot without scheduled lessons
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Time slot ID parameter from the URL
+//
+// Returns:
+//   - 200 OK on success
+//   - 400 Bad Request if the time slot ID is invalid
+//   - 403 Forbidden without the timetable:manage permission
+//   - 404 Not Found if the time slot doesn't exist
+//   - 409 Conflict if lessons are scheduled in the slot
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleDeleteTimeSlot(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time slot ID"})
+		return
+	}
+
+	if err := h.Timetable.DeleteTimeSlot(id); err != nil {
+		timetableError(c, err, "Time slot not found", "", "Failed to delete time slot")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Time slot deleted successfully"})
+}
+
+// HandleGetRooms retrieves every room
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Returns:
+//   - 200 OK with the rooms ordered by name
+//   - 403 Forbidden without the timetable:read permission
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetRooms(c *gin.Context) {
+	rooms, err := h.Timetable.GetRooms()
+	if err != nil {
+		log.Printf("Error getting rooms: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rooms"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rooms)
+}
+
+// HandleCreateRoom adds a room
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Expected Request Body:
+//   - name: Unique name, e.g. "Lab 2"
+//   - capacity: Optional number of seats
+//
+// Returns:
+//   - 201 Created with the room
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the timetable:manage permission
+//   - 409 Conflict if the name is taken
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleCreateRoom(c *gin.Context) {
+	var req models.RoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	room, err := h.Timetable.CreateRoom(&req)
+	if err != nil {
+		timetableError(c, err, "Room not found", "A room with this name already exists", "Failed to create room")
+		return
+	}
+
+	c.JSON(http.StatusCreated, room)
+}
+
+// HandleUpdateRoom renames a room or changes its capacity
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Room ID parameter from the URL
+//
+// Expected Request Body:
+//   - name: Unique name
+//   - capacity: Optional number of seats
+//
+// Returns:
+//   - 200 OK with the room
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the timetable:manage permission
+//   - 404 Not Found if the room doesn't exist
+//   - 409 Conflict if the name is taken
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleUpdateRoom(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	var req models.RoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	room, err := h.Timetable.UpdateRoom(id, &req)
+	if err != nil {
+		timetableError(c, err, "Room not found", "A room with this name already exists", "Failed to update room")
+		return
+	}
+
+	c.JSON(http.StatusOK, room)
+}
+
+// HandleDeleteRoom deletes a room without scheduled lessons
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Room ID parameter from the URL
+//
+// Returns:
+//   - 200 OK on success
+//   - 400 Bad Request if the room ID is invalid
+//   - 403 Forbidden without the timetable:manage permission
+//   - 404 Not Found if the room doesn't exist
+//   - 409 Conflict if lessons are scheduled in the room
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleDeleteRoom(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	if err := h.Timetable.DeleteRoom(id); err != nil {
+		timetableError(c, err, "Room not found", "", "Failed to delete room")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Room deleted successfully"})
+}
+
+// HandleGetTimetableLessons retrieves scheduled lessons
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - teacher_id: Optional teacher's user ID
+//   - student_id: Optional student ID; lessons of subjects the student is enrolled in
+//   - room_id: Optional room ID
+//   - day: Optional day, 1 (Monday) to 7 (Sunday)
+//
+// Returns:
+//   - 200 OK with the lessons ordered by day and time
+//   - 400 Bad Request if a parameter is invalid
+//   - 403 Forbidden without the timetable:read permission
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetTimetableLessons(c *gin.Context) {
+	filter, ok := parseTimetableFilter(c)
+	if !ok {
+		return
+	}
+
+	lessons, err := h.Timetable.GetTimetableLessons(filter)
+	if err != nil {
+		log.Printf("Error getting timetable lessons %+v: %v", filter, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve lessons"})
+		return
+	}
+
+	c.JSON(http.StatusOK, lessons)
+}
+
+// saveTimetableLesson responds to scheduling or moving a lesson, with the
+// conflicts if the lesson clashes with another
+func saveTimetableLesson(c *gin.Context, status int, lesson *models.TimetableLesson, conflicts []models.TimetableConflict, err error, message string) {
+	if err != nil {
+		timetableError(c, err, "Lesson not found", "The lesson conflicts with another lesson", message)
+		return
+	}
+	if len(conflicts) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "The lesson conflicts with the timetable", "conflicts": conflicts})
+		return
+	}
+
+	c.JSON(status, lesson)
+}
+
+// HandleCreateTimetableLesson schedules a weekly lesson after checking that
+// the teacher, the room and the subject's students are free at the time
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Expected Request Body:
+//   - subject_id: Subject that is not archived
+//   - teacher_id: User ID of a teacher assigned to the subject
+//   - room_id: Room the lesson is held in
+//   - day: 1 (Monday) to 7 (Sunday)
+//   - slot_id: Time slot of the lesson
+//
+// Returns:
+//   - 201 Created with the lesson
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the timetable:manage permission
+//   - 409 Conflict with the conflicting lessons if the teacher, room or
+//     students are already booked, or if the subject is archived
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleCreateTimetableLesson(c *gin.Context) {
+	var req models.TimetableLessonRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	lesson, conflicts, err := h.Timetable.CreateTimetableLesson(&req)
+	saveTimetableLesson(c, http.StatusCreated, lesson, conflicts, err, "Failed to schedule lesson")
+}
+
+// HandleUpdateTimetableLesson moves a lesson to another day, time slot or
+// room, or changes its teacher, after checking for conflicts
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Lesson ID parameter from the URL
+//
+// Expected Request Body:
+//   - subject_id, teacher_id, room_id, day, slot_id: As when scheduling
+//
+// Returns:
+//   - 200 OK with the lesson
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the timetable:manage permission
+//   - 404 Not Found if the lesson doesn't exist
+//   - 409 Conflict with the conflicting lessons if the teacher, room or
+//     students are already booked, or if the subject is archived
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleUpdateTimetableLesson(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lesson ID"})
+		return
+	}
+
+	var req models.TimetableLessonRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	lesson, conflicts, err := h.Timetable.UpdateTimetableLesson(id, &req)
+	saveTimetableLesson(c, http.StatusOK, lesson, conflicts, err, "Failed to update lesson")
+}
+
+// HandleDeleteTimetableLesson removes a lesson from the timetable
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Lesson ID parameter from the URL
+//
+// Returns:
+//   - 200 OK on success
+//   - 400 Bad Request if the lesson ID is invalid
+//   - 403 Forbidden without the timetable:manage permission
+//   - 404 Not Found if the lesson doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleDeleteTimetableLesson(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lesson ID"})
+		return
+	}
+
+	if err := h.Timetable.DeleteTimetableLesson(id); err != nil {
+		timetableError(c, err, "Lesson not found", "", "Failed to delete lesson")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Lesson deleted successfully"})
+}
+
+// HandleGetExams retrieves the exam schedule
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - subject_id: Optional subject ID
+//
+// Returns:
+//   - 200 OK with the exams ordered by start time
+//   - 400 Bad Request if the subject ID is invalid
+//   - 403 Forbidden without the timetable:read permission
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetExams(c *gin.Context) {
+	subjectID := 0
+	if value := c.Query("subject_id"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subject_id"})
+			return
+		}
+		subjectID = n
+	}
+
+	exams, err := h.Timetable.GetExams(subjectID)
+	if err != nil {
+		log.Printf("Error getting exams of subject %d: %v", subjectID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve exams"})
+		return
+	}
+
+	c.JSON(http.StatusOK, exams)
+}
+
+// HandleCreateExam schedules an exam
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Expected Request Body:
+//   - subject_id: Subject that is not archived
+//   - name: Name of the paper, e.g. "Paper 1"
+//   - starts_at: Local start time as YYYY-MM-DDTHH:MM
+//   - duration_minutes: Length of the sitting, 1 to 600
+//   - location: Optional place the exam is sat
+//
+// Returns:
+//   - 201 Created with the exam
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the timetable:manage permission
+//   - 409 Conflict if the subject is archived
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleCreateExam(c *gin.Context) {
+	var req models.ExamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	exam, err := h.Timetable.CreateExam(&req)
+	if err != nil {
+		timetableError(c, err, "Exam not found", "", "Failed to schedule exam")
+		return
+	}
+
+	c.JSON(http.StatusCreated, exam)
+}
+
+// HandleUpdateExam moves, renames or relocates an exam
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Exam ID parameter from the URL
+//
+// Expected Request Body:
+//   - subject_id: Subject that is not archived
+//   - name: Name of the paper
+//   - starts_at: Local start time as YYYY-MM-DDTHH:MM
+//   - duration_minutes: Length of the sitting, 1 to 600
+//   - location: Optional place the exam is sat
+//
+// Returns:
+//   - 200 OK with the exam
+//   - 400 Bad Request if the input is invalid
+//   - 403 Forbidden without the timetable:manage permission
+//   - 404 Not Found if the exam doesn't exist
+//   - 409 Conflict if the subject is archived
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleUpdateExam(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exam ID"})
+		return
+	}
+
+	var req models.ExamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	exam, err := h.Timetable.UpdateExam(id, &req)
+	if err != nil {
+		timetableError(c, err, "Exam not found", "", "Failed to update exam")
+		return
+	}
+
+	c.JSON(http.StatusOK, exam)
+}
+
+// HandleDeleteExam removes an exam from the schedule
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Exam ID parameter from the URL
+//
+// Returns:
+//   - 200 OK on success
+//   - 400 Bad Request if the exam ID is invalid
+//   - 403 Forbidden without the timetable:manage permission
+//   - 404 Not Found if the exam doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleDeleteExam(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exam ID"})
+		return
+	}
+
+	if err := h.Timetable.DeleteExam(id); err != nil {
+		timetableError(c, err, "Exam not found", "", "Failed to delete exam")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Exam deleted successfully"})
+}
+
+// HandleGetTeacherTimetable retrieves a teacher's weekly timetable
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Teacher's user ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with Monday to Friday, and weekend days with lessons
+//   - 400 Bad Request if the teacher ID is invalid
+//   - 403 Forbidden without the timetable:read permission
+//   - 404 Not Found if the teacher doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetTeacherTimetable(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid teacher ID"})
+		return
+	}
+
+	teacher, err := h.Teachers.GetTeacherByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Teacher not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting teacher %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve teacher"})
+		return
+	}
+	h.teacherTimetable(c, teacher)
+}
+
+// HandleGetStudentTimetable retrieves the weekly timetable of a student's subjects
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//   - id: Student ID parameter from the URL
+//
+// Returns:
+//   - 200 OK with Monday to Friday, and weekend days with lessons
+//   - 400 Bad Request if the student ID is invalid
+//   - 403 Forbidden without the timetable:read permission
+//   - 404 Not Found if the student doesn't exist
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetStudentTimetable(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID"})
+		return
+	}
+
+	student, err := h.Students.GetStudentByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting student %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve student"})
+		return
+	}
+	h.studentTimetable(c, student)
+}
+
+// HandleGetMyTimetable retrieves the caller's weekly timetable: a student's
+// subjects, or the lessons a teacher teaches
+//
+// Parameters:
+//   - c: Gin context containing the request and response
+//
+// Returns:
+//   - 200 OK with Monday to Friday, and weekend days with lessons
+//   - 403 Forbidden if the caller is neither a student nor a teacher
+//   - 500 Internal Server Error on database failure
+func (h *Handler) HandleGetMyTimetable(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	student, err := h.Students.GetStudentByUserID(userID)
+	if err == nil {
+		h.studentTimetable(c, student)
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error getting student of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve timetable"})
+		return
+	}
+
+	teacher, err := h.Teachers.GetTeacherByID(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only students and teachers have timetables"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting teacher %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve timetable"})
+		return
+	}
+	h.teacherTimetable(c, teacher)
+}
@@ -0,0 +1,243 @@
+// Package handlers provides HTTP request handlers for the application's API endpoints
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"wg-edu-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Default token lifetimes used when the Handler does not configure them
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// TokenResponse represents a freshly issued access/refresh token pair
+type TokenResponse struct {
+	Token        string `json:"token"`         // Short-lived access token
+	RefreshToken string `json:"refresh_token"` // Single-use refresh token
+	ExpiresIn    int    `json:"expires_in"`    // Access token lifetime in seconds
+}
+
+// RefreshRequest represents the request body for refreshing or revoking a refresh token
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// HandleRefreshToken exchanges a refresh token for a new token pair
+// @Summary Refresh access token
+// @Description Rotates a refresh token and returns a new access/refresh token pair.
+// @Description Presenting a refresh token that was already rotated revokes all of the user's sessions.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body RefreshRequest true "Refresh token"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/token/refresh [post]
+func (h *Handler) HandleRefreshToken(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	stored, err := h.Tokens.GetRefreshTokenByHash(models.HashToken(req.RefreshToken))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error looking up refresh token: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid refresh token"})
+		return
+	}
+
+	if stored.RevokedAt != nil {
+		// A rotated token being presented again means it was stolen, so kill
+		// every session of the user rather than guessing which copy is legitimate.
+		if stored.ReplacedBy != nil {
+			log.Printf("Refresh token reuse detected for user %d, revoking all sessions", stored.UserID)
+			if err := h.Tokens.RevokeUserSessions(stored.UserID); err != nil {
+				log.Printf("Error revoking sessions for user %d: %v", stored.UserID, err)
+			}
+		}
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid refresh token"})
+		return
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Refresh token expired"})
+		return
+	}
+
+	user, err := h.Users.GetUserByID(stored.UserID)
+	if err != nil || !user.Active {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid refresh token"})
+		return
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate token"})
+		return
+	}
+
+	_, err = h.Tokens.RotateRefreshToken(stored.ID, models.HashToken(refreshToken), time.Now().Add(h.refreshTokenTTL()))
+	if err != nil {
+		if errors.Is(err, models.ErrTokenRevoked) {
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid refresh token"})
+			return
+		}
+		log.Printf("Error rotating refresh token for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate token"})
+		return
+	}
+
+	// The new session keeps the two-factor state of the one it replaces
+	token, err := createToken(user, h.JWTSecret, h.accessTokenTTL(), stored.MFA)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(h.accessTokenTTL().Seconds()),
+	})
+}
+
+// HandleLogout revokes the caller's access token and, optionally, refresh token
+// @Summary Log out
+// @Description Adds the current access token to the denylist and revokes the given refresh token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body RefreshRequest false "Refresh token to revoke"
+// @Success 200 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/logout [post]
+func (h *Handler) HandleLogout(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	jti := c.GetString("jti")
+	expiresAt := c.GetTime("token_expires_at")
+	if userID == 0 || jti == "" {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Authentication required"})
+		return
+	}
+
+	// The body is optional; a client without a refresh token can still log out
+	var req RefreshRequest
+	_ = c.ShouldBindJSON(&req)
+
+	if err := h.Tokens.RevokeAccessToken(jti, userID, expiresAt); err != nil {
+		log.Printf("Error revoking access token for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to log out"})
+		return
+	}
+
+	if req.RefreshToken != "" {
+		if err := h.Tokens.RevokeRefreshToken(userID, models.HashToken(req.RefreshToken)); err != nil {
+			log.Printf("Error revoking refresh token for user %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to log out"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Message: "Logged out successfully"})
+}
+
+// HandleRevokeUserSessions revokes every session of a user
+// @Summary Revoke user sessions
+// @Description Revokes all refresh tokens of a user and rejects every access token issued to them so far
+// @Tags auth
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id}/revoke-sessions [post]
+func (h *Handler) HandleRevokeUserSessions(c *gin.Context) {
+	idStr := c.Param("id")
+	userID, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	if _, err := h.Users.GetUserByID(userID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		return
+	}
+
+	if err := h.Tokens.RevokeUserSessions(userID); err != nil {
+		log.Printf("Error revoking sessions for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Message: "User sessions revoked successfully"})
+}
+
+// issueTokens creates an access token and a stored refresh token for a user.
+// mfa records whether the user completed two-factor authentication.
+func (h *Handler) issueTokens(user *models.User, mfa bool) (*TokenResponse, error) {
+	token, err := createToken(user, h.JWTSecret, h.accessTokenTTL(), mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = h.Tokens.CreateRefreshToken(user.ID, models.HashToken(refreshToken), time.Now().Add(h.refreshTokenTTL()), mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(h.accessTokenTTL().Seconds()),
+	}, nil
+}
+
+// accessTokenTTL returns the configured access token lifetime or the default
+func (h *Handler) accessTokenTTL() time.Duration {
+	if h.AccessTokenTTL > 0 {
+		return h.AccessTokenTTL
+	}
+	return DefaultAccessTokenTTL
+}
+
+// refreshTokenTTL returns the configured refresh token lifetime or the default
+func (h *Handler) refreshTokenTTL() time.Duration {
+	if h.RefreshTokenTTL > 0 {
+		return h.RefreshTokenTTL
+	}
+	return DefaultRefreshTokenTTL
+}
+
+// randomToken returns n random bytes encoded as unpadded base64url
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,62 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Log is a mailer for local development. Messages are never delivered:
+// they are written to the log, or saved as .eml files when a directory is set.
+type Log struct {
+	dir  string // Directory messages are saved in, empty to log them
+	from string // From header of the rendered messages
+}
+
+var _ Mailer = (*Log)(nil)
+
+// NewLog creates a Log mailer, creating the directory if needed
+//
+// Parameters:
+//   - dir: Directory to save messages in, or empty to write them to the log
+//   - from: Sender address shown in the messages
+//
+// Returns:
+//   - *Log: Mailer keeping messages locally
+//   - error: Error if the directory cannot be created
+func NewLog(dir, from string) (*Log, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return nil, fmt.Errorf("creating mail directory: %w", err)
+		}
+	}
+	return &Log{dir: dir, from: from}, nil
+}
+
+// Send logs the message or saves it to a file named after the time it was sent
+func (l *Log) Send(msg Message) error {
+	data, err := format(l.from, msg)
+	if err != nil {
+		return err
+	}
+
+	if l.dir == "" {
+		log.Printf("Mail to %s (not delivered):\n%s", msg.To, data)
+		return nil
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := filepath.Join(l.dir, time.Now().Format("20060102-150405")+"-"+hex.EncodeToString(suffix)+".eml")
+	if err := os.WriteFile(name, data, 0o640); err != nil {
+		return err
+	}
+	log.Printf("Mail to %s saved to %s", msg.To, name)
+	return nil
+}
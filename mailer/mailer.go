@@ -0,0 +1,56 @@
+// Package mailer provides pluggable delivery of plain text email, such as
+// password reset links. SMTP sends real mail; Log writes messages to the log
+// or a directory for local development.
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+)
+
+// ErrInvalidMessage is returned for messages without a recipient or with
+// line breaks in a header, which could inject further headers
+var ErrInvalidMessage = errors.New("invalid mail message")
+
+// Message is a plain text email
+type Message struct {
+	To      string // Recipient address
+	Subject string // Subject line
+	Body    string // Plain text body
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	// Send delivers a message or returns an error if it could not be handed over
+	Send(msg Message) error
+}
+
+// format validates a message and renders it with its headers as an RFC 5322
+// message with CRLF line endings
+func format(from string, msg Message) ([]byte, error) {
+	if msg.To == "" {
+		return nil, fmt.Errorf("%w: no recipient", ErrInvalidMessage)
+	}
+	for _, header := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, fmt.Errorf("%w: line break in header", ErrInvalidMessage)
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,65 @@
+package mailer
+
+import (
+	"net"
+	"net/mail"
+	"net/smtp"
+)
+
+// SMTP sends messages through an SMTP server. net/smtp upgrades the
+// connection with STARTTLS when the server offers it and refuses to send
+// credentials over an unencrypted connection to a remote host.
+type SMTP struct {
+	host     string
+	addr     string // host:port
+	username string // Empty to send without authentication
+	password string
+	from     string // From header, e.g. "WG Education <no-reply@example.com>"
+}
+
+var _ Mailer = (*SMTP)(nil)
+
+// NewSMTP creates an SMTP mailer
+//
+// Parameters:
+//   - host, port: SMTP server, e.g. smtp.example.com and 587
+//   - username, password: Credentials for PLAIN authentication, empty for none
+//   - from: Sender address, optionally with a display name
+//
+// Returns:
+//   - *SMTP: Mailer sending through the server
+//   - error: Error if the sender address cannot be parsed
+func NewSMTP(host, port, username, password, from string) (*SMTP, error) {
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, err
+	}
+	return &SMTP{
+		host:     host,
+		addr:     net.JoinHostPort(host, port),
+		username: username,
+		password: password,
+		from:     from,
+	}, nil
+}
+
+// Send delivers the message to the SMTP server
+func (s *SMTP) Send(msg Message) error {
+	data, err := format(s.from, msg)
+	if err != nil {
+		return err
+	}
+	sender, err := mail.ParseAddress(s.from)
+	if err != nil {
+		return err
+	}
+	recipient, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+	return smtp.SendMail(s.addr, auth, sender.Address, []string{recipient.Address}, data)
+}
@@ -2,13 +2,16 @@ package main
 
 import (
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
+	"time"
 	"wg-edu-server/config"
 	"wg-edu-server/handlers"
+	"wg-edu-server/mailer"
+	"wg-edu-server/migrations"
 	"wg-edu-server/models"
 	"wg-edu-server/routes"
+	"wg-edu-server/storage"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq" // PostgreSQL driver
@@ -16,43 +19,150 @@ import (
 
 func main() {
 	// Load configuration
-	config := config.NewConfig()
+	config, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	log.Printf("Loaded configuration: %s", config)
 
 	// Connect to the database
-	db, err := models.NewDB(
-		config.DBHost,
-		config.DBPort,
-		config.DBName,
-		config.DBUser,
-		config.DBPassword,
-	)
+	db, err := models.NewDB(models.ConnOptions{
+		Host:            config.DBHost,
+		Port:            config.DBPort,
+		Name:            config.DBName,
+		User:            config.DBUser,
+		Password:        config.DBPassword,
+		SSLMode:         config.DBSSLMode,
+		MaxOpenConns:    config.DBMaxOpenConns,
+		MaxIdleConns:    config.DBMaxIdleConns,
+		ConnMaxLifetime: config.DBConnMaxLifetime,
+	})
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer db.Close()
 	log.Println("Connected to database")
 
-	// Initialize database schema
-	if err := initializeDatabase(db); err != nil {
-		log.Printf("Warning: failed to initialize database schema: %v", err)
+	// Select the password hasher used for all password writes
+	hasher, err := models.NewPasswordHasher(config.PasswordHasher)
+	if err != nil {
+		log.Fatalf("Invalid password hasher: %v", err)
 	}
+	db.Hasher = hasher
 
-	// Create test users
-	if err := CreateTestUsers(db); err != nil {
-		log.Printf("Warning: failed to create test users: %v", err)
+	// Store TOTP secrets encrypted with a key derived from the JWT secret
+	db.MFAKey = models.MFASecretKey(config.JWTSecret)
+
+	// Handle the migrate subcommand without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(db, os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	// Apply pending schema migrations
+	if err := migrateUp(db); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	// Create test users and seed data; these have well-known passwords and
+	// must never exist outside development
+	if config.IsDevelopment() {
+		if err := CreateTestUsers(db); err != nil {
+			log.Printf("Warning: failed to create test users: %v", err)
+		}
+
+		// Link test users to sample student records and subjects
+		if err := migrations.Seed(db.DB); err != nil {
+			log.Printf("Warning: failed to apply seed data: %v", err)
+		}
+	}
+
+	// Encrypt TOTP secrets stored before secrets were encrypted
+	if encrypted, err := db.EncryptMFASecrets(); err != nil {
+		log.Printf("Warning: failed to encrypt two-factor secrets: %v", err)
+	} else if encrypted > 0 {
+		log.Printf("Encrypted %d two-factor secrets", encrypted)
+	}
+
+	// Drop expired refresh tokens and denylist entries
+	if purged, err := db.PurgeExpiredTokens(); err != nil {
+		log.Printf("Warning: failed to purge expired tokens: %v", err)
+	} else if purged > 0 {
+		log.Printf("Purged %d expired tokens", purged)
 	}
 
 	// Create handler with dependencies
-	handler := &handlers.Handler{
-		DB:        db,
-		JWTSecret: config.JWTSecret,
-	}   
+	handler := handlers.NewHandler(db, config.JWTSecret)
+	handler.AccessTokenTTL = config.AccessTokenTTL
+	handler.RefreshTokenTTL = config.RefreshTokenTTL
+	handler.AttendanceThreshold = config.AttendanceThreshold
+	handler.PublicURL = config.PublicURL
+	handler.PasswordResetURL = config.PasswordResetURL
+	handler.PasswordResetTTL = config.PasswordResetTTL
+	handler.MFAIssuer = config.MFAIssuer
+	handler.MFARequiredRoles = config.MFARequiredRoles
+
+	// Store uploaded files on the local disk
+	files, err := storage.NewLocal(config.StorageDir)
+	if err != nil {
+		log.Fatalf("Failed to open file storage: %v", err)
+	}
+	handler.Files = files
+
+	// Move drafts uploaded while drafts were kept in the database
+	if moved, err := db.MoveProjectDraftsToStorage(files); err != nil {
+		log.Printf("Warning: failed to move project drafts to file storage: %v", err)
+	} else if moved > 0 {
+		log.Printf("Moved %d project drafts to file storage", moved)
+	}
+
+	// Deliver mail over SMTP, or keep it local during development
+	var mail mailer.Mailer
+	if config.MailDriver == "smtp" {
+		mail, err = mailer.NewSMTP(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.MailFrom)
+	} else {
+		mail, err = mailer.NewLog(config.MailDir, config.MailFrom)
+	}
+	if err != nil {
+		log.Fatalf("Failed to set up mail delivery: %v", err)
+	}
+	handler.Mailer = mail
+
+	// Count login attempts in PostgreSQL so limits hold across instances, or in
+	// this process only
+	handler.LoginPolicy = models.LoginPolicy{
+		Window:           config.LoginWindow,
+		MaxIPFailures:    config.LoginMaxIPFailures,
+		MaxUserFailures:  config.LoginMaxUserFailures,
+		FreeFailures:     config.LoginFreeFailures,
+		Delay:            config.LoginDelay,
+		MaxDelay:         config.LoginMaxDelay,
+		LockoutThreshold: config.LoginLockoutThreshold,
+		LockoutDuration:  config.LoginLockoutDuration,
+	}
+	retention := config.LoginAttemptsRetention
+	if config.LoginAttemptsBackend == "memory" {
+		handler.LoginAttempts = models.NewMemoryStore()
+		retention = config.LoginWindow // Keep memory bounded
+	}
+	go purgeLoginAttempts(handler.LoginAttempts, retention)
 
 	// Setup Gin router
+	if !config.IsDevelopment() {
+		gin.SetMode(gin.ReleaseMode)
+	}
 	router := gin.Default()
 
+	// Take the client address from X-Forwarded-For only behind trusted proxies,
+	// so that clients cannot dodge the login rate limit with a forged header
+	if err := router.SetTrustedProxies(config.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+
 	// Setup routes
-	routes.SetupRoutes(router, handler)
+	routes.SetupRoutes(router, handler, config.CORSAllowedOrigins)
 
 	// Start the server
 	log.Printf("Server starting on port %s", config.ServerPort)
@@ -61,36 +171,17 @@ func main() {
 	}
 }
 
-// InitializeDatabase sets up the database schema
-func initializeDatabase(db *models.DB) error {
-	// Read schema files
-	schemaFiles := []string{
-		"schema_teachers.sql",
-	}
-
-	for _, file := range schemaFiles {
-		// Check if file exists
-		if _, err := os.Stat(file); os.IsNotExist(err) {
-			log.Printf("Schema file %s not found, skipping", file)
-			continue
-		}
-
-		// Read file content
-		content, err := ioutil.ReadFile(file)
-		if err != nil {
-			return fmt.Errorf("failed to read schema file %s: %v", file, err)
-		}
-
-		// Execute SQL
-		_, err = db.Exec(string(content))
-		if err != nil {
-			return fmt.Errorf("failed to execute schema file %s: %v", file, err)
+// purgeLoginAttempts deletes login attempts older than the retention period
+// now and every hour after
+func purgeLoginAttempts(attempts models.LoginAttemptStore, retention time.Duration) {
+	for {
+		if purged, err := attempts.PurgeLoginAttempts(time.Now().Add(-retention)); err != nil {
+			log.Printf("Warning: failed to purge login attempts: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d login attempts", purged)
 		}
-
-		log.Printf("Successfully applied schema from %s", file)
+		time.Sleep(time.Hour)
 	}
-
-	return nil
 }
 
 // CreateTestUsers creates test users if they don't exist
@@ -2,8 +2,12 @@
 package middleware
 
 import (
+	"database/sql"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -13,20 +17,28 @@ import (
 type JWTClaims struct {
 	UserID int    `json:"user_id"`
 	Role   string `json:"role"`
+	MFA    bool   `json:"mfa,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// TokenDenylist reports whether an otherwise valid access token has been revoked
+type TokenDenylist interface {
+	IsTokenRevoked(jti string, userID int, issuedAt time.Time) (bool, error)
+}
+
 // JWTAuth middleware validates JWT tokens and sets user information in the context
 //
 // Parameters:
 //   - jwtSecret: Secret key for JWT validation
+//   - denylist: Revocation store consulted for every token
 //
 // Returns:
 //   - gin.HandlerFunc: Middleware function for Gin router
 //
 // The middleware extracts the Bearer token from the Authorization header,
-// validates it, and sets the user_id and role in the Gin context
-func JWTAuth(jwtSecret string) gin.HandlerFunc {
+// validates it, rejects it if its jti or the user's sessions have been revoked,
+// and sets the user_id, role, jti, token_expires_at and mfa in the Gin context
+func JWTAuth(jwtSecret string, denylist TokenDenylist) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -59,71 +71,136 @@ func JWTAuth(jwtSecret string) gin.HandlerFunc {
 		}
 
 		// Extract claims
-		if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
-			// Set claims in context for use in handlers
-			c.Set("user_id", claims.UserID)
-			c.Set("role", claims.Role)
-			c.Next()
-		} else {
+		claims, ok := token.Claims.(*JWTClaims)
+		// Access tokens carry no audience; tokens with one are meant for another
+		// purpose, such as calendar feeds
+		if !ok || !token.Valid || claims.ID == "" || claims.IssuedAt == nil || claims.ExpiresAt == nil ||
+			len(claims.Audience) > 0 {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
 			c.Abort()
 			return
 		}
+
+		// Reject revoked tokens
+		revoked, err := denylist.IsTokenRevoked(claims.ID, claims.UserID, claims.IssuedAt.Time)
+		if err != nil {
+			log.Printf("Error checking token revocation for user %d: %v", claims.UserID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate token"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		// Set claims in context for use in handlers
+		c.Set("user_id", claims.UserID)
+		c.Set("role", claims.Role)
+		c.Set("jti", claims.ID)
+		c.Set("token_expires_at", claims.ExpiresAt.Time)
+		c.Set("mfa", claims.MFA)
+		c.Next()
 	}
 }
 
-// AdminOnly middleware ensures the user has admin role
+// PermissionSource looks up a user's current role and its permissions
+type PermissionSource interface {
+	GetUserPermissions(userID int) (string, []string, error)
+}
+
+// LoadPermissions middleware resolves the authenticated user's current role
+// and permissions and stores them in the context
+//
+// Parameters:
+//   - source: Permission lookup, typically the role store
 //
 // Returns:
 //   - gin.HandlerFunc: Middleware function for Gin router
 //
-// This middleware should be used after JWTAuth to check if the authenticated
-// user has admin privileges
-func AdminOnly() gin.HandlerFunc {
+// This middleware should be used after JWTAuth. The role is read from the
+// database rather than the token claims, so role and permission changes take
+// effect on the next request and tokens of deleted or deactivated users stop
+// working.
+func LoadPermissions(source PermissionSource) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists {
+		userID := c.GetInt("user_id")
+		if userID == 0 {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
 			c.Abort()
 			return
 		}
 
-		if roleStr, ok := role.(string); !ok || roleStr != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		role, permissions, err := source.GetUserPermissions(userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or deactivated"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			log.Printf("Error loading permissions for user %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
 			c.Abort()
 			return
 		}
 
+		granted := make(map[string]bool, len(permissions))
+		for _, permission := range permissions {
+			granted[permission] = true
+		}
+		c.Set("role", role)
+		c.Set("permissions", granted)
 		c.Next()
 	}
 }
 
-// TeacherOrAdmin middleware ensures the user has teacher or admin role
+// RequirePermission middleware ensures the user holds every listed permission
+//
+// Parameters:
+//   - permissions: Permissions required to access the route
 //
 // Returns:
 //   - gin.HandlerFunc: Middleware function for Gin router
 //
-// This middleware should be used after JWTAuth to check if the authenticated
-// user has teacher or admin privileges
-func TeacherOrAdmin() gin.HandlerFunc {
+// This middleware should be used after LoadPermissions
+func RequirePermission(permissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists {
+		if _, exists := c.Get("permissions"); !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
 			c.Abort()
 			return
 		}
 
-		if roleStr, ok := role.(string); !ok || (roleStr != "teacher" && roleStr != "admin") {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Teacher or admin access required"})
-			c.Abort()
-			return
+		for _, permission := range permissions {
+			if !HasPermission(c, permission) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Permission required: " + permission})
+				c.Abort()
+				return
+			}
 		}
 
 		c.Next()
 	}
 }
 
+// HasPermission reports whether the authenticated user holds a permission
+//
+// Parameters:
+//   - c: Gin context populated by LoadPermissions
+//   - permission: Permission to check
+//
+// Returns:
+//   - bool: True if the permission is granted
+func HasPermission(c *gin.Context, permission string) bool {
+	value, exists := c.Get("permissions")
+	if !exists {
+		return false
+	}
+	granted, ok := value.(map[string]bool)
+	return ok && granted[permission]
+}
+
 // Helper function to extract token from Authorization header
 func extractToken(authHeader string) string {
 	if len(authHeader) > 7 && strings.HasPrefix(authHeader, "Bearer ") {
@@ -0,0 +1,61 @@
+// Package middleware provides HTTP middleware functions for the application.
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GuardianLinks reports whether a guardian is linked to a student
+type GuardianLinks interface {
+	IsGuardianOf(guardianID, studentID int) (bool, error)
+}
+
+// RequireGuardianOf middleware ensures the authenticated user is a guardian of
+// the student in the id path parameter
+//
+// Parameters:
+//   - links: Guardian link lookup, typically the guardian store
+//
+// Returns:
+//   - gin.HandlerFunc: Middleware function for Gin router
+//
+// This middleware should be used after JWTAuth. It sets the student's ID in
+// the context as student_id, so handlers behind it never read the parameter
+// themselves and cannot skip the check.
+func RequireGuardianOf(links GuardianLinks) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		if userID == 0 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.Abort()
+			return
+		}
+
+		studentID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID"})
+			c.Abort()
+			return
+		}
+
+		linked, err := links.IsGuardianOf(userID, studentID)
+		if err != nil {
+			log.Printf("Error checking guardian %d of student %d: %v", userID, studentID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check guardian link"})
+			c.Abort()
+			return
+		}
+		if !linked {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not a guardian of this student"})
+			c.Abort()
+			return
+		}
+
+		c.Set("student_id", studentID)
+		c.Next()
+	}
+}
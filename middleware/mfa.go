@@ -0,0 +1,39 @@
+// Package middleware provides HTTP middleware functions for the application.
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MFAPolicy reports which roles must complete two-factor authentication
+type MFAPolicy interface {
+	MFARequired(role string) bool
+}
+
+// RequireMFA middleware ensures users of roles that require two-factor
+// authentication completed it when they logged in
+//
+// Parameters:
+//   - policy: Roles requiring two-factor authentication, typically the handler
+//
+// Returns:
+//   - gin.HandlerFunc: Middleware function for Gin router
+//
+// This middleware should be used after LoadPermissions, so that the check
+// uses the user's current role. Users of other roles pass without it.
+func RequireMFA(policy MFAPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if policy.MFARequired(c.GetString("role")) && !c.GetBool("mfa") {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":        "Two-factor authentication required",
+				"mfa_required": true,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"wg-edu-server/migrations"
+	"wg-edu-server/models"
+)
+
+// migrateUp applies all pending migrations and logs each one
+func migrateUp(db *models.DB) error {
+	migrator, err := migrations.New(db.DB)
+	if err != nil {
+		return err
+	}
+
+	applied, err := migrator.Up()
+	for _, mig := range applied {
+		log.Printf("Applied migration %04d_%s", mig.Version, mig.Name)
+	}
+	return err
+}
+
+// runMigrateCommand runs the migrate subcommand
+//
+// Usage:
+//   - migrate up: Apply all pending migrations
+//   - migrate down [n]: Revert the last n migrations (default 1)
+//   - migrate status: List migrations and when they were applied
+func runMigrateCommand(db *models.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [n]|status")
+	}
+
+	migrator, err := migrations.New(db.DB)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		return migrateUp(db)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+
+		reverted, err := migrator.Down(steps)
+		for _, mig := range reverted {
+			log.Printf("Reverted migration %04d_%s", mig.Version, mig.Name)
+		}
+		return err
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		applied := 0
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+				applied++
+			}
+			fmt.Printf("%04d  %-40s %s\n", status.Version, status.Name, appliedAt)
+		}
+		if applied == 0 {
+			fmt.Println("No migrations applied")
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+	}
+}
@@ -0,0 +1,330 @@
+// Package migrations provides versioned SQL schema migrations for the WG Education platform.
+//
+// Migrations are embedded into the binary from the sql directory. Each version
+// has an up and a down file named <version>_<name>.up.sql and
+// <version>_<name>.down.sql. Applied versions are recorded in the
+// schema_migrations table, and a PostgreSQL advisory lock ensures that only
+// one process migrates the database at a time.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed sql/*.sql
+var sqlFiles embed.FS
+
+//go:embed seed.sql
+var seedSQL string
+
+// advisoryLockKey identifies the migration lock among other advisory locks.
+// The value is arbitrary but must never change between releases.
+const advisoryLockKey int64 = 5_806_236_012
+
+// fileNamePattern matches migration file names such as 0001_create_users.up.sql
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration represents a single versioned schema change
+type Migration struct {
+	Version int    // Version number, taken from the file name prefix
+	Name    string // Descriptive name, taken from the file name
+	Up      string // SQL applying the change
+	Down    string // SQL reverting the change
+}
+
+// Status represents the state of a migration in the database
+type Status struct {
+	Version   int        `json:"version"`    // Migration version
+	Name      string     `json:"name"`       // Migration name
+	AppliedAt *time.Time `json:"applied_at"` // When the migration was applied, nil if pending
+}
+
+// Migrator applies and reverts migrations against a database
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New creates a Migrator for the embedded migrations.
+//
+// Parameters:
+//   - db: Database connection to migrate
+//
+// Returns:
+//   - *Migrator: Migrator ready to apply migrations
+//   - error: Error if the embedded migration files are malformed
+func New(db *sql.DB) (*Migrator, error) {
+	migrations, err := load(sqlFiles, "sql")
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Migrations returns the known migrations ordered by version.
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Up applies every pending migration in version order.
+// Each migration runs in its own transaction together with its
+// schema_migrations record, so a failure leaves earlier migrations applied.
+//
+// Returns:
+//   - []Migration: Migrations applied by this call
+//   - error: Error if a migration fails
+func (m *Migrator) Up() ([]Migration, error) {
+	var applied []Migration
+
+	err := m.withLock(func(conn *sql.Conn) error {
+		done, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+
+			err := runInTx(conn, mig.Up,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+				mig.Version, mig.Name, time.Now())
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s failed: %v", mig.Version, mig.Name, err)
+			}
+			applied = append(applied, mig)
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the most recently applied migrations.
+//
+// Parameters:
+//   - steps: Number of migrations to revert
+//
+// Returns:
+//   - []Migration: Migrations reverted by this call, most recent first
+//   - error: Error if a migration fails
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var reverted []Migration
+
+	err := m.withLock(func(conn *sql.Conn) error {
+		done, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+
+			err := runInTx(conn, mig.Down,
+				"DELETE FROM schema_migrations WHERE version = $1",
+				mig.Version)
+			if err != nil {
+				return fmt.Errorf("reverting migration %04d_%s failed: %v", mig.Version, mig.Name, err)
+			}
+			reverted = append(reverted, mig)
+		}
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Status reports which migrations have been applied.
+// It only reads schema_migrations, without taking the migration lock, so it
+// neither waits for a running migration nor changes a database that has
+// never been migrated; such a database reports every migration as pending.
+//
+// Returns:
+//   - []Status: One entry per known migration, ordered by version
+//   - error: Error if the schema_migrations table cannot be read
+func (m *Migrator) Status() ([]Status, error) {
+	ctx := context.Background()
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var exists bool
+	if err := conn.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, err
+	}
+	done := map[int]time.Time{}
+	if exists {
+		if done, err = appliedVersions(conn); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		status := Status{Version: mig.Version, Name: mig.Name}
+		if appliedAt, ok := done[mig.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Seed applies the idempotent development seed data.
+// It must run after the test users have been created since the seed links
+// them to students and subjects.
+//
+// Parameters:
+//   - db: Database connection to seed
+//
+// Returns:
+//   - error: Error if the seed SQL fails
+func Seed(db *sql.DB) error {
+	_, err := db.Exec(seedSQL)
+	return err
+}
+
+// withLock runs fn on a dedicated connection holding the migration advisory
+// lock, creating the schema_migrations table first if needed.
+func (m *Migrator) withLock(fn func(conn *sql.Conn) error) (err error) {
+	ctx := context.Background()
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Session-level advisory locks belong to the connection, so lock and
+	// unlock must happen on the same pinned conn
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", advisoryLockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %v", err)
+	}
+	defer func() {
+		if _, unlockErr := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", advisoryLockKey); unlockErr != nil && err == nil {
+			err = fmt.Errorf("failed to release migration lock: %v", unlockErr)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// appliedVersions returns the applied migration versions with their timestamps
+func appliedVersions(conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(context.Background(), "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		done[version] = appliedAt
+	}
+
+	return done, rows.Err()
+}
+
+// runInTx executes a migration script and its bookkeeping statement in one transaction
+func runInTx(conn *sql.Conn, script, bookkeeping string, args ...interface{}) error {
+	ctx := context.Background()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// load reads and validates the migration files in dir
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = mig
+		} else if mig.Name != match[2] {
+			return nil, fmt.Errorf("migration %04d has conflicting names %q and %q", version, mig.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			mig.Up = string(content)
+		} else {
+			mig.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have both up and down files", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
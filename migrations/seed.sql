@@ -1,119 +1,28 @@
--- Create subjects table
-CREATE TABLE IF NOT EXISTS subjects (
-    id SERIAL PRIMARY KEY,
-    grade VARCHAR(5) NOT NULL CHECK (grade IN ('PIB', 'IB1', 'IB2')),
-    name VARCHAR(100) NOT NULL,
-    description TEXT,
-    created_at TIMESTAMP NOT NULL DEFAULT NOW()
-);
+-- Development seed data
+-- Applied on every boot after the test users have been created, so every
+-- statement must be idempotent.
 
--- Create teacher_subjects mapping table
-CREATE TABLE IF NOT EXISTS teacher_subjects (
-    id SERIAL PRIMARY KEY,
-    teacher_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    subject_id INTEGER NOT NULL REFERENCES subjects(id) ON DELETE CASCADE,
-    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-    UNIQUE(teacher_id, subject_id)
-);
-
--- Create indexes for faster lookups
-CREATE INDEX IF NOT EXISTS idx_teacher_subjects_teacher_id ON teacher_subjects(teacher_id);
-CREATE INDEX IF NOT EXISTS idx_teacher_subjects_subject_id ON teacher_subjects(subject_id);
-CREATE INDEX IF NOT EXISTS idx_subjects_grade ON subjects(grade);
-
--- Insert subjects
+-- Insert sample student for test_student
 DO $$
 BEGIN
-    -- PIB Subjects
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'PIB' AND name = 'Mathematics') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('PIB', 'Mathematics', 'Pre-IB Mathematics');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'PIB' AND name = 'Additional Mathematics') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('PIB', 'Additional Mathematics', 'Pre-IB Additional Mathematics');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'PIB' AND name = 'Physics') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('PIB', 'Physics', 'Pre-IB Physics');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'PIB' AND name = 'Chemistry') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('PIB', 'Chemistry', 'Pre-IB Chemistry');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'PIB' AND name = 'Biology') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('PIB', 'Biology', 'Pre-IB Biology');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'PIB' AND name = 'English') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('PIB', 'English', 'Pre-IB English');
-    END IF;
-    
-    -- IB1 Subjects
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB1' AND name = 'Math AA') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('IB1', 'Math AA', 'IB1 Mathematics Analysis and Approaches');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB1' AND name = 'Math AI') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('IB1', 'Math AI', 'IB1 Mathematics Applications and Interpretation');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB1' AND name = 'Physics') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('IB1', 'Physics', 'IB1 Physics');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB1' AND name = 'Chemistry') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('IB1', 'Chemistry', 'IB1 Chemistry');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB1' AND name = 'Business Management') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('IB1', 'Business Management', 'IB1 Business Management');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB1' AND name = 'Biology') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('IB1', 'Biology', 'IB1 Biology');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB1' AND name = 'English B') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('IB1', 'English B', 'IB1 English B');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB1' AND name = 'Economics') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('IB1', 'Economics', 'IB1 Economics');
-    END IF;
-    
-    -- IB2 Subjects
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB2' AND name = 'Math AA') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('IB2', 'Math AA', 'IB2 Mathematics Analysis and Approaches');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB2' AND name = 'Math AI') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('IB2', 'Math AI', 'IB2 Mathematics Applications and Interpretation');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB2' AND name = 'Physics') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('IB2', 'Physics', 'IB2 Physics');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB2' AND name = 'Chemistry') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('IB2', 'Chemistry', 'IB2 Chemistry');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB2' AND name = 'Business Management') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('IB2', 'Business Management', 'IB2 Business Management');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB2' AND name = 'Biology') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('IB2', 'Biology', 'IB2 Biology');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB2' AND name = 'English B') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('IB2', 'English B', 'IB2 English B');
-    END IF;
-    
-    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB2' AND name = 'Economics') THEN
-        INSERT INTO subjects (grade, name, description) VALUES ('IB2', 'Economics', 'IB2 Economics');
-    END IF;
+    -- First check if we have the test_student user
+    DECLARE student_user_id INTEGER;
+    BEGIN
+        SELECT id INTO student_user_id FROM users WHERE username = 'test_student';
+        
+        -- If we found the test_student user but no record in students table
+        IF student_user_id IS NOT NULL AND 
+           NOT EXISTS (SELECT 1 FROM students WHERE user_id = student_user_id) THEN
+            
+            INSERT INTO students (user_id, first_name, last_name, email, grade)
+            VALUES (student_user_id, 'Test', 'Student', 'test.student@example.com', 'IB1');
+            
+        END IF;
+    EXCEPTION
+        WHEN NO_DATA_FOUND THEN
+            -- No test_student user, do nothing
+            NULL;
+    END;
 END
 $$;
 
@@ -140,6 +49,8 @@ DECLARE
     pib_english_id INTEGER;
     ib1_english_id INTEGER;
     ib2_english_id INTEGER;
+    ib1_english_a_id INTEGER;
+    ib2_english_a_id INTEGER;
     pib_biology_id INTEGER;
     pib_chemistry_id INTEGER;
     ib1_business_id INTEGER;
@@ -167,6 +78,8 @@ BEGIN
     SELECT id INTO pib_english_id FROM subjects WHERE grade = 'PIB' AND name = 'English';
     SELECT id INTO ib1_english_id FROM subjects WHERE grade = 'IB1' AND name = 'English B';
     SELECT id INTO ib2_english_id FROM subjects WHERE grade = 'IB2' AND name = 'English B';
+    SELECT id INTO ib1_english_a_id FROM subjects WHERE grade = 'IB1' AND name = 'English A Literature';
+    SELECT id INTO ib2_english_a_id FROM subjects WHERE grade = 'IB2' AND name = 'English A Literature';
     SELECT id INTO pib_biology_id FROM subjects WHERE grade = 'PIB' AND name = 'Biology';
     SELECT id INTO pib_chemistry_id FROM subjects WHERE grade = 'PIB' AND name = 'Chemistry';
     SELECT id INTO ib1_business_id FROM subjects WHERE grade = 'IB1' AND name = 'Business Management';
@@ -236,7 +149,7 @@ BEGIN
         ON CONFLICT (teacher_id, subject_id) DO NOTHING;
     END IF;
     
-    -- Eddie: PIB English, IB1 English B, IB2 English B
+    -- Eddie: PIB English, IB1 English B, IB2 English B, IB1 English A Literature, IB2 English A Literature
     IF eddie_id IS NOT NULL AND pib_english_id IS NOT NULL THEN
         INSERT INTO teacher_subjects (teacher_id, subject_id) 
         VALUES (eddie_id, pib_english_id)
@@ -255,6 +168,18 @@ BEGIN
         ON CONFLICT (teacher_id, subject_id) DO NOTHING;
     END IF;
     
+    IF eddie_id IS NOT NULL AND ib1_english_a_id IS NOT NULL THEN
+        INSERT INTO teacher_subjects (teacher_id, subject_id) 
+        VALUES (eddie_id, ib1_english_a_id)
+        ON CONFLICT (teacher_id, subject_id) DO NOTHING;
+    END IF;
+    
+    IF eddie_id IS NOT NULL AND ib2_english_a_id IS NOT NULL THEN
+        INSERT INTO teacher_subjects (teacher_id, subject_id) 
+        VALUES (eddie_id, ib2_english_a_id)
+        ON CONFLICT (teacher_id, subject_id) DO NOTHING;
+    END IF;
+    
     -- Li: PIB Biology
     IF li_id IS NOT NULL AND pib_biology_id IS NOT NULL THEN
         INSERT INTO teacher_subjects (teacher_id, subject_id) 
@@ -283,4 +208,4 @@ BEGIN
     END IF;
     
 END
-$$; 
\ No newline at end of file
+$$;
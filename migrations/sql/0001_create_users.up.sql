@@ -0,0 +1,14 @@
+-- Create users table
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(100) NOT NULL UNIQUE,
+    password TEXT NOT NULL,
+    role VARCHAR(20) NOT NULL,
+    date_created TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Databases created before migrations existed may have a shorter password
+-- column that cannot hold bcrypt/argon2id hashes
+ALTER TABLE users ALTER COLUMN password TYPE TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_users_role ON users(role);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS teacher_subjects;
+DROP TABLE IF EXISTS subjects;
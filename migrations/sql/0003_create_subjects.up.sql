@@ -0,0 +1,118 @@
+-- Create subjects table
+CREATE TABLE IF NOT EXISTS subjects (
+    id SERIAL PRIMARY KEY,
+    grade VARCHAR(5) NOT NULL CHECK (grade IN ('PIB', 'IB1', 'IB2')),
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Create teacher_subjects mapping table
+CREATE TABLE IF NOT EXISTS teacher_subjects (
+    id SERIAL PRIMARY KEY,
+    teacher_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    subject_id INTEGER NOT NULL REFERENCES subjects(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE(teacher_id, subject_id)
+);
+
+-- Create indexes for faster lookups
+CREATE INDEX IF NOT EXISTS idx_teacher_subjects_teacher_id ON teacher_subjects(teacher_id);
+CREATE INDEX IF NOT EXISTS idx_teacher_subjects_subject_id ON teacher_subjects(subject_id);
+CREATE INDEX IF NOT EXISTS idx_subjects_grade ON subjects(grade);
+
+-- Insert subjects
+DO $$
+BEGIN
+    -- PIB Subjects
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'PIB' AND name = 'Mathematics') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('PIB', 'Mathematics', 'Pre-IB Mathematics');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'PIB' AND name = 'Additional Mathematics') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('PIB', 'Additional Mathematics', 'Pre-IB Additional Mathematics');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'PIB' AND name = 'Physics') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('PIB', 'Physics', 'Pre-IB Physics');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'PIB' AND name = 'Chemistry') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('PIB', 'Chemistry', 'Pre-IB Chemistry');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'PIB' AND name = 'Biology') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('PIB', 'Biology', 'Pre-IB Biology');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'PIB' AND name = 'English') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('PIB', 'English', 'Pre-IB English');
+    END IF;
+    
+    -- IB1 Subjects
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB1' AND name = 'Math AA') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('IB1', 'Math AA', 'IB1 Mathematics Analysis and Approaches');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB1' AND name = 'Math AI') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('IB1', 'Math AI', 'IB1 Mathematics Applications and Interpretation');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB1' AND name = 'Physics') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('IB1', 'Physics', 'IB1 Physics');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB1' AND name = 'Chemistry') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('IB1', 'Chemistry', 'IB1 Chemistry');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB1' AND name = 'Business Management') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('IB1', 'Business Management', 'IB1 Business Management');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB1' AND name = 'Biology') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('IB1', 'Biology', 'IB1 Biology');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB1' AND name = 'English B') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('IB1', 'English B', 'IB1 English B');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB1' AND name = 'Economics') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('IB1', 'Economics', 'IB1 Economics');
+    END IF;
+    
+    -- IB2 Subjects
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB2' AND name = 'Math AA') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('IB2', 'Math AA', 'IB2 Mathematics Analysis and Approaches');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB2' AND name = 'Math AI') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('IB2', 'Math AI', 'IB2 Mathematics Applications and Interpretation');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB2' AND name = 'Physics') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('IB2', 'Physics', 'IB2 Physics');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB2' AND name = 'Chemistry') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('IB2', 'Chemistry', 'IB2 Chemistry');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB2' AND name = 'Business Management') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('IB2', 'Business Management', 'IB2 Business Management');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB2' AND name = 'Biology') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('IB2', 'Biology', 'IB2 Biology');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB2' AND name = 'English B') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('IB2', 'English B', 'IB2 English B');
+    END IF;
+    
+    IF NOT EXISTS (SELECT 1 FROM subjects WHERE grade = 'IB2' AND name = 'Economics') THEN
+        INSERT INTO subjects (grade, name, description) VALUES ('IB2', 'Economics', 'IB2 Economics');
+    END IF;
+END
+$$;
@@ -0,0 +1,44 @@
+-- Create roles table
+-- users.role references roles.name. Built-in roles (is_system) are referenced
+-- by application code and cannot be deleted.
+CREATE TABLE IF NOT EXISTS roles (
+    name VARCHAR(50) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    is_system BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Create role_permissions mapping table
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_name VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE ON UPDATE CASCADE,
+    permission VARCHAR(100) NOT NULL,
+    PRIMARY KEY (role_name, permission)
+);
+
+-- Seed built-in roles
+INSERT INTO roles (name, description, is_system) VALUES
+    ('admin', 'Full administrative access', TRUE),
+    ('teacher', 'Teaching staff', TRUE),
+    ('student', 'Enrolled students', TRUE)
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'students:read'),
+    ('admin', 'students:write'),
+    ('admin', 'subjects:read'),
+    ('admin', 'subjects:assign'),
+    ('admin', 'teachers:read'),
+    ('admin', 'sessions:revoke'),
+    ('admin', 'roles:manage'),
+    ('teacher', 'subjects:read'),
+    ('teacher', 'teachers:read'),
+    ('student', 'subjects:read')
+ON CONFLICT DO NOTHING;
+
+-- Every existing user must have a known role before the foreign key is added
+INSERT INTO roles (name, description)
+SELECT DISTINCT role, 'Imported from existing users' FROM users
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE users
+    ADD CONSTRAINT fk_users_role FOREIGN KEY (role) REFERENCES roles(name) ON UPDATE CASCADE;
@@ -0,0 +1,3 @@
+DELETE FROM role_permissions WHERE permission IN ('enrollments:read', 'enrollments:write');
+DROP TABLE IF EXISTS enrollments;
+ALTER TABLE subjects DROP COLUMN IF EXISTS subject_group;
@@ -0,0 +1,29 @@
+-- IB subject groups: 1 Language and Literature, 2 Language Acquisition,
+-- 3 Individuals and Societies, 4 Sciences, 5 Mathematics, 6 The Arts.
+-- Pre-IB subjects have no group.
+ALTER TABLE subjects
+    ADD COLUMN IF NOT EXISTS subject_group SMALLINT CHECK (subject_group BETWEEN 1 AND 6);
+
+UPDATE subjects SET subject_group = 2 WHERE grade IN ('IB1', 'IB2') AND name = 'English B';
+UPDATE subjects SET subject_group = 3 WHERE grade IN ('IB1', 'IB2') AND name IN ('Business Management', 'Economics');
+UPDATE subjects SET subject_group = 4 WHERE grade IN ('IB1', 'IB2') AND name IN ('Physics', 'Chemistry', 'Biology');
+UPDATE subjects SET subject_group = 5 WHERE grade IN ('IB1', 'IB2') AND name IN ('Math AA', 'Math AI');
+
+-- Create enrollments table linking students to the subjects they take.
+-- level is HL or SL for IB subjects and NULL for Pre-IB subjects.
+CREATE TABLE IF NOT EXISTS enrollments (
+    student_id INTEGER NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    subject_id INTEGER NOT NULL REFERENCES subjects(id) ON DELETE CASCADE,
+    level VARCHAR(2) CHECK (level IN ('HL', 'SL')),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (student_id, subject_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_enrollments_subject_id ON enrollments(subject_id);
+
+-- Grant the new permissions to the built-in roles
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'enrollments:read'),
+    ('admin', 'enrollments:write'),
+    ('teacher', 'enrollments:read')
+ON CONFLICT DO NOTHING;
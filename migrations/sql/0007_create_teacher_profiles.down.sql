@@ -0,0 +1,3 @@
+DELETE FROM role_permissions WHERE permission = 'teachers:write';
+DROP TABLE IF EXISTS teacher_profiles;
+ALTER TABLE users DROP COLUMN IF EXISTS is_active;
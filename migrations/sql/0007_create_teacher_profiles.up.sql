@@ -0,0 +1,23 @@
+-- Deactivated users keep their data but can no longer log in
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_active BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- Create teacher_profiles table holding the personal details of teacher users.
+-- Teachers are identified by their user ID, which teacher_subjects references.
+CREATE TABLE IF NOT EXISTS teacher_profiles (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    first_name VARCHAR(100) NOT NULL DEFAULT '',
+    last_name VARCHAR(100) NOT NULL DEFAULT '',
+    email VARCHAR(255) UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Existing teachers get an empty profile to be filled in by an admin
+INSERT INTO teacher_profiles (user_id)
+SELECT id FROM users WHERE role = 'teacher'
+ON CONFLICT (user_id) DO NOTHING;
+
+-- Grant the new permission to the admin role
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'teachers:write')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+DELETE FROM role_permissions WHERE permission = 'subjects:write';
+ALTER TABLE subjects DROP CONSTRAINT IF EXISTS subjects_grade_name_key;
+ALTER TABLE subjects DROP COLUMN IF EXISTS archived;
+ALTER TABLE subjects DROP COLUMN IF EXISTS levels;
@@ -0,0 +1,16 @@
+-- Levels a subject is offered at (HL, SL); empty for Pre-IB subjects.
+-- Archived subjects are retired: they take no new enrollments or teacher
+-- assignments, but existing rows keep referencing them.
+ALTER TABLE subjects
+    ADD COLUMN IF NOT EXISTS levels TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE subjects SET levels = '{HL,SL}' WHERE grade IN ('IB1', 'IB2') AND levels = '{}';
+
+-- Subject names are unique within a grade
+ALTER TABLE subjects ADD CONSTRAINT subjects_grade_name_key UNIQUE (grade, name);
+
+-- Grant the new permission to the admin role
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'subjects:write')
+ON CONFLICT DO NOTHING;
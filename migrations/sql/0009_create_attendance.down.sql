@@ -0,0 +1,3 @@
+DELETE FROM role_permissions WHERE permission IN ('attendance:read', 'attendance:record');
+DROP TABLE IF EXISTS attendance;
+DROP TABLE IF EXISTS lessons;
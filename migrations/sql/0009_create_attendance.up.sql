@@ -0,0 +1,32 @@
+-- Create lessons table. A lesson is one meeting of a subject on a date,
+-- recorded by a teacher assigned to the subject.
+CREATE TABLE IF NOT EXISTS lessons (
+    id SERIAL PRIMARY KEY,
+    subject_id INTEGER NOT NULL REFERENCES subjects(id),
+    teacher_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    lesson_date DATE NOT NULL,
+    topic TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_lessons_subject_date ON lessons(subject_id, lesson_date);
+
+-- Create attendance table holding one record per student and lesson
+CREATE TABLE IF NOT EXISTS attendance (
+    lesson_id INTEGER NOT NULL REFERENCES lessons(id) ON DELETE CASCADE,
+    student_id INTEGER NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('present', 'absent', 'late', 'excused')),
+    note TEXT NOT NULL DEFAULT '',
+    recorded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    recorded_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (lesson_id, student_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_attendance_student ON attendance(student_id);
+
+-- Grant the new permissions; teachers record attendance for their own subjects
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'attendance:read'),
+    ('admin', 'attendance:record'),
+    ('teacher', 'attendance:record')
+ON CONFLICT DO NOTHING;
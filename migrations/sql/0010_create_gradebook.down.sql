@@ -0,0 +1,6 @@
+DELETE FROM role_permissions WHERE permission IN ('gradebook:read', 'gradebook:write');
+DROP TABLE IF EXISTS predicted_grades;
+DROP TABLE IF EXISTS assessment_scores;
+DROP TABLE IF EXISTS assessments;
+DROP TABLE IF EXISTS grade_boundaries;
+DROP TABLE IF EXISTS assessment_categories;
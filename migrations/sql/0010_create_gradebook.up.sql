@@ -0,0 +1,64 @@
+-- Create assessment_categories table holding the weighted categories of a
+-- subject's grading scheme, e.g. tests 60 and homework 40
+CREATE TABLE IF NOT EXISTS assessment_categories (
+    subject_id INTEGER NOT NULL REFERENCES subjects(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    weight NUMERIC(6, 2) NOT NULL CHECK (weight > 0),
+    position INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (subject_id, name)
+);
+
+-- Create grade_boundaries table holding the minimum percentages for IB grades
+-- 2 to 7 of a subject. Subjects without a row use the default boundaries.
+CREATE TABLE IF NOT EXISTS grade_boundaries (
+    subject_id INTEGER PRIMARY KEY REFERENCES subjects(id) ON DELETE CASCADE,
+    boundaries NUMERIC(5, 2)[] NOT NULL CHECK (array_length(boundaries, 1) = 6)
+);
+
+-- Create assessments table. Removing a category that is still used by an
+-- assessment is refused by the foreign key.
+CREATE TABLE IF NOT EXISTS assessments (
+    id SERIAL PRIMARY KEY,
+    subject_id INTEGER NOT NULL REFERENCES subjects(id),
+    category VARCHAR(50) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    weight NUMERIC(6, 2) NOT NULL DEFAULT 1 CHECK (weight > 0),
+    max_mark NUMERIC(8, 2) NOT NULL CHECK (max_mark > 0),
+    assessed_on DATE NOT NULL,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (subject_id, category) REFERENCES assessment_categories(subject_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_assessments_subject ON assessments(subject_id, assessed_on);
+
+-- Create assessment_scores table holding one mark per student and assessment
+CREATE TABLE IF NOT EXISTS assessment_scores (
+    assessment_id INTEGER NOT NULL REFERENCES assessments(id) ON DELETE CASCADE,
+    student_id INTEGER NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    mark NUMERIC(8, 2) NOT NULL CHECK (mark >= 0),
+    recorded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    recorded_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (assessment_id, student_id)
+);
+
+-- Create predicted_grades table. Every prediction is kept; the latest one of a
+-- student and subject is the current prediction.
+CREATE TABLE IF NOT EXISTS predicted_grades (
+    id SERIAL PRIMARY KEY,
+    subject_id INTEGER NOT NULL REFERENCES subjects(id) ON DELETE CASCADE,
+    student_id INTEGER NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    grade SMALLINT NOT NULL CHECK (grade BETWEEN 1 AND 7),
+    comment TEXT NOT NULL DEFAULT '',
+    teacher_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_predicted_grades_student ON predicted_grades(subject_id, student_id, created_at);
+
+-- Grant the new permissions; teachers manage the gradebooks of their own subjects
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'gradebook:read'),
+    ('admin', 'gradebook:write'),
+    ('teacher', 'gradebook:write')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+DELETE FROM role_permissions WHERE permission IN ('diploma:read', 'diploma:write');
+DROP TABLE IF EXISTS diploma_core;
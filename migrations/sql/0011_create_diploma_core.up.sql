@@ -0,0 +1,16 @@
+-- Create diploma_core table holding each IB student's Theory of Knowledge and
+-- Extended Essay grades and CAS completion. NULL means not decided yet.
+CREATE TABLE IF NOT EXISTS diploma_core (
+    student_id INTEGER PRIMARY KEY REFERENCES students(id) ON DELETE CASCADE,
+    tok_grade CHAR(1) CHECK (tok_grade IN ('A', 'B', 'C', 'D', 'E', 'N')),
+    ee_grade CHAR(1) CHECK (ee_grade IN ('A', 'B', 'C', 'D', 'E', 'N')),
+    cas_complete BOOLEAN,
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Grant the new permissions to admins
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'diploma:read'),
+    ('admin', 'diploma:write')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+DELETE FROM role_permissions WHERE permission IN ('cas:log', 'cas:supervise', 'cas:read');
+DROP TABLE IF EXISTS cas_activities;
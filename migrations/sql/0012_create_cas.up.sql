@@ -0,0 +1,33 @@
+-- Create cas_activities table holding the CAS experiences students log. An
+-- activity may span several strands and demonstrate several of the seven
+-- learning outcomes; only approved activities count towards progress.
+CREATE TABLE IF NOT EXISTS cas_activities (
+    id SERIAL PRIMARY KEY,
+    student_id INTEGER NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    supervisor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    title VARCHAR(200) NOT NULL,
+    strands TEXT[] NOT NULL CHECK (strands <@ ARRAY['creativity', 'activity', 'service'] AND cardinality(strands) > 0),
+    hours NUMERIC(6, 2) NOT NULL CHECK (hours > 0),
+    start_date DATE NOT NULL,
+    end_date DATE CHECK (end_date >= start_date),
+    reflection TEXT NOT NULL,
+    evidence TEXT NOT NULL DEFAULT '',
+    outcomes SMALLINT[] NOT NULL DEFAULT '{}' CHECK (outcomes <@ ARRAY[1, 2, 3, 4, 5, 6, 7]::SMALLINT[]),
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    review_comment TEXT NOT NULL DEFAULT '',
+    reviewed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_cas_activities_student ON cas_activities(student_id, start_date);
+CREATE INDEX IF NOT EXISTS idx_cas_activities_supervisor ON cas_activities(supervisor_id, status);
+
+-- Grant the new permissions; students log activities and teachers supervise them
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'cas:log'),
+    ('admin', 'cas:supervise'),
+    ('admin', 'cas:read'),
+    ('student', 'cas:log'),
+    ('teacher', 'cas:supervise')
+ON CONFLICT DO NOTHING;
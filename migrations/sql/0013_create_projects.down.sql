@@ -0,0 +1,5 @@
+DELETE FROM role_permissions WHERE permission IN ('projects:read', 'projects:manage', 'projects:supervise', 'projects:submit');
+DROP TABLE IF EXISTS project_comments;
+DROP TABLE IF EXISTS project_drafts;
+DROP TABLE IF EXISTS project_milestones;
+DROP TABLE IF EXISTS projects;
@@ -0,0 +1,64 @@
+-- Create the tables tracking Extended Essays and Internal Assessments. Each
+-- project links a student and subject to a supervising teacher and has
+-- milestone checkpoints, uploaded drafts and supervisor comments.
+CREATE TABLE IF NOT EXISTS projects (
+    id SERIAL PRIMARY KEY,
+    kind VARCHAR(2) NOT NULL CHECK (kind IN ('ee', 'ia')),
+    student_id INTEGER NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    subject_id INTEGER NOT NULL REFERENCES subjects(id),
+    supervisor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    title VARCHAR(200) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (student_id, kind, subject_id)
+);
+
+-- A student writes a single Extended Essay
+CREATE UNIQUE INDEX IF NOT EXISTS idx_projects_one_ee ON projects(student_id) WHERE kind = 'ee';
+CREATE INDEX IF NOT EXISTS idx_projects_supervisor ON projects(supervisor_id);
+
+CREATE TABLE IF NOT EXISTS project_milestones (
+    id SERIAL PRIMARY KEY,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    due_date DATE NOT NULL,
+    completed_at TIMESTAMP,
+    completed_by INTEGER REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_project_milestones_project ON project_milestones(project_id, due_date);
+
+CREATE TABLE IF NOT EXISTS project_drafts (
+    id SERIAL PRIMARY KEY,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    milestone_id INTEGER REFERENCES project_milestones(id) ON DELETE SET NULL,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size INTEGER NOT NULL,
+    data BYTEA NOT NULL,
+    uploaded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    uploaded_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_project_drafts_project ON project_drafts(project_id, uploaded_at);
+
+CREATE TABLE IF NOT EXISTS project_comments (
+    id SERIAL PRIMARY KEY,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    draft_id INTEGER REFERENCES project_drafts(id) ON DELETE SET NULL,
+    author_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_project_comments_project ON project_comments(project_id, created_at);
+
+-- Grant the new permissions; teachers supervise and students submit drafts
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'projects:read'),
+    ('admin', 'projects:manage'),
+    ('admin', 'projects:supervise'),
+    ('admin', 'projects:submit'),
+    ('student', 'projects:submit'),
+    ('teacher', 'projects:supervise')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+DELETE FROM role_permissions WHERE permission IN ('timetable:read', 'timetable:manage');
+DROP TABLE IF EXISTS timetable_lessons;
+DROP TABLE IF EXISTS rooms;
+DROP TABLE IF EXISTS time_slots;
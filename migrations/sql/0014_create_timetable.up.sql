@@ -0,0 +1,39 @@
+-- Create the weekly timetable. Time slots are the periods of the school day
+-- and never overlap, so lessons clash exactly when they share a day and slot.
+CREATE TABLE IF NOT EXISTS time_slots (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) NOT NULL UNIQUE,
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    CHECK (end_time > start_time)
+);
+
+CREATE TABLE IF NOT EXISTS rooms (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) NOT NULL UNIQUE,
+    capacity INTEGER NOT NULL DEFAULT 0 CHECK (capacity >= 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS timetable_lessons (
+    id SERIAL PRIMARY KEY,
+    subject_id INTEGER NOT NULL REFERENCES subjects(id),
+    teacher_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    room_id INTEGER NOT NULL REFERENCES rooms(id),
+    day SMALLINT NOT NULL CHECK (day BETWEEN 1 AND 7),
+    slot_id INTEGER NOT NULL REFERENCES time_slots(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- A teacher and a room can only be in one lesson at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_timetable_lessons_teacher ON timetable_lessons(teacher_id, day, slot_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_timetable_lessons_room ON timetable_lessons(room_id, day, slot_id);
+CREATE INDEX IF NOT EXISTS idx_timetable_lessons_subject ON timetable_lessons(subject_id);
+
+-- Grant the new permissions; teachers may view every timetable
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'timetable:read'),
+    ('admin', 'timetable:manage'),
+    ('teacher', 'timetable:read')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,9 @@
+-- Create calendar_feeds table
+-- Calendar feed URLs carry a signed token naming the user and feed_id. Only the
+-- token matching the user's current feed_id is accepted, so replacing feed_id
+-- invalidates every URL handed out before.
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    feed_id VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,4 @@
+DELETE FROM role_permissions WHERE permission IN ('homework:read', 'homework:manage', 'homework:submit');
+DROP TABLE IF EXISTS homework_submissions;
+DROP TABLE IF EXISTS homework_attachments;
+DROP TABLE IF EXISTS homework_assignments;
@@ -0,0 +1,58 @@
+-- Create the homework tables. File content lives on the storage backend;
+-- these tables keep the metadata and the storage key of each file. Due times
+-- are set by teachers in their own time zone, so they are stored with one.
+CREATE TABLE IF NOT EXISTS homework_assignments (
+    id SERIAL PRIMARY KEY,
+    subject_id INTEGER NOT NULL REFERENCES subjects(id),
+    title VARCHAR(200) NOT NULL,
+    instructions TEXT NOT NULL DEFAULT '',
+    due_at TIMESTAMPTZ NOT NULL,
+    late_policy VARCHAR(10) NOT NULL DEFAULT 'accept' CHECK (late_policy IN ('accept', 'reject')),
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_homework_assignments_subject ON homework_assignments(subject_id, due_at);
+
+CREATE TABLE IF NOT EXISTS homework_attachments (
+    id SERIAL PRIMARY KEY,
+    homework_id INTEGER NOT NULL REFERENCES homework_assignments(id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    uploaded_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_homework_attachments_homework ON homework_attachments(homework_id);
+
+-- Every submission is kept; a resubmission adds the next attempt
+CREATE TABLE IF NOT EXISTS homework_submissions (
+    id SERIAL PRIMARY KEY,
+    homework_id INTEGER NOT NULL REFERENCES homework_assignments(id) ON DELETE CASCADE,
+    student_id INTEGER NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    attempt INTEGER NOT NULL CHECK (attempt > 0),
+    comment TEXT NOT NULL DEFAULT '',
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    submitted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    late BOOLEAN NOT NULL DEFAULT FALSE,
+    feedback TEXT NOT NULL DEFAULT '',
+    feedback_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    feedback_at TIMESTAMP,
+    UNIQUE (homework_id, student_id, attempt)
+);
+
+CREATE INDEX IF NOT EXISTS idx_homework_submissions_student ON homework_submissions(student_id);
+
+-- Grant the new permissions; teachers set homework and students submit it
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'homework:read'),
+    ('admin', 'homework:manage'),
+    ('admin', 'homework:submit'),
+    ('student', 'homework:submit'),
+    ('teacher', 'homework:manage')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+DELETE FROM role_permissions WHERE permission IN ('guardians:manage', 'children:read');
+DROP TABLE IF EXISTS guardian_students;
+DROP TABLE IF EXISTS guardian_profiles;
+DELETE FROM roles WHERE name = 'guardian' AND NOT EXISTS (SELECT 1 FROM users WHERE role = 'guardian');
@@ -0,0 +1,34 @@
+-- Parents and guardians log in with the built-in guardian role
+INSERT INTO roles (name, description, is_system) VALUES
+    ('guardian', 'Parents and guardians of students', TRUE)
+ON CONFLICT (name) DO UPDATE SET is_system = TRUE;
+
+-- Create guardian_profiles table holding the personal details of guardian users
+CREATE TABLE IF NOT EXISTS guardian_profiles (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    first_name VARCHAR(100) NOT NULL DEFAULT '',
+    last_name VARCHAR(100) NOT NULL DEFAULT '',
+    email VARCHAR(255) UNIQUE,
+    phone VARCHAR(50) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Create guardian_students table linking guardians to their children.
+-- A student may have several guardians and a guardian several children.
+CREATE TABLE IF NOT EXISTS guardian_students (
+    guardian_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    student_id INTEGER NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    relationship VARCHAR(50) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (guardian_id, student_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_guardian_students_student ON guardian_students(student_id);
+
+-- Grant the new permissions; guardians only read their own children
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'guardians:manage'),
+    ('admin', 'children:read'),
+    ('guardian', 'children:read')
+ON CONFLICT DO NOTHING;
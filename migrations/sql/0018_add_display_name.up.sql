@@ -0,0 +1,3 @@
+-- Users may choose the name shown for them through the self-service API.
+-- Official names stay in the student, teacher and guardian records.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name VARCHAR(100) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+DELETE FROM role_permissions WHERE permission = 'passwords:reset';
+DROP TABLE IF EXISTS password_reset_tokens;
+ALTER TABLE users DROP COLUMN IF EXISTS must_change_password;
@@ -0,0 +1,20 @@
+-- Users flagged by an admin must choose a new password before they get a session
+ALTER TABLE users ADD COLUMN IF NOT EXISTS must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Create password_reset_tokens table. Only the SHA-256 hash of each token is
+-- stored; a token is single-use and expires.
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user ON password_reset_tokens(user_id);
+
+-- Grant the new permission to the admin role
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'passwords:reset')
+ON CONFLICT DO NOTHING;
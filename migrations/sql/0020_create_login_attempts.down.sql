@@ -0,0 +1,3 @@
+DELETE FROM role_permissions WHERE permission = 'logins:manage';
+DROP TABLE IF EXISTS login_attempts;
+ALTER TABLE users DROP COLUMN IF EXISTS locked_until;
@@ -0,0 +1,21 @@
+-- Accounts locked after repeated failed logins refuse logins until this time
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
+
+-- Create login_attempts table. Every login is recorded, including attempts
+-- for unknown usernames, so that rate limits hold across server instances
+-- and attack patterns can be reviewed.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    outcome VARCHAR(10) NOT NULL CHECK (outcome IN ('success', 'failure', 'blocked', 'unlocked')),
+    attempted_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_username ON login_attempts(username, attempted_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip_address, attempted_at);
+
+-- Grant the new permission to the admin role
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'logins:manage')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+DELETE FROM role_permissions WHERE permission IN ('mfa:enroll', 'mfa:reset');
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS user_mfa;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS mfa;
@@ -0,0 +1,32 @@
+-- Refresh tokens issued after two-factor authentication keep the mfa claim
+-- when they are rotated
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS mfa BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Create user_mfa table. A row without confirmed_at is an enrolment waiting
+-- for its first code; last_step is the newest TOTP time step used, so that a
+-- code cannot be used twice.
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret VARCHAR(64) NOT NULL,
+    confirmed_at TIMESTAMP,
+    last_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Create mfa_recovery_codes table. Only the SHA-256 hash of each code is
+-- stored; a code is single-use.
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user ON mfa_recovery_codes(user_id);
+
+-- Grant the new permissions
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'mfa:enroll'),
+    ('admin', 'mfa:reset'),
+    ('teacher', 'mfa:enroll')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+DELETE FROM login_attempts WHERE outcome = 'reset';
+ALTER TABLE login_attempts DROP CONSTRAINT IF EXISTS login_attempts_outcome_check;
+ALTER TABLE login_attempts ADD CONSTRAINT login_attempts_outcome_check
+    CHECK (outcome IN ('success', 'failure', 'blocked', 'unlocked'));
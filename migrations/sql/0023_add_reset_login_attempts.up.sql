@@ -0,0 +1,5 @@
+-- Password reset requests are recorded in login_attempts under the email
+-- address, so that they are rate limited like logins
+ALTER TABLE login_attempts DROP CONSTRAINT IF EXISTS login_attempts_outcome_check;
+ALTER TABLE login_attempts ADD CONSTRAINT login_attempts_outcome_check
+    CHECK (outcome IN ('success', 'failure', 'blocked', 'unlocked', 'reset'));
@@ -0,0 +1,5 @@
+ALTER TABLE login_attempts
+    ALTER COLUMN attempted_at TYPE TIMESTAMP USING attempted_at AT TIME ZONE 'UTC';
+
+ALTER TABLE users
+    ALTER COLUMN locked_until TYPE TIMESTAMP USING locked_until AT TIME ZONE 'UTC';
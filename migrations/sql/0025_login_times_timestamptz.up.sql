@@ -0,0 +1,7 @@
+-- Lockouts and login attempts are compared with the server clock, so they are
+-- stored as instants. Existing values are read as UTC.
+ALTER TABLE users
+    ALTER COLUMN locked_until TYPE TIMESTAMPTZ USING locked_until AT TIME ZONE 'UTC';
+
+ALTER TABLE login_attempts
+    ALTER COLUMN attempted_at TYPE TIMESTAMPTZ USING attempted_at AT TIME ZONE 'UTC';
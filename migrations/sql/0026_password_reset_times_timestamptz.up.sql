@@ -0,0 +1,6 @@
+-- Reset token expiries are compared with the server clock, so token times are
+-- stored as instants. Existing values are read as UTC.
+ALTER TABLE password_reset_tokens
+    ALTER COLUMN expires_at TYPE TIMESTAMPTZ USING expires_at AT TIME ZONE 'UTC',
+    ALTER COLUMN used_at TYPE TIMESTAMPTZ USING used_at AT TIME ZONE 'UTC',
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC';
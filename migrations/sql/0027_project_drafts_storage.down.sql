@@ -0,0 +1,6 @@
+-- Drafts whose content is on the storage backend cannot be moved back by SQL
+-- and are dropped
+ALTER TABLE project_drafts DROP CONSTRAINT IF EXISTS project_drafts_content_check;
+DELETE FROM project_drafts WHERE data IS NULL;
+ALTER TABLE project_drafts ALTER COLUMN data SET NOT NULL;
+ALTER TABLE project_drafts DROP COLUMN IF EXISTS storage_key;
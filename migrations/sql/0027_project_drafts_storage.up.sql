@@ -0,0 +1,7 @@
+-- Keep the content of project drafts on the storage backend, like homework
+-- files, with only its key in the table. Drafts uploaded before keep their
+-- content in data until the server moves it to the storage backend at startup.
+ALTER TABLE project_drafts ADD COLUMN IF NOT EXISTS storage_key VARCHAR(255) UNIQUE;
+ALTER TABLE project_drafts ALTER COLUMN data DROP NOT NULL;
+ALTER TABLE project_drafts ADD CONSTRAINT project_drafts_content_check
+    CHECK (storage_key IS NOT NULL OR data IS NOT NULL);
@@ -0,0 +1,5 @@
+-- Encrypted secrets do not fit the old column and cannot be decrypted by SQL;
+-- those users enrol again
+DELETE FROM user_mfa WHERE LENGTH(secret) > 64;
+ALTER TABLE user_mfa ALTER COLUMN secret TYPE VARCHAR(64);
+DELETE FROM mfa_recovery_codes WHERE user_id NOT IN (SELECT user_id FROM user_mfa);
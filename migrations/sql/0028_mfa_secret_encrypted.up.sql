@@ -0,0 +1,4 @@
+-- TOTP secrets are stored encrypted with a key derived from the JWT secret,
+-- which takes more room than the base32 secret. The server encrypts secrets
+-- stored in plain text before at startup.
+ALTER TABLE user_mfa ALTER COLUMN secret TYPE VARCHAR(255);
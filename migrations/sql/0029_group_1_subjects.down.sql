@@ -0,0 +1,10 @@
+-- Subjects already in use are kept
+DELETE FROM subjects s
+WHERE s.grade IN ('IB1', 'IB2') AND s.name = 'English A Literature'
+    AND NOT EXISTS (SELECT 1 FROM enrollments WHERE subject_id = s.id)
+    AND NOT EXISTS (SELECT 1 FROM lessons WHERE subject_id = s.id)
+    AND NOT EXISTS (SELECT 1 FROM assessments WHERE subject_id = s.id)
+    AND NOT EXISTS (SELECT 1 FROM projects WHERE subject_id = s.id)
+    AND NOT EXISTS (SELECT 1 FROM timetable_lessons WHERE subject_id = s.id)
+    AND NOT EXISTS (SELECT 1 FROM homework_assignments WHERE subject_id = s.id)
+    AND NOT EXISTS (SELECT 1 FROM exams WHERE subject_id = s.id);
@@ -0,0 +1,7 @@
+-- Group 1 (Language and Literature) subjects, without which no IB student
+-- can complete a diploma combination. Schools offering other group 1 subjects
+-- add them alongside or archive these.
+INSERT INTO subjects (grade, name, description, subject_group, levels) VALUES
+    ('IB1', 'English A Literature', 'IB1 English A: Literature', 1, '{HL,SL}'),
+    ('IB2', 'English A Literature', 'IB2 English A: Literature', 1, '{HL,SL}')
+ON CONFLICT (grade, name) DO NOTHING;
@@ -0,0 +1,572 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Attendance statuses
+const (
+	AttendancePresent = "present"
+	AttendanceAbsent  = "absent"
+	AttendanceLate    = "late"
+	AttendanceExcused = "excused" // Requires a note
+)
+
+// LessonDateLayout is the format of lesson dates in requests and query parameters
+const LessonDateLayout = "2006-01-02"
+
+// ErrInvalidAttendance is returned for an invalid lesson or attendance record.
+// The wrapped message describes the problem.
+var ErrInvalidAttendance = errors.New("invalid attendance")
+
+// Lesson represents one meeting of a subject on a date
+type Lesson struct {
+	ID          int                 `json:"id"`                   // Unique identifier
+	SubjectID   int                 `json:"subject_id"`           // Reference to subjects table
+	SubjectName string              `json:"subject_name"`         // Subject name (added for convenience)
+	TeacherID   int                 `json:"teacher_id,omitempty"` // Teacher who created the lesson, 0 if deleted
+	Date        time.Time           `json:"date"`                 // Day the lesson was held
+	Topic       string              `json:"topic"`                // Optional description
+	CreatedAt   time.Time           `json:"created_at"`           // Creation timestamp
+	Records     []*AttendanceRecord `json:"records,omitempty"`    // Attendance ordered by student name
+}
+
+// AttendanceRecord is the attendance of one student at a lesson
+type AttendanceRecord struct {
+	StudentID   int       `json:"student_id"`            // Reference to students table
+	StudentName string    `json:"student_name"`          // First and last name (added for convenience)
+	Status      string    `json:"status"`                // present, absent, late or excused
+	Note        string    `json:"note,omitempty"`        // Reason, required when excused
+	RecordedBy  int       `json:"recorded_by,omitempty"` // User who last changed the record, 0 if deleted
+	RecordedAt  time.Time `json:"recorded_at"`           // Time of the last change
+}
+
+// LessonRequest is used for creating a lesson together with its attendance
+type LessonRequest struct {
+	SubjectID int               `json:"subject_id"` // Subject the lesson belongs to
+	Date      string            `json:"date"`       // Day of the lesson as YYYY-MM-DD
+	Topic     string            `json:"topic"`      // Optional description
+	Records   []AttendanceEntry `json:"records"`    // Attendance of enrolled students
+}
+
+// AttendanceEntry records the status of one student at a lesson
+type AttendanceEntry struct {
+	StudentID int    `json:"student_id"`     // Student, who must be enrolled in the subject
+	Status    string `json:"status"`         // present, absent, late or excused
+	Note      string `json:"note,omitempty"` // Reason, required when excused
+}
+
+// AttendancePeriod limits summaries to lessons between two dates, inclusive.
+// A zero bound leaves that side open.
+type AttendancePeriod struct {
+	From time.Time
+	To   time.Time
+}
+
+// AttendanceCounts counts a student's attendance records by status
+type AttendanceCounts struct {
+	Lessons int     `json:"lessons"` // Lessons with a record
+	Present int     `json:"present"`
+	Absent  int     `json:"absent"`
+	Late    int     `json:"late"`
+	Excused int     `json:"excused"`
+	Rate    float64 `json:"rate"` // Percentage attended, see AttendanceRate
+}
+
+// AttendanceSummary holds attendance counts for a student, a subject, or a
+// student in a subject. Fields that do not apply are omitted.
+type AttendanceSummary struct {
+	StudentID   int    `json:"student_id,omitempty"`
+	StudentName string `json:"student_name,omitempty"`
+	Grade       string `json:"grade,omitempty"`
+	SubjectID   int    `json:"subject_id,omitempty"`
+	SubjectName string `json:"subject_name,omitempty"`
+	AttendanceCounts
+}
+
+// AttendanceRate returns the percentage of lessons attended, rounded to one
+// decimal. Late counts as attended and excused lessons are left out, so a
+// student with only excused absences has a rate of 100.
+func AttendanceRate(present, late, lessons, excused int) float64 {
+	counted := lessons - excused
+	if counted <= 0 {
+		return 100
+	}
+	return math.Round(float64(present+late)*1000/float64(counted)) / 10
+}
+
+// add counts one more record with a status
+func (c *AttendanceCounts) add(status string) {
+	c.Lessons++
+	switch status {
+	case AttendancePresent:
+		c.Present++
+	case AttendanceAbsent:
+		c.Absent++
+	case AttendanceLate:
+		c.Late++
+	case AttendanceExcused:
+		c.Excused++
+	}
+}
+
+// finish computes the rate from the counts
+func (c *AttendanceCounts) finish() {
+	c.Rate = AttendanceRate(c.Present, c.Late, c.Lessons, c.Excused)
+}
+
+// TotalAttendance adds up summaries, e.g. the subjects of a student
+//
+// Parameters:
+//   - summaries: Summaries to add up
+//
+// Returns:
+//   - AttendanceCounts: Combined counts and rate
+func TotalAttendance(summaries []*AttendanceSummary) AttendanceCounts {
+	total := AttendanceCounts{}
+	for _, s := range summaries {
+		total.Lessons += s.Lessons
+		total.Present += s.Present
+		total.Absent += s.Absent
+		total.Late += s.Late
+		total.Excused += s.Excused
+	}
+	total.finish()
+	return total
+}
+
+// contains reports whether a lesson date lies within the period
+func (p AttendancePeriod) contains(date time.Time) bool {
+	return (p.From.IsZero() || !date.Before(p.From)) && (p.To.IsZero() || !date.After(p.To))
+}
+
+// where returns the conditions limiting l.lesson_date to the period, appending
+// their arguments
+func (p AttendancePeriod) where(args []interface{}) (string, []interface{}) {
+	var where string
+	if !p.From.IsZero() {
+		args = append(args, p.From)
+		where += fmt.Sprintf(" AND l.lesson_date >= $%d", len(args))
+	}
+	if !p.To.IsZero() {
+		args = append(args, p.To)
+		where += fmt.Sprintf(" AND l.lesson_date <= $%d", len(args))
+	}
+	return where, args
+}
+
+// ParseLessonDate parses a YYYY-MM-DD date
+//
+// Parameters:
+//   - value: Date to parse
+//
+// Returns:
+//   - time.Time: Midnight UTC of the date
+//   - error: ErrInvalidAttendance if the date is malformed
+func ParseLessonDate(value string) (time.Time, error) {
+	date, err := time.Parse(LessonDateLayout, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: date must be formatted as YYYY-MM-DD", ErrInvalidAttendance)
+	}
+	return date, nil
+}
+
+// ValidateAttendance checks attendance entries for a lesson of a subject
+//
+// Parameters:
+//   - entries: Entries to check; Note is trimmed in place
+//   - enrolled: IDs of the students enrolled in the subject
+//
+// Returns:
+//   - error: ErrInvalidAttendance wrapped with the first problem, or nil
+func ValidateAttendance(entries []AttendanceEntry, enrolled map[int]bool) error {
+	seen := make(map[int]bool, len(entries))
+	for i := range entries {
+		e := &entries[i]
+		e.Note = strings.TrimSpace(e.Note)
+		switch e.Status {
+		case AttendancePresent, AttendanceAbsent, AttendanceLate:
+		case AttendanceExcused:
+			if e.Note == "" {
+				return fmt.Errorf("%w: a note is required to excuse student %d", ErrInvalidAttendance, e.StudentID)
+			}
+		default:
+			return fmt.Errorf("%w: status of student %d must be present, absent, late or excused", ErrInvalidAttendance, e.StudentID)
+		}
+		if seen[e.StudentID] {
+			return fmt.Errorf("%w: student %d is listed more than once", ErrInvalidAttendance, e.StudentID)
+		}
+		seen[e.StudentID] = true
+		if !enrolled[e.StudentID] {
+			return fmt.Errorf("%w: student %d is not enrolled in the subject", ErrInvalidAttendance, e.StudentID)
+		}
+	}
+	return nil
+}
+
+// belowThreshold keeps the summaries with a rate under the threshold, lowest
+// rate first. Summaries with the same rate keep their order.
+func belowThreshold(summaries []*AttendanceSummary, threshold float64) []*AttendanceSummary {
+	below := []*AttendanceSummary{}
+	for _, s := range summaries {
+		if s.Rate < threshold {
+			below = append(below, s)
+		}
+	}
+	sort.SliceStable(below, func(i, j int) bool { return below[i].Rate < below[j].Rate })
+	return below
+}
+
+// attendanceCountColumns counts the attendance records (aliased a) of a group by status
+const attendanceCountColumns = `COUNT(*),
+		       COUNT(*) FILTER (WHERE a.status = 'present'),
+		       COUNT(*) FILTER (WHERE a.status = 'absent'),
+		       COUNT(*) FILTER (WHERE a.status = 'late'),
+		       COUNT(*) FILTER (WHERE a.status = 'excused')`
+
+// CreateLesson creates a lesson and records the attendance of its students.
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - teacherID: User ID of the teacher, who must be assigned to the subject
+//   - req: Subject, date, topic and attendance
+//
+// Returns:
+//   - *Lesson: Created lesson with its records
+//   - error: sql.ErrNoRows if the subject does not exist, ErrSubjectArchived,
+//     ErrNotTeaching, ErrInvalidAttendance, or a database error
+func (db *DB) CreateLesson(teacherID int, req *LessonRequest) (*Lesson, error) {
+	date, err := ParseLessonDate(req.Date)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Share-lock the subject so it cannot be archived or deleted meanwhile
+	var archived bool
+	err = tx.QueryRow("SELECT archived FROM subjects WHERE id = $1 FOR SHARE", req.SubjectID).Scan(&archived)
+	if err != nil {
+		return nil, err
+	}
+	if archived {
+		err = ErrSubjectArchived
+		return nil, err
+	}
+
+	var lessonID int
+	err = tx.QueryRow(
+		"INSERT INTO lessons (subject_id, teacher_id, lesson_date, topic) VALUES ($1, $2, $3, $4) RETURNING id",
+		req.SubjectID, teacherID, date, strings.TrimSpace(req.Topic),
+	).Scan(&lessonID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = recordAttendance(tx, lessonID, req.SubjectID, teacherID, req.Records); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return db.GetLesson(lessonID)
+}
+
+// RecordAttendance adds or corrects attendance records of a lesson. Students
+// not listed keep their records.
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - lessonID: Lesson to record attendance for
+//   - teacherID: User ID of the teacher, who must be assigned to the subject
+//   - entries: Attendance of enrolled students
+//
+// Returns:
+//   - *Lesson: Lesson with all of its records
+//   - error: sql.ErrNoRows if the lesson does not exist, ErrNotTeaching,
+//     ErrInvalidAttendance, or a database error
+func (db *DB) RecordAttendance(lessonID, teacherID int, entries []AttendanceEntry) (*Lesson, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var subjectID int
+	err = tx.QueryRow("SELECT subject_id FROM lessons WHERE id = $1 FOR UPDATE", lessonID).Scan(&subjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = recordAttendance(tx, lessonID, subjectID, teacherID, entries); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return db.GetLesson(lessonID)
+}
+
+// recordAttendance checks the teacher's assignment and the entries, then
+// writes the entries of a lesson within a transaction
+func recordAttendance(tx *sql.Tx, lessonID, subjectID, teacherID int, entries []AttendanceEntry) error {
+	if err := requireTeaching(tx, teacherID, subjectID); err != nil {
+		return err
+	}
+
+	ids := make([]int, len(entries))
+	for i, e := range entries {
+		ids[i] = e.StudentID
+	}
+	enrolled, err := enrolledStudents(tx, subjectID, ids)
+	if err != nil {
+		return err
+	}
+
+	if err := ValidateAttendance(entries, enrolled); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		_, err := tx.Exec(`
+			INSERT INTO attendance (lesson_id, student_id, status, note, recorded_by)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (lesson_id, student_id) DO UPDATE
+			SET status = EXCLUDED.status, note = EXCLUDED.note,
+			    recorded_by = EXCLUDED.recorded_by, recorded_at = NOW()`,
+			lessonID, e.StudentID, e.Status, e.Note, teacherID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetLesson retrieves a lesson with its attendance records
+//
+// Parameters:
+//   - id: Lesson ID to retrieve
+//
+// Returns:
+//   - *Lesson: Lesson with records ordered by student name
+//   - error: sql.ErrNoRows if the lesson does not exist, or a database error
+func (db *DB) GetLesson(id int) (*Lesson, error) {
+	lesson := &Lesson{}
+	err := db.QueryRow(`
+		SELECT l.id, l.subject_id, s.name, COALESCE(l.teacher_id, 0), l.lesson_date, l.topic, l.created_at
+		FROM lessons l
+		JOIN subjects s ON s.id = l.subject_id
+		WHERE l.id = $1`,
+		id,
+	).Scan(
+		&lesson.ID,
+		&lesson.SubjectID,
+		&lesson.SubjectName,
+		&lesson.TeacherID,
+		&lesson.Date,
+		&lesson.Topic,
+		&lesson.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT a.student_id, st.first_name || ' ' || st.last_name, a.status, a.note,
+		       COALESCE(a.recorded_by, 0), a.recorded_at
+		FROM attendance a
+		JOIN students st ON st.id = a.student_id
+		WHERE a.lesson_id = $1
+		ORDER BY st.last_name, st.first_name, a.student_id`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lesson.Records = []*AttendanceRecord{}
+	for rows.Next() {
+		r := &AttendanceRecord{}
+		err := rows.Scan(&r.StudentID, &r.StudentName, &r.Status, &r.Note, &r.RecordedBy, &r.RecordedAt)
+		if err != nil {
+			return nil, err
+		}
+		lesson.Records = append(lesson.Records, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lesson, nil
+}
+
+// GetSubjectLessons retrieves the lessons of a subject without their records
+//
+// Parameters:
+//   - subjectID: Subject to retrieve lessons for
+//   - period: Dates to limit the lessons to
+//
+// Returns:
+//   - []*Lesson: Lessons ordered by date, most recent first
+//   - error: Error if retrieval fails
+func (db *DB) GetSubjectLessons(subjectID int, period AttendancePeriod) ([]*Lesson, error) {
+	where, args := period.where([]interface{}{subjectID})
+	rows, err := db.Query(`
+		SELECT l.id, l.subject_id, s.name, COALESCE(l.teacher_id, 0), l.lesson_date, l.topic, l.created_at
+		FROM lessons l
+		JOIN subjects s ON s.id = l.subject_id
+		WHERE l.subject_id = $1`+where+`
+		ORDER BY l.lesson_date DESC, l.id DESC`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lessons := []*Lesson{}
+	for rows.Next() {
+		l := &Lesson{}
+		err := rows.Scan(&l.ID, &l.SubjectID, &l.SubjectName, &l.TeacherID, &l.Date, &l.Topic, &l.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		lessons = append(lessons, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lessons, nil
+}
+
+// GetStudentAttendance summarizes a student's attendance per subject
+//
+// Parameters:
+//   - studentID: Student to summarize
+//   - period: Dates to limit the lessons to
+//
+// Returns:
+//   - []*AttendanceSummary: One summary per subject with records, ordered by grade and name
+//   - error: Error if retrieval fails
+func (db *DB) GetStudentAttendance(studentID int, period AttendancePeriod) ([]*AttendanceSummary, error) {
+	where, args := period.where([]interface{}{studentID})
+	return db.queryAttendanceSummaries(`
+		SELECT l.subject_id, s.name, `+attendanceCountColumns+`
+		FROM attendance a
+		JOIN lessons l ON l.id = a.lesson_id
+		JOIN subjects s ON s.id = l.subject_id
+		WHERE a.student_id = $1`+where+`
+		GROUP BY l.subject_id, s.grade, s.name
+		ORDER BY s.grade, s.name`,
+		args,
+		func(s *AttendanceSummary) []interface{} { return []interface{}{&s.SubjectID, &s.SubjectName} },
+	)
+}
+
+// GetSubjectAttendance summarizes attendance in a subject per student
+//
+// Parameters:
+//   - subjectID: Subject to summarize
+//   - period: Dates to limit the lessons to
+//
+// Returns:
+//   - []*AttendanceSummary: One summary per student with records, ordered by name
+//   - error: Error if retrieval fails
+func (db *DB) GetSubjectAttendance(subjectID int, period AttendancePeriod) ([]*AttendanceSummary, error) {
+	where, args := period.where([]interface{}{subjectID})
+	return db.queryAttendanceSummaries(`
+		SELECT a.student_id, st.first_name || ' ' || st.last_name, st.grade, `+attendanceCountColumns+`
+		FROM attendance a
+		JOIN lessons l ON l.id = a.lesson_id
+		JOIN students st ON st.id = a.student_id
+		WHERE l.subject_id = $1`+where+`
+		GROUP BY a.student_id, st.first_name, st.last_name, st.grade
+		ORDER BY st.last_name, st.first_name, a.student_id`,
+		args,
+		func(s *AttendanceSummary) []interface{} { return []interface{}{&s.StudentID, &s.StudentName, &s.Grade} },
+	)
+}
+
+// GetLowAttendance lists students whose attendance over all subjects is below a threshold
+//
+// Parameters:
+//   - threshold: Attendance percentage students must reach
+//   - period: Dates to limit the lessons to
+//
+// Returns:
+//   - []*AttendanceSummary: One summary per student below the threshold, lowest
+//     rate first, then by name
+//   - error: Error if retrieval fails
+func (db *DB) GetLowAttendance(threshold float64, period AttendancePeriod) ([]*AttendanceSummary, error) {
+	where, args := period.where(nil)
+	summaries, err := db.queryAttendanceSummaries(`
+		SELECT a.student_id, st.first_name || ' ' || st.last_name, st.grade, `+attendanceCountColumns+`
+		FROM attendance a
+		JOIN lessons l ON l.id = a.lesson_id
+		JOIN students st ON st.id = a.student_id
+		WHERE TRUE`+where+`
+		GROUP BY a.student_id, st.first_name, st.last_name, st.grade
+		ORDER BY st.last_name, st.first_name, a.student_id`,
+		args,
+		func(s *AttendanceSummary) []interface{} { return []interface{}{&s.StudentID, &s.StudentName, &s.Grade} },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return belowThreshold(summaries, threshold), nil
+}
+
+// queryAttendanceSummaries runs a summary query whose columns are the ones
+// returned by keys followed by attendanceCountColumns
+func (db *DB) queryAttendanceSummaries(query string, args []interface{}, keys func(*AttendanceSummary) []interface{}) ([]*AttendanceSummary, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []*AttendanceSummary{}
+	for rows.Next() {
+		s := &AttendanceSummary{}
+		dest := append(keys(s), &s.Lessons, &s.Present, &s.Absent, &s.Late, &s.Excused)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		s.finish()
+		summaries = append(summaries, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return summaries, nil
+}
@@ -0,0 +1,553 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// CAS strands
+const (
+	CASStrandCreativity = "creativity"
+	CASStrandActivity   = "activity"
+	CASStrandService    = "service"
+)
+
+// CASStrands lists the strands in display order
+var CASStrands = []string{CASStrandCreativity, CASStrandActivity, CASStrandService}
+
+// Review statuses of a CAS activity
+const (
+	CASPending  = "pending"  // Awaiting the supervisor's review
+	CASApproved = "approved" // Counts towards the student's progress
+	CASRejected = "rejected" // Returned to the student, who may edit and resubmit it
+)
+
+// CASLearningOutcomes describes the seven CAS learning outcomes, numbered 1 to 7
+var CASLearningOutcomes = []string{
+	"Identify own strengths and develop areas for growth",
+	"Demonstrate that challenges have been undertaken, developing new skills in the process",
+	"Demonstrate how to initiate and plan a CAS experience",
+	"Show commitment to and perseverance in CAS experiences",
+	"Demonstrate the skills and recognize the benefits of working collaboratively",
+	"Demonstrate engagement with issues of global significance",
+	"Recognize and consider the ethics of choices and actions",
+}
+
+// Errors returned by CAS operations
+var (
+	// ErrInvalidCAS is returned for an invalid CAS activity or review. The
+	// wrapped message describes the problem.
+	ErrInvalidCAS = errors.New("invalid CAS activity")
+	// ErrCASApproved is returned when an approved activity is changed or deleted
+	ErrCASApproved = errors.New("CAS activity is approved and can no longer be changed")
+	// ErrCASReviewed is returned when an activity that is not pending is reviewed
+	ErrCASReviewed = errors.New("CAS activity is not awaiting review")
+	// ErrNotSupervisor is returned when a teacher reviews an activity they do not supervise
+	ErrNotSupervisor = errors.New("user does not supervise this CAS activity")
+)
+
+// CASActivity is a CAS experience logged by a student
+type CASActivity struct {
+	ID             int        `json:"id"`                       // Unique identifier
+	StudentID      int        `json:"student_id"`               // Reference to students table
+	StudentName    string     `json:"student_name"`             // First and last name (added for convenience)
+	SupervisorID   int        `json:"supervisor_id,omitempty"`  // Teacher's user ID, 0 if deleted
+	SupervisorName string     `json:"supervisor_name"`          // Teacher's name (added for convenience)
+	Title          string     `json:"title"`                    // Short description
+	Strands        []string   `json:"strands"`                  // creativity, activity and/or service
+	Hours          float64    `json:"hours"`                    // Time spent
+	StartDate      time.Time  `json:"start_date"`               // First day of the activity
+	EndDate        *time.Time `json:"end_date,omitempty"`       // Last day, null if ongoing or a single day
+	Reflection     string     `json:"reflection"`               // The student's reflection
+	Evidence       string     `json:"evidence,omitempty"`       // Link or description of evidence
+	Outcomes       []int      `json:"outcomes"`                 // Learning outcomes 1 to 7 the activity demonstrates
+	Status         string     `json:"status"`                   // pending, approved or rejected
+	ReviewComment  string     `json:"review_comment,omitempty"` // Supervisor's comment
+	ReviewedAt     *time.Time `json:"reviewed_at,omitempty"`    // Time of the last review
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// CASActivityRequest is used for logging or editing a CAS activity
+type CASActivityRequest struct {
+	Title        string   `json:"title"`              // Required
+	Strands      []string `json:"strands"`            // At least one of creativity, activity and service
+	Hours        float64  `json:"hours"`              // Above 0
+	StartDate    string   `json:"start_date"`         // YYYY-MM-DD
+	EndDate      string   `json:"end_date,omitempty"` // YYYY-MM-DD, optional
+	Reflection   string   `json:"reflection"`         // Required
+	Evidence     string   `json:"evidence,omitempty"` // Optional link or description
+	Outcomes     []int    `json:"outcomes"`           // Learning outcomes 1 to 7, may be empty
+	SupervisorID int      `json:"supervisor_id"`      // User ID of an active teacher
+}
+
+// CASReviewRequest is used by supervisors to approve or reject an activity
+type CASReviewRequest struct {
+	Status  string `json:"status"`  // approved or rejected
+	Comment string `json:"comment"` // Required when rejecting
+}
+
+// CASOutcomeProgress tells whether a learning outcome has been demonstrated
+type CASOutcomeProgress struct {
+	Outcome     int    `json:"outcome"`     // 1 to 7
+	Description string `json:"description"` // Text of the outcome
+	Activities  int    `json:"activities"`  // Approved activities demonstrating it
+	Met         bool   `json:"met"`         // At least one approved activity demonstrates it
+}
+
+// CASProgress summarizes a student's CAS activities
+type CASProgress struct {
+	StudentID     int                  `json:"student_id"`
+	StudentName   string               `json:"student_name"`
+	ApprovedHours float64              `json:"approved_hours"`  // Hours of approved activities
+	PendingHours  float64              `json:"pending_hours"`   // Hours awaiting review
+	StrandHours   map[string]float64   `json:"strand_hours"`    // Approved hours per strand; activities count in each of their strands
+	Outcomes      []CASOutcomeProgress `json:"outcomes"`        // Progress on each learning outcome
+	OutcomesMet   int                  `json:"outcomes_met"`    // Learning outcomes demonstrated, out of 7
+	Counts        map[string]int       `json:"activity_counts"` // Activities per status
+	Activities    []*CASActivity       `json:"activities"`      // Every activity, most recent first
+}
+
+// ValidateCASActivity checks and normalizes an activity request in place.
+// Strands are lower-cased and outcomes sorted.
+//
+// Parameters:
+//   - req: Activity to check
+//
+// Returns:
+//   - time.Time: Start date
+//   - *time.Time: End date, nil if omitted
+//   - error: ErrInvalidCAS wrapped with the first problem, or nil
+func ValidateCASActivity(req *CASActivityRequest) (time.Time, *time.Time, error) {
+	req.Title = strings.TrimSpace(req.Title)
+	req.Reflection = strings.TrimSpace(req.Reflection)
+	req.Evidence = strings.TrimSpace(req.Evidence)
+	if req.Title == "" || len(req.Title) > 200 {
+		return time.Time{}, nil, fmt.Errorf("%w: title must be 1 to 200 characters", ErrInvalidCAS)
+	}
+	if req.Reflection == "" {
+		return time.Time{}, nil, fmt.Errorf("%w: reflection is required", ErrInvalidCAS)
+	}
+	if req.Hours <= 0 || req.Hours > 1000 {
+		return time.Time{}, nil, fmt.Errorf("%w: hours must be above 0 and at most 1000", ErrInvalidCAS)
+	}
+	if req.SupervisorID == 0 {
+		return time.Time{}, nil, fmt.Errorf("%w: supervisor_id is required", ErrInvalidCAS)
+	}
+
+	if len(req.Strands) == 0 {
+		return time.Time{}, nil, fmt.Errorf("%w: at least one strand is required", ErrInvalidCAS)
+	}
+	seen := map[string]bool{}
+	strands := []string{}
+	for _, strand := range req.Strands {
+		strand = strings.ToLower(strings.TrimSpace(strand))
+		if strand != CASStrandCreativity && strand != CASStrandActivity && strand != CASStrandService {
+			return time.Time{}, nil, fmt.Errorf("%w: strand must be creativity, activity or service", ErrInvalidCAS)
+		}
+		if !seen[strand] {
+			seen[strand] = true
+			strands = append(strands, strand)
+		}
+	}
+	req.Strands = strands
+
+	outcomes := map[int]bool{}
+	for _, outcome := range req.Outcomes {
+		if outcome < 1 || outcome > len(CASLearningOutcomes) {
+			return time.Time{}, nil, fmt.Errorf("%w: learning outcomes are numbered 1 to %d", ErrInvalidCAS, len(CASLearningOutcomes))
+		}
+		outcomes[outcome] = true
+	}
+	req.Outcomes = make([]int, 0, len(outcomes))
+	for outcome := range outcomes {
+		req.Outcomes = append(req.Outcomes, outcome)
+	}
+	sort.Ints(req.Outcomes)
+
+	start, err := time.Parse(LessonDateLayout, strings.TrimSpace(req.StartDate))
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("%w: start_date must be formatted as YYYY-MM-DD", ErrInvalidCAS)
+	}
+	if strings.TrimSpace(req.EndDate) == "" {
+		return start, nil, nil
+	}
+	end, err := time.Parse(LessonDateLayout, strings.TrimSpace(req.EndDate))
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("%w: end_date must be formatted as YYYY-MM-DD", ErrInvalidCAS)
+	}
+	if end.Before(start) {
+		return time.Time{}, nil, fmt.Errorf("%w: end_date must not be before start_date", ErrInvalidCAS)
+	}
+	return start, &end, nil
+}
+
+// ValidateCASReview checks a review request in place
+//
+// Returns:
+//   - error: ErrInvalidCAS wrapped with the problem, or nil
+func ValidateCASReview(req *CASReviewRequest) error {
+	req.Status = strings.ToLower(strings.TrimSpace(req.Status))
+	req.Comment = strings.TrimSpace(req.Comment)
+	if req.Status != CASApproved && req.Status != CASRejected {
+		return fmt.Errorf("%w: status must be approved or rejected", ErrInvalidCAS)
+	}
+	if req.Status == CASRejected && req.Comment == "" {
+		return fmt.Errorf("%w: a comment is required when rejecting", ErrInvalidCAS)
+	}
+	return nil
+}
+
+// BuildCASProgress summarizes a student's activities. Only approved
+// activities count towards hours and learning outcomes.
+//
+// Parameters:
+//   - activities: The student's activities
+//
+// Returns:
+//   - *CASProgress: Progress including the activities; student fields are left unset
+func BuildCASProgress(activities []*CASActivity) *CASProgress {
+	progress := &CASProgress{
+		StrandHours: map[string]float64{},
+		Outcomes:    make([]CASOutcomeProgress, len(CASLearningOutcomes)),
+		Counts:      map[string]int{CASPending: 0, CASApproved: 0, CASRejected: 0},
+		Activities:  activities,
+	}
+	for _, strand := range CASStrands {
+		progress.StrandHours[strand] = 0
+	}
+	for i, description := range CASLearningOutcomes {
+		progress.Outcomes[i] = CASOutcomeProgress{Outcome: i + 1, Description: description}
+	}
+
+	for _, a := range activities {
+		progress.Counts[a.Status]++
+		switch a.Status {
+		case CASPending:
+			progress.PendingHours += a.Hours
+		case CASApproved:
+			progress.ApprovedHours += a.Hours
+			for _, strand := range a.Strands {
+				progress.StrandHours[strand] += a.Hours
+			}
+			for _, outcome := range a.Outcomes {
+				progress.Outcomes[outcome-1].Activities++
+			}
+		}
+	}
+
+	for i := range progress.Outcomes {
+		if progress.Outcomes[i].Activities > 0 {
+			progress.Outcomes[i].Met = true
+			progress.OutcomesMet++
+		}
+	}
+	return progress
+}
+
+// casActivitySelect selects the columns scanned by scanCASActivity
+const casActivitySelect = `
+	SELECT a.id, a.student_id, s.first_name || ' ' || s.last_name, COALESCE(a.supervisor_id, 0),
+		COALESCE(tp.first_name || ' ' || tp.last_name, u.username, ''),
+		a.title, a.strands, a.hours, a.start_date, a.end_date, a.reflection, a.evidence,
+		a.outcomes, a.status, a.review_comment, a.reviewed_at, a.created_at, a.updated_at
+	FROM cas_activities a
+	JOIN students s ON s.id = a.student_id
+	LEFT JOIN users u ON u.id = a.supervisor_id
+	LEFT JOIN teacher_profiles tp ON tp.user_id = a.supervisor_id`
+
+// scanCASActivity scans a row selected with casActivitySelect
+func scanCASActivity(row interface{ Scan(...interface{}) error }) (*CASActivity, error) {
+	a := &CASActivity{}
+	var strands pq.StringArray
+	var outcomes pq.Int64Array
+	var end, reviewed sql.NullTime
+	err := row.Scan(
+		&a.ID, &a.StudentID, &a.StudentName, &a.SupervisorID, &a.SupervisorName,
+		&a.Title, &strands, &a.Hours, &a.StartDate, &end, &a.Reflection, &a.Evidence,
+		&outcomes, &a.Status, &a.ReviewComment, &reviewed, &a.CreatedAt, &a.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	a.Strands = []string(strands)
+	a.Outcomes = make([]int, len(outcomes))
+	for i, outcome := range outcomes {
+		a.Outcomes[i] = int(outcome)
+	}
+	if end.Valid {
+		a.EndDate = &end.Time
+	}
+	if reviewed.Valid {
+		a.ReviewedAt = &reviewed.Time
+	}
+	return a, nil
+}
+
+// queryCASActivities selects the activities matching a condition, most recent first
+func (db *DB) queryCASActivities(where string, args ...interface{}) ([]*CASActivity, error) {
+	rows, err := db.Query(casActivitySelect+" WHERE "+where+" ORDER BY a.start_date DESC, a.id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activities := []*CASActivity{}
+	for rows.Next() {
+		a, err := scanCASActivity(rows)
+		if err != nil {
+			return nil, err
+		}
+		activities = append(activities, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return activities, nil
+}
+
+// requireSupervisor checks that a user is an active teacher who can supervise
+// students' work, wrapping invalid when not
+func requireSupervisor(q interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}, userID int, invalid error) error {
+	var ok bool
+	err := q.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM users WHERE id = $1 AND role = $2 AND is_active)",
+		userID, RoleTeacher,
+	).Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: supervisor must be an active teacher", invalid)
+	}
+	return nil
+}
+
+// GetCASActivity retrieves a CAS activity
+//
+// Parameters:
+//   - id: Activity to retrieve
+//
+// Returns:
+//   - *CASActivity: Activity with student and supervisor names
+//   - error: sql.ErrNoRows if the activity does not exist, or a database error
+func (db *DB) GetCASActivity(id int) (*CASActivity, error) {
+	return scanCASActivity(db.QueryRow(casActivitySelect+" WHERE a.id = $1", id))
+}
+
+// GetStudentCASActivities retrieves a student's CAS activities
+//
+// Parameters:
+//   - studentID: Student whose activities are retrieved
+//
+// Returns:
+//   - []*CASActivity: Activities, most recent first
+//   - error: Error if retrieval fails
+func (db *DB) GetStudentCASActivities(studentID int) ([]*CASActivity, error) {
+	return db.queryCASActivities("a.student_id = $1", studentID)
+}
+
+// GetSupervisedCASActivities retrieves the CAS activities a teacher supervises
+//
+// Parameters:
+//   - supervisorID: Teacher's user ID
+//   - status: Review status to filter by, empty for all
+//
+// Returns:
+//   - []*CASActivity: Activities, most recent first
+//   - error: Error if retrieval fails
+func (db *DB) GetSupervisedCASActivities(supervisorID int, status string) ([]*CASActivity, error) {
+	return db.queryCASActivities("a.supervisor_id = $1 AND ($2 = '' OR a.status = $2)", supervisorID, status)
+}
+
+// CreateCASActivity logs a CAS activity for a student, pending review
+//
+// Parameters:
+//   - studentID: Student logging the activity
+//   - req: Activity details and supervisor
+//
+// Returns:
+//   - *CASActivity: Created activity
+//   - error: ErrInvalidCAS, or a database error
+func (db *DB) CreateCASActivity(studentID int, req *CASActivityRequest) (*CASActivity, error) {
+	start, end, err := ValidateCASActivity(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireSupervisor(db, req.SupervisorID, ErrInvalidCAS); err != nil {
+		return nil, err
+	}
+
+	var id int
+	err = db.QueryRow(`
+		INSERT INTO cas_activities (student_id, supervisor_id, title, strands, hours, start_date, end_date,
+		                            reflection, evidence, outcomes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`,
+		studentID, req.SupervisorID, req.Title, pq.Array(req.Strands), req.Hours, start, end,
+		req.Reflection, req.Evidence, pq.Array(req.Outcomes),
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetCASActivity(id)
+}
+
+// UpdateCASActivity edits a student's own activity and resubmits it for review
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - id: Activity to edit
+//   - studentID: Student who owns the activity
+//   - req: New activity details and supervisor
+//
+// Returns:
+//   - *CASActivity: Updated activity, pending review
+//   - error: sql.ErrNoRows if the student has no such activity, ErrInvalidCAS,
+//     ErrCASApproved, or a database error
+func (db *DB) UpdateCASActivity(id, studentID int, req *CASActivityRequest) (*CASActivity, error) {
+	start, end, err := ValidateCASActivity(req)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM cas_activities WHERE id = $1 AND student_id = $2 FOR UPDATE", id, studentID).Scan(&status)
+	if err != nil {
+		return nil, err
+	}
+	if status == CASApproved {
+		err = ErrCASApproved
+		return nil, err
+	}
+	if err = requireSupervisor(tx, req.SupervisorID, ErrInvalidCAS); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE cas_activities
+		SET supervisor_id = $1, title = $2, strands = $3, hours = $4, start_date = $5, end_date = $6,
+		    reflection = $7, evidence = $8, outcomes = $9, status = $10,
+		    review_comment = '', reviewed_at = NULL, updated_at = NOW()
+		WHERE id = $11`,
+		req.SupervisorID, req.Title, pq.Array(req.Strands), req.Hours, start, end,
+		req.Reflection, req.Evidence, pq.Array(req.Outcomes), CASPending, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return db.GetCASActivity(id)
+}
+
+// DeleteCASActivity deletes a student's own activity unless it is approved
+//
+// Parameters:
+//   - id: Activity to delete
+//   - studentID: Student who owns the activity
+//
+// Returns:
+//   - error: sql.ErrNoRows if the student has no such activity, ErrCASApproved, or a database error
+func (db *DB) DeleteCASActivity(id, studentID int) error {
+	result, err := db.Exec(
+		"DELETE FROM cas_activities WHERE id = $1 AND student_id = $2 AND status <> $3",
+		id, studentID, CASApproved,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	var status string
+	if err := db.QueryRow("SELECT status FROM cas_activities WHERE id = $1 AND student_id = $2", id, studentID).Scan(&status); err != nil {
+		return err
+	}
+	return ErrCASApproved
+}
+
+// ReviewCASActivity approves or rejects a pending activity
+//
+// Parameters:
+//   - id: Activity to review
+//   - supervisorID: User ID of the reviewing teacher, who must supervise the activity
+//   - req: Decision and comment
+//
+// Returns:
+//   - *CASActivity: Reviewed activity
+//   - error: sql.ErrNoRows if the activity does not exist, ErrInvalidCAS,
+//     ErrNotSupervisor, ErrCASReviewed, or a database error
+func (db *DB) ReviewCASActivity(id, supervisorID int, req *CASReviewRequest) (*CASActivity, error) {
+	if err := ValidateCASReview(req); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var supervisor int
+	var status string
+	err = tx.QueryRow(
+		"SELECT COALESCE(supervisor_id, 0), status FROM cas_activities WHERE id = $1 FOR UPDATE", id,
+	).Scan(&supervisor, &status)
+	if err != nil {
+		return nil, err
+	}
+	if supervisor != supervisorID {
+		err = ErrNotSupervisor
+		return nil, err
+	}
+	if status != CASPending {
+		err = ErrCASReviewed
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE cas_activities SET status = $1, review_comment = $2, reviewed_at = NOW() WHERE id = $3",
+		req.Status, req.Comment, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return db.GetCASActivity(id)
+}
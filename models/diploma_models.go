@@ -0,0 +1,378 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Results of a diploma status and of its rules
+const (
+	DiplomaOnTrack    = "on_track"   // Every rule passes
+	DiplomaFailing    = "failing"    // At least one failing condition applies
+	DiplomaIncomplete = "incomplete" // No rule fails yet but grades are missing
+
+	RulePassed  = "passed"
+	RuleFailed  = "failed"
+	RulePending = "pending" // Cannot be decided until missing grades are known
+)
+
+// Diploma point limits
+const (
+	DiplomaMinPoints   = 24 // Fewest points a diploma is awarded with
+	DiplomaMinHLPoints = 12 // Fewest points from the best three HL subjects
+	DiplomaMinSLPoints = 9  // Fewest points from three SL subjects
+	DiplomaMinSLPair   = 5  // Fewest points from two SL subjects, for candidates with four HL
+)
+
+// ErrInvalidDiplomaCore is returned for invalid TOK, EE or CAS results
+var ErrInvalidDiplomaCore = errors.New("invalid diploma core results")
+
+// corePoints is the official matrix of points for the TOK (rows) and EE
+// (columns) grades A to D. An E in either is a failing condition.
+var corePoints = [4][4]int{
+	{3, 3, 2, 2},
+	{3, 2, 2, 1},
+	{2, 2, 1, 0},
+	{2, 1, 0, 0},
+}
+
+// DiplomaCore holds a student's results in the diploma core
+type DiplomaCore struct {
+	StudentID   int       `json:"student_id"`
+	TOK         string    `json:"tok"`                  // Theory of Knowledge grade A to E or N, empty if not graded yet
+	EE          string    `json:"ee"`                   // Extended Essay grade A to E or N, empty if not graded yet
+	CASComplete *bool     `json:"cas_complete"`         // Whether CAS requirements are met, null if not decided yet
+	UpdatedBy   int       `json:"updated_by,omitempty"` // User who last changed the results, 0 if deleted
+	UpdatedAt   time.Time `json:"updated_at,omitempty"` // Time of the last change, zero if never recorded
+}
+
+// DiplomaCoreRequest is used for recording a student's core results
+type DiplomaCoreRequest struct {
+	TOK         string `json:"tok"`          // A to E or N; empty if not graded yet
+	EE          string `json:"ee"`           // A to E or N; empty if not graded yet
+	CASComplete *bool  `json:"cas_complete"` // Omit or null if not decided yet
+}
+
+// DiplomaSubjectGrade is a subject grade counted towards the diploma
+type DiplomaSubjectGrade struct {
+	SubjectID   int    `json:"subject_id"`
+	SubjectName string `json:"subject_name"`
+	Group       int    `json:"group"`
+	Level       string `json:"level"`            // HL or SL
+	Grade       int    `json:"grade,omitempty"`  // IB grade 1 to 7, omitted if not known yet
+	Source      string `json:"source,omitempty"` // "predicted" or "current"
+}
+
+// DiplomaRule is the outcome of one diploma requirement
+type DiplomaRule struct {
+	Rule        string `json:"rule"`        // Stable identifier, e.g. "min_points"
+	Description string `json:"description"` // The requirement
+	Result      string `json:"result"`      // passed, failed or pending
+	Explanation string `json:"explanation"` // How the result was reached
+}
+
+// DiplomaStatus tells whether a student is on track for the IB diploma
+type DiplomaStatus struct {
+	StudentID     int                   `json:"student_id"`
+	StudentName   string                `json:"student_name"`
+	Status        string                `json:"status"` // on_track, failing or incomplete
+	Subjects      []DiplomaSubjectGrade `json:"subjects"`
+	Core          DiplomaCore           `json:"core"`
+	SubjectPoints int                   `json:"subject_points"` // Sum of the known subject grades
+	CorePoints    int                   `json:"core_points"`    // TOK/EE bonus points, 0 to 3
+	TotalPoints   int                   `json:"total_points"`   // Out of 45
+	Rules         []DiplomaRule         `json:"rules"`
+}
+
+// normalizeCoreGrade upper-cases and checks a TOK or EE grade
+func normalizeCoreGrade(name, grade string) (string, error) {
+	grade = strings.ToUpper(strings.TrimSpace(grade))
+	switch grade {
+	case "", "A", "B", "C", "D", "E", "N":
+		return grade, nil
+	}
+	return "", fmt.Errorf("%w: %s must be A, B, C, D, E or N", ErrInvalidDiplomaCore, name)
+}
+
+// ValidateDiplomaCore checks and normalizes core results in place
+//
+// Returns:
+//   - error: ErrInvalidDiplomaCore wrapped with the problem, or nil
+func ValidateDiplomaCore(req *DiplomaCoreRequest) error {
+	var err error
+	if req.TOK, err = normalizeCoreGrade("tok", req.TOK); err != nil {
+		return err
+	}
+	req.EE, err = normalizeCoreGrade("ee", req.EE)
+	return err
+}
+
+// CorePoints looks up the bonus points for a TOK and EE grade combination
+//
+// Parameters:
+//   - tok, ee: Grades A to D
+//
+// Returns:
+//   - int: Points from 0 to 3
+//   - bool: False if either grade is not A to D
+func CorePoints(tok, ee string) (int, bool) {
+	if len(tok) != 1 || len(ee) != 1 || tok[0] < 'A' || tok[0] > 'D' || ee[0] < 'A' || ee[0] > 'D' {
+		return 0, false
+	}
+	return corePoints[tok[0]-'A'][ee[0]-'A'], true
+}
+
+// EvaluateDiploma applies the IB diploma points rules and failing conditions.
+// Missing grades leave the rules that depend on them pending, but rules that
+// already fail with the known grades are reported as failed.
+//
+// Parameters:
+//   - subjects: The student's HL and SL subjects with their known grades
+//   - core: The student's TOK, EE and CAS results
+//
+// Returns:
+//   - *DiplomaStatus: Points, rules and overall status; student fields are left unset
+func EvaluateDiploma(subjects []DiplomaSubjectGrade, core DiplomaCore) *DiplomaStatus {
+	status := &DiplomaStatus{Subjects: subjects, Core: core}
+	rule := func(name, description, result, explanation string, args ...interface{}) {
+		status.Rules = append(status.Rules, DiplomaRule{
+			Rule:        name,
+			Description: description,
+			Result:      result,
+			Explanation: fmt.Sprintf(explanation, args...),
+		})
+	}
+
+	var hl, sl []int
+	graded, ones, twos, lowGrades := 0, 0, 0, 0
+	for _, s := range subjects {
+		if s.Grade == 0 {
+			continue
+		}
+		graded++
+		status.SubjectPoints += s.Grade
+		if s.Level == LevelHL {
+			hl = append(hl, s.Grade)
+		} else {
+			sl = append(sl, s.Grade)
+		}
+		switch {
+		case s.Grade == 1:
+			ones++
+		case s.Grade == 2:
+			twos++
+		}
+		if s.Grade <= 3 {
+			lowGrades++
+		}
+	}
+	allGraded := len(subjects) == DiplomaSubjectCount && graded == DiplomaSubjectCount
+
+	// Six subjects with grades
+	switch {
+	case allGraded:
+		rule("subjects", "Six subjects are graded", RulePassed, "All %d subjects have a grade", DiplomaSubjectCount)
+	default:
+		rule("subjects", "Six subjects are graded", RulePending, "%d of %d subjects enrolled, %d graded", len(subjects), DiplomaSubjectCount, graded)
+	}
+
+	// TOK/EE bonus points and grades
+	coreKnown := core.TOK != "" && core.EE != ""
+	if points, ok := CorePoints(core.TOK, core.EE); ok {
+		status.CorePoints = points
+	}
+	switch {
+	case core.TOK == "N" || core.EE == "N":
+		rule("no_n", "No N is awarded for TOK or the EE", RuleFailed, "TOK %s, EE %s", coreLabel(core.TOK), coreLabel(core.EE))
+	case !coreKnown:
+		rule("no_n", "No N is awarded for TOK or the EE", RulePending, "TOK %s, EE %s", coreLabel(core.TOK), coreLabel(core.EE))
+	default:
+		rule("no_n", "No N is awarded for TOK or the EE", RulePassed, "TOK %s, EE %s", core.TOK, core.EE)
+	}
+	switch {
+	case core.TOK == "E" || core.EE == "E":
+		rule("no_e", "No E is awarded for TOK or the EE", RuleFailed, "TOK %s, EE %s", coreLabel(core.TOK), coreLabel(core.EE))
+	case !coreKnown || core.TOK == "N" || core.EE == "N":
+		rule("no_e", "No E is awarded for TOK or the EE", RulePending, "TOK %s, EE %s", coreLabel(core.TOK), coreLabel(core.EE))
+	default:
+		rule("no_e", "No E is awarded for TOK or the EE", RulePassed, "TOK %s and EE %s give %d bonus points", core.TOK, core.EE, status.CorePoints)
+	}
+
+	// CAS
+	switch {
+	case core.CASComplete == nil:
+		rule("cas", "CAS requirements are met", RulePending, "CAS has not been assessed yet")
+	case *core.CASComplete:
+		rule("cas", "CAS requirements are met", RulePassed, "CAS is complete")
+	default:
+		rule("cas", "CAS requirements are met", RuleFailed, "CAS requirements have not been met")
+	}
+
+	// Total points
+	status.TotalPoints = status.SubjectPoints + status.CorePoints
+	switch {
+	case allGraded && coreKnown && status.TotalPoints >= DiplomaMinPoints:
+		rule("min_points", "At least 24 points in total", RulePassed, "%d points (%d from subjects, %d bonus)", status.TotalPoints, status.SubjectPoints, status.CorePoints)
+	case allGraded && coreKnown:
+		rule("min_points", "At least 24 points in total", RuleFailed, "%d points (%d from subjects, %d bonus)", status.TotalPoints, status.SubjectPoints, status.CorePoints)
+	default:
+		rule("min_points", "At least 24 points in total", RulePending, "%d points so far", status.TotalPoints)
+	}
+
+	// Low grades fail as soon as they are awarded
+	if ones > 0 {
+		rule("no_grade_1", "No grade 1 in any subject", RuleFailed, "%d subject(s) graded 1", ones)
+	} else if allGraded {
+		rule("no_grade_1", "No grade 1 in any subject", RulePassed, "No subject is graded 1")
+	} else {
+		rule("no_grade_1", "No grade 1 in any subject", RulePending, "No graded subject is graded 1 so far")
+	}
+	if twos >= 3 {
+		rule("grade_2_count", "Grade 2 awarded fewer than three times", RuleFailed, "Grade 2 awarded %d times", twos)
+	} else if allGraded {
+		rule("grade_2_count", "Grade 2 awarded fewer than three times", RulePassed, "Grade 2 awarded %d times", twos)
+	} else {
+		rule("grade_2_count", "Grade 2 awarded fewer than three times", RulePending, "Grade 2 awarded %d times so far", twos)
+	}
+	if lowGrades >= 4 {
+		rule("grade_3_count", "Grade 3 or below awarded fewer than four times", RuleFailed, "Grade 3 or below awarded %d times", lowGrades)
+	} else if allGraded {
+		rule("grade_3_count", "Grade 3 or below awarded fewer than four times", RulePassed, "Grade 3 or below awarded %d times", lowGrades)
+	} else {
+		rule("grade_3_count", "Grade 3 or below awarded fewer than four times", RulePending, "Grade 3 or below awarded %d times so far", lowGrades)
+	}
+
+	// HL and SL minimums. With four HL subjects the best three count and the
+	// two SL subjects need fewer points.
+	if allGraded {
+		sort.Sort(sort.Reverse(sort.IntSlice(hl)))
+		best := min(len(hl), DiplomaMinHL)
+		hlPoints := sumInts(hl[:best])
+		if hlPoints >= DiplomaMinHLPoints {
+			rule("hl_points", "At least 12 points at HL", RulePassed, "%d points from the best %d HL subjects", hlPoints, best)
+		} else {
+			rule("hl_points", "At least 12 points at HL", RuleFailed, "%d points from the best %d HL subjects", hlPoints, best)
+		}
+
+		slMin := DiplomaMinSLPoints
+		if len(sl) < DiplomaSubjectCount-DiplomaMinHL {
+			slMin = DiplomaMinSLPair
+		}
+		slPoints := sumInts(sl)
+		description := fmt.Sprintf("At least %d points at SL", slMin)
+		if slPoints >= slMin {
+			rule("sl_points", description, RulePassed, "%d points from %d SL subjects", slPoints, len(sl))
+		} else {
+			rule("sl_points", description, RuleFailed, "%d points from %d SL subjects", slPoints, len(sl))
+		}
+	} else {
+		rule("hl_points", "At least 12 points at HL", RulePending, "%d points from %d graded HL subjects so far", sumInts(hl), len(hl))
+		rule("sl_points", "At least 9 points at SL (5 with two SL subjects)", RulePending, "%d points from %d graded SL subjects so far", sumInts(sl), len(sl))
+	}
+
+	status.Status = DiplomaOnTrack
+	for _, r := range status.Rules {
+		if r.Result == RuleFailed {
+			status.Status = DiplomaFailing
+			break
+		}
+		if r.Result == RulePending {
+			status.Status = DiplomaIncomplete
+		}
+	}
+	return status
+}
+
+// coreLabel describes a TOK or EE grade for explanations
+func coreLabel(grade string) string {
+	if grade == "" {
+		return "not graded"
+	}
+	return grade
+}
+
+// sumInts adds up integers
+func sumInts(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+// GetDiplomaCore retrieves a student's TOK, EE and CAS results
+//
+// Parameters:
+//   - studentID: Student whose results are retrieved
+//
+// Returns:
+//   - *DiplomaCore: Results, empty if none have been recorded
+//   - error: sql.ErrNoRows if the student does not exist, or a database error
+func (db *DB) GetDiplomaCore(studentID int) (*DiplomaCore, error) {
+	var id int
+	if err := db.QueryRow("SELECT id FROM students WHERE id = $1", studentID).Scan(&id); err != nil {
+		return nil, err
+	}
+
+	core := &DiplomaCore{StudentID: studentID}
+	var cas sql.NullBool
+	var updatedAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT COALESCE(tok_grade, ''), COALESCE(ee_grade, ''), cas_complete,
+		       COALESCE(updated_by, 0), updated_at
+		FROM diploma_core WHERE student_id = $1`,
+		studentID,
+	).Scan(&core.TOK, &core.EE, &cas, &core.UpdatedBy, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return core, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cas.Valid {
+		core.CASComplete = &cas.Bool
+	}
+	core.UpdatedAt = updatedAt.Time
+	return core, nil
+}
+
+// SetDiplomaCore records a student's TOK, EE and CAS results, replacing earlier ones
+//
+// Parameters:
+//   - studentID: Student whose results are recorded
+//   - userID: User recording the results
+//   - req: TOK and EE grades and CAS completion
+//
+// Returns:
+//   - *DiplomaCore: Recorded results
+//   - error: sql.ErrNoRows if the student does not exist, ErrInvalidDiplomaCore, or a database error
+func (db *DB) SetDiplomaCore(studentID, userID int, req *DiplomaCoreRequest) (*DiplomaCore, error) {
+	if err := ValidateDiplomaCore(req); err != nil {
+		return nil, err
+	}
+
+	var id int
+	if err := db.QueryRow("SELECT id FROM students WHERE id = $1", studentID).Scan(&id); err != nil {
+		return nil, err
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO diploma_core (student_id, tok_grade, ee_grade, cas_complete, updated_by, updated_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, NOW())
+		ON CONFLICT (student_id) DO UPDATE
+		SET tok_grade = EXCLUDED.tok_grade, ee_grade = EXCLUDED.ee_grade, cas_complete = EXCLUDED.cas_complete,
+		    updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at`,
+		studentID, req.TOK, req.EE, req.CASComplete, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetDiplomaCore(studentID)
+}
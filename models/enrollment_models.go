@@ -0,0 +1,434 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Subject levels for IB subjects
+const (
+	LevelHL = "HL" // Higher Level
+	LevelSL = "SL" // Standard Level
+)
+
+// IB diploma subject requirements
+const (
+	DiplomaSubjectCount = 6 // Subjects a diploma candidate takes
+	DiplomaMinHL        = 3 // Minimum subjects at Higher Level
+	DiplomaMaxHL        = 4 // Maximum subjects at Higher Level
+)
+
+// SubjectGroupNames maps IB subject groups to their names
+var SubjectGroupNames = map[int]string{
+	1: "Studies in Language and Literature",
+	2: "Language Acquisition",
+	3: "Individuals and Societies",
+	4: "Sciences",
+	5: "Mathematics",
+	6: "The Arts",
+}
+
+// ErrEnrollmentRule is returned when an enrollment would break the IB diploma
+// subject rules. The wrapped message describes the broken rule.
+var ErrEnrollmentRule = errors.New("enrollment violates IB diploma rules")
+
+// Enrollment represents a student taking a subject
+type Enrollment struct {
+	StudentID   int       `json:"student_id"`      // Reference to students table
+	SubjectID   int       `json:"subject_id"`      // Reference to subjects table
+	SubjectName string    `json:"subject_name"`    // Subject name (added for convenience)
+	Grade       string    `json:"grade"`           // Grade of the subject
+	Group       int       `json:"group"`           // IB subject group, 0 if none
+	Level       string    `json:"level,omitempty"` // HL or SL, empty for Pre-IB subjects
+	CreatedAt   time.Time `json:"created_at"`      // Enrollment timestamp
+}
+
+// EnrollmentRequest is used for enrolling a student in a subject
+type EnrollmentRequest struct {
+	SubjectID int    `json:"subject_id"`      // Subject to enroll in
+	Level     string `json:"level,omitempty"` // HL or SL; omitted for Pre-IB subjects
+}
+
+// DiplomaCheck reports whether a student's subjects form a valid IB diploma combination
+type DiplomaCheck struct {
+	Complete bool     `json:"complete"` // All rules are satisfied
+	Problems []string `json:"problems"` // Rules that are not yet satisfied
+}
+
+// IsDiplomaGrade reports whether the IB diploma subject rules apply to a grade
+func IsDiplomaGrade(grade string) bool {
+	return grade == "IB1" || grade == "IB2"
+}
+
+// ValidateEnrollment checks whether a student may enroll in a subject. For IB
+// students the resulting combination must still be completable into a valid
+// diploma: at most six subjects, at most four at HL, room left for every
+// missing group and enough HL slots.
+//
+// Parameters:
+//   - student: Student to enroll
+//   - subject: Subject to enroll in
+//   - level: HL or SL for IB subjects, empty for Pre-IB subjects
+//   - existing: The student's current enrollments
+//
+// Returns:
+//   - error: ErrSubjectArchived, ErrEnrollmentRule wrapped with the broken rules, or nil
+func ValidateEnrollment(student *Student, subject *Subject, level string, existing []*Enrollment) error {
+	if subject.Grade != student.Grade {
+		return fmt.Errorf("%w: %s is a %s subject but the student is in %s",
+			ErrEnrollmentRule, subject.Name, subject.Grade, student.Grade)
+	}
+
+	if subject.Archived {
+		return ErrSubjectArchived
+	}
+
+	if !IsDiplomaGrade(student.Grade) {
+		if level != "" {
+			return fmt.Errorf("%w: levels only apply to IB subjects", ErrEnrollmentRule)
+		}
+		return nil
+	}
+
+	if level != LevelHL && level != LevelSL {
+		return fmt.Errorf("%w: level must be HL or SL", ErrEnrollmentRule)
+	}
+	if !subject.OffersLevel(level) {
+		return fmt.Errorf("%w: %s is not offered at %s", ErrEnrollmentRule, subject.Name, level)
+	}
+	if subject.Group == 0 {
+		return fmt.Errorf("%w: %s has no IB subject group", ErrEnrollmentRule, subject.Name)
+	}
+
+	combined := append(append([]*Enrollment(nil), existing...), &Enrollment{
+		SubjectID:   subject.ID,
+		SubjectName: subject.Name,
+		Grade:       subject.Grade,
+		Group:       subject.Group,
+		Level:       level,
+	})
+	if problems := diplomaProblems(student.Grade, combined, false); len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrEnrollmentRule, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// CheckDiplomaCombination checks a student's full set of enrollments against
+// the IB diploma rules: six subjects, one from each of groups 1 to 5, the sixth
+// from group 6 or a second from groups 1 to 4, and three or four at HL.
+//
+// Parameters:
+//   - student: Student whose enrollments are checked
+//   - enrollments: The student's enrollments
+//
+// Returns:
+//   - *DiplomaCheck: Result of the check, or nil for Pre-IB students
+func CheckDiplomaCombination(student *Student, enrollments []*Enrollment) *DiplomaCheck {
+	if !IsDiplomaGrade(student.Grade) {
+		return nil
+	}
+
+	problems := diplomaProblems(student.Grade, enrollments, true)
+	return &DiplomaCheck{
+		Complete: len(problems) == 0,
+		Problems: problems,
+	}
+}
+
+// diplomaProblems lists the diploma rules broken by a set of enrollments. When
+// final is false the set may be incomplete and only rules that can no longer
+// be satisfied by adding subjects are reported.
+func diplomaProblems(grade string, enrollments []*Enrollment, final bool) []string {
+	problems := []string{}
+	groups := make(map[int]int)
+	hl := 0
+
+	for _, e := range enrollments {
+		if e.Grade != grade {
+			problems = append(problems, fmt.Sprintf("%s is a %s subject but the student is in %s", e.SubjectName, e.Grade, grade))
+		}
+		if e.Group == 0 {
+			problems = append(problems, fmt.Sprintf("%s has no IB subject group", e.SubjectName))
+		}
+		if e.Level == LevelHL {
+			hl++
+		}
+		groups[e.Group]++
+	}
+
+	n := len(enrollments)
+	if n > DiplomaSubjectCount {
+		problems = append(problems, fmt.Sprintf("no more than %d subjects may be taken", DiplomaSubjectCount))
+	}
+	if hl > DiplomaMaxHL {
+		problems = append(problems, fmt.Sprintf("no more than %d subjects may be taken at HL", DiplomaMaxHL))
+	}
+	if groups[5] > 1 {
+		problems = append(problems, "only one group 5 (Mathematics) subject may be taken")
+	}
+	if groups[6] > 1 {
+		problems = append(problems, "only one group 6 (The Arts) subject may be taken")
+	}
+
+	var missing []int
+	for group := 1; group <= 5; group++ {
+		if groups[group] == 0 {
+			missing = append(missing, group)
+		}
+	}
+
+	remaining := DiplomaSubjectCount - n
+	if final {
+		if n < DiplomaSubjectCount {
+			problems = append(problems, fmt.Sprintf("%d of %d subjects enrolled", n, DiplomaSubjectCount))
+		}
+		for _, group := range missing {
+			problems = append(problems, fmt.Sprintf("no group %d (%s) subject", group, SubjectGroupNames[group]))
+		}
+		if hl < DiplomaMinHL {
+			problems = append(problems, fmt.Sprintf("at least %d subjects must be taken at HL", DiplomaMinHL))
+		}
+	} else {
+		if len(missing) > remaining && n <= DiplomaSubjectCount {
+			problems = append(problems, fmt.Sprintf("%d subject slots left but groups %s are still missing", remaining, joinInts(missing)))
+		}
+		if hl+remaining < DiplomaMinHL && n <= DiplomaSubjectCount {
+			problems = append(problems, fmt.Sprintf("at least %d subjects must be taken at HL", DiplomaMinHL))
+		}
+	}
+
+	return problems
+}
+
+// joinInts formats integers as a comma separated list
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprint(v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// GetStudentEnrollments retrieves the subjects a student is enrolled in
+//
+// Parameters:
+//   - studentID: Student to retrieve enrollments for
+//
+// Returns:
+//   - []*Enrollment: Enrollments ordered by subject group and name
+//   - error: Error if retrieval fails
+func (db *DB) GetStudentEnrollments(studentID int) ([]*Enrollment, error) {
+	return queryEnrollments(db.DB, studentID)
+}
+
+// EnrollStudent enrolls a student in a subject after validating the IB diploma
+// rules, unless a lesson of the subject clashes with one the student attends
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - studentID: Student to enroll
+//   - req: Subject and level
+//
+// Returns:
+//   - *Enrollment: Created enrollment, nil if there are conflicts
+//   - []TimetableConflict: Timetable clashes that kept the student from enrolling
+//   - error: sql.ErrNoRows if the student or subject does not exist,
+//     ErrDuplicate if already enrolled, ErrSubjectArchived, ErrEnrollmentRule,
+//     or a database error
+func (db *DB) EnrollStudent(studentID int, req *EnrollmentRequest) (*Enrollment, []TimetableConflict, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Lock the student row so concurrent enrollments are validated one at a time
+	student := &Student{ID: studentID}
+	err = tx.QueryRow("SELECT grade FROM students WHERE id = $1 FOR UPDATE", studentID).Scan(&student.Grade)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Share-lock the subject so it cannot be deleted while we enroll
+	subject := &Subject{}
+	err = scanSubject(tx.QueryRow(
+		"SELECT "+subjectColumns+" FROM subjects s WHERE s.id = $1 FOR SHARE",
+		req.SubjectID,
+	), subject)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	existing, err := queryEnrollments(tx, studentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range existing {
+		if e.SubjectID == subject.ID {
+			err = ErrDuplicate
+			return nil, nil, err
+		}
+	}
+
+	if err = ValidateEnrollment(student, subject, req.Level, existing); err != nil {
+		return nil, nil, err
+	}
+
+	// Share-lock the timetable so no lesson is scheduled against the enrollments
+	// being checked; concurrent enrollments of other students still proceed
+	if _, err = tx.Exec("LOCK TABLE timetable_lessons IN SHARE MODE"); err != nil {
+		return nil, nil, err
+	}
+	lessons, err := queryTimetableLessons(tx, "l.subject_id = $1", subject.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	attended, err := queryTimetableLessons(tx,
+		"l.subject_id IN (SELECT subject_id FROM enrollments WHERE student_id = $1)", studentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if conflicts := DetectEnrollmentConflicts(studentID, lessons, attended); len(conflicts) > 0 {
+		tx.Rollback()
+		return nil, conflicts, nil
+	}
+
+	enrollment := &Enrollment{
+		StudentID:   studentID,
+		SubjectID:   subject.ID,
+		SubjectName: subject.Name,
+		Grade:       subject.Grade,
+		Group:       subject.Group,
+		Level:       req.Level,
+	}
+	err = tx.QueryRow(
+		"INSERT INTO enrollments (student_id, subject_id, level) VALUES ($1, $2, NULLIF($3, '')) RETURNING created_at",
+		studentID, subject.ID, req.Level,
+	).Scan(&enrollment.CreatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return enrollment, nil, nil
+}
+
+// UnenrollStudent removes a student from a subject
+//
+// Parameters:
+//   - studentID: Student to unenroll
+//   - subjectID: Subject to remove
+//
+// Returns:
+//   - error: sql.ErrNoRows if the student is not enrolled, or a database error
+func (db *DB) UnenrollStudent(studentID, subjectID int) error {
+	res, err := db.Exec(
+		"DELETE FROM enrollments WHERE student_id = $1 AND subject_id = $2",
+		studentID, subjectID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// queryEnrollments loads a student's enrollments using either the database or a transaction
+func queryEnrollments(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, studentID int) ([]*Enrollment, error) {
+	query := `
+		SELECT e.student_id, e.subject_id, s.name, s.grade, COALESCE(s.subject_group, 0),
+		       COALESCE(e.level, ''), e.created_at
+		FROM enrollments e
+		JOIN subjects s ON s.id = e.subject_id
+		WHERE e.student_id = $1
+		ORDER BY COALESCE(s.subject_group, 0), s.name
+	`
+	rows, err := q.Query(query, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	enrollments := []*Enrollment{}
+	for rows.Next() {
+		e := &Enrollment{}
+		err := rows.Scan(
+			&e.StudentID,
+			&e.SubjectID,
+			&e.SubjectName,
+			&e.Grade,
+			&e.Group,
+			&e.Level,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		enrollments = append(enrollments, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return enrollments, nil
+}
+
+// enrolledStudents reports which of a list of students are enrolled in a subject
+//
+// Parameters:
+//   - q: Database or transaction
+//   - subjectID: Subject to check
+//   - studentIDs: Students to check
+//
+// Returns:
+//   - map[int]bool: True for every enrolled student
+//   - error: Database error
+func enrolledStudents(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, subjectID int, studentIDs []int) (map[int]bool, error) {
+	ids := make([]int64, len(studentIDs))
+	for i, id := range studentIDs {
+		ids[i] = int64(id)
+	}
+	rows, err := q.Query(
+		"SELECT student_id FROM enrollments WHERE subject_id = $1 AND student_id = ANY($2)",
+		subjectID, pq.Array(ids),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	enrolled := make(map[int]bool, len(studentIDs))
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		enrolled[id] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return enrolled, nil
+}
@@ -0,0 +1,27 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// ErrDuplicate is returned by MemoryStore when a unique constraint would be violated
+var ErrDuplicate = errors.New("duplicate key value violates unique constraint")
+
+// IsDuplicate reports whether an error is a unique constraint violation,
+// either from PostgreSQL or from MemoryStore.
+//
+// Parameters:
+//   - err: Error returned by a store method
+//
+// Returns:
+//   - bool: True if the write conflicted with an existing row
+func IsDuplicate(err error) bool {
+	if errors.Is(err, ErrDuplicate) {
+		return true
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
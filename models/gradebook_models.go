@@ -0,0 +1,1093 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// IB grades range from 1 to 7
+const (
+	MinIBGrade = 1
+	MaxIBGrade = 7
+)
+
+// Limits on grading schemes
+const (
+	maxAssessmentCategories = 20
+	maxCategoryNameLength   = 50
+)
+
+// DefaultGradeBoundaries are the minimum percentages for IB grades 2 to 7 of
+// subjects without their own boundaries. Any lower percentage is a 1.
+var DefaultGradeBoundaries = []float64{20, 30, 42, 54, 66, 78}
+
+// Errors returned by gradebook operations
+var (
+	// ErrInvalidGradebook is returned for an invalid grading scheme,
+	// assessment, mark or predicted grade. The wrapped message describes the problem.
+	ErrInvalidGradebook = errors.New("invalid gradebook entry")
+	// ErrCategoryInUse is returned when a grading scheme drops a category
+	// that assessments still belong to
+	ErrCategoryInUse = errors.New("assessment category is in use")
+)
+
+// AssessmentCategory is a weighted group of assessments, e.g. tests or homework
+type AssessmentCategory struct {
+	Name   string  `json:"name"`   // Unique within the subject
+	Weight float64 `json:"weight"` // Relative weight in the current grade
+}
+
+// GradingScheme defines how a subject's marks make up the current grade
+type GradingScheme struct {
+	SubjectID         int                  `json:"subject_id"`
+	Categories        []AssessmentCategory `json:"categories"`         // Categories in display order
+	Boundaries        []float64            `json:"boundaries"`         // Minimum percentages for grades 2 to 7
+	DefaultBoundaries bool                 `json:"default_boundaries"` // Boundaries are DefaultGradeBoundaries
+}
+
+// GradingSchemeRequest is used for replacing a subject's grading scheme
+type GradingSchemeRequest struct {
+	Categories []AssessmentCategory `json:"categories"`           // Full set of categories
+	Boundaries []float64            `json:"boundaries,omitempty"` // Six ascending percentages; omit for the defaults
+}
+
+// Assessment is a marked piece of work in a subject
+type Assessment struct {
+	ID        int                `json:"id"`                   // Unique identifier
+	SubjectID int                `json:"subject_id"`           // Reference to subjects table
+	Category  string             `json:"category"`             // Category of the subject's grading scheme
+	Name      string             `json:"name"`                 // e.g. "Unit 1 test"
+	Weight    float64            `json:"weight"`               // Weight within the category
+	MaxMark   float64            `json:"max_mark"`             // Highest possible mark
+	Date      time.Time          `json:"date"`                 // Day the assessment was taken
+	CreatedBy int                `json:"created_by,omitempty"` // Teacher who created it, 0 if deleted
+	CreatedAt time.Time          `json:"created_at"`           // Creation timestamp
+	Scores    []*AssessmentScore `json:"scores,omitempty"`     // Marks ordered by student name
+}
+
+// AssessmentRequest is used for creating or updating an assessment
+type AssessmentRequest struct {
+	Name     string  `json:"name"`             // Required
+	Category string  `json:"category"`         // Must be a category of the grading scheme
+	Weight   float64 `json:"weight,omitempty"` // Weight within the category, defaults to 1
+	MaxMark  float64 `json:"max_mark"`         // Highest possible mark, must be positive
+	Date     string  `json:"date"`             // Day of the assessment as YYYY-MM-DD
+}
+
+// AssessmentScore is a student's mark for an assessment
+type AssessmentScore struct {
+	StudentID   int       `json:"student_id"`            // Reference to students table
+	StudentName string    `json:"student_name"`          // First and last name (added for convenience)
+	Mark        float64   `json:"mark"`                  // Between 0 and the maximum mark
+	RecordedBy  int       `json:"recorded_by,omitempty"` // User who last changed the mark, 0 if deleted
+	RecordedAt  time.Time `json:"recorded_at"`           // Time of the last change
+}
+
+// ScoreEntry records a student's mark for an assessment
+type ScoreEntry struct {
+	StudentID int     `json:"student_id"` // Student, who must be enrolled in the subject
+	Mark      float64 `json:"mark"`       // Between 0 and the maximum mark
+}
+
+// PredictedGrade is a teacher's prediction of a student's final IB grade
+type PredictedGrade struct {
+	ID        int       `json:"id"`                   // Unique identifier
+	SubjectID int       `json:"subject_id"`           // Reference to subjects table
+	StudentID int       `json:"student_id"`           // Reference to students table
+	Grade     int       `json:"grade"`                // IB grade 1 to 7
+	Comment   string    `json:"comment,omitempty"`    // Optional justification
+	TeacherID int       `json:"teacher_id,omitempty"` // Teacher who made it, 0 if deleted
+	CreatedAt time.Time `json:"created_at"`           // Creation timestamp
+}
+
+// PredictedGradeRequest is used for entering a predicted grade
+type PredictedGradeRequest struct {
+	Grade   int    `json:"grade"`   // IB grade 1 to 7
+	Comment string `json:"comment"` // Optional justification
+}
+
+// CategoryGrade is a student's result in one category of a grading scheme
+type CategoryGrade struct {
+	AssessmentCategory
+	Percentage *float64 `json:"percentage"` // Weighted percentage, null without marks
+}
+
+// StudentGrade is a student's current standing in a subject
+type StudentGrade struct {
+	StudentID   int             `json:"student_id"`
+	StudentName string          `json:"student_name"`
+	Percentage  *float64        `json:"percentage"`          // Weighted percentage, null without marks
+	Grade       int             `json:"grade,omitempty"`     // Current IB grade, omitted without marks
+	Categories  []CategoryGrade `json:"categories"`          // Result per category
+	Predicted   *PredictedGrade `json:"predicted,omitempty"` // Latest predicted grade
+}
+
+// StudentMark is an assessment together with one student's mark
+type StudentMark struct {
+	AssessmentID int       `json:"assessment_id"`
+	Name         string    `json:"name"`
+	Category     string    `json:"category"`
+	Weight       float64   `json:"weight"`
+	MaxMark      float64   `json:"max_mark"`
+	Date         time.Time `json:"date"`
+	Mark         *float64  `json:"mark"` // Null if not marked yet
+}
+
+// StudentGradebook is a student's full record in a subject
+type StudentGradebook struct {
+	StudentGrade
+	Marks            []*StudentMark    `json:"marks"`             // Every assessment of the subject, oldest first
+	PredictedHistory []*PredictedGrade `json:"predicted_history"` // Every predicted grade, newest first
+}
+
+// roundPercentage rounds a percentage to one decimal
+func roundPercentage(p float64) float64 {
+	return math.Round(p*10) / 10
+}
+
+// IBGrade converts a percentage to an IB grade using grade boundaries
+//
+// Parameters:
+//   - percentage: Percentage between 0 and 100
+//   - boundaries: Ascending minimum percentages for grades 2 to 7
+//
+// Returns:
+//   - int: IB grade from 1 to 7
+func IBGrade(percentage float64, boundaries []float64) int {
+	grade := MinIBGrade
+	for _, boundary := range boundaries {
+		if percentage >= boundary {
+			grade++
+		}
+	}
+	return grade
+}
+
+// ComputeGrade works out a student's current grade from their marks. Each
+// category's percentage is the weighted average of its marked assessments;
+// the overall percentage is the weighted average of the categories with marks.
+//
+// Parameters:
+//   - scheme: Grading scheme of the subject
+//   - assessments: Assessments of the subject
+//   - marks: The student's mark per assessment ID
+//
+// Returns:
+//   - StudentGrade: Percentage, grade and categories; student fields are left unset
+func ComputeGrade(scheme *GradingScheme, assessments []*Assessment, marks map[int]float64) StudentGrade {
+	type sums struct{ scored, weight float64 }
+	byCategory := map[string]*sums{}
+	for _, a := range assessments {
+		mark, ok := marks[a.ID]
+		if !ok {
+			continue
+		}
+		s := byCategory[a.Category]
+		if s == nil {
+			s = &sums{}
+			byCategory[a.Category] = s
+		}
+		s.scored += a.Weight * mark / a.MaxMark
+		s.weight += a.Weight
+	}
+
+	result := StudentGrade{Categories: make([]CategoryGrade, len(scheme.Categories))}
+	var total, totalWeight float64
+	for i, category := range scheme.Categories {
+		result.Categories[i].AssessmentCategory = category
+		s := byCategory[category.Name]
+		if s == nil || s.weight == 0 {
+			continue
+		}
+		percentage := 100 * s.scored / s.weight
+		rounded := roundPercentage(percentage)
+		result.Categories[i].Percentage = &rounded
+		total += category.Weight * percentage
+		totalWeight += category.Weight
+	}
+
+	if totalWeight > 0 {
+		percentage := roundPercentage(total / totalWeight)
+		result.Percentage = &percentage
+		result.Grade = IBGrade(percentage, scheme.Boundaries)
+	}
+	return result
+}
+
+// ValidateGradingScheme checks a grading scheme request. Category names are
+// trimmed in place.
+//
+// Parameters:
+//   - req: Categories and boundaries to check
+//
+// Returns:
+//   - error: ErrInvalidGradebook wrapped with the first problem, or nil
+func ValidateGradingScheme(req *GradingSchemeRequest) error {
+	if len(req.Categories) == 0 {
+		return fmt.Errorf("%w: at least one category is required", ErrInvalidGradebook)
+	}
+	if len(req.Categories) > maxAssessmentCategories {
+		return fmt.Errorf("%w: no more than %d categories are allowed", ErrInvalidGradebook, maxAssessmentCategories)
+	}
+
+	seen := map[string]bool{}
+	for i := range req.Categories {
+		c := &req.Categories[i]
+		c.Name = strings.TrimSpace(c.Name)
+		if c.Name == "" || len(c.Name) > maxCategoryNameLength {
+			return fmt.Errorf("%w: category names must be 1 to %d characters", ErrInvalidGradebook, maxCategoryNameLength)
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("%w: category %q is listed more than once", ErrInvalidGradebook, c.Name)
+		}
+		seen[c.Name] = true
+		if c.Weight <= 0 || c.Weight > 1000 {
+			return fmt.Errorf("%w: weight of category %q must be above 0 and at most 1000", ErrInvalidGradebook, c.Name)
+		}
+	}
+
+	if req.Boundaries == nil {
+		return nil
+	}
+	if len(req.Boundaries) != MaxIBGrade-MinIBGrade {
+		return fmt.Errorf("%w: boundaries must list the minimum percentages for grades 2 to 7", ErrInvalidGradebook)
+	}
+	previous := 0.0
+	for i, boundary := range req.Boundaries {
+		if boundary <= previous || boundary > 100 {
+			return fmt.Errorf("%w: boundary for grade %d must be above %g and at most 100", ErrInvalidGradebook, i+2, previous)
+		}
+		previous = boundary
+	}
+	return nil
+}
+
+// ValidateAssessment checks an assessment request against a grading scheme.
+// The name and category are trimmed and a zero weight is set to 1 in place.
+//
+// Parameters:
+//   - req: Assessment to check
+//   - scheme: Grading scheme of the subject
+//
+// Returns:
+//   - time.Time: Date of the assessment
+//   - error: ErrInvalidGradebook wrapped with the first problem, or nil
+func ValidateAssessment(req *AssessmentRequest, scheme *GradingScheme) (time.Time, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Category = strings.TrimSpace(req.Category)
+	if req.Name == "" || len(req.Name) > 100 {
+		return time.Time{}, fmt.Errorf("%w: name must be 1 to 100 characters", ErrInvalidGradebook)
+	}
+
+	known := false
+	for _, c := range scheme.Categories {
+		if c.Name == req.Category {
+			known = true
+		}
+	}
+	if !known {
+		return time.Time{}, fmt.Errorf("%w: category %q is not part of the subject's grading scheme", ErrInvalidGradebook, req.Category)
+	}
+
+	if req.Weight == 0 {
+		req.Weight = 1
+	}
+	if req.Weight < 0 || req.Weight > 1000 {
+		return time.Time{}, fmt.Errorf("%w: weight must be above 0 and at most 1000", ErrInvalidGradebook)
+	}
+	if req.MaxMark <= 0 || req.MaxMark > 100000 {
+		return time.Time{}, fmt.Errorf("%w: max_mark must be above 0 and at most 100000", ErrInvalidGradebook)
+	}
+
+	date, err := time.Parse(LessonDateLayout, strings.TrimSpace(req.Date))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: date must be formatted as YYYY-MM-DD", ErrInvalidGradebook)
+	}
+	return date, nil
+}
+
+// ValidateScores checks marks for an assessment
+//
+// Parameters:
+//   - entries: Marks to check
+//   - maxMark: Highest possible mark of the assessment
+//   - enrolled: IDs of the students enrolled in the subject
+//
+// Returns:
+//   - error: ErrInvalidGradebook wrapped with the first problem, or nil
+func ValidateScores(entries []ScoreEntry, maxMark float64, enrolled map[int]bool) error {
+	seen := make(map[int]bool, len(entries))
+	for _, e := range entries {
+		if e.Mark < 0 || e.Mark > maxMark {
+			return fmt.Errorf("%w: mark of student %d must be between 0 and %g", ErrInvalidGradebook, e.StudentID, maxMark)
+		}
+		if seen[e.StudentID] {
+			return fmt.Errorf("%w: student %d is listed more than once", ErrInvalidGradebook, e.StudentID)
+		}
+		seen[e.StudentID] = true
+		if !enrolled[e.StudentID] {
+			return fmt.Errorf("%w: student %d is not enrolled in the subject", ErrInvalidGradebook, e.StudentID)
+		}
+	}
+	return nil
+}
+
+// ValidatePredictedGrade checks a predicted grade request. The comment is
+// trimmed in place.
+//
+// Returns:
+//   - error: ErrInvalidGradebook if the grade is not 1 to 7, or nil
+func ValidatePredictedGrade(req *PredictedGradeRequest) error {
+	req.Comment = strings.TrimSpace(req.Comment)
+	if req.Grade < MinIBGrade || req.Grade > MaxIBGrade {
+		return fmt.Errorf("%w: grade must be between %d and %d", ErrInvalidGradebook, MinIBGrade, MaxIBGrade)
+	}
+	return nil
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// assessmentColumns lists the columns scanned by scanAssessment
+const assessmentColumns = `a.id, a.subject_id, a.category, a.name, a.weight, a.max_mark,
+		       a.assessed_on, COALESCE(a.created_by, 0), a.created_at`
+
+// scanAssessment scans a row selected with assessmentColumns
+func scanAssessment(row interface{ Scan(...interface{}) error }, a *Assessment) error {
+	return row.Scan(&a.ID, &a.SubjectID, &a.Category, &a.Name, &a.Weight, &a.MaxMark, &a.Date, &a.CreatedBy, &a.CreatedAt)
+}
+
+// loadGradingScheme loads a subject's grading scheme
+//
+// Parameters:
+//   - q: Database or transaction
+//   - subjectID: Subject whose scheme is loaded
+//
+// Returns:
+//   - *GradingScheme: Scheme, with the default boundaries if the subject has none
+//   - error: sql.ErrNoRows if the subject does not exist, or a database error
+func loadGradingScheme(q queryer, subjectID int) (*GradingScheme, error) {
+	var id int
+	if err := q.QueryRow("SELECT id FROM subjects WHERE id = $1", subjectID).Scan(&id); err != nil {
+		return nil, err
+	}
+
+	scheme := &GradingScheme{SubjectID: subjectID, Categories: []AssessmentCategory{}}
+	rows, err := q.Query(
+		"SELECT name, weight FROM assessment_categories WHERE subject_id = $1 ORDER BY position, name",
+		subjectID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c AssessmentCategory
+		if err := rows.Scan(&c.Name, &c.Weight); err != nil {
+			return nil, err
+		}
+		scheme.Categories = append(scheme.Categories, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var boundaries pq.Float64Array
+	err = q.QueryRow("SELECT boundaries FROM grade_boundaries WHERE subject_id = $1", subjectID).Scan(&boundaries)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		scheme.Boundaries = append([]float64{}, DefaultGradeBoundaries...)
+		scheme.DefaultBoundaries = true
+	case err != nil:
+		return nil, err
+	default:
+		scheme.Boundaries = []float64(boundaries)
+	}
+	return scheme, nil
+}
+
+// queryAssessments loads the assessments of a subject, oldest first
+func queryAssessments(q queryer, subjectID int) ([]*Assessment, error) {
+	rows, err := q.Query(
+		"SELECT "+assessmentColumns+" FROM assessments a WHERE a.subject_id = $1 ORDER BY a.assessed_on, a.id",
+		subjectID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assessments := []*Assessment{}
+	for rows.Next() {
+		a := &Assessment{}
+		if err := scanAssessment(rows, a); err != nil {
+			return nil, err
+		}
+		assessments = append(assessments, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return assessments, nil
+}
+
+// GetGradingScheme retrieves a subject's grading scheme
+//
+// Parameters:
+//   - subjectID: Subject whose scheme is retrieved
+//
+// Returns:
+//   - *GradingScheme: Categories and boundaries
+//   - error: sql.ErrNoRows if the subject does not exist, or a database error
+func (db *DB) GetGradingScheme(subjectID int) (*GradingScheme, error) {
+	return loadGradingScheme(db.DB, subjectID)
+}
+
+// SetGradingScheme replaces a subject's assessment categories and grade boundaries
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - subjectID: Subject whose scheme is replaced
+//   - teacherID: User ID of the teacher, who must be assigned to the subject
+//   - req: Categories and optional boundaries
+//
+// Returns:
+//   - *GradingScheme: Updated scheme
+//   - error: sql.ErrNoRows if the subject does not exist, ErrNotTeaching,
+//     ErrInvalidGradebook, ErrCategoryInUse, or a database error
+func (db *DB) SetGradingScheme(subjectID, teacherID int, req *GradingSchemeRequest) (*GradingScheme, error) {
+	if err := ValidateGradingScheme(req); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Lock the subject so concurrent scheme changes and new assessments wait
+	var id int
+	if err = tx.QueryRow("SELECT id FROM subjects WHERE id = $1 FOR UPDATE", subjectID).Scan(&id); err != nil {
+		return nil, err
+	}
+	if err = requireTeaching(tx, teacherID, subjectID); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(req.Categories))
+	for i, c := range req.Categories {
+		names[i] = c.Name
+	}
+	var used pq.StringArray
+	err = tx.QueryRow(
+		"SELECT COALESCE(array_agg(DISTINCT category), '{}') FROM assessments WHERE subject_id = $1 AND category <> ALL($2)",
+		subjectID, pq.Array(names),
+	).Scan(&used)
+	if err != nil {
+		return nil, err
+	}
+	if len(used) > 0 {
+		err = fmt.Errorf("%w: %s", ErrCategoryInUse, strings.Join(used, ", "))
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM assessment_categories WHERE subject_id = $1 AND name <> ALL($2)", subjectID, pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range req.Categories {
+		_, err = tx.Exec(`
+			INSERT INTO assessment_categories (subject_id, name, weight, position) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (subject_id, name) DO UPDATE SET weight = EXCLUDED.weight, position = EXCLUDED.position`,
+			subjectID, c.Name, c.Weight, i,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Boundaries == nil {
+		_, err = tx.Exec("DELETE FROM grade_boundaries WHERE subject_id = $1", subjectID)
+	} else {
+		_, err = tx.Exec(`
+			INSERT INTO grade_boundaries (subject_id, boundaries) VALUES ($1, $2)
+			ON CONFLICT (subject_id) DO UPDATE SET boundaries = EXCLUDED.boundaries`,
+			subjectID, pq.Array(req.Boundaries),
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return db.GetGradingScheme(subjectID)
+}
+
+// CreateAssessment adds an assessment to a subject
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - subjectID: Subject of the assessment
+//   - teacherID: User ID of the teacher, who must be assigned to the subject
+//   - req: Name, category, weight, maximum mark and date
+//
+// Returns:
+//   - *Assessment: Created assessment
+//   - error: sql.ErrNoRows if the subject does not exist, ErrNotTeaching,
+//     ErrInvalidGradebook, or a database error
+func (db *DB) CreateAssessment(subjectID, teacherID int, req *AssessmentRequest) (*Assessment, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var id int
+	if err = tx.QueryRow("SELECT id FROM subjects WHERE id = $1 FOR SHARE", subjectID).Scan(&id); err != nil {
+		return nil, err
+	}
+	if err = requireTeaching(tx, teacherID, subjectID); err != nil {
+		return nil, err
+	}
+
+	scheme, err := loadGradingScheme(tx, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	date, err := ValidateAssessment(req, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	assessment := &Assessment{}
+	err = scanAssessment(tx.QueryRow(`
+		INSERT INTO assessments AS a (subject_id, category, name, weight, max_mark, assessed_on, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+assessmentColumns,
+		subjectID, req.Category, req.Name, req.Weight, req.MaxMark, date, teacherID,
+	), assessment)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return assessment, nil
+}
+
+// UpdateAssessment changes an assessment. The maximum mark cannot drop below a recorded mark.
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - id: Assessment to update
+//   - teacherID: User ID of the teacher, who must be assigned to the subject
+//   - req: New name, category, weight, maximum mark and date
+//
+// Returns:
+//   - *Assessment: Updated assessment with its marks
+//   - error: sql.ErrNoRows if the assessment does not exist, ErrNotTeaching,
+//     ErrInvalidGradebook, or a database error
+func (db *DB) UpdateAssessment(id, teacherID int, req *AssessmentRequest) (*Assessment, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var subjectID int
+	if err = tx.QueryRow("SELECT subject_id FROM assessments WHERE id = $1 FOR UPDATE", id).Scan(&subjectID); err != nil {
+		return nil, err
+	}
+	if err = requireTeaching(tx, teacherID, subjectID); err != nil {
+		return nil, err
+	}
+
+	scheme, err := loadGradingScheme(tx, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	date, err := ValidateAssessment(req, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	var highest float64
+	err = tx.QueryRow("SELECT COALESCE(MAX(mark), 0) FROM assessment_scores WHERE assessment_id = $1", id).Scan(&highest)
+	if err != nil {
+		return nil, err
+	}
+	if req.MaxMark < highest {
+		err = fmt.Errorf("%w: max_mark is below the recorded mark of %g", ErrInvalidGradebook, highest)
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE assessments SET category = $1, name = $2, weight = $3, max_mark = $4, assessed_on = $5 WHERE id = $6",
+		req.Category, req.Name, req.Weight, req.MaxMark, date, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return db.GetAssessment(id)
+}
+
+// DeleteAssessment deletes an assessment and its marks
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - id: Assessment to delete
+//   - teacherID: User ID of the teacher, who must be assigned to the subject
+//
+// Returns:
+//   - error: sql.ErrNoRows if the assessment does not exist, ErrNotTeaching, or a database error
+func (db *DB) DeleteAssessment(id, teacherID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var subjectID int
+	if err = tx.QueryRow("SELECT subject_id FROM assessments WHERE id = $1 FOR UPDATE", id).Scan(&subjectID); err != nil {
+		return err
+	}
+	if err = requireTeaching(tx, teacherID, subjectID); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("DELETE FROM assessments WHERE id = $1", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAssessment retrieves an assessment with its marks
+//
+// Parameters:
+//   - id: Assessment to retrieve
+//
+// Returns:
+//   - *Assessment: Assessment with marks ordered by student name
+//   - error: sql.ErrNoRows if the assessment does not exist, or a database error
+func (db *DB) GetAssessment(id int) (*Assessment, error) {
+	assessment := &Assessment{}
+	err := scanAssessment(db.QueryRow("SELECT "+assessmentColumns+" FROM assessments a WHERE a.id = $1", id), assessment)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT sc.student_id, st.first_name || ' ' || st.last_name, sc.mark,
+		       COALESCE(sc.recorded_by, 0), sc.recorded_at
+		FROM assessment_scores sc
+		JOIN students st ON st.id = sc.student_id
+		WHERE sc.assessment_id = $1
+		ORDER BY st.last_name, st.first_name, sc.student_id`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assessment.Scores = []*AssessmentScore{}
+	for rows.Next() {
+		s := &AssessmentScore{}
+		if err := rows.Scan(&s.StudentID, &s.StudentName, &s.Mark, &s.RecordedBy, &s.RecordedAt); err != nil {
+			return nil, err
+		}
+		assessment.Scores = append(assessment.Scores, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return assessment, nil
+}
+
+// GetSubjectAssessments retrieves the assessments of a subject without their marks
+//
+// Parameters:
+//   - subjectID: Subject whose assessments are retrieved
+//
+// Returns:
+//   - []*Assessment: Assessments ordered by date, oldest first
+//   - error: Error if retrieval fails
+func (db *DB) GetSubjectAssessments(subjectID int) ([]*Assessment, error) {
+	return queryAssessments(db.DB, subjectID)
+}
+
+// RecordScores adds or corrects marks of an assessment. Students not listed keep their marks.
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - assessmentID: Assessment to record marks for
+//   - teacherID: User ID of the teacher, who must be assigned to the subject
+//   - entries: Marks of enrolled students
+//
+// Returns:
+//   - *Assessment: Assessment with all of its marks
+//   - error: sql.ErrNoRows if the assessment does not exist, ErrNotTeaching,
+//     ErrInvalidGradebook, or a database error
+func (db *DB) RecordScores(assessmentID, teacherID int, entries []ScoreEntry) (*Assessment, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var subjectID int
+	var maxMark float64
+	err = tx.QueryRow("SELECT subject_id, max_mark FROM assessments WHERE id = $1 FOR UPDATE", assessmentID).Scan(&subjectID, &maxMark)
+	if err != nil {
+		return nil, err
+	}
+	if err = requireTeaching(tx, teacherID, subjectID); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, len(entries))
+	for i, e := range entries {
+		ids[i] = e.StudentID
+	}
+	enrolled, err := enrolledStudents(tx, subjectID, ids)
+	if err != nil {
+		return nil, err
+	}
+	if err = ValidateScores(entries, maxMark, enrolled); err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		_, err = tx.Exec(`
+			INSERT INTO assessment_scores (assessment_id, student_id, mark, recorded_by) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (assessment_id, student_id) DO UPDATE
+			SET mark = EXCLUDED.mark, recorded_by = EXCLUDED.recorded_by, recorded_at = NOW()`,
+			assessmentID, e.StudentID, e.Mark, teacherID,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return db.GetAssessment(assessmentID)
+}
+
+// subjectMarks loads the marks of a subject's assessments per student ID and
+// assessment ID, optionally for a single student
+func subjectMarks(q queryer, subjectID, studentID int) (map[int]map[int]float64, error) {
+	query := `
+		SELECT sc.student_id, sc.assessment_id, sc.mark
+		FROM assessment_scores sc
+		JOIN assessments a ON a.id = sc.assessment_id
+		WHERE a.subject_id = $1 AND ($2 = 0 OR sc.student_id = $2)`
+	rows, err := q.Query(query, subjectID, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	marks := map[int]map[int]float64{}
+	for rows.Next() {
+		var student, assessment int
+		var mark float64
+		if err := rows.Scan(&student, &assessment, &mark); err != nil {
+			return nil, err
+		}
+		if marks[student] == nil {
+			marks[student] = map[int]float64{}
+		}
+		marks[student][assessment] = mark
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return marks, nil
+}
+
+// predictedGradeColumns lists the columns scanned by scanPredictedGrade
+const predictedGradeColumns = `p.id, p.subject_id, p.student_id, p.grade, p.comment, COALESCE(p.teacher_id, 0), p.created_at`
+
+// scanPredictedGrade scans a row selected with predictedGradeColumns
+func scanPredictedGrade(row interface{ Scan(...interface{}) error }, p *PredictedGrade) error {
+	return row.Scan(&p.ID, &p.SubjectID, &p.StudentID, &p.Grade, &p.Comment, &p.TeacherID, &p.CreatedAt)
+}
+
+// GetSubjectGrades works out the current grade of every student enrolled in a subject
+//
+// Parameters:
+//   - subjectID: Subject to grade
+//
+// Returns:
+//   - []*StudentGrade: Grades with the latest predicted grade, ordered by student name
+//   - error: sql.ErrNoRows if the subject does not exist, or a database error
+func (db *DB) GetSubjectGrades(subjectID int) ([]*StudentGrade, error) {
+	scheme, err := loadGradingScheme(db.DB, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	assessments, err := queryAssessments(db.DB, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	marks, err := subjectMarks(db.DB, subjectID, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	predicted := map[int]*PredictedGrade{}
+	rows, err := db.Query(`
+		SELECT DISTINCT ON (p.student_id) `+predictedGradeColumns+`
+		FROM predicted_grades p
+		WHERE p.subject_id = $1
+		ORDER BY p.student_id, p.created_at DESC, p.id DESC`,
+		subjectID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		p := &PredictedGrade{}
+		if err := scanPredictedGrade(rows, p); err != nil {
+			return nil, err
+		}
+		predicted[p.StudentID] = p
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	students, err := db.Query(`
+		SELECT st.id, st.first_name || ' ' || st.last_name
+		FROM enrollments e
+		JOIN students st ON st.id = e.student_id
+		WHERE e.subject_id = $1
+		ORDER BY st.last_name, st.first_name, st.id`,
+		subjectID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer students.Close()
+
+	grades := []*StudentGrade{}
+	for students.Next() {
+		var id int
+		var name string
+		if err := students.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		grade := ComputeGrade(scheme, assessments, marks[id])
+		grade.StudentID = id
+		grade.StudentName = name
+		grade.Predicted = predicted[id]
+		grades = append(grades, &grade)
+	}
+
+	if err = students.Err(); err != nil {
+		return nil, err
+	}
+
+	return grades, nil
+}
+
+// GetStudentGradebook retrieves a student's marks, current grade and predicted grades in a subject
+//
+// Parameters:
+//   - subjectID: Subject of the gradebook
+//   - studentID: Student, who must be enrolled in the subject
+//
+// Returns:
+//   - *StudentGradebook: Marks for every assessment, current grade and prediction history
+//   - error: sql.ErrNoRows if the subject does not exist or the student is not enrolled, or a database error
+func (db *DB) GetStudentGradebook(subjectID, studentID int) (*StudentGradebook, error) {
+	var name string
+	err := db.QueryRow(`
+		SELECT st.first_name || ' ' || st.last_name
+		FROM enrollments e
+		JOIN students st ON st.id = e.student_id
+		WHERE e.subject_id = $1 AND e.student_id = $2`,
+		subjectID, studentID,
+	).Scan(&name)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme, err := loadGradingScheme(db.DB, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	assessments, err := queryAssessments(db.DB, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	marks, err := subjectMarks(db.DB, subjectID, studentID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT `+predictedGradeColumns+`
+		FROM predicted_grades p
+		WHERE p.subject_id = $1 AND p.student_id = $2
+		ORDER BY p.created_at DESC, p.id DESC`,
+		subjectID, studentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []*PredictedGrade{}
+	for rows.Next() {
+		p := &PredictedGrade{}
+		if err := scanPredictedGrade(rows, p); err != nil {
+			return nil, err
+		}
+		history = append(history, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return buildStudentGradebook(studentID, name, scheme, assessments, marks[studentID], history), nil
+}
+
+// buildStudentGradebook assembles a student's gradebook from loaded data
+func buildStudentGradebook(studentID int, name string, scheme *GradingScheme, assessments []*Assessment, marks map[int]float64, history []*PredictedGrade) *StudentGradebook {
+	book := &StudentGradebook{
+		StudentGrade:     ComputeGrade(scheme, assessments, marks),
+		Marks:            make([]*StudentMark, len(assessments)),
+		PredictedHistory: history,
+	}
+	book.StudentID = studentID
+	book.StudentName = name
+	if len(history) > 0 {
+		book.Predicted = history[0]
+	}
+
+	for i, a := range assessments {
+		book.Marks[i] = &StudentMark{
+			AssessmentID: a.ID,
+			Name:         a.Name,
+			Category:     a.Category,
+			Weight:       a.Weight,
+			MaxMark:      a.MaxMark,
+			Date:         a.Date,
+		}
+		if mark, ok := marks[a.ID]; ok {
+			book.Marks[i].Mark = &mark
+		}
+	}
+	return book
+}
+
+// AddPredictedGrade records a new predicted grade, keeping earlier ones as history
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - subjectID: Subject of the prediction
+//   - studentID: Student, who must be enrolled in the subject
+//   - teacherID: User ID of the teacher, who must be assigned to the subject
+//   - req: Grade and optional comment
+//
+// Returns:
+//   - *PredictedGrade: Created prediction
+//   - error: sql.ErrNoRows if the student is not enrolled, ErrNotTeaching,
+//     ErrInvalidGradebook, or a database error
+func (db *DB) AddPredictedGrade(subjectID, studentID, teacherID int, req *PredictedGradeRequest) (*PredictedGrade, error) {
+	if err := ValidatePredictedGrade(req); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = requireTeaching(tx, teacherID, subjectID); err != nil {
+		return nil, err
+	}
+	enrolled, err := enrolledStudents(tx, subjectID, []int{studentID})
+	if err != nil {
+		return nil, err
+	}
+	if !enrolled[studentID] {
+		err = sql.ErrNoRows
+		return nil, err
+	}
+
+	predicted := &PredictedGrade{}
+	err = scanPredictedGrade(tx.QueryRow(`
+		INSERT INTO predicted_grades AS p (subject_id, student_id, grade, comment, teacher_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+predictedGradeColumns,
+		subjectID, studentID, req.Grade, req.Comment, teacherID,
+	), predicted)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return predicted, nil
+}
@@ -0,0 +1,436 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxRelationshipLength is the longest relationship a guardian link may record
+const MaxRelationshipLength = 50
+
+// ErrInvalidGuardianLink is returned when a guardian link request is invalid
+var ErrInvalidGuardianLink = errors.New("invalid guardian link")
+
+// Guardian represents a parent or guardian with the students they are linked to.
+// Personal details live in guardian_profiles, keyed by the user ID.
+type Guardian struct {
+	ID        int             `json:"id"`         // User ID from the users table
+	Username  string          `json:"username"`   // Login username
+	FirstName string          `json:"first_name"` // Guardian's first name
+	LastName  string          `json:"last_name"`  // Guardian's last name
+	Email     string          `json:"email"`      // Guardian's email address
+	Phone     string          `json:"phone"`      // Guardian's phone number, may be empty
+	Active    bool            `json:"active"`     // Deactivated guardians cannot log in
+	Children  []GuardianChild `json:"children"`   // Students the guardian is linked to
+}
+
+// GuardianRequest is used for creating or updating a guardian.
+// Username is ignored and password is optional when updating.
+type GuardianRequest struct {
+	FirstName string `json:"first_name"`         // Guardian's first name
+	LastName  string `json:"last_name"`          // Guardian's last name
+	Email     string `json:"email"`              // Guardian's email address
+	Phone     string `json:"phone"`              // Guardian's phone number (optional)
+	Username  string `json:"username"`           // Login username
+	Password  string `json:"password,omitempty"` // Login password (optional for updates)
+}
+
+// GuardianChild is a student as seen through a guardian link
+type GuardianChild struct {
+	StudentID    int       `json:"student_id"`   // Reference to students table
+	FirstName    string    `json:"first_name"`   // Student's first name
+	LastName     string    `json:"last_name"`    // Student's last name
+	Grade        string    `json:"grade"`        // Student's grade/class
+	Relationship string    `json:"relationship"` // E.g. mother, father or guardian; may be empty
+	LinkedAt     time.Time `json:"linked_at"`    // When the link was created
+}
+
+// GuardianLinkRequest is used for linking a guardian to a student
+type GuardianLinkRequest struct {
+	StudentID    int    `json:"student_id"`   // Student to link
+	Relationship string `json:"relationship"` // Optional relationship to the student
+}
+
+// ValidateGuardianLink trims and checks a guardian link request
+//
+// Parameters:
+//   - req: Link request, whose relationship is trimmed in place
+//
+// Returns:
+//   - error: ErrInvalidGuardianLink describing the problem, or nil
+func ValidateGuardianLink(req *GuardianLinkRequest) error {
+	req.Relationship = strings.TrimSpace(req.Relationship)
+	if req.StudentID <= 0 {
+		return fmt.Errorf("%w: student_id is required", ErrInvalidGuardianLink)
+	}
+	if len(req.Relationship) > MaxRelationshipLength {
+		return fmt.Errorf("%w: relationship must be at most %d characters", ErrInvalidGuardianLink, MaxRelationshipLength)
+	}
+	return nil
+}
+
+// guardianQuery selects guardians for scanGuardian. Users given the guardian
+// role through role management may not have a profile yet.
+const guardianQuery = `
+		SELECT u.id, u.username, COALESCE(p.first_name, ''), COALESCE(p.last_name, ''),
+		       COALESCE(p.email, ''), COALESCE(p.phone, ''), u.is_active
+		FROM users u
+		LEFT JOIN guardian_profiles p ON p.user_id = u.id
+		WHERE u.role = 'guardian'`
+
+// scanGuardian scans a row selected with guardianQuery
+func scanGuardian(row interface{ Scan(...interface{}) error }) (*Guardian, error) {
+	guardian := &Guardian{}
+	err := row.Scan(
+		&guardian.ID,
+		&guardian.Username,
+		&guardian.FirstName,
+		&guardian.LastName,
+		&guardian.Email,
+		&guardian.Phone,
+		&guardian.Active,
+	)
+	return guardian, err
+}
+
+// GetAllGuardians retrieves all guardians with the students they are linked to
+//
+// Returns:
+//   - []*Guardian: Guardians ordered by username
+//   - error: Error if retrieval fails
+func (db *DB) GetAllGuardians() ([]*Guardian, error) {
+	rows, err := db.Query(guardianQuery + " ORDER BY u.username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	guardians := []*Guardian{}
+	for rows.Next() {
+		guardian, err := scanGuardian(rows)
+		if err != nil {
+			return nil, err
+		}
+		guardians = append(guardians, guardian)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Load children once the rows are closed
+	for _, guardian := range guardians {
+		if guardian.Children, err = db.GetGuardianChildren(guardian.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return guardians, nil
+}
+
+// GetGuardianByID retrieves a guardian by ID with the students they are linked to
+//
+// Parameters:
+//   - id: Guardian (user) ID to retrieve
+//
+// Returns:
+//   - *Guardian: Guardian with their children if found
+//   - error: sql.ErrNoRows if the guardian does not exist, or a database error
+func (db *DB) GetGuardianByID(id int) (*Guardian, error) {
+	guardian, err := scanGuardian(db.QueryRow(guardianQuery+" AND u.id = $1", id))
+	if err != nil {
+		return nil, err
+	}
+
+	if guardian.Children, err = db.GetGuardianChildren(id); err != nil {
+		return nil, err
+	}
+
+	return guardian, nil
+}
+
+// CreateGuardian creates a new guardian and corresponding user.
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - req: Guardian creation request with personal and login information
+//
+// Returns:
+//   - *Guardian: Created guardian without children
+//   - error: Error if creation fails, e.g. a duplicate username or email
+func (db *DB) CreateGuardian(req *GuardianRequest) (*Guardian, error) {
+	hash, err := db.hashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	guardian := &Guardian{Children: []GuardianChild{}}
+	err = tx.QueryRow(`
+		INSERT INTO users (username, password, role, date_created)
+		VALUES ($1, $2, 'guardian', $3)
+		RETURNING id, username, is_active`,
+		req.Username, hash, time.Now().UTC(),
+	).Scan(&guardian.ID, &guardian.Username, &guardian.Active)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO guardian_profiles (user_id, first_name, last_name, email, phone)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING first_name, last_name, email, phone`,
+		guardian.ID, req.FirstName, req.LastName, req.Email, req.Phone,
+	).Scan(&guardian.FirstName, &guardian.LastName, &guardian.Email, &guardian.Phone)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return guardian, nil
+}
+
+// UpdateGuardian updates an existing guardian's profile and optionally their password.
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - id: Guardian (user) ID to update
+//   - req: Guardian update request with the new information
+//
+// Returns:
+//   - *Guardian: Updated guardian with their children
+//   - error: sql.ErrNoRows if the guardian does not exist, or a database error
+func (db *DB) UpdateGuardian(id int, req *GuardianRequest) (*Guardian, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Lock the user row and make sure it is a guardian
+	guardian := &Guardian{}
+	err = tx.QueryRow(
+		"SELECT id, username, is_active FROM users WHERE id = $1 AND role = 'guardian' FOR UPDATE",
+		id,
+	).Scan(&guardian.ID, &guardian.Username, &guardian.Active)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Password != "" {
+		var hash string
+		hash, err = db.hashPassword(req.Password)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec("UPDATE users SET password = $1 WHERE id = $2", hash, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Update the profile, creating it for guardians that do not have one yet
+	err = tx.QueryRow(`
+		INSERT INTO guardian_profiles (user_id, first_name, last_name, email, phone, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		ON CONFLICT (user_id) DO UPDATE
+		SET first_name = EXCLUDED.first_name, last_name = EXCLUDED.last_name,
+		    email = EXCLUDED.email, phone = EXCLUDED.phone, updated_at = EXCLUDED.updated_at
+		RETURNING first_name, last_name, email, phone`,
+		id, req.FirstName, req.LastName, req.Email, req.Phone, time.Now().UTC(),
+	).Scan(&guardian.FirstName, &guardian.LastName, &guardian.Email, &guardian.Phone)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if guardian.Children, err = db.GetGuardianChildren(id); err != nil {
+		return nil, err
+	}
+
+	return guardian, nil
+}
+
+// DeleteGuardian deletes a guardian and their user account. The profile,
+// student links and tokens are removed by cascading foreign keys.
+//
+// Parameters:
+//   - id: Guardian (user) ID to delete
+//
+// Returns:
+//   - error: sql.ErrNoRows if the guardian does not exist, or a database error
+func (db *DB) DeleteGuardian(id int) error {
+	res, err := db.Exec("DELETE FROM users WHERE id = $1 AND role = 'guardian'", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// LinkGuardianStudent links a guardian to a student
+//
+// Parameters:
+//   - guardianID: Guardian (user) ID
+//   - req: Validated link request with the student and relationship
+//
+// Returns:
+//   - *GuardianChild: Linked student
+//   - error: sql.ErrNoRows if the guardian or student does not exist,
+//     ErrDuplicate if already linked, or a database error
+func (db *DB) LinkGuardianStudent(guardianID int, req *GuardianLinkRequest) (*GuardianChild, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Share-lock both rows so neither can be deleted while we link them
+	var exists bool
+	err = tx.QueryRow(
+		"SELECT TRUE FROM users WHERE id = $1 AND role = 'guardian' FOR SHARE",
+		guardianID,
+	).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	child := &GuardianChild{StudentID: req.StudentID, Relationship: req.Relationship}
+	err = tx.QueryRow(
+		"SELECT first_name, last_name, grade FROM students WHERE id = $1 FOR SHARE",
+		req.StudentID,
+	).Scan(&child.FirstName, &child.LastName, &child.Grade)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO guardian_students (guardian_id, student_id, relationship)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (guardian_id, student_id) DO NOTHING
+		RETURNING created_at`,
+		guardianID, req.StudentID, req.Relationship,
+	).Scan(&child.LinkedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrDuplicate
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return child, nil
+}
+
+// UnlinkGuardianStudent removes the link between a guardian and a student
+//
+// Parameters:
+//   - guardianID: Guardian (user) ID
+//   - studentID: Student to unlink
+//
+// Returns:
+//   - error: sql.ErrNoRows if they are not linked, or a database error
+func (db *DB) UnlinkGuardianStudent(guardianID, studentID int) error {
+	res, err := db.Exec(
+		"DELETE FROM guardian_students WHERE guardian_id = $1 AND student_id = $2",
+		guardianID, studentID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetGuardianChildren retrieves the students a guardian is linked to
+//
+// Parameters:
+//   - guardianID: Guardian (user) ID
+//
+// Returns:
+//   - []GuardianChild: Linked students ordered by last and first name
+//   - error: Error if retrieval fails
+func (db *DB) GetGuardianChildren(guardianID int) ([]GuardianChild, error) {
+	rows, err := db.Query(`
+		SELECT s.id, s.first_name, s.last_name, s.grade, g.relationship, g.created_at
+		FROM guardian_students g
+		JOIN students s ON s.id = g.student_id
+		WHERE g.guardian_id = $1
+		ORDER BY s.last_name, s.first_name, s.id`,
+		guardianID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	children := []GuardianChild{}
+	for rows.Next() {
+		var child GuardianChild
+		err := rows.Scan(
+			&child.StudentID,
+			&child.FirstName,
+			&child.LastName,
+			&child.Grade,
+			&child.Relationship,
+			&child.LinkedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	return children, rows.Err()
+}
+
+// IsGuardianOf reports whether a user is a guardian linked to a student
+//
+// Parameters:
+//   - guardianID: User ID of the guardian
+//   - studentID: Student ID
+//
+// Returns:
+//   - bool: True if they are linked
+//   - error: A database error
+func (db *DB) IsGuardianOf(guardianID, studentID int) (bool, error) {
+	var linked bool
+	err := db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM guardian_students WHERE guardian_id = $1 AND student_id = $2)",
+		guardianID, studentID,
+	).Scan(&linked)
+	return linked, err
+}
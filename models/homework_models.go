@@ -0,0 +1,855 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Late policies of homework
+const (
+	LatePolicyAccept = "accept" // Late submissions are accepted and flagged
+	LatePolicyReject = "reject" // Submissions close at the due time
+)
+
+// Statuses of a student's homework
+const (
+	HomeworkPending   = "pending"   // Not submitted and not yet due
+	HomeworkSubmitted = "submitted" // Latest attempt was on time
+	HomeworkLate      = "late"      // Latest attempt was after the due time
+	HomeworkMissing   = "missing"   // Not submitted and past due
+)
+
+// Limits on homework text
+const (
+	maxHomeworkInstructions = 10000
+	maxHomeworkComment      = 2000
+	maxHomeworkFeedback     = 5000
+)
+
+// Errors returned by homework operations
+var (
+	// ErrInvalidHomework is returned for an invalid assignment, submission or
+	// feedback. The wrapped message describes the problem.
+	ErrInvalidHomework = errors.New("invalid homework")
+	// ErrHomeworkClosed is returned for a submission after the due time of
+	// homework that rejects late work
+	ErrHomeworkClosed = errors.New("homework is past due and does not accept late submissions")
+	// ErrNotEnrolled is returned when a student submits homework of a subject
+	// they are not enrolled in
+	ErrNotEnrolled = errors.New("student is not enrolled in the subject")
+)
+
+// Homework is an assignment set for the students of a subject
+type Homework struct {
+	ID           int             `json:"id"`                    // Unique identifier
+	SubjectID    int             `json:"subject_id"`            // Reference to subjects table
+	SubjectName  string          `json:"subject_name"`          // Subject name (added for convenience)
+	Grade        string          `json:"grade"`                 // Subject's grade (added for convenience)
+	Title        string          `json:"title"`                 // e.g. "Kinematics problem set"
+	Instructions string          `json:"instructions"`          // What students have to do, may be empty
+	DueAt        time.Time       `json:"due_at"`                // Submissions after this time are late
+	LatePolicy   string          `json:"late_policy"`           // accept or reject
+	CreatedBy    int             `json:"created_by,omitempty"`  // Teacher who set it, 0 if deleted
+	Attachments  []*HomeworkFile `json:"attachments,omitempty"` // Files set with the homework, only loaded by GetHomework
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+// HomeworkFile is a file attached to homework by its teacher
+type HomeworkFile struct {
+	ID          int       `json:"id"`           // Unique identifier
+	HomeworkID  int       `json:"homework_id"`  // Reference to homework_assignments table
+	Filename    string    `json:"filename"`     // Name of the uploaded file
+	ContentType string    `json:"content_type"` // MIME type of the file
+	Size        int64     `json:"size"`         // Size in bytes
+	StorageKey  string    `json:"-"`            // Key of the content on the storage backend
+	UploadedAt  time.Time `json:"uploaded_at"`
+}
+
+// HomeworkSubmission is one attempt of a student at homework
+type HomeworkSubmission struct {
+	ID          int        `json:"id"`                    // Unique identifier
+	HomeworkID  int        `json:"homework_id"`           // Reference to homework_assignments table
+	StudentID   int        `json:"student_id"`            // Reference to students table
+	StudentName string     `json:"student_name"`          // First and last name (added for convenience)
+	Attempt     int        `json:"attempt"`               // 1 for the first submission, counting up with each resubmission
+	Comment     string     `json:"comment"`               // Student's note to the teacher, may be empty
+	Filename    string     `json:"filename"`              // Name of the submitted file
+	ContentType string     `json:"content_type"`          // MIME type of the file
+	Size        int64      `json:"size"`                  // Size in bytes
+	StorageKey  string     `json:"-"`                     // Key of the content on the storage backend
+	SubmittedAt time.Time  `json:"submitted_at"`          // Time of the submission
+	Late        bool       `json:"late"`                  // Submitted after the due time
+	Feedback    string     `json:"feedback"`              // Teacher's feedback, empty until given
+	FeedbackBy  int        `json:"feedback_by,omitempty"` // Teacher who gave it, 0 if none or deleted
+	FeedbackAt  *time.Time `json:"feedback_at,omitempty"` // Time the feedback was last changed
+}
+
+// HomeworkRequest is used for setting or changing homework
+type HomeworkRequest struct {
+	Title        string `json:"title"`        // Required
+	Instructions string `json:"instructions"` // Optional
+	DueAt        string `json:"due_at"`       // RFC 3339, e.g. 2025-03-14T23:59:00+01:00
+	LatePolicy   string `json:"late_policy"`  // accept (default) or reject
+}
+
+// HomeworkFeedbackRequest is used for giving feedback on a submission
+type HomeworkFeedbackRequest struct {
+	Feedback string `json:"feedback"` // Required
+}
+
+// StudentHomework is homework of one of a student's subjects with the
+// student's attempts at it
+type StudentHomework struct {
+	*Homework
+	Status      string                `json:"status"`      // pending, submitted, late or missing
+	Submissions []*HomeworkSubmission `json:"submissions"` // Attempts, latest first
+}
+
+// ValidateHomework checks and normalizes a homework request in place. The
+// late policy is lower-cased and defaults to accept.
+//
+// Parameters:
+//   - req: Homework to check
+//
+// Returns:
+//   - time.Time: Due time
+//   - error: ErrInvalidHomework wrapped with the first problem, or nil
+func ValidateHomework(req *HomeworkRequest) (time.Time, error) {
+	req.Title = strings.TrimSpace(req.Title)
+	req.Instructions = strings.TrimSpace(req.Instructions)
+	req.LatePolicy = strings.ToLower(strings.TrimSpace(req.LatePolicy))
+	if req.Title == "" || len(req.Title) > 200 {
+		return time.Time{}, fmt.Errorf("%w: title must be 1 to 200 characters", ErrInvalidHomework)
+	}
+	if len(req.Instructions) > maxHomeworkInstructions {
+		return time.Time{}, fmt.Errorf("%w: instructions must be at most %d characters", ErrInvalidHomework, maxHomeworkInstructions)
+	}
+	due, err := time.Parse(time.RFC3339, strings.TrimSpace(req.DueAt))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: due_at must be an RFC 3339 time, e.g. 2025-03-14T23:59:00Z", ErrInvalidHomework)
+	}
+	switch req.LatePolicy {
+	case "":
+		req.LatePolicy = LatePolicyAccept
+	case LatePolicyAccept, LatePolicyReject:
+	default:
+		return time.Time{}, fmt.Errorf("%w: late_policy must be accept or reject", ErrInvalidHomework)
+	}
+	return due, nil
+}
+
+// ValidateHomeworkComment checks and normalizes a submission comment
+//
+// Returns:
+//   - string: Trimmed comment
+//   - error: ErrInvalidHomework wrapped with the problem, or nil
+func ValidateHomeworkComment(comment string) (string, error) {
+	comment = strings.TrimSpace(comment)
+	if len(comment) > maxHomeworkComment {
+		return "", fmt.Errorf("%w: comment must be at most %d characters", ErrInvalidHomework, maxHomeworkComment)
+	}
+	return comment, nil
+}
+
+// ValidateHomeworkFeedback checks and normalizes a feedback request in place
+//
+// Returns:
+//   - error: ErrInvalidHomework wrapped with the problem, or nil
+func ValidateHomeworkFeedback(req *HomeworkFeedbackRequest) error {
+	req.Feedback = strings.TrimSpace(req.Feedback)
+	if req.Feedback == "" || len(req.Feedback) > maxHomeworkFeedback {
+		return fmt.Errorf("%w: feedback must be 1 to %d characters", ErrInvalidHomework, maxHomeworkFeedback)
+	}
+	return nil
+}
+
+// CheckHomeworkSubmission decides whether a student may submit homework now
+//
+// Parameters:
+//   - h: Homework submitted
+//   - enrolled: Whether the student is enrolled in the homework's subject
+//   - now: Time of the submission
+//
+// Returns:
+//   - bool: Whether the submission is late
+//   - error: ErrNotEnrolled, ErrHomeworkClosed, or nil
+func CheckHomeworkSubmission(h *Homework, enrolled bool, now time.Time) (bool, error) {
+	if !enrolled {
+		return false, ErrNotEnrolled
+	}
+	late := now.After(h.DueAt)
+	if late && h.LatePolicy == LatePolicyReject {
+		return false, ErrHomeworkClosed
+	}
+	return late, nil
+}
+
+// BuildStudentHomework pairs homework with a student's attempts at it and
+// sets the status of each
+//
+// Parameters:
+//   - assignments: Homework of the student's subjects
+//   - submissions: The student's submissions, latest first
+//   - now: Time the statuses are evaluated at
+//
+// Returns:
+//   - []*StudentHomework: Homework in the order of assignments
+func BuildStudentHomework(assignments []*Homework, submissions []*HomeworkSubmission, now time.Time) []*StudentHomework {
+	attempts := map[int][]*HomeworkSubmission{}
+	for _, s := range submissions {
+		attempts[s.HomeworkID] = append(attempts[s.HomeworkID], s)
+	}
+
+	result := make([]*StudentHomework, len(assignments))
+	for i, h := range assignments {
+		sh := &StudentHomework{Homework: h, Submissions: attempts[h.ID]}
+		switch {
+		case len(sh.Submissions) > 0 && sh.Submissions[0].Late:
+			sh.Status = HomeworkLate
+		case len(sh.Submissions) > 0:
+			sh.Status = HomeworkSubmitted
+		case now.After(h.DueAt):
+			sh.Status = HomeworkMissing
+		default:
+			sh.Status = HomeworkPending
+		}
+		if sh.Submissions == nil {
+			sh.Submissions = []*HomeworkSubmission{}
+		}
+		result[i] = sh
+	}
+	return result
+}
+
+// homeworkSelect selects the columns scanned by scanHomework
+const homeworkSelect = `
+	SELECT h.id, h.subject_id, sub.name, sub.grade, h.title, h.instructions, h.due_at, h.late_policy,
+		COALESCE(h.created_by, 0), h.created_at, h.updated_at
+	FROM homework_assignments h
+	JOIN subjects sub ON sub.id = h.subject_id`
+
+// scanHomework scans a row selected with homeworkSelect
+func scanHomework(row interface{ Scan(...interface{}) error }) (*Homework, error) {
+	h := &Homework{}
+	err := row.Scan(
+		&h.ID, &h.SubjectID, &h.SubjectName, &h.Grade, &h.Title, &h.Instructions, &h.DueAt, &h.LatePolicy,
+		&h.CreatedBy, &h.CreatedAt, &h.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// queryHomework selects the homework matching a condition, earliest due first
+func (db *DB) queryHomework(where string, args ...interface{}) ([]*Homework, error) {
+	rows, err := db.Query(homeworkSelect+" WHERE "+where+" ORDER BY h.due_at, h.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []*Homework{}
+	for rows.Next() {
+		h, err := scanHomework(rows)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, h)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return assignments, nil
+}
+
+// GetHomework retrieves homework with its attachments
+//
+// Parameters:
+//   - id: Homework to retrieve
+//
+// Returns:
+//   - *Homework: Homework including Attachments, oldest first
+//   - error: sql.ErrNoRows if the homework does not exist, or a database error
+func (db *DB) GetHomework(id int) (*Homework, error) {
+	h, err := scanHomework(db.QueryRow(homeworkSelect+" WHERE h.id = $1", id))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT id, homework_id, filename, content_type, size, storage_key, uploaded_at
+		FROM homework_attachments
+		WHERE homework_id = $1
+		ORDER BY uploaded_at, id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	h.Attachments = []*HomeworkFile{}
+	for rows.Next() {
+		f := &HomeworkFile{}
+		if err := rows.Scan(&f.ID, &f.HomeworkID, &f.Filename, &f.ContentType, &f.Size, &f.StorageKey, &f.UploadedAt); err != nil {
+			return nil, err
+		}
+		h.Attachments = append(h.Attachments, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// GetSubjectHomework retrieves the homework of a subject
+//
+// Parameters:
+//   - subjectID: Subject whose homework is retrieved
+//
+// Returns:
+//   - []*Homework: Homework without attachments, earliest due first
+//   - error: Error if retrieval fails
+func (db *DB) GetSubjectHomework(subjectID int) ([]*Homework, error) {
+	return db.queryHomework("h.subject_id = $1", subjectID)
+}
+
+// GetStudentHomework retrieves the homework of every subject a student is enrolled in
+//
+// Parameters:
+//   - studentID: Student whose homework is retrieved
+//
+// Returns:
+//   - []*Homework: Homework without attachments, earliest due first
+//   - error: Error if retrieval fails
+func (db *DB) GetStudentHomework(studentID int) ([]*Homework, error) {
+	return db.queryHomework("h.subject_id IN (SELECT subject_id FROM enrollments WHERE student_id = $1)", studentID)
+}
+
+// CreateHomework sets homework for a subject
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - subjectID: Subject of the homework
+//   - teacherID: User ID of the teacher, who must be assigned to the subject
+//   - req: Title, instructions, due time and late policy
+//
+// Returns:
+//   - *Homework: Created homework
+//   - error: sql.ErrNoRows if the subject does not exist, ErrSubjectArchived,
+//     ErrNotTeaching, ErrInvalidHomework, or a database error
+func (db *DB) CreateHomework(subjectID, teacherID int, req *HomeworkRequest) (*Homework, error) {
+	due, err := ValidateHomework(req)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var archived bool
+	if err = tx.QueryRow("SELECT archived FROM subjects WHERE id = $1 FOR SHARE", subjectID).Scan(&archived); err != nil {
+		return nil, err
+	}
+	if archived {
+		err = ErrSubjectArchived
+		return nil, err
+	}
+	if err = requireTeaching(tx, teacherID, subjectID); err != nil {
+		return nil, err
+	}
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO homework_assignments (subject_id, title, instructions, due_at, late_policy, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		subjectID, req.Title, req.Instructions, due, req.LatePolicy, teacherID,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return db.GetHomework(id)
+}
+
+// lockHomework locks homework for the rest of a transaction and checks that
+// the teacher is assigned to its subject
+//
+// Returns:
+//   - int: Subject of the homework
+//   - error: sql.ErrNoRows if the homework does not exist, ErrNotTeaching, or a database error
+func lockHomework(tx *sql.Tx, id, teacherID int) (int, error) {
+	var subjectID int
+	if err := tx.QueryRow("SELECT subject_id FROM homework_assignments WHERE id = $1 FOR UPDATE", id).Scan(&subjectID); err != nil {
+		return 0, err
+	}
+	if err := requireTeaching(tx, teacherID, subjectID); err != nil {
+		return 0, err
+	}
+	return subjectID, nil
+}
+
+// UpdateHomework changes homework. The late flags of earlier submissions are
+// recomputed against the new due time.
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - id: Homework to update
+//   - teacherID: User ID of the teacher, who must be assigned to the subject
+//   - req: New title, instructions, due time and late policy
+//
+// Returns:
+//   - *Homework: Updated homework with its attachments
+//   - error: sql.ErrNoRows if the homework does not exist, ErrNotTeaching,
+//     ErrInvalidHomework, or a database error
+func (db *DB) UpdateHomework(id, teacherID int, req *HomeworkRequest) (*Homework, error) {
+	due, err := ValidateHomework(req)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = lockHomework(tx, id, teacherID); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE homework_assignments
+		SET title = $1, instructions = $2, due_at = $3, late_policy = $4, updated_at = NOW()
+		WHERE id = $5`,
+		req.Title, req.Instructions, due, req.LatePolicy, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec("UPDATE homework_submissions SET late = submitted_at > $1 WHERE homework_id = $2", due, id); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return db.GetHomework(id)
+}
+
+// DeleteHomework deletes homework with its attachments and submissions
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - id: Homework to delete
+//   - teacherID: User ID of the teacher, who must be assigned to the subject
+//
+// Returns:
+//   - []string: Storage keys of the deleted attachments and submissions, for removing their content
+//   - error: sql.ErrNoRows if the homework does not exist, ErrNotTeaching, or a database error
+func (db *DB) DeleteHomework(id, teacherID int) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = lockHomework(tx, id, teacherID); err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	rows, err := tx.Query(`
+		SELECT storage_key FROM homework_attachments WHERE homework_id = $1
+		UNION ALL
+		SELECT storage_key FROM homework_submissions WHERE homework_id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.Exec("DELETE FROM homework_assignments WHERE id = $1", id); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// AddHomeworkAttachment records a file attached to homework whose content is
+// already on the storage backend
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - homeworkID: Homework the file belongs to
+//   - teacherID: User ID of the teacher, who must be assigned to the subject
+//   - file: File name, content type, size and storage key
+//
+// Returns:
+//   - *HomeworkFile: Recorded attachment
+//   - error: sql.ErrNoRows if the homework does not exist, ErrNotTeaching, or a database error
+func (db *DB) AddHomeworkAttachment(homeworkID, teacherID int, file *HomeworkFile) (*HomeworkFile, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = lockHomework(tx, homeworkID, teacherID); err != nil {
+		return nil, err
+	}
+
+	stored := &HomeworkFile{
+		HomeworkID:  homeworkID,
+		Filename:    file.Filename,
+		ContentType: file.ContentType,
+		Size:        file.Size,
+		StorageKey:  file.StorageKey,
+	}
+	err = tx.QueryRow(`
+		INSERT INTO homework_attachments (homework_id, filename, content_type, size, storage_key)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, uploaded_at`,
+		homeworkID, stored.Filename, stored.ContentType, stored.Size, stored.StorageKey,
+	).Scan(&stored.ID, &stored.UploadedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return stored, nil
+}
+
+// GetHomeworkAttachment retrieves a file attached to homework
+//
+// Parameters:
+//   - homeworkID: Homework the file belongs to
+//   - fileID: Attachment to retrieve
+//
+// Returns:
+//   - *HomeworkFile: Attachment with its storage key
+//   - error: sql.ErrNoRows if the homework has no such attachment, or a database error
+func (db *DB) GetHomeworkAttachment(homeworkID, fileID int) (*HomeworkFile, error) {
+	f := &HomeworkFile{}
+	err := db.QueryRow(`
+		SELECT id, homework_id, filename, content_type, size, storage_key, uploaded_at
+		FROM homework_attachments
+		WHERE id = $1 AND homework_id = $2`, fileID, homeworkID,
+	).Scan(&f.ID, &f.HomeworkID, &f.Filename, &f.ContentType, &f.Size, &f.StorageKey, &f.UploadedAt)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// DeleteHomeworkAttachment removes a file attached to homework
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - homeworkID: Homework the file belongs to
+//   - fileID: Attachment to delete
+//   - teacherID: User ID of the teacher, who must be assigned to the subject
+//
+// Returns:
+//   - string: Storage key of the deleted attachment, for removing its content
+//   - error: sql.ErrNoRows if the homework has no such attachment, ErrNotTeaching, or a database error
+func (db *DB) DeleteHomeworkAttachment(homeworkID, fileID, teacherID int) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = lockHomework(tx, homeworkID, teacherID); err != nil {
+		return "", err
+	}
+
+	var key string
+	err = tx.QueryRow(
+		"DELETE FROM homework_attachments WHERE id = $1 AND homework_id = $2 RETURNING storage_key",
+		fileID, homeworkID,
+	).Scan(&key)
+	if err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+// submissionSelect selects the columns scanned by scanSubmission
+const submissionSelect = `
+	SELECT hs.id, hs.homework_id, hs.student_id, s.first_name || ' ' || s.last_name, hs.attempt, hs.comment,
+		hs.filename, hs.content_type, hs.size, hs.storage_key, hs.submitted_at, hs.late,
+		hs.feedback, COALESCE(hs.feedback_by, 0), hs.feedback_at
+	FROM homework_submissions hs
+	JOIN students s ON s.id = hs.student_id`
+
+// scanSubmission scans a row selected with submissionSelect
+func scanSubmission(row interface{ Scan(...interface{}) error }) (*HomeworkSubmission, error) {
+	s := &HomeworkSubmission{}
+	var feedbackAt sql.NullTime
+	err := row.Scan(
+		&s.ID, &s.HomeworkID, &s.StudentID, &s.StudentName, &s.Attempt, &s.Comment,
+		&s.Filename, &s.ContentType, &s.Size, &s.StorageKey, &s.SubmittedAt, &s.Late,
+		&s.Feedback, &s.FeedbackBy, &feedbackAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if feedbackAt.Valid {
+		s.FeedbackAt = &feedbackAt.Time
+	}
+	return s, nil
+}
+
+// querySubmissions selects the submissions matching a condition
+func (db *DB) querySubmissions(where, orderBy string, args ...interface{}) ([]*HomeworkSubmission, error) {
+	rows, err := db.Query(submissionSelect+" WHERE "+where+" ORDER BY "+orderBy, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	submissions := []*HomeworkSubmission{}
+	for rows.Next() {
+		s, err := scanSubmission(rows)
+		if err != nil {
+			return nil, err
+		}
+		submissions = append(submissions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return submissions, nil
+}
+
+// SubmitHomework records a student's submission whose file is already on the
+// storage backend. Each submission is kept as a new attempt; it is flagged
+// late when made after the due time.
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - homeworkID: Homework submitted
+//   - studentID: Submitting student
+//   - submission: Comment, file name, content type, size and storage key
+//
+// Returns:
+//   - *HomeworkSubmission: Recorded submission with its attempt number and late flag
+//   - error: sql.ErrNoRows if the homework does not exist, ErrNotEnrolled,
+//     ErrHomeworkClosed, ErrInvalidHomework, or a database error
+func (db *DB) SubmitHomework(homeworkID, studentID int, submission *HomeworkSubmission) (*HomeworkSubmission, error) {
+	comment, err := ValidateHomeworkComment(submission.Comment)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Lock the homework so concurrent attempts are numbered one at a time
+	h := &Homework{ID: homeworkID}
+	err = tx.QueryRow(
+		"SELECT subject_id, due_at, late_policy FROM homework_assignments WHERE id = $1 FOR UPDATE", homeworkID,
+	).Scan(&h.SubjectID, &h.DueAt, &h.LatePolicy)
+	if err != nil {
+		return nil, err
+	}
+	var enrolled bool
+	err = tx.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM enrollments WHERE student_id = $1 AND subject_id = $2)", studentID, h.SubjectID,
+	).Scan(&enrolled)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	late, err := CheckHomeworkSubmission(h, enrolled, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO homework_submissions
+			(homework_id, student_id, attempt, comment, filename, content_type, size, storage_key, submitted_at, late)
+		SELECT $1, $2, COALESCE(MAX(attempt), 0) + 1, $3, $4, $5, $6, $7, $8, $9
+		FROM homework_submissions WHERE homework_id = $1 AND student_id = $2
+		RETURNING id`,
+		homeworkID, studentID, comment, submission.Filename, submission.ContentType, submission.Size,
+		submission.StorageKey, now, late,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return db.GetHomeworkSubmission(id)
+}
+
+// GetHomeworkSubmissions retrieves the submissions of homework
+//
+// Parameters:
+//   - homeworkID: Homework whose submissions are retrieved
+//   - studentID: Only this student's submissions, or 0 for every student's
+//
+// Returns:
+//   - []*HomeworkSubmission: Submissions ordered by student name, latest attempt first
+//   - error: Error if retrieval fails
+func (db *DB) GetHomeworkSubmissions(homeworkID, studentID int) ([]*HomeworkSubmission, error) {
+	return db.querySubmissions(
+		"hs.homework_id = $1 AND ($2 = 0 OR hs.student_id = $2)",
+		"s.last_name, s.first_name, hs.student_id, hs.attempt DESC",
+		homeworkID, studentID,
+	)
+}
+
+// GetStudentSubmissions retrieves every homework submission of a student
+//
+// Parameters:
+//   - studentID: Student whose submissions are retrieved
+//
+// Returns:
+//   - []*HomeworkSubmission: Submissions, latest first
+//   - error: Error if retrieval fails
+func (db *DB) GetStudentSubmissions(studentID int) ([]*HomeworkSubmission, error) {
+	return db.querySubmissions("hs.student_id = $1", "hs.submitted_at DESC, hs.id DESC", studentID)
+}
+
+// GetHomeworkSubmission retrieves a homework submission
+//
+// Parameters:
+//   - id: Submission to retrieve
+//
+// Returns:
+//   - *HomeworkSubmission: Submission with its storage key
+//   - error: sql.ErrNoRows if the submission does not exist, or a database error
+func (db *DB) GetHomeworkSubmission(id int) (*HomeworkSubmission, error) {
+	return scanSubmission(db.QueryRow(submissionSelect+" WHERE hs.id = $1", id))
+}
+
+// SetHomeworkFeedback gives or replaces a teacher's feedback on a submission
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - submissionID: Submission the feedback is for
+//   - teacherID: User ID of the teacher, who must be assigned to the homework's subject
+//   - req: Feedback text
+//
+// Returns:
+//   - *HomeworkSubmission: Submission with the feedback
+//   - error: sql.ErrNoRows if the submission does not exist, ErrNotTeaching,
+//     ErrInvalidHomework, or a database error
+func (db *DB) SetHomeworkFeedback(submissionID, teacherID int, req *HomeworkFeedbackRequest) (*HomeworkSubmission, error) {
+	if err := ValidateHomeworkFeedback(req); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var subjectID int
+	err = tx.QueryRow(`
+		SELECT h.subject_id
+		FROM homework_submissions hs
+		JOIN homework_assignments h ON h.id = hs.homework_id
+		WHERE hs.id = $1
+		FOR UPDATE OF hs`, submissionID,
+	).Scan(&subjectID)
+	if err != nil {
+		return nil, err
+	}
+	if err = requireTeaching(tx, teacherID, subjectID); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE homework_submissions SET feedback = $1, feedback_by = $2, feedback_at = NOW() WHERE id = $3",
+		req.Feedback, teacherID, submissionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return db.GetHomeworkSubmission(submissionID)
+}
@@ -0,0 +1,568 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page size limits for list endpoints
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+)
+
+// ErrInvalidListParams is returned when list parameters name a field that is
+// not allowed or carry a malformed value. The wrapped message says which.
+var ErrInvalidListParams = errors.New("invalid list parameters")
+
+// SortField orders a list by one field
+type SortField struct {
+	Field string // API field name, e.g. last_name
+	Desc  bool   // Sort descending
+}
+
+// ListParams selects and orders a page of a list endpoint. Field names are
+// API names and are checked against an allow-list before any SQL is built.
+type ListParams struct {
+	Limit   int               // Maximum rows per page (DefaultListLimit if 0)
+	Page    int               // 1-based page number; cannot be combined with Cursor
+	Cursor  string            // Opaque cursor from a previous ListResult.NextCursor
+	Sort    []SortField       // Sort order; the entity default if empty
+	Filters map[string]string // Exact-match filters by field name
+	Query   string            // Case-insensitive substring search
+}
+
+// ListResult is the common response envelope of list endpoints
+type ListResult[T any] struct {
+	Data       []T    `json:"data"`                  // Rows of this page
+	Total      int    `json:"total"`                 // Rows matching the filters across all pages
+	Limit      int    `json:"limit"`                 // Page size used
+	Page       int    `json:"page,omitempty"`        // Page number, when paging by page
+	NextCursor string `json:"next_cursor,omitempty"` // Cursor of the next page, empty on the last page
+}
+
+// listKind is the type of a list field, used to parse filter and cursor values
+type listKind int
+
+const (
+	kindString listKind = iota
+	kindInt
+	kindBool
+	kindTime
+)
+
+// sqlType returns the PostgreSQL type list parameters of this kind are cast to
+func (k listKind) sqlType() string {
+	switch k {
+	case kindInt:
+		return "bigint"
+	case kindBool:
+		return "boolean"
+	case kindTime:
+		return "timestamp"
+	default:
+		return "text"
+	}
+}
+
+// listField describes one field of a list endpoint
+type listField[T any] struct {
+	Column string              // SQL expression selecting the field
+	Kind   listKind            // Value type
+	Value  func(T) interface{} // Reads the field from a row: string, int, bool or time.Time
+	Sort   bool                // Field may be used in sort
+	Filter bool                // Field may be used in filter[...]
+	Search bool                // Field is searched by q
+}
+
+// listSpec is the allow-list of fields of a list endpoint
+type listSpec[T any] struct {
+	Fields      map[string]listField[T]
+	Key         string      // Unique field appended to every sort as a tiebreaker
+	DefaultSort []SortField // Sort used when none is requested
+}
+
+// normalize validates params against the spec and fills in defaults
+func (spec listSpec[T]) normalize(p ListParams) (ListParams, error) {
+	if p.Limit == 0 {
+		p.Limit = DefaultListLimit
+	}
+	if p.Limit < 1 || p.Limit > MaxListLimit {
+		return p, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidListParams, MaxListLimit)
+	}
+	if p.Page < 0 {
+		return p, fmt.Errorf("%w: page must be positive", ErrInvalidListParams)
+	}
+	if p.Page > 0 && p.Cursor != "" {
+		return p, fmt.Errorf("%w: page and cursor cannot be combined", ErrInvalidListParams)
+	}
+
+	if len(p.Sort) == 0 {
+		p.Sort = spec.DefaultSort
+	}
+	seen := map[string]bool{}
+	var order []SortField
+	for _, s := range p.Sort {
+		if f, ok := spec.Fields[s.Field]; !ok || !f.Sort {
+			return p, fmt.Errorf("%w: cannot sort by %q", ErrInvalidListParams, s.Field)
+		}
+		if seen[s.Field] {
+			return p, fmt.Errorf("%w: %q sorted twice", ErrInvalidListParams, s.Field)
+		}
+		seen[s.Field] = true
+		order = append(order, s)
+	}
+	if !seen[spec.Key] {
+		order = append(order, SortField{Field: spec.Key})
+	}
+	p.Sort = order
+
+	for name, value := range p.Filters {
+		f, ok := spec.Fields[name]
+		if !ok || !f.Filter {
+			return p, fmt.Errorf("%w: cannot filter by %q", ErrInvalidListParams, name)
+		}
+		if _, err := parseListValue(f.Kind, value); err != nil {
+			return p, fmt.Errorf("%w: invalid value for filter %q", ErrInvalidListParams, name)
+		}
+	}
+
+	p.Query = strings.TrimSpace(p.Query)
+	return p, nil
+}
+
+// sortKey describes a sort order for embedding in cursors
+func sortKey(order []SortField) string {
+	parts := make([]string, len(order))
+	for i, s := range order {
+		parts[i] = s.Field
+		if s.Desc {
+			parts[i] = "-" + s.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// listCursor is the decoded form of ListResult.NextCursor
+type listCursor struct {
+	Sort   string   `json:"s"` // Sort order the cursor belongs to
+	Values []string `json:"v"` // Sort field values of the last row of the previous page
+}
+
+// encodeCursor builds the cursor pointing after a row
+func (spec listSpec[T]) encodeCursor(order []SortField, row T) string {
+	cursor := listCursor{Sort: sortKey(order)}
+	for _, s := range order {
+		cursor.Values = append(cursor.Values, formatListValue(spec.Fields[s.Field].Value(row)))
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a cursor and checks it belongs to the requested sort order
+func (spec listSpec[T]) decodeCursor(p ListParams) ([]interface{}, error) {
+	invalid := fmt.Errorf("%w: invalid cursor", ErrInvalidListParams)
+
+	data, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+	if err != nil {
+		return nil, invalid
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, invalid
+	}
+	if cursor.Sort != sortKey(p.Sort) || len(cursor.Values) != len(p.Sort) {
+		return nil, fmt.Errorf("%w: cursor does not match the requested sort", ErrInvalidListParams)
+	}
+
+	values := make([]interface{}, len(p.Sort))
+	for i, s := range p.Sort {
+		if values[i], err = parseListValue(spec.Fields[s.Field].Kind, cursor.Values[i]); err != nil {
+			return nil, invalid
+		}
+	}
+	return values, nil
+}
+
+// formatListValue formats a field value for a cursor
+func formatListValue(v interface{}) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// parseListValue parses a filter or cursor value of a kind
+func parseListValue(kind listKind, s string) (interface{}, error) {
+	switch kind {
+	case kindInt:
+		return strconv.Atoi(s)
+	case kindBool:
+		return strconv.ParseBool(s)
+	case kindTime:
+		return time.Parse(time.RFC3339Nano, s)
+	default:
+		return s, nil
+	}
+}
+
+// sqlListArg converts a parsed value to a query argument matching kind.sqlType
+func sqlListArg(v interface{}) interface{} {
+	if t, ok := v.(time.Time); ok {
+		// timestamp columns hold UTC wall-clock time
+		return t.UTC().Format("2006-01-02 15:04:05.999999")
+	}
+	return v
+}
+
+// compareListValues orders two field values of the same kind
+func compareListValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case int:
+		b := b.(int)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case bool:
+		b := b.(bool)
+		switch {
+		case a == b:
+			return 0
+		case !a:
+			return -1
+		}
+		return 1
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	default:
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	}
+}
+
+// escapeLike escapes LIKE wildcards so q is matched literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// queryList runs a paginated list query on PostgreSQL.
+//
+// Parameters:
+//   - db: Database to query
+//   - spec: Allowed fields of the entity
+//   - p: Requested page
+//   - selectFrom: "SELECT columns FROM tables" without WHERE
+//   - where: Fixed conditions to combine with the filters, may be empty
+//   - args: Arguments of the fixed conditions ($1, $2, ...)
+//   - scan: Scans one row
+//
+// Returns:
+//   - *ListResult[T]: The page with totals and the next cursor
+//   - error: ErrInvalidListParams or a database error
+func queryList[T any](db *DB, spec listSpec[T], p ListParams, selectFrom string, where []string, args []interface{}, scan func(*sql.Rows) (T, error)) (*ListResult[T], error) {
+	p, err := spec.normalize(p)
+	if err != nil {
+		return nil, err
+	}
+
+	whereSQL, args := spec.whereSQL(p, where, args)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var total int
+	countQuery := "SELECT COUNT(*) FROM (" + selectFrom + whereSQL + ") counted"
+	if err := db.QueryRow(countQuery, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	// Keyset condition: rows strictly after the cursor in sort order
+	if p.Cursor != "" {
+		values, err := spec.decodeCursor(p)
+		if err != nil {
+			return nil, err
+		}
+		var alternatives []string
+		for i, s := range p.Sort {
+			var terms []string
+			for j := 0; j < i; j++ {
+				f := spec.Fields[p.Sort[j].Field]
+				terms = append(terms, fmt.Sprintf("%s = %s::%s", f.Column, arg(sqlListArg(values[j])), f.Kind.sqlType()))
+			}
+			f := spec.Fields[s.Field]
+			op := ">"
+			if s.Desc {
+				op = "<"
+			}
+			terms = append(terms, fmt.Sprintf("%s %s %s::%s", f.Column, op, arg(sqlListArg(values[i])), f.Kind.sqlType()))
+			alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+		}
+		if whereSQL == "" {
+			whereSQL = " WHERE "
+		} else {
+			whereSQL += " AND "
+		}
+		whereSQL += "(" + strings.Join(alternatives, " OR ") + ")"
+	}
+
+	query := selectFrom + whereSQL + spec.orderBySQL(p) + " LIMIT " + arg(p.Limit+1)
+	if p.Page > 1 {
+		query += " OFFSET " + arg((p.Page-1)*p.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	data := []T{}
+	for rows.Next() {
+		row, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, row)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return spec.result(p, data, total), nil
+}
+
+// whereSQL builds the WHERE clause for the fixed conditions and the filters
+// and search of normalized params. Field names come from the allow-list;
+// values are passed as arguments appended to args.
+func (spec listSpec[T]) whereSQL(p ListParams, where []string, args []interface{}) (string, []interface{}) {
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	names := make([]string, 0, len(p.Filters))
+	for name := range p.Filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := spec.Fields[name]
+		value, _ := parseListValue(f.Kind, p.Filters[name])
+		where = append(where, fmt.Sprintf("%s = %s::%s", f.Column, arg(sqlListArg(value)), f.Kind.sqlType()))
+	}
+	if p.Query != "" {
+		pattern := arg("%" + escapeLike(p.Query) + "%")
+		var matches []string
+		for _, name := range sortedFieldNames(spec) {
+			if f := spec.Fields[name]; f.Search {
+				matches = append(matches, fmt.Sprintf("%s ILIKE %s", f.Column, pattern))
+			}
+		}
+		where = append(where, "("+strings.Join(matches, " OR ")+")")
+	}
+
+	if len(where) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
+}
+
+// orderBySQL builds the ORDER BY clause for the sort of normalized params
+func (spec listSpec[T]) orderBySQL(p ListParams) string {
+	var orderBy []string
+	for _, s := range p.Sort {
+		dir := "ASC"
+		if s.Desc {
+			dir = "DESC"
+		}
+		orderBy = append(orderBy, spec.Fields[s.Field].Column+" "+dir)
+	}
+	return " ORDER BY " + strings.Join(orderBy, ", ")
+}
+
+// queryEach streams every row matching the filters and search of a list query
+// on PostgreSQL, in sort order. Limit, page and cursor are ignored.
+//
+// Parameters:
+//   - db: Database to query
+//   - spec: Allowed fields of the entity
+//   - p: Sort, filters and search
+//   - selectFrom: "SELECT columns FROM tables" without WHERE
+//   - where: Fixed conditions to combine with the filters, may be empty
+//   - args: Arguments of the fixed conditions ($1, $2, ...)
+//   - scan: Scans one row
+//   - fn: Called for each row; an error stops the iteration and is returned
+//
+// Returns:
+//   - error: ErrInvalidListParams before any row, or an error of the query or fn
+func queryEach[T any](db *DB, spec listSpec[T], p ListParams, selectFrom string, where []string, args []interface{}, scan func(*sql.Rows) (T, error), fn func(T) error) error {
+	p.Limit, p.Page, p.Cursor = 0, 0, ""
+	p, err := spec.normalize(p)
+	if err != nil {
+		return err
+	}
+
+	whereSQL, args := spec.whereSQL(p, where, args)
+	rows, err := db.Query(selectFrom+whereSQL+spec.orderBySQL(p), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row, err := scan(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// listSlice applies list parameters to rows held in memory, with the same
+// semantics as queryList
+func listSlice[T any](spec listSpec[T], p ListParams, rows []T) (*ListResult[T], error) {
+	p, err := spec.normalize(p)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := spec.filterSort(p, rows)
+	total := len(matched)
+	if p.Cursor != "" {
+		values, err := spec.decodeCursor(p)
+		if err != nil {
+			return nil, err
+		}
+		start := sort.Search(len(matched), func(i int) bool {
+			for k, s := range p.Sort {
+				c := compareListValues(spec.Fields[s.Field].Value(matched[i]), values[k])
+				if s.Desc {
+					c = -c
+				}
+				if c != 0 {
+					return c > 0
+				}
+			}
+			return false
+		})
+		matched = matched[start:]
+	} else if p.Page > 1 {
+		offset := (p.Page - 1) * p.Limit
+		if offset > len(matched) {
+			offset = len(matched)
+		}
+		matched = matched[offset:]
+	}
+
+	if len(matched) > p.Limit+1 {
+		matched = matched[:p.Limit+1]
+	}
+	return spec.result(p, append([]T{}, matched...), total), nil
+}
+
+// eachSlice calls fn for every row held in memory that matches the filters
+// and search of p, in sort order, with the same semantics as queryEach
+func eachSlice[T any](spec listSpec[T], p ListParams, rows []T, fn func(T) error) error {
+	p.Limit, p.Page, p.Cursor = 0, 0, ""
+	p, err := spec.normalize(p)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range spec.filterSort(p, rows) {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filterSort returns the rows matching the filters and search of normalized
+// params, in sort order
+func (spec listSpec[T]) filterSort(p ListParams, rows []T) []T {
+	query := strings.ToLower(p.Query)
+	var matched []T
+	for _, row := range rows {
+		if spec.matches(p, query, row) {
+			matched = append(matched, row)
+		}
+	}
+
+	compare := func(a, b T) int {
+		for _, s := range p.Sort {
+			f := spec.Fields[s.Field]
+			if c := compareListValues(f.Value(a), f.Value(b)); c != 0 {
+				if s.Desc {
+					return -c
+				}
+				return c
+			}
+		}
+		return 0
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return compare(matched[i], matched[j]) < 0 })
+	return matched
+}
+
+// matches reports whether a row passes the filters and search of p
+func (spec listSpec[T]) matches(p ListParams, query string, row T) bool {
+	for name, want := range p.Filters {
+		f := spec.Fields[name]
+		value, _ := parseListValue(f.Kind, want)
+		if compareListValues(f.Value(row), value) != 0 {
+			return false
+		}
+	}
+	if query == "" {
+		return true
+	}
+	for _, f := range spec.Fields {
+		if f.Search && strings.Contains(strings.ToLower(fmt.Sprint(f.Value(row))), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// result builds the envelope from up to Limit+1 fetched rows
+func (spec listSpec[T]) result(p ListParams, data []T, total int) *ListResult[T] {
+	result := &ListResult[T]{Data: data, Total: total, Limit: p.Limit}
+	if p.Cursor == "" {
+		result.Page = p.Page
+		if result.Page == 0 {
+			result.Page = 1
+		}
+	}
+	if len(data) > p.Limit {
+		result.Data = data[:p.Limit]
+		result.NextCursor = spec.encodeCursor(p.Sort, result.Data[p.Limit-1])
+	}
+	return result
+}
+
+// sortedFieldNames returns the field names of a spec in a stable order
+func sortedFieldNames[T any](spec listSpec[T]) []string {
+	names := make([]string, 0, len(spec.Fields))
+	for name := range spec.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
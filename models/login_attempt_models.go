@@ -0,0 +1,383 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// MaxUsernameLength is the length of the users.username column; longer
+// usernames cannot belong to an account
+const MaxUsernameLength = 100
+
+// Outcomes of a recorded login attempt
+const (
+	LoginSuccess  = "success"  // The password was correct
+	LoginFailure  = "failure"  // Unknown username or wrong password
+	LoginBlocked  = "blocked"  // Refused by the rate limit or a lockout before the password was checked
+	LoginUnlocked = "unlocked" // An admin unlocked the account; restarts the count of its failures
+	LoginReset    = "reset"    // A password reset link was requested for the email address recorded as the username
+)
+
+// LoginAttempt is one recorded login, kept to enforce rate limits and to
+// review attack patterns
+type LoginAttempt struct {
+	ID          int       `json:"id"`           // Unique identifier
+	Username    string    `json:"username"`     // Username as entered, which may not exist
+	IPAddress   string    `json:"ip_address"`   // Client address
+	Outcome     string    `json:"outcome"`      // success, failure, blocked, unlocked or reset
+	AttemptedAt time.Time `json:"attempted_at"` // Time of the attempt
+}
+
+// LoginFailures counts the recent failed logins of a username and an address
+type LoginFailures struct {
+	Username      int       // Failures of the username since its last successful login or unlock
+	UsernameFirst time.Time // Oldest of them, zero if none
+	UsernameLast  time.Time // Newest of them, zero if none
+	IP            int       // Failures from the address
+	IPFirst       time.Time // Oldest of them, zero if none
+}
+
+// LoginFailureCount is the number of failed logins of one username or address
+type LoginFailureCount struct {
+	Key         string    `json:"key"`          // Username or IP address
+	Failures    int       `json:"failures"`     // Failed logins in the period
+	LastFailure time.Time `json:"last_failure"` // Newest of them
+}
+
+// LoginFailureSummary shows where failed logins came from in a period
+type LoginFailureSummary struct {
+	Since      time.Time           `json:"since"`       // Start of the period
+	Failures   int                 `json:"failures"`    // Failed logins in the period
+	Blocked    int                 `json:"blocked"`     // Attempts refused without checking the password
+	ByIP       []LoginFailureCount `json:"by_ip"`       // Addresses with the most failures first
+	ByUsername []LoginFailureCount `json:"by_username"` // Usernames with the most failures first
+}
+
+// LoginPolicy decides when logins are refused after failed attempts. Counts
+// are taken over a sliding window, so refusals end as old failures leave it.
+type LoginPolicy struct {
+	Window           time.Duration // Sliding window failures are counted in
+	MaxIPFailures    int           // Failures from one address in the window before it is refused, 0 for no limit
+	MaxUserFailures  int           // Failures of one username in the window before it is refused, 0 for no limit
+	FreeFailures     int           // Failures of one username before each attempt must wait
+	Delay            time.Duration // Wait after the first delayed failure, doubled after each further one
+	MaxDelay         time.Duration // Longest wait between attempts
+	LockoutThreshold int           // Failures of one account in the window that lock it, 0 to never lock
+	LockoutDuration  time.Duration // How long a locked account refuses logins
+}
+
+// DefaultLoginPolicy returns the login policy used unless one is configured
+func DefaultLoginPolicy() LoginPolicy {
+	return LoginPolicy{
+		Window:           15 * time.Minute,
+		MaxIPFailures:    100,
+		MaxUserFailures:  10,
+		FreeFailures:     3,
+		Delay:            time.Second,
+		MaxDelay:         30 * time.Second,
+		LockoutThreshold: 5,
+		LockoutDuration:  15 * time.Minute,
+	}
+}
+
+// DefaultPasswordResetPolicy returns the rate limit of password reset
+// requests: a few per email address and more per client address each hour.
+// Requests count as failures; there is no delay or lockout.
+func DefaultPasswordResetPolicy() LoginPolicy {
+	return LoginPolicy{
+		Window:          time.Hour,
+		MaxIPFailures:   20,
+		MaxUserFailures: 3,
+	}
+}
+
+// RetryAfter returns how long a login must wait given the recent failures of
+// its username and address
+//
+// Parameters:
+//   - f: Failures counted since now minus the window
+//   - now: Time of the login
+//
+// Returns:
+//   - time.Duration: Wait before the next attempt is allowed, 0 if it is allowed now
+func (p LoginPolicy) RetryAfter(f *LoginFailures, now time.Time) time.Duration {
+	var wait time.Duration
+	until := func(t time.Time) {
+		if d := t.Sub(now); d > wait {
+			wait = d
+		}
+	}
+
+	// At the limit, the oldest failure leaving the window lifts the refusal
+	if p.MaxIPFailures > 0 && f.IP >= p.MaxIPFailures {
+		until(f.IPFirst.Add(p.Window))
+	}
+	if p.MaxUserFailures > 0 && f.Username >= p.MaxUserFailures {
+		until(f.UsernameFirst.Add(p.Window))
+	}
+
+	if delayed := f.Username - p.FreeFailures; delayed > 0 && p.Delay > 0 {
+		delay := p.Delay
+		for i := 1; i < delayed && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+			delay *= 2
+		}
+		if p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+		until(f.UsernameLast.Add(delay))
+	}
+
+	return wait
+}
+
+// Locks reports whether an account with this many recent failures is locked
+func (p LoginPolicy) Locks(failures int) bool {
+	return p.LockoutThreshold > 0 && failures >= p.LockoutThreshold
+}
+
+// RecordLoginAttempt stores a login attempt
+//
+// Parameters:
+//   - username: Username as entered, at most MaxUsernameLength bytes
+//   - ip: Client address
+//   - outcome: LoginSuccess, LoginFailure, LoginBlocked, LoginUnlocked or LoginReset
+//
+// Returns:
+//   - error: Error if the attempt cannot be stored
+func (db *DB) RecordLoginAttempt(username, ip, outcome string) error {
+	_, err := db.Exec(
+		"INSERT INTO login_attempts (username, ip_address, outcome, attempted_at) VALUES ($1, $2, $3, $4)",
+		username, ip, outcome, time.Now().UTC(),
+	)
+	return err
+}
+
+// CountLoginFailures counts the failed logins of a username and an address.
+// Failures of the username before its last successful login or unlock are
+// not counted; failures of the address always are.
+//
+// Parameters:
+//   - username: Username as entered
+//   - ip: Client address
+//   - since: Start of the window
+//
+// Returns:
+//   - *LoginFailures: Counts with the times of the oldest and newest failures
+//   - error: A database error
+func (db *DB) CountLoginFailures(username, ip string, since time.Time) (*LoginFailures, error) {
+	f := &LoginFailures{}
+	var first, last, ipFirst sql.NullTime
+
+	err := db.QueryRow(`
+		SELECT COUNT(*), MIN(attempted_at), MAX(attempted_at)
+		FROM login_attempts
+		WHERE username = $1 AND outcome = 'failure' AND attempted_at >= $2
+		  AND attempted_at > COALESCE((
+		      SELECT MAX(attempted_at) FROM login_attempts
+		      WHERE username = $1 AND outcome IN ('success', 'unlocked')
+		  ), '-infinity')`,
+		username, since,
+	).Scan(&f.Username, &first, &last)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.QueryRow(`
+		SELECT COUNT(*), MIN(attempted_at)
+		FROM login_attempts
+		WHERE ip_address = $1 AND outcome = 'failure' AND attempted_at >= $2`,
+		ip, since,
+	).Scan(&f.IP, &ipFirst)
+	if err != nil {
+		return nil, err
+	}
+
+	f.UsernameFirst, f.UsernameLast, f.IPFirst = first.Time, last.Time, ipFirst.Time
+	return f, nil
+}
+
+// CountPasswordResetRequests counts the password reset requests for an email
+// address and from a client address, in the shape of LoginFailures so that
+// a LoginPolicy can limit them
+//
+// Parameters:
+//   - email: Normalized email address the requests were recorded under
+//   - ip: Client address
+//   - since: Start of the window
+//
+// Returns:
+//   - *LoginFailures: Counts with the times of the oldest and newest requests
+//   - error: A database error
+func (db *DB) CountPasswordResetRequests(email, ip string, since time.Time) (*LoginFailures, error) {
+	f := &LoginFailures{}
+	var first, last, ipFirst sql.NullTime
+
+	err := db.QueryRow(`
+		SELECT COUNT(*), MIN(attempted_at), MAX(attempted_at)
+		FROM login_attempts
+		WHERE username = $1 AND outcome = 'reset' AND attempted_at >= $2`,
+		email, since,
+	).Scan(&f.Username, &first, &last)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.QueryRow(`
+		SELECT COUNT(*), MIN(attempted_at)
+		FROM login_attempts
+		WHERE ip_address = $1 AND outcome = 'reset' AND attempted_at >= $2`,
+		ip, since,
+	).Scan(&f.IP, &ipFirst)
+	if err != nil {
+		return nil, err
+	}
+
+	f.UsernameFirst, f.UsernameLast, f.IPFirst = first.Time, last.Time, ipFirst.Time
+	return f, nil
+}
+
+// loginAttemptListSpec allow-lists the fields of the login attempt list
+var loginAttemptListSpec = listSpec[*LoginAttempt]{
+	Fields: map[string]listField[*LoginAttempt]{
+		"id":           {Column: "id", Kind: kindInt, Value: func(a *LoginAttempt) interface{} { return a.ID }, Sort: true},
+		"username":     {Column: "username", Value: func(a *LoginAttempt) interface{} { return a.Username }, Sort: true, Filter: true, Search: true},
+		"ip_address":   {Column: "ip_address", Value: func(a *LoginAttempt) interface{} { return a.IPAddress }, Sort: true, Filter: true, Search: true},
+		"outcome":      {Column: "outcome", Value: func(a *LoginAttempt) interface{} { return a.Outcome }, Sort: true, Filter: true},
+		"attempted_at": {Column: "attempted_at", Kind: kindTime, Value: func(a *LoginAttempt) interface{} { return a.AttemptedAt }, Sort: true},
+	},
+	Key:         "id",
+	DefaultSort: []SortField{{Field: "attempted_at", Desc: true}},
+}
+
+// ListLoginAttempts retrieves a page of recorded login attempts
+//
+// Parameters:
+//   - params: Page, sort, filters (username, ip_address, outcome) and search (username, ip_address)
+//
+// Returns:
+//   - *ListResult[*LoginAttempt]: Page of attempts, newest first unless sorted otherwise
+//   - error: ErrInvalidListParams or a database error
+func (db *DB) ListLoginAttempts(params ListParams) (*ListResult[*LoginAttempt], error) {
+	return queryList(db, loginAttemptListSpec, params,
+		"SELECT id, username, ip_address, outcome, attempted_at FROM login_attempts",
+		nil, nil, scanLoginAttemptRow)
+}
+
+// scanLoginAttemptRow scans a row of login_attempts
+func scanLoginAttemptRow(rows *sql.Rows) (*LoginAttempt, error) {
+	a := &LoginAttempt{}
+	err := rows.Scan(&a.ID, &a.Username, &a.IPAddress, &a.Outcome, &a.AttemptedAt)
+	return a, err
+}
+
+// SummarizeLoginFailures counts failed logins per address and per username
+//
+// Parameters:
+//   - since: Start of the period
+//   - limit: Maximum number of addresses and of usernames listed
+//
+// Returns:
+//   - *LoginFailureSummary: Totals and the addresses and usernames with the most failures
+//   - error: A database error
+func (db *DB) SummarizeLoginFailures(since time.Time, limit int) (*LoginFailureSummary, error) {
+	summary := &LoginFailureSummary{Since: since}
+	err := db.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE outcome = 'failure'), COUNT(*) FILTER (WHERE outcome = 'blocked')
+		FROM login_attempts
+		WHERE attempted_at >= $1`,
+		since,
+	).Scan(&summary.Failures, &summary.Blocked)
+	if err != nil {
+		return nil, err
+	}
+
+	if summary.ByIP, err = db.countLoginFailuresBy("ip_address", since, limit); err != nil {
+		return nil, err
+	}
+	if summary.ByUsername, err = db.countLoginFailuresBy("username", since, limit); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// countLoginFailuresBy counts failed logins grouped by a column of
+// login_attempts, which must be a trusted column name
+func (db *DB) countLoginFailuresBy(column string, since time.Time, limit int) ([]LoginFailureCount, error) {
+	rows, err := db.Query(`
+		SELECT `+column+`, COUNT(*), MAX(attempted_at)
+		FROM login_attempts
+		WHERE outcome = 'failure' AND attempted_at >= $1
+		GROUP BY `+column+`
+		ORDER BY COUNT(*) DESC, `+column+`
+		LIMIT $2`,
+		since, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []LoginFailureCount{}
+	for rows.Next() {
+		var count LoginFailureCount
+		if err := rows.Scan(&count.Key, &count.Failures, &count.LastFailure); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// PurgeLoginAttempts deletes login attempts older than a time
+//
+// Parameters:
+//   - before: Attempts before this time are deleted
+//
+// Returns:
+//   - int64: Number of attempts deleted
+//   - error: A database error
+func (db *DB) PurgeLoginAttempts(before time.Time) (int64, error) {
+	res, err := db.Exec("DELETE FROM login_attempts WHERE attempted_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// LockUser refuses logins of a user until a time
+//
+// Parameters:
+//   - userID: User to lock
+//   - until: End of the lockout
+//
+// Returns:
+//   - error: sql.ErrNoRows if the user does not exist, or a database error
+func (db *DB) LockUser(userID int, until time.Time) error {
+	res, err := db.Exec("UPDATE users SET locked_until = $1 WHERE id = $2", until, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UnlockUser lifts the lockout of a user
+//
+// Parameters:
+//   - userID: User to unlock
+//
+// Returns:
+//   - error: sql.ErrNoRows if the user does not exist, or a database error
+func (db *DB) UnlockUser(userID int) error {
+	res, err := db.Exec("UPDATE users SET locked_until = NULL WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
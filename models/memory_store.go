@@ -0,0 +1,4181 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-memory implementation of Store intended for tests.
+// It mirrors the behaviour of the PostgreSQL implementation, including
+// unique constraints, cascading deletes and sql.ErrNoRows for missing rows.
+// All returned values are copies, so callers cannot mutate the store.
+type MemoryStore struct {
+	Hasher PasswordHasher // Hasher used for every password write
+
+	mu                  sync.RWMutex
+	nextID              int
+	users               map[int]*User
+	students            map[int]*Student
+	subjects            map[int]*Subject
+	teacherSubjects     map[int]map[int]time.Time         // teacher ID -> subject ID -> assigned at
+	enrollments         map[int]map[int]*Enrollment       // student ID -> subject ID -> enrollment
+	teacherProfiles     map[int]*Teacher                  // user ID -> profile (subjects unset)
+	lessons             map[int]*Lesson                   // lesson ID -> lesson (records unset)
+	attendance          map[int]map[int]*AttendanceRecord // lesson ID -> student ID -> record
+	gradingSchemes      map[int]*GradingScheme            // subject ID -> scheme, nil boundaries for the defaults
+	assessments         map[int]*Assessment               // assessment ID -> assessment (scores unset)
+	scores              map[int]map[int]*AssessmentScore  // assessment ID -> student ID -> score
+	predictedGrades     map[int]*PredictedGrade
+	diplomaCore         map[int]*DiplomaCore      // student ID -> core results
+	casActivities       map[int]*CASActivity      // activity ID -> activity (names unset)
+	projects            map[int]*Project          // project ID -> project (names, milestones and drafts unset)
+	milestones          map[int]*ProjectMilestone // milestone ID -> milestone
+	projectDrafts       map[int]*ProjectDraft
+	projectComments     map[int]*ProjectComment // comment ID -> comment (author name unset)
+	timeSlots           map[int]*TimeSlot
+	rooms               map[int]*Room
+	timetableLessons    map[int]*TimetableLesson       // lesson ID -> lesson (names and times unset)
+	exams               map[int]*Exam                  // exam ID -> exam (subject unset)
+	homeworkAssignments map[int]*Homework              // homework ID -> homework (subject and attachments unset)
+	homeworkFiles       map[int]*HomeworkFile          // attachment ID -> attachment
+	homeworkSubmissions map[int]*HomeworkSubmission    // submission ID -> submission (student name unset)
+	guardianProfiles    map[int]*Guardian              // user ID -> profile (username and children unset)
+	guardianLinks       map[int]map[int]*GuardianChild // guardian ID -> student ID -> link (names unset)
+	refreshTokens       map[int]*RefreshToken
+	passwordResets      map[int]*PasswordResetToken
+	loginAttempts       []*LoginAttempt // oldest first
+	mfa                 map[int]*MFA    // user ID -> enrolment (recovery codes left unset)
+	recoveryCodes       map[int][]*mfaRecoveryCode
+	revokedTokens       map[string]time.Time // jti -> expires at
+	sessionRevocations  map[int]time.Time    // user ID -> revoked at
+	calendarFeeds       map[int]string       // user ID -> feed ID
+	roles               map[string]*Role
+}
+
+// NewMemoryStore creates an in-memory store seeded with the built-in roles.
+//
+// Returns:
+//   - *MemoryStore: Store using bcrypt for password hashing
+func NewMemoryStore() *MemoryStore {
+	m := &MemoryStore{
+		Hasher:              BcryptHasher{},
+		users:               make(map[int]*User),
+		students:            make(map[int]*Student),
+		subjects:            make(map[int]*Subject),
+		teacherSubjects:     make(map[int]map[int]time.Time),
+		enrollments:         make(map[int]map[int]*Enrollment),
+		teacherProfiles:     make(map[int]*Teacher),
+		lessons:             make(map[int]*Lesson),
+		attendance:          make(map[int]map[int]*AttendanceRecord),
+		gradingSchemes:      make(map[int]*GradingScheme),
+		assessments:         make(map[int]*Assessment),
+		scores:              make(map[int]map[int]*AssessmentScore),
+		predictedGrades:     make(map[int]*PredictedGrade),
+		diplomaCore:         make(map[int]*DiplomaCore),
+		casActivities:       make(map[int]*CASActivity),
+		projects:            make(map[int]*Project),
+		milestones:          make(map[int]*ProjectMilestone),
+		projectDrafts:       make(map[int]*ProjectDraft),
+		projectComments:     make(map[int]*ProjectComment),
+		timeSlots:           make(map[int]*TimeSlot),
+		rooms:               make(map[int]*Room),
+		timetableLessons:    make(map[int]*TimetableLesson),
+		exams:               make(map[int]*Exam),
+		homeworkAssignments: make(map[int]*Homework),
+		homeworkFiles:       make(map[int]*HomeworkFile),
+		homeworkSubmissions: make(map[int]*HomeworkSubmission),
+		guardianProfiles:    make(map[int]*Guardian),
+		guardianLinks:       make(map[int]map[int]*GuardianChild),
+		refreshTokens:       make(map[int]*RefreshToken),
+		passwordResets:      make(map[int]*PasswordResetToken),
+		mfa:                 make(map[int]*MFA),
+		recoveryCodes:       make(map[int][]*mfaRecoveryCode),
+		revokedTokens:       make(map[string]time.Time),
+		sessionRevocations:  make(map[int]time.Time),
+		calendarFeeds:       make(map[int]string),
+		roles:               make(map[string]*Role),
+	}
+
+	for name, permissions := range DefaultRolePermissions {
+		sorted := append([]string(nil), permissions...)
+		sort.Strings(sorted)
+		m.roles[name] = &Role{
+			Name:        name,
+			IsSystem:    true,
+			Permissions: sorted,
+			CreatedAt:   time.Now(),
+		}
+	}
+
+	return m
+}
+
+// id returns the next identifier; callers must hold the write lock
+func (m *MemoryStore) id() int {
+	m.nextID++
+	return m.nextID
+}
+
+// hashPassword hashes a password with the store's configured hasher
+func (m *MemoryStore) hashPassword(password string) (string, error) {
+	hasher := m.Hasher
+	if hasher == nil {
+		hasher = BcryptHasher{}
+	}
+	return hasher.Hash(password)
+}
+
+// userByUsername finds a user by username; callers must hold the lock
+func (m *MemoryStore) userByUsername(username string) *User {
+	for _, user := range m.users {
+		if user.Username == username {
+			return user
+		}
+	}
+	return nil
+}
+
+// deleteUser removes a user and every row referencing it; callers must hold the write lock
+func (m *MemoryStore) deleteUser(userID int) {
+	delete(m.users, userID)
+	delete(m.teacherSubjects, userID)
+	delete(m.teacherProfiles, userID)
+	delete(m.guardianProfiles, userID)
+	delete(m.guardianLinks, userID)
+	delete(m.sessionRevocations, userID)
+	delete(m.calendarFeeds, userID)
+	delete(m.mfa, userID)
+	delete(m.recoveryCodes, userID)
+	for id, student := range m.students {
+		if student.UserID == userID {
+			delete(m.students, id)
+			delete(m.enrollments, id)
+			delete(m.diplomaCore, id)
+			for activityID, activity := range m.casActivities {
+				if activity.StudentID == id {
+					delete(m.casActivities, activityID)
+				}
+			}
+			for projectID, project := range m.projects {
+				if project.StudentID == id {
+					m.deleteProject(projectID)
+				}
+			}
+			for submissionID, submission := range m.homeworkSubmissions {
+				if submission.StudentID == id {
+					delete(m.homeworkSubmissions, submissionID)
+				}
+			}
+			for _, links := range m.guardianLinks {
+				delete(links, id)
+			}
+			for _, records := range m.attendance {
+				delete(records, id)
+			}
+			for _, scores := range m.scores {
+				delete(scores, id)
+			}
+			for predictionID, predicted := range m.predictedGrades {
+				if predicted.StudentID == id {
+					delete(m.predictedGrades, predictionID)
+				}
+			}
+		}
+	}
+	for _, lesson := range m.lessons {
+		if lesson.TeacherID == userID {
+			lesson.TeacherID = 0
+		}
+	}
+	for _, records := range m.attendance {
+		for _, record := range records {
+			if record.RecordedBy == userID {
+				record.RecordedBy = 0
+			}
+		}
+	}
+	for _, assessment := range m.assessments {
+		if assessment.CreatedBy == userID {
+			assessment.CreatedBy = 0
+		}
+	}
+	for _, scores := range m.scores {
+		for _, score := range scores {
+			if score.RecordedBy == userID {
+				score.RecordedBy = 0
+			}
+		}
+	}
+	for _, predicted := range m.predictedGrades {
+		if predicted.TeacherID == userID {
+			predicted.TeacherID = 0
+		}
+	}
+	for _, core := range m.diplomaCore {
+		if core.UpdatedBy == userID {
+			core.UpdatedBy = 0
+		}
+	}
+	for _, activity := range m.casActivities {
+		if activity.SupervisorID == userID {
+			activity.SupervisorID = 0
+		}
+	}
+	for _, project := range m.projects {
+		if project.SupervisorID == userID {
+			project.SupervisorID = 0
+		}
+	}
+	for _, milestone := range m.milestones {
+		if milestone.CompletedBy == userID {
+			milestone.CompletedBy = 0
+		}
+	}
+	for _, lesson := range m.timetableLessons {
+		if lesson.TeacherID == userID {
+			lesson.TeacherID = 0
+		}
+	}
+	for _, draft := range m.projectDrafts {
+		if draft.UploadedBy == userID {
+			draft.UploadedBy = 0
+		}
+	}
+	for _, comment := range m.projectComments {
+		if comment.AuthorID == userID {
+			comment.AuthorID = 0
+		}
+	}
+	for _, h := range m.homeworkAssignments {
+		if h.CreatedBy == userID {
+			h.CreatedBy = 0
+		}
+	}
+	for _, submission := range m.homeworkSubmissions {
+		if submission.FeedbackBy == userID {
+			submission.FeedbackBy = 0
+		}
+	}
+	for id, token := range m.refreshTokens {
+		if token.UserID == userID {
+			delete(m.refreshTokens, id)
+		}
+	}
+	for id, token := range m.passwordResets {
+		if token.UserID == userID {
+			delete(m.passwordResets, id)
+		}
+	}
+}
+
+// --- UserStore ---
+
+// GetUserByID retrieves a user by their ID.
+func (m *MemoryStore) GetUserByID(id int) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *user
+	return &copied, nil
+}
+
+// GetUserByUsername retrieves a user by their username.
+func (m *MemoryStore) GetUserByUsername(username string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user := m.userByUsername(username)
+	if user == nil {
+		return nil, sql.ErrNoRows
+	}
+	copied := *user
+	return &copied, nil
+}
+
+// CreateUser adds a new user with a hashed password.
+func (m *MemoryStore) CreateUser(username, password, role string) (*User, error) {
+	hash, err := m.hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userByUsername(username) != nil {
+		return nil, ErrDuplicate
+	}
+	if _, ok := m.roles[role]; !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	user := &User{
+		ID:          m.id(),
+		Username:    username,
+		Password:    hash,
+		Role:        role,
+		Active:      true,
+		DateCreated: time.Now(),
+	}
+	m.users[user.ID] = user
+
+	copied := *user
+	return &copied, nil
+}
+
+// CreateUserWithStoredPassword adds a user whose password value is stored
+// verbatim, bypassing hashing. It exists so tests can reproduce legacy
+// plaintext rows.
+//
+// Parameters:
+//   - username: Login username
+//   - stored: Value to store in the password column
+//   - role: User role
+//
+// Returns:
+//   - *User: Created user object
+//   - error: ErrDuplicate if the username is taken
+func (m *MemoryStore) CreateUserWithStoredPassword(username, stored, role string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userByUsername(username) != nil {
+		return nil, ErrDuplicate
+	}
+
+	user := &User{
+		ID:          m.id(),
+		Username:    username,
+		Password:    stored,
+		Role:        role,
+		Active:      true,
+		DateCreated: time.Now(),
+	}
+	m.users[user.ID] = user
+
+	copied := *user
+	return &copied, nil
+}
+
+// UpdateUserPassword hashes and stores a new password for a user.
+func (m *MemoryStore) UpdateUserPassword(userID int, password string) error {
+	hash, err := m.hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	user.Password = hash
+	return nil
+}
+
+// UpdateProfile changes a user's display name and the email in their role's record.
+func (m *MemoryStore) UpdateProfile(userID int, req *ProfileRequest) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	switch user.Role {
+	case RoleStudent:
+		var own *Student
+		for _, student := range m.students {
+			if student.UserID == userID {
+				own = student
+			} else if student.Email == req.Email {
+				return nil, ErrDuplicate
+			}
+		}
+		if own != nil {
+			own.Email = req.Email
+			own.UpdatedAt = time.Now()
+		}
+	case RoleTeacher:
+		if m.teacherEmailTaken(req.Email, userID) {
+			return nil, ErrDuplicate
+		}
+		if m.teacherProfiles[userID] == nil {
+			m.teacherProfiles[userID] = &Teacher{}
+		}
+		m.teacherProfiles[userID].Email = req.Email
+	case RoleGuardian:
+		if m.guardianEmailTaken(req.Email, userID) {
+			return nil, ErrDuplicate
+		}
+		if m.guardianProfiles[userID] == nil {
+			m.guardianProfiles[userID] = &Guardian{}
+		}
+		m.guardianProfiles[userID].Email = req.Email
+	}
+	user.DisplayName = req.DisplayName
+
+	copied := *user
+	return &copied, nil
+}
+
+// GetUsersByEmail retrieves the users whose student, teacher or guardian record holds an email.
+func (m *MemoryStore) GetUsersByEmail(email string) ([]*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matches := map[int]bool{}
+	for _, student := range m.students {
+		if strings.EqualFold(student.Email, email) {
+			matches[student.UserID] = true
+		}
+	}
+	for id, profile := range m.teacherProfiles {
+		if strings.EqualFold(profile.Email, email) {
+			matches[id] = true
+		}
+	}
+	for id, profile := range m.guardianProfiles {
+		if strings.EqualFold(profile.Email, email) {
+			matches[id] = true
+		}
+	}
+
+	users := []*User{}
+	for id := range matches {
+		if user, ok := m.users[id]; ok {
+			copied := *user
+			users = append(users, &copied)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+	return users, nil
+}
+
+// RequirePasswordChange flags a user to set a new password before their next login.
+func (m *MemoryStore) RequirePasswordChange(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	user.MustChangePassword = true
+	return nil
+}
+
+// LockUser refuses logins of a user until a time.
+func (m *MemoryStore) LockUser(userID int, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	user.LockedUntil = &until
+	return nil
+}
+
+// UnlockUser lifts the lockout of a user.
+func (m *MemoryStore) UnlockUser(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	user.LockedUntil = nil
+	return nil
+}
+
+// VerifyDummyPassword spends the time of a password check for an unknown username.
+func (m *MemoryStore) VerifyDummyPassword(password string) {
+	verifyDummyPassword(m.Hasher, password)
+}
+
+// PasswordNeedsUpgrade reports whether a user's stored password should be rehashed.
+func (m *MemoryStore) PasswordNeedsUpgrade(user *User) bool {
+	if !IsPasswordHash(user.Password) {
+		return true
+	}
+	return m.Hasher != nil && !m.Hasher.Matches(user.Password)
+}
+
+// --- TokenStore ---
+
+// CreateRefreshToken stores a new refresh token for a user.
+func (m *MemoryStore) CreateRefreshToken(userID int, tokenHash string, expiresAt time.Time, mfa bool) (*RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.createRefreshToken(userID, tokenHash, expiresAt, mfa)
+}
+
+// createRefreshToken stores a refresh token; callers must hold the write lock
+func (m *MemoryStore) createRefreshToken(userID int, tokenHash string, expiresAt time.Time, mfa bool) (*RefreshToken, error) {
+	if _, ok := m.users[userID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	for _, token := range m.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return nil, ErrDuplicate
+		}
+	}
+
+	token := &RefreshToken{
+		ID:        m.id(),
+		UserID:    userID,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+		MFA:       mfa,
+	}
+	m.refreshTokens[token.ID] = token
+
+	copied := *token
+	return &copied, nil
+}
+
+// GetRefreshTokenByHash retrieves a refresh token by its hash.
+func (m *MemoryStore) GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, token := range m.refreshTokens {
+		if token.TokenHash == tokenHash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// RotateRefreshToken revokes a refresh token and stores its replacement.
+func (m *MemoryStore) RotateRefreshToken(oldID int, newHash string, expiresAt time.Time) (*RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.refreshTokens[oldID]
+	if !ok || old.RevokedAt != nil {
+		return nil, ErrTokenRevoked
+	}
+
+	token, err := m.createRefreshToken(old.UserID, newHash, expiresAt, old.MFA)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	replacedBy := token.ID
+	old.RevokedAt = &now
+	old.ReplacedBy = &replacedBy
+
+	return token, nil
+}
+
+// RevokeRefreshToken revokes a single refresh token belonging to a user.
+func (m *MemoryStore) RevokeRefreshToken(userID int, tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range m.refreshTokens {
+		if token.UserID == userID && token.TokenHash == tokenHash && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+// RevokeAccessToken adds an access token's jti to the denylist.
+func (m *MemoryStore) RevokeAccessToken(jti string, userID int, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.revokedTokens[jti]; !ok {
+		m.revokedTokens[jti] = expiresAt
+	}
+	return nil
+}
+
+// ClaimToken adds a single-use token to the denylist, reporting whether it was unused.
+func (m *MemoryStore) ClaimToken(jti string, userID int, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.revokedTokens[jti]; ok {
+		return false, nil
+	}
+	m.revokedTokens[jti] = expiresAt
+	return true, nil
+}
+
+// RevokeUserSessions revokes every refresh token and access token of a user.
+func (m *MemoryStore) RevokeUserSessions(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range m.refreshTokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	m.sessionRevocations[userID] = now
+	return nil
+}
+
+// IsTokenRevoked reports whether an access token has been revoked.
+func (m *MemoryStore) IsTokenRevoked(jti string, userID int, issuedAt time.Time) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.revokedTokens[jti]; ok {
+		return true, nil
+	}
+	if revokedAt, ok := m.sessionRevocations[userID]; ok {
+		// JWT timestamps have second precision, as in the PostgreSQL query
+		return !revokedAt.Truncate(time.Second).Before(issuedAt), nil
+	}
+	return false, nil
+}
+
+// GetCalendarFeedID retrieves the identifier of a user's current calendar feed.
+func (m *MemoryStore) GetCalendarFeedID(userID int) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	feedID, ok := m.calendarFeeds[userID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return feedID, nil
+}
+
+// SetCalendarFeedID creates or replaces a user's calendar feed identifier.
+func (m *MemoryStore) SetCalendarFeedID(userID int, feedID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calendarFeeds[userID] = feedID
+	return nil
+}
+
+// CreatePasswordResetToken stores a new password reset token for a user.
+func (m *MemoryStore) CreatePasswordResetToken(userID int, tokenHash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return sql.ErrNoRows
+	}
+	token := &PasswordResetToken{
+		ID:        m.id(),
+		UserID:    userID,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	m.passwordResets[token.ID] = token
+	return nil
+}
+
+// ResetPassword uses a reset token to set a new password and invalidates the user's other tokens.
+func (m *MemoryStore) ResetPassword(tokenHash, password string) (int, error) {
+	hash, err := m.hashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var claimed *PasswordResetToken
+	for _, token := range m.passwordResets {
+		if token.TokenHash == tokenHash && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			claimed = token
+		}
+	}
+	if claimed == nil {
+		return 0, ErrInvalidResetToken
+	}
+
+	for _, token := range m.passwordResets {
+		if token.UserID == claimed.UserID && token.UsedAt == nil {
+			token.UsedAt = &now
+		}
+	}
+	user := m.users[claimed.UserID]
+	user.Password = hash
+	user.MustChangePassword = false
+	return user.ID, nil
+}
+
+// --- LoginAttemptStore ---
+
+// RecordLoginAttempt stores a login attempt.
+func (m *MemoryStore) RecordLoginAttempt(username, ip, outcome string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.loginAttempts = append(m.loginAttempts, &LoginAttempt{
+		ID:          m.id(),
+		Username:    username,
+		IPAddress:   ip,
+		Outcome:     outcome,
+		AttemptedAt: time.Now(),
+	})
+	return nil
+}
+
+// CountLoginFailures counts the failed logins of a username since its last success or unlock, and of an address.
+func (m *MemoryStore) CountLoginFailures(username, ip string, since time.Time) (*LoginFailures, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	f := &LoginFailures{}
+	for _, a := range m.loginAttempts {
+		if a.Username == username {
+			switch {
+			case a.Outcome == LoginSuccess || a.Outcome == LoginUnlocked:
+				f.Username, f.UsernameFirst, f.UsernameLast = 0, time.Time{}, time.Time{}
+			case a.Outcome == LoginFailure && !a.AttemptedAt.Before(since):
+				if f.Username == 0 {
+					f.UsernameFirst = a.AttemptedAt
+				}
+				f.Username++
+				f.UsernameLast = a.AttemptedAt
+			}
+		}
+		if a.IPAddress == ip && a.Outcome == LoginFailure && !a.AttemptedAt.Before(since) {
+			if f.IP == 0 {
+				f.IPFirst = a.AttemptedAt
+			}
+			f.IP++
+		}
+	}
+	return f, nil
+}
+
+// CountPasswordResetRequests counts the password reset requests for an email address and from an address.
+func (m *MemoryStore) CountPasswordResetRequests(email, ip string, since time.Time) (*LoginFailures, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	f := &LoginFailures{}
+	for _, a := range m.loginAttempts {
+		if a.Outcome != LoginReset || a.AttemptedAt.Before(since) {
+			continue
+		}
+		if a.Username == email {
+			if f.Username == 0 {
+				f.UsernameFirst = a.AttemptedAt
+			}
+			f.Username++
+			f.UsernameLast = a.AttemptedAt
+		}
+		if a.IPAddress == ip {
+			if f.IP == 0 {
+				f.IPFirst = a.AttemptedAt
+			}
+			f.IP++
+		}
+	}
+	return f, nil
+}
+
+// ListLoginAttempts retrieves a page of recorded login attempts.
+func (m *MemoryStore) ListLoginAttempts(params ListParams) (*ListResult[*LoginAttempt], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	attempts := make([]*LoginAttempt, len(m.loginAttempts))
+	for i, a := range m.loginAttempts {
+		copied := *a
+		attempts[i] = &copied
+	}
+
+	return listSlice(loginAttemptListSpec, params, attempts)
+}
+
+// SummarizeLoginFailures counts failed logins per address and per username.
+func (m *MemoryStore) SummarizeLoginFailures(since time.Time, limit int) (*LoginFailureSummary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	summary := &LoginFailureSummary{Since: since}
+	byIP := map[string]*LoginFailureCount{}
+	byUsername := map[string]*LoginFailureCount{}
+	count := func(counts map[string]*LoginFailureCount, key string, at time.Time) {
+		c, ok := counts[key]
+		if !ok {
+			c = &LoginFailureCount{Key: key}
+			counts[key] = c
+		}
+		c.Failures++
+		if at.After(c.LastFailure) {
+			c.LastFailure = at
+		}
+	}
+	for _, a := range m.loginAttempts {
+		if a.AttemptedAt.Before(since) {
+			continue
+		}
+		switch a.Outcome {
+		case LoginFailure:
+			summary.Failures++
+			count(byIP, a.IPAddress, a.AttemptedAt)
+			count(byUsername, a.Username, a.AttemptedAt)
+		case LoginBlocked:
+			summary.Blocked++
+		}
+	}
+
+	summary.ByIP = topLoginFailures(byIP, limit)
+	summary.ByUsername = topLoginFailures(byUsername, limit)
+	return summary, nil
+}
+
+// topLoginFailures orders failure counts by failures descending, then key, keeping at most limit.
+func topLoginFailures(counts map[string]*LoginFailureCount, limit int) []LoginFailureCount {
+	list := []LoginFailureCount{}
+	for _, c := range counts {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Failures != list[j].Failures {
+			return list[i].Failures > list[j].Failures
+		}
+		return list[i].Key < list[j].Key
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
+
+// PurgeLoginAttempts deletes login attempts older than a time.
+func (m *MemoryStore) PurgeLoginAttempts(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.loginAttempts[:0]
+	for _, a := range m.loginAttempts {
+		if !a.AttemptedAt.Before(before) {
+			kept = append(kept, a)
+		}
+	}
+	purged := int64(len(m.loginAttempts) - len(kept))
+	clear(m.loginAttempts[len(kept):])
+	m.loginAttempts = kept
+	return purged, nil
+}
+
+// --- MFAStore ---
+
+// mfaRecoveryCode is a stored recovery code
+type mfaRecoveryCode struct {
+	hash string
+	used bool
+}
+
+// GetMFA retrieves the two-factor authentication state of a user.
+func (m *MemoryStore) GetMFA(userID int) (*MFA, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	mfa, ok := m.mfa[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *mfa
+	for _, code := range m.recoveryCodes[userID] {
+		if !code.used {
+			copied.RecoveryCodesLeft++
+		}
+	}
+	return &copied, nil
+}
+
+// StartMFAEnrollment stores a new TOTP secret for a user, replacing the secret of a pending enrolment.
+func (m *MemoryStore) StartMFAEnrollment(userID int, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.mfa[userID]; ok && existing.Enabled {
+		return ErrMFAEnabled
+	}
+	m.mfa[userID] = &MFA{UserID: userID, Secret: secret, CreatedAt: time.Now()}
+	return nil
+}
+
+// ConfirmMFA enables a pending enrolment and stores the user's recovery codes.
+func (m *MemoryStore) ConfirmMFA(userID int, step int64, codeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mfa, ok := m.mfa[userID]
+	if !ok || mfa.Enabled {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	mfa.Enabled = true
+	mfa.ConfirmedAt = &now
+	mfa.LastStep = step
+	m.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+// UseMFAStep records the TOTP time step of an accepted code, refusing steps not newer than the last one.
+func (m *MemoryStore) UseMFAStep(userID int, step int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mfa, ok := m.mfa[userID]
+	if !ok || !mfa.Enabled || mfa.LastStep >= step {
+		return ErrInvalidMFACode
+	}
+	mfa.LastStep = step
+	return nil
+}
+
+// UseRecoveryCode marks a recovery code as used.
+func (m *MemoryStore) UseRecoveryCode(userID int, codeHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, code := range m.recoveryCodes[userID] {
+		if code.hash == codeHash && !code.used {
+			code.used = true
+			return nil
+		}
+	}
+	return ErrInvalidMFACode
+}
+
+// ReplaceRecoveryCodes discards a user's recovery codes and stores new ones.
+func (m *MemoryStore) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+// replaceRecoveryCodes swaps a user's recovery codes; the caller holds the lock.
+func (m *MemoryStore) replaceRecoveryCodes(userID int, codeHashes []string) {
+	codes := make([]*mfaRecoveryCode, len(codeHashes))
+	for i, hash := range codeHashes {
+		codes[i] = &mfaRecoveryCode{hash: hash}
+	}
+	m.recoveryCodes[userID] = codes
+}
+
+// DisableMFA removes a user's TOTP secret and recovery codes.
+func (m *MemoryStore) DisableMFA(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.mfa[userID]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(m.mfa, userID)
+	delete(m.recoveryCodes, userID)
+	return nil
+}
+
+// --- StudentStore ---
+
+// ListStudents retrieves a page of students.
+func (m *MemoryStore) ListStudents(params ListParams) (*ListResult[*Student], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var students []*Student
+	for _, student := range m.students {
+		copied := *student
+		students = append(students, &copied)
+	}
+
+	return listSlice(studentListSpec, params, students)
+}
+
+// EachStudent streams every student matching the filters and search of params.
+func (m *MemoryStore) EachStudent(params ListParams, fn func(*Student) error) error {
+	m.mu.RLock()
+	var students []*Student
+	for _, student := range m.students {
+		copied := *student
+		students = append(students, &copied)
+	}
+	m.mu.RUnlock()
+
+	return eachSlice(studentListSpec, params, students, fn)
+}
+
+// GetStudentByID retrieves a student by ID.
+func (m *MemoryStore) GetStudentByID(id int) (*Student, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	student, ok := m.students[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *student
+	return &copied, nil
+}
+
+// GetStudentByUserID retrieves the student record of a login account.
+func (m *MemoryStore) GetStudentByUserID(userID int) (*Student, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, student := range m.students {
+		if student.UserID == userID {
+			copied := *student
+			return &copied, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// CreateStudent creates a new student and corresponding user.
+func (m *MemoryStore) CreateStudent(req *StudentRequest) (*Student, error) {
+	hash, err := m.hashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userByUsername(req.Username) != nil {
+		return nil, ErrDuplicate
+	}
+	for _, student := range m.students {
+		if student.Email == req.Email {
+			return nil, ErrDuplicate
+		}
+	}
+
+	return m.insertStudent(req, hash), nil
+}
+
+// insertStudent adds a student and their user; callers must hold the write lock
+// and have checked that the username and email are free
+func (m *MemoryStore) insertStudent(req *StudentRequest, hash string) *Student {
+	now := time.Now()
+	user := &User{
+		ID:          m.id(),
+		Username:    req.Username,
+		Password:    hash,
+		Role:        "student",
+		Active:      true,
+		DateCreated: now,
+	}
+	m.users[user.ID] = user
+
+	student := &Student{
+		ID:        m.id(),
+		UserID:    user.ID,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Email:     req.Email,
+		Grade:     req.Grade,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Username:  req.Username,
+	}
+	m.students[student.ID] = student
+
+	copied := *student
+	return &copied
+}
+
+// ImportStudents validates a batch of students and, unless it is a dry run,
+// creates all of them. Nothing is written if any row is invalid.
+func (m *MemoryStore) ImportStudents(rows []StudentImportRow, dryRun bool) (*StudentImportResult, error) {
+	hashes := make([]string, len(rows))
+	if !dryRun {
+		for i, row := range rows {
+			var err error
+			if hashes[i], err = m.hashPassword(row.Password); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	takenUsernames := map[string]bool{}
+	for _, user := range m.users {
+		takenUsernames[user.Username] = true
+	}
+	takenEmails := map[string]bool{}
+	for _, student := range m.students {
+		takenEmails[student.Email] = true
+	}
+
+	result := validateStudentImport(rows, dryRun, takenUsernames, takenEmails)
+	if !result.Valid || dryRun {
+		return result, nil
+	}
+
+	for i := range rows {
+		result.Created = append(result.Created, m.insertStudent(&rows[i].StudentRequest, hashes[i]))
+	}
+	return result, nil
+}
+
+// UpdateStudent updates an existing student's information.
+func (m *MemoryStore) UpdateStudent(id int, req *StudentRequest) (*Student, error) {
+	var hash string
+	if req.Password != "" {
+		var err error
+		if hash, err = m.hashPassword(req.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	student, ok := m.students[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	for _, other := range m.students {
+		if other.ID != id && other.Email == req.Email {
+			return nil, ErrDuplicate
+		}
+	}
+
+	if hash != "" {
+		m.users[student.UserID].Password = hash
+	}
+
+	student.FirstName = req.FirstName
+	student.LastName = req.LastName
+	student.Email = req.Email
+	student.Grade = req.Grade
+	student.UpdatedAt = time.Now()
+
+	copied := *student
+	return &copied, nil
+}
+
+// DeleteStudent deletes a student and their user account.
+func (m *MemoryStore) DeleteStudent(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	student, ok := m.students[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	m.deleteUser(student.UserID)
+	return nil
+}
+
+// --- SubjectStore ---
+
+// sortSubjects orders subjects by grade and name
+func sortSubjects(subjects []*Subject) {
+	sort.Slice(subjects, func(i, j int) bool {
+		if subjects[i].Grade != subjects[j].Grade {
+			return subjects[i].Grade < subjects[j].Grade
+		}
+		return subjects[i].Name < subjects[j].Name
+	})
+}
+
+// copySubject returns a copy of a subject that shares no slices with the store
+func copySubject(subject *Subject) *Subject {
+	copied := *subject
+	copied.Levels = append([]string{}, subject.Levels...)
+	return &copied
+}
+
+// subjectNameTaken reports whether another subject of a grade has a name; callers must hold the lock
+func (m *MemoryStore) subjectNameTaken(grade, name string, exceptID int) bool {
+	for id, subject := range m.subjects {
+		if id != exceptID && subject.Grade == grade && subject.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAllSubjects retrieves all subjects ordered by grade and name.
+func (m *MemoryStore) GetAllSubjects(includeArchived bool) ([]*Subject, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var subjects []*Subject
+	for _, subject := range m.subjects {
+		if includeArchived || !subject.Archived {
+			subjects = append(subjects, copySubject(subject))
+		}
+	}
+	sortSubjects(subjects)
+
+	return subjects, nil
+}
+
+// EachSubject streams every subject ordered by grade and name.
+func (m *MemoryStore) EachSubject(includeArchived bool, fn func(*Subject) error) error {
+	subjects, err := m.GetAllSubjects(includeArchived)
+	if err != nil {
+		return err
+	}
+	for _, subject := range subjects {
+		if err := fn(subject); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListSubjects retrieves a page of subjects.
+func (m *MemoryStore) ListSubjects(params ListParams, includeArchived bool) (*ListResult[*Subject], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var subjects []*Subject
+	for _, subject := range m.subjects {
+		if includeArchived || !subject.Archived {
+			subjects = append(subjects, copySubject(subject))
+		}
+	}
+
+	return listSlice(subjectListSpec, params, subjects)
+}
+
+// GetSubjectByID retrieves a subject by ID, including archived subjects.
+func (m *MemoryStore) GetSubjectByID(id int) (*Subject, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	subject, ok := m.subjects[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copySubject(subject), nil
+}
+
+// CreateSubject adds a subject to the catalogue.
+func (m *MemoryStore) CreateSubject(req *SubjectRequest) (*Subject, error) {
+	if err := ValidateSubjectRequest(req); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.subjectNameTaken(req.Grade, req.Name, 0) {
+		return nil, ErrDuplicate
+	}
+
+	subject := &Subject{
+		ID:          m.id(),
+		Grade:       req.Grade,
+		Name:        req.Name,
+		Description: req.Description,
+		Group:       req.Group,
+		Levels:      append([]string{}, req.Levels...),
+		CreatedAt:   time.Now(),
+	}
+	m.subjects[subject.ID] = subject
+
+	return copySubject(subject), nil
+}
+
+// UpdateSubject replaces a subject's definition, including its archived flag.
+func (m *MemoryStore) UpdateSubject(id int, req *SubjectRequest) (*Subject, error) {
+	if err := ValidateSubjectRequest(req); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subject, ok := m.subjects[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if m.subjectNameTaken(req.Grade, req.Name, id) {
+		return nil, ErrDuplicate
+	}
+
+	subject.Grade = req.Grade
+	subject.Name = req.Name
+	subject.Description = req.Description
+	subject.Group = req.Group
+	subject.Levels = append([]string{}, req.Levels...)
+	subject.Archived = req.Archived
+
+	// Enrollments denormalise subject details
+	for _, enrollments := range m.enrollments {
+		if e, ok := enrollments[id]; ok {
+			e.SubjectName = subject.Name
+			e.Grade = subject.Grade
+			e.Group = subject.Group
+		}
+	}
+
+	return copySubject(subject), nil
+}
+
+// DeleteSubject deletes a subject that has never been used.
+func (m *MemoryStore) DeleteSubject(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.subjects[id]; !ok {
+		return sql.ErrNoRows
+	}
+	for _, enrollments := range m.enrollments {
+		if _, ok := enrollments[id]; ok {
+			return ErrSubjectInUse
+		}
+	}
+	for _, subjects := range m.teacherSubjects {
+		if _, ok := subjects[id]; ok {
+			return ErrSubjectInUse
+		}
+	}
+	for _, lesson := range m.lessons {
+		if lesson.SubjectID == id {
+			return ErrSubjectInUse
+		}
+	}
+	for _, assessment := range m.assessments {
+		if assessment.SubjectID == id {
+			return ErrSubjectInUse
+		}
+	}
+	for _, project := range m.projects {
+		if project.SubjectID == id {
+			return ErrSubjectInUse
+		}
+	}
+	for _, lesson := range m.timetableLessons {
+		if lesson.SubjectID == id {
+			return ErrSubjectInUse
+		}
+	}
+	for _, exam := range m.exams {
+		if exam.SubjectID == id {
+			return ErrSubjectInUse
+		}
+	}
+	for _, h := range m.homeworkAssignments {
+		if h.SubjectID == id {
+			return ErrSubjectInUse
+		}
+	}
+
+	delete(m.subjects, id)
+	delete(m.gradingSchemes, id)
+	for predictionID, predicted := range m.predictedGrades {
+		if predicted.SubjectID == id {
+			delete(m.predictedGrades, predictionID)
+		}
+	}
+	return nil
+}
+
+// --- TeacherStore ---
+
+// teacher builds a Teacher from a user and their profile; callers must hold the lock
+func (m *MemoryStore) teacher(user *User) *Teacher {
+	teacher := &Teacher{
+		ID:       user.ID,
+		Username: user.Username,
+		Active:   user.Active,
+		Subjects: m.teacherSubjectList(user.ID),
+	}
+	if profile, ok := m.teacherProfiles[user.ID]; ok {
+		teacher.FirstName = profile.FirstName
+		teacher.LastName = profile.LastName
+		teacher.Email = profile.Email
+	}
+	return teacher
+}
+
+// teacherEmailTaken reports whether another teacher uses an email; callers must hold the lock
+func (m *MemoryStore) teacherEmailTaken(email string, exceptID int) bool {
+	for id, profile := range m.teacherProfiles {
+		if id != exceptID && profile.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// teacherSubjectList returns the subjects of a teacher; callers must hold the lock
+func (m *MemoryStore) teacherSubjectList(teacherID int) []Subject {
+	var list []*Subject
+	for subjectID := range m.teacherSubjects[teacherID] {
+		if subject, ok := m.subjects[subjectID]; ok {
+			list = append(list, subject)
+		}
+	}
+	sortSubjects(list)
+
+	var subjects []Subject
+	for _, subject := range list {
+		subjects = append(subjects, *copySubject(subject))
+	}
+	return subjects
+}
+
+// ListTeachers retrieves a page of teachers with their subjects.
+func (m *MemoryStore) ListTeachers(params ListParams) (*ListResult[*Teacher], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var teachers []*Teacher
+	for _, user := range m.users {
+		if user.Role == "teacher" {
+			teachers = append(teachers, m.teacher(user))
+		}
+	}
+
+	return listSlice(teacherListSpec, params, teachers)
+}
+
+// EachTeacher streams every teacher matching the filters and search of params.
+func (m *MemoryStore) EachTeacher(params ListParams, fn func(*Teacher) error) error {
+	m.mu.RLock()
+	var teachers []*Teacher
+	for _, user := range m.users {
+		if user.Role == "teacher" {
+			teachers = append(teachers, m.teacher(user))
+		}
+	}
+	m.mu.RUnlock()
+
+	return eachSlice(teacherListSpec, params, teachers, fn)
+}
+
+// GetTeacherByID retrieves a teacher by ID with their subjects.
+func (m *MemoryStore) GetTeacherByID(id int) (*Teacher, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok || user.Role != "teacher" {
+		return nil, sql.ErrNoRows
+	}
+	return m.teacher(user), nil
+}
+
+// CreateTeacher creates a new teacher and corresponding user.
+func (m *MemoryStore) CreateTeacher(req *TeacherRequest) (*Teacher, error) {
+	hash, err := m.hashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userByUsername(req.Username) != nil || m.teacherEmailTaken(req.Email, 0) {
+		return nil, ErrDuplicate
+	}
+
+	user := &User{
+		ID:          m.id(),
+		Username:    req.Username,
+		Password:    hash,
+		Role:        RoleTeacher,
+		Active:      true,
+		DateCreated: time.Now(),
+	}
+	m.users[user.ID] = user
+	m.teacherProfiles[user.ID] = &Teacher{
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Email:     req.Email,
+	}
+
+	return m.teacher(user), nil
+}
+
+// UpdateTeacher updates an existing teacher's profile and optionally their password.
+func (m *MemoryStore) UpdateTeacher(id int, req *TeacherRequest) (*Teacher, error) {
+	var hash string
+	if req.Password != "" {
+		var err error
+		if hash, err = m.hashPassword(req.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok || user.Role != RoleTeacher {
+		return nil, sql.ErrNoRows
+	}
+	if m.teacherEmailTaken(req.Email, id) {
+		return nil, ErrDuplicate
+	}
+
+	if hash != "" {
+		user.Password = hash
+	}
+	m.teacherProfiles[id] = &Teacher{
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Email:     req.Email,
+	}
+
+	return m.teacher(user), nil
+}
+
+// SetTeacherActive activates or deactivates a teacher's login account.
+func (m *MemoryStore) SetTeacherActive(id int, active bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok || user.Role != RoleTeacher {
+		return sql.ErrNoRows
+	}
+	user.Active = active
+	return nil
+}
+
+// DeleteTeacher deletes a teacher and their user account.
+func (m *MemoryStore) DeleteTeacher(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok || user.Role != RoleTeacher {
+		return sql.ErrNoRows
+	}
+	m.deleteUser(id)
+	return nil
+}
+
+// GetTeacherSubjects retrieves all subjects taught by a specific teacher.
+func (m *MemoryStore) GetTeacherSubjects(teacherID int) ([]Subject, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.teacherSubjectList(teacherID), nil
+}
+
+// AssignSubjectToTeacher assigns a subject to a teacher.
+func (m *MemoryStore) AssignSubjectToTeacher(teacherID, subjectID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[teacherID]
+	if !ok || user.Role != "teacher" {
+		return sql.ErrNoRows
+	}
+	subject, ok := m.subjects[subjectID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if subject.Archived {
+		return ErrSubjectArchived
+	}
+
+	if m.teacherSubjects[teacherID] == nil {
+		m.teacherSubjects[teacherID] = make(map[int]time.Time)
+	}
+	if _, ok := m.teacherSubjects[teacherID][subjectID]; !ok {
+		m.teacherSubjects[teacherID][subjectID] = time.Now()
+	}
+	return nil
+}
+
+// teaches reports whether a teacher is assigned to a subject; callers must hold the lock
+func (m *MemoryStore) teaches(teacherID, subjectID int) bool {
+	_, ok := m.teacherSubjects[teacherID][subjectID]
+	return ok
+}
+
+// RemoveSubjectFromTeacher removes a subject assignment from a teacher.
+func (m *MemoryStore) RemoveSubjectFromTeacher(teacherID, subjectID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.teacherSubjects[teacherID], subjectID)
+	return nil
+}
+
+// --- EnrollmentStore ---
+
+// studentEnrollments returns a student's enrollments ordered by group and
+// subject name; callers must hold the lock
+func (m *MemoryStore) studentEnrollments(studentID int) []*Enrollment {
+	enrollments := []*Enrollment{}
+	for _, e := range m.enrollments[studentID] {
+		copied := *e
+		enrollments = append(enrollments, &copied)
+	}
+	sort.Slice(enrollments, func(i, j int) bool {
+		if enrollments[i].Group != enrollments[j].Group {
+			return enrollments[i].Group < enrollments[j].Group
+		}
+		return enrollments[i].SubjectName < enrollments[j].SubjectName
+	})
+	return enrollments
+}
+
+// GetStudentEnrollments retrieves the subjects a student is enrolled in.
+func (m *MemoryStore) GetStudentEnrollments(studentID int) ([]*Enrollment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.studentEnrollments(studentID), nil
+}
+
+// EnrollStudent enrolls a student in a subject after validating the IB diploma rules and the student's timetable.
+func (m *MemoryStore) EnrollStudent(studentID int, req *EnrollmentRequest) (*Enrollment, []TimetableConflict, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	student, ok := m.students[studentID]
+	if !ok {
+		return nil, nil, sql.ErrNoRows
+	}
+	subject, ok := m.subjects[req.SubjectID]
+	if !ok {
+		return nil, nil, sql.ErrNoRows
+	}
+	if _, ok := m.enrollments[studentID][subject.ID]; ok {
+		return nil, nil, ErrDuplicate
+	}
+
+	if err := ValidateEnrollment(student, subject, req.Level, m.studentEnrollments(studentID)); err != nil {
+		return nil, nil, err
+	}
+
+	lessons := m.filterTimetableLessons(func(l *TimetableLesson) bool { return l.SubjectID == subject.ID })
+	attended := m.filterTimetableLessons(func(l *TimetableLesson) bool {
+		_, ok := m.enrollments[studentID][l.SubjectID]
+		return ok
+	})
+	if conflicts := DetectEnrollmentConflicts(studentID, lessons, attended); len(conflicts) > 0 {
+		return nil, conflicts, nil
+	}
+
+	enrollment := &Enrollment{
+		StudentID:   studentID,
+		SubjectID:   subject.ID,
+		SubjectName: subject.Name,
+		Grade:       subject.Grade,
+		Group:       subject.Group,
+		Level:       req.Level,
+		CreatedAt:   time.Now(),
+	}
+	if m.enrollments[studentID] == nil {
+		m.enrollments[studentID] = make(map[int]*Enrollment)
+	}
+	m.enrollments[studentID][subject.ID] = enrollment
+
+	copied := *enrollment
+	return &copied, nil, nil
+}
+
+// UnenrollStudent removes a student from a subject.
+func (m *MemoryStore) UnenrollStudent(studentID, subjectID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.enrollments[studentID][subjectID]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(m.enrollments[studentID], subjectID)
+	return nil
+}
+
+// --- AttendanceStore ---
+
+// recordAttendance checks the teacher's assignment and the entries, then
+// writes the entries of a lesson; callers must hold the write lock
+func (m *MemoryStore) recordAttendance(lesson *Lesson, teacherID int, entries []AttendanceEntry) error {
+	if !m.teaches(teacherID, lesson.SubjectID) {
+		return ErrNotTeaching
+	}
+
+	enrolled := make(map[int]bool, len(entries))
+	for _, e := range entries {
+		if _, ok := m.enrollments[e.StudentID][lesson.SubjectID]; ok {
+			enrolled[e.StudentID] = true
+		}
+	}
+	if err := ValidateAttendance(entries, enrolled); err != nil {
+		return err
+	}
+
+	if m.attendance[lesson.ID] == nil {
+		m.attendance[lesson.ID] = make(map[int]*AttendanceRecord)
+	}
+	for _, e := range entries {
+		m.attendance[lesson.ID][e.StudentID] = &AttendanceRecord{
+			StudentID:  e.StudentID,
+			Status:     e.Status,
+			Note:       e.Note,
+			RecordedBy: teacherID,
+			RecordedAt: time.Now(),
+		}
+	}
+	return nil
+}
+
+// lesson returns a copy of a lesson with its records ordered by student
+// name; callers must hold the lock
+func (m *MemoryStore) lesson(stored *Lesson) *Lesson {
+	lesson := *stored
+	lesson.SubjectName = m.subjects[lesson.SubjectID].Name
+	lesson.Records = []*AttendanceRecord{}
+	for _, record := range m.attendance[lesson.ID] {
+		copied := *record
+		student := m.students[record.StudentID]
+		copied.StudentName = student.FirstName + " " + student.LastName
+		lesson.Records = append(lesson.Records, &copied)
+	}
+	sort.Slice(lesson.Records, func(i, j int) bool {
+		return m.studentLess(lesson.Records[i].StudentID, lesson.Records[j].StudentID)
+	})
+	return &lesson
+}
+
+// CreateLesson creates a lesson and records the attendance of its students.
+func (m *MemoryStore) CreateLesson(teacherID int, req *LessonRequest) (*Lesson, error) {
+	date, err := ParseLessonDate(req.Date)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subject, ok := m.subjects[req.SubjectID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if subject.Archived {
+		return nil, ErrSubjectArchived
+	}
+
+	lesson := &Lesson{
+		ID:        m.id(),
+		SubjectID: subject.ID,
+		TeacherID: teacherID,
+		Date:      date,
+		Topic:     strings.TrimSpace(req.Topic),
+		CreatedAt: time.Now(),
+	}
+	if err := m.recordAttendance(lesson, teacherID, req.Records); err != nil {
+		return nil, err
+	}
+	m.lessons[lesson.ID] = lesson
+
+	return m.lesson(lesson), nil
+}
+
+// RecordAttendance adds or corrects attendance records of a lesson.
+func (m *MemoryStore) RecordAttendance(lessonID, teacherID int, entries []AttendanceEntry) (*Lesson, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lesson, ok := m.lessons[lessonID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if err := m.recordAttendance(lesson, teacherID, entries); err != nil {
+		return nil, err
+	}
+	return m.lesson(lesson), nil
+}
+
+// GetLesson retrieves a lesson with its attendance records.
+func (m *MemoryStore) GetLesson(id int) (*Lesson, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	lesson, ok := m.lessons[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return m.lesson(lesson), nil
+}
+
+// GetSubjectLessons retrieves the lessons of a subject without their records.
+func (m *MemoryStore) GetSubjectLessons(subjectID int, period AttendancePeriod) ([]*Lesson, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	lessons := []*Lesson{}
+	for _, lesson := range m.lessons {
+		if lesson.SubjectID == subjectID && period.contains(lesson.Date) {
+			copied := *lesson
+			copied.SubjectName = m.subjects[subjectID].Name
+			lessons = append(lessons, &copied)
+		}
+	}
+	sort.Slice(lessons, func(i, j int) bool {
+		if !lessons[i].Date.Equal(lessons[j].Date) {
+			return lessons[i].Date.After(lessons[j].Date)
+		}
+		return lessons[i].ID > lessons[j].ID
+	})
+	return lessons, nil
+}
+
+// attendanceSummaries counts the records of lessons within a period that
+// match a filter, grouped by a key; callers must hold the lock
+func (m *MemoryStore) attendanceSummaries(
+	period AttendancePeriod,
+	match func(lesson *Lesson, studentID int) bool,
+	key func(lesson *Lesson, student *Student) AttendanceSummary,
+) []*AttendanceSummary {
+	groups := map[AttendanceSummary]*AttendanceSummary{}
+	for lessonID, records := range m.attendance {
+		lesson := m.lessons[lessonID]
+		if !period.contains(lesson.Date) {
+			continue
+		}
+		for studentID, record := range records {
+			if !match(lesson, studentID) {
+				continue
+			}
+			k := key(lesson, m.students[studentID])
+			summary, ok := groups[k]
+			if !ok {
+				copied := k
+				summary = &copied
+				groups[k] = summary
+			}
+			summary.add(record.Status)
+		}
+	}
+
+	summaries := make([]*AttendanceSummary, 0, len(groups))
+	for _, summary := range groups {
+		summary.finish()
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// studentSummaryKey groups attendance by student
+func studentSummaryKey(_ *Lesson, student *Student) AttendanceSummary {
+	return AttendanceSummary{
+		StudentID:   student.ID,
+		StudentName: student.FirstName + " " + student.LastName,
+		Grade:       student.Grade,
+	}
+}
+
+// GetStudentAttendance summarizes a student's attendance per subject.
+func (m *MemoryStore) GetStudentAttendance(studentID int, period AttendancePeriod) ([]*AttendanceSummary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	summaries := m.attendanceSummaries(period,
+		func(_ *Lesson, id int) bool { return id == studentID },
+		func(lesson *Lesson, _ *Student) AttendanceSummary {
+			return AttendanceSummary{SubjectID: lesson.SubjectID, SubjectName: m.subjects[lesson.SubjectID].Name}
+		},
+	)
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := m.subjects[summaries[i].SubjectID], m.subjects[summaries[j].SubjectID]
+		if a.Grade != b.Grade {
+			return a.Grade < b.Grade
+		}
+		return a.Name < b.Name
+	})
+	return summaries, nil
+}
+
+// GetSubjectAttendance summarizes attendance in a subject per student.
+func (m *MemoryStore) GetSubjectAttendance(subjectID int, period AttendancePeriod) ([]*AttendanceSummary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	summaries := m.attendanceSummaries(period,
+		func(lesson *Lesson, _ int) bool { return lesson.SubjectID == subjectID },
+		studentSummaryKey,
+	)
+	m.sortSummariesByStudent(summaries)
+	return summaries, nil
+}
+
+// GetLowAttendance lists students whose attendance over all subjects is below a threshold.
+func (m *MemoryStore) GetLowAttendance(threshold float64, period AttendancePeriod) ([]*AttendanceSummary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	summaries := m.attendanceSummaries(period,
+		func(*Lesson, int) bool { return true },
+		studentSummaryKey,
+	)
+	m.sortSummariesByStudent(summaries)
+	return belowThreshold(summaries, threshold), nil
+}
+
+// sortSummariesByStudent orders summaries by student name; callers must hold the lock
+func (m *MemoryStore) sortSummariesByStudent(summaries []*AttendanceSummary) {
+	sort.Slice(summaries, func(i, j int) bool {
+		return m.studentLess(summaries[i].StudentID, summaries[j].StudentID)
+	})
+}
+
+// studentLess orders students by last name, first name and ID; callers must hold the lock
+func (m *MemoryStore) studentLess(aID, bID int) bool {
+	a, b := m.students[aID], m.students[bID]
+	if a.LastName != b.LastName {
+		return a.LastName < b.LastName
+	}
+	if a.FirstName != b.FirstName {
+		return a.FirstName < b.FirstName
+	}
+	return a.ID < b.ID
+}
+
+// --- GradebookStore ---
+
+// gradingScheme returns a copy of a subject's grading scheme; callers must hold the lock
+func (m *MemoryStore) gradingScheme(subjectID int) *GradingScheme {
+	scheme := &GradingScheme{SubjectID: subjectID, Categories: []AssessmentCategory{}}
+	stored, ok := m.gradingSchemes[subjectID]
+	if ok {
+		scheme.Categories = append(scheme.Categories, stored.Categories...)
+	}
+	if ok && stored.Boundaries != nil {
+		scheme.Boundaries = append([]float64{}, stored.Boundaries...)
+	} else {
+		scheme.Boundaries = append([]float64{}, DefaultGradeBoundaries...)
+		scheme.DefaultBoundaries = true
+	}
+	return scheme
+}
+
+// subjectAssessments returns copies of a subject's assessments without their
+// scores, oldest first; callers must hold the lock
+func (m *MemoryStore) subjectAssessments(subjectID int) []*Assessment {
+	assessments := []*Assessment{}
+	for _, assessment := range m.assessments {
+		if assessment.SubjectID == subjectID {
+			copied := *assessment
+			assessments = append(assessments, &copied)
+		}
+	}
+	sort.Slice(assessments, func(i, j int) bool {
+		if !assessments[i].Date.Equal(assessments[j].Date) {
+			return assessments[i].Date.Before(assessments[j].Date)
+		}
+		return assessments[i].ID < assessments[j].ID
+	})
+	return assessments
+}
+
+// assessment returns a copy of an assessment with its scores ordered by
+// student name; callers must hold the lock
+func (m *MemoryStore) assessment(stored *Assessment) *Assessment {
+	assessment := *stored
+	assessment.Scores = []*AssessmentScore{}
+	for _, score := range m.scores[assessment.ID] {
+		copied := *score
+		student := m.students[score.StudentID]
+		copied.StudentName = student.FirstName + " " + student.LastName
+		assessment.Scores = append(assessment.Scores, &copied)
+	}
+	sort.Slice(assessment.Scores, func(i, j int) bool {
+		return m.studentLess(assessment.Scores[i].StudentID, assessment.Scores[j].StudentID)
+	})
+	return &assessment
+}
+
+// studentMarks returns a student's marks in the given assessments; callers must hold the lock
+func (m *MemoryStore) studentMarks(studentID int, assessments []*Assessment) map[int]float64 {
+	marks := map[int]float64{}
+	for _, assessment := range assessments {
+		if score, ok := m.scores[assessment.ID][studentID]; ok {
+			marks[assessment.ID] = score.Mark
+		}
+	}
+	return marks
+}
+
+// predictionHistory returns copies of a student's predicted grades in a
+// subject, newest first; callers must hold the lock
+func (m *MemoryStore) predictionHistory(subjectID, studentID int) []*PredictedGrade {
+	history := []*PredictedGrade{}
+	for _, predicted := range m.predictedGrades {
+		if predicted.SubjectID == subjectID && predicted.StudentID == studentID {
+			copied := *predicted
+			history = append(history, &copied)
+		}
+	}
+	sort.Slice(history, func(i, j int) bool {
+		if !history[i].CreatedAt.Equal(history[j].CreatedAt) {
+			return history[i].CreatedAt.After(history[j].CreatedAt)
+		}
+		return history[i].ID > history[j].ID
+	})
+	return history
+}
+
+// GetGradingScheme retrieves a subject's grading scheme.
+func (m *MemoryStore) GetGradingScheme(subjectID int) (*GradingScheme, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.subjects[subjectID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	return m.gradingScheme(subjectID), nil
+}
+
+// SetGradingScheme replaces a subject's assessment categories and grade boundaries.
+func (m *MemoryStore) SetGradingScheme(subjectID, teacherID int, req *GradingSchemeRequest) (*GradingScheme, error) {
+	if err := ValidateGradingScheme(req); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.subjects[subjectID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	if !m.teaches(teacherID, subjectID) {
+		return nil, ErrNotTeaching
+	}
+
+	kept := make(map[string]bool, len(req.Categories))
+	for _, c := range req.Categories {
+		kept[c.Name] = true
+	}
+	used := map[string]bool{}
+	for _, assessment := range m.assessments {
+		if assessment.SubjectID == subjectID && !kept[assessment.Category] {
+			used[assessment.Category] = true
+		}
+	}
+	if len(used) > 0 {
+		names := make([]string, 0, len(used))
+		for name := range used {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("%w: %s", ErrCategoryInUse, strings.Join(names, ", "))
+	}
+
+	scheme := &GradingScheme{SubjectID: subjectID, Categories: append([]AssessmentCategory{}, req.Categories...)}
+	if req.Boundaries != nil {
+		scheme.Boundaries = append([]float64{}, req.Boundaries...)
+	}
+	m.gradingSchemes[subjectID] = scheme
+	return m.gradingScheme(subjectID), nil
+}
+
+// CreateAssessment adds an assessment to a subject.
+func (m *MemoryStore) CreateAssessment(subjectID, teacherID int, req *AssessmentRequest) (*Assessment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.subjects[subjectID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	if !m.teaches(teacherID, subjectID) {
+		return nil, ErrNotTeaching
+	}
+	date, err := ValidateAssessment(req, m.gradingScheme(subjectID))
+	if err != nil {
+		return nil, err
+	}
+
+	assessment := &Assessment{
+		ID:        m.id(),
+		SubjectID: subjectID,
+		Category:  req.Category,
+		Name:      req.Name,
+		Weight:    req.Weight,
+		MaxMark:   req.MaxMark,
+		Date:      date,
+		CreatedBy: teacherID,
+		CreatedAt: time.Now(),
+	}
+	m.assessments[assessment.ID] = assessment
+
+	copied := *assessment
+	return &copied, nil
+}
+
+// UpdateAssessment changes an assessment.
+func (m *MemoryStore) UpdateAssessment(id, teacherID int, req *AssessmentRequest) (*Assessment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	assessment, ok := m.assessments[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if !m.teaches(teacherID, assessment.SubjectID) {
+		return nil, ErrNotTeaching
+	}
+	date, err := ValidateAssessment(req, m.gradingScheme(assessment.SubjectID))
+	if err != nil {
+		return nil, err
+	}
+	for _, score := range m.scores[id] {
+		if score.Mark > req.MaxMark {
+			return nil, fmt.Errorf("%w: max_mark is below the recorded mark of %g", ErrInvalidGradebook, score.Mark)
+		}
+	}
+
+	assessment.Category = req.Category
+	assessment.Name = req.Name
+	assessment.Weight = req.Weight
+	assessment.MaxMark = req.MaxMark
+	assessment.Date = date
+	return m.assessment(assessment), nil
+}
+
+// DeleteAssessment deletes an assessment and its marks.
+func (m *MemoryStore) DeleteAssessment(id, teacherID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	assessment, ok := m.assessments[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if !m.teaches(teacherID, assessment.SubjectID) {
+		return ErrNotTeaching
+	}
+	delete(m.assessments, id)
+	delete(m.scores, id)
+	return nil
+}
+
+// GetAssessment retrieves an assessment with its marks.
+func (m *MemoryStore) GetAssessment(id int) (*Assessment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	assessment, ok := m.assessments[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return m.assessment(assessment), nil
+}
+
+// GetSubjectAssessments retrieves the assessments of a subject without their marks.
+func (m *MemoryStore) GetSubjectAssessments(subjectID int) ([]*Assessment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.subjectAssessments(subjectID), nil
+}
+
+// RecordScores adds or corrects marks of an assessment.
+func (m *MemoryStore) RecordScores(assessmentID, teacherID int, entries []ScoreEntry) (*Assessment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	assessment, ok := m.assessments[assessmentID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if !m.teaches(teacherID, assessment.SubjectID) {
+		return nil, ErrNotTeaching
+	}
+
+	enrolled := make(map[int]bool, len(entries))
+	for _, e := range entries {
+		if _, ok := m.enrollments[e.StudentID][assessment.SubjectID]; ok {
+			enrolled[e.StudentID] = true
+		}
+	}
+	if err := ValidateScores(entries, assessment.MaxMark, enrolled); err != nil {
+		return nil, err
+	}
+
+	if m.scores[assessmentID] == nil {
+		m.scores[assessmentID] = make(map[int]*AssessmentScore)
+	}
+	for _, e := range entries {
+		m.scores[assessmentID][e.StudentID] = &AssessmentScore{
+			StudentID:  e.StudentID,
+			Mark:       e.Mark,
+			RecordedBy: teacherID,
+			RecordedAt: time.Now(),
+		}
+	}
+	return m.assessment(assessment), nil
+}
+
+// GetSubjectGrades works out the current grade of every student enrolled in a subject.
+func (m *MemoryStore) GetSubjectGrades(subjectID int) ([]*StudentGrade, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.subjects[subjectID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	scheme := m.gradingScheme(subjectID)
+	assessments := m.subjectAssessments(subjectID)
+
+	grades := []*StudentGrade{}
+	for studentID, enrollments := range m.enrollments {
+		if _, ok := enrollments[subjectID]; !ok {
+			continue
+		}
+		grade := ComputeGrade(scheme, assessments, m.studentMarks(studentID, assessments))
+		student := m.students[studentID]
+		grade.StudentID = studentID
+		grade.StudentName = student.FirstName + " " + student.LastName
+		if history := m.predictionHistory(subjectID, studentID); len(history) > 0 {
+			grade.Predicted = history[0]
+		}
+		grades = append(grades, &grade)
+	}
+	sort.Slice(grades, func(i, j int) bool {
+		return m.studentLess(grades[i].StudentID, grades[j].StudentID)
+	})
+	return grades, nil
+}
+
+// GetStudentGradebook retrieves a student's marks, current grade and predicted grades in a subject.
+func (m *MemoryStore) GetStudentGradebook(subjectID, studentID int) (*StudentGradebook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.enrollments[studentID][subjectID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	student := m.students[studentID]
+	assessments := m.subjectAssessments(subjectID)
+	return buildStudentGradebook(
+		studentID,
+		student.FirstName+" "+student.LastName,
+		m.gradingScheme(subjectID),
+		assessments,
+		m.studentMarks(studentID, assessments),
+		m.predictionHistory(subjectID, studentID),
+	), nil
+}
+
+// AddPredictedGrade records a new predicted grade, keeping earlier ones as history.
+func (m *MemoryStore) AddPredictedGrade(subjectID, studentID, teacherID int, req *PredictedGradeRequest) (*PredictedGrade, error) {
+	if err := ValidatePredictedGrade(req); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.teaches(teacherID, subjectID) {
+		return nil, ErrNotTeaching
+	}
+	if _, ok := m.enrollments[studentID][subjectID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	predicted := &PredictedGrade{
+		ID:        m.id(),
+		SubjectID: subjectID,
+		StudentID: studentID,
+		Grade:     req.Grade,
+		Comment:   req.Comment,
+		TeacherID: teacherID,
+		CreatedAt: time.Now(),
+	}
+	m.predictedGrades[predicted.ID] = predicted
+
+	copied := *predicted
+	return &copied, nil
+}
+
+// --- DiplomaStore ---
+
+// GetDiplomaCore retrieves a student's TOK, EE and CAS results.
+func (m *MemoryStore) GetDiplomaCore(studentID int) (*DiplomaCore, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.students[studentID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	core, ok := m.diplomaCore[studentID]
+	if !ok {
+		return &DiplomaCore{StudentID: studentID}, nil
+	}
+	return copyDiplomaCore(core), nil
+}
+
+// SetDiplomaCore records a student's TOK, EE and CAS results.
+func (m *MemoryStore) SetDiplomaCore(studentID, userID int, req *DiplomaCoreRequest) (*DiplomaCore, error) {
+	if err := ValidateDiplomaCore(req); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.students[studentID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	core := &DiplomaCore{
+		StudentID: studentID,
+		TOK:       req.TOK,
+		EE:        req.EE,
+		UpdatedBy: userID,
+		UpdatedAt: time.Now(),
+	}
+	if req.CASComplete != nil {
+		complete := *req.CASComplete
+		core.CASComplete = &complete
+	}
+	m.diplomaCore[studentID] = core
+	return copyDiplomaCore(core), nil
+}
+
+// copyDiplomaCore returns a copy of core results that shares no pointers with the store
+func copyDiplomaCore(core *DiplomaCore) *DiplomaCore {
+	copied := *core
+	if core.CASComplete != nil {
+		complete := *core.CASComplete
+		copied.CASComplete = &complete
+	}
+	return &copied
+}
+
+// --- CASStore ---
+
+// casActivity returns a copy of an activity with student and supervisor
+// names; callers must hold the lock
+func (m *MemoryStore) casActivity(stored *CASActivity) *CASActivity {
+	activity := *stored
+	activity.Strands = append([]string{}, stored.Strands...)
+	activity.Outcomes = append([]int{}, stored.Outcomes...)
+	student := m.students[activity.StudentID]
+	activity.StudentName = student.FirstName + " " + student.LastName
+	if user, ok := m.users[activity.SupervisorID]; ok {
+		activity.SupervisorName = user.Username
+		if profile, ok := m.teacherProfiles[user.ID]; ok {
+			activity.SupervisorName = profile.FirstName + " " + profile.LastName
+		}
+	}
+	return &activity
+}
+
+// filterCASActivities returns copies of the activities matching a filter, most
+// recent first; callers must hold the lock
+func (m *MemoryStore) filterCASActivities(match func(*CASActivity) bool) []*CASActivity {
+	activities := []*CASActivity{}
+	for _, activity := range m.casActivities {
+		if match(activity) {
+			activities = append(activities, m.casActivity(activity))
+		}
+	}
+	sort.Slice(activities, func(i, j int) bool {
+		if !activities[i].StartDate.Equal(activities[j].StartDate) {
+			return activities[i].StartDate.After(activities[j].StartDate)
+		}
+		return activities[i].ID > activities[j].ID
+	})
+	return activities
+}
+
+// requireSupervisor checks that a user is an active teacher, wrapping invalid
+// when not; callers must hold the lock
+func (m *MemoryStore) requireSupervisor(userID int, invalid error) error {
+	user, ok := m.users[userID]
+	if !ok || user.Role != RoleTeacher || !user.Active {
+		return fmt.Errorf("%w: supervisor must be an active teacher", invalid)
+	}
+	return nil
+}
+
+// GetCASActivity retrieves a CAS activity.
+func (m *MemoryStore) GetCASActivity(id int) (*CASActivity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	activity, ok := m.casActivities[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return m.casActivity(activity), nil
+}
+
+// GetStudentCASActivities retrieves a student's CAS activities.
+func (m *MemoryStore) GetStudentCASActivities(studentID int) ([]*CASActivity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.filterCASActivities(func(a *CASActivity) bool { return a.StudentID == studentID }), nil
+}
+
+// GetSupervisedCASActivities retrieves the CAS activities a teacher supervises.
+func (m *MemoryStore) GetSupervisedCASActivities(supervisorID int, status string) ([]*CASActivity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.filterCASActivities(func(a *CASActivity) bool {
+		return a.SupervisorID == supervisorID && (status == "" || a.Status == status)
+	}), nil
+}
+
+// CreateCASActivity logs a CAS activity for a student, pending review.
+func (m *MemoryStore) CreateCASActivity(studentID int, req *CASActivityRequest) (*CASActivity, error) {
+	start, end, err := ValidateCASActivity(req)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.students[studentID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	if err := m.requireSupervisor(req.SupervisorID, ErrInvalidCAS); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	activity := &CASActivity{
+		ID:           m.id(),
+		StudentID:    studentID,
+		SupervisorID: req.SupervisorID,
+		Title:        req.Title,
+		Strands:      append([]string{}, req.Strands...),
+		Hours:        req.Hours,
+		StartDate:    start,
+		EndDate:      end,
+		Reflection:   req.Reflection,
+		Evidence:     req.Evidence,
+		Outcomes:     append([]int{}, req.Outcomes...),
+		Status:       CASPending,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	m.casActivities[activity.ID] = activity
+	return m.casActivity(activity), nil
+}
+
+// UpdateCASActivity edits a student's own activity and resubmits it for review.
+func (m *MemoryStore) UpdateCASActivity(id, studentID int, req *CASActivityRequest) (*CASActivity, error) {
+	start, end, err := ValidateCASActivity(req)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	activity, ok := m.casActivities[id]
+	if !ok || activity.StudentID != studentID {
+		return nil, sql.ErrNoRows
+	}
+	if activity.Status == CASApproved {
+		return nil, ErrCASApproved
+	}
+	if err := m.requireSupervisor(req.SupervisorID, ErrInvalidCAS); err != nil {
+		return nil, err
+	}
+
+	activity.SupervisorID = req.SupervisorID
+	activity.Title = req.Title
+	activity.Strands = append([]string{}, req.Strands...)
+	activity.Hours = req.Hours
+	activity.StartDate = start
+	activity.EndDate = end
+	activity.Reflection = req.Reflection
+	activity.Evidence = req.Evidence
+	activity.Outcomes = append([]int{}, req.Outcomes...)
+	activity.Status = CASPending
+	activity.ReviewComment = ""
+	activity.ReviewedAt = nil
+	activity.UpdatedAt = time.Now()
+	return m.casActivity(activity), nil
+}
+
+// DeleteCASActivity deletes a student's own activity unless it is approved.
+func (m *MemoryStore) DeleteCASActivity(id, studentID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	activity, ok := m.casActivities[id]
+	if !ok || activity.StudentID != studentID {
+		return sql.ErrNoRows
+	}
+	if activity.Status == CASApproved {
+		return ErrCASApproved
+	}
+	delete(m.casActivities, id)
+	return nil
+}
+
+// ReviewCASActivity approves or rejects a pending activity.
+func (m *MemoryStore) ReviewCASActivity(id, supervisorID int, req *CASReviewRequest) (*CASActivity, error) {
+	if err := ValidateCASReview(req); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	activity, ok := m.casActivities[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if activity.SupervisorID != supervisorID {
+		return nil, ErrNotSupervisor
+	}
+	if activity.Status != CASPending {
+		return nil, ErrCASReviewed
+	}
+
+	now := time.Now()
+	activity.Status = req.Status
+	activity.ReviewComment = req.Comment
+	activity.ReviewedAt = &now
+	return m.casActivity(activity), nil
+}
+
+// --- ProjectStore ---
+
+// project returns a copy of a project with names, milestones and draft
+// counts; callers must hold the lock
+func (m *MemoryStore) project(stored *Project) *Project {
+	p := *stored
+	student := m.students[p.StudentID]
+	p.StudentName = student.FirstName + " " + student.LastName
+	p.Grade = student.Grade
+	p.SubjectName = m.subjects[p.SubjectID].Name
+	p.SupervisorName = ""
+	if user, ok := m.users[p.SupervisorID]; ok {
+		p.SupervisorName = user.Username
+		if profile, ok := m.teacherProfiles[user.ID]; ok {
+			p.SupervisorName = profile.FirstName + " " + profile.LastName
+		}
+	}
+
+	p.Milestones = []*ProjectMilestone{}
+	for _, milestone := range m.milestones {
+		if milestone.ProjectID == p.ID {
+			copied := *milestone
+			p.Milestones = append(p.Milestones, &copied)
+		}
+	}
+	sort.Slice(p.Milestones, func(i, j int) bool {
+		if !p.Milestones[i].DueDate.Equal(p.Milestones[j].DueDate) {
+			return p.Milestones[i].DueDate.Before(p.Milestones[j].DueDate)
+		}
+		return p.Milestones[i].ID < p.Milestones[j].ID
+	})
+
+	p.DraftCount, p.LastDraftAt = 0, nil
+	for _, draft := range m.projectDrafts {
+		if draft.ProjectID == p.ID {
+			p.DraftCount++
+			if p.LastDraftAt == nil || draft.UploadedAt.After(*p.LastDraftAt) {
+				uploaded := draft.UploadedAt
+				p.LastDraftAt = &uploaded
+			}
+		}
+	}
+	return &p
+}
+
+// filterProjects returns copies of the projects matching a filter, ordered by
+// student name; callers must hold the lock
+func (m *MemoryStore) filterProjects(match func(*Project) bool) []*Project {
+	projects := []*Project{}
+	for _, stored := range m.projects {
+		if match(stored) {
+			projects = append(projects, m.project(stored))
+		}
+	}
+	sort.Slice(projects, func(i, j int) bool {
+		a, b := m.students[projects[i].StudentID], m.students[projects[j].StudentID]
+		if a.LastName != b.LastName {
+			return a.LastName < b.LastName
+		}
+		if a.FirstName != b.FirstName {
+			return a.FirstName < b.FirstName
+		}
+		if projects[i].Kind != projects[j].Kind {
+			return projects[i].Kind < projects[j].Kind
+		}
+		return projects[i].SubjectName < projects[j].SubjectName
+	})
+	return projects
+}
+
+// deleteProject removes a project with its milestones, drafts and comments;
+// callers must hold the write lock
+func (m *MemoryStore) deleteProject(id int) {
+	delete(m.projects, id)
+	for milestoneID, milestone := range m.milestones {
+		if milestone.ProjectID == id {
+			delete(m.milestones, milestoneID)
+		}
+	}
+	for draftID, draft := range m.projectDrafts {
+		if draft.ProjectID == id {
+			delete(m.projectDrafts, draftID)
+		}
+	}
+	for commentID, comment := range m.projectComments {
+		if comment.ProjectID == id {
+			delete(m.projectComments, commentID)
+		}
+	}
+}
+
+// GetProject retrieves a project with its milestones.
+func (m *MemoryStore) GetProject(id int) (*Project, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.projects[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return m.project(stored), nil
+}
+
+// GetStudentProjects retrieves a student's EE and IAs.
+func (m *MemoryStore) GetStudentProjects(studentID int) ([]*Project, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.filterProjects(func(p *Project) bool { return p.StudentID == studentID }), nil
+}
+
+// GetSupervisedProjects retrieves the projects a teacher supervises.
+func (m *MemoryStore) GetSupervisedProjects(supervisorID int) ([]*Project, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.filterProjects(func(p *Project) bool { return p.SupervisorID == supervisorID }), nil
+}
+
+// GetGradeProjects retrieves the projects of the students in a grade.
+func (m *MemoryStore) GetGradeProjects(grade, kind string) ([]*Project, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.filterProjects(func(p *Project) bool {
+		return m.students[p.StudentID].Grade == grade && (kind == "" || p.Kind == kind)
+	}), nil
+}
+
+// CreateProject assigns a supervisor to a student's EE or IA and adds the initial milestones.
+func (m *MemoryStore) CreateProject(req *ProjectRequest) (*Project, error) {
+	dues, err := ValidateProject(req)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	student, ok := m.students[req.StudentID]
+	if !ok {
+		return nil, fmt.Errorf("%w: student not found", ErrInvalidProject)
+	}
+	subject, ok := m.subjects[req.SubjectID]
+	if !ok {
+		return nil, fmt.Errorf("%w: subject not found", ErrInvalidProject)
+	}
+	_, enrolled := m.enrollments[req.StudentID][req.SubjectID]
+	if err := checkProjectStudent(student, subject, enrolled, req.Kind); err != nil {
+		return nil, err
+	}
+	if err := m.requireSupervisor(req.SupervisorID, ErrInvalidProject); err != nil {
+		return nil, err
+	}
+	for _, p := range m.projects {
+		if p.StudentID == req.StudentID && p.Kind == req.Kind && (p.Kind == ProjectEE || p.SubjectID == req.SubjectID) {
+			return nil, ErrProjectExists
+		}
+	}
+
+	now := time.Now()
+	p := &Project{
+		ID:           m.id(),
+		Kind:         req.Kind,
+		StudentID:    req.StudentID,
+		SubjectID:    req.SubjectID,
+		SupervisorID: req.SupervisorID,
+		Title:        req.Title,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	m.projects[p.ID] = p
+	for i, milestone := range req.Milestones {
+		id := m.id()
+		m.milestones[id] = &ProjectMilestone{ID: id, ProjectID: p.ID, Name: milestone.Name, DueDate: dues[i]}
+	}
+	return m.project(p), nil
+}
+
+// UpdateProject changes a project's supervisor and title.
+func (m *MemoryStore) UpdateProject(id int, req *ProjectUpdateRequest) (*Project, error) {
+	if err := ValidateProjectUpdate(req); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.requireSupervisor(req.SupervisorID, ErrInvalidProject); err != nil {
+		return nil, err
+	}
+	p, ok := m.projects[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	p.SupervisorID = req.SupervisorID
+	p.Title = req.Title
+	p.UpdatedAt = time.Now()
+	return m.project(p), nil
+}
+
+// DeleteProject deletes a project with its milestones, drafts and comments.
+func (m *MemoryStore) DeleteProject(id int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.projects[id]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	keys := []string{}
+	for _, draft := range m.projectDrafts {
+		if draft.ProjectID == id {
+			keys = append(keys, draft.StorageKey)
+		}
+	}
+	m.deleteProject(id)
+	return keys, nil
+}
+
+// AddMilestone adds a checkpoint to a project.
+func (m *MemoryStore) AddMilestone(projectID int, req *MilestoneRequest) (*ProjectMilestone, error) {
+	due, err := ValidateMilestone(req)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.projects[projectID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	milestone := &ProjectMilestone{ID: m.id(), ProjectID: projectID, Name: req.Name, DueDate: due}
+	m.milestones[milestone.ID] = milestone
+	copied := *milestone
+	return &copied, nil
+}
+
+// UpdateMilestone renames a milestone or moves its due date.
+func (m *MemoryStore) UpdateMilestone(projectID, milestoneID int, req *MilestoneRequest) (*ProjectMilestone, error) {
+	due, err := ValidateMilestone(req)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	milestone, ok := m.milestones[milestoneID]
+	if !ok || milestone.ProjectID != projectID {
+		return nil, sql.ErrNoRows
+	}
+
+	milestone.Name = req.Name
+	milestone.DueDate = due
+	copied := *milestone
+	return &copied, nil
+}
+
+// SetMilestoneCompleted signs off a milestone or reopens it.
+func (m *MemoryStore) SetMilestoneCompleted(projectID, milestoneID, userID int, completed bool) (*ProjectMilestone, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	milestone, ok := m.milestones[milestoneID]
+	if !ok || milestone.ProjectID != projectID {
+		return nil, sql.ErrNoRows
+	}
+
+	switch {
+	case !completed:
+		milestone.CompletedAt, milestone.CompletedBy = nil, 0
+	case milestone.CompletedAt == nil:
+		now := time.Now()
+		milestone.CompletedAt, milestone.CompletedBy = &now, userID
+	}
+	copied := *milestone
+	return &copied, nil
+}
+
+// DeleteMilestone deletes a milestone. Drafts uploaded for it are kept.
+func (m *MemoryStore) DeleteMilestone(projectID, milestoneID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	milestone, ok := m.milestones[milestoneID]
+	if !ok || milestone.ProjectID != projectID {
+		return sql.ErrNoRows
+	}
+	delete(m.milestones, milestoneID)
+	for _, draft := range m.projectDrafts {
+		if draft.MilestoneID == milestoneID {
+			draft.MilestoneID = 0
+		}
+	}
+	return nil
+}
+
+// AddProjectDraft records a draft uploaded for a project whose content is on the storage backend.
+func (m *MemoryStore) AddProjectDraft(projectID int, draft *ProjectDraft) (*ProjectDraft, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.projects[projectID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	if draft.MilestoneID != 0 {
+		if milestone, ok := m.milestones[draft.MilestoneID]; !ok || milestone.ProjectID != projectID {
+			return nil, fmt.Errorf("%w: milestone does not belong to the project", ErrInvalidProject)
+		}
+	}
+
+	stored := &ProjectDraft{
+		ID:          m.id(),
+		ProjectID:   projectID,
+		MilestoneID: draft.MilestoneID,
+		Filename:    draft.Filename,
+		ContentType: draft.ContentType,
+		Size:        draft.Size,
+		UploadedBy:  draft.UploadedBy,
+		UploadedAt:  time.Now(),
+		StorageKey:  draft.StorageKey,
+	}
+	m.projectDrafts[stored.ID] = stored
+	copied := *stored
+	return &copied, nil
+}
+
+// GetProjectDrafts retrieves the drafts of a project.
+func (m *MemoryStore) GetProjectDrafts(projectID int) ([]*ProjectDraft, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	drafts := []*ProjectDraft{}
+	for _, draft := range m.projectDrafts {
+		if draft.ProjectID == projectID {
+			copied := *draft
+			drafts = append(drafts, &copied)
+		}
+	}
+	sort.Slice(drafts, func(i, j int) bool {
+		if !drafts[i].UploadedAt.Equal(drafts[j].UploadedAt) {
+			return drafts[i].UploadedAt.After(drafts[j].UploadedAt)
+		}
+		return drafts[i].ID > drafts[j].ID
+	})
+	return drafts, nil
+}
+
+// GetProjectDraft retrieves a draft with its storage key.
+func (m *MemoryStore) GetProjectDraft(projectID, draftID int) (*ProjectDraft, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	draft, ok := m.projectDrafts[draftID]
+	if !ok || draft.ProjectID != projectID {
+		return nil, sql.ErrNoRows
+	}
+	copied := *draft
+	return &copied, nil
+}
+
+// projectComment returns a copy of a comment with the author's name; callers must hold the lock
+func (m *MemoryStore) projectComment(stored *ProjectComment) *ProjectComment {
+	comment := *stored
+	comment.AuthorName = ""
+	if user, ok := m.users[comment.AuthorID]; ok {
+		comment.AuthorName = user.Username
+		if profile, ok := m.teacherProfiles[user.ID]; ok {
+			comment.AuthorName = profile.FirstName + " " + profile.LastName
+		}
+	}
+	return &comment
+}
+
+// AddProjectComment comments on a project or one of its drafts.
+func (m *MemoryStore) AddProjectComment(projectID, authorID int, req *ProjectCommentRequest) (*ProjectComment, error) {
+	if err := ValidateProjectComment(req); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.projects[projectID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	if req.DraftID != 0 {
+		if draft, ok := m.projectDrafts[req.DraftID]; !ok || draft.ProjectID != projectID {
+			return nil, fmt.Errorf("%w: draft does not belong to the project", ErrInvalidProject)
+		}
+	}
+
+	comment := &ProjectComment{
+		ID:        m.id(),
+		ProjectID: projectID,
+		DraftID:   req.DraftID,
+		AuthorID:  authorID,
+		Body:      req.Body,
+		CreatedAt: time.Now(),
+	}
+	m.projectComments[comment.ID] = comment
+	return m.projectComment(comment), nil
+}
+
+// GetProjectComments retrieves the comments on a project.
+func (m *MemoryStore) GetProjectComments(projectID int) ([]*ProjectComment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	comments := []*ProjectComment{}
+	for _, comment := range m.projectComments {
+		if comment.ProjectID == projectID {
+			comments = append(comments, m.projectComment(comment))
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		if !comments[i].CreatedAt.Equal(comments[j].CreatedAt) {
+			return comments[i].CreatedAt.Before(comments[j].CreatedAt)
+		}
+		return comments[i].ID < comments[j].ID
+	})
+	return comments, nil
+}
+
+// --- TimetableStore ---
+
+// GetTimeSlots retrieves every time slot ordered by start time.
+func (m *MemoryStore) GetTimeSlots() ([]*TimeSlot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	slots := []*TimeSlot{}
+	for _, slot := range m.timeSlots {
+		copied := *slot
+		slots = append(slots, &copied)
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].StartTime < slots[j].StartTime })
+	return slots, nil
+}
+
+// saveTimeSlot inserts a time slot, or updates it when id is not 0, after
+// checking it overlaps no other slot; callers must hold the write lock
+func (m *MemoryStore) saveTimeSlot(id int, req *TimeSlotRequest) (*TimeSlot, error) {
+	if err := ValidateTimeSlot(req); err != nil {
+		return nil, err
+	}
+	if _, ok := m.timeSlots[id]; id != 0 && !ok {
+		return nil, sql.ErrNoRows
+	}
+	for _, other := range m.timeSlots {
+		if other.ID == id {
+			continue
+		}
+		if other.Name == req.Name {
+			return nil, ErrDuplicate
+		}
+		if other.StartTime < req.EndTime && other.EndTime > req.StartTime {
+			return nil, fmt.Errorf("%w: time slot overlaps %s", ErrInvalidTimetable, other.Name)
+		}
+	}
+
+	if id == 0 {
+		id = m.id()
+	}
+	slot := &TimeSlot{ID: id, Name: req.Name, StartTime: req.StartTime, EndTime: req.EndTime}
+	m.timeSlots[id] = slot
+	copied := *slot
+	return &copied, nil
+}
+
+// CreateTimeSlot adds a period to the school day.
+func (m *MemoryStore) CreateTimeSlot(req *TimeSlotRequest) (*TimeSlot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.saveTimeSlot(0, req)
+}
+
+// UpdateTimeSlot renames a time slot or moves its times.
+func (m *MemoryStore) UpdateTimeSlot(id int, req *TimeSlotRequest) (*TimeSlot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.saveTimeSlot(id, req)
+}
+
+// DeleteTimeSlot deletes a time slot without scheduled lessons.
+func (m *MemoryStore) DeleteTimeSlot(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.timeSlots[id]; !ok {
+		return sql.ErrNoRows
+	}
+	for _, lesson := range m.timetableLessons {
+		if lesson.SlotID == id {
+			return ErrSlotInUse
+		}
+	}
+	delete(m.timeSlots, id)
+	return nil
+}
+
+// GetRooms retrieves every room ordered by name.
+func (m *MemoryStore) GetRooms() ([]*Room, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rooms := []*Room{}
+	for _, room := range m.rooms {
+		copied := *room
+		rooms = append(rooms, &copied)
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Name < rooms[j].Name })
+	return rooms, nil
+}
+
+// roomNameTaken reports whether another room has the name; callers must hold the lock
+func (m *MemoryStore) roomNameTaken(id int, name string) bool {
+	for _, room := range m.rooms {
+		if room.ID != id && room.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateRoom adds a room.
+func (m *MemoryStore) CreateRoom(req *RoomRequest) (*Room, error) {
+	if err := ValidateRoom(req); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.roomNameTaken(0, req.Name) {
+		return nil, ErrDuplicate
+	}
+	room := &Room{ID: m.id(), Name: req.Name, Capacity: req.Capacity, CreatedAt: time.Now()}
+	m.rooms[room.ID] = room
+	copied := *room
+	return &copied, nil
+}
+
+// UpdateRoom renames a room or changes its capacity.
+func (m *MemoryStore) UpdateRoom(id int, req *RoomRequest) (*Room, error) {
+	if err := ValidateRoom(req); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	room, ok := m.rooms[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if m.roomNameTaken(id, req.Name) {
+		return nil, ErrDuplicate
+	}
+	room.Name = req.Name
+	room.Capacity = req.Capacity
+	copied := *room
+	return &copied, nil
+}
+
+// DeleteRoom deletes a room without scheduled lessons.
+func (m *MemoryStore) DeleteRoom(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[id]; !ok {
+		return sql.ErrNoRows
+	}
+	for _, lesson := range m.timetableLessons {
+		if lesson.RoomID == id {
+			return ErrRoomInUse
+		}
+	}
+	delete(m.rooms, id)
+	return nil
+}
+
+// timetableLesson returns a copy of a stored lesson with its names and times
+// filled in; callers must hold the lock
+func (m *MemoryStore) timetableLesson(stored *TimetableLesson) *TimetableLesson {
+	lesson := *stored
+	if subject, ok := m.subjects[lesson.SubjectID]; ok {
+		lesson.SubjectName, lesson.Grade = subject.Name, subject.Grade
+	}
+	lesson.TeacherName = ""
+	if user, ok := m.users[lesson.TeacherID]; ok {
+		lesson.TeacherName = user.Username
+		if profile, ok := m.teacherProfiles[user.ID]; ok {
+			lesson.TeacherName = profile.FirstName + " " + profile.LastName
+		}
+	}
+	if room, ok := m.rooms[lesson.RoomID]; ok {
+		lesson.RoomName = room.Name
+	}
+	if slot, ok := m.timeSlots[lesson.SlotID]; ok {
+		lesson.SlotName, lesson.StartTime, lesson.EndTime = slot.Name, slot.StartTime, slot.EndTime
+	}
+	return &lesson
+}
+
+// filterTimetableLessons returns copies of the lessons matching a filter,
+// ordered by day and time; callers must hold the lock
+func (m *MemoryStore) filterTimetableLessons(match func(*TimetableLesson) bool) []*TimetableLesson {
+	lessons := []*TimetableLesson{}
+	for _, stored := range m.timetableLessons {
+		if match(stored) {
+			lessons = append(lessons, m.timetableLesson(stored))
+		}
+	}
+	sort.Slice(lessons, func(i, j int) bool {
+		a, b := lessons[i], lessons[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.StartTime != b.StartTime {
+			return a.StartTime < b.StartTime
+		}
+		if a.SubjectName != b.SubjectName {
+			return a.SubjectName < b.SubjectName
+		}
+		return a.ID < b.ID
+	})
+	return lessons
+}
+
+// GetTimetableLesson retrieves a timetable lesson.
+func (m *MemoryStore) GetTimetableLesson(id int) (*TimetableLesson, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.timetableLessons[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return m.timetableLesson(stored), nil
+}
+
+// GetTimetableLessons retrieves the timetable lessons matching a filter.
+func (m *MemoryStore) GetTimetableLessons(filter TimetableFilter) ([]*TimetableLesson, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.filterTimetableLessons(func(l *TimetableLesson) bool {
+		if filter.StudentID != 0 {
+			if _, ok := m.enrollments[filter.StudentID][l.SubjectID]; !ok {
+				return false
+			}
+		}
+		return (filter.TeacherID == 0 || l.TeacherID == filter.TeacherID) &&
+			(filter.RoomID == 0 || l.RoomID == filter.RoomID) &&
+			(filter.Day == 0 || l.Day == filter.Day)
+	}), nil
+}
+
+// saveTimetableLesson schedules a lesson, or moves it when id is not 0, unless
+// it conflicts with the lessons in its day and time slot; callers must hold the write lock
+func (m *MemoryStore) saveTimetableLesson(id int, req *TimetableLessonRequest) (*TimetableLesson, []TimetableConflict, error) {
+	if err := ValidateTimetableLesson(req); err != nil {
+		return nil, nil, err
+	}
+	if _, ok := m.timetableLessons[id]; id != 0 && !ok {
+		return nil, nil, sql.ErrNoRows
+	}
+	subject, ok := m.subjects[req.SubjectID]
+	switch {
+	case !ok:
+		return nil, nil, fmt.Errorf("%w: subject not found", ErrInvalidTimetable)
+	case subject.Archived:
+		return nil, nil, ErrSubjectArchived
+	case !m.teaches(req.TeacherID, req.SubjectID):
+		return nil, nil, fmt.Errorf("%w: teacher is not assigned to the subject", ErrInvalidTimetable)
+	}
+	if _, ok := m.rooms[req.RoomID]; !ok {
+		return nil, nil, fmt.Errorf("%w: room not found", ErrInvalidTimetable)
+	}
+	if _, ok := m.timeSlots[req.SlotID]; !ok {
+		return nil, nil, fmt.Errorf("%w: time slot not found", ErrInvalidTimetable)
+	}
+
+	scheduled := m.filterTimetableLessons(func(l *TimetableLesson) bool {
+		return l.ID != id && l.Day == req.Day && l.SlotID == req.SlotID
+	})
+	shared := map[int][]int{}
+	for _, other := range scheduled {
+		for studentID, subjects := range m.enrollments {
+			_, requested := subjects[req.SubjectID]
+			_, attends := subjects[other.SubjectID]
+			if requested && attends {
+				shared[other.ID] = append(shared[other.ID], studentID)
+			}
+		}
+		sort.Ints(shared[other.ID])
+	}
+	if conflicts := DetectTimetableConflicts(req, scheduled, shared); len(conflicts) > 0 {
+		return nil, conflicts, nil
+	}
+
+	now := time.Now()
+	lesson, ok := m.timetableLessons[id]
+	if !ok {
+		lesson = &TimetableLesson{ID: m.id(), CreatedAt: now}
+		m.timetableLessons[lesson.ID] = lesson
+	}
+	lesson.SubjectID = req.SubjectID
+	lesson.TeacherID = req.TeacherID
+	lesson.RoomID = req.RoomID
+	lesson.Day = req.Day
+	lesson.SlotID = req.SlotID
+	lesson.UpdatedAt = now
+	return m.timetableLesson(lesson), nil, nil
+}
+
+// CreateTimetableLesson schedules a weekly lesson unless it conflicts with another lesson.
+func (m *MemoryStore) CreateTimetableLesson(req *TimetableLessonRequest) (*TimetableLesson, []TimetableConflict, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.saveTimetableLesson(0, req)
+}
+
+// UpdateTimetableLesson moves or reassigns a weekly lesson unless it then conflicts with another lesson.
+func (m *MemoryStore) UpdateTimetableLesson(id int, req *TimetableLessonRequest) (*TimetableLesson, []TimetableConflict, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.saveTimetableLesson(id, req)
+}
+
+// DeleteTimetableLesson removes a lesson from the timetable.
+func (m *MemoryStore) DeleteTimetableLesson(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.timetableLessons[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(m.timetableLessons, id)
+	return nil
+}
+
+// exam returns a copy of a stored exam with its subject filled in; callers must hold the lock
+func (m *MemoryStore) exam(stored *Exam) *Exam {
+	exam := *stored
+	if subject, ok := m.subjects[exam.SubjectID]; ok {
+		exam.SubjectName, exam.Grade = subject.Name, subject.Grade
+	}
+	return &exam
+}
+
+// GetExam retrieves an exam.
+func (m *MemoryStore) GetExam(id int) (*Exam, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.exams[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return m.exam(stored), nil
+}
+
+// GetExams retrieves the exams of a subject, or every exam if subjectID is 0, ordered by start time.
+func (m *MemoryStore) GetExams(subjectID int) ([]*Exam, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	exams := []*Exam{}
+	for _, stored := range m.exams {
+		if subjectID == 0 || stored.SubjectID == subjectID {
+			exams = append(exams, m.exam(stored))
+		}
+	}
+	sort.Slice(exams, func(i, j int) bool {
+		a, b := exams[i], exams[j]
+		if a.StartsAt != b.StartsAt {
+			return a.StartsAt < b.StartsAt
+		}
+		if a.SubjectName != b.SubjectName {
+			return a.SubjectName < b.SubjectName
+		}
+		return a.ID < b.ID
+	})
+	return exams, nil
+}
+
+// saveExam schedules an exam, or moves it when id is not 0; callers must hold the write lock
+func (m *MemoryStore) saveExam(id int, req *ExamRequest) (*Exam, error) {
+	if err := ValidateExam(req); err != nil {
+		return nil, err
+	}
+	if _, ok := m.exams[id]; id != 0 && !ok {
+		return nil, sql.ErrNoRows
+	}
+	subject, ok := m.subjects[req.SubjectID]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("%w: subject not found", ErrInvalidTimetable)
+	case subject.Archived:
+		return nil, ErrSubjectArchived
+	}
+
+	now := time.Now()
+	exam, ok := m.exams[id]
+	if !ok {
+		exam = &Exam{ID: m.id(), CreatedAt: now}
+		m.exams[exam.ID] = exam
+	}
+	exam.SubjectID = req.SubjectID
+	exam.Name = req.Name
+	exam.StartsAt = req.StartsAt
+	exam.DurationMinutes = req.DurationMinutes
+	exam.Location = req.Location
+	exam.UpdatedAt = now
+	return m.exam(exam), nil
+}
+
+// CreateExam schedules an exam.
+func (m *MemoryStore) CreateExam(req *ExamRequest) (*Exam, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.saveExam(0, req)
+}
+
+// UpdateExam moves, renames or relocates an exam.
+func (m *MemoryStore) UpdateExam(id int, req *ExamRequest) (*Exam, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.saveExam(id, req)
+}
+
+// DeleteExam removes an exam from the schedule.
+func (m *MemoryStore) DeleteExam(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.exams[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(m.exams, id)
+	return nil
+}
+
+// --- HomeworkStore ---
+
+// homework returns a copy of stored homework with its subject filled in;
+// callers must hold the lock
+func (m *MemoryStore) homework(stored *Homework) *Homework {
+	h := *stored
+	if subject, ok := m.subjects[h.SubjectID]; ok {
+		h.SubjectName, h.Grade = subject.Name, subject.Grade
+	}
+	return &h
+}
+
+// filterHomework returns copies of the homework matching a filter, earliest
+// due first; callers must hold the lock
+func (m *MemoryStore) filterHomework(match func(*Homework) bool) []*Homework {
+	assignments := []*Homework{}
+	for _, stored := range m.homeworkAssignments {
+		if match(stored) {
+			assignments = append(assignments, m.homework(stored))
+		}
+	}
+	sort.Slice(assignments, func(i, j int) bool {
+		if !assignments[i].DueAt.Equal(assignments[j].DueAt) {
+			return assignments[i].DueAt.Before(assignments[j].DueAt)
+		}
+		return assignments[i].ID < assignments[j].ID
+	})
+	return assignments
+}
+
+// GetHomework retrieves homework with its attachments.
+func (m *MemoryStore) GetHomework(id int) (*Homework, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.homeworkAssignments[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	h := m.homework(stored)
+	h.Attachments = []*HomeworkFile{}
+	for _, file := range m.homeworkFiles {
+		if file.HomeworkID == id {
+			copied := *file
+			h.Attachments = append(h.Attachments, &copied)
+		}
+	}
+	sort.Slice(h.Attachments, func(i, j int) bool { return h.Attachments[i].ID < h.Attachments[j].ID })
+	return h, nil
+}
+
+// GetSubjectHomework retrieves the homework of a subject.
+func (m *MemoryStore) GetSubjectHomework(subjectID int) ([]*Homework, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.filterHomework(func(h *Homework) bool { return h.SubjectID == subjectID }), nil
+}
+
+// GetStudentHomework retrieves the homework of every subject a student is enrolled in.
+func (m *MemoryStore) GetStudentHomework(studentID int) ([]*Homework, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.filterHomework(func(h *Homework) bool {
+		_, enrolled := m.enrollments[studentID][h.SubjectID]
+		return enrolled
+	}), nil
+}
+
+// CreateHomework sets homework for a subject the teacher teaches.
+func (m *MemoryStore) CreateHomework(subjectID, teacherID int, req *HomeworkRequest) (*Homework, error) {
+	due, err := ValidateHomework(req)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subject, ok := m.subjects[subjectID]
+	switch {
+	case !ok:
+		return nil, sql.ErrNoRows
+	case subject.Archived:
+		return nil, ErrSubjectArchived
+	case !m.teaches(teacherID, subjectID):
+		return nil, ErrNotTeaching
+	}
+
+	now := time.Now()
+	h := &Homework{
+		ID:           m.id(),
+		SubjectID:    subjectID,
+		Title:        req.Title,
+		Instructions: req.Instructions,
+		DueAt:        due,
+		LatePolicy:   req.LatePolicy,
+		CreatedBy:    teacherID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	m.homeworkAssignments[h.ID] = h
+	created := m.homework(h)
+	created.Attachments = []*HomeworkFile{}
+	return created, nil
+}
+
+// teachingHomework finds homework whose subject the teacher teaches; callers must hold the lock
+func (m *MemoryStore) teachingHomework(id, teacherID int) (*Homework, error) {
+	h, ok := m.homeworkAssignments[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if !m.teaches(teacherID, h.SubjectID) {
+		return nil, ErrNotTeaching
+	}
+	return h, nil
+}
+
+// UpdateHomework changes homework and recomputes the late flags of its submissions.
+func (m *MemoryStore) UpdateHomework(id, teacherID int, req *HomeworkRequest) (*Homework, error) {
+	due, err := ValidateHomework(req)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	h, err := m.teachingHomework(id, teacherID)
+	if err != nil {
+		m.mu.Unlock()
+		return nil, err
+	}
+	h.Title = req.Title
+	h.Instructions = req.Instructions
+	h.DueAt = due
+	h.LatePolicy = req.LatePolicy
+	h.UpdatedAt = time.Now()
+	for _, submission := range m.homeworkSubmissions {
+		if submission.HomeworkID == id {
+			submission.Late = submission.SubmittedAt.After(due)
+		}
+	}
+	m.mu.Unlock()
+
+	return m.GetHomework(id)
+}
+
+// DeleteHomework deletes homework with its attachments and submissions and
+// returns their storage keys.
+func (m *MemoryStore) DeleteHomework(id, teacherID int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.teachingHomework(id, teacherID); err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for fileID, file := range m.homeworkFiles {
+		if file.HomeworkID == id {
+			keys = append(keys, file.StorageKey)
+			delete(m.homeworkFiles, fileID)
+		}
+	}
+	for submissionID, submission := range m.homeworkSubmissions {
+		if submission.HomeworkID == id {
+			keys = append(keys, submission.StorageKey)
+			delete(m.homeworkSubmissions, submissionID)
+		}
+	}
+	delete(m.homeworkAssignments, id)
+	return keys, nil
+}
+
+// AddHomeworkAttachment records a file attached to homework.
+func (m *MemoryStore) AddHomeworkAttachment(homeworkID, teacherID int, file *HomeworkFile) (*HomeworkFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.teachingHomework(homeworkID, teacherID); err != nil {
+		return nil, err
+	}
+	for _, other := range m.homeworkFiles {
+		if other.StorageKey == file.StorageKey {
+			return nil, ErrDuplicate
+		}
+	}
+	stored := &HomeworkFile{
+		ID:          m.id(),
+		HomeworkID:  homeworkID,
+		Filename:    file.Filename,
+		ContentType: file.ContentType,
+		Size:        file.Size,
+		StorageKey:  file.StorageKey,
+		UploadedAt:  time.Now(),
+	}
+	m.homeworkFiles[stored.ID] = stored
+	copied := *stored
+	return &copied, nil
+}
+
+// GetHomeworkAttachment retrieves a file attached to homework.
+func (m *MemoryStore) GetHomeworkAttachment(homeworkID, fileID int) (*HomeworkFile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	file, ok := m.homeworkFiles[fileID]
+	if !ok || file.HomeworkID != homeworkID {
+		return nil, sql.ErrNoRows
+	}
+	copied := *file
+	return &copied, nil
+}
+
+// DeleteHomeworkAttachment removes a file attached to homework and returns its storage key.
+func (m *MemoryStore) DeleteHomeworkAttachment(homeworkID, fileID, teacherID int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.teachingHomework(homeworkID, teacherID); err != nil {
+		return "", err
+	}
+	file, ok := m.homeworkFiles[fileID]
+	if !ok || file.HomeworkID != homeworkID {
+		return "", sql.ErrNoRows
+	}
+	delete(m.homeworkFiles, fileID)
+	return file.StorageKey, nil
+}
+
+// homeworkSubmission returns a copy of a stored submission with the student's
+// name filled in; callers must hold the lock
+func (m *MemoryStore) homeworkSubmission(stored *HomeworkSubmission) *HomeworkSubmission {
+	s := *stored
+	if student, ok := m.students[s.StudentID]; ok {
+		s.StudentName = student.FirstName + " " + student.LastName
+	}
+	return &s
+}
+
+// SubmitHomework records a student's submission as a new attempt, flagged late after the due time.
+func (m *MemoryStore) SubmitHomework(homeworkID, studentID int, submission *HomeworkSubmission) (*HomeworkSubmission, error) {
+	comment, err := ValidateHomeworkComment(submission.Comment)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, ok := m.homeworkAssignments[homeworkID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	_, enrolled := m.enrollments[studentID][h.SubjectID]
+	now := time.Now()
+	late, err := CheckHomeworkSubmission(h, enrolled, now)
+	if err != nil {
+		return nil, err
+	}
+
+	attempt := 1
+	for _, other := range m.homeworkSubmissions {
+		if other.StorageKey == submission.StorageKey {
+			return nil, ErrDuplicate
+		}
+		if other.HomeworkID == homeworkID && other.StudentID == studentID && other.Attempt >= attempt {
+			attempt = other.Attempt + 1
+		}
+	}
+	stored := &HomeworkSubmission{
+		ID:          m.id(),
+		HomeworkID:  homeworkID,
+		StudentID:   studentID,
+		Attempt:     attempt,
+		Comment:     comment,
+		Filename:    submission.Filename,
+		ContentType: submission.ContentType,
+		Size:        submission.Size,
+		StorageKey:  submission.StorageKey,
+		SubmittedAt: now,
+		Late:        late,
+	}
+	m.homeworkSubmissions[stored.ID] = stored
+	return m.homeworkSubmission(stored), nil
+}
+
+// GetHomeworkSubmissions retrieves the submissions of homework, optionally of one student.
+func (m *MemoryStore) GetHomeworkSubmissions(homeworkID, studentID int) ([]*HomeworkSubmission, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	submissions := []*HomeworkSubmission{}
+	for _, stored := range m.homeworkSubmissions {
+		if stored.HomeworkID == homeworkID && (studentID == 0 || stored.StudentID == studentID) {
+			submissions = append(submissions, m.homeworkSubmission(stored))
+		}
+	}
+	sort.Slice(submissions, func(i, j int) bool {
+		a, b := submissions[i], submissions[j]
+		sa, sb := m.students[a.StudentID], m.students[b.StudentID]
+		if sa.LastName != sb.LastName {
+			return sa.LastName < sb.LastName
+		}
+		if sa.FirstName != sb.FirstName {
+			return sa.FirstName < sb.FirstName
+		}
+		if a.StudentID != b.StudentID {
+			return a.StudentID < b.StudentID
+		}
+		return a.Attempt > b.Attempt
+	})
+	return submissions, nil
+}
+
+// GetStudentSubmissions retrieves every homework submission of a student, latest first.
+func (m *MemoryStore) GetStudentSubmissions(studentID int) ([]*HomeworkSubmission, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	submissions := []*HomeworkSubmission{}
+	for _, stored := range m.homeworkSubmissions {
+		if stored.StudentID == studentID {
+			submissions = append(submissions, m.homeworkSubmission(stored))
+		}
+	}
+	sort.Slice(submissions, func(i, j int) bool {
+		if !submissions[i].SubmittedAt.Equal(submissions[j].SubmittedAt) {
+			return submissions[i].SubmittedAt.After(submissions[j].SubmittedAt)
+		}
+		return submissions[i].ID > submissions[j].ID
+	})
+	return submissions, nil
+}
+
+// GetHomeworkSubmission retrieves a homework submission.
+func (m *MemoryStore) GetHomeworkSubmission(id int) (*HomeworkSubmission, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.homeworkSubmissions[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return m.homeworkSubmission(stored), nil
+}
+
+// SetHomeworkFeedback gives or replaces a teacher's feedback on a submission.
+func (m *MemoryStore) SetHomeworkFeedback(submissionID, teacherID int, req *HomeworkFeedbackRequest) (*HomeworkSubmission, error) {
+	if err := ValidateHomeworkFeedback(req); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	submission, ok := m.homeworkSubmissions[submissionID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if !m.teaches(teacherID, m.homeworkAssignments[submission.HomeworkID].SubjectID) {
+		return nil, ErrNotTeaching
+	}
+	now := time.Now()
+	submission.Feedback = req.Feedback
+	submission.FeedbackBy = teacherID
+	submission.FeedbackAt = &now
+	return m.homeworkSubmission(submission), nil
+}
+
+// --- GuardianStore ---
+
+// guardian builds a guardian from a user and their profile; callers must hold the lock
+func (m *MemoryStore) guardian(user *User) *Guardian {
+	guardian := &Guardian{
+		ID:       user.ID,
+		Username: user.Username,
+		Active:   user.Active,
+		Children: m.guardianChildren(user.ID),
+	}
+	if profile, ok := m.guardianProfiles[user.ID]; ok {
+		guardian.FirstName = profile.FirstName
+		guardian.LastName = profile.LastName
+		guardian.Email = profile.Email
+		guardian.Phone = profile.Phone
+	}
+	return guardian
+}
+
+// guardianUser finds a user with the guardian role; callers must hold the lock
+func (m *MemoryStore) guardianUser(id int) (*User, bool) {
+	user, ok := m.users[id]
+	if !ok || user.Role != RoleGuardian {
+		return nil, false
+	}
+	return user, true
+}
+
+// guardianEmailTaken reports whether another guardian uses an email; callers must hold the lock
+func (m *MemoryStore) guardianEmailTaken(email string, exceptID int) bool {
+	for id, profile := range m.guardianProfiles {
+		if id != exceptID && profile.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// guardianChildren returns the students a guardian is linked to; callers must hold the lock
+func (m *MemoryStore) guardianChildren(guardianID int) []GuardianChild {
+	children := []GuardianChild{}
+	for studentID, link := range m.guardianLinks[guardianID] {
+		student, ok := m.students[studentID]
+		if !ok {
+			continue
+		}
+		child := *link
+		child.FirstName = student.FirstName
+		child.LastName = student.LastName
+		child.Grade = student.Grade
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		a, b := children[i], children[j]
+		if a.LastName != b.LastName {
+			return a.LastName < b.LastName
+		}
+		if a.FirstName != b.FirstName {
+			return a.FirstName < b.FirstName
+		}
+		return a.StudentID < b.StudentID
+	})
+	return children
+}
+
+// GetAllGuardians retrieves all guardians ordered by username.
+func (m *MemoryStore) GetAllGuardians() ([]*Guardian, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	guardians := []*Guardian{}
+	for _, user := range m.users {
+		if user.Role == RoleGuardian {
+			guardians = append(guardians, m.guardian(user))
+		}
+	}
+	sort.Slice(guardians, func(i, j int) bool {
+		return guardians[i].Username < guardians[j].Username
+	})
+	return guardians, nil
+}
+
+// GetGuardianByID retrieves a guardian by ID with their children.
+func (m *MemoryStore) GetGuardianByID(id int) (*Guardian, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.guardianUser(id)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return m.guardian(user), nil
+}
+
+// CreateGuardian creates a new guardian and corresponding user.
+func (m *MemoryStore) CreateGuardian(req *GuardianRequest) (*Guardian, error) {
+	hash, err := m.hashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userByUsername(req.Username) != nil || m.guardianEmailTaken(req.Email, 0) {
+		return nil, ErrDuplicate
+	}
+
+	user := &User{
+		ID:          m.id(),
+		Username:    req.Username,
+		Password:    hash,
+		Role:        RoleGuardian,
+		Active:      true,
+		DateCreated: time.Now(),
+	}
+	m.users[user.ID] = user
+	m.guardianProfiles[user.ID] = &Guardian{
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Email:     req.Email,
+		Phone:     req.Phone,
+	}
+
+	return m.guardian(user), nil
+}
+
+// UpdateGuardian updates an existing guardian's profile and optionally their password.
+func (m *MemoryStore) UpdateGuardian(id int, req *GuardianRequest) (*Guardian, error) {
+	var hash string
+	if req.Password != "" {
+		var err error
+		if hash, err = m.hashPassword(req.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.guardianUser(id)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if m.guardianEmailTaken(req.Email, id) {
+		return nil, ErrDuplicate
+	}
+
+	if hash != "" {
+		user.Password = hash
+	}
+	m.guardianProfiles[id] = &Guardian{
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Email:     req.Email,
+		Phone:     req.Phone,
+	}
+
+	return m.guardian(user), nil
+}
+
+// DeleteGuardian deletes a guardian, their user account and their student links.
+func (m *MemoryStore) DeleteGuardian(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.guardianUser(id); !ok {
+		return sql.ErrNoRows
+	}
+	m.deleteUser(id)
+	return nil
+}
+
+// LinkGuardianStudent links a guardian to a student.
+func (m *MemoryStore) LinkGuardianStudent(guardianID int, req *GuardianLinkRequest) (*GuardianChild, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.guardianUser(guardianID); !ok {
+		return nil, sql.ErrNoRows
+	}
+	student, ok := m.students[req.StudentID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if _, ok := m.guardianLinks[guardianID][student.ID]; ok {
+		return nil, ErrDuplicate
+	}
+
+	if m.guardianLinks[guardianID] == nil {
+		m.guardianLinks[guardianID] = make(map[int]*GuardianChild)
+	}
+	link := &GuardianChild{
+		StudentID:    student.ID,
+		Relationship: req.Relationship,
+		LinkedAt:     time.Now(),
+	}
+	m.guardianLinks[guardianID][student.ID] = link
+
+	child := *link
+	child.FirstName = student.FirstName
+	child.LastName = student.LastName
+	child.Grade = student.Grade
+	return &child, nil
+}
+
+// UnlinkGuardianStudent removes the link between a guardian and a student.
+func (m *MemoryStore) UnlinkGuardianStudent(guardianID, studentID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.guardianLinks[guardianID][studentID]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(m.guardianLinks[guardianID], studentID)
+	return nil
+}
+
+// GetGuardianChildren retrieves the students a guardian is linked to.
+func (m *MemoryStore) GetGuardianChildren(guardianID int) ([]GuardianChild, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.guardianChildren(guardianID), nil
+}
+
+// IsGuardianOf reports whether a user is a guardian linked to a student.
+func (m *MemoryStore) IsGuardianOf(guardianID, studentID int) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.guardianLinks[guardianID][studentID]
+	return ok, nil
+}
+
+// --- RoleStore ---
+
+// copyRole returns a deep copy of a role
+func copyRole(role *Role) *Role {
+	copied := *role
+	copied.Permissions = append([]string{}, role.Permissions...)
+	return &copied
+}
+
+// GetAllRoles retrieves all roles ordered by name.
+func (m *MemoryStore) GetAllRoles() ([]*Role, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var roles []*Role
+	for _, role := range m.roles {
+		roles = append(roles, copyRole(role))
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+
+	return roles, nil
+}
+
+// GetRole retrieves a role by name.
+func (m *MemoryStore) GetRole(name string) (*Role, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	role, ok := m.roles[name]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyRole(role), nil
+}
+
+// GetRolePermissions retrieves the permissions granted to a role.
+func (m *MemoryStore) GetRolePermissions(name string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	role, ok := m.roles[name]
+	if !ok {
+		return []string{}, nil
+	}
+	return append([]string{}, role.Permissions...), nil
+}
+
+// GetUserPermissions retrieves a user's current role and its permissions.
+func (m *MemoryStore) GetUserPermissions(userID int) (string, []string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userID]
+	if !ok || !user.Active {
+		return "", nil, sql.ErrNoRows
+	}
+	permissions := []string{}
+	if role, ok := m.roles[user.Role]; ok {
+		permissions = append(permissions, role.Permissions...)
+	}
+	return user.Role, permissions, nil
+}
+
+// CreateRole creates a new role with the given permissions.
+func (m *MemoryStore) CreateRole(req *RoleRequest) (*Role, error) {
+	if !roleNamePattern.MatchString(req.Name) {
+		return nil, ErrInvalidRoleName
+	}
+	permissions, err := validateRolePermissions(req.Name, req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.roles[req.Name]; ok {
+		return nil, ErrDuplicate
+	}
+
+	role := &Role{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: append([]string{}, permissions...),
+		CreatedAt:   time.Now(),
+	}
+	m.roles[role.Name] = role
+
+	return copyRole(role), nil
+}
+
+// UpdateRole replaces a role's description and permissions.
+func (m *MemoryStore) UpdateRole(name string, req *RoleRequest) (*Role, error) {
+	permissions, err := validateRolePermissions(name, req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	role, ok := m.roles[name]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	role.Description = req.Description
+	role.Permissions = append([]string{}, permissions...)
+
+	return copyRole(role), nil
+}
+
+// DeleteRole deletes a role that is not built in and not assigned to any user.
+func (m *MemoryStore) DeleteRole(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	role, ok := m.roles[name]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if role.IsSystem {
+		return ErrSystemRole
+	}
+	for _, user := range m.users {
+		if user.Role == name {
+			return ErrRoleInUse
+		}
+	}
+
+	delete(m.roles, name)
+	return nil
+}
+
+// SetUserRole assigns a role to a user.
+func (m *MemoryStore) SetUserRole(userID int, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if _, ok := m.roles[role]; !ok {
+		return sql.ErrNoRows
+	}
+	user.Role = role
+	return nil
+}
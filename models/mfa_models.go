@@ -0,0 +1,387 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecoveryCodeCount is the number of recovery codes issued at a time
+const RecoveryCodeCount = 10
+
+// ErrMFAEnabled is returned when enrolling a user whose two-factor
+// authentication is already confirmed
+var ErrMFAEnabled = errors.New("two-factor authentication is already enabled")
+
+// ErrInvalidMFACode is returned when a TOTP code was already used or a
+// recovery code is unknown or used
+var ErrInvalidMFACode = errors.New("two-factor authentication code is invalid or already used")
+
+// sealedMFASecretPrefix marks an encrypted TOTP secret; secrets stored before
+// encryption are plain base32, which never contains a colon
+const sealedMFASecretPrefix = "v1:"
+
+// errNoMFAKey is returned when a TOTP secret is written without DB.MFAKey
+var errNoMFAKey = errors.New("no key to encrypt two-factor secrets with")
+
+// MFASecretKey derives the key TOTP secrets are stored encrypted with from
+// the JWT secret. Changing the JWT secret makes stored secrets unreadable,
+// so enrolled users then need their two-factor authentication reset.
+//
+// Parameters:
+//   - jwtSecret: The server's JWT signing secret
+//
+// Returns:
+//   - []byte: 32 byte AES-256 key
+func MFASecretKey(jwtSecret string) []byte {
+	mac := hmac.New(sha256.New, []byte(jwtSecret))
+	mac.Write([]byte("mfa-secret"))
+	return mac.Sum(nil)
+}
+
+// mfaCipher returns the AES-GCM cipher of the configured MFA key
+func (db *DB) mfaCipher() (cipher.AEAD, error) {
+	if len(db.MFAKey) == 0 {
+		return nil, errNoMFAKey
+	}
+	block, err := aes.NewCipher(db.MFAKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealMFASecret encrypts a user's TOTP secret. The user ID is authenticated
+// with it, so that a secret copied to another user's row does not decrypt.
+func (db *DB) sealMFASecret(userID int, secret string) (string, error) {
+	gcm, err := db.mfaCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), []byte(strconv.Itoa(userID)))
+	return sealedMFASecretPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// openMFASecret decrypts a stored TOTP secret, returning secrets stored
+// before encryption as they are
+func (db *DB) openMFASecret(userID int, stored string) (string, error) {
+	encoded, ok := strings.CutPrefix(stored, sealedMFASecretPrefix)
+	if !ok {
+		return stored, nil
+	}
+	gcm, err := db.mfaCipher()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("two-factor secret of user %d is malformed", userID)
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	secret, err := gcm.Open(nil, nonce, ciphertext, []byte(strconv.Itoa(userID)))
+	if err != nil {
+		return "", fmt.Errorf("decrypting two-factor secret of user %d, which needs the JWT secret it was stored with: %w", userID, err)
+	}
+	return string(secret), nil
+}
+
+// MFA represents the two-factor authentication state of a user. An
+// enrolment is pending until the first code confirms it.
+type MFA struct {
+	UserID            int        `json:"user_id"`             // User the secret belongs to
+	Secret            string     `json:"-"`                   // Base32 TOTP secret
+	Enabled           bool       `json:"enabled"`             // Whether the enrolment is confirmed
+	ConfirmedAt       *time.Time `json:"confirmed_at"`        // When the first code was accepted, nil while pending
+	LastStep          int64      `json:"-"`                   // Newest TOTP time step used, refused afterwards
+	RecoveryCodesLeft int        `json:"recovery_codes_left"` // Unused recovery codes
+	CreatedAt         time.Time  `json:"created_at"`          // When the secret was generated
+}
+
+// GetMFA retrieves the two-factor authentication state of a user
+//
+// Parameters:
+//   - userID: User to look up
+//
+// Returns:
+//   - *MFA: Enrolment, confirmed or pending
+//   - error: sql.ErrNoRows if the user never enrolled, or a database error
+func (db *DB) GetMFA(userID int) (*MFA, error) {
+	mfa := &MFA{}
+	err := db.QueryRow(`
+		SELECT m.user_id, m.secret, m.confirmed_at, m.last_step, m.created_at,
+			(SELECT COUNT(*) FROM mfa_recovery_codes r WHERE r.user_id = m.user_id AND r.used_at IS NULL)
+		FROM user_mfa m
+		WHERE m.user_id = $1`,
+		userID,
+	).Scan(
+		&mfa.UserID,
+		&mfa.Secret,
+		&mfa.ConfirmedAt,
+		&mfa.LastStep,
+		&mfa.CreatedAt,
+		&mfa.RecoveryCodesLeft,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if mfa.Secret, err = db.openMFASecret(mfa.UserID, mfa.Secret); err != nil {
+		return nil, err
+	}
+	mfa.Enabled = mfa.ConfirmedAt != nil
+	return mfa, nil
+}
+
+// StartMFAEnrollment stores a new TOTP secret for a user, encrypted with
+// MFAKey, replacing the secret of a pending enrolment
+//
+// Parameters:
+//   - userID: User enrolling
+//   - secret: Base32 TOTP secret
+//
+// Returns:
+//   - error: ErrMFAEnabled if the user's enrolment is already confirmed, or a database error
+func (db *DB) StartMFAEnrollment(userID int, secret string) error {
+	sealed, err := db.sealMFASecret(userID, secret)
+	if err != nil {
+		return err
+	}
+	res, err := db.Exec(`
+		INSERT INTO user_mfa (user_id, secret, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_step = 0, created_at = EXCLUDED.created_at
+		WHERE user_mfa.confirmed_at IS NULL`,
+		userID, sealed, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrMFAEnabled
+	}
+	return nil
+}
+
+// ConfirmMFA enables a pending enrolment once the user entered a valid code,
+// and stores the user's recovery codes. This operation is performed in a
+// transaction.
+//
+// Parameters:
+//   - userID: User enrolling
+//   - step: TOTP time step of the accepted code
+//   - codeHashes: SHA-256 hashes of the recovery codes (see HashToken)
+//
+// Returns:
+//   - error: sql.ErrNoRows if no enrolment is pending, or a database error
+func (db *DB) ConfirmMFA(userID int, step int64, codeHashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	res, err := tx.Exec(
+		"UPDATE user_mfa SET confirmed_at = $1, last_step = $2 WHERE user_id = $3 AND confirmed_at IS NULL",
+		time.Now().UTC(), step, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		err = sql.ErrNoRows
+		return err
+	}
+
+	if err = replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseMFAStep records the TOTP time step of an accepted code, so that the code
+// and older ones cannot be used again
+//
+// Parameters:
+//   - userID: User who entered the code
+//   - step: TOTP time step of the code
+//
+// Returns:
+//   - error: ErrInvalidMFACode if the step is not newer than the last one
+//     used or the user has no confirmed enrolment, or a database error
+func (db *DB) UseMFAStep(userID int, step int64) error {
+	res, err := db.Exec(
+		"UPDATE user_mfa SET last_step = $1 WHERE user_id = $2 AND confirmed_at IS NOT NULL AND last_step < $1",
+		step, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// UseRecoveryCode marks a recovery code as used
+//
+// Parameters:
+//   - userID: User who entered the code
+//   - codeHash: SHA-256 hash of the normalized code (see HashToken)
+//
+// Returns:
+//   - error: ErrInvalidMFACode if the code is unknown or used, or a database error
+func (db *DB) UseRecoveryCode(userID int, codeHash string) error {
+	res, err := db.Exec(
+		"UPDATE mfa_recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL",
+		time.Now().UTC(), userID, codeHash,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes discards a user's recovery codes, used or not, and
+// stores new ones. This operation is performed in a transaction.
+//
+// Parameters:
+//   - userID: User whose codes are replaced
+//   - codeHashes: SHA-256 hashes of the new codes (see HashToken)
+//
+// Returns:
+//   - error: Error if the codes cannot be stored
+func (db *DB) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DisableMFA removes a user's TOTP secret and recovery codes, so that the
+// user logs in with the password alone. This operation is performed in a
+// transaction.
+//
+// Parameters:
+//   - userID: User whose two-factor authentication is disabled
+//
+// Returns:
+//   - error: sql.ErrNoRows if the user never enrolled, or a database error
+func (db *DB) DisableMFA(userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("DELETE FROM user_mfa WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		err = sql.ErrNoRows
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// replaceRecoveryCodes swaps a user's recovery codes within a transaction
+func replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		_, err := tx.Exec("INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncryptMFASecrets encrypts the TOTP secrets stored in plain text before
+// secrets were encrypted. Encrypted secrets are left alone, so it can run at
+// every startup and on several servers at once.
+//
+// Returns:
+//   - int: Number of secrets encrypted
+//   - error: A database error, or errNoMFAKey without MFAKey
+func (db *DB) EncryptMFASecrets() (int, error) {
+	rows, err := db.Query("SELECT user_id, secret FROM user_mfa WHERE secret NOT LIKE $1", sealedMFASecretPrefix+"%")
+	if err != nil {
+		return 0, err
+	}
+	plain := map[int]string{}
+	for rows.Next() {
+		var userID int
+		var secret string
+		if err := rows.Scan(&userID, &secret); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		plain[userID] = secret
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	encrypted := 0
+	for userID, secret := range plain {
+		sealed, err := db.sealMFASecret(userID, secret)
+		if err != nil {
+			return encrypted, err
+		}
+		// Skip secrets replaced by a new enrolment meanwhile
+		result, err := db.Exec("UPDATE user_mfa SET secret = $1 WHERE user_id = $2 AND secret = $3", sealed, userID, secret)
+		if err != nil {
+			return encrypted, err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return encrypted, err
+		} else if n > 0 {
+			encrypted++
+		}
+	}
+	return encrypted, nil
+}
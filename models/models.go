@@ -7,18 +7,24 @@ package models
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 )
 
 // User represents a user in the system with authentication information.
-// Passwords are stored as plaintext for development simplicity.
-// In production, passwords should be hashed using a secure algorithm.
+// Passwords are stored as bcrypt or argon2id hashes. Rows created before
+// hashing was introduced may still hold plaintext and are upgraded on login.
 type User struct {
 	ID          int       `json:"id"`           // Unique identifier
 	Username    string    `json:"username"`     // Login username
-	Password    string    `json:"-"`            // Password (not included in JSON)
+	Password    string    `json:"-"`            // Password hash (not included in JSON)
 	Role        string    `json:"role"`         // User role: admin, teacher, or student
+	Active      bool      `json:"active"`       // Deactivated users cannot log in
 	DateCreated time.Time `json:"date_created"` // Account creation timestamp
+	DisplayName string    `json:"display_name"` // Name the user chose to be shown, may be empty
+
+	MustChangePassword bool       `json:"must_change_password"` // Login is refused until a new password is set
+	LockedUntil        *time.Time `json:"locked_until"`         // Locked after repeated failed logins until then, nil if not locked
 }
 
 // Student represents a student in the system with additional details.
@@ -50,35 +56,72 @@ type StudentRequest struct {
 // It wraps the standard sql.DB connection.
 type DB struct {
 	*sql.DB
+	Hasher PasswordHasher // Hasher used for every password write
+	MFAKey []byte         // AES-256 key TOTP secrets are stored encrypted with, see MFASecretKey
+}
+
+// ConnOptions holds the settings used to open and pool database connections.
+type ConnOptions struct {
+	Host            string        // Database server hostname
+	Port            string        // Database server port
+	Name            string        // Database name
+	User            string        // Database username
+	Password        string        // Database password
+	SSLMode         string        // PostgreSQL sslmode, "disable" when empty
+	MaxOpenConns    int           // Maximum open connections, 0 for unlimited
+	MaxIdleConns    int           // Maximum idle connections kept in the pool
+	ConnMaxLifetime time.Duration // Maximum lifetime of a pooled connection, 0 for unlimited
 }
 
-// NewDB creates a new database connection using the provided parameters.
+// NewDB creates a new database connection using the provided options.
 //
 // Parameters:
-//   - host: Database server hostname
-//   - port: Database server port
-//   - dbname: Database name
-//   - user: Database username
-//   - password: Database password
+//   - opts: Connection and pool settings
 //
 // Returns:
 //   - *DB: Database connection wrapper
 //   - error: Error if connection fails
-func NewDB(host, port, dbname, user, password string) (*DB, error) {
-	connStr := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=disable",
-		host, port, dbname, user, password)
+func NewDB(opts ConnOptions) (*DB, error) {
+	sslMode := opts.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	// Sessions run in UTC so that NOW() defaults and timestamp list cursors
+	// agree with the UTC times written by the server, whatever its zone
+	connStr := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s timezone=%s",
+		quoteConnValue(opts.Host),
+		quoteConnValue(opts.Port),
+		quoteConnValue(opts.Name),
+		quoteConnValue(opts.User),
+		quoteConnValue(opts.Password),
+		quoteConnValue(sslMode),
+		quoteConnValue("UTC"),
+	)
 
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
 		return nil, err
 	}
 
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+
 	// Test the connection
 	if err = db.Ping(); err != nil {
 		return nil, err
 	}
 
-	return &DB{db}, nil
+	return &DB{DB: db, Hasher: BcryptHasher{}}, nil
+}
+
+// quoteConnValue quotes a value for a key=value PostgreSQL connection string
+// so that passwords containing spaces or quotes are passed through intact.
+func quoteConnValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
 }
 
 // GetUserByUsername retrieves a user by their username.
@@ -91,14 +134,18 @@ func NewDB(host, port, dbname, user, password string) (*DB, error) {
 //   - error: Error if user not found or database error
 func (db *DB) GetUserByUsername(username string) (*User, error) {
 	user := &User{}
-	query := `SELECT id, username, password, role, date_created FROM users WHERE username = $1`
+	query := `SELECT id, username, password, role, is_active, date_created, display_name, must_change_password, locked_until FROM users WHERE username = $1`
 
 	err := db.QueryRow(query, username).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Password,
 		&user.Role,
+		&user.Active,
 		&user.DateCreated,
+		&user.DisplayName,
+		&user.MustChangePassword,
+		&user.LockedUntil,
 	)
 
 	if err != nil {
@@ -109,6 +156,7 @@ func (db *DB) GetUserByUsername(username string) (*User, error) {
 }
 
 // CreateUser adds a new user to the database.
+// The password is hashed with the configured hasher before it is stored.
 //
 // Parameters:
 //   - username: Login username
@@ -119,24 +167,32 @@ func (db *DB) GetUserByUsername(username string) (*User, error) {
 //   - *User: Created user object
 //   - error: Error if creation fails
 func (db *DB) CreateUser(username, password, role string) (*User, error) {
-	// Store the plain password since that's what's in the database
+	hash, err := db.hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
 	user := &User{}
 	query := `INSERT INTO users (username, password, role, date_created) 
 	          VALUES ($1, $2, $3, $4) 
-	          RETURNING id, username, password, role, date_created`
+	          RETURNING id, username, password, role, is_active, date_created, display_name, must_change_password, locked_until`
 
-	err := db.QueryRow(
+	err = db.QueryRow(
 		query,
 		username,
-		password, // Storing plaintext password
+		hash,
 		role,
-		time.Now(),
+		time.Now().UTC(),
 	).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Password,
 		&user.Role,
+		&user.Active,
 		&user.DateCreated,
+		&user.DisplayName,
+		&user.MustChangePassword,
+		&user.LockedUntil,
 	)
 
 	if err != nil {
@@ -147,6 +203,7 @@ func (db *DB) CreateUser(username, password, role string) (*User, error) {
 }
 
 // CheckPassword verifies a user's password.
+// Both hashed and legacy plaintext passwords are accepted.
 //
 // Parameters:
 //   - password: Password to check
@@ -154,54 +211,72 @@ func (db *DB) CreateUser(username, password, role string) (*User, error) {
 // Returns:
 //   - bool: True if password matches, false otherwise
 func (user *User) CheckPassword(password string) bool {
-	// In this case, we're comparing plaintext passwords directly
-	return user.Password == password
+	return VerifyPassword(user.Password, password)
+}
+
+// studentListSpec lists the student fields list endpoints may sort, filter and search by
+var studentListSpec = listSpec[*Student]{
+	Fields: map[string]listField[*Student]{
+		"id":         {Column: "s.id", Kind: kindInt, Value: func(s *Student) interface{} { return s.ID }, Sort: true},
+		"first_name": {Column: "s.first_name", Value: func(s *Student) interface{} { return s.FirstName }, Sort: true, Search: true},
+		"last_name":  {Column: "s.last_name", Value: func(s *Student) interface{} { return s.LastName }, Sort: true, Search: true},
+		"email":      {Column: "s.email", Value: func(s *Student) interface{} { return s.Email }, Sort: true, Filter: true, Search: true},
+		"grade":      {Column: "s.grade", Value: func(s *Student) interface{} { return s.Grade }, Sort: true, Filter: true},
+		"username":   {Column: "u.username", Value: func(s *Student) interface{} { return s.Username }, Sort: true, Filter: true, Search: true},
+		"created_at": {Column: "s.created_at", Kind: kindTime, Value: func(s *Student) interface{} { return s.CreatedAt }, Sort: true},
+		"updated_at": {Column: "s.updated_at", Kind: kindTime, Value: func(s *Student) interface{} { return s.UpdatedAt }, Sort: true},
+	},
+	Key:         "id",
+	DefaultSort: []SortField{{Field: "last_name"}, {Field: "first_name"}},
 }
 
-// GetAllStudents retrieves all students with their user information.
+// ListStudents retrieves a page of students with their user information.
+//
+// Parameters:
+//   - params: Page, sort, filters (grade, email, username) and search (names, email, username)
 //
 // Returns:
-//   - []*Student: Array of all students
-//   - error: Error if retrieval fails
-func (db *DB) GetAllStudents() ([]*Student, error) {
-	query := `
-		SELECT s.id, s.user_id, s.first_name, s.last_name, s.email, s.grade, 
+//   - *ListResult[*Student]: Page of students ordered by last name and first name unless sorted otherwise
+//   - error: ErrInvalidListParams or a database error
+func (db *DB) ListStudents(params ListParams) (*ListResult[*Student], error) {
+	return queryList(db, studentListSpec, params, studentListQuery, nil, nil, scanStudentRow)
+}
+
+// EachStudent streams every student matching the filters and search of params
+// in sort order, without loading them all into memory
+//
+// Parameters:
+//   - params: Sort, filters and search as for ListStudents; limit, page and cursor are ignored
+//   - fn: Called for each student; an error stops the iteration and is returned
+//
+// Returns:
+//   - error: ErrInvalidListParams before any student, or an error of the query or fn
+func (db *DB) EachStudent(params ListParams, fn func(*Student) error) error {
+	return queryEach(db, studentListSpec, params, studentListQuery, nil, nil, scanStudentRow, fn)
+}
+
+// studentListQuery selects students with their usernames for scanStudentRow
+const studentListQuery = `
+		SELECT s.id, s.user_id, s.first_name, s.last_name, s.email, s.grade,
 		       s.created_at, s.updated_at, u.username
 		FROM students s
-		JOIN users u ON s.user_id = u.id
-		ORDER BY s.last_name, s.first_name
-	`
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var students []*Student
-	for rows.Next() {
-		student := &Student{}
-		err := rows.Scan(
-			&student.ID,
-			&student.UserID,
-			&student.FirstName,
-			&student.LastName,
-			&student.Email,
-			&student.Grade,
-			&student.CreatedAt,
-			&student.UpdatedAt,
-			&student.Username,
-		)
-		if err != nil {
-			return nil, err
-		}
-		students = append(students, student)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
+		JOIN users u ON s.user_id = u.id`
 
-	return students, nil
+// scanStudentRow scans a row selected with studentListQuery
+func scanStudentRow(rows *sql.Rows) (*Student, error) {
+	student := &Student{}
+	err := rows.Scan(
+		&student.ID,
+		&student.UserID,
+		&student.FirstName,
+		&student.LastName,
+		&student.Email,
+		&student.Grade,
+		&student.CreatedAt,
+		&student.UpdatedAt,
+		&student.Username,
+	)
+	return student, err
 }
 
 // GetStudentByID retrieves a student by ID.
@@ -238,6 +313,22 @@ func (db *DB) GetStudentByID(id int) (*Student, error) {
 	return student, nil
 }
 
+// GetStudentByUserID retrieves the student record of a login account.
+//
+// Parameters:
+//   - userID: User ID of the student's login account
+//
+// Returns:
+//   - *Student: Student object if found
+//   - error: sql.ErrNoRows if the user is not a student, or a database error
+func (db *DB) GetStudentByUserID(userID int) (*Student, error) {
+	var id int
+	if err := db.QueryRow("SELECT id FROM students WHERE user_id = $1", userID).Scan(&id); err != nil {
+		return nil, err
+	}
+	return db.GetStudentByID(id)
+}
+
 // CreateStudent creates a new student and corresponding user.
 // This operation is performed in a transaction to ensure data consistency.
 //
@@ -248,6 +339,11 @@ func (db *DB) GetStudentByID(id int) (*Student, error) {
 //   - *Student: Created student object
 //   - error: Error if creation fails
 func (db *DB) CreateStudent(req *StudentRequest) (*Student, error) {
+	hash, err := db.hashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
 	tx, err := db.Begin()
 	if err != nil {
 		return nil, err
@@ -258,6 +354,29 @@ func (db *DB) CreateStudent(req *StudentRequest) (*Student, error) {
 		}
 	}()
 
+	student, err := insertStudent(tx, req, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return student, nil
+}
+
+// insertStudent creates a student's login account and record within a transaction
+//
+// Parameters:
+//   - tx: Transaction to insert in
+//   - req: Student details
+//   - hash: Hashed login password
+//
+// Returns:
+//   - *Student: Created student
+//   - error: A duplicate username or email error, or a database error
+func insertStudent(tx *sql.Tx, req *StudentRequest, hash string) (*Student, error) {
 	// Create user first
 	var userID int
 	userQuery := `
@@ -265,18 +384,18 @@ func (db *DB) CreateStudent(req *StudentRequest) (*Student, error) {
 		VALUES ($1, $2, 'student', $3) 
 		RETURNING id
 	`
-	err = tx.QueryRow(
+	err := tx.QueryRow(
 		userQuery,
 		req.Username,
-		req.Password,
-		time.Now(),
+		hash,
+		time.Now().UTC(),
 	).Scan(&userID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Create student record
-	now := time.Now()
+	now := time.Now().UTC()
 	student := &Student{}
 	studentQuery := `
 		INSERT INTO students (user_id, first_name, last_name, email, grade, created_at, updated_at) 
@@ -308,10 +427,6 @@ func (db *DB) CreateStudent(req *StudentRequest) (*Student, error) {
 
 	student.Username = req.Username
 
-	if err = tx.Commit(); err != nil {
-		return nil, err
-	}
-
 	return student, nil
 }
 
@@ -345,15 +460,20 @@ func (db *DB) UpdateStudent(id int, req *StudentRequest) (*Student, error) {
 
 	// Update user information if password is provided
 	if req.Password != "" {
+		var hash string
+		hash, err = db.hashPassword(req.Password)
+		if err != nil {
+			return nil, err
+		}
 		_, err = tx.Exec("UPDATE users SET password = $1 WHERE id = $2",
-			req.Password, userID)
+			hash, userID)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	// Update student information
-	now := time.Now()
+	now := time.Now().UTC()
 	student := &Student{}
 	studentQuery := `
 		UPDATE students 
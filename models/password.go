@@ -0,0 +1,323 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Limits of the passwords users may set
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72 // bcrypt only hashes the first 72 bytes and rejects longer passwords
+)
+
+// ErrInvalidPassword is returned when a new password is too short or too long
+var ErrInvalidPassword = errors.New("invalid password")
+
+// ValidatePassword checks a password that is about to be set. Every handler
+// that sets a password calls it, so that weak passwords are rejected with a
+// client error before they reach the hasher.
+//
+// Parameters:
+//   - password: New password
+//
+// Returns:
+//   - error: ErrInvalidPassword describing the problem, or nil
+func ValidatePassword(password string) error {
+	if problem := passwordProblem(password); problem != "" {
+		return fmt.Errorf("%w: %s", ErrInvalidPassword, problem)
+	}
+	return nil
+}
+
+// passwordProblem describes why a new password is rejected, or returns an empty string
+func passwordProblem(password string) string {
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return fmt.Sprintf("password must be at least %d characters", MinPasswordLength)
+	}
+	if len(password) > MaxPasswordLength {
+		return fmt.Sprintf("password must be at most %d bytes", MaxPasswordLength)
+	}
+	return ""
+}
+
+// PasswordHasher hashes and verifies user passwords.
+// Implementations produce self-describing encoded hashes so that a stored
+// value can always be verified regardless of which hasher is configured.
+type PasswordHasher interface {
+	// Hash returns the encoded hash of the given password
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches the encoded hash
+	Verify(encoded, password string) bool
+	// Matches reports whether the encoded hash was produced by this hasher
+	Matches(encoded string) bool
+}
+
+// BcryptHasher hashes passwords using bcrypt.
+type BcryptHasher struct {
+	Cost int // bcrypt cost factor, bcrypt.DefaultCost when zero
+}
+
+// Hash returns the bcrypt hash of the password.
+func (h BcryptHasher) Hash(password string) (string, error) {
+	cost := h.Cost
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify reports whether the password matches the bcrypt hash.
+func (h BcryptHasher) Verify(encoded, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+}
+
+// Matches reports whether the encoded value is a bcrypt hash.
+func (h BcryptHasher) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+// Argon2idHasher hashes passwords using argon2id.
+// Hashes are encoded in the PHC string format:
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+type Argon2idHasher struct {
+	Time    uint32 // Number of passes over memory
+	Memory  uint32 // Memory usage in KiB
+	Threads uint8  // Degree of parallelism
+	KeyLen  uint32 // Length of the derived key in bytes
+	SaltLen uint32 // Length of the random salt in bytes
+}
+
+// NewArgon2idHasher returns an Argon2idHasher with the recommended parameters.
+//
+// Returns:
+//   - Argon2idHasher: Hasher using 64 MiB of memory, one pass and four threads
+func NewArgon2idHasher() Argon2idHasher {
+	return Argon2idHasher{
+		Time:    1,
+		Memory:  64 * 1024,
+		Threads: 4,
+		KeyLen:  32,
+		SaltLen: 16,
+	}
+}
+
+const argon2idPrefix = "$argon2id$"
+
+// Bounds on the parameters of a stored argon2id hash. Hashes outside them
+// are rejected rather than computed, as argon2.IDKey panics on zero passes
+// or threads and a large memory cost would let one hash exhaust the server.
+const (
+	argon2idMaxMemory = 1024 * 1024 // KiB, 1 GiB
+	argon2idMaxTime   = 64
+	argon2idMinSalt   = 8
+	argon2idMinKey    = 4
+)
+
+// Hash returns the argon2id hash of the password in PHC string format.
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		h.Memory,
+		h.Time,
+		h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify reports whether the password matches the argon2id hash.
+// The parameters stored in the hash are used, not the hasher's own.
+func (h Argon2idHasher) Verify(encoded, password string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+
+	var memory, time, threads uint64
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+	if threads < 1 || threads > math.MaxUint8 ||
+		time < 1 || time > argon2idMaxTime ||
+		memory < 8*threads || memory > argon2idMaxMemory {
+		return false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) < argon2idMinSalt {
+		return false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) < argon2idMinKey {
+		return false
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, uint32(time), uint32(memory), uint8(threads), uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, candidate) == 1
+}
+
+// Matches reports whether the encoded value is an argon2id hash.
+func (h Argon2idHasher) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+// NewPasswordHasher returns the password hasher with the given name.
+//
+// Parameters:
+//   - name: Hasher name, either "bcrypt" or "argon2id" (empty means bcrypt)
+//
+// Returns:
+//   - PasswordHasher: The named hasher with default parameters
+//   - error: Error if the name is not recognised
+func NewPasswordHasher(name string) (PasswordHasher, error) {
+	switch name {
+	case "", "bcrypt":
+		return BcryptHasher{Cost: bcrypt.DefaultCost}, nil
+	case "argon2id":
+		return NewArgon2idHasher(), nil
+	default:
+		return nil, fmt.Errorf("unknown password hasher %q", name)
+	}
+}
+
+// knownHashers lists every hasher whose output may be stored in the users table.
+var knownHashers = []PasswordHasher{BcryptHasher{}, Argon2idHasher{}}
+
+// IsPasswordHash reports whether the stored password is a hash produced by one
+// of the supported hashers, as opposed to a legacy plaintext password.
+//
+// Parameters:
+//   - encoded: Value stored in users.password
+//
+// Returns:
+//   - bool: True if the value is a recognised hash
+func IsPasswordHash(encoded string) bool {
+	for _, h := range knownHashers {
+		if h.Matches(encoded) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyPassword checks a password against a stored value.
+// Legacy plaintext values are compared in constant time so that existing
+// accounts can still log in until they are upgraded.
+//
+// Parameters:
+//   - encoded: Value stored in users.password
+//   - password: Password to check
+//
+// Returns:
+//   - bool: True if the password matches
+func VerifyPassword(encoded, password string) bool {
+	for _, h := range knownHashers {
+		if h.Matches(encoded) {
+			return h.Verify(encoded, password)
+		}
+	}
+	return subtle.ConstantTimeCompare([]byte(encoded), []byte(password)) == 1
+}
+
+// dummyHashes caches the hash each hasher checks passwords of unknown users against
+var dummyHashes sync.Map
+
+// verifyDummyPassword checks a password against a hash made by the hasher,
+// taking as long as checking the password of an existing user
+func verifyDummyPassword(hasher PasswordHasher, password string) {
+	if hasher == nil {
+		hasher = BcryptHasher{}
+	}
+	encoded, ok := dummyHashes.Load(hasher)
+	if !ok {
+		hash, err := hasher.Hash("dummy password")
+		if err != nil {
+			return
+		}
+		encoded, _ = dummyHashes.LoadOrStore(hasher, hash)
+	}
+	hasher.Verify(encoded.(string), password)
+}
+
+// VerifyDummyPassword spends the time of a password check when no user
+// matches a login, so that response times do not reveal which usernames exist.
+//
+// Parameters:
+//   - password: Password given with the unknown username
+func (db *DB) VerifyDummyPassword(password string) {
+	verifyDummyPassword(db.Hasher, password)
+}
+
+// hashPassword hashes a password with the database's configured hasher.
+func (db *DB) hashPassword(password string) (string, error) {
+	hasher := db.Hasher
+	if hasher == nil {
+		hasher = BcryptHasher{}
+	}
+	return hasher.Hash(password)
+}
+
+// PasswordNeedsUpgrade reports whether a user's stored password should be
+// rewritten, either because it is legacy plaintext or because it was hashed
+// with a different algorithm than the one currently configured.
+//
+// Parameters:
+//   - user: User whose stored password to inspect
+//
+// Returns:
+//   - bool: True if the password should be rehashed after a successful login
+func (db *DB) PasswordNeedsUpgrade(user *User) bool {
+	if !IsPasswordHash(user.Password) {
+		return true
+	}
+	return db.Hasher != nil && !db.Hasher.Matches(user.Password)
+}
+
+// UpdateUserPassword hashes and stores a new password for a user.
+//
+// Parameters:
+//   - userID: ID of the user to update
+//   - password: New plaintext password
+//
+// Returns:
+//   - error: Error if hashing or the update fails
+func (db *DB) UpdateUserPassword(userID int, password string) error {
+	hash, err := db.hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("UPDATE users SET password = $1 WHERE id = $2", hash, userID)
+	return err
+}
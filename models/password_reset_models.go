@@ -0,0 +1,175 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrInvalidResetToken is returned when a password reset token is unknown,
+// expired or already used
+var ErrInvalidResetToken = errors.New("password reset token is invalid, expired or already used")
+
+// PasswordResetToken represents a single-use token allowing a user to set a
+// new password without knowing the current one
+type PasswordResetToken struct {
+	ID        int        `json:"id"`         // Unique identifier
+	UserID    int        `json:"user_id"`    // User whose password may be reset
+	TokenHash string     `json:"-"`          // SHA-256 hash of the token (see HashToken)
+	ExpiresAt time.Time  `json:"expires_at"` // Expiry timestamp
+	UsedAt    *time.Time `json:"used_at"`    // When the token was used or invalidated, nil while valid
+	CreatedAt time.Time  `json:"created_at"` // Creation timestamp
+}
+
+// GetUsersByEmail retrieves the users whose student record, teacher profile
+// or guardian profile holds an email address, ignoring case
+//
+// Parameters:
+//   - email: Email address to look up
+//
+// Returns:
+//   - []*User: Matching users ordered by ID; usually one, empty if none
+//   - error: A database error
+func (db *DB) GetUsersByEmail(email string) ([]*User, error) {
+	rows, err := db.Query(`
+		SELECT id, username, password, role, is_active, date_created, display_name, must_change_password, locked_until
+		FROM users
+		WHERE id IN (
+			SELECT user_id FROM students WHERE LOWER(email) = LOWER($1)
+			UNION SELECT user_id FROM teacher_profiles WHERE LOWER(email) = LOWER($1)
+			UNION SELECT user_id FROM guardian_profiles WHERE LOWER(email) = LOWER($1)
+		)
+		ORDER BY id`,
+		email,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		user := &User{}
+		err := rows.Scan(
+			&user.ID,
+			&user.Username,
+			&user.Password,
+			&user.Role,
+			&user.Active,
+			&user.DateCreated,
+			&user.DisplayName,
+			&user.MustChangePassword,
+			&user.LockedUntil,
+		)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// RequirePasswordChange flags a user so that their next login is refused
+// until they set a new password
+//
+// Parameters:
+//   - userID: User to flag
+//
+// Returns:
+//   - error: sql.ErrNoRows if the user does not exist, or a database error
+func (db *DB) RequirePasswordChange(userID int) error {
+	res, err := db.Exec("UPDATE users SET must_change_password = TRUE WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CreatePasswordResetToken stores a new password reset token for a user
+//
+// Parameters:
+//   - userID: User whose password may be reset
+//   - tokenHash: SHA-256 hash of the token (see HashToken)
+//   - expiresAt: Expiry timestamp
+//
+// Returns:
+//   - error: Error if the token cannot be stored
+func (db *DB) CreatePasswordResetToken(userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := db.Exec(
+		"INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4)",
+		userID, tokenHash, expiresAt, time.Now().UTC(),
+	)
+	return err
+}
+
+// ResetPassword uses a password reset token to set a new password. The token
+// and every other unused token of the user are invalidated, and the user's
+// must_change_password flag is cleared. This operation is performed in a
+// transaction, so a token can only be used once even by concurrent requests.
+//
+// Parameters:
+//   - tokenHash: SHA-256 hash of the token presented by the user
+//   - password: New password, hashed with the configured hasher
+//
+// Returns:
+//   - int: ID of the user whose password was reset
+//   - error: ErrInvalidResetToken if the token is unknown, expired or used, or a database error
+func (db *DB) ResetPassword(tokenHash, password string) (int, error) {
+	hash, err := db.hashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Claim the token, so that a concurrent reset with it fails
+	now := time.Now().UTC()
+	var userID int
+	err = tx.QueryRow(`
+		UPDATE password_reset_tokens SET used_at = $1
+		WHERE token_hash = $2 AND used_at IS NULL AND expires_at > $1
+		RETURNING user_id`,
+		now, tokenHash,
+	).Scan(&userID)
+	if err == sql.ErrNoRows {
+		err = ErrInvalidResetToken
+		return 0, err
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE password_reset_tokens SET used_at = $1 WHERE user_id = $2 AND used_at IS NULL",
+		now, userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE users SET password = $1, must_change_password = FALSE WHERE id = $2",
+		hash, userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
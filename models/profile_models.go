@@ -0,0 +1,137 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Limits of the fields users may change themselves
+const (
+	MaxDisplayNameLength = 100
+	MaxEmailLength       = 100 // Shortest email column of the profile tables
+)
+
+// ErrInvalidProfile is returned when a self-service profile update is invalid
+var ErrInvalidProfile = errors.New("invalid profile")
+
+// ProfileRequest is used by users to update their own profile. Other fields,
+// such as names and grades, are managed by admins.
+type ProfileRequest struct {
+	DisplayName     string `json:"display_name"`     // Name to show, empty to show the username
+	Email           string `json:"email"`            // Email address, only for roles with a profile
+	CurrentPassword string `json:"current_password"` // The user's password, required to change the email address
+}
+
+// ProfileHasEmail reports whether users of a role have a student, teacher or
+// guardian record holding their email address
+func ProfileHasEmail(role string) bool {
+	return role == RoleStudent || role == RoleTeacher || role == RoleGuardian
+}
+
+// ValidateProfile trims and checks a self-service profile update
+//
+// Parameters:
+//   - req: Update request, whose fields are trimmed in place
+//   - role: Role of the user updating their profile
+//
+// Returns:
+//   - error: ErrInvalidProfile describing the problem, or nil
+func ValidateProfile(req *ProfileRequest, role string) error {
+	req.DisplayName = strings.TrimSpace(req.DisplayName)
+	req.Email = strings.TrimSpace(req.Email)
+
+	if len(req.DisplayName) > MaxDisplayNameLength {
+		return fmt.Errorf("%w: display_name must be at most %d characters", ErrInvalidProfile, MaxDisplayNameLength)
+	}
+
+	if !ProfileHasEmail(role) {
+		if req.Email != "" {
+			return fmt.Errorf("%w: accounts with the %s role have no email address", ErrInvalidProfile, role)
+		}
+		return nil
+	}
+	if req.Email == "" {
+		return fmt.Errorf("%w: email is required", ErrInvalidProfile)
+	}
+	if len(req.Email) > MaxEmailLength {
+		return fmt.Errorf("%w: email must be at most %d characters", ErrInvalidProfile, MaxEmailLength)
+	}
+	if addr, err := mail.ParseAddress(req.Email); err != nil || addr.Address != req.Email {
+		return fmt.Errorf("%w: email is not a valid address", ErrInvalidProfile)
+	}
+	return nil
+}
+
+// UpdateProfile changes a user's display name and, for students, teachers and
+// guardians, the email address in their record
+//
+// Parameters:
+//   - userID: User updating their own profile
+//   - req: Validated update request
+//
+// Returns:
+//   - *User: Updated user
+//   - error: sql.ErrNoRows if the user does not exist, a duplicate email
+//     error, or a database error
+func (db *DB) UpdateProfile(userID int, req *ProfileRequest) (*User, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	user := &User{}
+	err = tx.QueryRow(`
+		UPDATE users SET display_name = $1 WHERE id = $2
+		RETURNING id, username, password, role, is_active, date_created, display_name, must_change_password, locked_until`,
+		req.DisplayName, userID,
+	).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Password,
+		&user.Role,
+		&user.Active,
+		&user.DateCreated,
+		&user.DisplayName,
+		&user.MustChangePassword,
+		&user.LockedUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// The email lives in the record of the user's role; teachers and
+	// guardians given their role through role management may not have one yet
+	now := time.Now().UTC()
+	switch user.Role {
+	case RoleStudent:
+		_, err = tx.Exec("UPDATE students SET email = $1, updated_at = $2 WHERE user_id = $3", req.Email, now, userID)
+	case RoleTeacher:
+		_, err = tx.Exec(`
+			INSERT INTO teacher_profiles (user_id, email, created_at, updated_at) VALUES ($1, $2, $3, $3)
+			ON CONFLICT (user_id) DO UPDATE SET email = EXCLUDED.email, updated_at = EXCLUDED.updated_at`,
+			userID, req.Email, now)
+	case RoleGuardian:
+		_, err = tx.Exec(`
+			INSERT INTO guardian_profiles (user_id, email, created_at, updated_at) VALUES ($1, $2, $3, $3)
+			ON CONFLICT (user_id) DO UPDATE SET email = EXCLUDED.email, updated_at = EXCLUDED.updated_at`,
+			userID, req.Email, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
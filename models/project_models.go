@@ -0,0 +1,1029 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"wg-edu-server/storage"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of supervised project
+const (
+	ProjectEE = "ee" // Extended Essay, one per student
+	ProjectIA = "ia" // Internal Assessment of a subject the student takes
+)
+
+// Statuses of a project on the status board
+const (
+	ProjectBehind   = "behind"   // A milestone is past its due date and not completed
+	ProjectOnTrack  = "on_track" // No milestone is overdue
+	ProjectComplete = "complete" // Every milestone is completed
+)
+
+// Errors returned by project operations
+var (
+	// ErrInvalidProject is returned for an invalid project, milestone, draft or
+	// comment. The wrapped message describes the problem.
+	ErrInvalidProject = errors.New("invalid project")
+	// ErrProjectExists is returned when a student already has an EE, or an IA in the subject
+	ErrProjectExists = errors.New("student already has this project")
+)
+
+// Project is an Extended Essay or Internal Assessment supervised by a teacher
+type Project struct {
+	ID             int                 `json:"id"`                       // Unique identifier
+	Kind           string              `json:"kind"`                     // ee or ia
+	StudentID      int                 `json:"student_id"`               // Reference to students table
+	StudentName    string              `json:"student_name"`             // First and last name (added for convenience)
+	Grade          string              `json:"grade"`                    // Student's grade (added for convenience)
+	SubjectID      int                 `json:"subject_id"`               // Subject of the essay or assessment
+	SubjectName    string              `json:"subject_name"`             // Subject name (added for convenience)
+	SupervisorID   int                 `json:"supervisor_id,omitempty"`  // Teacher's user ID, 0 if deleted
+	SupervisorName string              `json:"supervisor_name"`          // Teacher's name (added for convenience)
+	Title          string              `json:"title"`                    // Working title, may be empty
+	Milestones     []*ProjectMilestone `json:"milestones"`               // Checkpoints, earliest due first
+	DraftCount     int                 `json:"draft_count"`              // Drafts uploaded
+	LastDraftAt    *time.Time          `json:"last_draft_at,omitempty"`  // Time of the latest draft
+	Status         string              `json:"status"`                   // behind, on_track or complete, set by Evaluate
+	Completed      int                 `json:"milestones_completed"`     // Completed milestones, set by Evaluate
+	Overdue        int                 `json:"milestones_overdue"`       // Overdue milestones, set by Evaluate
+	NextMilestone  *ProjectMilestone   `json:"next_milestone,omitempty"` // Earliest milestone not completed, set by Evaluate
+	CreatedAt      time.Time           `json:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at"`
+}
+
+// ProjectMilestone is a checkpoint of a project with a due date
+type ProjectMilestone struct {
+	ID          int        `json:"id"`                     // Unique identifier
+	ProjectID   int        `json:"project_id"`             // Reference to projects table
+	Name        string     `json:"name"`                   // e.g. "Research question" or "First draft"
+	DueDate     time.Time  `json:"due_date"`               // Day the checkpoint is due
+	CompletedAt *time.Time `json:"completed_at,omitempty"` // Time the supervisor signed it off, null if open
+	CompletedBy int        `json:"completed_by,omitempty"` // User who signed it off, 0 if open or deleted
+	Overdue     bool       `json:"overdue"`                // Past due and not completed, set by Evaluate
+}
+
+// ProjectDetails is a project with its drafts and comments
+type ProjectDetails struct {
+	*Project
+	Drafts   []*ProjectDraft   `json:"drafts"`   // Uploaded drafts without content, most recent first
+	Comments []*ProjectComment `json:"comments"` // Supervisor comments, oldest first
+}
+
+// ProjectDraft is a file uploaded for a project
+type ProjectDraft struct {
+	ID          int       `json:"id"`                     // Unique identifier
+	ProjectID   int       `json:"project_id"`             // Reference to projects table
+	MilestoneID int       `json:"milestone_id,omitempty"` // Milestone the draft is for, 0 if none
+	Filename    string    `json:"filename"`               // Name of the uploaded file
+	ContentType string    `json:"content_type"`           // MIME type of the file
+	Size        int64     `json:"size"`                   // Size in bytes
+	UploadedBy  int       `json:"uploaded_by,omitempty"`  // Uploader's user ID, 0 if deleted
+	UploadedAt  time.Time `json:"uploaded_at"`
+	StorageKey  string    `json:"-"` // Key of the content on the storage backend
+}
+
+// ProjectComment is a supervisor's comment on a project or one of its drafts
+type ProjectComment struct {
+	ID         int       `json:"id"`                 // Unique identifier
+	ProjectID  int       `json:"project_id"`         // Reference to projects table
+	DraftID    int       `json:"draft_id,omitempty"` // Draft commented on, 0 for the project as a whole
+	AuthorID   int       `json:"author_id"`          // Author's user ID, 0 if deleted
+	AuthorName string    `json:"author_name"`        // Author's name (added for convenience)
+	Body       string    `json:"body"`               // Comment text
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ProjectRequest is used for assigning a supervisor to a student's EE or IA
+type ProjectRequest struct {
+	Kind         string             `json:"kind"`          // ee or ia
+	StudentID    int                `json:"student_id"`    // IB1 or IB2 student
+	SubjectID    int                `json:"subject_id"`    // IB subject; for an IA one the student is enrolled in
+	SupervisorID int                `json:"supervisor_id"` // User ID of an active teacher
+	Title        string             `json:"title"`         // Optional working title
+	Milestones   []MilestoneRequest `json:"milestones"`    // Optional initial checkpoints
+}
+
+// ProjectUpdateRequest is used for changing a project's supervisor or title
+type ProjectUpdateRequest struct {
+	SupervisorID int    `json:"supervisor_id"` // User ID of an active teacher
+	Title        string `json:"title"`         // Optional working title
+}
+
+// MilestoneRequest is used for adding or editing a milestone
+type MilestoneRequest struct {
+	Name    string `json:"name"`     // Required
+	DueDate string `json:"due_date"` // YYYY-MM-DD
+}
+
+// MilestoneCompletionRequest is used for signing off or reopening a milestone
+type MilestoneCompletionRequest struct {
+	Completed bool `json:"completed"`
+}
+
+// ProjectCommentRequest is used for commenting on a project
+type ProjectCommentRequest struct {
+	Body    string `json:"body"`     // Required
+	DraftID int    `json:"draft_id"` // Optional draft of the same project
+}
+
+// ProjectBoard lists the projects of a grade with their status
+type ProjectBoard struct {
+	Grade    string         `json:"grade"`    // IB1 or IB2
+	Kind     string         `json:"kind"`     // ee or ia, empty for both
+	Date     time.Time      `json:"date"`     // Day the statuses were evaluated on
+	Counts   map[string]int `json:"counts"`   // Projects per status
+	Projects []*Project     `json:"projects"` // Projects behind first, then on track, then complete
+}
+
+// ValidateMilestone checks and normalizes a milestone request in place
+//
+// Parameters:
+//   - req: Milestone to check
+//
+// Returns:
+//   - time.Time: Due date
+//   - error: ErrInvalidProject wrapped with the problem, or nil
+func ValidateMilestone(req *MilestoneRequest) (time.Time, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		return time.Time{}, fmt.Errorf("%w: milestone name must be 1 to 100 characters", ErrInvalidProject)
+	}
+	due, err := time.Parse(LessonDateLayout, strings.TrimSpace(req.DueDate))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: due_date must be formatted as YYYY-MM-DD", ErrInvalidProject)
+	}
+	return due, nil
+}
+
+// ValidateProject checks and normalizes a project request in place. The kind
+// is lower-cased.
+//
+// Parameters:
+//   - req: Project to check
+//
+// Returns:
+//   - []time.Time: Due date of each requested milestone
+//   - error: ErrInvalidProject wrapped with the first problem, or nil
+func ValidateProject(req *ProjectRequest) ([]time.Time, error) {
+	req.Kind = strings.ToLower(strings.TrimSpace(req.Kind))
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Kind != ProjectEE && req.Kind != ProjectIA {
+		return nil, fmt.Errorf("%w: kind must be ee or ia", ErrInvalidProject)
+	}
+	if req.StudentID == 0 || req.SubjectID == 0 || req.SupervisorID == 0 {
+		return nil, fmt.Errorf("%w: student_id, subject_id and supervisor_id are required", ErrInvalidProject)
+	}
+	if len(req.Title) > 200 {
+		return nil, fmt.Errorf("%w: title must be at most 200 characters", ErrInvalidProject)
+	}
+
+	dues := make([]time.Time, len(req.Milestones))
+	for i := range req.Milestones {
+		due, err := ValidateMilestone(&req.Milestones[i])
+		if err != nil {
+			return nil, err
+		}
+		dues[i] = due
+	}
+	return dues, nil
+}
+
+// ValidateProjectUpdate checks and normalizes a project update in place
+//
+// Returns:
+//   - error: ErrInvalidProject wrapped with the problem, or nil
+func ValidateProjectUpdate(req *ProjectUpdateRequest) error {
+	req.Title = strings.TrimSpace(req.Title)
+	if req.SupervisorID == 0 {
+		return fmt.Errorf("%w: supervisor_id is required", ErrInvalidProject)
+	}
+	if len(req.Title) > 200 {
+		return fmt.Errorf("%w: title must be at most 200 characters", ErrInvalidProject)
+	}
+	return nil
+}
+
+// ValidateProjectComment checks and normalizes a comment request in place
+//
+// Returns:
+//   - error: ErrInvalidProject wrapped with the problem, or nil
+func ValidateProjectComment(req *ProjectCommentRequest) error {
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" {
+		return fmt.Errorf("%w: comment body is required", ErrInvalidProject)
+	}
+	return nil
+}
+
+// Evaluate marks the overdue milestones of a project and sets its status as
+// of a day. A project without milestones is on track.
+//
+// Parameters:
+//   - today: Day to evaluate on; milestones due before it and not completed are overdue
+func (p *Project) Evaluate(today time.Time) {
+	p.Completed, p.Overdue, p.NextMilestone = 0, 0, nil
+	for _, milestone := range p.Milestones {
+		milestone.Overdue = milestone.CompletedAt == nil && milestone.DueDate.Before(today)
+		switch {
+		case milestone.CompletedAt != nil:
+			p.Completed++
+		case milestone.Overdue:
+			p.Overdue++
+		}
+		if milestone.CompletedAt == nil && p.NextMilestone == nil {
+			p.NextMilestone = milestone
+		}
+	}
+
+	switch {
+	case p.Overdue > 0:
+		p.Status = ProjectBehind
+	case len(p.Milestones) > 0 && p.Completed == len(p.Milestones):
+		p.Status = ProjectComplete
+	default:
+		p.Status = ProjectOnTrack
+	}
+}
+
+// BuildProjectBoard evaluates the projects of a grade and orders them so the
+// students who are behind come first
+//
+// Parameters:
+//   - grade, kind: Filters the projects were selected with
+//   - projects: Projects to evaluate, sorted by student name
+//   - today: Day to evaluate on
+//
+// Returns:
+//   - *ProjectBoard: Board with the counts per status
+func BuildProjectBoard(grade, kind string, projects []*Project, today time.Time) *ProjectBoard {
+	board := &ProjectBoard{
+		Grade:    grade,
+		Kind:     kind,
+		Date:     today,
+		Counts:   map[string]int{ProjectBehind: 0, ProjectOnTrack: 0, ProjectComplete: 0},
+		Projects: projects,
+	}
+	for _, p := range projects {
+		p.Evaluate(today)
+		board.Counts[p.Status]++
+	}
+
+	rank := map[string]int{ProjectBehind: 0, ProjectOnTrack: 1, ProjectComplete: 2}
+	sort.SliceStable(projects, func(i, j int) bool {
+		return rank[projects[i].Status] < rank[projects[j].Status]
+	})
+	return board
+}
+
+// checkProjectStudent checks that a student may have the requested project:
+// the student must be in IB1 or IB2 and the subject an IB subject that is not
+// archived; for an IA the student must be enrolled in it
+//
+// Parameters:
+//   - student: Student the project is for
+//   - subject: Subject of the project
+//   - enrolled: Whether the student is enrolled in the subject
+//   - kind: ee or ia
+//
+// Returns:
+//   - error: ErrInvalidProject wrapped with the problem, or nil
+func checkProjectStudent(student *Student, subject *Subject, enrolled bool, kind string) error {
+	if !IsDiplomaGrade(student.Grade) {
+		return fmt.Errorf("%w: EEs and IAs only apply to IB1 and IB2 students", ErrInvalidProject)
+	}
+	if subject.Group == 0 || subject.Archived {
+		return fmt.Errorf("%w: subject must be an IB subject that is not archived", ErrInvalidProject)
+	}
+	if kind == ProjectIA && !enrolled {
+		return fmt.Errorf("%w: student is not enrolled in the subject", ErrInvalidProject)
+	}
+	return nil
+}
+
+// projectSelect selects the columns scanned by scanProject
+const projectSelect = `
+	SELECT p.id, p.kind, p.student_id, s.first_name || ' ' || s.last_name, s.grade, p.subject_id, sub.name,
+		COALESCE(p.supervisor_id, 0), COALESCE(tp.first_name || ' ' || tp.last_name, u.username, ''), p.title,
+		(SELECT COUNT(*) FROM project_drafts d WHERE d.project_id = p.id),
+		(SELECT MAX(d.uploaded_at) FROM project_drafts d WHERE d.project_id = p.id),
+		p.created_at, p.updated_at
+	FROM projects p
+	JOIN students s ON s.id = p.student_id
+	JOIN subjects sub ON sub.id = p.subject_id
+	LEFT JOIN users u ON u.id = p.supervisor_id
+	LEFT JOIN teacher_profiles tp ON tp.user_id = p.supervisor_id`
+
+// scanProject scans a row selected with projectSelect
+func scanProject(row interface{ Scan(...interface{}) error }) (*Project, error) {
+	p := &Project{Milestones: []*ProjectMilestone{}}
+	var lastDraft sql.NullTime
+	err := row.Scan(
+		&p.ID, &p.Kind, &p.StudentID, &p.StudentName, &p.Grade, &p.SubjectID, &p.SubjectName,
+		&p.SupervisorID, &p.SupervisorName, &p.Title, &p.DraftCount, &lastDraft, &p.CreatedAt, &p.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if lastDraft.Valid {
+		p.LastDraftAt = &lastDraft.Time
+	}
+	return p, nil
+}
+
+// milestoneSelect selects the columns scanned by scanMilestone
+const milestoneSelect = `
+	SELECT id, project_id, name, due_date, completed_at, COALESCE(completed_by, 0)
+	FROM project_milestones`
+
+// scanMilestone scans a row selected with milestoneSelect
+func scanMilestone(row interface{ Scan(...interface{}) error }) (*ProjectMilestone, error) {
+	m := &ProjectMilestone{}
+	var completed sql.NullTime
+	if err := row.Scan(&m.ID, &m.ProjectID, &m.Name, &m.DueDate, &completed, &m.CompletedBy); err != nil {
+		return nil, err
+	}
+	if completed.Valid {
+		m.CompletedAt = &completed.Time
+	}
+	return m, nil
+}
+
+// queryProjects selects the projects matching a condition with their
+// milestones, ordered by student name
+func (db *DB) queryProjects(where string, args ...interface{}) ([]*Project, error) {
+	rows, err := db.Query(projectSelect+" WHERE "+where+" ORDER BY s.last_name, s.first_name, p.kind, sub.name", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := []*Project{}
+	byID := map[int]*Project{}
+	ids := []int64{}
+	for rows.Next() {
+		p, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, p)
+		byID[p.ID] = p
+		ids = append(ids, int64(p.ID))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(projects) == 0 {
+		return projects, nil
+	}
+
+	milestones, err := db.Query(milestoneSelect+" WHERE project_id = ANY($1) ORDER BY due_date, id", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer milestones.Close()
+
+	for milestones.Next() {
+		m, err := scanMilestone(milestones)
+		if err != nil {
+			return nil, err
+		}
+		byID[m.ProjectID].Milestones = append(byID[m.ProjectID].Milestones, m)
+	}
+
+	if err = milestones.Err(); err != nil {
+		return nil, err
+	}
+
+	return projects, nil
+}
+
+// GetProject retrieves a project with its milestones
+//
+// Parameters:
+//   - id: Project to retrieve
+//
+// Returns:
+//   - *Project: Project with student, subject and supervisor names
+//   - error: sql.ErrNoRows if the project does not exist, or a database error
+func (db *DB) GetProject(id int) (*Project, error) {
+	projects, err := db.queryProjects("p.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(projects) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return projects[0], nil
+}
+
+// GetStudentProjects retrieves a student's EE and IAs
+//
+// Parameters:
+//   - studentID: Student whose projects are retrieved
+//
+// Returns:
+//   - []*Project: Projects with their milestones
+//   - error: Error if retrieval fails
+func (db *DB) GetStudentProjects(studentID int) ([]*Project, error) {
+	return db.queryProjects("p.student_id = $1", studentID)
+}
+
+// GetSupervisedProjects retrieves the projects a teacher supervises
+//
+// Parameters:
+//   - supervisorID: Teacher's user ID
+//
+// Returns:
+//   - []*Project: Projects with their milestones, ordered by student name
+//   - error: Error if retrieval fails
+func (db *DB) GetSupervisedProjects(supervisorID int) ([]*Project, error) {
+	return db.queryProjects("p.supervisor_id = $1", supervisorID)
+}
+
+// GetGradeProjects retrieves the projects of the students in a grade
+//
+// Parameters:
+//   - grade: Students' grade
+//   - kind: ee or ia, empty for both
+//
+// Returns:
+//   - []*Project: Projects with their milestones, ordered by student name
+//   - error: Error if retrieval fails
+func (db *DB) GetGradeProjects(grade, kind string) ([]*Project, error) {
+	return db.queryProjects("s.grade = $1 AND ($2 = '' OR p.kind = $2)", grade, kind)
+}
+
+// CreateProject assigns a supervisor to a student's EE or IA and adds the initial milestones
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - req: Student, subject, supervisor and milestones
+//
+// Returns:
+//   - *Project: Created project
+//   - error: ErrInvalidProject, ErrProjectExists, or a database error
+func (db *DB) CreateProject(req *ProjectRequest) (*Project, error) {
+	dues, err := ValidateProject(req)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	student := &Student{}
+	err = tx.QueryRow("SELECT id, grade FROM students WHERE id = $1", req.StudentID).Scan(&student.ID, &student.Grade)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = fmt.Errorf("%w: student not found", ErrInvalidProject)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	subject := &Subject{}
+	var group sql.NullInt64
+	var enrolled bool
+	err = tx.QueryRow(`
+		SELECT id, subject_group, archived,
+		       EXISTS(SELECT 1 FROM enrollments WHERE student_id = $2 AND subject_id = $1)
+		FROM subjects WHERE id = $1 FOR SHARE`,
+		req.SubjectID, req.StudentID,
+	).Scan(&subject.ID, &group, &subject.Archived, &enrolled)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = fmt.Errorf("%w: subject not found", ErrInvalidProject)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	subject.Group = int(group.Int64)
+
+	if err = checkProjectStudent(student, subject, enrolled, req.Kind); err != nil {
+		return nil, err
+	}
+	if err = requireSupervisor(tx, req.SupervisorID, ErrInvalidProject); err != nil {
+		return nil, err
+	}
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO projects (kind, student_id, subject_id, supervisor_id, title)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`,
+		req.Kind, req.StudentID, req.SubjectID, req.SupervisorID, req.Title,
+	).Scan(&id)
+	if IsDuplicate(err) {
+		err = ErrProjectExists
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i, milestone := range req.Milestones {
+		_, err = tx.Exec(
+			"INSERT INTO project_milestones (project_id, name, due_date) VALUES ($1, $2, $3)",
+			id, milestone.Name, dues[i],
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return db.GetProject(id)
+}
+
+// UpdateProject changes a project's supervisor and title
+//
+// Parameters:
+//   - id: Project to update
+//   - req: New supervisor and title
+//
+// Returns:
+//   - *Project: Updated project
+//   - error: sql.ErrNoRows if the project does not exist, ErrInvalidProject, or a database error
+func (db *DB) UpdateProject(id int, req *ProjectUpdateRequest) (*Project, error) {
+	if err := ValidateProjectUpdate(req); err != nil {
+		return nil, err
+	}
+	if err := requireSupervisor(db, req.SupervisorID, ErrInvalidProject); err != nil {
+		return nil, err
+	}
+
+	result, err := db.Exec(
+		"UPDATE projects SET supervisor_id = $1, title = $2, updated_at = NOW() WHERE id = $3",
+		req.SupervisorID, req.Title, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return db.GetProject(id)
+}
+
+// DeleteProject deletes a project with its milestones, drafts and comments
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - id: Project to delete
+//
+// Returns:
+//   - []string: Storage keys of the deleted drafts, for removing their content
+//   - error: sql.ErrNoRows if the project does not exist, or a database error
+func (db *DB) DeleteProject(id int) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	keys := []string{}
+	rows, err := tx.Query(`
+		SELECT storage_key FROM project_drafts
+		WHERE project_id = $1 AND storage_key IS NOT NULL
+		FOR UPDATE`, id)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec("DELETE FROM projects WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		err = sql.ErrNoRows
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// AddMilestone adds a checkpoint to a project
+//
+// Parameters:
+//   - projectID: Project the milestone belongs to
+//   - req: Name and due date
+//
+// Returns:
+//   - *ProjectMilestone: Created milestone
+//   - error: sql.ErrNoRows if the project does not exist, ErrInvalidProject, or a database error
+func (db *DB) AddMilestone(projectID int, req *MilestoneRequest) (*ProjectMilestone, error) {
+	due, err := ValidateMilestone(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM projects WHERE id = $1)", projectID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	return scanMilestone(db.QueryRow(`
+		INSERT INTO project_milestones (project_id, name, due_date)
+		VALUES ($1, $2, $3)
+		RETURNING id, project_id, name, due_date, completed_at, COALESCE(completed_by, 0)`,
+		projectID, req.Name, due,
+	))
+}
+
+// UpdateMilestone renames a milestone or moves its due date
+//
+// Parameters:
+//   - projectID: Project the milestone belongs to
+//   - milestoneID: Milestone to update
+//   - req: New name and due date
+//
+// Returns:
+//   - *ProjectMilestone: Updated milestone
+//   - error: sql.ErrNoRows if the project has no such milestone, ErrInvalidProject, or a database error
+func (db *DB) UpdateMilestone(projectID, milestoneID int, req *MilestoneRequest) (*ProjectMilestone, error) {
+	due, err := ValidateMilestone(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMilestone(db.QueryRow(`
+		UPDATE project_milestones SET name = $1, due_date = $2
+		WHERE id = $3 AND project_id = $4
+		RETURNING id, project_id, name, due_date, completed_at, COALESCE(completed_by, 0)`,
+		req.Name, due, milestoneID, projectID,
+	))
+}
+
+// SetMilestoneCompleted signs off a milestone or reopens it
+//
+// Parameters:
+//   - projectID: Project the milestone belongs to
+//   - milestoneID: Milestone to update
+//   - userID: User signing it off
+//   - completed: True to sign it off, false to reopen it
+//
+// Returns:
+//   - *ProjectMilestone: Updated milestone; signing off a completed milestone keeps its original time
+//   - error: sql.ErrNoRows if the project has no such milestone, or a database error
+func (db *DB) SetMilestoneCompleted(projectID, milestoneID, userID int, completed bool) (*ProjectMilestone, error) {
+	query := `
+		UPDATE project_milestones
+		SET completed_at = COALESCE(completed_at, NOW()), completed_by = COALESCE(completed_by, $1)
+		WHERE id = $2 AND project_id = $3
+		RETURNING id, project_id, name, due_date, completed_at, COALESCE(completed_by, 0)`
+	args := []interface{}{userID, milestoneID, projectID}
+	if !completed {
+		query = `
+			UPDATE project_milestones SET completed_at = NULL, completed_by = NULL
+			WHERE id = $1 AND project_id = $2
+			RETURNING id, project_id, name, due_date, completed_at, COALESCE(completed_by, 0)`
+		args = args[1:]
+	}
+	return scanMilestone(db.QueryRow(query, args...))
+}
+
+// DeleteMilestone deletes a milestone. Drafts uploaded for it are kept.
+//
+// Parameters:
+//   - projectID: Project the milestone belongs to
+//   - milestoneID: Milestone to delete
+//
+// Returns:
+//   - error: sql.ErrNoRows if the project has no such milestone, or a database error
+func (db *DB) DeleteMilestone(projectID, milestoneID int) error {
+	result, err := db.Exec("DELETE FROM project_milestones WHERE id = $1 AND project_id = $2", milestoneID, projectID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AddProjectDraft records a draft uploaded for a project whose content is
+// already on the storage backend
+//
+// Parameters:
+//   - projectID: Project the draft belongs to
+//   - draft: Milestone, file name, content type, size, storage key and uploader
+//
+// Returns:
+//   - *ProjectDraft: Stored draft
+//   - error: sql.ErrNoRows if the project does not exist, ErrInvalidProject if the
+//     milestone belongs to another project, or a database error
+func (db *DB) AddProjectDraft(projectID int, draft *ProjectDraft) (*ProjectDraft, error) {
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM projects WHERE id = $1)", projectID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	var milestone sql.NullInt64
+	if draft.MilestoneID != 0 {
+		err := db.QueryRow(
+			"SELECT EXISTS(SELECT 1 FROM project_milestones WHERE id = $1 AND project_id = $2)",
+			draft.MilestoneID, projectID,
+		).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("%w: milestone does not belong to the project", ErrInvalidProject)
+		}
+		milestone = sql.NullInt64{Int64: int64(draft.MilestoneID), Valid: true}
+	}
+
+	stored := &ProjectDraft{
+		ProjectID:   projectID,
+		MilestoneID: draft.MilestoneID,
+		Filename:    draft.Filename,
+		ContentType: draft.ContentType,
+		Size:        draft.Size,
+		UploadedBy:  draft.UploadedBy,
+		StorageKey:  draft.StorageKey,
+	}
+	err := db.QueryRow(`
+		INSERT INTO project_drafts (project_id, milestone_id, filename, content_type, size, storage_key, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, uploaded_at`,
+		projectID, milestone, stored.Filename, stored.ContentType, stored.Size, stored.StorageKey, draft.UploadedBy,
+	).Scan(&stored.ID, &stored.UploadedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return stored, nil
+}
+
+// GetProjectDrafts retrieves the drafts of a project
+//
+// Parameters:
+//   - projectID: Project whose drafts are retrieved
+//
+// Returns:
+//   - []*ProjectDraft: Drafts, most recent first
+//   - error: Error if retrieval fails
+func (db *DB) GetProjectDrafts(projectID int) ([]*ProjectDraft, error) {
+	rows, err := db.Query(`
+		SELECT id, project_id, COALESCE(milestone_id, 0), filename, content_type, size,
+		       COALESCE(uploaded_by, 0), uploaded_at
+		FROM project_drafts
+		WHERE project_id = $1
+		ORDER BY uploaded_at DESC, id DESC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drafts := []*ProjectDraft{}
+	for rows.Next() {
+		d := &ProjectDraft{}
+		err := rows.Scan(&d.ID, &d.ProjectID, &d.MilestoneID, &d.Filename, &d.ContentType, &d.Size, &d.UploadedBy, &d.UploadedAt)
+		if err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return drafts, nil
+}
+
+// GetProjectDraft retrieves a draft with its storage key
+//
+// Parameters:
+//   - projectID: Project the draft belongs to
+//   - draftID: Draft to retrieve
+//
+// Returns:
+//   - *ProjectDraft: Draft including StorageKey
+//   - error: sql.ErrNoRows if the project has no such draft, or a database error
+func (db *DB) GetProjectDraft(projectID, draftID int) (*ProjectDraft, error) {
+	d := &ProjectDraft{}
+	err := db.QueryRow(`
+		SELECT id, project_id, COALESCE(milestone_id, 0), filename, content_type, size,
+		       COALESCE(uploaded_by, 0), uploaded_at, COALESCE(storage_key, '')
+		FROM project_drafts
+		WHERE id = $1 AND project_id = $2`, draftID, projectID,
+	).Scan(&d.ID, &d.ProjectID, &d.MilestoneID, &d.Filename, &d.ContentType, &d.Size, &d.UploadedBy, &d.UploadedAt, &d.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// MoveProjectDraftsToStorage moves the content of drafts uploaded while
+// drafts were kept in the database to the storage backend, one draft at a
+// time. Drafts that are already moved are left alone, so it can run at every
+// startup and on several servers at once.
+//
+// Parameters:
+//   - files: Storage backend the drafts are moved to
+//
+// Returns:
+//   - int: Number of drafts moved
+//   - error: A storage or database error; drafts moved before it stay moved
+func (db *DB) MoveProjectDraftsToStorage(files storage.Storage) (int, error) {
+	rows, err := db.Query("SELECT id, project_id FROM project_drafts WHERE storage_key IS NULL ORDER BY id")
+	if err != nil {
+		return 0, err
+	}
+	var drafts []ProjectDraft
+	for rows.Next() {
+		var draft ProjectDraft
+		if err := rows.Scan(&draft.ID, &draft.ProjectID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		drafts = append(drafts, draft)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, draft := range drafts {
+		var data []byte
+		err := db.QueryRow("SELECT data FROM project_drafts WHERE id = $1 AND storage_key IS NULL", draft.ID).Scan(&data)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue // Deleted or moved by another server meanwhile
+		}
+		if err != nil {
+			return moved, err
+		}
+
+		key := fmt.Sprintf("projects/%d/drafts/legacy-%d", draft.ProjectID, draft.ID)
+		if _, err := files.Put(key, bytes.NewReader(data)); err != nil {
+			return moved, err
+		}
+		result, err := db.Exec(
+			"UPDATE project_drafts SET storage_key = $1, data = NULL WHERE id = $2 AND storage_key IS NULL",
+			key, draft.ID,
+		)
+		if err != nil {
+			return moved, err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return moved, err
+		} else if n > 0 {
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// projectCommentSelect selects the columns scanned by scanProjectComment
+const projectCommentSelect = `
+	SELECT c.id, c.project_id, COALESCE(c.draft_id, 0), COALESCE(c.author_id, 0),
+		COALESCE(tp.first_name || ' ' || tp.last_name, u.username, ''), c.body, c.created_at
+	FROM project_comments c
+	LEFT JOIN users u ON u.id = c.author_id
+	LEFT JOIN teacher_profiles tp ON tp.user_id = c.author_id`
+
+// scanProjectComment scans a row selected with projectCommentSelect
+func scanProjectComment(row interface{ Scan(...interface{}) error }) (*ProjectComment, error) {
+	c := &ProjectComment{}
+	if err := row.Scan(&c.ID, &c.ProjectID, &c.DraftID, &c.AuthorID, &c.AuthorName, &c.Body, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// AddProjectComment comments on a project or one of its drafts
+//
+// Parameters:
+//   - projectID: Project commented on
+//   - authorID: User writing the comment
+//   - req: Comment text and optional draft
+//
+// Returns:
+//   - *ProjectComment: Created comment
+//   - error: sql.ErrNoRows if the project does not exist, ErrInvalidProject, or a database error
+func (db *DB) AddProjectComment(projectID, authorID int, req *ProjectCommentRequest) (*ProjectComment, error) {
+	if err := ValidateProjectComment(req); err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM projects WHERE id = $1)", projectID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	var draft sql.NullInt64
+	if req.DraftID != 0 {
+		err := db.QueryRow(
+			"SELECT EXISTS(SELECT 1 FROM project_drafts WHERE id = $1 AND project_id = $2)",
+			req.DraftID, projectID,
+		).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("%w: draft does not belong to the project", ErrInvalidProject)
+		}
+		draft = sql.NullInt64{Int64: int64(req.DraftID), Valid: true}
+	}
+
+	var id int
+	err := db.QueryRow(
+		"INSERT INTO project_comments (project_id, draft_id, author_id, body) VALUES ($1, $2, $3, $4) RETURNING id",
+		projectID, draft, authorID, req.Body,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanProjectComment(db.QueryRow(projectCommentSelect+" WHERE c.id = $1", id))
+}
+
+// GetProjectComments retrieves the comments on a project
+//
+// Parameters:
+//   - projectID: Project whose comments are retrieved
+//
+// Returns:
+//   - []*ProjectComment: Comments, oldest first
+//   - error: Error if retrieval fails
+func (db *DB) GetProjectComments(projectID int) ([]*ProjectComment, error) {
+	rows, err := db.Query(projectCommentSelect+" WHERE c.project_id = $1 ORDER BY c.created_at, c.id", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []*ProjectComment{}
+	for rows.Next() {
+		c, err := scanProjectComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
@@ -0,0 +1,504 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Permissions checked by the API. Roles are sets of these strings stored in
+// the role_permissions table; adding a permission requires code, adding a
+// role does not.
+const (
+	PermStudentsRead   = "students:read"   // View student records
+	PermStudentsWrite  = "students:write"  // Create, update and delete students
+	PermSubjectsRead   = "subjects:read"   // View the subject catalogue
+	PermSubjectsWrite  = "subjects:write"  // Create, update, archive and delete subjects
+	PermSubjectsAssign = "subjects:assign" // Assign subjects to teachers
+	PermTeachersRead   = "teachers:read"   // View teachers and their subjects
+	PermTeachersWrite  = "teachers:write"  // Create, update, deactivate and delete teachers
+	PermSessionsRevoke = "sessions:revoke" // Revoke other users' sessions
+	PermPasswordsReset = "passwords:reset" // Force users to choose a new password at next login
+	PermLoginsManage   = "logins:manage"   // Review login attempts and unlock locked accounts
+	PermMFAEnroll      = "mfa:enroll"      // Set up two-factor authentication for one's own account
+	PermMFAReset       = "mfa:reset"       // Turn off other users' two-factor authentication
+	PermRolesManage    = "roles:manage"    // Manage roles and assign them to users
+
+	PermEnrollmentsRead  = "enrollments:read"  // View student subject enrollments
+	PermEnrollmentsWrite = "enrollments:write" // Enroll and unenroll students
+
+	PermAttendanceRead   = "attendance:read"   // View attendance of any subject and the low attendance report
+	PermAttendanceRecord = "attendance:record" // Record attendance for lessons of subjects the user teaches
+
+	PermGradebookRead  = "gradebook:read"  // View marks and grades of any subject
+	PermGradebookWrite = "gradebook:write" // Manage assessments, marks and predicted grades of subjects the user teaches
+
+	PermDiplomaRead  = "diploma:read"  // View students' IB diploma status
+	PermDiplomaWrite = "diploma:write" // Record TOK, EE and CAS results
+
+	PermCASLog       = "cas:log"       // Log and edit own CAS activities
+	PermCASSupervise = "cas:supervise" // Review CAS activities the user supervises
+	PermCASRead      = "cas:read"      // View CAS activities and progress of any student
+
+	PermProjectsRead      = "projects:read"      // View every EE and IA and the status board
+	PermProjectsManage    = "projects:manage"    // Assign supervisors and set milestones of EEs and IAs
+	PermProjectsSupervise = "projects:supervise" // Comment on and complete milestones of projects the user supervises
+	PermProjectsSubmit    = "projects:submit"    // Upload drafts of own projects
+
+	PermTimetableRead   = "timetable:read"   // View every teacher's, student's and room's timetable
+	PermTimetableManage = "timetable:manage" // Manage time slots and rooms and schedule lessons and exams
+
+	PermHomeworkRead   = "homework:read"   // View homework and submissions of any subject
+	PermHomeworkManage = "homework:manage" // Set homework and give feedback in subjects the user teaches
+	PermHomeworkSubmit = "homework:submit" // Submit own homework
+
+	PermGuardiansManage = "guardians:manage" // Manage guardian accounts and link them to students
+	PermChildrenRead    = "children:read"    // View profile, subjects, attendance and grades of own children
+)
+
+// AllPermissions lists every permission known to the API
+var AllPermissions = []string{
+	PermStudentsRead,
+	PermStudentsWrite,
+	PermSubjectsRead,
+	PermSubjectsWrite,
+	PermSubjectsAssign,
+	PermTeachersRead,
+	PermTeachersWrite,
+	PermSessionsRevoke,
+	PermPasswordsReset,
+	PermLoginsManage,
+	PermMFAEnroll,
+	PermMFAReset,
+	PermRolesManage,
+	PermEnrollmentsRead,
+	PermEnrollmentsWrite,
+	PermAttendanceRead,
+	PermAttendanceRecord,
+	PermGradebookRead,
+	PermGradebookWrite,
+	PermDiplomaRead,
+	PermDiplomaWrite,
+	PermCASLog,
+	PermCASSupervise,
+	PermCASRead,
+	PermProjectsRead,
+	PermProjectsManage,
+	PermProjectsSupervise,
+	PermProjectsSubmit,
+	PermTimetableRead,
+	PermTimetableManage,
+	PermHomeworkRead,
+	PermHomeworkManage,
+	PermHomeworkSubmit,
+	PermGuardiansManage,
+	PermChildrenRead,
+}
+
+// Built-in roles. Other code depends on these names (e.g. teachers are users
+// with the teacher role), so they cannot be deleted.
+const (
+	RoleAdmin    = "admin"
+	RoleTeacher  = "teacher"
+	RoleStudent  = "student"
+	RoleGuardian = "guardian"
+)
+
+// DefaultRolePermissions holds the permissions the built-in roles are seeded
+// with. It must stay in sync with the roles migrations.
+var DefaultRolePermissions = map[string][]string{
+	RoleAdmin:    AllPermissions,
+	RoleTeacher:  {PermSubjectsRead, PermTeachersRead, PermEnrollmentsRead, PermAttendanceRecord, PermGradebookWrite, PermCASSupervise, PermProjectsSupervise, PermTimetableRead, PermHomeworkManage, PermMFAEnroll},
+	RoleStudent:  {PermSubjectsRead, PermCASLog, PermProjectsSubmit, PermHomeworkSubmit},
+	RoleGuardian: {PermChildrenRead},
+}
+
+// Errors returned by role operations
+var (
+	ErrSystemRole        = errors.New("built-in roles cannot be deleted")
+	ErrRoleInUse         = errors.New("role is assigned to users")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrInvalidRoleName   = errors.New("role name must be 2-50 lowercase letters, digits or underscores")
+	ErrAdminLockout      = errors.New("the admin role must keep the roles:manage permission")
+)
+
+// roleNamePattern restricts role names to lowercase slugs
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+
+// Role represents a named set of permissions
+type Role struct {
+	Name        string    `json:"name"`        // Unique role name, stored in users.role
+	Description string    `json:"description"` // Human readable description
+	IsSystem    bool      `json:"is_system"`   // Built-in roles cannot be deleted
+	Permissions []string  `json:"permissions"` // Granted permissions, sorted
+	CreatedAt   time.Time `json:"created_at"`  // Creation timestamp
+}
+
+// RoleRequest is used for creating or updating a role
+type RoleRequest struct {
+	Name        string   `json:"name"`        // Role name (ignored on update)
+	Description string   `json:"description"` // Human readable description
+	Permissions []string `json:"permissions"` // Full set of permissions to grant
+}
+
+// IsKnownPermission reports whether a permission exists in AllPermissions
+func IsKnownPermission(permission string) bool {
+	for _, p := range AllPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// validateRolePermissions checks a role's permission set and returns it sorted and deduplicated
+func validateRolePermissions(name string, permissions []string) ([]string, error) {
+	seen := make(map[string]bool, len(permissions))
+	var cleaned []string
+	for _, p := range permissions {
+		if !IsKnownPermission(p) {
+			return nil, ErrUnknownPermission
+		}
+		if !seen[p] {
+			seen[p] = true
+			cleaned = append(cleaned, p)
+		}
+	}
+
+	if name == RoleAdmin && !seen[PermRolesManage] {
+		return nil, ErrAdminLockout
+	}
+
+	sort.Strings(cleaned)
+	return cleaned, nil
+}
+
+// GetAllRoles retrieves all roles with their permissions
+//
+// Returns:
+//   - []*Role: Array of roles ordered by name
+//   - error: Error if retrieval fails
+func (db *DB) GetAllRoles() ([]*Role, error) {
+	query := `
+		SELECT r.name, r.description, r.is_system, r.created_at,
+		       COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_name = r.name
+		GROUP BY r.name
+		ORDER BY r.name
+	`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []*Role
+	for rows.Next() {
+		role := &Role{}
+		var permissions pq.StringArray
+		err := rows.Scan(
+			&role.Name,
+			&role.Description,
+			&role.IsSystem,
+			&role.CreatedAt,
+			&permissions,
+		)
+		if err != nil {
+			return nil, err
+		}
+		role.Permissions = []string(permissions)
+		roles = append(roles, role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// GetRole retrieves a role by name with its permissions
+//
+// Parameters:
+//   - name: Role name
+//
+// Returns:
+//   - *Role: Role if found
+//   - error: sql.ErrNoRows if the role does not exist, or a database error
+func (db *DB) GetRole(name string) (*Role, error) {
+	role := &Role{}
+	err := db.QueryRow(
+		"SELECT name, description, is_system, created_at FROM roles WHERE name = $1",
+		name,
+	).Scan(&role.Name, &role.Description, &role.IsSystem, &role.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	role.Permissions, err = db.GetRolePermissions(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+// GetRolePermissions retrieves the permissions granted to a role
+//
+// Parameters:
+//   - name: Role name
+//
+// Returns:
+//   - []string: Sorted permissions, empty for unknown roles
+//   - error: Error if retrieval fails
+func (db *DB) GetRolePermissions(name string) ([]string, error) {
+	rows, err := db.Query(
+		"SELECT permission FROM role_permissions WHERE role_name = $1 ORDER BY permission",
+		name,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// GetUserPermissions retrieves a user's current role and its permissions
+//
+// Parameters:
+//   - userID: User to look up
+//
+// Returns:
+//   - string: The user's role
+//   - []string: Sorted permissions of that role
+//   - error: sql.ErrNoRows if the user does not exist or is deactivated, or a database error
+func (db *DB) GetUserPermissions(userID int) (string, []string, error) {
+	var role string
+	var permissions pq.StringArray
+	query := `
+		SELECT u.role,
+		       COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+		FROM users u
+		LEFT JOIN role_permissions rp ON rp.role_name = u.role
+		WHERE u.id = $1 AND u.is_active
+		GROUP BY u.role
+	`
+	err := db.QueryRow(query, userID).Scan(&role, &permissions)
+	if err != nil {
+		return "", nil, err
+	}
+	return role, []string(permissions), nil
+}
+
+// CreateRole creates a new role with the given permissions
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - req: Role name, description and permissions
+//
+// Returns:
+//   - *Role: Created role
+//   - error: ErrInvalidRoleName, ErrUnknownPermission, or a database error
+func (db *DB) CreateRole(req *RoleRequest) (*Role, error) {
+	if !roleNamePattern.MatchString(req.Name) {
+		return nil, ErrInvalidRoleName
+	}
+	permissions, err := validateRolePermissions(req.Name, req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	role := &Role{Permissions: permissions}
+	err = tx.QueryRow(`
+		INSERT INTO roles (name, description, is_system, created_at)
+		VALUES ($1, $2, FALSE, $3)
+		RETURNING name, description, is_system, created_at`,
+		req.Name, req.Description, time.Now().UTC(),
+	).Scan(&role.Name, &role.Description, &role.IsSystem, &role.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = insertRolePermissions(tx, role.Name, permissions); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+// UpdateRole replaces a role's description and permissions
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - name: Role to update
+//   - req: New description and full permission set
+//
+// Returns:
+//   - *Role: Updated role
+//   - error: sql.ErrNoRows if the role does not exist, ErrUnknownPermission,
+//     ErrAdminLockout, or a database error
+func (db *DB) UpdateRole(name string, req *RoleRequest) (*Role, error) {
+	permissions, err := validateRolePermissions(name, req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	role := &Role{Permissions: permissions}
+	err = tx.QueryRow(`
+		UPDATE roles SET description = $1 WHERE name = $2
+		RETURNING name, description, is_system, created_at`,
+		req.Description, name,
+	).Scan(&role.Name, &role.Description, &role.IsSystem, &role.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM role_permissions WHERE role_name = $1", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = insertRolePermissions(tx, name, permissions); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+// DeleteRole deletes a role that is not built in and not assigned to any user
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - name: Role to delete
+//
+// Returns:
+//   - error: sql.ErrNoRows, ErrSystemRole, ErrRoleInUse, or a database error
+func (db *DB) DeleteRole(name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Lock the role row so no user can be assigned to it while we check
+	var isSystem bool
+	err = tx.QueryRow("SELECT is_system FROM roles WHERE name = $1 FOR UPDATE", name).Scan(&isSystem)
+	if err != nil {
+		return err
+	}
+	if isSystem {
+		err = ErrSystemRole
+		return err
+	}
+
+	var inUse bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE role = $1)", name).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		err = ErrRoleInUse
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM roles WHERE name = $1", name)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetUserRole assigns a role to a user
+//
+// Parameters:
+//   - userID: User to update
+//   - role: Name of an existing role
+//
+// Returns:
+//   - error: sql.ErrNoRows if the user or role does not exist, or a database error
+func (db *DB) SetUserRole(userID int, role string) error {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM roles WHERE name = $1)", role).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	res, err := db.Exec("UPDATE users SET role = $1 WHERE id = $2", role, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// insertRolePermissions grants permissions to a role inside a transaction
+func insertRolePermissions(tx *sql.Tx, role string, permissions []string) error {
+	for _, permission := range permissions {
+		_, err := tx.Exec(
+			"INSERT INTO role_permissions (role_name, permission) VALUES ($1, $2)",
+			role, permission,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import "time"
+
+// UserStore provides access to login accounts.
+type UserStore interface {
+	GetUserByID(id int) (*User, error)
+	GetUserByUsername(username string) (*User, error)
+	CreateUser(username, password, role string) (*User, error)
+	UpdateUserPassword(userID int, password string) error
+	UpdateProfile(userID int, req *ProfileRequest) (*User, error)
+	GetUsersByEmail(email string) ([]*User, error)
+	RequirePasswordChange(userID int) error
+	LockUser(userID int, until time.Time) error
+	UnlockUser(userID int) error
+	PasswordNeedsUpgrade(user *User) bool
+	VerifyDummyPassword(password string)
+}
+
+// LoginAttemptStore records login attempts and password reset requests and
+// counts recent ones for rate limiting. *DB shares the counts between server instances;
+// *MemoryStore keeps them in the process.
+type LoginAttemptStore interface {
+	RecordLoginAttempt(username, ip, outcome string) error
+	CountLoginFailures(username, ip string, since time.Time) (*LoginFailures, error)
+	CountPasswordResetRequests(email, ip string, since time.Time) (*LoginFailures, error)
+	ListLoginAttempts(params ListParams) (*ListResult[*LoginAttempt], error)
+	SummarizeLoginFailures(since time.Time, limit int) (*LoginFailureSummary, error)
+	PurgeLoginAttempts(before time.Time) (int64, error)
+}
+
+// MFAStore provides access to TOTP secrets and recovery codes for two-factor
+// authentication.
+type MFAStore interface {
+	GetMFA(userID int) (*MFA, error)
+	StartMFAEnrollment(userID int, secret string) error
+	ConfirmMFA(userID int, step int64, codeHashes []string) error
+	UseMFAStep(userID int, step int64) error
+	UseRecoveryCode(userID int, codeHash string) error
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	DisableMFA(userID int) error
+}
+
+// TokenStore provides access to refresh tokens, access token revocations,
+// calendar feed identifiers and password reset tokens.
+type TokenStore interface {
+	CreateRefreshToken(userID int, tokenHash string, expiresAt time.Time, mfa bool) (*RefreshToken, error)
+	GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error)
+	RotateRefreshToken(oldID int, newHash string, expiresAt time.Time) (*RefreshToken, error)
+	RevokeRefreshToken(userID int, tokenHash string) error
+	RevokeAccessToken(jti string, userID int, expiresAt time.Time) error
+	ClaimToken(jti string, userID int, expiresAt time.Time) (bool, error)
+	RevokeUserSessions(userID int) error
+	IsTokenRevoked(jti string, userID int, issuedAt time.Time) (bool, error)
+	GetCalendarFeedID(userID int) (string, error)
+	SetCalendarFeedID(userID int, feedID string) error
+	CreatePasswordResetToken(userID int, tokenHash string, expiresAt time.Time) error
+	ResetPassword(tokenHash, password string) (int, error)
+}
+
+// StudentStore provides access to student records and their login accounts.
+type StudentStore interface {
+	ListStudents(params ListParams) (*ListResult[*Student], error)
+	EachStudent(params ListParams, fn func(*Student) error) error
+	GetStudentByID(id int) (*Student, error)
+	GetStudentByUserID(userID int) (*Student, error)
+	CreateStudent(req *StudentRequest) (*Student, error)
+	UpdateStudent(id int, req *StudentRequest) (*Student, error)
+	DeleteStudent(id int) error
+	ImportStudents(rows []StudentImportRow, dryRun bool) (*StudentImportResult, error)
+}
+
+// SubjectStore provides access to the subject catalogue.
+type SubjectStore interface {
+	GetAllSubjects(includeArchived bool) ([]*Subject, error)
+	ListSubjects(params ListParams, includeArchived bool) (*ListResult[*Subject], error)
+	EachSubject(includeArchived bool, fn func(*Subject) error) error
+	GetSubjectByID(id int) (*Subject, error)
+	CreateSubject(req *SubjectRequest) (*Subject, error)
+	UpdateSubject(id int, req *SubjectRequest) (*Subject, error)
+	DeleteSubject(id int) error
+}
+
+// TeacherStore provides access to teachers, their login accounts and subject assignments.
+type TeacherStore interface {
+	ListTeachers(params ListParams) (*ListResult[*Teacher], error)
+	EachTeacher(params ListParams, fn func(*Teacher) error) error
+	GetTeacherByID(id int) (*Teacher, error)
+	CreateTeacher(req *TeacherRequest) (*Teacher, error)
+	UpdateTeacher(id int, req *TeacherRequest) (*Teacher, error)
+	SetTeacherActive(id int, active bool) error
+	DeleteTeacher(id int) error
+	GetTeacherSubjects(teacherID int) ([]Subject, error)
+	AssignSubjectToTeacher(teacherID, subjectID int) error
+	RemoveSubjectFromTeacher(teacherID, subjectID int) error
+}
+
+// EnrollmentStore provides access to the subjects students are enrolled in.
+type EnrollmentStore interface {
+	GetStudentEnrollments(studentID int) ([]*Enrollment, error)
+	EnrollStudent(studentID int, req *EnrollmentRequest) (*Enrollment, []TimetableConflict, error)
+	UnenrollStudent(studentID, subjectID int) error
+}
+
+// AttendanceStore provides access to lessons and the attendance recorded for them.
+type AttendanceStore interface {
+	CreateLesson(teacherID int, req *LessonRequest) (*Lesson, error)
+	RecordAttendance(lessonID, teacherID int, entries []AttendanceEntry) (*Lesson, error)
+	GetLesson(id int) (*Lesson, error)
+	GetSubjectLessons(subjectID int, period AttendancePeriod) ([]*Lesson, error)
+	GetStudentAttendance(studentID int, period AttendancePeriod) ([]*AttendanceSummary, error)
+	GetSubjectAttendance(subjectID int, period AttendancePeriod) ([]*AttendanceSummary, error)
+	GetLowAttendance(threshold float64, period AttendancePeriod) ([]*AttendanceSummary, error)
+}
+
+// GradebookStore provides access to grading schemes, assessments, marks and predicted grades.
+type GradebookStore interface {
+	GetGradingScheme(subjectID int) (*GradingScheme, error)
+	SetGradingScheme(subjectID, teacherID int, req *GradingSchemeRequest) (*GradingScheme, error)
+	CreateAssessment(subjectID, teacherID int, req *AssessmentRequest) (*Assessment, error)
+	UpdateAssessment(id, teacherID int, req *AssessmentRequest) (*Assessment, error)
+	DeleteAssessment(id, teacherID int) error
+	GetAssessment(id int) (*Assessment, error)
+	GetSubjectAssessments(subjectID int) ([]*Assessment, error)
+	RecordScores(assessmentID, teacherID int, entries []ScoreEntry) (*Assessment, error)
+	GetSubjectGrades(subjectID int) ([]*StudentGrade, error)
+	GetStudentGradebook(subjectID, studentID int) (*StudentGradebook, error)
+	AddPredictedGrade(subjectID, studentID, teacherID int, req *PredictedGradeRequest) (*PredictedGrade, error)
+}
+
+// DiplomaStore provides access to students' TOK, EE and CAS results.
+type DiplomaStore interface {
+	GetDiplomaCore(studentID int) (*DiplomaCore, error)
+	SetDiplomaCore(studentID, userID int, req *DiplomaCoreRequest) (*DiplomaCore, error)
+}
+
+// CASStore provides access to students' CAS activities and their reviews.
+type CASStore interface {
+	GetCASActivity(id int) (*CASActivity, error)
+	GetStudentCASActivities(studentID int) ([]*CASActivity, error)
+	GetSupervisedCASActivities(supervisorID int, status string) ([]*CASActivity, error)
+	CreateCASActivity(studentID int, req *CASActivityRequest) (*CASActivity, error)
+	UpdateCASActivity(id, studentID int, req *CASActivityRequest) (*CASActivity, error)
+	DeleteCASActivity(id, studentID int) error
+	ReviewCASActivity(id, supervisorID int, req *CASReviewRequest) (*CASActivity, error)
+}
+
+// ProjectStore provides access to Extended Essays and Internal Assessments
+// with their milestones, drafts and supervisor comments.
+type ProjectStore interface {
+	GetProject(id int) (*Project, error)
+	GetStudentProjects(studentID int) ([]*Project, error)
+	GetSupervisedProjects(supervisorID int) ([]*Project, error)
+	GetGradeProjects(grade, kind string) ([]*Project, error)
+	CreateProject(req *ProjectRequest) (*Project, error)
+	UpdateProject(id int, req *ProjectUpdateRequest) (*Project, error)
+	DeleteProject(id int) ([]string, error)
+	AddMilestone(projectID int, req *MilestoneRequest) (*ProjectMilestone, error)
+	UpdateMilestone(projectID, milestoneID int, req *MilestoneRequest) (*ProjectMilestone, error)
+	SetMilestoneCompleted(projectID, milestoneID, userID int, completed bool) (*ProjectMilestone, error)
+	DeleteMilestone(projectID, milestoneID int) error
+	AddProjectDraft(projectID int, draft *ProjectDraft) (*ProjectDraft, error)
+	GetProjectDrafts(projectID int) ([]*ProjectDraft, error)
+	GetProjectDraft(projectID, draftID int) (*ProjectDraft, error)
+	AddProjectComment(projectID, authorID int, req *ProjectCommentRequest) (*ProjectComment, error)
+	GetProjectComments(projectID int) ([]*ProjectComment, error)
+}
+
+// TimetableStore provides access to time slots, rooms, the weekly lessons
+// scheduled in them and the exam schedule.
+type TimetableStore interface {
+	GetTimeSlots() ([]*TimeSlot, error)
+	CreateTimeSlot(req *TimeSlotRequest) (*TimeSlot, error)
+	UpdateTimeSlot(id int, req *TimeSlotRequest) (*TimeSlot, error)
+	DeleteTimeSlot(id int) error
+	GetRooms() ([]*Room, error)
+	CreateRoom(req *RoomRequest) (*Room, error)
+	UpdateRoom(id int, req *RoomRequest) (*Room, error)
+	DeleteRoom(id int) error
+	GetTimetableLesson(id int) (*TimetableLesson, error)
+	GetTimetableLessons(filter TimetableFilter) ([]*TimetableLesson, error)
+	CreateTimetableLesson(req *TimetableLessonRequest) (*TimetableLesson, []TimetableConflict, error)
+	UpdateTimetableLesson(id int, req *TimetableLessonRequest) (*TimetableLesson, []TimetableConflict, error)
+	DeleteTimetableLesson(id int) error
+	GetExam(id int) (*Exam, error)
+	GetExams(subjectID int) ([]*Exam, error)
+	CreateExam(req *ExamRequest) (*Exam, error)
+	UpdateExam(id int, req *ExamRequest) (*Exam, error)
+	DeleteExam(id int) error
+}
+
+// HomeworkStore provides access to homework, its attachments and students'
+// submissions. File content is kept on a storage backend; the store records
+// the storage keys.
+type HomeworkStore interface {
+	GetHomework(id int) (*Homework, error)
+	GetSubjectHomework(subjectID int) ([]*Homework, error)
+	GetStudentHomework(studentID int) ([]*Homework, error)
+	CreateHomework(subjectID, teacherID int, req *HomeworkRequest) (*Homework, error)
+	UpdateHomework(id, teacherID int, req *HomeworkRequest) (*Homework, error)
+	DeleteHomework(id, teacherID int) ([]string, error)
+	AddHomeworkAttachment(homeworkID, teacherID int, file *HomeworkFile) (*HomeworkFile, error)
+	GetHomeworkAttachment(homeworkID, fileID int) (*HomeworkFile, error)
+	DeleteHomeworkAttachment(homeworkID, fileID, teacherID int) (string, error)
+	SubmitHomework(homeworkID, studentID int, submission *HomeworkSubmission) (*HomeworkSubmission, error)
+	GetHomeworkSubmissions(homeworkID, studentID int) ([]*HomeworkSubmission, error)
+	GetStudentSubmissions(studentID int) ([]*HomeworkSubmission, error)
+	GetHomeworkSubmission(id int) (*HomeworkSubmission, error)
+	SetHomeworkFeedback(submissionID, teacherID int, req *HomeworkFeedbackRequest) (*HomeworkSubmission, error)
+}
+
+// GuardianStore provides access to guardians, their login accounts and the students they are linked to.
+type GuardianStore interface {
+	GetAllGuardians() ([]*Guardian, error)
+	GetGuardianByID(id int) (*Guardian, error)
+	CreateGuardian(req *GuardianRequest) (*Guardian, error)
+	UpdateGuardian(id int, req *GuardianRequest) (*Guardian, error)
+	DeleteGuardian(id int) error
+	LinkGuardianStudent(guardianID int, req *GuardianLinkRequest) (*GuardianChild, error)
+	UnlinkGuardianStudent(guardianID, studentID int) error
+	GetGuardianChildren(guardianID int) ([]GuardianChild, error)
+	IsGuardianOf(guardianID, studentID int) (bool, error)
+}
+
+// RoleStore provides access to roles and their permissions.
+type RoleStore interface {
+	GetAllRoles() ([]*Role, error)
+	GetRole(name string) (*Role, error)
+	GetRolePermissions(name string) ([]string, error)
+	GetUserPermissions(userID int) (string, []string, error)
+	CreateRole(req *RoleRequest) (*Role, error)
+	UpdateRole(name string, req *RoleRequest) (*Role, error)
+	DeleteRole(name string) error
+	SetUserRole(userID int, role string) error
+}
+
+// Store combines every store interface. Both *DB (PostgreSQL) and
+// *MemoryStore (in-memory, for tests) implement it.
+type Store interface {
+	UserStore
+	TokenStore
+	LoginAttemptStore
+	MFAStore
+	StudentStore
+	SubjectStore
+	TeacherStore
+	EnrollmentStore
+	AttendanceStore
+	GradebookStore
+	DiplomaStore
+	CASStore
+	ProjectStore
+	TimetableStore
+	HomeworkStore
+	GuardianStore
+	RoleStore
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
@@ -0,0 +1,218 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// StudentImportFields lists the student fields an import file provides, in report order
+var StudentImportFields = []string{"first_name", "last_name", "email", "grade", "username", "password"}
+
+// StudentImportRow is a student read from one row of an import file
+type StudentImportRow struct {
+	Row int `json:"row"` // Row number in the file, the header being row 1
+	StudentRequest
+}
+
+// StudentImportError describes a problem with one row of an import file
+type StudentImportError struct {
+	Row     int    `json:"row"`             // Row number in the file
+	Field   string `json:"field,omitempty"` // Offending field, empty if the whole row is affected
+	Value   string `json:"value,omitempty"` // Offending value; never set for passwords
+	Message string `json:"message"`         // Description of the problem
+}
+
+// StudentImportResult reports the outcome of a student import.
+// Students are only created when every row is valid.
+type StudentImportResult struct {
+	DryRun  bool                 `json:"dry_run"` // Rows were validated but not written
+	Rows    int                  `json:"rows"`    // Number of rows read from the file
+	Valid   bool                 `json:"valid"`   // No row has an error
+	Errors  []StudentImportError `json:"errors"`  // Problems ordered by row
+	Created []*Student           `json:"created"` // Created students, empty on dry runs and errors
+}
+
+// validateStudentImport checks every import row for missing fields, passwords
+// that are too short or too long, invalid grades and usernames or emails that
+// are taken or repeated within the file
+//
+// Parameters:
+//   - rows: Rows to check
+//   - dryRun: Whether the import only validates
+//   - takenUsernames: Usernames that already belong to a user
+//   - takenEmails: Emails that already belong to a student
+//
+// Returns:
+//   - *StudentImportResult: Result with the errors found and no created students
+func validateStudentImport(rows []StudentImportRow, dryRun bool, takenUsernames, takenEmails map[string]bool) *StudentImportResult {
+	result := &StudentImportResult{
+		DryRun:  dryRun,
+		Rows:    len(rows),
+		Errors:  []StudentImportError{},
+		Created: []*Student{},
+	}
+
+	usernameRows := map[string]int{}
+	emailRows := map[string]int{}
+	for _, row := range rows {
+		fail := func(field, value, message string) {
+			result.Errors = append(result.Errors, StudentImportError{Row: row.Row, Field: field, Value: value, Message: message})
+		}
+
+		values := map[string]string{
+			"first_name": row.FirstName,
+			"last_name":  row.LastName,
+			"email":      row.Email,
+			"grade":      row.Grade,
+			"username":   row.Username,
+			"password":   row.Password,
+		}
+		for _, field := range StudentImportFields {
+			if values[field] == "" {
+				fail(field, "", field+" is required")
+			}
+		}
+
+		if row.Password != "" {
+			if problem := passwordProblem(row.Password); problem != "" {
+				fail("password", "", problem)
+			}
+		}
+
+		if row.Grade != "" && !IsValidGrade(row.Grade) {
+			fail("grade", row.Grade, "grade must be PIB, IB1, or IB2")
+		}
+
+		if row.Email != "" {
+			if first, ok := emailRows[row.Email]; ok {
+				fail("email", row.Email, fmt.Sprintf("email is repeated from row %d", first))
+			} else if takenEmails[row.Email] {
+				emailRows[row.Email] = row.Row
+				fail("email", row.Email, "email is already in use")
+			} else {
+				emailRows[row.Email] = row.Row
+			}
+		}
+
+		if row.Username != "" {
+			if first, ok := usernameRows[row.Username]; ok {
+				fail("username", row.Username, fmt.Sprintf("username is repeated from row %d", first))
+			} else if takenUsernames[row.Username] {
+				usernameRows[row.Username] = row.Row
+				fail("username", row.Username, "username is already in use")
+			} else {
+				usernameRows[row.Username] = row.Row
+			}
+		}
+	}
+
+	result.Valid = len(result.Errors) == 0
+	return result
+}
+
+// ImportStudents validates a batch of students and, unless it is a dry run,
+// creates all of them in a single transaction. Nothing is written if any row
+// is invalid.
+//
+// Parameters:
+//   - rows: Students read from an import file
+//   - dryRun: Only validate the rows
+//
+// Returns:
+//   - *StudentImportResult: Per-row errors, or the created students
+//   - error: A database error
+func (db *DB) ImportStudents(rows []StudentImportRow, dryRun bool) (*StudentImportResult, error) {
+	usernames := make([]string, 0, len(rows))
+	emails := make([]string, 0, len(rows))
+	for _, row := range rows {
+		usernames = append(usernames, row.Username)
+		emails = append(emails, row.Email)
+	}
+
+	takenUsernames, err := db.existingValues(`SELECT username FROM users WHERE username = ANY($1)`, usernames)
+	if err != nil {
+		return nil, err
+	}
+	takenEmails, err := db.existingValues(`SELECT email FROM students WHERE email = ANY($1)`, emails)
+	if err != nil {
+		return nil, err
+	}
+
+	result := validateStudentImport(rows, dryRun, takenUsernames, takenEmails)
+	if !result.Valid || dryRun {
+		return result, nil
+	}
+
+	// Hash before opening the transaction so that it stays short
+	hashes := make([]string, len(rows))
+	for i, row := range rows {
+		if hashes[i], err = db.hashPassword(row.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for i := range rows {
+		var student *Student
+		student, err = insertStudent(tx, &rows[i].StudentRequest, hashes[i])
+		if err != nil {
+			if IsDuplicate(err) {
+				// Another request took the username or email after validation
+				result.Valid = false
+				result.Created = []*Student{}
+				result.Errors = append(result.Errors, StudentImportError{
+					Row:     rows[i].Row,
+					Message: "username or email is already in use",
+				})
+				return result, nil
+			}
+			return nil, err
+		}
+		result.Created = append(result.Created, student)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// existingValues runs a query that selects the given values which already exist
+//
+// Parameters:
+//   - query: Query taking the values as a text array in $1 and selecting one text column
+//   - values: Values to look up
+//
+// Returns:
+//   - map[string]bool: Values returned by the query
+//   - error: A database error
+func (db *DB) existingValues(query string, values []string) (map[string]bool, error) {
+	rows, err := db.Query(query, pq.Array(values))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := map[string]bool{}
+	for rows.Next() {
+		var value sql.NullString
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		existing[value.String] = true
+	}
+	return existing, rows.Err()
+}
@@ -0,0 +1,399 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Grades offered by the school
+var Grades = []string{"PIB", "IB1", "IB2"}
+
+// Errors returned by subject operations
+var (
+	ErrInvalidSubject  = errors.New("invalid subject")
+	ErrSubjectArchived = errors.New("subject is archived")
+	ErrSubjectInUse    = errors.New("subject has enrollments, teacher assignments, lessons, assessments, projects or homework; archive it instead")
+)
+
+// Subject represents a subject that can be taught by teachers
+type Subject struct {
+	ID          int       `json:"id"`          // Unique identifier
+	Grade       string    `json:"grade"`       // Educational grade (PIB, IB1, or IB2)
+	Name        string    `json:"name"`        // Subject name, unique per grade
+	Description string    `json:"description"` // Subject description
+	Group       int       `json:"group"`       // IB subject group (1-6), 0 if none
+	Levels      []string  `json:"levels"`      // Levels the subject is offered at (HL, SL)
+	Archived    bool      `json:"archived"`    // Archived subjects take no new enrollments or assignments
+	CreatedAt   time.Time `json:"created_at"`  // Creation timestamp
+}
+
+// SubjectRequest is used for creating or updating a subject
+type SubjectRequest struct {
+	Grade       string   `json:"grade"`       // PIB, IB1, or IB2
+	Name        string   `json:"name"`        // Subject name
+	Description string   `json:"description"` // Subject description
+	Group       int      `json:"group"`       // IB subject group (1-6); must be 0 for PIB
+	Levels      []string `json:"levels"`      // HL and/or SL; must be empty for PIB
+	Archived    bool     `json:"archived"`    // Retire the subject (updates only)
+}
+
+// IsValidGrade reports whether a grade is offered by the school
+func IsValidGrade(grade string) bool {
+	for _, g := range Grades {
+		if g == grade {
+			return true
+		}
+	}
+	return false
+}
+
+// OffersLevel reports whether a subject can be taken at a level. Subjects
+// without levels (Pre-IB) accept only the empty level.
+func (s *Subject) OffersLevel(level string) bool {
+	if len(s.Levels) == 0 {
+		return level == ""
+	}
+	for _, l := range s.Levels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateSubjectRequest checks a subject request and normalises its levels
+//
+// Parameters:
+//   - req: Subject request to check; Name is trimmed and Levels deduplicated in place
+//
+// Returns:
+//   - error: ErrInvalidSubject wrapped with the reason, or nil
+func ValidateSubjectRequest(req *SubjectRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSubject)
+	}
+	if !IsValidGrade(req.Grade) {
+		return fmt.Errorf("%w: grade must be PIB, IB1, or IB2", ErrInvalidSubject)
+	}
+
+	if !IsDiplomaGrade(req.Grade) {
+		if req.Group != 0 || len(req.Levels) > 0 {
+			return fmt.Errorf("%w: Pre-IB subjects have no group or levels", ErrInvalidSubject)
+		}
+		req.Levels = []string{}
+		return nil
+	}
+
+	if _, ok := SubjectGroupNames[req.Group]; !ok {
+		return fmt.Errorf("%w: group must be between 1 and 6", ErrInvalidSubject)
+	}
+
+	// Keep levels in HL, SL order without duplicates
+	offered := map[string]bool{}
+	for _, level := range req.Levels {
+		if level != LevelHL && level != LevelSL {
+			return fmt.Errorf("%w: levels must be HL or SL", ErrInvalidSubject)
+		}
+		offered[level] = true
+	}
+	if len(offered) == 0 {
+		return fmt.Errorf("%w: IB subjects must be offered at HL, SL, or both", ErrInvalidSubject)
+	}
+	req.Levels = []string{}
+	for _, level := range []string{LevelHL, LevelSL} {
+		if offered[level] {
+			req.Levels = append(req.Levels, level)
+		}
+	}
+	return nil
+}
+
+// subjectColumns selects a subject from the subjects table aliased as s, in
+// the order expected by scanSubject
+const subjectColumns = `s.id, s.grade, s.name, COALESCE(s.description, ''),
+		       COALESCE(s.subject_group, 0), s.levels, s.archived, s.created_at`
+
+// scanSubject scans a row selected with subjectColumns
+func scanSubject(row interface{ Scan(...interface{}) error }, subject *Subject) error {
+	var levels pq.StringArray
+	err := row.Scan(
+		&subject.ID,
+		&subject.Grade,
+		&subject.Name,
+		&subject.Description,
+		&subject.Group,
+		&levels,
+		&subject.Archived,
+		&subject.CreatedAt,
+	)
+	subject.Levels = []string(levels)
+	if subject.Levels == nil {
+		subject.Levels = []string{}
+	}
+	return err
+}
+
+// querySubjects runs a query selecting subjectColumns and collects the results
+func (db *DB) querySubjects(query string, args ...interface{}) ([]*Subject, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subjects []*Subject
+	for rows.Next() {
+		subject := &Subject{}
+		if err := scanSubject(rows, subject); err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, subject)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subjects, nil
+}
+
+// GetAllSubjects retrieves all subjects
+//
+// Parameters:
+//   - includeArchived: Whether archived subjects are included
+//
+// Returns:
+//   - []*Subject: Array of subjects ordered by grade and name
+//   - error: Error if retrieval fails
+func (db *DB) GetAllSubjects(includeArchived bool) ([]*Subject, error) {
+	query := `
+		SELECT ` + subjectColumns + `
+		FROM subjects s
+		WHERE $1 OR NOT s.archived
+		ORDER BY s.grade, s.name
+	`
+	return db.querySubjects(query, includeArchived)
+}
+
+// EachSubject streams every subject ordered by grade and name
+//
+// Parameters:
+//   - includeArchived: Whether archived subjects are included
+//   - fn: Called for each subject; an error stops the iteration and is returned
+//
+// Returns:
+//   - error: An error of the query or fn
+func (db *DB) EachSubject(includeArchived bool, fn func(*Subject) error) error {
+	query := `
+		SELECT ` + subjectColumns + `
+		FROM subjects s
+		WHERE $1 OR NOT s.archived
+		ORDER BY s.grade, s.name
+	`
+	rows, err := db.Query(query, includeArchived)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		subject := &Subject{}
+		if err := scanSubject(rows, subject); err != nil {
+			return err
+		}
+		if err := fn(subject); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// subjectListSpec lists the subject fields list endpoints may sort, filter and search by
+var subjectListSpec = listSpec[*Subject]{
+	Fields: map[string]listField[*Subject]{
+		"id":          {Column: "s.id", Kind: kindInt, Value: func(s *Subject) interface{} { return s.ID }, Sort: true},
+		"grade":       {Column: "s.grade", Value: func(s *Subject) interface{} { return s.Grade }, Sort: true, Filter: true},
+		"name":        {Column: "s.name", Value: func(s *Subject) interface{} { return s.Name }, Sort: true, Search: true},
+		"description": {Column: "COALESCE(s.description, '')", Value: func(s *Subject) interface{} { return s.Description }, Search: true},
+		"group":       {Column: "COALESCE(s.subject_group, 0)", Kind: kindInt, Value: func(s *Subject) interface{} { return s.Group }, Sort: true, Filter: true},
+		"archived":    {Column: "s.archived", Kind: kindBool, Value: func(s *Subject) interface{} { return s.Archived }, Sort: true},
+		"created_at":  {Column: "s.created_at", Kind: kindTime, Value: func(s *Subject) interface{} { return s.CreatedAt }, Sort: true},
+	},
+	Key:         "id",
+	DefaultSort: []SortField{{Field: "grade"}, {Field: "name"}},
+}
+
+// ListSubjects retrieves a page of subjects
+//
+// Parameters:
+//   - params: Page, sort, filters (grade, group) and search (name, description)
+//   - includeArchived: Whether archived subjects are included
+//
+// Returns:
+//   - *ListResult[*Subject]: Page of subjects ordered by grade and name unless sorted otherwise
+//   - error: ErrInvalidListParams or a database error
+func (db *DB) ListSubjects(params ListParams, includeArchived bool) (*ListResult[*Subject], error) {
+	query := "SELECT " + subjectColumns + " FROM subjects s"
+	return queryList(db, subjectListSpec, params, query,
+		[]string{"($1 OR NOT s.archived)"}, []interface{}{includeArchived},
+		func(rows *sql.Rows) (*Subject, error) {
+			subject := &Subject{}
+			err := scanSubject(rows, subject)
+			return subject, err
+		})
+}
+
+// GetSubjectByID retrieves a subject by ID, including archived subjects
+//
+// Parameters:
+//   - id: Subject ID to retrieve
+//
+// Returns:
+//   - *Subject: Subject if found
+//   - error: Error if subject not found or database error
+func (db *DB) GetSubjectByID(id int) (*Subject, error) {
+	subject := &Subject{}
+	query := `
+		SELECT ` + subjectColumns + `
+		FROM subjects s
+		WHERE s.id = $1
+	`
+	if err := scanSubject(db.QueryRow(query, id), subject); err != nil {
+		return nil, err
+	}
+	return subject, nil
+}
+
+// CreateSubject adds a subject to the catalogue
+//
+// Parameters:
+//   - req: Subject definition; Archived is ignored
+//
+// Returns:
+//   - *Subject: Created subject
+//   - error: ErrInvalidSubject, a duplicate (grade, name) error, or a database error
+func (db *DB) CreateSubject(req *SubjectRequest) (*Subject, error) {
+	if err := ValidateSubjectRequest(req); err != nil {
+		return nil, err
+	}
+
+	subject := &Subject{}
+	query := `
+		INSERT INTO subjects AS s (grade, name, description, subject_group, levels, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6)
+		RETURNING ` + subjectColumns
+	err := scanSubject(db.QueryRow(
+		query,
+		req.Grade,
+		req.Name,
+		req.Description,
+		req.Group,
+		pq.StringArray(req.Levels),
+		time.Now().UTC(),
+	), subject)
+	if err != nil {
+		return nil, err
+	}
+	return subject, nil
+}
+
+// UpdateSubject replaces a subject's definition, including its archived flag.
+// Existing enrollments and teacher assignments are kept.
+//
+// Parameters:
+//   - id: Subject ID to update
+//   - req: New subject definition
+//
+// Returns:
+//   - *Subject: Updated subject
+//   - error: sql.ErrNoRows, ErrInvalidSubject, a duplicate (grade, name) error, or a database error
+func (db *DB) UpdateSubject(id int, req *SubjectRequest) (*Subject, error) {
+	if err := ValidateSubjectRequest(req); err != nil {
+		return nil, err
+	}
+
+	subject := &Subject{}
+	query := `
+		UPDATE subjects AS s
+		SET grade = $1, name = $2, description = $3, subject_group = NULLIF($4, 0),
+		    levels = $5, archived = $6
+		WHERE s.id = $7
+		RETURNING ` + subjectColumns
+	err := scanSubject(db.QueryRow(
+		query,
+		req.Grade,
+		req.Name,
+		req.Description,
+		req.Group,
+		pq.StringArray(req.Levels),
+		req.Archived,
+		id,
+	), subject)
+	if err != nil {
+		return nil, err
+	}
+	return subject, nil
+}
+
+// DeleteSubject deletes a subject that has never been used. Subjects with
+// enrollments, teacher assignments, lessons, assessments or projects must be
+// archived instead.
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - id: Subject ID to delete
+//
+// Returns:
+//   - error: sql.ErrNoRows, ErrSubjectInUse, or a database error
+func (db *DB) DeleteSubject(id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Lock the subject so no enrollment or assignment is added while we check
+	var subjectID int
+	err = tx.QueryRow("SELECT id FROM subjects WHERE id = $1 FOR UPDATE", id).Scan(&subjectID)
+	if err != nil {
+		return err
+	}
+
+	var inUse bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM enrollments WHERE subject_id = $1)
+		    OR EXISTS(SELECT 1 FROM teacher_subjects WHERE subject_id = $1)
+		    OR EXISTS(SELECT 1 FROM lessons WHERE subject_id = $1)
+		    OR EXISTS(SELECT 1 FROM assessments WHERE subject_id = $1)
+		    OR EXISTS(SELECT 1 FROM projects WHERE subject_id = $1)
+		    OR EXISTS(SELECT 1 FROM timetable_lessons WHERE subject_id = $1)
+		    OR EXISTS(SELECT 1 FROM exams WHERE subject_id = $1)
+		    OR EXISTS(SELECT 1 FROM homework_assignments WHERE subject_id = $1)`,
+		id,
+	).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		err = ErrSubjectInUse
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM subjects WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -3,28 +3,36 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"time"
 )
 
-// Subject represents a subject that can be taught by teachers
-type Subject struct {
-	ID          int       `json:"id"`          // Unique identifier
-	Grade       string    `json:"grade"`       // Educational grade (PIB, IB1, or IB2)
-	Name        string    `json:"name"`        // Subject name
-	Description string    `json:"description"` // Subject description
-	CreatedAt   time.Time `json:"created_at"`  // Creation timestamp
-}
+// ErrNotTeaching is returned when a teacher changes records of a subject,
+// such as attendance or marks, that they are not assigned to
+var ErrNotTeaching = errors.New("teacher is not assigned to the subject")
 
-// Teacher represents a teacher with their associated subjects
+// Teacher represents a teacher with their associated subjects.
+// Personal details live in teacher_profiles, keyed by the user ID.
 type Teacher struct {
 	ID        int       `json:"id"`         // User ID from the users table
 	Username  string    `json:"username"`   // Login username
 	FirstName string    `json:"first_name"` // Teacher's first name
 	LastName  string    `json:"last_name"`  // Teacher's last name
 	Email     string    `json:"email"`      // Teacher's email address
+	Active    bool      `json:"active"`     // Deactivated teachers cannot log in
 	Subjects  []Subject `json:"subjects"`   // Subjects taught by this teacher
 }
 
+// TeacherRequest is used for creating or updating a teacher.
+// Username is ignored and password is optional when updating.
+type TeacherRequest struct {
+	FirstName string `json:"first_name"`         // Teacher's first name
+	LastName  string `json:"last_name"`          // Teacher's last name
+	Email     string `json:"email"`              // Teacher's email address
+	Username  string `json:"username"`           // Login username
+	Password  string `json:"password,omitempty"` // Login password (optional for updates)
+}
+
 // TeacherSubject represents a mapping between teachers and subjects
 type TeacherSubject struct {
 	ID        int       `json:"id"`         // Unique identifier
@@ -33,198 +41,356 @@ type TeacherSubject struct {
 	CreatedAt time.Time `json:"created_at"` // Creation timestamp
 }
 
-// GetAllSubjects retrieves all subjects
+// teacherListSpec lists the teacher fields list endpoints may sort, filter and search by
+var teacherListSpec = listSpec[*Teacher]{
+	Fields: map[string]listField[*Teacher]{
+		"id":         {Column: "u.id", Kind: kindInt, Value: func(t *Teacher) interface{} { return t.ID }, Sort: true},
+		"username":   {Column: "u.username", Value: func(t *Teacher) interface{} { return t.Username }, Sort: true, Search: true},
+		"first_name": {Column: "COALESCE(p.first_name, '')", Value: func(t *Teacher) interface{} { return t.FirstName }, Sort: true, Search: true},
+		"last_name":  {Column: "COALESCE(p.last_name, '')", Value: func(t *Teacher) interface{} { return t.LastName }, Sort: true, Search: true},
+		"email":      {Column: "COALESCE(p.email, '')", Value: func(t *Teacher) interface{} { return t.Email }, Sort: true, Filter: true, Search: true},
+		"active":     {Column: "u.is_active", Kind: kindBool, Value: func(t *Teacher) interface{} { return t.Active }, Sort: true, Filter: true},
+	},
+	Key:         "id",
+	DefaultSort: []SortField{{Field: "username"}},
+}
+
+// ListTeachers retrieves a page of teachers with their associated subjects
+//
+// Parameters:
+//   - params: Page, sort, filters (email, active) and search (username, names, email)
 //
 // Returns:
-//   - []*Subject: Array of all subjects
-//   - error: Error if retrieval fails
-func (db *DB) GetAllSubjects() ([]*Subject, error) {
-	query := `
-		SELECT id, grade, name, description, created_at
-		FROM subjects
-		ORDER BY grade, name
-	`
-	rows, err := db.Query(query)
+//   - *ListResult[*Teacher]: Page of teachers ordered by username unless sorted otherwise
+//   - error: ErrInvalidListParams or a database error
+func (db *DB) ListTeachers(params ListParams) (*ListResult[*Teacher], error) {
+	result, err := queryList(db, teacherListSpec, params, teacherListQuery,
+		[]string{"u.role = 'teacher'"}, nil, scanTeacherRow)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var subjects []*Subject
-	for rows.Next() {
-		subject := &Subject{}
-		err := rows.Scan(
-			&subject.ID,
-			&subject.Grade,
-			&subject.Name,
-			&subject.Description,
-			&subject.CreatedAt,
-		)
-		if err != nil {
+	// Load subjects once the rows are closed; a page is at most MaxListLimit teachers
+	for _, teacher := range result.Data {
+		if teacher.Subjects, err = db.GetTeacherSubjects(teacher.ID); err != nil {
 			return nil, err
 		}
-		subjects = append(subjects, subject)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
 	}
 
-	return subjects, nil
+	return result, nil
 }
 
-// GetSubjectsByGrade retrieves all subjects for a specific grade
+// EachTeacher streams every teacher matching the filters and search of params
+// in sort order, with their subjects
 //
 // Parameters:
-//   - grade: Educational grade (PIB, IB1, or IB2)
+//   - params: Sort, filters and search as for ListTeachers; limit, page and cursor are ignored
+//   - fn: Called for each teacher; an error stops the iteration and is returned
 //
 // Returns:
-//   - []*Subject: Array of subjects for the specified grade
-//   - error: Error if retrieval fails
-func (db *DB) GetSubjectsByGrade(grade string) ([]*Subject, error) {
-	query := `
-		SELECT id, grade, name, description, created_at
-		FROM subjects
-		WHERE grade = $1
-		ORDER BY name
-	`
-	rows, err := db.Query(query, grade)
+//   - error: ErrInvalidListParams before any teacher, or an error of the query or fn
+func (db *DB) EachTeacher(params ListParams, fn func(*Teacher) error) error {
+	// Assignments are loaded up front so that no second query runs while the teachers stream
+	subjects, err := db.subjectsByTeacher()
+	if err != nil {
+		return err
+	}
+
+	return queryEach(db, teacherListSpec, params, teacherListQuery,
+		[]string{"u.role = 'teacher'"}, nil, scanTeacherRow,
+		func(teacher *Teacher) error {
+			teacher.Subjects = subjects[teacher.ID]
+			return fn(teacher)
+		})
+}
+
+// teacherListQuery selects teachers for scanTeacherRow. Users given the
+// teacher role through role management may not have a profile yet.
+const teacherListQuery = `
+		SELECT u.id, u.username, COALESCE(p.first_name, ''), COALESCE(p.last_name, ''),
+		       COALESCE(p.email, ''), u.is_active
+		FROM users u
+		LEFT JOIN teacher_profiles p ON p.user_id = u.id`
+
+// scanTeacherRow scans a row selected with teacherListQuery
+func scanTeacherRow(rows *sql.Rows) (*Teacher, error) {
+	teacher := &Teacher{}
+	err := rows.Scan(
+		&teacher.ID,
+		&teacher.Username,
+		&teacher.FirstName,
+		&teacher.LastName,
+		&teacher.Email,
+		&teacher.Active,
+	)
+	return teacher, err
+}
+
+// subjectsByTeacher loads every subject assignment
+//
+// Returns:
+//   - map[int][]Subject: Subjects of each teacher ordered by grade and name, keyed by teacher ID
+//   - error: A database error
+func (db *DB) subjectsByTeacher() (map[int][]Subject, error) {
+	subjects, err := db.GetAllSubjects(true)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT teacher_id, subject_id FROM teacher_subjects")
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var subjects []*Subject
+	teachers := map[int][]int{} // subject ID -> teacher IDs
 	for rows.Next() {
-		subject := &Subject{}
-		err := rows.Scan(
-			&subject.ID,
-			&subject.Grade,
-			&subject.Name,
-			&subject.Description,
-			&subject.CreatedAt,
-		)
-		if err != nil {
+		var teacherID, subjectID int
+		if err := rows.Scan(&teacherID, &subjectID); err != nil {
 			return nil, err
 		}
-		subjects = append(subjects, subject)
+		teachers[subjectID] = append(teachers[subjectID], teacherID)
 	}
-
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return subjects, nil
+	result := map[int][]Subject{}
+	for _, subject := range subjects {
+		for _, teacherID := range teachers[subject.ID] {
+			result[teacherID] = append(result[teacherID], *subject)
+		}
+	}
+	return result, nil
 }
 
-// GetSubjectByID retrieves a subject by ID
+// GetTeacherByID retrieves a teacher by ID with their associated subjects
 //
 // Parameters:
-//   - id: Subject ID to retrieve
+//   - id: Teacher ID to retrieve
 //
 // Returns:
-//   - *Subject: Subject if found
-//   - error: Error if subject not found or database error
-func (db *DB) GetSubjectByID(id int) (*Subject, error) {
-	subject := &Subject{}
+//   - *Teacher: Teacher with their subjects if found
+//   - error: Error if teacher not found or database error
+func (db *DB) GetTeacherByID(id int) (*Teacher, error) {
+	teacher := &Teacher{}
 	query := `
-		SELECT id, grade, name, description, created_at
-		FROM subjects
-		WHERE id = $1
+		SELECT u.id, u.username, COALESCE(p.first_name, ''), COALESCE(p.last_name, ''),
+		       COALESCE(p.email, ''), u.is_active
+		FROM users u
+		LEFT JOIN teacher_profiles p ON p.user_id = u.id
+		WHERE u.id = $1 AND u.role = 'teacher'
 	`
 	err := db.QueryRow(query, id).Scan(
-		&subject.ID,
-		&subject.Grade,
-		&subject.Name,
-		&subject.Description,
-		&subject.CreatedAt,
+		&teacher.ID,
+		&teacher.Username,
+		&teacher.FirstName,
+		&teacher.LastName,
+		&teacher.Email,
+		&teacher.Active,
 	)
 	if err != nil {
 		return nil, err
 	}
-	return subject, nil
+
+	// Get subjects for this teacher
+	subjects, err := db.GetTeacherSubjects(teacher.ID)
+	if err != nil {
+		return nil, err
+	}
+	teacher.Subjects = subjects
+
+	return teacher, nil
 }
 
-// GetAllTeachers retrieves all teachers with their associated subjects
+// CreateTeacher creates a new teacher and corresponding user.
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - req: Teacher creation request with personal and login information
 //
 // Returns:
-//   - []*Teacher: Array of all teachers with their subjects
-//   - error: Error if retrieval fails
-func (db *DB) GetAllTeachers() ([]*Teacher, error) {
-	// Get all users with role 'teacher'
-	query := `
-		SELECT id, username
-		FROM users
-		WHERE role = 'teacher'
-		ORDER BY username
-	`
-	rows, err := db.Query(query)
+//   - *Teacher: Created teacher object
+//   - error: Error if creation fails, e.g. a duplicate username or email
+func (db *DB) CreateTeacher(req *TeacherRequest) (*Teacher, error) {
+	hash, err := db.hashPassword(req.Password)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var teachers []*Teacher
-	for rows.Next() {
-		teacher := &Teacher{}
-		err := rows.Scan(
-			&teacher.ID,
-			&teacher.Username,
-		)
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
 		if err != nil {
-			return nil, err
+			tx.Rollback()
 		}
+	}()
 
-		// Get subjects for this teacher
-		subjects, err := db.GetTeacherSubjects(teacher.ID)
-		if err != nil {
-			return nil, err
-		}
-		teacher.Subjects = subjects
+	// Create user first
+	teacher := &Teacher{Subjects: []Subject{}}
+	userQuery := `
+		INSERT INTO users (username, password, role, date_created)
+		VALUES ($1, $2, 'teacher', $3)
+		RETURNING id, username, is_active
+	`
+	err = tx.QueryRow(userQuery, req.Username, hash, time.Now().UTC()).Scan(
+		&teacher.ID,
+		&teacher.Username,
+		&teacher.Active,
+	)
+	if err != nil {
+		return nil, err
+	}
 
-		teachers = append(teachers, teacher)
+	// Create teacher profile
+	now := time.Now().UTC()
+	profileQuery := `
+		INSERT INTO teacher_profiles (user_id, first_name, last_name, email, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING first_name, last_name, email
+	`
+	err = tx.QueryRow(
+		profileQuery,
+		teacher.ID,
+		req.FirstName,
+		req.LastName,
+		req.Email,
+		now,
+		now,
+	).Scan(
+		&teacher.FirstName,
+		&teacher.LastName,
+		&teacher.Email,
+	)
+	if err != nil {
+		return nil, err
 	}
 
-	if err = rows.Err(); err != nil {
+	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
 
-	return teachers, nil
+	return teacher, nil
 }
 
-// GetTeacherByID retrieves a teacher by ID with their associated subjects
+// UpdateTeacher updates an existing teacher's profile and optionally their password.
+// This operation is performed in a transaction to ensure data consistency.
 //
 // Parameters:
-//   - id: Teacher ID to retrieve
+//   - id: Teacher (user) ID to update
+//   - req: Teacher update request with the new information
 //
 // Returns:
-//   - *Teacher: Teacher with their subjects if found
-//   - error: Error if teacher not found or database error
-func (db *DB) GetTeacherByID(id int) (*Teacher, error) {
+//   - *Teacher: Updated teacher object
+//   - error: sql.ErrNoRows if the teacher does not exist, or a database error
+func (db *DB) UpdateTeacher(id int, req *TeacherRequest) (*Teacher, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Lock the user row and make sure it is a teacher
 	teacher := &Teacher{}
-	query := `
-		SELECT id, username
-		FROM users
-		WHERE id = $1 AND role = 'teacher'
+	err = tx.QueryRow(
+		"SELECT id, username, is_active FROM users WHERE id = $1 AND role = 'teacher' FOR UPDATE",
+		id,
+	).Scan(&teacher.ID, &teacher.Username, &teacher.Active)
+	if err != nil {
+		return nil, err
+	}
+
+	// Update password if provided
+	if req.Password != "" {
+		var hash string
+		hash, err = db.hashPassword(req.Password)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec("UPDATE users SET password = $1 WHERE id = $2", hash, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Update the profile, creating it for teachers that do not have one yet
+	now := time.Now().UTC()
+	profileQuery := `
+		INSERT INTO teacher_profiles (user_id, first_name, last_name, email, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (user_id) DO UPDATE
+		SET first_name = EXCLUDED.first_name, last_name = EXCLUDED.last_name,
+		    email = EXCLUDED.email, updated_at = EXCLUDED.updated_at
+		RETURNING first_name, last_name, email
 	`
-	err := db.QueryRow(query, id).Scan(
-		&teacher.ID,
-		&teacher.Username,
+	err = tx.QueryRow(profileQuery, id, req.FirstName, req.LastName, req.Email, now).Scan(
+		&teacher.FirstName,
+		&teacher.LastName,
+		&teacher.Email,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get subjects for this teacher
-	subjects, err := db.GetTeacherSubjects(teacher.ID)
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	teacher.Subjects, err = db.GetTeacherSubjects(id)
 	if err != nil {
 		return nil, err
 	}
-	teacher.Subjects = subjects
 
 	return teacher, nil
 }
 
+// SetTeacherActive activates or deactivates a teacher's login account
+//
+// Parameters:
+//   - id: Teacher (user) ID
+//   - active: Whether the teacher may log in
+//
+// Returns:
+//   - error: sql.ErrNoRows if the teacher does not exist, or a database error
+func (db *DB) SetTeacherActive(id int, active bool) error {
+	res, err := db.Exec(
+		"UPDATE users SET is_active = $1 WHERE id = $2 AND role = 'teacher'",
+		active, id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteTeacher deletes a teacher and their user account. The profile,
+// subject assignments and tokens are removed by cascading foreign keys.
+//
+// Parameters:
+//   - id: Teacher (user) ID to delete
+//
+// Returns:
+//   - error: sql.ErrNoRows if the teacher does not exist, or a database error
+func (db *DB) DeleteTeacher(id int) error {
+	res, err := db.Exec("DELETE FROM users WHERE id = $1 AND role = 'teacher'", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 // GetTeacherSubjects retrieves all subjects taught by a specific teacher
 //
 // Parameters:
@@ -235,7 +401,7 @@ func (db *DB) GetTeacherByID(id int) (*Teacher, error) {
 //   - error: Error if retrieval fails
 func (db *DB) GetTeacherSubjects(teacherID int) ([]Subject, error) {
 	query := `
-		SELECT s.id, s.grade, s.name, s.description, s.created_at
+		SELECT ` + subjectColumns + `
 		FROM subjects s
 		JOIN teacher_subjects ts ON s.id = ts.subject_id
 		WHERE ts.teacher_id = $1
@@ -250,14 +416,7 @@ func (db *DB) GetTeacherSubjects(teacherID int) ([]Subject, error) {
 	var subjects []Subject
 	for rows.Next() {
 		subject := Subject{}
-		err := rows.Scan(
-			&subject.ID,
-			&subject.Grade,
-			&subject.Name,
-			&subject.Description,
-			&subject.CreatedAt,
-		)
-		if err != nil {
+		if err := scanSubject(rows, &subject); err != nil {
 			return nil, err
 		}
 		subjects = append(subjects, subject)
@@ -270,6 +429,32 @@ func (db *DB) GetTeacherSubjects(teacherID int) ([]Subject, error) {
 	return subjects, nil
 }
 
+// requireTeaching checks that a teacher is assigned to a subject
+//
+// Parameters:
+//   - q: Database or transaction
+//   - teacherID: User ID of the teacher
+//   - subjectID: Subject to check
+//
+// Returns:
+//   - error: ErrNotTeaching if the teacher is not assigned, or a database error
+func requireTeaching(q interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}, teacherID, subjectID int) error {
+	var teaches bool
+	err := q.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM teacher_subjects WHERE teacher_id = $1 AND subject_id = $2)",
+		teacherID, subjectID,
+	).Scan(&teaches)
+	if err != nil {
+		return err
+	}
+	if !teaches {
+		return ErrNotTeaching
+	}
+	return nil
+}
+
 // AssignSubjectToTeacher assigns a subject to a teacher
 //
 // Parameters:
@@ -277,7 +462,8 @@ func (db *DB) GetTeacherSubjects(teacherID int) ([]Subject, error) {
 //   - subjectID: Subject ID
 //
 // Returns:
-//   - error: Error if assignment fails
+//   - error: sql.ErrNoRows if the teacher or subject does not exist,
+//     ErrSubjectArchived, or a database error
 func (db *DB) AssignSubjectToTeacher(teacherID, subjectID int) error {
 	// First verify this is a valid teacher and subject
 	var teacherExists bool
@@ -289,13 +475,13 @@ func (db *DB) AssignSubjectToTeacher(teacherID, subjectID int) error {
 		return sql.ErrNoRows
 	}
 
-	var subjectExists bool
-	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM subjects WHERE id = $1)", subjectID).Scan(&subjectExists)
+	var archived bool
+	err = db.QueryRow("SELECT archived FROM subjects WHERE id = $1", subjectID).Scan(&archived)
 	if err != nil {
 		return err
 	}
-	if !subjectExists {
-		return sql.ErrNoRows
+	if archived {
+		return ErrSubjectArchived
 	}
 
 	// Create the assignment
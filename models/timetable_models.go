@@ -0,0 +1,1024 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SlotTimeLayout is the format of time slot start and end times
+const SlotTimeLayout = "15:04"
+
+// Weekdays names the days lessons may be scheduled on, numbered 1 (Monday) to 7 (Sunday)
+var Weekdays = []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+
+// Kinds of timetable conflict
+const (
+	ConflictTeacher = "teacher" // The teacher already teaches another lesson
+	ConflictRoom    = "room"    // The room is already booked
+	ConflictStudent = "student" // Students of the subject already attend another lesson
+)
+
+// Errors returned by timetable operations
+var (
+	// ErrInvalidTimetable is returned for an invalid time slot, room or
+	// lesson. The wrapped message describes the problem.
+	ErrInvalidTimetable = errors.New("invalid timetable entry")
+	// ErrSlotInUse is returned when a time slot with scheduled lessons is deleted
+	ErrSlotInUse = errors.New("time slot has scheduled lessons")
+	// ErrRoomInUse is returned when a room with scheduled lessons is deleted
+	ErrRoomInUse = errors.New("room has scheduled lessons")
+)
+
+// TimeSlot is a period of the school day. Time slots never overlap, so
+// lessons in different slots never clash.
+type TimeSlot struct {
+	ID        int    `json:"id"`         // Unique identifier
+	Name      string `json:"name"`       // Unique name, e.g. "Period 1"
+	StartTime string `json:"start_time"` // HH:MM
+	EndTime   string `json:"end_time"`   // HH:MM, after the start
+}
+
+// TimeSlotRequest is used for creating or updating a time slot
+type TimeSlotRequest struct {
+	Name      string `json:"name"`       // Required, unique
+	StartTime string `json:"start_time"` // HH:MM
+	EndTime   string `json:"end_time"`   // HH:MM
+}
+
+// Room is a room lessons are held in
+type Room struct {
+	ID        int       `json:"id"`       // Unique identifier
+	Name      string    `json:"name"`     // Unique name, e.g. "Lab 2"
+	Capacity  int       `json:"capacity"` // Seats, 0 if unknown
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RoomRequest is used for creating or updating a room
+type RoomRequest struct {
+	Name     string `json:"name"`     // Required, unique
+	Capacity int    `json:"capacity"` // Seats, 0 if unknown
+}
+
+// TimetableLesson is a weekly recurring lesson of a subject
+type TimetableLesson struct {
+	ID          int       `json:"id"`                   // Unique identifier
+	SubjectID   int       `json:"subject_id"`           // Reference to subjects table
+	SubjectName string    `json:"subject_name"`         // Subject name (added for convenience)
+	Grade       string    `json:"grade"`                // Subject's grade (added for convenience)
+	TeacherID   int       `json:"teacher_id,omitempty"` // Teacher's user ID, 0 if deleted
+	TeacherName string    `json:"teacher_name"`         // Teacher's name (added for convenience)
+	RoomID      int       `json:"room_id"`              // Reference to rooms table
+	RoomName    string    `json:"room_name"`            // Room name (added for convenience)
+	Day         int       `json:"day"`                  // 1 (Monday) to 7 (Sunday)
+	SlotID      int       `json:"slot_id"`              // Reference to time_slots table
+	SlotName    string    `json:"slot_name"`            // Time slot name (added for convenience)
+	StartTime   string    `json:"start_time"`           // HH:MM of the time slot
+	EndTime     string    `json:"end_time"`             // HH:MM of the time slot
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TimetableLessonRequest is used for scheduling or moving a lesson
+type TimetableLessonRequest struct {
+	SubjectID int `json:"subject_id"` // Subject that is not archived
+	TeacherID int `json:"teacher_id"` // Teacher assigned to the subject
+	RoomID    int `json:"room_id"`    // Room the lesson is held in
+	Day       int `json:"day"`        // 1 (Monday) to 7 (Sunday)
+	SlotID    int `json:"slot_id"`    // Time slot of the lesson
+}
+
+// ExamTimeLayout is the format of exam start times, in the school's local time
+const ExamTimeLayout = "2006-01-02T15:04"
+
+// Exam is a scheduled sitting of a subject's exam paper
+type Exam struct {
+	ID              int       `json:"id"`               // Unique identifier
+	SubjectID       int       `json:"subject_id"`       // Reference to subjects table
+	SubjectName     string    `json:"subject_name"`     // Subject name (added for convenience)
+	Grade           string    `json:"grade"`            // Subject's grade (added for convenience)
+	Name            string    `json:"name"`             // e.g. "Paper 1"
+	StartsAt        string    `json:"starts_at"`        // YYYY-MM-DDTHH:MM, local time
+	DurationMinutes int       `json:"duration_minutes"` // Length of the sitting
+	Location        string    `json:"location"`         // Where it is sat, e.g. "Sports hall"; may be empty
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ExamRequest is used for scheduling or moving an exam
+type ExamRequest struct {
+	SubjectID       int    `json:"subject_id"`       // Subject that is not archived
+	Name            string `json:"name"`             // Required, up to 100 characters
+	StartsAt        string `json:"starts_at"`        // YYYY-MM-DDTHH:MM, local time
+	DurationMinutes int    `json:"duration_minutes"` // 1 to 600
+	Location        string `json:"location"`         // Optional, up to 100 characters
+}
+
+// TimetableConflict describes why a lesson cannot be scheduled
+type TimetableConflict struct {
+	Type       string `json:"type"`                  // teacher, room or student
+	LessonID   int    `json:"lesson_id"`             // Lesson already scheduled at the time
+	Message    string `json:"message"`               // Human-readable description
+	StudentIDs []int  `json:"student_ids,omitempty"` // Students attending both lessons, for student conflicts
+}
+
+// TimetableFilter selects timetable lessons; zero fields match every lesson
+type TimetableFilter struct {
+	TeacherID int // Lessons taught by the teacher
+	StudentID int // Lessons of subjects the student is enrolled in
+	RoomID    int // Lessons held in the room
+	Day       int // Lessons on the day
+}
+
+// TimetableDay lists the lessons of one day of the week
+type TimetableDay struct {
+	Day     int                `json:"day"`     // 1 (Monday) to 7 (Sunday)
+	Name    string             `json:"name"`    // Name of the day
+	Lessons []*TimetableLesson `json:"lessons"` // Lessons in time order
+}
+
+// Timetable is the weekly timetable of a teacher or student
+type Timetable struct {
+	TeacherID int            `json:"teacher_id,omitempty"` // Teacher's user ID, for a teacher's timetable
+	StudentID int            `json:"student_id,omitempty"` // Student ID, for a student's timetable
+	Name      string         `json:"name"`                 // Teacher's or student's name
+	Days      []TimetableDay `json:"days"`                 // Days of the week with their lessons
+}
+
+// ValidateTimeSlot checks and normalizes a time slot request in place
+//
+// Parameters:
+//   - req: Time slot to check
+//
+// Returns:
+//   - error: ErrInvalidTimetable wrapped with the problem, or nil
+func ValidateTimeSlot(req *TimeSlotRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 50 {
+		return fmt.Errorf("%w: time slot name must be 1 to 50 characters", ErrInvalidTimetable)
+	}
+	start, err := time.Parse(SlotTimeLayout, strings.TrimSpace(req.StartTime))
+	if err != nil {
+		return fmt.Errorf("%w: start_time must be formatted as HH:MM", ErrInvalidTimetable)
+	}
+	end, err := time.Parse(SlotTimeLayout, strings.TrimSpace(req.EndTime))
+	if err != nil {
+		return fmt.Errorf("%w: end_time must be formatted as HH:MM", ErrInvalidTimetable)
+	}
+	if !end.After(start) {
+		return fmt.Errorf("%w: end_time must be after start_time", ErrInvalidTimetable)
+	}
+	req.StartTime, req.EndTime = start.Format(SlotTimeLayout), end.Format(SlotTimeLayout)
+	return nil
+}
+
+// ValidateRoom checks and normalizes a room request in place
+//
+// Returns:
+//   - error: ErrInvalidTimetable wrapped with the problem, or nil
+func ValidateRoom(req *RoomRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 50 {
+		return fmt.Errorf("%w: room name must be 1 to 50 characters", ErrInvalidTimetable)
+	}
+	if req.Capacity < 0 {
+		return fmt.Errorf("%w: capacity must not be negative", ErrInvalidTimetable)
+	}
+	return nil
+}
+
+// ValidateTimetableLesson checks a lesson request
+//
+// Returns:
+//   - error: ErrInvalidTimetable wrapped with the problem, or nil
+func ValidateTimetableLesson(req *TimetableLessonRequest) error {
+	if req.SubjectID == 0 || req.TeacherID == 0 || req.RoomID == 0 || req.SlotID == 0 {
+		return fmt.Errorf("%w: subject_id, teacher_id, room_id and slot_id are required", ErrInvalidTimetable)
+	}
+	if req.Day < 1 || req.Day > len(Weekdays) {
+		return fmt.Errorf("%w: day must be 1 (Monday) to 7 (Sunday)", ErrInvalidTimetable)
+	}
+	return nil
+}
+
+// ValidateExam checks and normalizes an exam request in place
+//
+// Returns:
+//   - error: ErrInvalidTimetable wrapped with the problem, or nil
+func ValidateExam(req *ExamRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Location = strings.TrimSpace(req.Location)
+	if req.SubjectID == 0 {
+		return fmt.Errorf("%w: subject_id is required", ErrInvalidTimetable)
+	}
+	if req.Name == "" || len(req.Name) > 100 {
+		return fmt.Errorf("%w: exam name must be 1 to 100 characters", ErrInvalidTimetable)
+	}
+	startsAt, err := time.Parse(ExamTimeLayout, strings.TrimSpace(req.StartsAt))
+	if err != nil {
+		return fmt.Errorf("%w: starts_at must be formatted as YYYY-MM-DDTHH:MM", ErrInvalidTimetable)
+	}
+	if req.DurationMinutes < 1 || req.DurationMinutes > 600 {
+		return fmt.Errorf("%w: duration_minutes must be 1 to 600", ErrInvalidTimetable)
+	}
+	if len(req.Location) > 100 {
+		return fmt.Errorf("%w: location must be at most 100 characters", ErrInvalidTimetable)
+	}
+	req.StartsAt = startsAt.Format(ExamTimeLayout)
+	return nil
+}
+
+// DetectTimetableConflicts reports what stops a lesson from being scheduled
+// at its day and time slot
+//
+// Parameters:
+//   - req: Lesson to schedule
+//   - scheduled: Other lessons in the same day and time slot
+//   - shared: Students enrolled in both the requested subject and each scheduled lesson's subject, by lesson ID
+//
+// Returns:
+//   - []TimetableConflict: Conflicts, empty if the lesson can be scheduled
+func DetectTimetableConflicts(req *TimetableLessonRequest, scheduled []*TimetableLesson, shared map[int][]int) []TimetableConflict {
+	conflicts := []TimetableConflict{}
+	for _, other := range scheduled {
+		if other.TeacherID == req.TeacherID {
+			conflicts = append(conflicts, TimetableConflict{
+				Type:     ConflictTeacher,
+				LessonID: other.ID,
+				Message:  fmt.Sprintf("%s already teaches %s (%s) at this time", other.TeacherName, other.SubjectName, other.Grade),
+			})
+		}
+		if other.RoomID == req.RoomID {
+			conflicts = append(conflicts, TimetableConflict{
+				Type:     ConflictRoom,
+				LessonID: other.ID,
+				Message:  fmt.Sprintf("%s is already booked for %s (%s) at this time", other.RoomName, other.SubjectName, other.Grade),
+			})
+		}
+		if students := shared[other.ID]; len(students) > 0 {
+			conflicts = append(conflicts, TimetableConflict{
+				Type:       ConflictStudent,
+				LessonID:   other.ID,
+				Message:    fmt.Sprintf("%d student(s) also attend %s (%s) at this time", len(students), other.SubjectName, other.Grade),
+				StudentIDs: students,
+			})
+		}
+	}
+	return conflicts
+}
+
+// DetectEnrollmentConflicts reports the lessons a student already attends at
+// the day and time slot of a lesson of the subject they enroll in
+//
+// Parameters:
+//   - studentID: Student to enroll
+//   - lessons: Lessons of the subject to enroll in
+//   - attended: Lessons of the subjects the student is already enrolled in
+//
+// Returns:
+//   - []TimetableConflict: Conflicts, empty if the student is free for every lesson
+func DetectEnrollmentConflicts(studentID int, lessons, attended []*TimetableLesson) []TimetableConflict {
+	conflicts := []TimetableConflict{}
+	for _, lesson := range lessons {
+		for _, other := range attended {
+			if other.Day != lesson.Day || other.SlotID != lesson.SlotID {
+				continue
+			}
+			conflicts = append(conflicts, TimetableConflict{
+				Type:     ConflictStudent,
+				LessonID: other.ID,
+				Message: fmt.Sprintf("The student already attends %s (%s) on %s at %s",
+					other.SubjectName, other.Grade, Weekdays[other.Day-1], other.StartTime),
+				StudentIDs: []int{studentID},
+			})
+		}
+	}
+	return conflicts
+}
+
+// BuildTimetable groups lessons by day. Monday to Friday are always listed,
+// weekend days only when they have lessons.
+//
+// Parameters:
+//   - lessons: Lessons ordered by day and time
+//
+// Returns:
+//   - []TimetableDay: Days in week order
+func BuildTimetable(lessons []*TimetableLesson) []TimetableDay {
+	days := make([]TimetableDay, len(Weekdays))
+	for i, name := range Weekdays {
+		days[i] = TimetableDay{Day: i + 1, Name: name, Lessons: []*TimetableLesson{}}
+	}
+	for _, lesson := range lessons {
+		days[lesson.Day-1].Lessons = append(days[lesson.Day-1].Lessons, lesson)
+	}
+
+	week := days[:5]
+	for _, day := range days[5:] {
+		if len(day.Lessons) > 0 {
+			week = append(week, day)
+		}
+	}
+	return week
+}
+
+// GetTimeSlots retrieves every time slot
+//
+// Returns:
+//   - []*TimeSlot: Time slots ordered by start time
+//   - error: Error if retrieval fails
+func (db *DB) GetTimeSlots() ([]*TimeSlot, error) {
+	rows, err := db.Query(`
+		SELECT id, name, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
+		FROM time_slots
+		ORDER BY start_time`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	slots := []*TimeSlot{}
+	for rows.Next() {
+		s := &TimeSlot{}
+		if err := rows.Scan(&s.ID, &s.Name, &s.StartTime, &s.EndTime); err != nil {
+			return nil, err
+		}
+		slots = append(slots, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return slots, nil
+}
+
+// saveTimeSlot inserts a time slot, or updates it when id is not 0, after
+// checking it overlaps no other slot
+// This operation is performed in a transaction to ensure data consistency.
+func (db *DB) saveTimeSlot(id int, req *TimeSlotRequest) (*TimeSlot, error) {
+	if err := ValidateTimeSlot(req); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Serialize slot changes so two overlapping slots cannot be saved at once
+	if _, err = tx.Exec("LOCK TABLE time_slots IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return nil, err
+	}
+
+	var overlapping string
+	err = tx.QueryRow(
+		"SELECT name FROM time_slots WHERE id <> $1 AND start_time < $3 AND end_time > $2 LIMIT 1",
+		id, req.StartTime, req.EndTime,
+	).Scan(&overlapping)
+	if err == nil {
+		err = fmt.Errorf("%w: time slot overlaps %s", ErrInvalidTimetable, overlapping)
+		return nil, err
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	slot := &TimeSlot{}
+	if id == 0 {
+		err = tx.QueryRow(`
+			INSERT INTO time_slots (name, start_time, end_time) VALUES ($1, $2, $3)
+			RETURNING id, name, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')`,
+			req.Name, req.StartTime, req.EndTime,
+		).Scan(&slot.ID, &slot.Name, &slot.StartTime, &slot.EndTime)
+	} else {
+		err = tx.QueryRow(`
+			UPDATE time_slots SET name = $1, start_time = $2, end_time = $3 WHERE id = $4
+			RETURNING id, name, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')`,
+			req.Name, req.StartTime, req.EndTime, id,
+		).Scan(&slot.ID, &slot.Name, &slot.StartTime, &slot.EndTime)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return slot, nil
+}
+
+// CreateTimeSlot adds a period to the school day
+//
+// Parameters:
+//   - req: Name, start and end time
+//
+// Returns:
+//   - *TimeSlot: Created time slot
+//   - error: ErrInvalidTimetable if invalid or overlapping, a duplicate name error, or a database error
+func (db *DB) CreateTimeSlot(req *TimeSlotRequest) (*TimeSlot, error) {
+	return db.saveTimeSlot(0, req)
+}
+
+// UpdateTimeSlot renames a time slot or moves its times. Scheduled lessons move with it.
+//
+// Parameters:
+//   - id: Time slot to update
+//   - req: New name, start and end time
+//
+// Returns:
+//   - *TimeSlot: Updated time slot
+//   - error: sql.ErrNoRows if the slot does not exist, ErrInvalidTimetable if
+//     invalid or overlapping, a duplicate name error, or a database error
+func (db *DB) UpdateTimeSlot(id int, req *TimeSlotRequest) (*TimeSlot, error) {
+	return db.saveTimeSlot(id, req)
+}
+
+// DeleteTimeSlot deletes a time slot without scheduled lessons
+//
+// Parameters:
+//   - id: Time slot to delete
+//
+// Returns:
+//   - error: sql.ErrNoRows, ErrSlotInUse, or a database error
+func (db *DB) DeleteTimeSlot(id int) error {
+	var inUse bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM timetable_lessons WHERE slot_id = $1)", id).Scan(&inUse); err != nil {
+		return err
+	}
+	if inUse {
+		return ErrSlotInUse
+	}
+
+	result, err := db.Exec("DELETE FROM time_slots WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetRooms retrieves every room
+//
+// Returns:
+//   - []*Room: Rooms ordered by name
+//   - error: Error if retrieval fails
+func (db *DB) GetRooms() ([]*Room, error) {
+	rows, err := db.Query("SELECT id, name, capacity, created_at FROM rooms ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rooms := []*Room{}
+	for rows.Next() {
+		r := &Room{}
+		if err := rows.Scan(&r.ID, &r.Name, &r.Capacity, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rooms, nil
+}
+
+// CreateRoom adds a room
+//
+// Parameters:
+//   - req: Name and capacity
+//
+// Returns:
+//   - *Room: Created room
+//   - error: ErrInvalidTimetable, a duplicate name error, or a database error
+func (db *DB) CreateRoom(req *RoomRequest) (*Room, error) {
+	if err := ValidateRoom(req); err != nil {
+		return nil, err
+	}
+
+	room := &Room{}
+	err := db.QueryRow(
+		"INSERT INTO rooms (name, capacity) VALUES ($1, $2) RETURNING id, name, capacity, created_at",
+		req.Name, req.Capacity,
+	).Scan(&room.ID, &room.Name, &room.Capacity, &room.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// UpdateRoom renames a room or changes its capacity
+//
+// Parameters:
+//   - id: Room to update
+//   - req: New name and capacity
+//
+// Returns:
+//   - *Room: Updated room
+//   - error: sql.ErrNoRows, ErrInvalidTimetable, a duplicate name error, or a database error
+func (db *DB) UpdateRoom(id int, req *RoomRequest) (*Room, error) {
+	if err := ValidateRoom(req); err != nil {
+		return nil, err
+	}
+
+	room := &Room{}
+	err := db.QueryRow(
+		"UPDATE rooms SET name = $1, capacity = $2 WHERE id = $3 RETURNING id, name, capacity, created_at",
+		req.Name, req.Capacity, id,
+	).Scan(&room.ID, &room.Name, &room.Capacity, &room.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// DeleteRoom deletes a room without scheduled lessons
+//
+// Parameters:
+//   - id: Room to delete
+//
+// Returns:
+//   - error: sql.ErrNoRows, ErrRoomInUse, or a database error
+func (db *DB) DeleteRoom(id int) error {
+	var inUse bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM timetable_lessons WHERE room_id = $1)", id).Scan(&inUse); err != nil {
+		return err
+	}
+	if inUse {
+		return ErrRoomInUse
+	}
+
+	result, err := db.Exec("DELETE FROM rooms WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// timetableLessonSelect selects the columns scanned by scanTimetableLesson
+const timetableLessonSelect = `
+	SELECT l.id, l.subject_id, sub.name, sub.grade, COALESCE(l.teacher_id, 0),
+		COALESCE(tp.first_name || ' ' || tp.last_name, u.username, ''), l.room_id, r.name,
+		l.day, l.slot_id, ts.name, to_char(ts.start_time, 'HH24:MI'), to_char(ts.end_time, 'HH24:MI'),
+		l.created_at, l.updated_at
+	FROM timetable_lessons l
+	JOIN subjects sub ON sub.id = l.subject_id
+	JOIN rooms r ON r.id = l.room_id
+	JOIN time_slots ts ON ts.id = l.slot_id
+	LEFT JOIN users u ON u.id = l.teacher_id
+	LEFT JOIN teacher_profiles tp ON tp.user_id = l.teacher_id`
+
+// scanTimetableLesson scans a row selected with timetableLessonSelect
+func scanTimetableLesson(row interface{ Scan(...interface{}) error }) (*TimetableLesson, error) {
+	l := &TimetableLesson{}
+	err := row.Scan(
+		&l.ID, &l.SubjectID, &l.SubjectName, &l.Grade, &l.TeacherID, &l.TeacherName, &l.RoomID, &l.RoomName,
+		&l.Day, &l.SlotID, &l.SlotName, &l.StartTime, &l.EndTime, &l.CreatedAt, &l.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// queryTimetableLessons selects the lessons matching a condition, ordered by day and time
+func queryTimetableLessons(q queryer, where string, args ...interface{}) ([]*TimetableLesson, error) {
+	rows, err := q.Query(timetableLessonSelect+" WHERE "+where+" ORDER BY l.day, ts.start_time, sub.name, l.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lessons := []*TimetableLesson{}
+	for rows.Next() {
+		l, err := scanTimetableLesson(rows)
+		if err != nil {
+			return nil, err
+		}
+		lessons = append(lessons, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lessons, nil
+}
+
+// GetTimetableLesson retrieves a timetable lesson
+//
+// Parameters:
+//   - id: Lesson to retrieve
+//
+// Returns:
+//   - *TimetableLesson: Lesson with subject, teacher, room and time slot
+//   - error: sql.ErrNoRows if the lesson does not exist, or a database error
+func (db *DB) GetTimetableLesson(id int) (*TimetableLesson, error) {
+	return scanTimetableLesson(db.QueryRow(timetableLessonSelect+" WHERE l.id = $1", id))
+}
+
+// GetTimetableLessons retrieves the timetable lessons matching a filter
+//
+// Parameters:
+//   - filter: Teacher, student, room and day to filter by; zero fields are ignored
+//
+// Returns:
+//   - []*TimetableLesson: Lessons ordered by day and time
+//   - error: Error if retrieval fails
+func (db *DB) GetTimetableLessons(filter TimetableFilter) ([]*TimetableLesson, error) {
+	where := "TRUE"
+	var args []interface{}
+	if filter.TeacherID != 0 {
+		args = append(args, filter.TeacherID)
+		where += fmt.Sprintf(" AND l.teacher_id = $%d", len(args))
+	}
+	if filter.StudentID != 0 {
+		args = append(args, filter.StudentID)
+		where += fmt.Sprintf(" AND l.subject_id IN (SELECT subject_id FROM enrollments WHERE student_id = $%d)", len(args))
+	}
+	if filter.RoomID != 0 {
+		args = append(args, filter.RoomID)
+		where += fmt.Sprintf(" AND l.room_id = $%d", len(args))
+	}
+	if filter.Day != 0 {
+		args = append(args, filter.Day)
+		where += fmt.Sprintf(" AND l.day = $%d", len(args))
+	}
+	return queryTimetableLessons(db, where, args...)
+}
+
+// saveTimetableLesson schedules a lesson, or moves it when id is not 0,
+// unless it conflicts with the lessons already in its day and time slot
+// This operation is performed in a transaction to ensure data consistency.
+func (db *DB) saveTimetableLesson(id int, req *TimetableLessonRequest) (*TimetableLesson, []TimetableConflict, error) {
+	if err := ValidateTimetableLesson(req); err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Serialize timetable changes so two clashing lessons cannot be saved at once
+	if _, err = tx.Exec("LOCK TABLE timetable_lessons IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return nil, nil, err
+	}
+
+	if id != 0 {
+		var exists bool
+		if err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM timetable_lessons WHERE id = $1)", id).Scan(&exists); err != nil {
+			return nil, nil, err
+		}
+		if !exists {
+			err = sql.ErrNoRows
+			return nil, nil, err
+		}
+	}
+
+	var archived, teaches, roomExists, slotExists bool
+	err = tx.QueryRow(`
+		SELECT archived,
+		       EXISTS(SELECT 1 FROM teacher_subjects WHERE teacher_id = $2 AND subject_id = $1),
+		       EXISTS(SELECT 1 FROM rooms WHERE id = $3),
+		       EXISTS(SELECT 1 FROM time_slots WHERE id = $4)
+		FROM subjects WHERE id = $1 FOR SHARE`,
+		req.SubjectID, req.TeacherID, req.RoomID, req.SlotID,
+	).Scan(&archived, &teaches, &roomExists, &slotExists)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		err = fmt.Errorf("%w: subject not found", ErrInvalidTimetable)
+	case err != nil:
+	case archived:
+		err = ErrSubjectArchived
+	case !teaches:
+		err = fmt.Errorf("%w: teacher is not assigned to the subject", ErrInvalidTimetable)
+	case !roomExists:
+		err = fmt.Errorf("%w: room not found", ErrInvalidTimetable)
+	case !slotExists:
+		err = fmt.Errorf("%w: time slot not found", ErrInvalidTimetable)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scheduled, err := queryTimetableLessons(tx, "l.day = $1 AND l.slot_id = $2 AND l.id <> $3", req.Day, req.SlotID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	shared, err := sharedTimetableStudents(tx, id, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if conflicts := DetectTimetableConflicts(req, scheduled, shared); len(conflicts) > 0 {
+		tx.Rollback()
+		return nil, conflicts, nil
+	}
+
+	if id == 0 {
+		err = tx.QueryRow(`
+			INSERT INTO timetable_lessons (subject_id, teacher_id, room_id, day, slot_id)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id`,
+			req.SubjectID, req.TeacherID, req.RoomID, req.Day, req.SlotID,
+		).Scan(&id)
+	} else {
+		_, err = tx.Exec(`
+			UPDATE timetable_lessons
+			SET subject_id = $1, teacher_id = $2, room_id = $3, day = $4, slot_id = $5, updated_at = NOW()
+			WHERE id = $6`,
+			req.SubjectID, req.TeacherID, req.RoomID, req.Day, req.SlotID, id,
+		)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	lesson, err := db.GetTimetableLesson(id)
+	return lesson, nil, err
+}
+
+// sharedTimetableStudents finds, for each other lesson in a request's day and
+// time slot, the students also enrolled in the requested subject
+func sharedTimetableStudents(q queryer, exceptID int, req *TimetableLessonRequest) (map[int][]int, error) {
+	rows, err := q.Query(`
+		SELECT l.id, e.student_id
+		FROM timetable_lessons l
+		JOIN enrollments e ON e.subject_id = l.subject_id
+		JOIN enrollments requested ON requested.student_id = e.student_id AND requested.subject_id = $3
+		WHERE l.day = $1 AND l.slot_id = $2 AND l.id <> $4
+		ORDER BY l.id, e.student_id`,
+		req.Day, req.SlotID, req.SubjectID, exceptID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shared := map[int][]int{}
+	for rows.Next() {
+		var lessonID, studentID int
+		if err := rows.Scan(&lessonID, &studentID); err != nil {
+			return nil, err
+		}
+		shared[lessonID] = append(shared[lessonID], studentID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return shared, nil
+}
+
+// CreateTimetableLesson schedules a weekly lesson unless it conflicts with
+// another lesson in the same day and time slot
+//
+// Parameters:
+//   - req: Subject, teacher, room, day and time slot
+//
+// Returns:
+//   - *TimetableLesson: Scheduled lesson, nil if there are conflicts
+//   - []TimetableConflict: Conflicts that kept the lesson from being scheduled
+//   - error: ErrInvalidTimetable, ErrSubjectArchived, or a database error
+func (db *DB) CreateTimetableLesson(req *TimetableLessonRequest) (*TimetableLesson, []TimetableConflict, error) {
+	return db.saveTimetableLesson(0, req)
+}
+
+// UpdateTimetableLesson moves or reassigns a weekly lesson unless it then
+// conflicts with another lesson in the same day and time slot
+//
+// Parameters:
+//   - id: Lesson to update
+//   - req: New subject, teacher, room, day and time slot
+//
+// Returns:
+//   - *TimetableLesson: Updated lesson, nil if there are conflicts
+//   - []TimetableConflict: Conflicts that kept the lesson from being moved
+//   - error: sql.ErrNoRows if the lesson does not exist, ErrInvalidTimetable,
+//     ErrSubjectArchived, or a database error
+func (db *DB) UpdateTimetableLesson(id int, req *TimetableLessonRequest) (*TimetableLesson, []TimetableConflict, error) {
+	return db.saveTimetableLesson(id, req)
+}
+
+// DeleteTimetableLesson removes a lesson from the timetable
+//
+// Parameters:
+//   - id: Lesson to delete
+//
+// Returns:
+//   - error: sql.ErrNoRows if the lesson does not exist, or a database error
+func (db *DB) DeleteTimetableLesson(id int) error {
+	result, err := db.Exec("DELETE FROM timetable_lessons WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// examSelect selects the columns scanned by scanExam
+const examSelect = `
+	SELECT e.id, e.subject_id, sub.name, sub.grade, e.name,
+		to_char(e.starts_at, 'YYYY-MM-DD"T"HH24:MI'), e.duration_minutes, e.location,
+		e.created_at, e.updated_at
+	FROM exams e
+	JOIN subjects sub ON sub.id = e.subject_id`
+
+// scanExam scans a row selected with examSelect
+func scanExam(row interface{ Scan(...interface{}) error }) (*Exam, error) {
+	e := &Exam{}
+	err := row.Scan(
+		&e.ID, &e.SubjectID, &e.SubjectName, &e.Grade, &e.Name,
+		&e.StartsAt, &e.DurationMinutes, &e.Location, &e.CreatedAt, &e.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// GetExam retrieves an exam
+//
+// Parameters:
+//   - id: Exam to retrieve
+//
+// Returns:
+//   - *Exam: Exam with its subject
+//   - error: sql.ErrNoRows if the exam does not exist, or a database error
+func (db *DB) GetExam(id int) (*Exam, error) {
+	return scanExam(db.QueryRow(examSelect+" WHERE e.id = $1", id))
+}
+
+// GetExams retrieves the scheduled exams
+//
+// Parameters:
+//   - subjectID: Subject whose exams are retrieved, 0 for every subject
+//
+// Returns:
+//   - []*Exam: Exams ordered by start time
+//   - error: Error if retrieval fails
+func (db *DB) GetExams(subjectID int) ([]*Exam, error) {
+	rows, err := db.Query(
+		examSelect+" WHERE $1 = 0 OR e.subject_id = $1 ORDER BY e.starts_at, sub.name, e.id",
+		subjectID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exams := []*Exam{}
+	for rows.Next() {
+		e, err := scanExam(rows)
+		if err != nil {
+			return nil, err
+		}
+		exams = append(exams, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return exams, nil
+}
+
+// saveExam schedules an exam, or moves it when id is not 0, after checking
+// its subject exists and is not archived
+// This operation is performed in a transaction to ensure data consistency.
+func (db *DB) saveExam(id int, req *ExamRequest) (*Exam, error) {
+	if err := ValidateExam(req); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var archived bool
+	err = tx.QueryRow("SELECT archived FROM subjects WHERE id = $1 FOR SHARE", req.SubjectID).Scan(&archived)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		err = fmt.Errorf("%w: subject not found", ErrInvalidTimetable)
+	case err != nil:
+	case archived:
+		err = ErrSubjectArchived
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if id == 0 {
+		err = tx.QueryRow(`
+			INSERT INTO exams (subject_id, name, starts_at, duration_minutes, location)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id`,
+			req.SubjectID, req.Name, req.StartsAt, req.DurationMinutes, req.Location,
+		).Scan(&id)
+	} else {
+		var updated int
+		err = tx.QueryRow(`
+			UPDATE exams
+			SET subject_id = $1, name = $2, starts_at = $3, duration_minutes = $4, location = $5, updated_at = NOW()
+			WHERE id = $6
+			RETURNING id`,
+			req.SubjectID, req.Name, req.StartsAt, req.DurationMinutes, req.Location, id,
+		).Scan(&updated)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return db.GetExam(id)
+}
+
+// CreateExam schedules an exam
+//
+// Parameters:
+//   - req: Subject, name, start time, duration and location
+//
+// Returns:
+//   - *Exam: Scheduled exam
+//   - error: ErrInvalidTimetable, ErrSubjectArchived, or a database error
+func (db *DB) CreateExam(req *ExamRequest) (*Exam, error) {
+	return db.saveExam(0, req)
+}
+
+// UpdateExam moves, renames or relocates an exam
+//
+// Parameters:
+//   - id: Exam to update
+//   - req: New subject, name, start time, duration and location
+//
+// Returns:
+//   - *Exam: Updated exam
+//   - error: sql.ErrNoRows if the exam does not exist, ErrInvalidTimetable,
+//     ErrSubjectArchived, or a database error
+func (db *DB) UpdateExam(id int, req *ExamRequest) (*Exam, error) {
+	return db.saveExam(id, req)
+}
+
+// DeleteExam removes an exam from the schedule
+//
+// Parameters:
+//   - id: Exam to delete
+//
+// Returns:
+//   - error: sql.ErrNoRows if the exam does not exist, or a database error
+func (db *DB) DeleteExam(id int) error {
+	result, err := db.Exec("DELETE FROM exams WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
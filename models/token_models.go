@@ -0,0 +1,404 @@
+// Package models provides database models and operations for the WG Education platform.
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrTokenRevoked is returned when a refresh token has already been used or revoked
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// RefreshToken represents a stored refresh token.
+// The token itself is never stored, only its SHA-256 hash.
+type RefreshToken struct {
+	ID         int        `json:"id"`          // Unique identifier
+	UserID     int        `json:"user_id"`     // Owner of the token
+	TokenHash  string     `json:"-"`           // SHA-256 hash of the token
+	ExpiresAt  time.Time  `json:"expires_at"`  // Expiry timestamp
+	CreatedAt  time.Time  `json:"created_at"`  // Creation timestamp
+	RevokedAt  *time.Time `json:"revoked_at"`  // Revocation timestamp, nil while active
+	ReplacedBy *int       `json:"replaced_by"` // Token issued when this one was rotated
+	MFA        bool       `json:"mfa"`         // Issued after two-factor authentication; kept on rotation
+}
+
+// HashToken returns the hex-encoded SHA-256 hash of an opaque token.
+//
+// Parameters:
+//   - token: Plain token value as handed to the client
+//
+// Returns:
+//   - string: Hash suitable for storage and lookups
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetUserByID retrieves a user by their ID.
+//
+// Parameters:
+//   - id: User ID to look up
+//
+// Returns:
+//   - *User: User object if found
+//   - error: Error if user not found or database error
+func (db *DB) GetUserByID(id int) (*User, error) {
+	user := &User{}
+	query := `SELECT id, username, password, role, is_active, date_created, display_name, must_change_password, locked_until FROM users WHERE id = $1`
+
+	err := db.QueryRow(query, id).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Password,
+		&user.Role,
+		&user.Active,
+		&user.DateCreated,
+		&user.DisplayName,
+		&user.MustChangePassword,
+		&user.LockedUntil,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// CreateRefreshToken stores a new refresh token for a user.
+//
+// Parameters:
+//   - userID: Owner of the token
+//   - tokenHash: SHA-256 hash of the token (see HashToken)
+//   - expiresAt: Expiry timestamp
+//   - mfa: Whether the session was started with two-factor authentication
+//
+// Returns:
+//   - *RefreshToken: Stored token record
+//   - error: Error if creation fails
+func (db *DB) CreateRefreshToken(userID int, tokenHash string, expiresAt time.Time, mfa bool) (*RefreshToken, error) {
+	token := &RefreshToken{}
+	query := `
+		INSERT INTO refresh_tokens (user_id, token_hash, expires_at, created_at, mfa)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, user_id, token_hash, expires_at, created_at, mfa
+	`
+	err := db.QueryRow(query, userID, tokenHash, expiresAt, time.Now().UTC(), mfa).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.CreatedAt,
+		&token.MFA,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// GetRefreshTokenByHash retrieves a refresh token by its hash.
+//
+// Parameters:
+//   - tokenHash: SHA-256 hash of the token
+//
+// Returns:
+//   - *RefreshToken: Token record if found, including revoked tokens
+//   - error: Error if token not found or database error
+func (db *DB) GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error) {
+	token := &RefreshToken{}
+	var revokedAt sql.NullTime
+	var replacedBy sql.NullInt64
+	query := `
+		SELECT id, user_id, token_hash, expires_at, created_at, revoked_at, replaced_by, mfa
+		FROM refresh_tokens
+		WHERE token_hash = $1
+	`
+	err := db.QueryRow(query, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.CreatedAt,
+		&revokedAt,
+		&replacedBy,
+		&token.MFA,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	if replacedBy.Valid {
+		id := int(replacedBy.Int64)
+		token.ReplacedBy = &id
+	}
+
+	return token, nil
+}
+
+// RotateRefreshToken revokes a refresh token and stores its replacement.
+// This operation is performed in a transaction; if the old token was revoked
+// concurrently, ErrTokenRevoked is returned and nothing is stored. The
+// replacement keeps the mfa flag of the old token.
+//
+// Parameters:
+//   - oldID: ID of the token being exchanged
+//   - newHash: SHA-256 hash of the replacement token
+//   - expiresAt: Expiry timestamp of the replacement token
+//
+// Returns:
+//   - *RefreshToken: The replacement token record
+//   - error: ErrTokenRevoked if the old token is no longer active, or a database error
+func (db *DB) RotateRefreshToken(oldID int, newHash string, expiresAt time.Time) (*RefreshToken, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	now := time.Now().UTC()
+
+	// Revoke the old token, claiming it so that a concurrent rotation fails
+	var userID int
+	var mfa bool
+	err = tx.QueryRow(
+		"UPDATE refresh_tokens SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL RETURNING user_id, mfa",
+		now, oldID,
+	).Scan(&userID, &mfa)
+	if err == sql.ErrNoRows {
+		err = ErrTokenRevoked
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token := &RefreshToken{}
+	query := `
+		INSERT INTO refresh_tokens (user_id, token_hash, expires_at, created_at, mfa)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, user_id, token_hash, expires_at, created_at, mfa
+	`
+	err = tx.QueryRow(query, userID, newHash, expiresAt, now, mfa).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.CreatedAt,
+		&token.MFA,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET replaced_by = $1 WHERE id = $2", token.ID, oldID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// RevokeRefreshToken revokes a single refresh token belonging to a user.
+// Revoking an unknown or already revoked token is not an error.
+//
+// Parameters:
+//   - userID: Owner of the token
+//   - tokenHash: SHA-256 hash of the token
+//
+// Returns:
+//   - error: Error if the update fails
+func (db *DB) RevokeRefreshToken(userID int, tokenHash string) error {
+	_, err := db.Exec(
+		"UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND token_hash = $3 AND revoked_at IS NULL",
+		time.Now().UTC(), userID, tokenHash,
+	)
+	return err
+}
+
+// RevokeAccessToken adds an access token's jti to the denylist.
+//
+// Parameters:
+//   - jti: Unique token identifier from the JWT
+//   - userID: Owner of the token
+//   - expiresAt: Expiry of the token, after which the entry can be purged
+//
+// Returns:
+//   - error: Error if the insert fails
+func (db *DB) RevokeAccessToken(jti string, userID int, expiresAt time.Time) error {
+	_, err := db.Exec(
+		"INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_at) VALUES ($1, $2, $3, $4) ON CONFLICT (jti) DO NOTHING",
+		jti, userID, expiresAt, time.Now().UTC(),
+	)
+	return err
+}
+
+// ClaimToken adds a single-use token's jti to the denylist and reports
+// whether this call added it. Of concurrent claims of the same token, exactly
+// one succeeds.
+//
+// Parameters:
+//   - jti: Unique token identifier from the JWT
+//   - userID: Owner of the token
+//   - expiresAt: Expiry of the token, after which the entry can be purged
+//
+// Returns:
+//   - bool: True if the token was unused and is now claimed
+//   - error: Error if the insert fails
+func (db *DB) ClaimToken(jti string, userID int, expiresAt time.Time) (bool, error) {
+	result, err := db.Exec(
+		"INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_at) VALUES ($1, $2, $3, $4) ON CONFLICT (jti) DO NOTHING",
+		jti, userID, expiresAt, time.Now().UTC(),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// RevokeUserSessions revokes every refresh token of a user and invalidates
+// all access tokens issued to them up to now.
+// This operation is performed in a transaction to ensure data consistency.
+//
+// Parameters:
+//   - userID: User whose sessions to revoke
+//
+// Returns:
+//   - error: Error if revocation fails
+func (db *DB) RevokeUserSessions(userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	now := time.Now().UTC()
+
+	_, err = tx.Exec(
+		"UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL",
+		now, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO session_revocations (user_id, revoked_at) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET revoked_at = EXCLUDED.revoked_at`,
+		userID, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// IsTokenRevoked reports whether an access token has been revoked, either
+// individually by jti or through a revocation of all the user's sessions.
+//
+// Parameters:
+//   - jti: Unique token identifier from the JWT
+//   - userID: Owner of the token
+//   - issuedAt: Issue time of the token
+//
+// Returns:
+//   - bool: True if the token must be rejected
+//   - error: Error if the lookup fails
+func (db *DB) IsTokenRevoked(jti string, userID int, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	query := `
+		SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1)
+		    OR EXISTS(SELECT 1 FROM session_revocations
+		              WHERE user_id = $2 AND date_trunc('second', revoked_at) >= $3)
+	`
+	err := db.QueryRow(query, jti, userID, issuedAt).Scan(&revoked)
+	if err != nil {
+		return false, err
+	}
+	return revoked, nil
+}
+
+// GetCalendarFeedID retrieves the identifier of a user's current calendar feed.
+//
+// Parameters:
+//   - userID: Owner of the feed
+//
+// Returns:
+//   - string: Feed identifier carried by the feed's signed token
+//   - error: sql.ErrNoRows if the user has no feed yet, or a database error
+func (db *DB) GetCalendarFeedID(userID int) (string, error) {
+	var feedID string
+	err := db.QueryRow("SELECT feed_id FROM calendar_feeds WHERE user_id = $1", userID).Scan(&feedID)
+	return feedID, err
+}
+
+// SetCalendarFeedID creates or replaces a user's calendar feed identifier.
+// Tokens carrying the previous identifier stop working.
+//
+// Parameters:
+//   - userID: Owner of the feed
+//   - feedID: New random feed identifier
+//
+// Returns:
+//   - error: Error if the upsert fails
+func (db *DB) SetCalendarFeedID(userID int, feedID string) error {
+	_, err := db.Exec(`
+		INSERT INTO calendar_feeds (user_id, feed_id, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET feed_id = EXCLUDED.feed_id, created_at = EXCLUDED.created_at`,
+		userID, feedID, time.Now().UTC(),
+	)
+	return err
+}
+
+// PurgeExpiredTokens deletes refresh tokens, denylist entries and password
+// reset tokens that have expired.
+//
+// Returns:
+//   - int64: Number of rows deleted
+//   - error: Error if deletion fails
+func (db *DB) PurgeExpiredTokens() (int64, error) {
+	now := time.Now().UTC()
+
+	res, err := db.Exec("DELETE FROM revoked_tokens WHERE expires_at < $1", now)
+	if err != nil {
+		return 0, err
+	}
+	denylisted, _ := res.RowsAffected()
+
+	res, err = db.Exec("DELETE FROM refresh_tokens WHERE expires_at < $1", now)
+	if err != nil {
+		return 0, err
+	}
+	refresh, _ := res.RowsAffected()
+
+	res, err = db.Exec("DELETE FROM password_reset_tokens WHERE expires_at < $1", now)
+	if err != nil {
+		return 0, err
+	}
+	resets, _ := res.RowsAffected()
+
+	return denylisted + refresh + resets, nil
+}
@@ -7,6 +7,7 @@ package routes
 import (
 	"wg-edu-server/handlers"
 	"wg-edu-server/middleware"
+	"wg-edu-server/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,11 +17,12 @@ import (
 // Parameters:
 //   - router: Gin router instance
 //   - handler: Handler containing dependencies and endpoint handlers
+//   - allowedOrigins: Origins allowed to make cross-origin requests ("*" for any)
 //
 // This function organizes routes into logical groups and applies middleware
-func SetupRoutes(router *gin.Engine, handler *handlers.Handler) {
+func SetupRoutes(router *gin.Engine, handler *handlers.Handler, allowedOrigins []string) {
 	// Add CORS middleware
-	router.Use(CORSMiddleware())
+	router.Use(CORSMiddleware(allowedOrigins))
 
 	// API routes group
 	api := router.Group("/api")
@@ -28,53 +30,338 @@ func SetupRoutes(router *gin.Engine, handler *handlers.Handler) {
 		// Health check endpoint (public)
 		api.GET("/health", handler.HandleHealth)
 
-		// Login endpoint (public)
+		// Login and token refresh endpoints (public)
 		api.POST("/login", handler.HandleLogin)
+		api.POST("/login/mfa", handler.HandleLoginMFA) // Complete a login with the second factor
+		api.POST("/token/refresh", handler.HandleRefreshToken)
+
+		// Password reset endpoints (public, authenticated by the emailed token)
+		api.POST("/password/forgot", handler.HandleForgotPassword) // Mail a reset link
+		api.POST("/password/reset", handler.HandleResetPassword)   // Set a new password with a reset token
+
+		// Calendar feed (public, authenticated by the signed token in the URL
+		// since calendar apps cannot send an Authorization header)
+		api.GET("/calendar/feeds/:token", handler.HandleCalendarFeed)
 
 		// Protected routes (require authentication)
 		protected := api.Group("")
-		protected.Use(middleware.JWTAuth(handler.JWTSecret))
+		protected.Use(
+			middleware.JWTAuth(handler.JWTSecret, handler.Tokens),
+			middleware.LoadPermissions(handler.Roles),
+		)
 		{
 			// General protected endpoint
 			protected.GET("/protected", handler.HandleProtected)
 
-			// Subject routes (available to all authenticated users)
+			// Logout (revokes the current tokens)
+			protected.POST("/logout", handler.HandleLogout)
+
+			// Self-service account routes, open to every role
+			me := protected.Group("/me")
+			{
+				me.GET("", handler.HandleGetMe)                    // Own account and profile
+				me.PUT("", handler.HandleUpdateMe)                 // Change display name and email
+				me.POST("/password", handler.HandleChangePassword) // Change password
+
+				// Two-factor authentication with an authenticator app
+				mfa := me.Group("/mfa")
+				mfa.Use(middleware.RequirePermission(models.PermMFAEnroll))
+				{
+					mfa.GET("", handler.HandleGetMyMFA)                                // Two-factor status
+					mfa.POST("", handler.HandleStartMFAEnrollment)                     // Generate secret and provisioning URI
+					mfa.POST("/confirm", handler.HandleConfirmMFA)                     // Enable with the first code
+					mfa.POST("/recovery-codes", handler.HandleRegenerateRecoveryCodes) // Replace recovery codes
+					mfa.POST("/disable", handler.HandleDisableMFA)                     // Turn off
+				}
+			}
+
+			// Subject routes
 			subjects := protected.Group("/subjects")
+			subjects.Use(middleware.RequirePermission(models.PermSubjectsRead))
 			{
 				subjects.GET("", handler.GetAllSubjects)                // Get all subjects
+				subjects.GET("/export", handler.ExportSubjects)         // Export subjects as CSV, XLSX or JSON
 				subjects.GET("/grouped", handler.GetAllSubjectsGrouped) // Get subjects grouped by grade
 				subjects.GET("/:grade", handler.GetSubjectsByGrade)     // Get subjects by grade
 				subjects.GET("/id/:id", handler.GetSubjectByID)         // Get subject by ID
+
+				// Catalogue management
+				subjectWrite := middleware.RequirePermission(models.PermSubjectsWrite)
+				subjects.POST("", subjectWrite, handler.CreateSubject)       // Create subject
+				subjects.PUT("/:id", subjectWrite, handler.UpdateSubject)    // Update or archive subject
+				subjects.DELETE("/:id", subjectWrite, handler.DeleteSubject) // Delete unused subject
 			}
 
-			// Teacher routes (available to teachers and admins)
+			// Teacher routes
 			teachers := protected.Group("/teachers")
-			teachers.Use(middleware.TeacherOrAdmin())
+			teachers.Use(middleware.RequirePermission(models.PermTeachersRead))
+			{
+				teachers.GET("", handler.GetAllTeachers)        // Get all teachers
+				teachers.GET("/export", handler.ExportTeachers) // Export teachers with their subjects
+				teachers.GET("/:id", handler.GetTeacherByID)    // Get teacher by ID
+
+				// Subject assignment
+				teacherAssign := teachers.Group("")
+				teacherAssign.Use(middleware.RequirePermission(models.PermSubjectsAssign))
+				{
+					teacherAssign.POST("/:id/subjects", handler.AssignSubjectToTeacher)                // Assign subject
+					teacherAssign.DELETE("/:id/subjects/:subjectId", handler.RemoveSubjectFromTeacher) // Remove subject
+				}
+			}
+
+			// Student routes for IB diploma coordination
+			students := protected.Group("/students")
+			{
+				students.GET("/:id/diploma-status",
+					middleware.RequirePermission(models.PermDiplomaRead),
+					handler.HandleGetDiplomaStatus) // Diploma points and failing conditions
+				students.PUT("/:id/diploma-core",
+					middleware.RequirePermission(models.PermDiplomaWrite),
+					handler.HandleSetDiplomaCore) // Record TOK, EE and CAS results
+			}
+
+			// CAS routes. Students log their own activities, supervisors review
+			// them and cas:read sees every student's progress.
+			cas := protected.Group("/cas")
+			{
+				logActivity := middleware.RequirePermission(models.PermCASLog)
+				supervise := middleware.RequirePermission(models.PermCASSupervise)
+
+				cas.GET("/me", logActivity, handler.HandleGetMyCASProgress)                                                     // Own progress and activities
+				cas.POST("/activities", logActivity, handler.HandleCreateCASActivity)                                           // Log activity
+				cas.PUT("/activities/:id", logActivity, handler.HandleUpdateCASActivity)                                        // Edit and resubmit activity
+				cas.DELETE("/activities/:id", logActivity, handler.HandleDeleteCASActivity)                                     // Delete activity
+				cas.GET("/activities/:id", handler.HandleGetCASActivity)                                                        // Get activity
+				cas.GET("/supervision", supervise, handler.HandleGetSupervisedCASActivities)                                    // Activities to review
+				cas.POST("/activities/:id/review", supervise, handler.HandleReviewCASActivity)                                  // Approve or reject
+				cas.GET("/students/:id", middleware.RequirePermission(models.PermCASRead), handler.HandleGetStudentCASProgress) // Student's progress
+			}
+
+			// Extended Essay and Internal Assessment routes. Coordinators assign
+			// supervisors and milestones, supervisors sign milestones off and
+			// comment, and students upload drafts of their own projects.
+			projects := protected.Group("/projects")
+			{
+				read := middleware.RequirePermission(models.PermProjectsRead)
+				manage := middleware.RequirePermission(models.PermProjectsManage)
+				supervise := middleware.RequirePermission(models.PermProjectsSupervise)
+				submit := middleware.RequirePermission(models.PermProjectsSubmit)
+
+				projects.GET("/board", read, handler.HandleGetProjectBoard)                                              // Status board of a grade
+				projects.GET("/mine", submit, handler.HandleGetMyProjects)                                               // Own projects
+				projects.GET("/supervised", supervise, handler.HandleGetSupervisedProjects)                              // Projects to supervise
+				projects.POST("", manage, handler.HandleCreateProject)                                                   // Assign supervisor
+				projects.GET("/:id", handler.HandleGetProject)                                                           // Get project
+				projects.PUT("/:id", manage, handler.HandleUpdateProject)                                                // Change supervisor or title
+				projects.DELETE("/:id", manage, handler.HandleDeleteProject)                                             // Delete project
+				projects.POST("/:id/milestones", manage, handler.HandleAddMilestone)                                     // Add milestone
+				projects.PUT("/:id/milestones/:milestoneId", manage, handler.HandleUpdateMilestone)                      // Edit milestone
+				projects.DELETE("/:id/milestones/:milestoneId", manage, handler.HandleDeleteMilestone)                   // Delete milestone
+				projects.PUT("/:id/milestones/:milestoneId/completion", supervise, handler.HandleSetMilestoneCompletion) // Sign off or reopen milestone
+				projects.POST("/:id/drafts", submit, handler.HandleUploadProjectDraft)                                   // Upload draft
+				projects.GET("/:id/drafts/:draftId", handler.HandleDownloadProjectDraft)                                 // Download draft
+				projects.POST("/:id/comments", supervise, handler.HandleAddProjectComment)                               // Comment on project
+			}
+
+			// Timetable routes. Administrators manage time slots and rooms and
+			// schedule weekly lessons and exams; every user can see their own timetable.
+			timetable := protected.Group("/timetable")
+			{
+				read := middleware.RequirePermission(models.PermTimetableRead)
+				manage := middleware.RequirePermission(models.PermTimetableManage)
+
+				timetable.GET("/me", handler.HandleGetMyTimetable)                            // Own timetable
+				timetable.GET("/slots", read, handler.HandleGetTimeSlots)                     // List time slots
+				timetable.POST("/slots", manage, handler.HandleCreateTimeSlot)                // Create time slot
+				timetable.PUT("/slots/:id", manage, handler.HandleUpdateTimeSlot)             // Update time slot
+				timetable.DELETE("/slots/:id", manage, handler.HandleDeleteTimeSlot)          // Delete time slot
+				timetable.GET("/rooms", read, handler.HandleGetRooms)                         // List rooms
+				timetable.POST("/rooms", manage, handler.HandleCreateRoom)                    // Create room
+				timetable.PUT("/rooms/:id", manage, handler.HandleUpdateRoom)                 // Update room
+				timetable.DELETE("/rooms/:id", manage, handler.HandleDeleteRoom)              // Delete room
+				timetable.GET("/lessons", read, handler.HandleGetTimetableLessons)            // List lessons
+				timetable.POST("/lessons", manage, handler.HandleCreateTimetableLesson)       // Schedule lesson
+				timetable.PUT("/lessons/:id", manage, handler.HandleUpdateTimetableLesson)    // Move lesson
+				timetable.DELETE("/lessons/:id", manage, handler.HandleDeleteTimetableLesson) // Remove lesson
+				timetable.GET("/exams", read, handler.HandleGetExams)                         // List exams
+				timetable.POST("/exams", manage, handler.HandleCreateExam)                    // Schedule exam
+				timetable.PUT("/exams/:id", manage, handler.HandleUpdateExam)                 // Move exam
+				timetable.DELETE("/exams/:id", manage, handler.HandleDeleteExam)              // Remove exam
+				timetable.GET("/teachers/:id", read, handler.HandleGetTeacherTimetable)       // Teacher's timetable
+				timetable.GET("/students/:id", read, handler.HandleGetStudentTimetable)       // Student's timetable
+			}
+
+			// Homework routes. Teachers set homework and give feedback in the
+			// subjects they teach, enrolled students submit their work and
+			// homework:read grants read access to every subject.
+			homework := protected.Group("/homework")
+			{
+				manage := middleware.RequirePermission(models.PermHomeworkManage)
+				submit := middleware.RequirePermission(models.PermHomeworkSubmit)
+
+				homework.GET("/mine", submit, handler.HandleGetMyHomework)                                  // Own homework and submissions
+				homework.GET("/subjects/:id", handler.HandleGetSubjectHomework)                             // List homework of a subject
+				homework.POST("/subjects/:id", manage, handler.HandleCreateHomework)                        // Set homework
+				homework.GET("/:id", handler.HandleGetHomework)                                             // Get homework
+				homework.PUT("/:id", manage, handler.HandleUpdateHomework)                                  // Update homework
+				homework.DELETE("/:id", manage, handler.HandleDeleteHomework)                               // Delete homework
+				homework.POST("/:id/attachments", manage, handler.HandleUploadHomeworkAttachment)           // Attach file
+				homework.GET("/:id/attachments/:fileId", handler.HandleDownloadHomeworkAttachment)          // Download attachment
+				homework.DELETE("/:id/attachments/:fileId", manage, handler.HandleDeleteHomeworkAttachment) // Remove attachment
+				homework.POST("/:id/submissions", submit, handler.HandleSubmitHomework)                     // Submit or resubmit
+				homework.GET("/:id/submissions", handler.HandleGetHomeworkSubmissions)                      // List submissions
+				homework.GET("/submissions/:id/file", handler.HandleDownloadHomeworkSubmission)             // Download submitted file
+				homework.PUT("/submissions/:id/feedback", manage, handler.HandleSetHomeworkFeedback)        // Give feedback
+			}
+
+			// Guardian portal. Guardians see only the students they are linked
+			// to; RequireGuardianOf checks the link for every /:id route.
+			children := protected.Group("/guardian/children")
+			children.Use(middleware.RequirePermission(models.PermChildrenRead))
 			{
-				teachers.GET("", handler.GetAllTeachers)     // Get all teachers
-				teachers.GET("/:id", handler.GetTeacherByID) // Get teacher by ID
+				children.GET("", handler.HandleGetMyChildren) // Linked students
 
-				// Subject assignment (admin only)
-				teacherAdmin := teachers.Group("")
-				teacherAdmin.Use(middleware.AdminOnly())
+				child := children.Group("/:id")
+				child.Use(middleware.RequireGuardianOf(handler.Guardians))
 				{
-					teacherAdmin.POST("/:id/subjects", handler.AssignSubjectToTeacher)                // Assign subject
-					teacherAdmin.DELETE("/:id/subjects/:subjectId", handler.RemoveSubjectFromTeacher) // Remove subject
+					child.GET("", handler.HandleGetChild)                      // Student profile
+					child.GET("/subjects", handler.HandleGetChildSubjects)     // Enrolled subjects
+					child.GET("/attendance", handler.HandleGetChildAttendance) // Attendance per subject
+					child.GET("/grades", handler.HandleGetChildGrades)         // Gradebook per subject
 				}
 			}
 
-			// Admin routes group
+			// Calendar feed subscription of the caller's lessons and deadlines
+			calendar := protected.Group("/calendar")
+			{
+				calendar.GET("/feed", handler.HandleGetCalendarFeed)          // Get feed URL
+				calendar.POST("/feed/reset", handler.HandleResetCalendarFeed) // Replace feed URL
+			}
+
+			// Attendance routes. Teachers record and view attendance of the
+			// subjects they teach; attendance:read grants access to every subject.
+			attendance := protected.Group("/attendance")
+			{
+				record := middleware.RequirePermission(models.PermAttendanceRecord)
+				read := middleware.RequirePermission(models.PermAttendanceRead)
+
+				attendance.POST("/lessons", record, handler.HandleCreateLesson)                   // Create lesson with attendance
+				attendance.PUT("/lessons/:id/records", record, handler.HandleRecordAttendance)    // Add or correct records
+				attendance.GET("/lessons/:id", handler.HandleGetLesson)                           // Get lesson with records
+				attendance.GET("/subjects/:id/lessons", handler.HandleGetSubjectLessons)          // List lessons of a subject
+				attendance.GET("/subjects/:id/summary", handler.HandleGetSubjectAttendance)       // Summary per student
+				attendance.GET("/students/:id/summary", read, handler.HandleGetStudentAttendance) // Summary per subject
+			}
+
+			// Gradebook routes. Teachers manage the gradebooks of the subjects
+			// they teach; gradebook:read grants read access to every subject.
+			gradebook := protected.Group("/gradebook")
+			{
+				write := middleware.RequirePermission(models.PermGradebookWrite)
+
+				gradebook.GET("/subjects/:id/scheme", handler.HandleGetGradingScheme)                                 // Get categories and boundaries
+				gradebook.PUT("/subjects/:id/scheme", write, handler.HandleSetGradingScheme)                          // Replace categories and boundaries
+				gradebook.GET("/subjects/:id/assessments", handler.HandleGetSubjectAssessments)                       // List assessments
+				gradebook.POST("/subjects/:id/assessments", write, handler.HandleCreateAssessment)                    // Create assessment
+				gradebook.GET("/subjects/:id/grades", handler.HandleGetSubjectGrades)                                 // Current grades per student
+				gradebook.GET("/subjects/:id/students/:studentId", handler.HandleGetStudentGradebook)                 // Student's marks and predictions
+				gradebook.POST("/subjects/:id/students/:studentId/predicted", write, handler.HandleAddPredictedGrade) // Add predicted grade
+				gradebook.GET("/assessments/:id", handler.HandleGetAssessment)                                        // Get assessment with marks
+				gradebook.PUT("/assessments/:id", write, handler.HandleUpdateAssessment)                              // Update assessment
+				gradebook.DELETE("/assessments/:id", write, handler.HandleDeleteAssessment)                           // Delete assessment
+				gradebook.PUT("/assessments/:id/scores", write, handler.HandleRecordScores)                           // Add or correct marks
+			}
+
+			// Admin routes group; each subgroup requires its own permissions.
+			// Destructive and account security routes also require a two-factor
+			// session from roles listed in MFARequiredRoles.
 			admin := protected.Group("/admin")
-			admin.Use(middleware.AdminOnly())
 			{
+				requireMFA := middleware.RequireMFA(handler)
+
 				// Student management
 				students := admin.Group("/students")
 				{
-					students.GET("", handler.HandleGetAllStudents)       // Get all students
-					students.GET("/:id", handler.HandleGetStudent)       // Get specific student
-					students.POST("", handler.HandleCreateStudent)       // Create new student
-					students.PUT("/:id", handler.HandleUpdateStudent)    // Update student
-					students.DELETE("/:id", handler.HandleDeleteStudent) // Delete student
+					read := middleware.RequirePermission(models.PermStudentsRead)
+					write := middleware.RequirePermission(models.PermStudentsWrite)
+
+					students.GET("", read, handler.HandleGetAllStudents)                    // Get all students
+					students.GET("/export", read, handler.HandleExportStudents)             // Export students as CSV, XLSX or JSON
+					students.GET("/:id", read, handler.HandleGetStudent)                    // Get specific student
+					students.POST("", write, handler.HandleCreateStudent)                   // Create new student
+					students.POST("/import", write, handler.HandleImportStudents)           // Bulk import from CSV or XLSX
+					students.PUT("/:id", write, handler.HandleUpdateStudent)                // Update student
+					students.DELETE("/:id", write, requireMFA, handler.HandleDeleteStudent) // Delete student
+
+					// Subject enrollment
+					enrollRead := middleware.RequirePermission(models.PermEnrollmentsRead)
+					enrollWrite := middleware.RequirePermission(models.PermEnrollmentsWrite)
+
+					students.GET("/:id/enrollments", enrollRead, handler.HandleGetStudentEnrollments)          // Get enrollments and diploma check
+					students.POST("/:id/enrollments", enrollWrite, handler.HandleEnrollStudent)                // Enroll in subject
+					students.DELETE("/:id/enrollments/:subjectId", enrollWrite, handler.HandleUnenrollStudent) // Unenroll from subject
+				}
+
+				// Teacher management
+				teachers := admin.Group("/teachers")
+				teachers.Use(middleware.RequirePermission(models.PermTeachersWrite))
+				{
+					teachers.POST("", handler.CreateTeacher)                    // Create teacher and login account
+					teachers.PUT("/:id", handler.UpdateTeacher)                 // Update teacher profile
+					teachers.POST("/:id/deactivate", handler.DeactivateTeacher) // Block login and revoke sessions
+					teachers.POST("/:id/activate", handler.ActivateTeacher)     // Allow login again
+					teachers.DELETE("/:id", requireMFA, handler.DeleteTeacher)  // Delete teacher and login account
+				}
+
+				// Guardian management
+				guardians := admin.Group("/guardians")
+				guardians.Use(middleware.RequirePermission(models.PermGuardiansManage))
+				{
+					guardians.GET("", handler.GetAllGuardians)                                  // Get all guardians
+					guardians.GET("/:id", handler.GetGuardian)                                  // Get guardian with children
+					guardians.POST("", handler.CreateGuardian)                                  // Create guardian and login account
+					guardians.PUT("/:id", handler.UpdateGuardian)                               // Update guardian profile
+					guardians.DELETE("/:id", requireMFA, handler.DeleteGuardian)                // Delete guardian and login account
+					guardians.POST("/:id/students", handler.LinkGuardianStudent)                // Link to student
+					guardians.DELETE("/:id/students/:studentId", handler.UnlinkGuardianStudent) // Unlink from student
+				}
+
+				// Attendance report
+				admin.GET("/attendance/report",
+					middleware.RequirePermission(models.PermAttendanceRead),
+					handler.HandleGetAttendanceReport) // Students below the attendance threshold
+
+				// Session management
+				admin.POST("/users/:id/revoke-sessions",
+					middleware.RequirePermission(models.PermSessionsRevoke), requireMFA,
+					handler.HandleRevokeUserSessions) // Kill all sessions of a user
+				admin.POST("/users/:id/force-password-reset",
+					middleware.RequirePermission(models.PermPasswordsReset), requireMFA,
+					handler.HandleForcePasswordReset) // Require a new password at next login
+				admin.POST("/users/:id/mfa/reset",
+					middleware.RequirePermission(models.PermMFAReset), requireMFA,
+					handler.HandleResetUserMFA) // Turn off two-factor authentication of a user
+
+				// Login protection
+				logins := admin.Group("")
+				logins.Use(middleware.RequirePermission(models.PermLoginsManage), requireMFA)
+				{
+					logins.GET("/login-attempts", handler.GetLoginAttempts)               // List login attempts
+					logins.GET("/login-attempts/summary", handler.GetLoginFailureSummary) // Failed logins per address and username
+					logins.POST("/users/:id/unlock", handler.HandleUnlockUser)            // Unlock an account locked after failed logins
+				}
+
+				// Role management
+				roles := admin.Group("")
+				roles.Use(middleware.RequirePermission(models.PermRolesManage), requireMFA)
+				{
+					roles.GET("/permissions", handler.GetAllPermissions) // List known permissions
+					roles.GET("/roles", handler.GetAllRoles)             // Get all roles
+					roles.GET("/roles/:name", handler.GetRole)           // Get role
+					roles.POST("/roles", handler.CreateRole)             // Create role
+					roles.PUT("/roles/:name", handler.UpdateRole)        // Update role
+					roles.DELETE("/roles/:name", handler.DeleteRole)     // Delete role
+					roles.PUT("/users/:id/role", handler.SetUserRole)    // Change a user's role
 				}
 			}
 		}
@@ -83,13 +370,32 @@ func SetupRoutes(router *gin.Engine, handler *handlers.Handler) {
 
 // CORSMiddleware handles Cross-Origin Resource Sharing
 //
+// Parameters:
+//   - allowedOrigins: Origins allowed to make cross-origin requests ("*" for any)
+//
 // Returns:
 //   - gin.HandlerFunc: Middleware function for the Gin router
 //
-// This middleware adds appropriate CORS headers to allow cross-origin requests
-func CORSMiddleware() gin.HandlerFunc {
+// This middleware adds CORS headers for allowed origins. Requests from other
+// origins are still served but without CORS headers, so browsers block them.
+func CORSMiddleware(allowedOrigins []string) gin.HandlerFunc {
+	allowAny := false
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		if origin == "*" {
+			allowAny = true
+		}
+		allowed[origin] = true
+	}
+
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		origin := c.GetHeader("Origin")
+		if allowAny {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		} else if origin != "" && allowed[origin] {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Add("Vary", "Origin")
+		}
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
@@ -0,0 +1,27 @@
+// Package storage provides pluggable backends for uploaded files such as
+// homework attachments and submissions. Metadata about the files lives in the
+// database; a Storage only holds their content under opaque keys.
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when no file is stored under a key
+var ErrNotFound = errors.New("stored file not found")
+
+// ErrInvalidKey is returned for keys that are empty, absolute or escape the storage root
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage stores file content under keys chosen by the caller. Keys are
+// slash-separated relative paths, e.g. "homework/12/submissions/3f9a".
+type Storage interface {
+	// Put stores the content read from r under key, replacing any previous
+	// content, and returns the number of bytes written
+	Put(key string, r io.Reader) (int64, error)
+	// Open returns the content stored under key, or ErrNotFound
+	Open(key string) (io.ReadCloser, error)
+	// Delete removes the content stored under key; deleting a missing key is not an error
+	Delete(key string) error
+}
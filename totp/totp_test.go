@@ -0,0 +1,94 @@
+package totp_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"wg-edu-server/totp"
+)
+
+// rfcSecret is the SHA-1 seed of RFC 6238 appendix B, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	// The RFC lists 8 digit codes; codes of 6 digits are their last six
+	tests := []struct {
+		unix int64
+		rfc  string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		step := totp.Step(time.Unix(tt.unix, 0))
+		code, err := totp.Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tt.rfc[len(tt.rfc)-totp.Digits:]; code != want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, code, want)
+		}
+
+		// Spaced, lower-case and padded secrets are the same secret
+		spaced := strings.ToLower(rfcSecret[:16] + " " + rfcSecret[16:] + "====")
+		if other, err := totp.Code(spaced, step); err != nil || other != code {
+			t.Errorf("code at %d with %q = %s, %v, want %s", tt.unix, spaced, other, err, code)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := totp.Step(now)
+	code := func(step int64) string {
+		t.Helper()
+		c, err := totp.Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	if got, ok := totp.Verify(rfcSecret, "050 471", now, 0); !ok || got != step {
+		t.Errorf("Verify of the current code = %d, %v, want %d, true", got, ok, step)
+	}
+	if got, ok := totp.Verify(rfcSecret, code(step-1), now, 1); !ok || got != step-1 {
+		t.Errorf("Verify of the previous code = %d, %v, want %d, true", got, ok, step-1)
+	}
+	for _, tt := range []struct {
+		name string
+		code string
+		skew int
+	}{
+		{"previous code without skew", code(step - 1), 0},
+		{"code beyond skew", code(step + 2), 1},
+		{"8 digit code", "14050471", 1},
+		{"wrong code", "000000", 1},
+	} {
+		if _, ok := totp.Verify(rfcSecret, tt.code, now, tt.skew); ok {
+			t.Errorf("%s: Verify accepted %s", tt.name, tt.code)
+		}
+	}
+}
+
+func TestInvalidSecret(t *testing.T) {
+	for _, secret := range []string{"", "not base32!", "GEZDGNBV1"} {
+		if _, err := totp.Code(secret, 1); !errors.Is(err, totp.ErrInvalidSecret) {
+			t.Errorf("Code with %q: err = %v, want ErrInvalidSecret", secret, err)
+		}
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := totp.Code(secret, 1); err != nil {
+		t.Errorf("Code with generated secret %q: %v", secret, err)
+	}
+}